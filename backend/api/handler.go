@@ -31,16 +31,6 @@ func NewHandler(torrentClient *torrent.Client, torrentStore *db.TorrentStore) *H
 
 // AddMagnet handles requests to add a magnet link
 func (h *Handler) AddMagnet(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -82,16 +72,6 @@ func (h *Handler) AddMagnet(w http.ResponseWriter, r *http.Request) {
 
 // ListTorrents handles requests to list all torrents, just torrent client status
 func (h *Handler) ListTorrents(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -106,16 +86,6 @@ func (h *Handler) ListTorrents(w http.ResponseWriter, r *http.Request) {
 
 // UpdateMovieDetails handles requests to update movie details for a torrent
 func (h *Handler) UpdateMovieDetails(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -182,16 +152,6 @@ func (h *Handler) UpdateMovieDetails(w http.ResponseWriter, r *http.Request) {
 
 // StreamFile handles requests to stream a file from a torrent
 func (h *Handler) StreamFile(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Range, Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -361,16 +321,6 @@ func getContentTypeFromPath(path string) string {
 
 // GetMovieDetails handles requests to get movie details for all torrents
 func (h *Handler) GetMovieDetails(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -390,16 +340,6 @@ func (h *Handler) GetMovieDetails(w http.ResponseWriter, r *http.Request) {
 
 // SaveTorrentData handles requests to save torrent data including file paths to the database
 func (h *Handler) SaveTorrentData(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -449,21 +389,21 @@ func (h *Handler) SaveTorrentData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	torrentRecord := db.TorrentRecord{
-		InfoHash:   infoHash,
-		Name:       torrentData.Name,
-		Length:     torrentData.Length,
+	// The magnet link is left as stored, the client does not send it
+	dataPath := string(dataPathJSON)
+	update := db.TorrentUpdate{
+		Name:       &torrentData.Name,
+		Length:     &torrentData.Length,
 		Files:      torrentData.Files,
-		Downloaded: torrentData.Downloaded,
-		Progress:   torrentData.Progress,
-		State:      torrentData.State,
-		MagnetURI:  torrentData.InfoHash,
-		AddedAt:    torrentData.AddedAt,
-		DataPath:   string(dataPathJSON),
+		Downloaded: &torrentData.Downloaded,
+		Progress:   &torrentData.Progress,
+		State:      &torrentData.State,
+		AddedAt:    &torrentData.AddedAt,
+		DataPath:   &dataPath,
 	}
 
 	// Update the data_path in the database
-	if err := h.torrentStore.UpdateTorrent(&torrentRecord); err != nil {
+	if err := h.torrentStore.UpdateTorrent(infoHash, update); err != nil {
 		http.Error(w, "Failed to update data path: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
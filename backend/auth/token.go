@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// issuer 令牌签发者
+const issuer = "magnet-player"
+
+// ErrInvalidToken 令牌无效或已过期
+var ErrInvalidToken = errors.New("无效的访问令牌")
+
+// API密钥权限范围
+const (
+	// ScopeRead 只读，仅允许 GET/HEAD 请求
+	ScopeRead = "read"
+	// ScopeWrite 读写，允许添加/删除等修改操作
+	ScopeWrite = "write"
+)
+
+// 用户角色
+const (
+	// RoleAdmin 管理员，可以添加、删除和管理种子及用户
+	RoleAdmin = "admin"
+	// RoleViewer 观众，只能浏览和播放
+	RoleViewer = "viewer"
+)
+
+// ValidRole 判断是否为已知角色
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleViewer
+}
+
+// Claims JWT中携带的用户信息
+type Claims struct {
+	UserID   int64  `json:"uid"`
+	Username string `json:"username"`
+	// Scope 为空表示登录会话（完整权限），API密钥请求为 read 或 write
+	Scope string `json:"scope,omitempty"`
+	// Role 不写入令牌，每次校验时从数据库读取，修改角色后立即生效
+	Role string `json:"-"`
+	jwt.RegisteredClaims
+}
+
+// IsAdmin 是否为管理员
+func (c *Claims) IsAdmin() bool {
+	return c.Role == RoleAdmin
+}
+
+// IsAPIKey 是否为API密钥请求
+func (c *Claims) IsAPIKey() bool {
+	return c.Scope != ""
+}
+
+// Allows 判断当前权限是否允许指定的HTTP方法
+func (c *Claims) Allows(method string) bool {
+	switch c.Scope {
+	case "", ScopeWrite:
+		return true
+	case ScopeRead:
+		return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+	default:
+		return false
+	}
+}
+
+// TokenManager 负责签发和校验JWT
+type TokenManager struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewTokenManager 创建令牌管理器
+func NewTokenManager(secret string, ttl time.Duration) *TokenManager {
+	return &TokenManager{
+		secret: []byte(secret),
+		ttl:    ttl,
+	}
+}
+
+// Issue 为用户签发令牌，返回令牌及其过期时间
+func (m *TokenManager) Issue(userID int64, username string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(m.ttl)
+
+	claims := Claims{
+		UserID:   userID,
+		Username: username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   strconv.FormatInt(userID, 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("签发令牌失败: %w", err)
+	}
+
+	return token, expiresAt, nil
+}
+
+// Verify 校验令牌并返回其中的用户信息
+func (m *TokenManager) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return m.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	return claims, nil
+}
+
+// HashPassword 使用bcrypt生成密码哈希
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("生成密码哈希失败: %w", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword 校验密码是否与哈希匹配
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// claimsKey context中保存用户信息的键
+type claimsKey struct{}
+
+// WithClaims 将用户信息写入context
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext 从context中读取用户信息
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
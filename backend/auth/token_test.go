@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	m := NewTokenManager("secret", time.Hour)
+
+	token, expiresAt, err := m.Issue(42, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(expiresAt) <= 0 {
+		t.Fatalf("expiresAt should be in the future, got %v", expiresAt)
+	}
+
+	claims, err := m.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != 42 || claims.Username != "alice" {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestTokenRejected(t *testing.T) {
+	token, _, err := NewTokenManager("secret", time.Hour).Issue(1, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		manager *TokenManager
+		token   string
+	}{
+		"wrong secret": {NewTokenManager("other", time.Hour), token},
+		"garbage":      {NewTokenManager("secret", time.Hour), "not-a-token"},
+	}
+
+	expired, _, err := NewTokenManager("secret", -time.Minute).Issue(1, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases["expired"] = struct {
+		manager *TokenManager
+		token   string
+	}{NewTokenManager("secret", time.Hour), expired}
+
+	for name, tc := range cases {
+		if _, err := tc.manager.Verify(tc.token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
+
+func TestPasswordHash(t *testing.T) {
+	hash, err := HashPassword("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !CheckPassword(hash, "hunter2") {
+		t.Error("correct password rejected")
+	}
+	if CheckPassword(hash, "hunter3") {
+		t.Error("wrong password accepted")
+	}
+}
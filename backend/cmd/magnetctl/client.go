@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// apiPath is where every API route lives, below the server's base path
+const apiPath = "/api/v1"
+
+// client calls the server's HTTP API
+type client struct {
+	server   string
+	basePath string
+	token    string
+	apiKey   string
+	json     bool
+}
+
+// apiError is the error body every API route answers with
+type apiError struct {
+	Status    int    `json:"code"`
+	ErrorCode string `json:"errorCode"`
+	Message   string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	if e.ErrorCode != "" {
+		return fmt.Sprintf("%s (%d %s)", e.Message, e.Status, e.ErrorCode)
+	}
+	return fmt.Sprintf("%s (%d)", e.Message, e.Status)
+}
+
+// request sends a request to an API path and returns the response, turning
+// error statuses into an apiError. The caller closes the body.
+func (c *client) request(method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	base := strings.TrimRight(c.server, "/")
+	if basePath := strings.Trim(c.basePath, "/"); basePath != "" {
+		base += "/" + basePath
+	}
+	req, err := http.NewRequest(method, base+apiPath+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.apiKey != "" {
+		req.Header.Set("X-Api-Key", c.apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		apiErr := &apiError{Status: resp.StatusCode}
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+			if apiErr.Message == "" {
+				apiErr.Message = http.StatusText(resp.StatusCode)
+			}
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// call sends in as a JSON body, if it is not nil, and decodes the JSON
+// response into out. With --json the response is also printed as is.
+func (c *client) call(method, path string, in, out any) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	resp, err := c.request(method, path, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		os.Stdout.Write(data)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// decodeJSON decodes one JSON value from r into out
+func decodeJSON(r io.Reader, out any) error {
+	return json.NewDecoder(r).Decode(out)
+}
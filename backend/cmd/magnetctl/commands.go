@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// torrent is the part of the API's torrent object the commands print
+type torrent struct {
+	InfoHash     string    `json:"infoHash"`
+	Name         string    `json:"name"`
+	Length       int64     `json:"length"`
+	Progress     float32   `json:"progress"`
+	State        string    `json:"state"`
+	Category     string    `json:"category"`
+	AddedAt      time.Time `json:"addedAt"`
+	MovieDetails *struct {
+		Filename string `json:"filename"`
+		Year     int    `json:"year"`
+	} `json:"movieDetails"`
+}
+
+func newLoginCommand(api *client) *cobra.Command {
+	var username, password string
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Log in and print an access token for MAGNETCTL_TOKEN",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if password == "" {
+				fmt.Fprint(os.Stderr, "Password: ")
+				data, err := term.ReadPassword(int(os.Stdin.Fd()))
+				fmt.Fprintln(os.Stderr)
+				if err != nil {
+					return err
+				}
+				password = string(data)
+			}
+
+			var result struct {
+				Token     string    `json:"token"`
+				ExpiresAt time.Time `json:"expiresAt"`
+			}
+			body := map[string]string{"username": username, "password": password}
+			if err := api.call("POST", "/auth/login", body, &result); err != nil {
+				return err
+			}
+			if !api.json {
+				fmt.Println(result.Token)
+				fmt.Fprintf(os.Stderr, "expires %s\n", result.ExpiresAt.Local().Format(time.DateTime))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&username, "username", "u", "admin", "user name")
+	cmd.Flags().StringVarP(&password, "password", "p", "", "password, prompted for when empty")
+	return cmd
+}
+
+func newTorrentsCommand(api *client) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "torrents",
+		Aliases: []string{"torrent", "t"},
+		Short:   "List, add and delete torrents",
+	}
+	cmd.AddCommand(newListCommand(api), newAddCommand(api), newDeleteCommand(api))
+	return cmd
+}
+
+func newListCommand(api *client) *cobra.Command {
+	var state, category string
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List torrents",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := url.Values{}
+			if state != "" {
+				query.Set("state", state)
+			}
+			if category != "" {
+				query.Set("category", category)
+			}
+			path := "/torrents"
+			if len(query) > 0 {
+				path += "?" + query.Encode()
+			}
+
+			var torrents []torrent
+			if err := api.call("GET", path, nil, &torrents); err != nil || api.json {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "INFO HASH\tSTATE\tPROGRESS\tSIZE\tNAME")
+			for _, t := range torrents {
+				fmt.Fprintf(w, "%s\t%s\t%.1f%%\t%s\t%s\n", t.InfoHash, t.State, t.Progress*100, formatBytes(t.Length), t.Name)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&state, "state", "", "only torrents in this state, such as downloading or seeding")
+	cmd.Flags().StringVar(&category, "category", "", "only torrents in this category")
+	return cmd
+}
+
+func newAddCommand(api *client) *cobra.Command {
+	var private, autoMatch bool
+	cmd := &cobra.Command{
+		Use:   "add <magnet>...",
+		Short: "Add magnet links",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, magnet := range args {
+				var added torrent
+				body := map[string]any{"magnetUri": magnet, "private": private, "autoMatch": autoMatch}
+				if err := api.call("POST", "/torrents", body, &added); err != nil {
+					return fmt.Errorf("%s: %w", magnet, err)
+				}
+				if !api.json {
+					fmt.Printf("%s  %s\n", added.InfoHash, added.Name)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&private, "private", false, "treat as private torrents, without DHT, PEX or public trackers")
+	cmd.Flags().BoolVar(&autoMatch, "auto-match", false, "match movie or show details once the metadata arrives")
+	return cmd
+}
+
+func newDeleteCommand(api *client) *cobra.Command {
+	var deleteData, permanent bool
+	cmd := &cobra.Command{
+		Use:     "delete <info hash>...",
+		Aliases: []string{"rm"},
+		Short:   "Delete torrents, moving them to the trash unless --permanent is set",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := url.Values{}
+			query.Set("deleteData", fmt.Sprint(deleteData))
+			query.Set("permanent", fmt.Sprint(permanent))
+			for _, infoHash := range args {
+				if err := api.call("DELETE", "/torrents/"+url.PathEscape(infoHash)+"?"+query.Encode(), nil, nil); err != nil {
+					return fmt.Errorf("%s: %w", infoHash, err)
+				}
+				if !api.json {
+					fmt.Printf("deleted %s\n", infoHash)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&deleteData, "delete-data", false, "also delete the downloaded data")
+	cmd.Flags().BoolVar(&permanent, "permanent", false, "delete at once instead of moving to the trash")
+	return cmd
+}
+
+func newBackupCommand(api *client) *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Export the library (magnets, details, tags, playback positions) to a JSON file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output == "" {
+				output = "library-" + time.Now().Format("20060102") + ".json"
+			}
+			resp, err := api.request("GET", "/library/export", nil, "")
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			w := os.Stdout
+			if output != "-" {
+				file, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				w = file
+			}
+			n, err := io.Copy(w, resp.Body)
+			if err != nil {
+				return err
+			}
+			if output != "-" {
+				fmt.Fprintf(os.Stderr, "wrote %s to %s\n", formatBytes(n), output)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "file to write, - for stdout (default library-YYYYMMDD.json)")
+	return cmd
+}
+
+func newRestoreCommand(api *client) *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore <file>",
+		Short: "Import a library backup, skipping torrents that already exist",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			resp, err := api.request("POST", "/library/import", file, "application/json")
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if api.json {
+				_, err := io.Copy(os.Stdout, resp.Body)
+				return err
+			}
+
+			var result struct {
+				Results []struct {
+					InfoHash string `json:"infoHash"`
+					Name     string `json:"name"`
+					Status   string `json:"status"`
+					Error    string `json:"error"`
+				} `json:"results"`
+				Positions        int `json:"positions"`
+				PositionsSkipped int `json:"positionsSkipped"`
+			}
+			if err := decodeJSON(resp.Body, &result); err != nil {
+				return err
+			}
+			counts := map[string]int{}
+			for _, item := range result.Results {
+				counts[item.Status]++
+				if item.Status == "failed" {
+					fmt.Printf("failed %s  %s: %s\n", item.InfoHash, item.Name, item.Error)
+				}
+			}
+			fmt.Printf("%d imported, %d already present, %d failed; %d playback positions imported, %d skipped\n",
+				counts["imported"], counts["exists"], counts["failed"], result.Positions, result.PositionsSkipped)
+			return nil
+		},
+	}
+}
+
+func newBackfillCommand(api *client) *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "backfill",
+		Short: "Match movie or show details for torrents that have none",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var torrents []torrent
+			if err := api.call("GET", "/torrents", nil, &torrents); err != nil {
+				return err
+			}
+
+			matched, pending, failed := 0, 0, 0
+			for _, t := range torrents {
+				if t.MovieDetails != nil {
+					continue
+				}
+				if dryRun {
+					fmt.Printf("would match %s  %s\n", t.InfoHash, t.Name)
+					continue
+				}
+
+				var details struct {
+					Filename string `json:"filename"`
+					Year     int    `json:"year"`
+				}
+				quiet := *api
+				quiet.json = false
+				err := quiet.call("POST", "/torrents/"+t.InfoHash+"/rematch", struct{}{}, &details)
+				var apiErr *apiError
+				if errors.As(err, &apiErr) && apiErr.ErrorCode == "METADATA_PENDING" {
+					// Matching needs the file names, so wait for the metadata
+					pending++
+					continue
+				}
+				if err != nil {
+					fmt.Printf("failed %s  %s: %v\n", t.InfoHash, t.Name, err)
+					failed++
+					continue
+				}
+				fmt.Printf("matched %s  %s -> %s (%d)\n", t.InfoHash, t.Name, details.Filename, details.Year)
+				matched++
+			}
+			if !dryRun {
+				fmt.Printf("%d matched, %d waiting for metadata, %d failed\n", matched, pending, failed)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only list the torrents that would be matched")
+	return cmd
+}
+
+func newEventsCommand(api *client) *cobra.Command {
+	var types []string
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Print torrent events as they happen",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resp, err := api.request("GET", "/events", nil, "")
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			// The stream is Server-Sent Events; the data line carries the
+			// whole event, so event names and ping comments are skipped
+			scanner := bufio.NewScanner(resp.Body)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+				if !ok {
+					continue
+				}
+				var event struct {
+					Type     string    `json:"type"`
+					InfoHash string    `json:"infoHash"`
+					Time     time.Time `json:"time"`
+					Data     any       `json:"data"`
+				}
+				if err := decodeJSON(strings.NewReader(data), &event); err != nil {
+					continue
+				}
+				if len(types) > 0 && !matchesType(event.Type, types) {
+					continue
+				}
+				if api.json {
+					fmt.Println(data)
+					continue
+				}
+				fmt.Printf("%s  %-22s %s  %s\n", event.Time.Local().Format(time.TimeOnly), event.Type, event.InfoHash, summarize(event.Data))
+			}
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("server closed the event stream")
+		},
+	}
+	cmd.Flags().StringSliceVar(&types, "type", nil, "only these event types, such as torrent.state; a trailing * matches a prefix")
+	return cmd
+}
+
+// matchesType reports whether an event type is one of the wanted types
+func matchesType(eventType string, types []string) bool {
+	for _, want := range types {
+		if prefix, ok := strings.CutSuffix(want, "*"); ok && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+		if eventType == want {
+			return true
+		}
+	}
+	return false
+}
+
+// summarize prints the scalar fields of an event's data on one line
+func summarize(data any) string {
+	fields, ok := data.(map[string]any)
+	if !ok {
+		return ""
+	}
+	var parts []string
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		switch value := fields[key].(type) {
+		case string, float64, bool:
+			parts = append(parts, fmt.Sprintf("%s=%v", key, value))
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,68 @@
+// magnetctl manages a Magnet Player server through its HTTP API, for headless
+// servers and scripts.
+//
+//	magnetctl login -u admin
+//	export MAGNETCTL_TOKEN=...
+//	magnetctl torrents add 'magnet:?xt=urn:btih:...'
+//	magnetctl events
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCommand() *cobra.Command {
+	api := &client{}
+
+	root := &cobra.Command{
+		Use:          "magnetctl",
+		Short:        "Manage a Magnet Player server",
+		SilenceUsage: true,
+	}
+	flags := root.PersistentFlags()
+	flags.StringVar(&api.server, "server", envOr("MAGNETCTL_SERVER", "http://localhost:8080"), "server address (MAGNETCTL_SERVER)")
+	flags.StringVar(&api.basePath, "base-path", envOr("MAGNETCTL_BASE_PATH", "/magnet"), "the server's BASE_PATH (MAGNETCTL_BASE_PATH)")
+	flags.StringVar(&api.token, "token", os.Getenv("MAGNETCTL_TOKEN"), "access token from login (MAGNETCTL_TOKEN)")
+	flags.StringVar(&api.apiKey, "api-key", os.Getenv("MAGNETCTL_API_KEY"), "API key, used when no token is set (MAGNETCTL_API_KEY)")
+	flags.BoolVar(&api.json, "json", false, "print raw JSON responses")
+
+	root.AddCommand(
+		newLoginCommand(api),
+		newTorrentsCommand(api),
+		newBackupCommand(api),
+		newRestoreCommand(api),
+		newBackfillCommand(api),
+		newEventsCommand(api),
+	)
+	return root
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// formatBytes prints a size with a binary unit, such as 1.5 GiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -2,8 +2,13 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"unicode"
 
 	"github.com/joho/godotenv"
 )
@@ -21,6 +26,85 @@ type Config struct {
 	
 	// Torrent配置
 	Torrent TorrentConfig `json:"torrent"`
+
+	// 认证配置
+	Auth AuthConfig `json:"auth"`
+
+	// 日志配置
+	Log LogConfig `json:"log"`
+
+	// 自动清理配置
+	Retention RetentionConfig `json:"retention"`
+
+	// 种子索引器配置
+	Indexer IndexerConfig `json:"indexer"`
+
+	// DLNA 媒体服务器配置
+	DLNA DLNAConfig `json:"dlna"`
+
+	// 前端静态文件配置
+	Web WebConfig `json:"web"`
+
+	// 下载完成后处理配置
+	PostProcess PostProcessConfig `json:"post_process"`
+
+	// 媒体库整理配置
+	Organizer OrganizerConfig `json:"organizer"`
+}
+
+// OrganizerConfig 媒体库整理的默认设置，识别出影片信息后用硬链接建立整齐的媒体库目录，
+// 可在设置中修改，修改后的设置优先
+type OrganizerConfig struct {
+	Enabled         bool   `json:"enabled"`
+	LibraryDir      string `json:"library_dir"`      // 需与数据目录在同一文件系统，否则无法创建硬链接
+	MovieTemplate   string `json:"movie_template"`   // 电影的相对路径模板
+	EpisodeTemplate string `json:"episode_template"` // 剧集每一集的相对路径模板
+}
+
+// PostProcessConfig 种子下载完成后执行的外部命令，用于自定义重命名、移动等流程
+type PostProcessConfig struct {
+	Command    string `json:"command"`     // 通过 shell 执行的命令，为空时不启用
+	TimeoutSec int    `json:"timeout_sec"` // 单次执行超时（秒），超时后结束命令并记为失败
+}
+
+// WebConfig 前端静态文件配置，启用后在 / 下提供构建好的前端，单个程序即可部署
+type WebConfig struct {
+	Enabled bool   `json:"enabled"`
+	Dir     string `json:"dir"` // 前端构建目录，为空时使用编译进程序的文件
+}
+
+// DLNAConfig DLNA 媒体服务器配置，启用后通过 SSDP 在局域网内广播媒体库
+type DLNAConfig struct {
+	Enabled      bool   `json:"enabled"`
+	FriendlyName string `json:"friendly_name"` // 电视和播放器中显示的服务器名称
+}
+
+// IndexerConfig Torznab 索引器（Jackett、Prowlarr）配置，用于在应用内搜索种子
+type IndexerConfig struct {
+	URL        string `json:"url"`         // Torznab 地址，为空时不启用搜索
+	APIKey     string `json:"-"`           // 不序列化到JSON
+	TimeoutSec int    `json:"timeout_sec"` // 单次搜索超时（秒），Jackett 同时查询所有索引器时较慢
+}
+
+// RetentionConfig 自动清理已完成种子的规则，规则命中的种子连同数据一起删除
+type RetentionConfig struct {
+	CompletedDays   int     `json:"completed_days"`   // 下载完成 N 天后删除，0 表示不启用
+	DeleteWatched   bool    `json:"delete_watched"`   // 是否删除已看完的种子
+	WatchedDays     int     `json:"watched_days"`     // 看完 N 天后删除，0 表示立即删除
+	MaxDiskPercent  float64 `json:"max_disk_percent"` // 数据目录所在磁盘使用率超过该值时删除最早完成的种子，0 表示不启用
+	IntervalMinutes int     `json:"interval_minutes"` // 后台检查间隔
+	TrashDays       int     `json:"trash_days"`       // 用户删除的种子暂停后在回收站保留 N 天再清除，0 表示直接删除
+}
+
+// Enabled 是否启用了任一清理规则
+func (r RetentionConfig) Enabled() bool {
+	return r.CompletedDays > 0 || r.DeleteWatched || r.MaxDiskPercent > 0
+}
+
+// LogConfig 日志相关配置
+type LogConfig struct {
+	Format string `json:"format"` // json 或 text
+	Level  string `json:"level"`  // debug、info、warn、error
 }
 
 // ServerConfig 服务器配置
@@ -28,6 +112,31 @@ type ServerConfig struct {
 	Host string `json:"host"`
 	Port string `json:"port"`
 	Env  string `json:"env"`
+	// GRPCPort gRPC 接口端口，为空时不启动 gRPC 服务
+	GRPCPort string `json:"grpc_port"`
+	// BasePath 所有路由的公共前缀，反向代理以子路径转发时设置为该子路径，空字符串表示根路径
+	BasePath string `json:"base_path"`
+	// CORSOrigins 允许跨域访问的来源，* 表示任意来源；为空时开发环境允许任意来源，生产环境只允许本机前端
+	CORSOrigins []string `json:"cors_origins"`
+	// TLS HTTPS 配置，设置证书文件或自动申请证书的域名后启用
+	TLS TLSConfig `json:"tls"`
+}
+
+// TLSConfig HTTPS 配置，证书文件与 Let's Encrypt 自动证书二选一
+type TLSConfig struct {
+	CertFile        string   `json:"cert_file"`
+	KeyFile         string   `json:"key_file"`
+	AutocertDomains []string `json:"autocert_domains"` // 自动申请证书的域名，需要能从公网访问
+	AutocertEmail   string   `json:"autocert_email"`   // 证书到期等通知的联系邮箱，可以为空
+	AutocertDir     string   `json:"autocert_dir"`     // 保存证书和账号密钥的目录
+	// HTTPPort 同时监听的 HTTP 端口：完成 HTTP-01 验证、把其他请求重定向到 HTTPS，
+	// 并继续以 HTTP 提供 DLNA（电视不支持 HTTPS）；为空时不监听
+	HTTPPort string `json:"http_port"`
+}
+
+// Enabled 是否启用 HTTPS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != "" || len(t.AutocertDomains) > 0
 }
 
 // DatabaseConfig 数据库配置
@@ -42,16 +151,108 @@ type APIConfig struct {
 	JinaAPIKey  string `json:"-"` // 不序列化到JSON
 	TMDBAPIKey  string `json:"-"` // 不序列化到JSON
 	OpenAIAPIKey string `json:"-"` // 不序列化到JSON
+	AutoMatch    bool   `json:"auto_match"` // 元数据到达后自动识别并保存所有种子的电影或剧集详情
+	OMDbAPIKey   string `json:"-"`          // 设置后从OMDb补充IMDb评分、烂番茄评分和分级，不序列化到JSON
+	MetadataLanguage string `json:"metadata_language"` // TMDB 元数据语言，如 zh-CN、en-US
+
+	// 本地解析置信度低时用于识别文件名的AI服务
+	LLMProvider   string `json:"llm_provider"`    // none、coze、openai、jina、azure 或 ollama
+	LLMBaseURL    string `json:"llm_base_url"`    // 为空时使用服务的默认地址，azure 必须设置
+	LLMModel      string `json:"llm_model"`       // 为空时使用服务的默认模型，azure 为部署名称且必须设置
+	LLMAPIKey     string `json:"-"`               // 不序列化到JSON
+	LLMAPIVersion string `json:"llm_api_version"` // 仅 azure 使用
+	LLMTimeoutSec int    `json:"llm_timeout_sec"` // 单次请求超时（秒）
+	LLMRetries    int    `json:"llm_retries"`     // 失败后的重试次数
+}
+
+// llmProviders 支持的AI服务
+var llmProviders = map[string]bool{
+	"none": true, "coze": true, "openai": true, "jina": true, "azure": true, "ollama": true,
 }
 
 // TorrentConfig Torrent相关配置
 type TorrentConfig struct {
 	DataDir               string `json:"data_dir"`
-	MaxConnections        int    `json:"max_connections"`
+	MaxConnections        int    `json:"max_connections"` // 每个种子的连接数上限
+	MaxPeers              int    `json:"max_peers"`       // 每个种子保留的已知 peer 数上限
 	EnableDHT             bool   `json:"enable_dht"`
 	EnablePEX             bool   `json:"enable_pex"`
+	EnableWebTorrent      bool   `json:"enable_webtorrent"` // 通过 WebRTC 与浏览器中的 WebTorrent peer 交换数据
 	SeedEnabled           bool   `json:"seed_enabled"`
 	MetadataTimeoutSec    int    `json:"metadata_timeout_sec"`
+	MetadataRetries       int    `json:"metadata_retries"` // 元数据获取超时后的重试次数
+	MetadataWorkers       int    `json:"metadata_workers"` // 并发获取元数据的任务数
+	SeedRatioLimit        float64 `json:"seed_ratio_limit"`        // 全局分享率上限，0 表示不限制
+	SeedTimeLimitMinutes  int     `json:"seed_time_limit_minutes"` // 全局做种时长上限（分钟），0 表示不限制
+	SeedLimitAction       string  `json:"seed_limit_action"`       // 达到上限后的操作：pause 或 remove
+	PublicTrackers        []string `json:"public_trackers"`        // 添加到每个公开磁力链接的 tracker
+	TrackersListURL       string   `json:"trackers_list_url"`      // 定期拉取的 tracker 列表地址（每行一个），为空时不拉取
+	TrackersRefreshHours  int      `json:"trackers_refresh_hours"` // 拉取 tracker 列表的间隔（小时）
+	ListenPort            int      `json:"listen_port"`            // 监听端口，0 表示随机；私有种子使用下一个端口
+	PortForwarding        bool     `json:"port_forwarding"`        // 通过 UPnP 自动映射监听端口
+	ListenAddresses       []string `json:"listen_addresses"`       // 监听的本机地址，IPv4 和 IPv6 各最多一个，为空时监听所有网卡
+	EnableIPv6            bool     `json:"enable_ipv6"`            // 启用 IPv6 的 peer、DHT 和 tracker
+	BindInterface         string   `json:"bind_interface"`         // 所有种子流量只通过该网卡（如 VPN 的 tun0），网卡没有地址时拒绝启动
+	ICEServers            []string `json:"ice_servers"`            // WebTorrent 的 WebRTC 连接使用的 STUN/TURN 服务器
+	ICEUsername           string   `json:"ice_username"`           // TURN 服务器的用户名
+	ICECredential         string   `json:"-"`                      // TURN 服务器的密码，不序列化到JSON
+	DisableUTP            bool     `json:"disable_utp"`            // 不使用 uTP 连接 peer
+	DisableTCP            bool     `json:"disable_tcp"`            // 不使用 TCP 连接 peer
+	Encryption            string   `json:"encryption"`             // peer 连接加密策略：prefer、require 或 disable
+	IPCheckURL            string   `json:"ip_check_url"`           // 网络检查时查询外网IP的地址，为空时只使用 UPnP 网关报告的IP
+	DownloadLimitKBps     int      `json:"download_limit_kbps"`    // 总下载速度上限（KiB/s），0 表示不限制
+	UploadLimitKBps       int      `json:"upload_limit_kbps"`      // 总上传速度上限（KiB/s），0 表示不限制
+	DownloadCompleteOnly  bool     `json:"download_complete_only"` // 只允许直接下载已完成的文件
+	MaxStreams            int      `json:"max_streams"`            // 同时播放的会话数上限，0 表示不限制
+	StreamRateFactor      float64  `json:"stream_rate_factor"`     // 播放会话的限速，为文件估算码率的倍数，0 表示不限速
+	ReadaheadSeconds      int      `json:"readahead_seconds"`      // 播放时预读的时长（秒），按文件码率换算为字节
+	ReadaheadMinMB        int      `json:"readahead_min_mb"`       // 预读下限（MiB）
+	ReadaheadMaxMB        int      `json:"readahead_max_mb"`       // 预读上限（MiB），0 表示不限制
+	PrebufferMB           int      `json:"prebuffer_mb"`           // 获取元数据后优先下载每个视频文件首尾的大小（MiB），0 表示不优先
+	FailureRetries        int      `json:"failure_retries"`        // 种子操作在 torrent 库中异常（panic）后的重试次数，0 表示不重试
+}
+
+// DefaultPublicTrackers 未设置 TORRENT_PUBLIC_TRACKERS 时使用的公共 tracker
+var DefaultPublicTrackers = []string{
+	"udp://tracker.opentrackr.org:1337/announce",
+	"udp://tracker.openbittorrent.com:6969/announce",
+	"udp://open.stealth.si:80/announce",
+	"udp://exodus.desync.com:6969/announce",
+	"udp://explodie.org:6969/announce",
+	"http://tracker.opentrackr.org:1337/announce",
+	"http://tracker.openbittorrent.com:80/announce",
+	"udp://tracker.torrent.eu.org:451/announce",
+	"udp://tracker.moeking.me:6969/announce",
+	"udp://bt.oiyo.tk:6969/announce",
+	"https://tracker.nanoha.org:443/announce",
+	"https://tracker.lilithraws.org:443/announce",
+	// WebTorrent tracker，通过它们找到浏览器中的 peer
+	"wss://tracker.openwebtorrent.com",
+	"wss://tracker.webtorrent.dev",
+	"wss://tracker.btorrent.xyz",
+}
+
+// DefaultICEServers 未设置 TORRENT_ICE_SERVERS 时使用的 STUN 服务器
+var DefaultICEServers = []string{
+	"stun:stun.l.google.com:19302",
+	"stun:global.stun.twilio.com:3478",
+}
+
+// AuthConfig 认证相关配置
+type AuthConfig struct {
+	Enabled       bool   `json:"enabled"`         // 仅本机使用时可关闭认证
+	JWTSecret     string `json:"-"`               // 不序列化到JSON
+	TokenTTLHours int    `json:"token_ttl_hours"` // 令牌有效期（小时）
+	AdminUsername string `json:"admin_username"`  // 首次启动时创建的管理员账号
+	AdminPassword string `json:"-"`               // 不序列化到JSON
+	APIKeys       []APIKeyConfig `json:"-"`         // 静态API密钥，不序列化到JSON
+}
+
+// APIKeyConfig 静态API密钥配置，通过 API_KEYS=名称:权限:密钥,... 设置
+type APIKeyConfig struct {
+	Name  string
+	Scope string // read 只读，write 可添加/删除
+	Key   string
 }
 
 // Load 加载配置
@@ -61,9 +262,20 @@ func Load() (*Config, error) {
 	
 	config := &Config{
 		Server: ServerConfig{
-			Host: getEnvWithDefault("SERVER_HOST", "localhost"),
-			Port: getEnvWithDefault("SERVER_PORT", "8080"),
-			Env:  getEnvWithDefault("ENV", "development"),
+			Host:        getEnvWithDefault("SERVER_HOST", "localhost"),
+			Port:        getEnvWithDefault("SERVER_PORT", "8080"),
+			Env:         getEnvWithDefault("ENV", "development"),
+			GRPCPort:    getEnvWithDefault("GRPC_PORT", ""),
+			BasePath:    normalizeBasePath(getEnvWithDefault("BASE_PATH", "/magnet")),
+			CORSOrigins: ParseList(getEnvWithDefault("CORS_ALLOWED_ORIGINS", "")),
+			TLS: TLSConfig{
+				CertFile:        getEnvWithDefault("TLS_CERT_FILE", ""),
+				KeyFile:         getEnvWithDefault("TLS_KEY_FILE", ""),
+				AutocertDomains: ParseList(getEnvWithDefault("TLS_AUTOCERT_DOMAINS", "")),
+				AutocertEmail:   getEnvWithDefault("TLS_AUTOCERT_EMAIL", ""),
+				AutocertDir:     getEnvWithDefault("TLS_AUTOCERT_DIR", "./data/autocert"),
+				HTTPPort:        getEnvWithDefault("TLS_HTTP_PORT", ""),
+			},
 		},
 		Database: DatabaseConfig{
 			Path:            getEnvWithDefault("DB_PATH", "./data/torrents.db"),
@@ -71,19 +283,136 @@ func Load() (*Config, error) {
 			ConnMaxLifetime: getEnvIntWithDefault("DB_CONN_MAX_LIFETIME", 3600),
 		},
 		API: APIConfig{
-			JinaAPIKey:   getEnvWithDefault("JINA_API_KEY", ""),
-			TMDBAPIKey:   getEnvWithDefault("TMDB_API_KEY", ""),
-			OpenAIAPIKey: getEnvWithDefault("OPENAI_API_KEY", ""),
+			JinaAPIKey:    getEnvWithDefault("JINA_API_KEY", ""),
+			TMDBAPIKey:    getEnvWithDefault("TMDB_API_KEY", ""),
+			OpenAIAPIKey:  getEnvWithDefault("OPENAI_API_KEY", ""),
+			OMDbAPIKey:    getEnvWithDefault("OMDB_API_KEY", ""),
+			AutoMatch:     getEnvBoolWithDefault("METADATA_AUTO_MATCH", false),
+			MetadataLanguage: getEnvWithDefault("METADATA_LANGUAGE", "zh-CN"),
+			LLMProvider:   strings.ToLower(getEnvWithDefault("LLM_PROVIDER", "coze")),
+			LLMBaseURL:    getEnvWithDefault("LLM_BASE_URL", ""),
+			LLMModel:      getEnvWithDefault("LLM_MODEL", ""),
+			LLMAPIKey:     getEnvWithDefault("LLM_API_KEY", ""),
+			LLMAPIVersion: getEnvWithDefault("LLM_API_VERSION", ""),
+			LLMTimeoutSec: getEnvIntWithDefault("LLM_TIMEOUT", 60),
+			LLMRetries:    getEnvIntWithDefault("LLM_RETRIES", 2),
 		},
 		Torrent: TorrentConfig{
 			DataDir:            getEnvWithDefault("TORRENT_DATA_DIR", "./data"),
-			MaxConnections:     getEnvIntWithDefault("TORRENT_MAX_CONNECTIONS", 50),
+			MaxConnections:     getEnvIntWithDefault("TORRENT_MAX_CONNECTIONS", 100),
+			MaxPeers:           getEnvIntWithDefault("TORRENT_MAX_PEERS", 500),
 			EnableDHT:          getEnvBoolWithDefault("TORRENT_ENABLE_DHT", true),
 			EnablePEX:          getEnvBoolWithDefault("TORRENT_ENABLE_PEX", true),
+			EnableWebTorrent:   getEnvBoolWithDefault("TORRENT_ENABLE_WEBTORRENT", true),
 			SeedEnabled:        getEnvBoolWithDefault("TORRENT_SEED_ENABLED", true),
 			MetadataTimeoutSec: getEnvIntWithDefault("TORRENT_METADATA_TIMEOUT", 30),
+			MetadataRetries:    getEnvIntWithDefault("TORRENT_METADATA_RETRIES", 3),
+			MetadataWorkers:    getEnvIntWithDefault("TORRENT_METADATA_WORKERS", 4),
+			SeedRatioLimit:       getEnvFloatWithDefault("TORRENT_SEED_RATIO_LIMIT", 0),
+			SeedTimeLimitMinutes: getEnvIntWithDefault("TORRENT_SEED_TIME_LIMIT", 0),
+			SeedLimitAction:      getEnvWithDefault("TORRENT_SEED_LIMIT_ACTION", "pause"),
+			PublicTrackers:       parseTrackerList(getEnvWithDefault("TORRENT_PUBLIC_TRACKERS", strings.Join(DefaultPublicTrackers, ","))),
+			TrackersListURL:      getEnvWithDefault("TORRENT_TRACKERS_URL", ""),
+			TrackersRefreshHours: getEnvIntWithDefault("TORRENT_TRACKERS_REFRESH_HOURS", 24),
+			ListenPort:           getEnvIntWithDefault("TORRENT_LISTEN_PORT", 0),
+			PortForwarding:       getEnvBoolWithDefault("TORRENT_PORT_FORWARDING", true),
+			ListenAddresses:      ParseList(getEnvWithDefault("TORRENT_LISTEN_ADDRESS", "")),
+			EnableIPv6:           getEnvBoolWithDefault("TORRENT_ENABLE_IPV6", true),
+			BindInterface:        getEnvWithDefault("TORRENT_BIND_INTERFACE", ""),
+			ICEServers:           ParseList(getEnvWithDefault("TORRENT_ICE_SERVERS", strings.Join(DefaultICEServers, ","))),
+			ICEUsername:          getEnvWithDefault("TORRENT_ICE_USERNAME", ""),
+			ICECredential:        getEnvWithDefault("TORRENT_ICE_CREDENTIAL", ""),
+			DisableUTP:           getEnvBoolWithDefault("TORRENT_DISABLE_UTP", false),
+			DisableTCP:           getEnvBoolWithDefault("TORRENT_DISABLE_TCP", false),
+			Encryption:           getEnvWithDefault("TORRENT_ENCRYPTION", "prefer"),
+			IPCheckURL:           getEnvWithDefault("TORRENT_IP_CHECK_URL", "https://api.ipify.org"),
+			DownloadLimitKBps:    getEnvIntWithDefault("TORRENT_DOWNLOAD_LIMIT", 0),
+			UploadLimitKBps:      getEnvIntWithDefault("TORRENT_UPLOAD_LIMIT", 0),
+			DownloadCompleteOnly: getEnvBoolWithDefault("TORRENT_DOWNLOAD_COMPLETE_ONLY", false),
+			MaxStreams:           getEnvIntWithDefault("TORRENT_MAX_STREAMS", 0),
+			StreamRateFactor:     getEnvFloatWithDefault("TORRENT_STREAM_RATE_FACTOR", 0),
+			ReadaheadSeconds:     getEnvIntWithDefault("TORRENT_READAHEAD_SECONDS", 30),
+			ReadaheadMinMB:       getEnvIntWithDefault("TORRENT_READAHEAD_MIN_MB", 4),
+			ReadaheadMaxMB:       getEnvIntWithDefault("TORRENT_READAHEAD_MAX_MB", 64),
+			PrebufferMB:          getEnvIntWithDefault("TORRENT_PREBUFFER_MB", 4),
+			FailureRetries:       getEnvIntWithDefault("TORRENT_FAILURE_RETRIES", 1),
+		},
+		Auth: AuthConfig{
+			Enabled:       getEnvBoolWithDefault("AUTH_ENABLED", true),
+			JWTSecret:     getEnvWithDefault("JWT_SECRET", ""),
+			TokenTTLHours: getEnvIntWithDefault("AUTH_TOKEN_TTL_HOURS", 24*7),
+			AdminUsername: getEnvWithDefault("ADMIN_USERNAME", "admin"),
+			AdminPassword: getEnvWithDefault("ADMIN_PASSWORD", ""),
 		},
 	}
+
+	// 未设置 LLM_API_KEY 时沿用各服务原有的密钥变量
+	if config.API.LLMAPIKey == "" {
+		switch config.API.LLMProvider {
+		case "openai":
+			config.API.LLMAPIKey = config.API.OpenAIAPIKey
+		case "jina":
+			config.API.LLMAPIKey = config.API.JinaAPIKey
+		}
+	}
+
+	// none 表示不通过外部服务查询外网IP
+	if config.Torrent.IPCheckURL == "none" {
+		config.Torrent.IPCheckURL = ""
+	}
+
+	// 生产环境默认输出JSON日志，便于日志系统采集
+	defaultLogFormat := "text"
+	if config.IsProduction() {
+		defaultLogFormat = "json"
+	}
+	config.Log = LogConfig{
+		Format: getEnvWithDefault("LOG_FORMAT", defaultLogFormat),
+		Level:  getEnvWithDefault("LOG_LEVEL", "info"),
+	}
+
+	config.Retention = RetentionConfig{
+		CompletedDays:   getEnvIntWithDefault("RETENTION_COMPLETED_DAYS", 0),
+		DeleteWatched:   getEnvBoolWithDefault("RETENTION_DELETE_WATCHED", false),
+		WatchedDays:     getEnvIntWithDefault("RETENTION_WATCHED_DAYS", 0),
+		MaxDiskPercent:  getEnvFloatWithDefault("RETENTION_MAX_DISK_PERCENT", 0),
+		IntervalMinutes: getEnvIntWithDefault("RETENTION_INTERVAL_MINUTES", 60),
+		TrashDays:       getEnvIntWithDefault("TRASH_DAYS", 7),
+	}
+
+	config.Indexer = IndexerConfig{
+		URL:        strings.TrimSpace(getEnvWithDefault("INDEXER_URL", "")),
+		APIKey:     getEnvWithDefault("INDEXER_API_KEY", ""),
+		TimeoutSec: getEnvIntWithDefault("INDEXER_TIMEOUT", 60),
+	}
+
+	config.DLNA = DLNAConfig{
+		Enabled:      getEnvBoolWithDefault("DLNA_ENABLED", false),
+		FriendlyName: getEnvWithDefault("DLNA_NAME", "Magnet Player"),
+	}
+
+	config.Web = WebConfig{
+		Enabled: getEnvBoolWithDefault("WEB_ENABLED", true),
+		Dir:     strings.TrimSpace(getEnvWithDefault("WEB_DIR", "")),
+	}
+
+	config.PostProcess = PostProcessConfig{
+		Command:    strings.TrimSpace(getEnvWithDefault("POST_PROCESS_COMMAND", "")),
+		TimeoutSec: getEnvIntWithDefault("POST_PROCESS_TIMEOUT", 600),
+	}
+
+	config.Organizer = OrganizerConfig{
+		Enabled:         getEnvBoolWithDefault("ORGANIZER_ENABLED", false),
+		LibraryDir:      strings.TrimSpace(getEnvWithDefault("LIBRARY_DIR", filepath.Join(config.Torrent.DataDir, "library"))),
+		MovieTemplate:   getEnvWithDefault("ORGANIZER_MOVIE_TEMPLATE", "Movies/{title} ({year})/{title} ({year}){ext}"),
+		EpisodeTemplate: getEnvWithDefault("ORGANIZER_EPISODE_TEMPLATE", "TV/{title}/Season {season}/{title} - S{season}E{episode}{ext}"),
+	}
+
+	apiKeys, err := parseAPIKeys(getEnvWithDefault("API_KEYS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("配置验证失败: %w", err)
+	}
+	config.Auth.APIKeys = apiKeys
 	
 	// 验证必要的配置
 	if err := config.Validate(); err != nil {
@@ -98,6 +427,22 @@ func (c *Config) Validate() error {
 	if c.Server.Port == "" {
 		return fmt.Errorf("服务器端口不能为空")
 	}
+
+	if strings.ContainsAny(c.Server.BasePath, "{}?#% ") {
+		return fmt.Errorf("BASE_PATH 不能包含 {、}、?、#、%% 或空格")
+	}
+
+	if c.Server.GRPCPort != "" && c.Server.GRPCPort == c.Server.Port {
+		return fmt.Errorf("gRPC端口不能与HTTP端口相同")
+	}
+
+	if err := c.validateTLS(); err != nil {
+		return err
+	}
+
+	if err := c.validateListen(); err != nil {
+		return err
+	}
 	
 	if c.Database.Path == "" {
 		return fmt.Errorf("数据库路径不能为空")
@@ -106,10 +451,177 @@ func (c *Config) Validate() error {
 	if c.Torrent.DataDir == "" {
 		return fmt.Errorf("Torrent数据目录不能为空")
 	}
+
+	if c.Torrent.MaxConnections <= 0 || c.Torrent.MaxPeers <= 0 {
+		return fmt.Errorf("每个种子的连接数和peer数上限必须大于0")
+	}
+
+	if c.Torrent.MetadataTimeoutSec <= 0 || c.Torrent.MetadataWorkers <= 0 {
+		return fmt.Errorf("元数据超时时间和并发数必须大于0")
+	}
+
+	if c.Torrent.SeedRatioLimit < 0 || c.Torrent.SeedTimeLimitMinutes < 0 {
+		return fmt.Errorf("做种分享率和时长上限不能为负数")
+	}
+
+	if c.Torrent.SeedLimitAction != "pause" && c.Torrent.SeedLimitAction != "remove" {
+		return fmt.Errorf("做种上限操作必须为 pause 或 remove")
+	}
+
+	if c.Torrent.TrackersListURL != "" && c.Torrent.TrackersRefreshHours <= 0 {
+		return fmt.Errorf("tracker列表拉取间隔必须大于0")
+	}
+
+	if c.Torrent.DownloadLimitKBps < 0 || c.Torrent.UploadLimitKBps < 0 {
+		return fmt.Errorf("下载和上传速度上限不能为负数")
+	}
+
+	if c.Torrent.ListenPort < 0 || c.Torrent.ListenPort > 65534 {
+		return fmt.Errorf("监听端口必须在0到65534之间")
+	}
+
+	if c.Torrent.DisableUTP && c.Torrent.DisableTCP {
+		return fmt.Errorf("TORRENT_DISABLE_UTP和TORRENT_DISABLE_TCP不能同时启用")
+	}
+
+	for _, server := range c.Torrent.ICEServers {
+		if !strings.HasPrefix(server, "stun:") && !strings.HasPrefix(server, "stuns:") &&
+			!strings.HasPrefix(server, "turn:") && !strings.HasPrefix(server, "turns:") {
+			return fmt.Errorf("TORRENT_ICE_SERVERS中的地址必须以 stun:、stuns:、turn: 或 turns: 开头: %s", server)
+		}
+	}
+
+	if c.Torrent.Encryption != "prefer" && c.Torrent.Encryption != "require" && c.Torrent.Encryption != "disable" {
+		return fmt.Errorf("TORRENT_ENCRYPTION必须为 prefer、require 或 disable")
+	}
+
+	if c.Torrent.ReadaheadSeconds < 0 || c.Torrent.ReadaheadMinMB < 0 || c.Torrent.ReadaheadMaxMB < 0 || c.Torrent.PrebufferMB < 0 {
+		return fmt.Errorf("预读和预缓冲设置不能为负数")
+	}
+
+	if c.Torrent.FailureRetries < 0 {
+		return fmt.Errorf("TORRENT_FAILURE_RETRIES不能为负数")
+	}
+
+	// 限速低于码率时播放会卡顿
+	if c.Torrent.StreamRateFactor != 0 && c.Torrent.StreamRateFactor < 1 {
+		return fmt.Errorf("TORRENT_STREAM_RATE_FACTOR必须为0（不限速）或不小于1")
+	}
+
+	if c.Torrent.ReadaheadMaxMB > 0 && c.Torrent.ReadaheadMaxMB < c.Torrent.ReadaheadMinMB {
+		return fmt.Errorf("预读上限不能小于预读下限")
+	}
+
+	if !llmProviders[c.API.LLMProvider] {
+		return fmt.Errorf("LLM_PROVIDER必须为 none、coze、openai、jina、azure 或 ollama")
+	}
+
+	if c.API.LLMProvider == "azure" && (c.API.LLMBaseURL == "" || c.API.LLMModel == "") {
+		return fmt.Errorf("使用azure时必须设置LLM_BASE_URL和LLM_MODEL（部署名称）")
+	}
+
+	if c.API.LLMTimeoutSec <= 0 || c.API.LLMRetries < 0 {
+		return fmt.Errorf("AI请求超时时间必须大于0，重试次数不能为负数")
+	}
+
+	if c.Auth.Enabled && c.Auth.TokenTTLHours <= 0 {
+		return fmt.Errorf("令牌有效期必须大于0")
+	}
+
+	if c.Retention.CompletedDays < 0 || c.Retention.WatchedDays < 0 || c.Retention.TrashDays < 0 {
+		return fmt.Errorf("清理规则的天数不能为负数")
+	}
+
+	if c.Retention.MaxDiskPercent < 0 || c.Retention.MaxDiskPercent > 100 {
+		return fmt.Errorf("磁盘使用率上限必须在0到100之间")
+	}
+
+	if c.Retention.IntervalMinutes <= 0 {
+		return fmt.Errorf("清理检查间隔必须大于0")
+	}
+
+	if c.Indexer.URL != "" {
+		if u, err := url.Parse(c.Indexer.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("INDEXER_URL必须为 http 或 https 地址")
+		}
+	}
+
+	if c.Indexer.TimeoutSec <= 0 {
+		return fmt.Errorf("索引器搜索超时时间必须大于0")
+	}
+
+	if c.PostProcess.TimeoutSec <= 0 {
+		return fmt.Errorf("后处理命令超时时间必须大于0")
+	}
 	
 	return nil
 }
 
+// validateTLS 验证 HTTPS 配置
+func (c *Config) validateTLS() error {
+	tls := c.Server.TLS
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		return fmt.Errorf("TLS_CERT_FILE和TLS_KEY_FILE必须同时设置")
+	}
+	if tls.CertFile != "" && len(tls.AutocertDomains) > 0 {
+		return fmt.Errorf("证书文件和TLS_AUTOCERT_DOMAINS不能同时设置")
+	}
+	if len(tls.AutocertDomains) > 0 && tls.AutocertDir == "" {
+		return fmt.Errorf("使用自动证书时TLS_AUTOCERT_DIR不能为空")
+	}
+	if tls.HTTPPort == "" {
+		// DLNA 设备描述和媒体文件只能通过 HTTP 访问
+		if tls.Enabled() && c.DLNA.Enabled {
+			return fmt.Errorf("启用HTTPS和DLNA时必须设置TLS_HTTP_PORT")
+		}
+		return nil
+	}
+	if !tls.Enabled() {
+		return fmt.Errorf("TLS_HTTP_PORT仅在启用HTTPS时使用")
+	}
+	if tls.HTTPPort == c.Server.Port || tls.HTTPPort == c.Server.GRPCPort {
+		return fmt.Errorf("TLS_HTTP_PORT不能与HTTPS或gRPC端口相同")
+	}
+	return nil
+}
+
+// validateListen 验证种子客户端的监听地址和绑定网卡
+func (c *Config) validateListen() error {
+	if len(c.Torrent.ListenAddresses) > 0 && c.Torrent.BindInterface != "" {
+		return fmt.Errorf("TORRENT_LISTEN_ADDRESS和TORRENT_BIND_INTERFACE不能同时设置")
+	}
+	var ipv4, ipv6 int
+	for _, addr := range c.Torrent.ListenAddresses {
+		ip := net.ParseIP(addr)
+		switch {
+		case ip == nil:
+			return fmt.Errorf("TORRENT_LISTEN_ADDRESS中的 %s 不是有效的IP地址", addr)
+		case ip.To4() != nil:
+			ipv4++
+		default:
+			if !c.Torrent.EnableIPv6 {
+				return fmt.Errorf("未启用IPv6时不能监听IPv6地址 %s", addr)
+			}
+			ipv6++
+		}
+	}
+	if ipv4 > 1 || ipv6 > 1 {
+		return fmt.Errorf("TORRENT_LISTEN_ADDRESS中IPv4和IPv6地址各最多一个")
+	}
+	return nil
+}
+
+// ListenIPs 返回种子客户端监听的本机地址，需先通过 Validate 验证
+func (t TorrentConfig) ListenIPs() []net.IP {
+	var ips []net.IP
+	for _, addr := range t.ListenAddresses {
+		if ip := net.ParseIP(addr); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
 // IsProduction 判断是否为生产环境
 func (c *Config) IsProduction() bool {
 	return c.Server.Env == "production"
@@ -125,6 +637,22 @@ func (c *Config) GetServerAddress() string {
 	return c.Server.Host + ":" + c.Server.Port
 }
 
+// CORSOrigins 允许跨域访问的来源，返回 nil 时使用CORS中间件的默认来源
+func (c *Config) CORSOrigins() []string {
+	switch {
+	case len(c.Server.CORSOrigins) > 0:
+		return c.Server.CORSOrigins
+	case c.IsDevelopment():
+		return []string{"*"}
+	}
+	return nil
+}
+
+// GetGRPCAddress 获取 gRPC 服务地址
+func (c *Config) GetGRPCAddress() string {
+	return c.Server.Host + ":" + c.Server.GRPCPort
+}
+
 // 辅助函数
 
 // getEnvWithDefault 获取环境变量，如果不存在则返回默认值
@@ -145,6 +673,69 @@ func getEnvIntWithDefault(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvFloatWithDefault 获取浮点数环境变量，如果不存在或转换失败则返回默认值
+func getEnvFloatWithDefault(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// parseAPIKeys 解析 名称:权限:密钥 格式的静态API密钥列表
+func parseAPIKeys(value string) ([]APIKeyConfig, error) {
+	var keys []APIKeyConfig
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("API_KEYS格式错误，应为 名称:权限:密钥")
+		}
+		if parts[1] != "read" && parts[1] != "write" {
+			return nil, fmt.Errorf("API密钥 %s 的权限必须为 read 或 write", parts[0])
+		}
+		if len(parts[2]) < 16 {
+			return nil, fmt.Errorf("API密钥 %s 长度不能少于16个字符", parts[0])
+		}
+
+		keys = append(keys, APIKeyConfig{Name: parts[0], Scope: parts[1], Key: parts[2]})
+	}
+	return keys, nil
+}
+
+// parseTrackerList 解析以逗号或空白分隔的 tracker 列表，none 表示不使用公共 tracker
+func parseTrackerList(value string) []string {
+	if strings.TrimSpace(value) == "none" {
+		return []string{}
+	}
+	return ParseList(value)
+}
+
+// normalizeBasePath 统一基础路径的格式：以 / 开头、不以 / 结尾，根路径为空字符串
+func normalizeBasePath(value string) string {
+	value = strings.Trim(strings.TrimSpace(value), "/")
+	if value == "" {
+		return ""
+	}
+	return "/" + value
+}
+
+// ParseList 解析以逗号或空白分隔的列表
+func ParseList(value string) []string {
+	items := []string{}
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	}) {
+		items = append(items, item)
+	}
+	return items
+}
+
 // getEnvBoolWithDefault 获取布尔环境变量，如果不存在或转换失败则返回默认值
 func getEnvBoolWithDefault(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
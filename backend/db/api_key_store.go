@@ -0,0 +1,126 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// APIKey represents a per-user key for programmatic access. Only the hash of the
+// key is stored; the prefix is kept so users can tell their keys apart.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"userId"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// APIKeyStore handles the storage and retrieval of API keys
+type APIKeyStore struct {
+	db *sql.DB
+}
+
+// NewAPIKeyStore creates a new APIKeyStore sharing the manager's connection pool
+func NewAPIKeyStore(dbManager *DatabaseManager) *APIKeyStore {
+	return &APIKeyStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+// CreateAPIKey inserts a new key with its hash and fills in the generated id
+func (s *APIKeyStore) CreateAPIKey(key *APIKey, keyHash string) error {
+	key.CreatedAt = time.Now()
+
+	result, err := s.db.Exec(`
+		INSERT INTO api_keys (user_id, name, key_hash, key_prefix, scope, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, key.UserID, key.Name, keyHash, key.Prefix, key.Scope, key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("创建API密钥失败: %w", err)
+	}
+
+	key.ID, err = result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("获取API密钥ID失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetAPIKeyByHash retrieves a key by its hash, returning nil when not found
+func (s *APIKeyStore) GetAPIKeyByHash(keyHash string) (*APIKey, error) {
+	var key APIKey
+	var lastUsedAt sql.NullTime
+
+	err := s.db.QueryRow(`
+		SELECT id, user_id, name, key_prefix, scope, created_at, last_used_at
+		FROM api_keys WHERE key_hash = ?
+	`, keyHash).Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Scope, &key.CreatedAt, &lastUsedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询API密钥失败: %w", err)
+	}
+
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return &key, nil
+}
+
+// ListAPIKeys returns all keys belonging to a user
+func (s *APIKeyStore) ListAPIKeys(userID int64) ([]*APIKey, error) {
+	rows, err := s.db.Query(`
+		SELECT id, user_id, name, key_prefix, scope, created_at, last_used_at
+		FROM api_keys WHERE user_id = ? ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("查询API密钥失败: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		var key APIKey
+		var lastUsedAt sql.NullTime
+
+		if err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Scope, &key.CreatedAt, &lastUsedAt); err != nil {
+			return nil, fmt.Errorf("读取API密钥失败: %w", err)
+		}
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.Time
+		}
+		keys = append(keys, &key)
+	}
+
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey removes a user's key, reporting whether it existed
+func (s *APIKeyStore) DeleteAPIKey(userID, id int64) (bool, error) {
+	result, err := s.db.Exec("DELETE FROM api_keys WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return false, fmt.Errorf("删除API密钥失败: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("删除API密钥失败: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// UpdateLastUsed records when a key was last used
+func (s *APIKeyStore) UpdateLastUsed(id int64) error {
+	_, err := s.db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("更新API密钥使用时间失败: %w", err)
+	}
+	return nil
+}
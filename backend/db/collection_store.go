@@ -0,0 +1,93 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Collection is a TMDB collection together with the torrents in it
+type Collection struct {
+	MovieCollection
+	InfoHashes []string `json:"infoHashes"`
+}
+
+// CollectionStore handles collections and the torrents that belong to them
+type CollectionStore struct {
+	db *sql.DB
+}
+
+// NewCollectionStore creates a new CollectionStore sharing the manager's connection pool
+func NewCollectionStore(dbManager *DatabaseManager) *CollectionStore {
+	return &CollectionStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+// SetTorrentCollection saves the collection of a torrent, nil removes the
+// torrent from its collection. Collections left without torrents are deleted.
+func (s *CollectionStore) SetTorrentCollection(infoHash string, collection *MovieCollection) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("保存合集信息失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	collectionID := 0
+	if collection != nil && collection.TmdbId > 0 {
+		collectionID = collection.TmdbId
+		_, err := tx.Exec(`
+			INSERT INTO collections (tmdb_id, name, poster_url, backdrop_url, updated_at)
+			VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(tmdb_id) DO UPDATE SET
+				name = excluded.name,
+				poster_url = excluded.poster_url,
+				backdrop_url = excluded.backdrop_url,
+				updated_at = excluded.updated_at
+		`, collection.TmdbId, collection.Name, collection.PosterUrl, collection.BackdropUrl)
+		if err != nil {
+			return fmt.Errorf("保存合集信息失败: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE torrents SET collection_id = ? WHERE info_hash = ?", collectionID, infoHash); err != nil {
+		return fmt.Errorf("保存合集信息失败: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM collections WHERE tmdb_id NOT IN (SELECT collection_id FROM torrents)"); err != nil {
+		return fmt.Errorf("保存合集信息失败: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("保存合集信息失败: %w", err)
+	}
+	return nil
+}
+
+// ListCollections returns the collections that have torrents, ordered by
+// name, with the info hashes of their torrents in the order they were added
+func (s *CollectionStore) ListCollections() ([]*Collection, error) {
+	rows, err := s.db.Query(`
+		SELECT c.tmdb_id, c.name, c.poster_url, c.backdrop_url, t.info_hash
+		FROM collections c
+		JOIN torrents t ON t.collection_id = c.tmdb_id AND t.deleted_at IS NULL
+		ORDER BY c.name, c.tmdb_id, t.added_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("查询合集失败: %w", err)
+	}
+	defer rows.Close()
+
+	collections := []*Collection{}
+	for rows.Next() {
+		var collection MovieCollection
+		var infoHash string
+		if err := rows.Scan(&collection.TmdbId, &collection.Name, &collection.PosterUrl,
+			&collection.BackdropUrl, &infoHash); err != nil {
+			return nil, fmt.Errorf("读取合集失败: %w", err)
+		}
+		if n := len(collections); n == 0 || collections[n-1].TmdbId != collection.TmdbId {
+			collections = append(collections, &Collection{MovieCollection: collection, InfoHashes: []string{}})
+		}
+		last := collections[len(collections)-1]
+		last.InfoHashes = append(last.InfoHashes, infoHash)
+	}
+	return collections, rows.Err()
+}
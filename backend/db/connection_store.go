@@ -0,0 +1,61 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ConnectionStore handles the storage of per-torrent connection limits.
+// Torrents without a stored limit use the global setting.
+type ConnectionStore struct {
+	db *sql.DB
+}
+
+// NewConnectionStore creates a new ConnectionStore sharing the manager's connection pool
+func NewConnectionStore(dbManager *DatabaseManager) *ConnectionStore {
+	return &ConnectionStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+// GetMaxConnections returns a torrent's connection limit, 0 when none is stored
+func (s *ConnectionStore) GetMaxConnections(infoHash string) (int, error) {
+	var maxConnections int
+	err := s.db.QueryRow("SELECT max_connections FROM torrent_connections WHERE info_hash = ?", infoHash).Scan(&maxConnections)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("查询连接数设置失败: %w", err)
+	}
+	return maxConnections, nil
+}
+
+// SaveMaxConnections stores a torrent's connection limit; 0 removes it
+func (s *ConnectionStore) SaveMaxConnections(infoHash string, maxConnections int) error {
+	if maxConnections <= 0 {
+		return s.DeleteConnections(infoHash)
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO torrent_connections (info_hash, max_connections, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(info_hash) DO UPDATE SET
+			max_connections = excluded.max_connections,
+			updated_at = excluded.updated_at
+	`, infoHash, maxConnections, time.Now())
+	if err != nil {
+		return fmt.Errorf("保存连接数设置失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteConnections removes a torrent's connection limit
+func (s *ConnectionStore) DeleteConnections(infoHash string) error {
+	if _, err := s.db.Exec("DELETE FROM torrent_connections WHERE info_hash = ?", infoHash); err != nil {
+		return fmt.Errorf("删除连接数设置失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Episode is the TV episode a file of a torrent was matched to
+type Episode struct {
+	InfoHash  string  `json:"infoHash"`
+	FileIndex int     `json:"fileIndex"`
+	Season    int     `json:"season"`
+	Episode   int     `json:"episode"`
+	Title     string  `json:"title,omitempty"`
+	Overview  string  `json:"overview,omitempty"`
+	AirDate   string  `json:"airDate,omitempty"`
+	StillUrl  string  `json:"stillUrl,omitempty"`
+	Rating    float64 `json:"rating,omitempty"`
+	Runtime   int     `json:"runtime,omitempty"`
+	TmdbId    int     `json:"tmdbId,omitempty"`
+}
+
+// EpisodeStore handles the storage of per-file episode metadata
+type EpisodeStore struct {
+	db *sql.DB
+}
+
+// NewEpisodeStore creates a new EpisodeStore sharing the manager's connection pool
+func NewEpisodeStore(dbManager *DatabaseManager) *EpisodeStore {
+	return &EpisodeStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+// ReplaceEpisodes replaces all episodes of a torrent in one transaction
+func (s *EpisodeStore) ReplaceEpisodes(infoHash string, episodes []*Episode) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("保存剧集信息失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM torrent_episodes WHERE info_hash = ?", infoHash); err != nil {
+		return fmt.Errorf("保存剧集信息失败: %w", err)
+	}
+	for _, episode := range episodes {
+		_, err := tx.Exec(`
+			INSERT INTO torrent_episodes (
+				info_hash, file_index, season, episode, title, overview,
+				air_date, still_url, rating, runtime, tmdb_id
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, infoHash, episode.FileIndex, episode.Season, episode.Episode, episode.Title,
+			episode.Overview, episode.AirDate, episode.StillUrl, episode.Rating,
+			episode.Runtime, episode.TmdbId)
+		if err != nil {
+			return fmt.Errorf("保存剧集信息失败: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("保存剧集信息失败: %w", err)
+	}
+	return nil
+}
+
+// ListEpisodes returns the episodes of a torrent ordered by season and episode
+func (s *EpisodeStore) ListEpisodes(infoHash string) ([]*Episode, error) {
+	rows, err := s.db.Query(`
+		SELECT info_hash, file_index, season, episode, title, overview,
+			air_date, still_url, rating, runtime, tmdb_id
+		FROM torrent_episodes
+		WHERE info_hash = ?
+		ORDER BY season, episode, file_index
+	`, infoHash)
+	if err != nil {
+		return nil, fmt.Errorf("查询剧集信息失败: %w", err)
+	}
+	defer rows.Close()
+
+	episodes := []*Episode{}
+	for rows.Next() {
+		var episode Episode
+		if err := rows.Scan(&episode.InfoHash, &episode.FileIndex, &episode.Season,
+			&episode.Episode, &episode.Title, &episode.Overview, &episode.AirDate,
+			&episode.StillUrl, &episode.Rating, &episode.Runtime, &episode.TmdbId); err != nil {
+			return nil, fmt.Errorf("读取剧集信息失败: %w", err)
+		}
+		episodes = append(episodes, &episode)
+	}
+	return episodes, rows.Err()
+}
+
+// DeleteTorrentEpisodes removes all episodes of a torrent
+func (s *EpisodeStore) DeleteTorrentEpisodes(infoHash string) error {
+	if _, err := s.db.Exec("DELETE FROM torrent_episodes WHERE info_hash = ?", infoHash); err != nil {
+		return fmt.Errorf("删除剧集信息失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// LibraryLinkStore handles the storage of the hardlinks the organizer created
+// in the library, one per torrent file
+type LibraryLinkStore struct {
+	db *sql.DB
+}
+
+// NewLibraryLinkStore creates a new LibraryLinkStore sharing the manager's connection pool
+func NewLibraryLinkStore(dbManager *DatabaseManager) *LibraryLinkStore {
+	return &LibraryLinkStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+// ListLinks returns the link paths of a torrent by file index
+func (s *LibraryLinkStore) ListLinks(infoHash string) (map[int]string, error) {
+	rows, err := s.db.Query("SELECT file_index, path FROM library_links WHERE info_hash = ?", infoHash)
+	if err != nil {
+		return nil, fmt.Errorf("查询媒体库链接失败: %w", err)
+	}
+	defer rows.Close()
+
+	links := make(map[int]string)
+	for rows.Next() {
+		var fileIndex int
+		var path string
+		if err := rows.Scan(&fileIndex, &path); err != nil {
+			return nil, fmt.Errorf("读取媒体库链接失败: %w", err)
+		}
+		links[fileIndex] = path
+	}
+
+	return links, rows.Err()
+}
+
+// SaveLink stores the link path of a torrent file, replacing the previous one
+func (s *LibraryLinkStore) SaveLink(infoHash string, fileIndex int, path string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO library_links (info_hash, file_index, path, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(info_hash, file_index) DO UPDATE SET
+			path = excluded.path,
+			created_at = excluded.created_at
+	`, infoHash, fileIndex, path, time.Now())
+	if err != nil {
+		return fmt.Errorf("保存媒体库链接失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteLink removes the link record of a torrent file
+func (s *LibraryLinkStore) DeleteLink(infoHash string, fileIndex int) error {
+	if _, err := s.db.Exec("DELETE FROM library_links WHERE info_hash = ? AND file_index = ?", infoHash, fileIndex); err != nil {
+		return fmt.Errorf("删除媒体库链接失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteTorrentLinks removes all link records of a torrent
+func (s *LibraryLinkStore) DeleteTorrentLinks(infoHash string) error {
+	if _, err := s.db.Exec("DELETE FROM library_links WHERE info_hash = ?", infoHash); err != nil {
+		return fmt.Errorf("删除媒体库链接失败: %w", err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -14,6 +15,16 @@ type Migration struct {
 	Version     int
 	Description string
 	SQL         string
+	Down        string // 回滚SQL，为空时回滚只删除版本记录
+	NoTx        bool   // 在事务外执行（例如 PRAGMA journal_mode 不能在事务中修改）
+}
+
+// ErrSchemaTooNew 数据库由更新版本的程序迁移过，当前程序不认识其中的表结构
+var ErrSchemaTooNew = errors.New("数据库结构版本高于程序支持的版本")
+
+// LatestVersion 返回程序支持的最新结构版本
+func LatestVersion() int {
+	return migrations[len(migrations)-1].Version
 }
 
 // migrations 所有数据库迁移
@@ -38,6 +49,9 @@ var migrations = []Migration{
 				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 			)
 		`,
+		Down: `
+			DROP TABLE IF EXISTS torrents;
+		`,
 	},
 	{
 		Version:     2,
@@ -48,6 +62,12 @@ var migrations = []Migration{
 			CREATE INDEX IF NOT EXISTS idx_torrents_state ON torrents(state);
 			CREATE INDEX IF NOT EXISTS idx_torrents_progress ON torrents(progress);
 		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_torrents_name;
+			DROP INDEX IF EXISTS idx_torrents_added_at;
+			DROP INDEX IF EXISTS idx_torrents_state;
+			DROP INDEX IF EXISTS idx_torrents_progress;
+		`,
 	},
 	{
 		Version:     3,
@@ -58,16 +78,447 @@ var migrations = []Migration{
 				applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 			)
 		`,
+		// 回滚时保留该表，迁移版本本身记录在其中
 	},
 	{
 		Version:     4,
 		Description: "添加性能优化设置",
+		NoTx:        true,
 		SQL: `
 			PRAGMA journal_mode=WAL;
 			PRAGMA synchronous=NORMAL;
 			PRAGMA cache_size=10000;
 			PRAGMA temp_store=MEMORY;
 		`,
+		Down: `
+			PRAGMA journal_mode=DELETE;
+		`,
+	},
+	{
+		Version:     5,
+		Description: "创建users表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS users (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				username TEXT NOT NULL UNIQUE,
+				password_hash TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				last_login_at TIMESTAMP
+			)
+		`,
+		Down: `
+			DROP TABLE IF EXISTS users;
+		`,
+	},
+	{
+		Version:     6,
+		Description: "创建user_preferences表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS user_preferences (
+				user_id INTEGER PRIMARY KEY,
+				max_bitrate_kbps INTEGER DEFAULT 0,
+				audio_language TEXT DEFAULT '',
+				subtitle_language TEXT DEFAULT '',
+				force_transcode INTEGER DEFAULT 0,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)
+		`,
+		Down: `
+			DROP TABLE IF EXISTS user_preferences;
+		`,
+	},
+	{
+		Version:     7,
+		Description: "创建api_keys表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS api_keys (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				key_hash TEXT NOT NULL UNIQUE,
+				key_prefix TEXT NOT NULL,
+				scope TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				last_used_at TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS api_keys;
+		`,
+	},
+	{
+		Version:     8,
+		Description: "添加种子状态原因字段",
+		SQL: `
+			ALTER TABLE torrents ADD COLUMN state_reason TEXT DEFAULT '';
+		`,
+		Down: `
+			ALTER TABLE torrents DROP COLUMN state_reason;
+		`,
+	},
+	{
+		Version:     9,
+		Description: "创建torrent_seeding表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS torrent_seeding (
+				info_hash TEXT PRIMARY KEY,
+				uploaded INTEGER NOT NULL DEFAULT 0,
+				seeding_seconds INTEGER NOT NULL DEFAULT 0,
+				ratio_limit REAL,
+				time_limit_minutes INTEGER,
+				limit_action TEXT NOT NULL DEFAULT '',
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS torrent_seeding;
+		`,
+	},
+	{
+		Version:     10,
+		Description: "添加种子完成时间和观看时间字段",
+		SQL: `
+			ALTER TABLE torrents ADD COLUMN completed_at TIMESTAMP;
+			ALTER TABLE torrents ADD COLUMN watched_at TIMESTAMP;
+			UPDATE torrents SET completed_at = updated_at WHERE state IN ('completed', 'seeding');
+		`,
+		Down: `
+			ALTER TABLE torrents DROP COLUMN watched_at;
+			ALTER TABLE torrents DROP COLUMN completed_at;
+		`,
+	},
+	{
+		Version:     11,
+		Description: "创建torrent_trackers表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS torrent_trackers (
+				info_hash TEXT NOT NULL,
+				url TEXT NOT NULL,
+				removed INTEGER NOT NULL DEFAULT 0,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (info_hash, url)
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS torrent_trackers;
+		`,
+	},
+	{
+		Version:     12,
+		Description: "添加种子私有标记字段",
+		SQL: `
+			ALTER TABLE torrents ADD COLUMN private INTEGER NOT NULL DEFAULT 0;
+		`,
+		Down: `
+			ALTER TABLE torrents DROP COLUMN private;
+		`,
+	},
+	{
+		Version:     13,
+		Description: "创建RSS订阅表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS rss_feeds (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				url TEXT NOT NULL,
+				include_pattern TEXT NOT NULL DEFAULT '',
+				exclude_pattern TEXT NOT NULL DEFAULT '',
+				interval_minutes INTEGER NOT NULL DEFAULT 30,
+				private INTEGER NOT NULL DEFAULT 0,
+				enabled INTEGER NOT NULL DEFAULT 1,
+				last_checked_at TIMESTAMP,
+				last_error TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE TABLE IF NOT EXISTS rss_items (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				feed_id INTEGER NOT NULL,
+				guid TEXT NOT NULL,
+				title TEXT NOT NULL,
+				magnet_uri TEXT NOT NULL DEFAULT '',
+				info_hash TEXT NOT NULL DEFAULT '',
+				error TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (feed_id, guid)
+			);
+			CREATE INDEX IF NOT EXISTS idx_rss_items_info_hash ON rss_items(info_hash);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS rss_items;
+			DROP TABLE IF EXISTS rss_feeds;
+		`,
+	},
+	{
+		Version:     14,
+		Description: "添加种子分类和标签字段",
+		SQL: `
+			ALTER TABLE torrents ADD COLUMN category TEXT NOT NULL DEFAULT '';
+			ALTER TABLE torrents ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+			CREATE INDEX IF NOT EXISTS idx_torrents_category ON torrents(category);
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_torrents_category;
+			ALTER TABLE torrents DROP COLUMN tags;
+			ALTER TABLE torrents DROP COLUMN category;
+		`,
+	},
+	{
+		Version:     15,
+		Description: "创建playback_positions表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS playback_positions (
+				user_id INTEGER NOT NULL,
+				info_hash TEXT NOT NULL,
+				file_index INTEGER NOT NULL,
+				position_seconds REAL NOT NULL DEFAULT 0,
+				duration_seconds REAL NOT NULL DEFAULT 0,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (user_id, info_hash, file_index)
+			);
+			CREATE INDEX IF NOT EXISTS idx_playback_positions_recent ON playback_positions(user_id, updated_at);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS playback_positions;
+		`,
+	},
+	{
+		Version:     16,
+		Description: "添加用户角色和种子所有者字段",
+		SQL: `
+			ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'admin';
+			ALTER TABLE torrents ADD COLUMN added_by INTEGER NOT NULL DEFAULT 0;
+		`,
+		Down: `
+			ALTER TABLE torrents DROP COLUMN added_by;
+			ALTER TABLE users DROP COLUMN role;
+		`,
+	},
+	{
+		Version:     17,
+		Description: "创建torrent_episodes表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS torrent_episodes (
+				info_hash TEXT NOT NULL,
+				file_index INTEGER NOT NULL,
+				season INTEGER NOT NULL,
+				episode INTEGER NOT NULL,
+				title TEXT NOT NULL DEFAULT '',
+				overview TEXT NOT NULL DEFAULT '',
+				air_date TEXT NOT NULL DEFAULT '',
+				still_url TEXT NOT NULL DEFAULT '',
+				rating REAL NOT NULL DEFAULT 0,
+				runtime INTEGER NOT NULL DEFAULT 0,
+				tmdb_id INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (info_hash, file_index)
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS torrent_episodes;
+		`,
+	},
+	{
+		Version:     18,
+		Description: "创建collections表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS collections (
+				tmdb_id INTEGER PRIMARY KEY,
+				name TEXT NOT NULL,
+				poster_url TEXT NOT NULL DEFAULT '',
+				backdrop_url TEXT NOT NULL DEFAULT '',
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			ALTER TABLE torrents ADD COLUMN collection_id INTEGER NOT NULL DEFAULT 0;
+			CREATE INDEX IF NOT EXISTS idx_torrents_collection ON torrents(collection_id);
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_torrents_collection;
+			ALTER TABLE torrents DROP COLUMN collection_id;
+			DROP TABLE IF EXISTS collections;
+		`,
+	},
+	{
+		Version:     19,
+		Description: "创建settings表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS settings (
+				key TEXT PRIMARY KEY,
+				value TEXT NOT NULL,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS settings;
+		`,
+	},
+	{
+		Version:     20,
+		Description: "创建torrent_info表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS torrent_info (
+				info_hash TEXT PRIMARY KEY,
+				info BLOB NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS torrent_info;
+		`,
+	},
+	{
+		Version:     21,
+		Description: "添加种子回收站字段",
+		SQL: `
+			ALTER TABLE torrents ADD COLUMN deleted_at TIMESTAMP;
+			ALTER TABLE torrents ADD COLUMN delete_data INTEGER NOT NULL DEFAULT 0;
+			CREATE INDEX IF NOT EXISTS idx_torrents_deleted_at ON torrents(deleted_at);
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_torrents_deleted_at;
+			ALTER TABLE torrents DROP COLUMN delete_data;
+			ALTER TABLE torrents DROP COLUMN deleted_at;
+		`,
+	},
+	{
+		Version:     22,
+		Description: "创建stats_history表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS stats_history (
+				resolution INTEGER NOT NULL,
+				at INTEGER NOT NULL,
+				downloaded INTEGER NOT NULL DEFAULT 0,
+				uploaded INTEGER NOT NULL DEFAULT 0,
+				peer_sum INTEGER NOT NULL DEFAULT 0,
+				samples INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (resolution, at)
+			);
+			CREATE INDEX IF NOT EXISTS idx_stats_history_at ON stats_history(at);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS stats_history;
+		`,
+	},
+	{
+		Version:     23,
+		Description: "创建torrent_connections表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS torrent_connections (
+				info_hash TEXT PRIMARY KEY,
+				max_connections INTEGER NOT NULL,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS torrent_connections;
+		`,
+	},
+	{
+		Version:     24,
+		Description: "创建playable_files表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS playable_files (
+				info_hash TEXT NOT NULL,
+				file_index INTEGER NOT NULL,
+				playable_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (info_hash, file_index)
+			);
+			-- 已完成种子的视频文件视为已经可播放，升级后不再重复通知
+			INSERT OR IGNORE INTO playable_files (info_hash, file_index, playable_at)
+			SELECT t.info_hash, json_extract(f.value, '$.fileIndex'), t.completed_at
+			FROM torrents t, json_each(t.files) f
+			WHERE t.completed_at IS NOT NULL AND json_valid(t.files)
+				AND json_extract(f.value, '$.isVideo');
+		`,
+		Down: `
+			DROP TABLE IF EXISTS playable_files;
+		`,
+	},
+	{
+		Version:     25,
+		Description: "创建post_process_results表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS post_process_results (
+				info_hash TEXT PRIMARY KEY,
+				status TEXT NOT NULL,
+				exit_code INTEGER NOT NULL DEFAULT 0,
+				error TEXT NOT NULL DEFAULT '',
+				output TEXT NOT NULL DEFAULT '',
+				started_at TIMESTAMP NOT NULL,
+				finished_at TIMESTAMP
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS post_process_results;
+		`,
+	},
+	{
+		Version:     26,
+		Description: "创建library_links表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS library_links (
+				info_hash TEXT NOT NULL,
+				file_index INTEGER NOT NULL,
+				path TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (info_hash, file_index)
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS library_links;
+		`,
+	},
+	{
+		Version:     27,
+		Description: "添加种子最近错误字段",
+		SQL: `
+			ALTER TABLE torrents ADD COLUMN last_error TEXT NOT NULL DEFAULT '';
+		`,
+		Down: `
+			ALTER TABLE torrents DROP COLUMN last_error;
+		`,
+	},
+	{
+		Version:     28,
+		Description: "创建stream_log表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS stream_log (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				remote_addr TEXT NOT NULL DEFAULT '',
+				user_agent TEXT NOT NULL DEFAULT '',
+				kind TEXT NOT NULL,
+				info_hash TEXT NOT NULL,
+				file_index INTEGER NOT NULL,
+				file_path TEXT NOT NULL DEFAULT '',
+				file_length INTEGER NOT NULL DEFAULT 0,
+				title TEXT NOT NULL DEFAULT '',
+				started_at INTEGER NOT NULL,
+				ended_at INTEGER NOT NULL,
+				bytes_read INTEGER NOT NULL DEFAULT 0,
+				last_offset INTEGER NOT NULL DEFAULT 0
+			);
+			CREATE INDEX IF NOT EXISTS idx_stream_log_ended_at ON stream_log(ended_at);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS stream_log;
+		`,
+	},
+	{
+		Version:     29,
+		Description: "创建torrent_webseeds表",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS torrent_webseeds (
+				info_hash TEXT NOT NULL,
+				url TEXT NOT NULL,
+				removed INTEGER NOT NULL DEFAULT 0,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (info_hash, url)
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS torrent_webseeds;
+		`,
 	},
 }
 
@@ -78,8 +529,24 @@ type DatabaseManager struct {
 	connTimeout    time.Duration
 }
 
-// NewDatabaseManager 创建数据库管理器
+// NewDatabaseManager 创建数据库管理器，并把数据库迁移到最新版本
 func NewDatabaseManager(dbPath string, maxConnections int, connTimeout time.Duration) (*DatabaseManager, error) {
+	manager, err := OpenDatabaseManager(dbPath, maxConnections, connTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// 执行数据库迁移
+	if err := manager.migrate(); err != nil {
+		manager.Close()
+		return nil, fmt.Errorf("数据库迁移失败: %w", err)
+	}
+
+	return manager, nil
+}
+
+// OpenDatabaseManager 打开数据库但不执行迁移，供 migrate 命令使用
+func OpenDatabaseManager(dbPath string, maxConnections int, connTimeout time.Duration) (*DatabaseManager, error) {
 	db, err := sql.Open("sqlite", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("打开数据库失败: %w", err)
@@ -90,28 +557,51 @@ func NewDatabaseManager(dbPath string, maxConnections int, connTimeout time.Dura
 	db.SetMaxIdleConns(maxConnections / 2)
 	db.SetConnMaxLifetime(connTimeout)
 
-	manager := &DatabaseManager{
+	return &DatabaseManager{
 		db:             db,
 		maxConnections: maxConnections,
 		connTimeout:    connTimeout,
-	}
-
-	// 执行数据库迁移
-	if err := manager.migrate(); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("数据库迁移失败: %w", err)
-	}
-
-	return manager, nil
+	}, nil
 }
 
 // migrate 执行数据库迁移
 func (dm *DatabaseManager) migrate() error {
 	log.Println("开始数据库迁移...")
 
-	// 首先创建迁移表（如果不存在）
+	if err := dm.MigrateTo(LatestVersion()); err != nil {
+		return err
+	}
+
+	log.Println("数据库迁移完成")
+	return nil
+}
+
+// SchemaVersion 返回数据库当前的结构版本，即已应用的最高迁移版本，空数据库为 0
+func (dm *DatabaseManager) SchemaVersion() (int, error) {
 	if err := dm.createMigrationTable(); err != nil {
-		return fmt.Errorf("创建迁移表失败: %w", err)
+		return 0, fmt.Errorf("创建迁移表失败: %w", err)
+	}
+	var version int
+	if err := dm.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("获取迁移版本失败: %w", err)
+	}
+	return version, nil
+}
+
+// MigrateTo 把数据库迁移到指定版本：应用不高于该版本的未应用迁移，按版本从高到低回滚高于该版本的迁移
+// 数据库结构比程序新时返回 ErrSchemaTooNew，因为程序没有更新迁移的回滚SQL
+func (dm *DatabaseManager) MigrateTo(target int) error {
+	latest := LatestVersion()
+	if target < 0 || target > latest {
+		return fmt.Errorf("无效的迁移版本 %d，可用范围 0-%d", target, latest)
+	}
+
+	current, err := dm.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("%w: 数据库为 v%d，程序最高支持 v%d，请使用新版本程序执行 migrate to %d 后再降级", ErrSchemaTooNew, current, latest, latest)
 	}
 
 	// 获取已应用的迁移版本
@@ -122,21 +612,56 @@ func (dm *DatabaseManager) migrate() error {
 
 	// 执行未应用的迁移
 	for _, migration := range migrations {
-		if !contains(appliedVersions, migration.Version) {
+		if migration.Version <= target && !contains(appliedVersions, migration.Version) {
 			log.Printf("应用迁移 v%d: %s", migration.Version, migration.Description)
-			
+
 			if err := dm.applyMigration(migration); err != nil {
 				return fmt.Errorf("应用迁移 v%d 失败: %w", migration.Version, err)
 			}
-			
+
 			log.Printf("迁移 v%d 应用成功", migration.Version)
 		}
 	}
 
-	log.Println("数据库迁移完成")
+	// 回滚高于目标版本的迁移
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version > target && contains(appliedVersions, migration.Version) {
+			log.Printf("回滚迁移 v%d: %s", migration.Version, migration.Description)
+
+			if err := dm.rollbackMigration(migration); err != nil {
+				return fmt.Errorf("回滚迁移 v%d 失败: %w", migration.Version, err)
+			}
+
+			log.Printf("迁移 v%d 回滚成功", migration.Version)
+		}
+	}
+
 	return nil
 }
 
+// MigrateDown 回滚最近应用的一个迁移
+func (dm *DatabaseManager) MigrateDown() error {
+	current, err := dm.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current == 0 {
+		return nil
+	}
+	appliedVersions, err := dm.getAppliedVersions()
+	if err != nil {
+		return fmt.Errorf("获取迁移版本失败: %w", err)
+	}
+	target := 0
+	for _, version := range appliedVersions {
+		if version < current {
+			target = version
+		}
+	}
+	return dm.MigrateTo(target)
+}
+
 // createMigrationTable 创建迁移表
 func (dm *DatabaseManager) createMigrationTable() error {
 	_, err := dm.db.Exec(`
@@ -170,6 +695,17 @@ func (dm *DatabaseManager) getAppliedVersions() ([]int, error) {
 
 // applyMigration 应用单个迁移
 func (dm *DatabaseManager) applyMigration(migration Migration) error {
+	if migration.NoTx {
+		if _, err := dm.db.Exec(migration.SQL); err != nil {
+			return fmt.Errorf("执行迁移SQL失败: %w", err)
+		}
+		_, err := dm.db.Exec("INSERT INTO schema_migrations (version) VALUES (?)", migration.Version)
+		if err != nil {
+			return fmt.Errorf("记录迁移版本失败: %w", err)
+		}
+		return nil
+	}
+
 	tx, err := dm.db.Begin()
 	if err != nil {
 		return err
@@ -192,6 +728,38 @@ func (dm *DatabaseManager) applyMigration(migration Migration) error {
 	return tx.Commit()
 }
 
+// rollbackMigration 回滚单个迁移
+func (dm *DatabaseManager) rollbackMigration(migration Migration) error {
+	if migration.NoTx {
+		if migration.Down != "" {
+			if _, err := dm.db.Exec(migration.Down); err != nil {
+				return fmt.Errorf("执行回滚SQL失败: %w", err)
+			}
+		}
+		if _, err := dm.db.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+			return fmt.Errorf("删除迁移版本失败: %w", err)
+		}
+		return nil
+	}
+
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if migration.Down != "" {
+		if _, err := tx.Exec(migration.Down); err != nil {
+			return fmt.Errorf("执行回滚SQL失败: %w", err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+		return fmt.Errorf("删除迁移版本失败: %w", err)
+	}
+
+	return tx.Commit()
+}
+
 // GetDB 获取数据库连接
 func (dm *DatabaseManager) GetDB() *sql.DB {
 	return dm.db
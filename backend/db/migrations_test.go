@@ -0,0 +1,79 @@
+package db
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestManager(t *testing.T, dbPath string) *DatabaseManager {
+	t.Helper()
+	manager, err := NewDatabaseManager(dbPath, 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manager
+}
+
+func tableCount(t *testing.T, manager *DatabaseManager) int {
+	t.Helper()
+	var count int
+	if err := manager.GetDB().QueryRow(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'",
+	).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestMigrationsRollBackAndReapply(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	manager := openTestManager(t, filepath.Join(t.TempDir(), "migrate.db"))
+	defer manager.Close()
+	tables := tableCount(t, manager)
+
+	for version := LatestVersion(); version > 0; version-- {
+		if err := manager.MigrateDown(); err != nil {
+			t.Fatalf("回滚 v%d: %v", version, err)
+		}
+		current, err := manager.SchemaVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current != version-1 {
+			t.Fatalf("回滚 v%d 后版本为 v%d", version, current)
+		}
+	}
+	if got := tableCount(t, manager); got != 1 {
+		t.Fatalf("全部回滚后剩余 %d 张表，应只剩 schema_migrations", got)
+	}
+
+	if err := manager.MigrateTo(LatestVersion()); err != nil {
+		t.Fatal(err)
+	}
+	if got := tableCount(t, manager); got != tables {
+		t.Fatalf("重新迁移后有 %d 张表，应为 %d", got, tables)
+	}
+}
+
+func TestNewerSchemaRefused(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dbPath := filepath.Join(t.TempDir(), "newer.db")
+	manager := openTestManager(t, dbPath)
+	if _, err := manager.GetDB().Exec("INSERT INTO schema_migrations (version) VALUES (?)", LatestVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+	manager.Close()
+
+	if _, err := NewDatabaseManager(dbPath, 1, time.Hour); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("err = %v, want ErrSchemaTooNew", err)
+	}
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PlaybackPosition is the last watched position of one file of a torrent,
+// per user. Position and Duration are in seconds; Duration is 0 when the
+// player did not report it.
+type PlaybackPosition struct {
+	UserID    int64     `json:"userId"`
+	InfoHash  string    `json:"infoHash"`
+	FileIndex int       `json:"fileIndex"`
+	Position  float64   `json:"position"`
+	Duration  float64   `json:"duration"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// PlaybackStore handles the storage of playback positions
+type PlaybackStore struct {
+	db *sql.DB
+}
+
+// NewPlaybackStore creates a new PlaybackStore sharing the manager's connection pool
+func NewPlaybackStore(dbManager *DatabaseManager) *PlaybackStore {
+	return &PlaybackStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+// SavePosition inserts or replaces the position of a file
+func (s *PlaybackStore) SavePosition(position *PlaybackPosition) error {
+	position.UpdatedAt = time.Now()
+
+	_, err := s.db.Exec(`
+		INSERT OR REPLACE INTO playback_positions (
+			user_id, info_hash, file_index, position_seconds, duration_seconds, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?)
+	`, position.UserID, position.InfoHash, position.FileIndex, position.Position,
+		position.Duration, position.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("保存播放进度失败: %w", err)
+	}
+	return nil
+}
+
+// ImportPosition inserts or replaces a position, keeping its UpdatedAt, as
+// when moving positions over from another instance
+func (s *PlaybackStore) ImportPosition(position *PlaybackPosition) error {
+	_, err := s.db.Exec(`
+		INSERT OR REPLACE INTO playback_positions (
+			user_id, info_hash, file_index, position_seconds, duration_seconds, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?)
+	`, position.UserID, position.InfoHash, position.FileIndex, position.Position,
+		position.Duration, position.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("保存播放进度失败: %w", err)
+	}
+	return nil
+}
+
+// ListAllPositions returns the positions of every user for every torrent
+func (s *PlaybackStore) ListAllPositions() ([]*PlaybackPosition, error) {
+	return s.query(`
+		SELECT user_id, info_hash, file_index, position_seconds, duration_seconds, updated_at
+		FROM playback_positions
+		ORDER BY info_hash, user_id, file_index
+	`)
+}
+
+// ListPositions returns a user's positions for the files of one torrent
+func (s *PlaybackStore) ListPositions(userID int64, infoHash string) ([]*PlaybackPosition, error) {
+	return s.query(`
+		SELECT user_id, info_hash, file_index, position_seconds, duration_seconds, updated_at
+		FROM playback_positions
+		WHERE user_id = ? AND info_hash = ?
+		ORDER BY file_index
+	`, userID, infoHash)
+}
+
+// ListInProgress returns a user's started but unfinished positions, most
+// recently watched first. A file counts as finished once the position reaches
+// finishedRatio of its duration.
+func (s *PlaybackStore) ListInProgress(userID int64, finishedRatio float64) ([]*PlaybackPosition, error) {
+	return s.query(`
+		SELECT user_id, info_hash, file_index, position_seconds, duration_seconds, updated_at
+		FROM playback_positions
+		WHERE user_id = ? AND position_seconds > 0
+		  AND (duration_seconds = 0 OR position_seconds < duration_seconds * ?)
+		ORDER BY updated_at DESC
+	`, userID, finishedRatio)
+}
+
+// DeletePosition removes the position of a file
+func (s *PlaybackStore) DeletePosition(userID int64, infoHash string, fileIndex int) error {
+	_, err := s.db.Exec(`
+		DELETE FROM playback_positions
+		WHERE user_id = ? AND info_hash = ? AND file_index = ?
+	`, userID, infoHash, fileIndex)
+	if err != nil {
+		return fmt.Errorf("删除播放进度失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteTorrentPositions removes every user's positions for a torrent
+func (s *PlaybackStore) DeleteTorrentPositions(infoHash string) error {
+	if _, err := s.db.Exec("DELETE FROM playback_positions WHERE info_hash = ?", infoHash); err != nil {
+		return fmt.Errorf("删除播放进度失败: %w", err)
+	}
+	return nil
+}
+
+// query reads positions selected with the columns used above
+func (s *PlaybackStore) query(query string, args ...interface{}) ([]*PlaybackPosition, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询播放进度失败: %w", err)
+	}
+	defer rows.Close()
+
+	positions := []*PlaybackPosition{}
+	for rows.Next() {
+		var position PlaybackPosition
+		if err := rows.Scan(&position.UserID, &position.InfoHash, &position.FileIndex,
+			&position.Position, &position.Duration, &position.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("读取播放进度失败: %w", err)
+		}
+		positions = append(positions, &position)
+	}
+	return positions, rows.Err()
+}
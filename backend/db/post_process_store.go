@@ -0,0 +1,99 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Post-processing statuses
+const (
+	PostProcessRunning   = "running"
+	PostProcessSucceeded = "succeeded"
+	PostProcessFailed    = "failed"
+)
+
+// PostProcessResult is the outcome of the post-download command run when a
+// torrent completed
+type PostProcessResult struct {
+	Status   string `json:"status"`
+	ExitCode int    `json:"exitCode"`
+	// Error describes why the command failed, empty when it succeeded
+	Error string `json:"error,omitempty"`
+	// Output is the end of the command's combined stdout and stderr
+	Output     string     `json:"output,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// PostProcessStore handles the storage of post-processing results, one per torrent
+type PostProcessStore struct {
+	db *sql.DB
+}
+
+// NewPostProcessStore creates a new PostProcessStore sharing the manager's connection pool
+func NewPostProcessStore(dbManager *DatabaseManager) *PostProcessStore {
+	return &PostProcessStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+// ListResults retrieves every stored result by info hash
+func (s *PostProcessStore) ListResults() (map[string]*PostProcessResult, error) {
+	rows, err := s.db.Query(`
+		SELECT info_hash, status, exit_code, error, output, started_at, finished_at
+		FROM post_process_results
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("查询后处理结果失败: %w", err)
+	}
+	defer rows.Close()
+
+	results := make(map[string]*PostProcessResult)
+	for rows.Next() {
+		var infoHash string
+		var result PostProcessResult
+		var finishedAt sql.NullTime
+
+		if err := rows.Scan(
+			&infoHash, &result.Status, &result.ExitCode, &result.Error, &result.Output,
+			&result.StartedAt, &finishedAt,
+		); err != nil {
+			return nil, fmt.Errorf("读取后处理结果失败: %w", err)
+		}
+
+		if finishedAt.Valid {
+			result.FinishedAt = &finishedAt.Time
+		}
+		results[infoHash] = &result
+	}
+
+	return results, rows.Err()
+}
+
+// SaveResult stores a torrent's result, replacing the previous one
+func (s *PostProcessStore) SaveResult(infoHash string, result *PostProcessResult) error {
+	_, err := s.db.Exec(`
+		INSERT INTO post_process_results (info_hash, status, exit_code, error, output, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(info_hash) DO UPDATE SET
+			status = excluded.status,
+			exit_code = excluded.exit_code,
+			error = excluded.error,
+			output = excluded.output,
+			started_at = excluded.started_at,
+			finished_at = excluded.finished_at
+	`, infoHash, result.Status, result.ExitCode, result.Error, result.Output, result.StartedAt, result.FinishedAt)
+	if err != nil {
+		return fmt.Errorf("保存后处理结果失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteResult removes a torrent's result
+func (s *PostProcessStore) DeleteResult(infoHash string) error {
+	if _, err := s.db.Exec("DELETE FROM post_process_results WHERE info_hash = ?", infoHash); err != nil {
+		return fmt.Errorf("删除后处理结果失败: %w", err)
+	}
+	return nil
+}
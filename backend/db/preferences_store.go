@@ -0,0 +1,80 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PlaybackPreferences represents a user's default stream/transcode settings
+type PlaybackPreferences struct {
+	UserID           int64     `json:"userId"`
+	MaxBitrateKbps   int       `json:"maxBitrateKbps"`
+	AudioLanguage    string    `json:"audioLanguage"`
+	SubtitleLanguage string    `json:"subtitleLanguage"`
+	ForceTranscode   bool      `json:"forceTranscode"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// PreferencesStore handles the storage and retrieval of playback preferences
+type PreferencesStore struct {
+	db *sql.DB
+}
+
+// NewPreferencesStore creates a new PreferencesStore sharing the manager's connection pool
+func NewPreferencesStore(dbManager *DatabaseManager) *PreferencesStore {
+	return &PreferencesStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+// GetPreferences retrieves a user's preferences, returning nil when none are stored
+func (s *PreferencesStore) GetPreferences(userID int64) (*PlaybackPreferences, error) {
+	prefs := PlaybackPreferences{UserID: userID}
+	var updatedAt sql.NullTime
+
+	err := s.db.QueryRow(`
+		SELECT max_bitrate_kbps, audio_language, subtitle_language, force_transcode, updated_at
+		FROM user_preferences WHERE user_id = ?
+	`, userID).Scan(
+		&prefs.MaxBitrateKbps, &prefs.AudioLanguage, &prefs.SubtitleLanguage,
+		&prefs.ForceTranscode, &updatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询播放偏好失败: %w", err)
+	}
+
+	if updatedAt.Valid {
+		prefs.UpdatedAt = updatedAt.Time
+	}
+
+	return &prefs, nil
+}
+
+// SavePreferences inserts or replaces a user's preferences
+func (s *PreferencesStore) SavePreferences(prefs *PlaybackPreferences) error {
+	prefs.UpdatedAt = time.Now()
+
+	_, err := s.db.Exec(`
+		INSERT INTO user_preferences (
+			user_id, max_bitrate_kbps, audio_language, subtitle_language, force_transcode, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			max_bitrate_kbps = excluded.max_bitrate_kbps,
+			audio_language = excluded.audio_language,
+			subtitle_language = excluded.subtitle_language,
+			force_transcode = excluded.force_transcode,
+			updated_at = excluded.updated_at
+	`,
+		prefs.UserID, prefs.MaxBitrateKbps, prefs.AudioLanguage, prefs.SubtitleLanguage,
+		prefs.ForceTranscode, prefs.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("保存播放偏好失败: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RSSFeed is a feed that is polled for new torrents. Items whose title
+// matches IncludePattern and not ExcludePattern are added automatically.
+type RSSFeed struct {
+	ID              int64      `json:"id"`
+	Name            string     `json:"name"`
+	URL             string     `json:"url"`
+	IncludePattern  string     `json:"include"`
+	ExcludePattern  string     `json:"exclude"`
+	IntervalMinutes int        `json:"intervalMinutes"`
+	Private         bool       `json:"private"`
+	Enabled         bool       `json:"enabled"`
+	LastCheckedAt   *time.Time `json:"lastCheckedAt,omitempty"`
+	LastError       string     `json:"lastError,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+// RSSItem is a feed item that matched the feed's filters, together with the
+// torrent it was added as. Error is set when adding it failed; such items are
+// retried on the next poll.
+type RSSItem struct {
+	ID        int64     `json:"id"`
+	FeedID    int64     `json:"feedId"`
+	GUID      string    `json:"guid"`
+	Title     string    `json:"title"`
+	MagnetURI string    `json:"magnetUri,omitempty"`
+	InfoHash  string    `json:"infoHash,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// RSSStore handles the storage of RSS feeds and their matched items
+type RSSStore struct {
+	db *sql.DB
+}
+
+// NewRSSStore creates a new RSSStore sharing the manager's connection pool
+func NewRSSStore(dbManager *DatabaseManager) *RSSStore {
+	return &RSSStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+const rssFeedColumns = `id, name, url, include_pattern, exclude_pattern, interval_minutes,
+	private, enabled, last_checked_at, last_error, created_at, updated_at`
+
+// scanRSSFeed reads a row selected with rssFeedColumns
+func scanRSSFeed(row interface{ Scan(...interface{}) error }) (*RSSFeed, error) {
+	var feed RSSFeed
+	var lastCheckedAt sql.NullTime
+	err := row.Scan(&feed.ID, &feed.Name, &feed.URL, &feed.IncludePattern, &feed.ExcludePattern,
+		&feed.IntervalMinutes, &feed.Private, &feed.Enabled, &lastCheckedAt, &feed.LastError,
+		&feed.CreatedAt, &feed.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastCheckedAt.Valid {
+		feed.LastCheckedAt = &lastCheckedAt.Time
+	}
+	return &feed, nil
+}
+
+// CreateFeed inserts a new feed and fills in the generated id
+func (s *RSSStore) CreateFeed(feed *RSSFeed) error {
+	now := time.Now()
+	feed.CreatedAt = now
+	feed.UpdatedAt = now
+
+	result, err := s.db.Exec(`
+		INSERT INTO rss_feeds (name, url, include_pattern, exclude_pattern, interval_minutes,
+			private, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, feed.Name, feed.URL, feed.IncludePattern, feed.ExcludePattern, feed.IntervalMinutes,
+		feed.Private, feed.Enabled, now, now)
+	if err != nil {
+		return fmt.Errorf("创建RSS订阅失败: %w", err)
+	}
+
+	feed.ID, err = result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("获取RSS订阅ID失败: %w", err)
+	}
+	return nil
+}
+
+// GetFeed retrieves a feed by id, returning nil when not found
+func (s *RSSStore) GetFeed(id int64) (*RSSFeed, error) {
+	feed, err := scanRSSFeed(s.db.QueryRow("SELECT "+rssFeedColumns+" FROM rss_feeds WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询RSS订阅失败: %w", err)
+	}
+	return feed, nil
+}
+
+// ListFeeds returns all feeds ordered by creation time
+func (s *RSSStore) ListFeeds() ([]*RSSFeed, error) {
+	rows, err := s.db.Query("SELECT " + rssFeedColumns + " FROM rss_feeds ORDER BY created_at")
+	if err != nil {
+		return nil, fmt.Errorf("查询RSS订阅失败: %w", err)
+	}
+	defer rows.Close()
+
+	feeds := []*RSSFeed{}
+	for rows.Next() {
+		feed, err := scanRSSFeed(rows)
+		if err != nil {
+			return nil, fmt.Errorf("读取RSS订阅失败: %w", err)
+		}
+		feeds = append(feeds, feed)
+	}
+	return feeds, rows.Err()
+}
+
+// UpdateFeed saves a feed's settings, reporting whether it existed
+func (s *RSSStore) UpdateFeed(feed *RSSFeed) (bool, error) {
+	feed.UpdatedAt = time.Now()
+
+	result, err := s.db.Exec(`
+		UPDATE rss_feeds SET name = ?, url = ?, include_pattern = ?, exclude_pattern = ?,
+			interval_minutes = ?, private = ?, enabled = ?, updated_at = ?
+		WHERE id = ?
+	`, feed.Name, feed.URL, feed.IncludePattern, feed.ExcludePattern, feed.IntervalMinutes,
+		feed.Private, feed.Enabled, feed.UpdatedAt, feed.ID)
+	if err != nil {
+		return false, fmt.Errorf("更新RSS订阅失败: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("更新RSS订阅失败: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// MarkChecked records when a feed was last polled and the error, if any
+func (s *RSSStore) MarkChecked(id int64, checkedAt time.Time, lastError string) error {
+	_, err := s.db.Exec("UPDATE rss_feeds SET last_checked_at = ?, last_error = ? WHERE id = ?",
+		checkedAt, lastError, id)
+	if err != nil {
+		return fmt.Errorf("更新RSS订阅检查时间失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteFeed removes a feed and its item history, reporting whether it existed
+func (s *RSSStore) DeleteFeed(id int64) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("删除RSS订阅失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM rss_items WHERE feed_id = ?", id); err != nil {
+		return false, fmt.Errorf("删除RSS订阅记录失败: %w", err)
+	}
+	result, err := tx.Exec("DELETE FROM rss_feeds WHERE id = ?", id)
+	if err != nil {
+		return false, fmt.Errorf("删除RSS订阅失败: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("删除RSS订阅失败: %w", err)
+	}
+
+	return affected > 0, tx.Commit()
+}
+
+// HandledGUIDs returns the GUIDs of a feed's items that were added
+// successfully; items that failed are left out so they are retried
+func (s *RSSStore) HandledGUIDs(feedID int64) (map[string]bool, error) {
+	rows, err := s.db.Query("SELECT guid FROM rss_items WHERE feed_id = ? AND error = ''", feedID)
+	if err != nil {
+		return nil, fmt.Errorf("查询RSS记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	guids := make(map[string]bool)
+	for rows.Next() {
+		var guid string
+		if err := rows.Scan(&guid); err != nil {
+			return nil, fmt.Errorf("读取RSS记录失败: %w", err)
+		}
+		guids[guid] = true
+	}
+	return guids, rows.Err()
+}
+
+// SaveItem records a matched item, replacing an earlier failed attempt, and
+// fills in its id
+func (s *RSSStore) SaveItem(item *RSSItem) error {
+	item.CreatedAt = time.Now()
+
+	err := s.db.QueryRow(`
+		INSERT INTO rss_items (feed_id, guid, title, magnet_uri, info_hash, error, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(feed_id, guid) DO UPDATE SET
+			title = excluded.title,
+			magnet_uri = excluded.magnet_uri,
+			info_hash = excluded.info_hash,
+			error = excluded.error,
+			created_at = excluded.created_at
+		RETURNING id
+	`, item.FeedID, item.GUID, item.Title, item.MagnetURI, item.InfoHash, item.Error, item.CreatedAt).Scan(&item.ID)
+	if err != nil {
+		return fmt.Errorf("保存RSS记录失败: %w", err)
+	}
+	return nil
+}
+
+// ListItems returns the most recent matched items, of one feed when feedID is
+// not 0
+func (s *RSSStore) ListItems(feedID int64, limit int) ([]*RSSItem, error) {
+	rows, err := s.db.Query(`
+		SELECT id, feed_id, guid, title, magnet_uri, info_hash, error, created_at
+		FROM rss_items
+		WHERE ? = 0 OR feed_id = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, feedID, feedID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询RSS记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	items := []*RSSItem{}
+	for rows.Next() {
+		var item RSSItem
+		if err := rows.Scan(&item.ID, &item.FeedID, &item.GUID, &item.Title, &item.MagnetURI,
+			&item.InfoHash, &item.Error, &item.CreatedAt); err != nil {
+			return nil, fmt.Errorf("读取RSS记录失败: %w", err)
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
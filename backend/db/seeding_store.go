@@ -0,0 +1,131 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SeedingRecord holds a torrent's cumulative upload statistics and its
+// per-torrent seeding limits. Nil limits fall back to the global settings.
+type SeedingRecord struct {
+	InfoHash         string    `json:"infoHash"`
+	Uploaded         int64     `json:"uploaded"`
+	SeedingSeconds   int64     `json:"seedingSeconds"`
+	RatioLimit       *float64  `json:"ratioLimit"`
+	TimeLimitMinutes *int      `json:"timeLimitMinutes"`
+	LimitAction      string    `json:"limitAction,omitempty"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// SeedingStore handles the storage of upload statistics and seeding limits
+type SeedingStore struct {
+	db *sql.DB
+}
+
+// NewSeedingStore creates a new SeedingStore sharing the manager's connection pool
+func NewSeedingStore(dbManager *DatabaseManager) *SeedingStore {
+	return &SeedingStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+// GetSeeding retrieves a torrent's seeding record, returning nil when none is stored
+func (s *SeedingStore) GetSeeding(infoHash string) (*SeedingRecord, error) {
+	rows, err := s.query("WHERE info_hash = ?", infoHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return rows[0], nil
+}
+
+// ListSeeding retrieves every stored seeding record
+func (s *SeedingStore) ListSeeding() ([]*SeedingRecord, error) {
+	return s.query("")
+}
+
+func (s *SeedingStore) query(where string, args ...interface{}) ([]*SeedingRecord, error) {
+	rows, err := s.db.Query(`
+		SELECT info_hash, uploaded, seeding_seconds, ratio_limit, time_limit_minutes, limit_action, updated_at
+		FROM torrent_seeding `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询做种记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*SeedingRecord
+	for rows.Next() {
+		var record SeedingRecord
+		var ratioLimit sql.NullFloat64
+		var timeLimit sql.NullInt64
+		var updatedAt sql.NullTime
+
+		if err := rows.Scan(
+			&record.InfoHash, &record.Uploaded, &record.SeedingSeconds,
+			&ratioLimit, &timeLimit, &record.LimitAction, &updatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("读取做种记录失败: %w", err)
+		}
+
+		if ratioLimit.Valid {
+			record.RatioLimit = &ratioLimit.Float64
+		}
+		if timeLimit.Valid {
+			minutes := int(timeLimit.Int64)
+			record.TimeLimitMinutes = &minutes
+		}
+		if updatedAt.Valid {
+			record.UpdatedAt = updatedAt.Time
+		}
+		records = append(records, &record)
+	}
+
+	return records, rows.Err()
+}
+
+// UpdateStats stores a torrent's cumulative uploaded bytes and seeding time,
+// keeping any per-torrent limits
+func (s *SeedingStore) UpdateStats(infoHash string, uploaded, seedingSeconds int64) error {
+	_, err := s.db.Exec(`
+		INSERT INTO torrent_seeding (info_hash, uploaded, seeding_seconds, limit_action, updated_at)
+		VALUES (?, ?, ?, '', ?)
+		ON CONFLICT(info_hash) DO UPDATE SET
+			uploaded = excluded.uploaded,
+			seeding_seconds = excluded.seeding_seconds,
+			updated_at = excluded.updated_at
+	`, infoHash, uploaded, seedingSeconds, time.Now())
+	if err != nil {
+		return fmt.Errorf("保存上传统计失败: %w", err)
+	}
+	return nil
+}
+
+// SaveLimits stores a torrent's seeding limits, keeping its statistics
+func (s *SeedingStore) SaveLimits(record *SeedingRecord) error {
+	record.UpdatedAt = time.Now()
+
+	_, err := s.db.Exec(`
+		INSERT INTO torrent_seeding (info_hash, ratio_limit, time_limit_minutes, limit_action, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(info_hash) DO UPDATE SET
+			ratio_limit = excluded.ratio_limit,
+			time_limit_minutes = excluded.time_limit_minutes,
+			limit_action = excluded.limit_action,
+			updated_at = excluded.updated_at
+	`, record.InfoHash, record.RatioLimit, record.TimeLimitMinutes, record.LimitAction, record.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("保存做种限制失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteSeeding removes a torrent's seeding record
+func (s *SeedingStore) DeleteSeeding(infoHash string) error {
+	if _, err := s.db.Exec("DELETE FROM torrent_seeding WHERE info_hash = ?", infoHash); err != nil {
+		return fmt.Errorf("删除做种记录失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SettingsStore handles runtime settings changed through the API. Each
+// setting is a key with a JSON value.
+type SettingsStore struct {
+	db *sql.DB
+}
+
+// NewSettingsStore creates a new SettingsStore sharing the manager's connection pool
+func NewSettingsStore(dbManager *DatabaseManager) *SettingsStore {
+	return &SettingsStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+// GetSettings returns all stored settings keyed by name
+func (s *SettingsStore) GetSettings() (map[string]string, error) {
+	rows, err := s.db.Query("SELECT key, value FROM settings")
+	if err != nil {
+		return nil, fmt.Errorf("查询设置失败: %w", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("读取设置失败: %w", err)
+		}
+		settings[key] = value
+	}
+	return settings, rows.Err()
+}
+
+// SaveSettings inserts or replaces the given settings in one transaction
+func (s *SettingsStore) SaveSettings(settings map[string]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("保存设置失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	for key, value := range settings {
+		_, err := tx.Exec(`
+			INSERT INTO settings (key, value, updated_at)
+			VALUES (?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(key) DO UPDATE SET
+				value = excluded.value,
+				updated_at = excluded.updated_at
+		`, key, value)
+		if err != nil {
+			return fmt.Errorf("保存设置失败: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("保存设置失败: %w", err)
+	}
+	return nil
+}
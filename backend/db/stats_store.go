@@ -0,0 +1,118 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// StatsSample is the transfer of one bucket of the stats history. Buckets
+// start at At and span Resolution; PeerSum is the sum of the active peer
+// counts of its Samples one-minute samples.
+type StatsSample struct {
+	Resolution time.Duration
+	At         time.Time
+	Downloaded int64
+	Uploaded   int64
+	PeerSum    int64
+	Samples    int64
+}
+
+// StatsStore handles the transfer statistics history. Samples are recorded
+// per minute and rolled up into coarser buckets as they age.
+type StatsStore struct {
+	db *sql.DB
+}
+
+// NewStatsStore creates a new StatsStore sharing the manager's connection pool
+func NewStatsStore(dbManager *DatabaseManager) *StatsStore {
+	return &StatsStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+// AddSample adds a sample to its bucket, merging it with a sample already
+// recorded there
+func (s *StatsStore) AddSample(sample StatsSample) error {
+	_, err := s.db.Exec(`
+		INSERT INTO stats_history (resolution, at, downloaded, uploaded, peer_sum, samples)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(resolution, at) DO UPDATE SET
+			downloaded = downloaded + excluded.downloaded,
+			uploaded = uploaded + excluded.uploaded,
+			peer_sum = peer_sum + excluded.peer_sum,
+			samples = samples + excluded.samples
+	`, int64(sample.Resolution/time.Second), sample.At.Unix(),
+		sample.Downloaded, sample.Uploaded, sample.PeerSum, sample.Samples)
+	if err != nil {
+		return fmt.Errorf("保存统计记录失败: %w", err)
+	}
+	return nil
+}
+
+// Rollup merges the buckets of resolution from before the cutoff into buckets
+// of the coarser resolution into, and deletes them
+func (s *StatsStore) Rollup(from, into time.Duration, before time.Time) error {
+	fromSec, intoSec := int64(from/time.Second), int64(into/time.Second)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO stats_history (resolution, at, downloaded, uploaded, peer_sum, samples)
+		SELECT ?, at / ? * ?, SUM(downloaded), SUM(uploaded), SUM(peer_sum), SUM(samples)
+		FROM stats_history WHERE resolution = ? AND at < ?
+		GROUP BY at / ?
+		ON CONFLICT(resolution, at) DO UPDATE SET
+			downloaded = downloaded + excluded.downloaded,
+			uploaded = uploaded + excluded.uploaded,
+			peer_sum = peer_sum + excluded.peer_sum,
+			samples = samples + excluded.samples
+	`, intoSec, intoSec, intoSec, fromSec, before.Unix(), intoSec); err != nil {
+		return fmt.Errorf("合并统计记录失败: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM stats_history WHERE resolution = ? AND at < ?", fromSec, before.Unix()); err != nil {
+		return fmt.Errorf("删除统计记录失败: %w", err)
+	}
+	return tx.Commit()
+}
+
+// DeleteBefore deletes the buckets of resolution from before the cutoff
+func (s *StatsStore) DeleteBefore(resolution time.Duration, before time.Time) error {
+	if _, err := s.db.Exec("DELETE FROM stats_history WHERE resolution = ? AND at < ?",
+		int64(resolution/time.Second), before.Unix()); err != nil {
+		return fmt.Errorf("删除统计记录失败: %w", err)
+	}
+	return nil
+}
+
+// History returns the history since the given time in buckets of step,
+// whatever resolution the samples are stored in. Steps should be multiples of
+// the resolutions covering the range; empty buckets are left out.
+func (s *StatsStore) History(since time.Time, step time.Duration) ([]StatsSample, error) {
+	stepSec := int64(step / time.Second)
+	rows, err := s.db.Query(`
+		SELECT at / ? * ? AS bucket, SUM(downloaded), SUM(uploaded), SUM(peer_sum), SUM(samples)
+		FROM stats_history WHERE at >= ?
+		GROUP BY bucket ORDER BY bucket
+	`, stepSec, stepSec, since.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("查询统计记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	samples := []StatsSample{}
+	for rows.Next() {
+		sample := StatsSample{Resolution: step}
+		var at int64
+		if err := rows.Scan(&at, &sample.Downloaded, &sample.Uploaded, &sample.PeerSum, &sample.Samples); err != nil {
+			return nil, fmt.Errorf("读取统计记录失败: %w", err)
+		}
+		sample.At = time.Unix(at, 0).UTC()
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStatsRollupKeepsTotals(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	manager := openTestManager(t, filepath.Join(t.TempDir(), "stats.db"))
+	defer manager.Close()
+	store := NewStatsStore(manager)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 45; i++ {
+		if err := store.AddSample(StatsSample{
+			Resolution: time.Minute,
+			At:         start.Add(time.Duration(i) * time.Minute),
+			Downloaded: 600,
+			Uploaded:   60,
+			PeerSum:    int64(i % 3),
+			Samples:    1,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 前 30 分钟合并为 15 分钟精度，剩余记录保持每分钟精度
+	if err := store.Rollup(time.Minute, 15*time.Minute, start.Add(30*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	var minutes int
+	if err := manager.GetDB().QueryRow("SELECT COUNT(*) FROM stats_history WHERE resolution = 60").Scan(&minutes); err != nil {
+		t.Fatal(err)
+	}
+	if minutes != 15 {
+		t.Fatalf("合并后剩余 %d 条每分钟记录，应为 15", minutes)
+	}
+
+	history, err := store.History(start, 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("得到 %d 个数据点，应为 3", len(history))
+	}
+	for i, sample := range history {
+		if !sample.At.Equal(start.Add(time.Duration(i) * 15 * time.Minute)) {
+			t.Errorf("数据点 %d 的时间为 %v", i, sample.At)
+		}
+		if sample.Downloaded != 15*600 || sample.Uploaded != 15*60 || sample.Samples != 15 || sample.PeerSum != 15 {
+			t.Errorf("数据点 %d = %+v，合并前后总量应相同", i, sample)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// StreamLogEntry is one stream session in the access log. LastOffset is the
+// position of the last read, from which the watched share of the file is
+// estimated.
+type StreamLogEntry struct {
+	ID         int64
+	UserID     int64
+	RemoteAddr string
+	UserAgent  string
+	Kind       string
+	InfoHash   string
+	FileIndex  int
+	FilePath   string
+	FileLength int64
+	Title      string
+	StartedAt  time.Time
+	EndedAt    time.Time
+	BytesRead  int64
+	LastOffset int64
+}
+
+// TitleStats sums up the logged sessions of one torrent. Title is the title
+// of its latest session; Completion is the average watched share from 0 to 1.
+type TitleStats struct {
+	InfoHash     string
+	Title        string
+	Plays        int64
+	Viewers      int64
+	WatchSeconds int64
+	BytesServed  int64
+	Completion   float64
+	LastPlayedAt time.Time
+}
+
+// StreamInterval is the time a logged session was open
+type StreamInterval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// StreamLogStore handles the access log of stream sessions
+type StreamLogStore struct {
+	db *sql.DB
+}
+
+// NewStreamLogStore creates a new StreamLogStore sharing the manager's connection pool
+func NewStreamLogStore(dbManager *DatabaseManager) *StreamLogStore {
+	return &StreamLogStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+// AddEntry logs a session. A player often closes its session and opens a new
+// one for the same file, as when it probes the file before playing it; an
+// entry of the same client and file that ended at most mergeWithin before
+// the session started is extended instead of adding another entry.
+func (s *StreamLogStore) AddEntry(entry *StreamLogEntry, mergeWithin time.Duration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(`
+		SELECT id FROM stream_log
+		WHERE user_id = ? AND remote_addr = ? AND kind = ? AND info_hash = ? AND file_index = ?
+			AND ended_at >= ?
+		ORDER BY ended_at DESC LIMIT 1
+	`, entry.UserID, entry.RemoteAddr, entry.Kind, entry.InfoHash, entry.FileIndex,
+		entry.StartedAt.Add(-mergeWithin).Unix()).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		result, err := tx.Exec(`
+			INSERT INTO stream_log (
+				user_id, remote_addr, user_agent, kind, info_hash, file_index, file_path,
+				file_length, title, started_at, ended_at, bytes_read, last_offset
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, entry.UserID, entry.RemoteAddr, entry.UserAgent, entry.Kind, entry.InfoHash,
+			entry.FileIndex, entry.FilePath, entry.FileLength, entry.Title,
+			entry.StartedAt.Unix(), entry.EndedAt.Unix(), entry.BytesRead, entry.LastOffset)
+		if err != nil {
+			return fmt.Errorf("保存播放记录失败: %w", err)
+		}
+		id, _ = result.LastInsertId()
+	case err != nil:
+		return fmt.Errorf("查询播放记录失败: %w", err)
+	default:
+		if _, err := tx.Exec(`
+			UPDATE stream_log SET
+				ended_at = MAX(ended_at, ?),
+				bytes_read = bytes_read + ?,
+				last_offset = ?,
+				user_agent = COALESCE(NULLIF(?, ''), user_agent),
+				title = COALESCE(NULLIF(?, ''), title)
+			WHERE id = ?
+		`, entry.EndedAt.Unix(), entry.BytesRead, entry.LastOffset, entry.UserAgent,
+			entry.Title, id); err != nil {
+			return fmt.Errorf("保存播放记录失败: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	entry.ID = id
+	return nil
+}
+
+// TitleStats returns the stats of the torrents played since the given time,
+// most played first
+func (s *StreamLogStore) TitleStats(since time.Time, limit int) ([]TitleStats, error) {
+	// SQLite takes the bare title column from the row that has MAX(ended_at)
+	rows, err := s.db.Query(`
+		SELECT info_hash, title, COUNT(*) AS plays, COUNT(DISTINCT user_id),
+			SUM(ended_at - started_at) AS watched, SUM(bytes_read),
+			AVG(CASE WHEN file_length > 0 THEN MIN(last_offset * 1.0 / file_length, 1) ELSE 0 END),
+			MAX(ended_at)
+		FROM stream_log WHERE ended_at >= ?
+		GROUP BY info_hash
+		ORDER BY plays DESC, watched DESC
+		LIMIT ?
+	`, since.Unix(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询播放记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	stats := []TitleStats{}
+	for rows.Next() {
+		var title TitleStats
+		var lastPlayed int64
+		if err := rows.Scan(&title.InfoHash, &title.Title, &title.Plays, &title.Viewers,
+			&title.WatchSeconds, &title.BytesServed, &title.Completion, &lastPlayed); err != nil {
+			return nil, fmt.Errorf("读取播放记录失败: %w", err)
+		}
+		title.LastPlayedAt = time.Unix(lastPlayed, 0).UTC()
+		stats = append(stats, title)
+	}
+	return stats, rows.Err()
+}
+
+// Intervals returns the open times of the sessions that ended since the given time
+func (s *StreamLogStore) Intervals(since time.Time) ([]StreamInterval, error) {
+	rows, err := s.db.Query("SELECT started_at, ended_at FROM stream_log WHERE ended_at >= ?", since.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("查询播放记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	intervals := []StreamInterval{}
+	for rows.Next() {
+		var start, end int64
+		if err := rows.Scan(&start, &end); err != nil {
+			return nil, fmt.Errorf("读取播放记录失败: %w", err)
+		}
+		intervals = append(intervals, StreamInterval{Start: time.Unix(start, 0).UTC(), End: time.Unix(end, 0).UTC()})
+	}
+	return intervals, rows.Err()
+}
+
+// DeleteBefore deletes the entries of the sessions that ended before the cutoff
+func (s *StreamLogStore) DeleteBefore(before time.Time) error {
+	if _, err := s.db.Exec("DELETE FROM stream_log WHERE ended_at < ?", before.Unix()); err != nil {
+		return fmt.Errorf("删除播放记录失败: %w", err)
+	}
+	return nil
+}
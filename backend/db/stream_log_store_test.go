@@ -0,0 +1,74 @@
+package db
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStreamLogMergesReopenedSessions(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	manager := openTestManager(t, filepath.Join(t.TempDir(), "streams.db"))
+	defer manager.Close()
+	store := NewStreamLogStore(manager)
+
+	start := time.Date(2026, 1, 1, 20, 0, 0, 0, time.UTC)
+	entry := func(userID int64, startOffset, endOffset time.Duration, bytes, offset int64) *StreamLogEntry {
+		return &StreamLogEntry{
+			UserID: userID, RemoteAddr: "10.0.0.2", Kind: "stream",
+			InfoHash: "abc", FileIndex: 0, FileLength: 1000, Title: "Movie",
+			StartedAt: start.Add(startOffset), EndedAt: start.Add(endOffset),
+			BytesRead: bytes, LastOffset: offset,
+		}
+	}
+
+	// 探测请求之后立即开始播放，合并为一次播放
+	for _, e := range []*StreamLogEntry{
+		entry(1, 0, time.Second, 2, 2),
+		entry(1, 5*time.Second, time.Hour, 900, 900),
+		// 第二天重新观看
+		entry(1, 24*time.Hour, 25*time.Hour, 500, 500),
+		entry(2, 0, 30*time.Minute, 300, 300),
+	} {
+		if err := store.AddEntry(e, 30*time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := store.TitleStats(start.Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("got %d titles, want 1", len(stats))
+	}
+	got := stats[0]
+	if got.Plays != 3 || got.Viewers != 2 {
+		t.Errorf("plays %d viewers %d, want 3 and 2", got.Plays, got.Viewers)
+	}
+	if want := int64(3600 + 3600 + 1800); got.WatchSeconds != want {
+		t.Errorf("watched %d seconds, want %d", got.WatchSeconds, want)
+	}
+	if got.BytesServed != 1702 {
+		t.Errorf("served %d bytes, want 1702", got.BytesServed)
+	}
+	if got.Completion < 0.566 || got.Completion > 0.567 {
+		t.Errorf("completion %f, want 0.567", got.Completion)
+	}
+	if !got.LastPlayedAt.Equal(start.Add(25 * time.Hour)) {
+		t.Errorf("last played at %v", got.LastPlayedAt)
+	}
+
+	intervals, err := store.Intervals(start.Add(12 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intervals) != 1 {
+		t.Errorf("got %d intervals since noon, want 1", len(intervals))
+	}
+}
@@ -3,7 +3,11 @@ package db
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,15 +23,28 @@ type TorrentRecord struct {
 	Downloaded   int64         `json:"downloaded"`
 	Progress     float32       `json:"progress"`
 	State        string        `json:"state"`
+	StateReason  string        `json:"stateReason,omitempty"`
+	// LastError is the last failure of an operation on the torrent, kept
+	// after the torrent has recovered
+	LastError    string        `json:"lastError,omitempty"`
 	MagnetURI    string        `json:"magnetUri"`
 	AddedAt      time.Time     `json:"addedAt"`
 	DataPath     string        `json:"dataPath,omitempty"`
+	// Private marks BEP 27 private torrents, which must only use their own trackers
+	Private      bool          `json:"private"`
+	// Category and Tags organize the library; tags are stored as a JSON array
+	Category     string        `json:"category,omitempty"`
+	Tags         []string      `json:"tags,omitempty"`
+	// AddedBy is the id of the user who added the torrent, 0 for the local
+	// user and automatic sources such as RSS
+	AddedBy      int64         `json:"addedBy,omitempty"`
 	MovieDetails *MovieDetails `json:"movieDetails,omitempty"`
 	CreatedAt    time.Time     `json:"createdAt"`
 	UpdatedAt    time.Time     `json:"updatedAt"`
 }
 
-// MovieDetails represents the movie information
+// MovieDetails represents the movie information. TV series reuse it with
+// MediaType "tv"; their per-file episodes are kept in torrent_episodes.
 type MovieDetails struct {
 	Filename      string   `json:"filename,omitempty"`
 	Year          int      `json:"year,omitempty"`
@@ -44,6 +61,37 @@ type MovieDetails struct {
 	Popularity    float64  `json:"popularity,omitempty"`
 	Status        string   `json:"status,omitempty"`
 	Tagline       string   `json:"tagline,omitempty"`
+	// MediaType is "tv" for series and empty for movies
+	MediaType        string `json:"mediaType,omitempty"`
+	NumberOfSeasons  int    `json:"numberOfSeasons,omitempty"`
+	NumberOfEpisodes int    `json:"numberOfEpisodes,omitempty"`
+	// MatchedBy is "parser" or "llm" when the details were matched
+	// automatically, and empty when they were saved by a client
+	MatchedBy string `json:"matchedBy,omitempty"`
+	// IMDb ID from TMDB; the ratings come from OMDb when OMDB_API_KEY is set.
+	// RottenTomatoes is the Tomatometer in percent.
+	ImdbId         string  `json:"imdbId,omitempty"`
+	ImdbRating     float64 `json:"imdbRating,omitempty"`
+	ImdbVotes      int     `json:"imdbVotes,omitempty"`
+	RottenTomatoes int     `json:"rottenTomatoes,omitempty"`
+	ContentRating  string  `json:"contentRating,omitempty"`
+	// Provider is "anilist" for anime matched on AniList, which sets
+	// AnilistId instead of TmdbId, and empty for TMDB
+	Provider  string `json:"provider,omitempty"`
+	AnilistId int    `json:"anilistId,omitempty"`
+	// Collection is the TMDB collection of a movie; membership is also
+	// kept in the torrents table for the collections listing
+	Collection *MovieCollection `json:"collection,omitempty"`
+	// TrailerUrl is a YouTube link to the trailer of a movie
+	TrailerUrl string `json:"trailerUrl,omitempty"`
+}
+
+// MovieCollection is a TMDB collection, a series of movies such as a franchise
+type MovieCollection struct {
+	TmdbId      int    `json:"tmdbId"`
+	Name        string `json:"name"`
+	PosterUrl   string `json:"posterUrl,omitempty"`
+	BackdropUrl string `json:"backdropUrl,omitempty"`
 }
 
 // FileInfo represents information about a file in a torrent
@@ -60,13 +108,79 @@ type FileInfo struct {
 // TorrentStore handles the storage and retrieval of torrent information
 type TorrentStore struct {
 	db    *sql.DB
+	stmts *torrentStatements
 	mutex sync.RWMutex
 }
 
+// Queries run for every torrent every few seconds, prepared once when the
+// store is created instead of being parsed by SQLite on each call
+const (
+	getTorrentQuery = `
+		SELECT info_hash, name, magnet_uri, added_at, data_path, 
+		       length, files, downloaded, progress, state, state_reason, last_error, private, category, tags, added_by, movie_details,
+		       created_at, updated_at
+		FROM torrents WHERE info_hash = ?
+	`
+	updateStateQuery = `
+		UPDATE torrents SET state = ?, state_reason = ?, updated_at = ?
+		WHERE info_hash = ?
+	`
+	updateProgressQuery = `
+		UPDATE torrents SET downloaded = ?, progress = ?, updated_at = ?
+		WHERE info_hash = ?
+	`
+	markCompletedQuery = `
+		UPDATE torrents SET completed_at = ?
+		WHERE info_hash = ? AND completed_at IS NULL
+	`
+)
+
+// torrentStatements are the prepared hot queries of a TorrentStore
+type torrentStatements struct {
+	getTorrent     *sql.Stmt
+	updateState    *sql.Stmt
+	updateProgress *sql.Stmt
+	markCompleted  *sql.Stmt
+}
+
+func prepareTorrentStatements(db *sql.DB) (*torrentStatements, error) {
+	stmts := &torrentStatements{}
+	for _, prepare := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&stmts.getTorrent, getTorrentQuery},
+		{&stmts.updateState, updateStateQuery},
+		{&stmts.updateProgress, updateProgressQuery},
+		{&stmts.markCompleted, markCompletedQuery},
+	} {
+		stmt, err := db.Prepare(prepare.query)
+		if err != nil {
+			stmts.close()
+			return nil, fmt.Errorf("预编译SQL语句失败: %w", err)
+		}
+		*prepare.stmt = stmt
+	}
+	return stmts, nil
+}
+
+func (s *torrentStatements) close() {
+	for _, stmt := range []*sql.Stmt{s.getTorrent, s.updateState, s.updateProgress, s.markCompleted} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
+
 // NewTorrentStore creates a new TorrentStore with improved connection management
 func NewTorrentStore(dbManager *DatabaseManager) (*TorrentStore, error) {
+	stmts, err := prepareTorrentStatements(dbManager.GetDB())
+	if err != nil {
+		return nil, err
+	}
 	return &TorrentStore{
-		db: dbManager.GetDB(),
+		db:    dbManager.GetDB(),
+		stmts: stmts,
 	}, nil
 }
 
@@ -88,9 +202,15 @@ func NewTorrentStoreWithPath(dbPath string) (*TorrentStore, error) {
 		db.Close()
 		return nil, err
 	}
+	stmts, err := prepareTorrentStatements(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 
 	return &TorrentStore{
-		db: db,
+		db:    db,
+		stmts: stmts,
 	}, nil
 }
 
@@ -108,7 +228,23 @@ func createTables(db *sql.DB) error {
 			downloaded INTEGER,
 			progress REAL,
 			state TEXT,
-			movie_details TEXT
+			state_reason TEXT DEFAULT '',
+			last_error TEXT NOT NULL DEFAULT '',
+			private INTEGER NOT NULL DEFAULT 0,
+			category TEXT NOT NULL DEFAULT '',
+			tags TEXT NOT NULL DEFAULT '',
+			added_by INTEGER NOT NULL DEFAULT 0,
+			movie_details TEXT,
+			completed_at TIMESTAMP,
+			deleted_at TIMESTAMP,
+			delete_data INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS torrent_info (
+			info_hash TEXT PRIMARY KEY,
+			info BLOB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)
 	`)
 	return err
@@ -116,10 +252,15 @@ func createTables(db *sql.DB) error {
 
 // Close closes the database connection
 func (s *TorrentStore) Close() error {
+	s.stmts.close()
 	return s.db.Close()
 }
 
-// AddTorrent adds a new torrent record to the database
+// AddTorrent adds a new torrent record to the database. If a record with the
+// same info hash exists (e.g. in the trash) it is restored and updated in
+// place as a new download: progress starts over and the torrent belongs to
+// the user adding it. Movie details, labels and timestamps are kept, and so
+// are name, files and length until the new download has its metadata.
 func (s *TorrentStore) AddTorrent(record *TorrentRecord) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -139,6 +280,11 @@ func (s *TorrentStore) AddTorrent(record *TorrentRecord) error {
 		}
 	}
 
+	tagsJSON, err := marshalTags(record.Tags)
+	if err != nil {
+		return err
+	}
+
 	// Set timestamps
 	now := time.Now()
 	if record.AddedAt.IsZero() {
@@ -147,15 +293,31 @@ func (s *TorrentStore) AddTorrent(record *TorrentRecord) error {
 
 	// Insert the torrent record with optimized query
 	_, err = s.db.Exec(`
-		INSERT OR REPLACE INTO torrents (
+		INSERT INTO torrents (
 			info_hash, name, magnet_uri, added_at, data_path, 
-			length, files, downloaded, progress, state, movie_details,
+			length, files, downloaded, progress, state, state_reason, last_error, private, category, tags, added_by, movie_details,
 			created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(info_hash) DO UPDATE SET
+			magnet_uri = excluded.magnet_uri,
+			data_path = excluded.data_path,
+			state = excluded.state,
+			state_reason = excluded.state_reason,
+			last_error = excluded.last_error,
+			downloaded = excluded.downloaded,
+			progress = excluded.progress,
+			private = excluded.private,
+			added_by = excluded.added_by,
+			category = COALESCE(NULLIF(excluded.category, ''), torrents.category),
+			tags = COALESCE(NULLIF(excluded.tags, ''), torrents.tags),
+			movie_details = COALESCE(NULLIF(excluded.movie_details, ''), torrents.movie_details),
+			deleted_at = NULL,
+			delete_data = 0,
+			updated_at = excluded.updated_at
 	`,
 		record.InfoHash, record.Name, record.MagnetURI, record.AddedAt, record.DataPath,
-		record.Length, string(filesJSON), record.Downloaded, record.Progress, record.State,
-		string(movieDetailsJSON), now, now,
+		record.Length, string(filesJSON), record.Downloaded, record.Progress, record.State, record.StateReason, record.LastError, record.Private,
+		record.Category, tagsJSON, record.AddedBy, string(movieDetailsJSON), now, now,
 	)
 	
 	if err != nil {
@@ -171,18 +333,13 @@ func (s *TorrentStore) GetTorrent(infoHash string) (*TorrentRecord, error) {
 	defer s.mutex.RUnlock()
 
 	var record TorrentRecord
-	var filesJSON, movieDetailsJSON sql.NullString
+	var filesJSON, tagsJSON, movieDetailsJSON sql.NullString
 	var addedAt, createdAt, updatedAt sql.NullString
 
-	err := s.db.QueryRow(`
-		SELECT info_hash, name, magnet_uri, added_at, data_path, 
-		       length, files, downloaded, progress, state, movie_details,
-		       created_at, updated_at
-		FROM torrents WHERE info_hash = ?
-	`, infoHash).Scan(
+	err := s.stmts.getTorrent.QueryRow(infoHash).Scan(
 		&record.InfoHash, &record.Name, &record.MagnetURI, &addedAt, &record.DataPath,
-		&record.Length, &filesJSON, &record.Downloaded, &record.Progress, &record.State,
-		&movieDetailsJSON, &createdAt, &updatedAt,
+		&record.Length, &filesJSON, &record.Downloaded, &record.Progress, &record.State, &record.StateReason, &record.LastError, &record.Private,
+		&record.Category, &tagsJSON, &record.AddedBy, &movieDetailsJSON, &createdAt, &updatedAt,
 	)
 
 	if err != nil {
@@ -224,18 +381,32 @@ func (s *TorrentStore) GetTorrent(infoHash string) (*TorrentRecord, error) {
 		}
 	}
 
-	// Unmarshal movie details JSON if it exists
-	if movieDetailsJSON.Valid && movieDetailsJSON.String != "" {
-		record.MovieDetails = &MovieDetails{}
-		err = json.Unmarshal([]byte(movieDetailsJSON.String), record.MovieDetails)
-		if err != nil {
-			return nil, fmt.Errorf("反序列化电影详情失败: %w", err)
+	if tagsJSON.Valid && tagsJSON.String != "" {
+		if err = json.Unmarshal([]byte(tagsJSON.String), &record.Tags); err != nil {
+			return nil, fmt.Errorf("反序列化标签失败: %w", err)
 		}
 	}
 
+	// Unmarshal movie details JSON if it exists
+	if record.MovieDetails, err = decodeMovieDetails(movieDetailsJSON); err != nil {
+		return nil, err
+	}
+
 	return &record, nil
 }
 
+// decodeMovieDetails decodes the movie_details column, nil when it is empty
+func decodeMovieDetails(column sql.NullString) (*MovieDetails, error) {
+	if !column.Valid || column.String == "" {
+		return nil, nil
+	}
+	details := &MovieDetails{}
+	if err := json.Unmarshal([]byte(column.String), details); err != nil {
+		return nil, fmt.Errorf("反序列化电影详情失败: %w", err)
+	}
+	return details, nil
+}
+
 // GetAllTorrents retrieves all torrent records from the database (optimized with read lock and pagination support)
 func (s *TorrentStore) GetAllTorrents() ([]*TorrentRecord, error) {
 	s.mutex.RLock()
@@ -243,9 +414,10 @@ func (s *TorrentStore) GetAllTorrents() ([]*TorrentRecord, error) {
 
 	rows, err := s.db.Query(`
 		SELECT info_hash, name, magnet_uri, added_at, data_path, 
-		       length, files, downloaded, progress, state, movie_details,
+		       length, files, downloaded, progress, state, state_reason, last_error, private, category, tags, added_by, movie_details,
 		       created_at, updated_at
 		FROM torrents 
+		WHERE deleted_at IS NULL
 		ORDER BY added_at DESC
 	`)
 	if err != nil {
@@ -257,13 +429,13 @@ func (s *TorrentStore) GetAllTorrents() ([]*TorrentRecord, error) {
 
 	for rows.Next() {
 		var record TorrentRecord
-		var filesJSON, movieDetailsJSON sql.NullString
+		var filesJSON, tagsJSON, movieDetailsJSON sql.NullString
 		var addedAt, createdAt, updatedAt sql.NullString
 
 		err := rows.Scan(
 			&record.InfoHash, &record.Name, &record.MagnetURI, &addedAt, &record.DataPath,
-			&record.Length, &filesJSON, &record.Downloaded, &record.Progress, &record.State,
-			&movieDetailsJSON, &createdAt, &updatedAt,
+			&record.Length, &filesJSON, &record.Downloaded, &record.Progress, &record.State, &record.StateReason, &record.LastError, &record.Private,
+			&record.Category, &tagsJSON, &record.AddedBy, &movieDetailsJSON, &createdAt, &updatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("扫描种子记录失败: %w", err)
@@ -299,6 +471,12 @@ func (s *TorrentStore) GetAllTorrents() ([]*TorrentRecord, error) {
 			}
 		}
 
+		if tagsJSON.Valid && tagsJSON.String != "" {
+			if err = json.Unmarshal([]byte(tagsJSON.String), &record.Tags); err != nil {
+				return nil, fmt.Errorf("反序列化标签失败: %w", err)
+			}
+		}
+
 		// Unmarshal movie details JSON if it exists
 		if movieDetailsJSON.Valid && movieDetailsJSON.String != "" {
 			record.MovieDetails = &MovieDetails{}
@@ -318,27 +496,90 @@ func (s *TorrentStore) GetAllTorrents() ([]*TorrentRecord, error) {
 	return torrents, nil
 }
 
-// GetTorrentsPaginated 分页获取种子列表
-func (s *TorrentStore) GetTorrentsPaginated(limit, offset int) ([]*TorrentRecord, int, error) {
+// TorrentQuery filters, orders and pages torrent records. Tags must all be
+// present; Limit 0 returns every matching record.
+type TorrentQuery struct {
+	State    string
+	Category string
+	Tags     []string
+	AddedBy  *int64
+	SortBy   string // name, added, progress, size or state
+	Desc     bool
+	Limit    int
+	Offset   int
+}
+
+// torrentSortColumns maps sort keys to the columns they order by
+var torrentSortColumns = map[string]string{
+	"name":     "name COLLATE NOCASE",
+	"added":    "added_at",
+	"progress": "progress",
+	"size":     "length",
+	"state":    "state",
+}
+
+// where builds the WHERE clause and its arguments for the query's filters.
+// Torrents in the trash never match.
+func (q TorrentQuery) where() (string, []interface{}) {
+	conditions := []string{"deleted_at IS NULL"}
+	var args []interface{}
+	if q.State != "" {
+		conditions = append(conditions, "state = ?")
+		args = append(args, q.State)
+	}
+	if q.Category != "" {
+		conditions = append(conditions, "category = ?")
+		args = append(args, strings.ToLower(q.Category))
+	}
+	if q.AddedBy != nil {
+		conditions = append(conditions, "added_by = ?")
+		args = append(args, *q.AddedBy)
+	}
+	for _, tag := range q.Tags {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(NULLIF(tags, '')) WHERE value = ?)")
+		args = append(args, strings.ToLower(tag))
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// GetTorrentsPaginated 按条件分页获取种子列表，同时返回符合条件的总数
+func (s *TorrentStore) GetTorrentsPaginated(query TorrentQuery) ([]*TorrentRecord, int, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
+	where, args := query.where()
+
 	// 获取总数
 	var total int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM torrents").Scan(&total)
+	err := s.db.QueryRow("SELECT COUNT(*) FROM torrents"+where, args...).Scan(&total)
 	if err != nil {
 		return nil, 0, fmt.Errorf("获取种子总数失败: %w", err)
 	}
 
+	column, ok := torrentSortColumns[query.SortBy]
+	if !ok {
+		column = torrentSortColumns["added"]
+	}
+	direction := "ASC"
+	if query.Desc {
+		direction = "DESC"
+	}
+	// 排序值相同时按添加时间和 info_hash 排序，保证分页稳定
+	orderBy := fmt.Sprintf(" ORDER BY %s %s, added_at DESC, info_hash", column, direction)
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = -1 // SQLite 中 LIMIT -1 表示不限制
+	}
+
 	// 获取分页数据
 	rows, err := s.db.Query(`
 		SELECT info_hash, name, magnet_uri, added_at, data_path, 
-		       length, files, downloaded, progress, state, movie_details,
+		       length, files, downloaded, progress, state, state_reason, last_error, private, category, tags, added_by, movie_details,
 		       created_at, updated_at
-		FROM torrents 
-		ORDER BY added_at DESC
+		FROM torrents`+where+orderBy+`
 		LIMIT ? OFFSET ?
-	`, limit, offset)
+	`, append(args, limit, query.Offset)...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("查询分页种子列表失败: %w", err)
 	}
@@ -347,13 +588,13 @@ func (s *TorrentStore) GetTorrentsPaginated(limit, offset int) ([]*TorrentRecord
 	var torrents []*TorrentRecord
 	for rows.Next() {
 		var record TorrentRecord
-		var filesJSON, movieDetailsJSON sql.NullString
+		var filesJSON, tagsJSON, movieDetailsJSON sql.NullString
 		var addedAt, createdAt, updatedAt sql.NullString
 
 		err := rows.Scan(
 			&record.InfoHash, &record.Name, &record.MagnetURI, &addedAt, &record.DataPath,
-			&record.Length, &filesJSON, &record.Downloaded, &record.Progress, &record.State,
-			&movieDetailsJSON, &createdAt, &updatedAt,
+			&record.Length, &filesJSON, &record.Downloaded, &record.Progress, &record.State, &record.StateReason, &record.LastError, &record.Private,
+			&record.Category, &tagsJSON, &record.AddedBy, &movieDetailsJSON, &createdAt, &updatedAt,
 		)
 		if err != nil {
 			return nil, 0, fmt.Errorf("扫描分页种子记录失败: %w", err)
@@ -378,6 +619,9 @@ func (s *TorrentStore) GetTorrentsPaginated(limit, offset int) ([]*TorrentRecord
 		if filesJSON.Valid && filesJSON.String != "" {
 			json.Unmarshal([]byte(filesJSON.String), &record.Files)
 		}
+		if tagsJSON.Valid && tagsJSON.String != "" {
+			json.Unmarshal([]byte(tagsJSON.String), &record.Tags)
+		}
 		if movieDetailsJSON.Valid && movieDetailsJSON.String != "" {
 			record.MovieDetails = &MovieDetails{}
 			json.Unmarshal([]byte(movieDetailsJSON.String), record.MovieDetails)
@@ -389,70 +633,414 @@ func (s *TorrentStore) GetTorrentsPaginated(limit, offset int) ([]*TorrentRecord
 	return torrents, total, rows.Err()
 }
 
-// UpdateTorrent updates an existing torrent record in the database
-func (s *TorrentStore) UpdateTorrent(record *TorrentRecord) error {
+// TorrentUpdate lists the fields UpdateTorrent changes. Nil fields keep their
+// stored value, so callers that only know part of a record cannot clobber the
+// rest, such as the magnet link needed to restore the torrent.
+type TorrentUpdate struct {
+	Name        *string
+	MagnetURI   *string
+	DataPath    *string
+	AddedAt     *time.Time
+	Length      *int64
+	Files       []FileInfo // nil keeps the stored files
+	Downloaded  *int64
+	Progress    *float32
+	State       *string
+	StateReason *string
+}
+
+// UpdateTorrent updates the given fields of an existing torrent record
+func (s *TorrentStore) UpdateTorrent(infoHash string, update TorrentUpdate) error {
+	fields := make(map[string]any)
+	if update.Name != nil {
+		fields["name"] = *update.Name
+	}
+	if update.MagnetURI != nil {
+		fields["magnet_uri"] = *update.MagnetURI
+	}
+	if update.DataPath != nil {
+		fields["data_path"] = *update.DataPath
+	}
+	if update.AddedAt != nil {
+		fields["added_at"] = *update.AddedAt
+	}
+	if update.Length != nil {
+		fields["length"] = *update.Length
+	}
+	if update.Files != nil {
+		fields["files"] = update.Files
+	}
+	if update.Downloaded != nil {
+		fields["downloaded"] = *update.Downloaded
+	}
+	if update.Progress != nil {
+		fields["progress"] = *update.Progress
+	}
+	if update.State != nil {
+		fields["state"] = *update.State
+	}
+	if update.StateReason != nil {
+		fields["state_reason"] = *update.StateReason
+	}
+	return s.UpdateFields(infoHash, fields)
+}
+
+// ErrConcurrentUpdate is returned by UpdateFieldsIfDetailsUnchanged when the
+// movie details were modified after the caller read them
+var ErrConcurrentUpdate = errors.New("种子记录已被其他操作修改")
+
+// updatableColumns are the columns UpdateFields may set, and whether they
+// hold JSON, which is encoded from the Go value. Labels, collections and
+// timestamps have their own methods.
+var updatableColumns = map[string]bool{
+	"name":          false,
+	"magnet_uri":    false,
+	"added_at":      false,
+	"data_path":     false,
+	"length":        false,
+	"files":         true,
+	"downloaded":    false,
+	"progress":      false,
+	"state":         false,
+	"state_reason":  false,
+	"private":       false,
+	"movie_details": true,
+}
+
+// UpdateFields sets only the given columns of a torrent record, keyed by
+// column name, in a single transaction. Writers of different columns no
+// longer overwrite each other's changes.
+func (s *TorrentStore) UpdateFields(infoHash string, fields map[string]any) error {
+	return s.updateFields(infoHash, fields, false, nil)
+}
+
+// UpdateFieldsIfDetailsUnchanged is UpdateFields with optimistic concurrency
+// for writers that computed the fields from the movie details they read: the
+// update is only applied while movie_details still equals read (nil when the
+// torrent had none), as returned by GetTorrent, and fails with
+// ErrConcurrentUpdate otherwise. Only movie_details is compared, so progress,
+// name or files written in the meantime never cause a conflict. updated_at
+// is not usable for this, as every progress write changes it.
+func (s *TorrentStore) UpdateFieldsIfDetailsUnchanged(infoHash string, fields map[string]any, read *MovieDetails) error {
+	return s.updateFields(infoHash, fields, true, read)
+}
+
+// updateFields applies fields in a transaction; with checkDetails it first
+// compares the stored movie details to read
+func (s *TorrentStore) updateFields(infoHash string, fields map[string]any, checkDetails bool, read *MovieDetails) error {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		if _, ok := updatableColumns[name]; !ok {
+			return fmt.Errorf("无法更新字段 %s", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	columns := make([]string, 0, len(names)+1)
+	args := make([]interface{}, 0, len(names)+2)
+	for _, name := range names {
+		value := fields[name]
+		if updatableColumns[name] {
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return fmt.Errorf("序列化字段 %s 失败: %w", name, err)
+			}
+			value = string(encoded)
+		}
+		columns = append(columns, name+" = ?")
+		args = append(args, value)
+	}
+	columns = append(columns, "updated_at = ?")
+	args = append(args, time.Now(), infoHash)
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	// Check if the torrent exists
-	var exists bool
-	err := s.db.QueryRow("SELECT 1 FROM torrents WHERE info_hash = ?", record.InfoHash).Scan(&exists)
+	tx, err := s.db.Begin()
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("torrent with info_hash %s does not exist", record.InfoHash)
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	var movieDetailsJSON sql.NullString
+	err = tx.QueryRow("SELECT movie_details FROM torrents WHERE info_hash = ?", infoHash).Scan(&movieDetailsJSON)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("torrent with info_hash %s does not exist", infoHash)
+	}
+	if err != nil {
+		return fmt.Errorf("查询种子记录失败: %w", err)
+	}
+	if checkDetails {
+		// Decoded the same way as in GetTorrent, so unchanged details compare equal
+		stored, err := decodeMovieDetails(movieDetailsJSON)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(stored, read) {
+			return ErrConcurrentUpdate
 		}
-		return err
 	}
 
-	// Convert Files slice to JSON
-	filesJSON, err := json.Marshal(record.Files)
+	if _, err := tx.Exec("UPDATE torrents SET "+strings.Join(columns, ", ")+" WHERE info_hash = ?", args...); err != nil {
+		return fmt.Errorf("更新种子记录失败: %w", err)
+	}
+	return tx.Commit()
+}
+
+// UpdateProgress records how much of a torrent is downloaded without touching
+// the rest of the record
+func (s *TorrentStore) UpdateProgress(infoHash string, downloaded int64, progress float32) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result, err := s.stmts.updateProgress.Exec(downloaded, progress, time.Now(), infoHash)
 	if err != nil {
-		return err
+		return fmt.Errorf("更新种子进度失败: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("torrent with info_hash %s does not exist", infoHash)
 	}
+	return nil
+}
 
-	// Update the torrent record
-	_, err = s.db.Exec(`
-		UPDATE torrents 
-		SET name = ?, magnet_uri = ?, added_at = ?, data_path = ?, length = ?, files = ?, downloaded = ?, progress = ?, state = ?
-		WHERE info_hash = ?
-	`,
-		record.Name, record.MagnetURI, record.AddedAt, record.DataPath,
-		record.Length, string(filesJSON), record.Downloaded, record.Progress, record.State, record.InfoHash,
-	)
-	return err
+// ProgressUpdate is the download progress of one torrent
+type ProgressUpdate struct {
+	InfoHash   string
+	Downloaded int64
+	Progress   float32
 }
 
-// UpdateTorrentMovieDetail updates an existing torrent record in the database
-func (s *TorrentStore) UpdateTorrentMovieDetail(record *TorrentRecord) error {
+// UpdateProgressBatch records the progress of many torrents in one
+// transaction, so SQLite syncs to disk once instead of once per torrent.
+// Torrents that no longer exist are skipped.
+func (s *TorrentStore) UpdateProgressBatch(updates []ProgressUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	// Check if the torrent exists
-	var exists bool
-	err := s.db.QueryRow("SELECT 1 FROM torrents WHERE info_hash = ?", record.InfoHash).Scan(&exists)
+	tx, err := s.db.Begin()
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("torrent with info_hash %s does not exist", record.InfoHash)
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt := tx.Stmt(s.stmts.updateProgress)
+	now := time.Now()
+	for _, update := range updates {
+		if _, err := stmt.Exec(update.Downloaded, update.Progress, now, update.InfoHash); err != nil {
+			return fmt.Errorf("更新种子进度失败: %w", err)
 		}
-		return err
 	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("更新种子进度失败: %w", err)
+	}
+	return nil
+}
 
-	// Convert Files slice to JSON
-	MovieDetails, err := json.Marshal(record.MovieDetails)
+// UpdateTorrentMovieDetail saves the movie details of a torrent record,
+// leaving its other columns as they are
+func (s *TorrentStore) UpdateTorrentMovieDetail(record *TorrentRecord) error {
+	return s.UpdateFields(record.InfoHash, map[string]any{"movie_details": record.MovieDetails})
+}
+
+// UpdateState persists a torrent's lifecycle state and the reason for the
+// last transition without touching the rest of the record
+func (s *TorrentStore) UpdateState(infoHash, state, reason string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result, err := s.stmts.updateState.Exec(state, reason, time.Now(), infoHash)
+	if err != nil {
+		return fmt.Errorf("更新种子状态失败: %w", err)
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("torrent with info_hash %s does not exist", infoHash)
+	}
+	return nil
+}
+
+// SetLastError records the last failure of an operation on a torrent
+func (s *TorrentStore) SetLastError(infoHash, message string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.db.Exec(`
+		UPDATE torrents SET last_error = ?, updated_at = ?
+		WHERE info_hash = ?
+	`, message, time.Now(), infoHash); err != nil {
+		return fmt.Errorf("保存种子错误失败: %w", err)
+	}
+	return nil
+}
+
+// MarkPrivate records that a torrent is private, once its metadata shows the
+// private flag
+func (s *TorrentStore) MarkPrivate(infoHash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.db.Exec(`
+		UPDATE torrents SET private = 1, updated_at = ?
+		WHERE info_hash = ?
+	`, time.Now(), infoHash); err != nil {
+		return fmt.Errorf("更新种子私有标记失败: %w", err)
+	}
+	return nil
+}
+
+// MarkCompleted records when a torrent first finished downloading. Later calls
+// keep the original time and report false.
+func (s *TorrentStore) MarkCompleted(infoHash string, at time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result, err := s.stmts.markCompleted.Exec(at, infoHash)
+	if err != nil {
+		return false, fmt.Errorf("更新种子完成时间失败: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("更新种子完成时间失败: %w", err)
+	}
+	return n > 0, nil
+}
+
+// MarkFilePlayable records when a file of a torrent first became playable.
+// Later calls keep the original time and report false.
+func (s *TorrentStore) MarkFilePlayable(infoHash string, fileIndex int, at time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result, err := s.db.Exec(`
+		INSERT INTO playable_files (info_hash, file_index, playable_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(info_hash, file_index) DO NOTHING
+	`, infoHash, fileIndex, at)
+	if err != nil {
+		return false, fmt.Errorf("保存文件可播放时间失败: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("保存文件可播放时间失败: %w", err)
+	}
+	return n > 0, nil
+}
+
+// SetWatched marks a torrent as fully watched, or clears the mark
+func (s *TorrentStore) SetWatched(infoHash string, watched bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var watchedAt interface{}
+	if watched {
+		watchedAt = time.Now()
+	}
+
+	result, err := s.db.Exec("UPDATE torrents SET watched_at = ? WHERE info_hash = ?", watchedAt, infoHash)
+	if err != nil {
+		return fmt.Errorf("更新观看状态失败: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("torrent with info_hash %s does not exist", infoHash)
+	}
+	return nil
+}
+
+// SetLabels replaces a torrent's category and tags
+func (s *TorrentStore) SetLabels(infoHash, category string, tags []string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tagsJSON, err := marshalTags(tags)
 	if err != nil {
 		return err
 	}
 
-	// Update the torrent record
-	_, err = s.db.Exec(`
-		UPDATE torrents 
-		SET name = ?, magnet_uri = ?, added_at = ?, data_path = ?, length = ?, movie_details = ?, downloaded = ?, progress = ?, state = ?
+	result, err := s.db.Exec(`
+		UPDATE torrents SET category = ?, tags = ?, updated_at = ?
 		WHERE info_hash = ?
-	`,
-		record.Name, record.MagnetURI, record.AddedAt, record.DataPath,
-		record.Length, string(MovieDetails), record.Downloaded, record.Progress, record.State, record.InfoHash,
-	)
-	return err
+	`, category, tagsJSON, time.Now(), infoHash)
+	if err != nil {
+		return fmt.Errorf("更新种子分类和标签失败: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("torrent with info_hash %s does not exist", infoHash)
+	}
+	return nil
+}
+
+// marshalTags encodes tags as a JSON array, or an empty string when there
+// are none
+func marshalTags(tags []string) (string, error) {
+	if len(tags) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return "", fmt.Errorf("序列化标签失败: %w", err)
+	}
+	return string(data), nil
+}
+
+// RetentionRecord is the subset of a torrent record used by retention rules
+type RetentionRecord struct {
+	InfoHash    string
+	Name        string
+	Length      int64
+	State       string
+	DataPath    string
+	AddedAt     time.Time
+	CompletedAt *time.Time
+	WatchedAt   *time.Time
+}
+
+// ListRetention retrieves the fields retention rules need for every torrent
+// outside the trash
+func (s *TorrentStore) ListRetention() ([]RetentionRecord, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT info_hash, COALESCE(name, ''), COALESCE(length, 0), COALESCE(state, ''),
+		       COALESCE(data_path, ''), added_at, completed_at, watched_at
+		FROM torrents
+		WHERE deleted_at IS NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("查询种子列表失败: %w", err)
+	}
+	defer rows.Close()
+
+	var records []RetentionRecord
+	for rows.Next() {
+		var record RetentionRecord
+		var addedAt, completedAt, watchedAt sql.NullTime
+
+		if err := rows.Scan(
+			&record.InfoHash, &record.Name, &record.Length, &record.State,
+			&record.DataPath, &addedAt, &completedAt, &watchedAt,
+		); err != nil {
+			return nil, fmt.Errorf("读取种子记录失败: %w", err)
+		}
+
+		if addedAt.Valid {
+			record.AddedAt = addedAt.Time
+		}
+		if completedAt.Valid {
+			record.CompletedAt = &completedAt.Time
+		}
+		if watchedAt.Valid {
+			record.WatchedAt = &watchedAt.Time
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
 }
 
 // DeleteTorrent removes a torrent record from the database
@@ -476,5 +1064,151 @@ func (s *TorrentStore) DeleteTorrent(infoHash string) error {
 		return fmt.Errorf("torrent with info_hash %s does not exist", infoHash)
 	}
 
+	if _, err := s.db.Exec("DELETE FROM torrent_info WHERE info_hash = ?", infoHash); err != nil {
+		return fmt.Errorf("删除种子元数据失败: %w", err)
+	}
+	if _, err := s.db.Exec("DELETE FROM playable_files WHERE info_hash = ?", infoHash); err != nil {
+		return fmt.Errorf("删除文件可播放记录失败: %w", err)
+	}
+
+	return nil
+}
+
+// TrashRecord is a torrent in the trash. DeleteData records whether its data
+// is deleted when it is purged.
+type TrashRecord struct {
+	InfoHash   string    `json:"infoHash"`
+	Name       string    `json:"name"`
+	Length     int64     `json:"length"`
+	Progress   float32   `json:"progress"`
+	DataPath   string    `json:"dataPath,omitempty"`
+	DeleteData bool      `json:"deleteData"`
+	DeletedAt  time.Time `json:"deletedAt"`
+}
+
+const trashColumns = `info_hash, COALESCE(name, ''), COALESCE(length, 0), COALESCE(progress, 0),
+		       COALESCE(data_path, ''), delete_data, deleted_at`
+
+// TrashTorrent moves a torrent to the trash, which hides it from every
+// listing until it is restored or purged
+func (s *TorrentStore) TrashTorrent(infoHash string, deleteData bool, at time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result, err := s.db.Exec(`
+		UPDATE torrents SET deleted_at = ?, delete_data = ?, updated_at = ?
+		WHERE info_hash = ? AND deleted_at IS NULL
+	`, at, deleteData, at, infoHash)
+	if err != nil {
+		return fmt.Errorf("移入回收站失败: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("torrent with info_hash %s does not exist", infoHash)
+	}
 	return nil
 }
+
+// UntrashTorrent takes a torrent out of the trash. ok is false if it was not
+// in the trash.
+func (s *TorrentStore) UntrashTorrent(infoHash string) (ok bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result, err := s.db.Exec(`
+		UPDATE torrents SET deleted_at = NULL, delete_data = 0, updated_at = ?
+		WHERE info_hash = ? AND deleted_at IS NOT NULL
+	`, time.Now(), infoHash)
+	if err != nil {
+		return false, fmt.Errorf("从回收站恢复失败: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetTrashRecord retrieves a torrent in the trash, or nil if it is not there
+func (s *TorrentStore) GetTrashRecord(infoHash string) (*TrashRecord, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var record TrashRecord
+	err := s.db.QueryRow(`
+		SELECT `+trashColumns+`
+		FROM torrents WHERE info_hash = ? AND deleted_at IS NOT NULL
+	`, infoHash).Scan(
+		&record.InfoHash, &record.Name, &record.Length, &record.Progress,
+		&record.DataPath, &record.DeleteData, &record.DeletedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询回收站失败: %w", err)
+	}
+	return &record, nil
+}
+
+// ListTrash retrieves the torrents in the trash, most recently deleted first
+func (s *TorrentStore) ListTrash() ([]TrashRecord, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT ` + trashColumns + `
+		FROM torrents WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("查询回收站失败: %w", err)
+	}
+	defer rows.Close()
+
+	records := []TrashRecord{}
+	for rows.Next() {
+		var record TrashRecord
+		if err := rows.Scan(
+			&record.InfoHash, &record.Name, &record.Length, &record.Progress,
+			&record.DataPath, &record.DeleteData, &record.DeletedAt,
+		); err != nil {
+			return nil, fmt.Errorf("读取回收站记录失败: %w", err)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// SaveInfoBytes stores the bencoded info dictionary of a torrent, so it can be
+// restored without fetching its metadata from peers again. The info of an
+// info hash never changes, so a stored copy is kept as is.
+func (s *TorrentStore) SaveInfoBytes(infoHash string, info []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, err := s.db.Exec(`
+		INSERT INTO torrent_info (info_hash, info, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(info_hash) DO NOTHING
+	`, infoHash, info, time.Now())
+	if err != nil {
+		return fmt.Errorf("保存种子元数据失败: %w", err)
+	}
+	return nil
+}
+
+// GetInfoBytes returns the stored info dictionary of a torrent, or nil if its
+// metadata has not arrived yet
+func (s *TorrentStore) GetInfoBytes(infoHash string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var info []byte
+	err := s.db.QueryRow("SELECT info FROM torrent_info WHERE info_hash = ?", infoHash).Scan(&info)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询种子元数据失败: %w", err)
+	}
+	return info, nil
+}
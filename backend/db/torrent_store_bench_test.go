@@ -0,0 +1,89 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// benchTorrents is the library size the progress benchmarks write to, about
+// what a seedbox accumulates
+const benchTorrents = 250
+
+func newBenchStore(b *testing.B) *TorrentStore {
+	b.Helper()
+
+	// 迁移日志会淹没基准测试的输出
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	manager, err := NewDatabaseManager(filepath.Join(b.TempDir(), "bench.db"), 10, time.Hour)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { manager.Close() })
+
+	store, err := NewTorrentStore(manager)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < benchTorrents; i++ {
+		if err := store.AddTorrent(&TorrentRecord{
+			InfoHash:  fmt.Sprintf("%040x", i),
+			Name:      fmt.Sprintf("torrent %d", i),
+			MagnetURI: fmt.Sprintf("magnet:?xt=urn:btih:%040x", i),
+			AddedAt:   time.Now(),
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return store
+}
+
+// BenchmarkProgressUnprepared writes the progress of every torrent one
+// statement at a time, parsing the SQL on each call
+func BenchmarkProgressUnprepared(b *testing.B) {
+	store := newBenchStore(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < benchTorrents; i++ {
+			if _, err := store.db.Exec(updateProgressQuery, int64(n), float32(0.5), time.Now(), fmt.Sprintf("%040x", i)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkProgressPrepared writes the progress of every torrent one
+// statement at a time with the prepared statement
+func BenchmarkProgressPrepared(b *testing.B) {
+	store := newBenchStore(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < benchTorrents; i++ {
+			if err := store.UpdateProgress(fmt.Sprintf("%040x", i), int64(n), 0.5); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkProgressBatch writes the progress of every torrent in one
+// transaction
+func BenchmarkProgressBatch(b *testing.B) {
+	store := newBenchStore(b)
+	updates := make([]ProgressUpdate, benchTorrents)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := range updates {
+			updates[i] = ProgressUpdate{InfoHash: fmt.Sprintf("%040x", i), Downloaded: int64(n), Progress: 0.5}
+		}
+		if err := store.UpdateProgressBatch(updates); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
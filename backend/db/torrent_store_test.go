@@ -0,0 +1,195 @@
+package db
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *TorrentStore {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	manager := openTestManager(t, filepath.Join(t.TempDir(), "torrents.db"))
+	t.Cleanup(func() { manager.Close() })
+	store, err := NewTorrentStore(manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddTorrent(&TorrentRecord{InfoHash: "abc", Name: "movie", MagnetURI: "magnet:?xt=urn:btih:abc"}); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestAddTorrentKeepsExistingRecord(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	manager := openTestManager(t, filepath.Join(t.TempDir(), "torrents.db"))
+	defer manager.Close()
+	store, err := NewTorrentStore(manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := store.AddTorrent(&TorrentRecord{
+		InfoHash:     "abc",
+		Name:         "movie",
+		MagnetURI:    "magnet:?xt=urn:btih:abc",
+		AddedAt:      addedAt,
+		Category:     "电影",
+		AddedBy:      1,
+		MovieDetails: &MovieDetails{Filename: "movie.mkv", Year: 2020},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateProgress("abc", 21, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	first, err := store.GetTorrent("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.TrashTorrent("abc", false, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 再次添加同一个种子：恢复回收站中的记录，保留电影详情、分类和时间，进度和添加者按新添加的种子
+	if err := store.AddTorrent(&TorrentRecord{
+		InfoHash:  "abc",
+		Name:      "abc",
+		MagnetURI: "magnet:?xt=urn:btih:abc&dn=movie",
+		State:     "queued",
+		AddedBy:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	record, err := store.GetTorrent("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record == nil {
+		t.Fatal("再次添加后记录仍在回收站中")
+	}
+	if record.MovieDetails == nil || record.MovieDetails.Filename != "movie.mkv" {
+		t.Errorf("电影详情 = %+v，应保留原有详情", record.MovieDetails)
+	}
+	if record.Category != "电影" {
+		t.Errorf("分类 = %q，应保留原有分类", record.Category)
+	}
+	if !record.AddedAt.Equal(addedAt) || !record.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("添加时间 %v、创建时间 %v 被覆盖", record.AddedAt, record.CreatedAt)
+	}
+	if record.MagnetURI != "magnet:?xt=urn:btih:abc&dn=movie" || record.State != "queued" {
+		t.Errorf("磁力链接 %q、状态 %q 未更新", record.MagnetURI, record.State)
+	}
+	if record.Downloaded != 0 || record.Progress != 0 {
+		t.Errorf("已下载 %d、进度 %v，应重新开始", record.Downloaded, record.Progress)
+	}
+	if record.AddedBy != 2 {
+		t.Errorf("添加者 = %d，应为再次添加的用户", record.AddedBy)
+	}
+}
+
+func TestUpdateFieldsRejectsColumns(t *testing.T) {
+	store := openTestStore(t)
+
+	for _, column := range []string{"info_hash", "updated_at", "version", "tags", "name = 'x', magnet_uri"} {
+		err := store.UpdateFields("abc", map[string]any{"name": "changed", column: "x"})
+		if err == nil || !strings.Contains(err.Error(), column) {
+			t.Errorf("更新字段 %s: err = %v，应拒绝", column, err)
+		}
+	}
+	record, err := store.GetTorrent("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Name != "movie" {
+		t.Errorf("拒绝的更新修改了记录: 名称 %q", record.Name)
+	}
+}
+
+func TestUpdateFieldsEncodesJSON(t *testing.T) {
+	store := openTestStore(t)
+
+	files := []FileInfo{{Path: "movie/movie.mkv", Length: 42, FileIndex: 0, IsVideo: true}}
+	details := &MovieDetails{Filename: "movie.mkv", Year: 2020, Genres: []string{"剧情"}}
+	if err := store.UpdateFields("abc", map[string]any{"files": files, "movie_details": details, "length": int64(42)}); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := store.GetTorrent("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(record.Files) != 1 || record.Files[0].Path != "movie/movie.mkv" || !record.Files[0].IsVideo {
+		t.Errorf("文件列表 = %+v", record.Files)
+	}
+	if record.MovieDetails == nil || record.MovieDetails.Year != 2020 || len(record.MovieDetails.Genres) != 1 {
+		t.Errorf("电影详情 = %+v", record.MovieDetails)
+	}
+	if record.Length != 42 {
+		t.Errorf("长度 %d，应为 42", record.Length)
+	}
+}
+
+func TestUpdateFieldsMissingTorrent(t *testing.T) {
+	store := openTestStore(t)
+
+	if err := store.UpdateFields("missing", map[string]any{"name": "x"}); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("UpdateFields: err = %v，应报告记录不存在", err)
+	}
+	if err := store.UpdateFieldsIfDetailsUnchanged("missing", map[string]any{"name": "x"}, nil); err == nil || errors.Is(err, ErrConcurrentUpdate) {
+		t.Errorf("UpdateFieldsIfDetailsUnchanged: err = %v，应报告记录不存在", err)
+	}
+}
+
+func TestUpdateFieldsIfDetailsUnchanged(t *testing.T) {
+	store := openTestStore(t)
+
+	read, err := store.GetTorrent("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 读取之后写入的进度、状态、名称和文件列表不造成冲突
+	if err := store.UpdateProgress("abc", 10, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateState("abc", "downloading", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateFields("abc", map[string]any{"name": "renamed", "files": []FileInfo{{Path: "movie.mkv", Length: 42}}}); err != nil {
+		t.Fatal(err)
+	}
+	first := &MovieDetails{Filename: "movie.mkv", Year: 2020}
+	if err := store.UpdateFieldsIfDetailsUnchanged("abc", map[string]any{"movie_details": first}, read.MovieDetails); err != nil {
+		t.Fatalf("详情未变化时: %v", err)
+	}
+
+	// 详情在读取之后已被修改
+	second := &MovieDetails{Filename: "movie.mkv", Year: 2021}
+	if err := store.UpdateFieldsIfDetailsUnchanged("abc", map[string]any{"movie_details": second}, read.MovieDetails); !errors.Is(err, ErrConcurrentUpdate) {
+		t.Fatalf("err = %v，应为 ErrConcurrentUpdate", err)
+	}
+	record, err := store.GetTorrent("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.MovieDetails == nil || record.MovieDetails.Year != 2020 || record.Name != "renamed" || record.Downloaded != 10 {
+		t.Errorf("详情 %+v，名称 %q，已下载 %d，冲突的更新不应生效", record.MovieDetails, record.Name, record.Downloaded)
+	}
+
+	// 与重新读取的详情比较时可以保存
+	if err := store.UpdateFieldsIfDetailsUnchanged("abc", map[string]any{"movie_details": second}, record.MovieDetails); err != nil {
+		t.Fatalf("重新读取后: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TrackerEdits are the changes a user made to a torrent's tracker list. They
+// are replayed when the torrent is restored, since the stored magnet link only
+// carries the trackers it was added with.
+type TrackerEdits struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// TrackerStore handles the storage of per-torrent tracker edits
+type TrackerStore struct {
+	db *sql.DB
+}
+
+// NewTrackerStore creates a new TrackerStore sharing the manager's connection pool
+func NewTrackerStore(dbManager *DatabaseManager) *TrackerStore {
+	return &TrackerStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+// GetTrackerEdits retrieves the tracker edits of a torrent
+func (s *TrackerStore) GetTrackerEdits(infoHash string) (*TrackerEdits, error) {
+	rows, err := s.db.Query(`
+		SELECT url, removed FROM torrent_trackers
+		WHERE info_hash = ?
+		ORDER BY created_at
+	`, infoHash)
+	if err != nil {
+		return nil, fmt.Errorf("查询tracker记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	edits := &TrackerEdits{}
+	for rows.Next() {
+		var url string
+		var removed bool
+		if err := rows.Scan(&url, &removed); err != nil {
+			return nil, fmt.Errorf("读取tracker记录失败: %w", err)
+		}
+		if removed {
+			edits.Removed = append(edits.Removed, url)
+		} else {
+			edits.Added = append(edits.Added, url)
+		}
+	}
+
+	return edits, rows.Err()
+}
+
+// SaveTrackerEdit records that a tracker was added to or removed from a
+// torrent, replacing any earlier edit of the same tracker
+func (s *TrackerStore) SaveTrackerEdit(infoHash, url string, removed bool) error {
+	_, err := s.db.Exec(`
+		INSERT INTO torrent_trackers (info_hash, url, removed, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(info_hash, url) DO UPDATE SET
+			removed = excluded.removed,
+			created_at = excluded.created_at
+	`, infoHash, url, removed, time.Now())
+	if err != nil {
+		return fmt.Errorf("保存tracker记录失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteTrackerEdits removes all tracker edits of a torrent
+func (s *TrackerStore) DeleteTrackerEdits(infoHash string) error {
+	if _, err := s.db.Exec("DELETE FROM torrent_trackers WHERE info_hash = ?", infoHash); err != nil {
+		return fmt.Errorf("删除tracker记录失败: %w", err)
+	}
+	return nil
+}
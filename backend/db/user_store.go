@@ -0,0 +1,179 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// User represents an account that can log in to the API. Role is admin or
+// viewer; viewers can only browse and stream.
+type User struct {
+	ID           int64      `json:"id"`
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"-"`
+	Role         string     `json:"role"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	LastLoginAt  *time.Time `json:"lastLoginAt,omitempty"`
+}
+
+// UserStore handles the storage and retrieval of users
+type UserStore struct {
+	db *sql.DB
+}
+
+// NewUserStore creates a new UserStore sharing the manager's connection pool
+func NewUserStore(dbManager *DatabaseManager) *UserStore {
+	return &UserStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+// CreateUser inserts a new user with an already hashed password
+func (s *UserStore) CreateUser(username, passwordHash, role string) (*User, error) {
+	now := time.Now()
+	result, err := s.db.Exec(
+		"INSERT INTO users (username, password_hash, role, created_at) VALUES (?, ?, ?, ?)",
+		username, passwordHash, role, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("创建用户失败: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("获取用户ID失败: %w", err)
+	}
+
+	return &User{
+		ID:           id,
+		Username:     username,
+		PasswordHash: passwordHash,
+		Role:         role,
+		CreatedAt:    now,
+	}, nil
+}
+
+// GetUserByUsername retrieves a user by username, returning nil when not found
+func (s *UserStore) GetUserByUsername(username string) (*User, error) {
+	return s.getUser("username = ?", username)
+}
+
+// GetUserByID retrieves a user by id, returning nil when not found
+func (s *UserStore) GetUserByID(id int64) (*User, error) {
+	return s.getUser("id = ?", id)
+}
+
+const userColumns = "id, username, password_hash, role, created_at, last_login_at"
+
+// scanUser reads a row selected with userColumns
+func scanUser(row interface{ Scan(...interface{}) error }) (*User, error) {
+	var user User
+	var lastLoginAt sql.NullTime
+
+	if err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role,
+		&user.CreatedAt, &lastLoginAt); err != nil {
+		return nil, err
+	}
+	if lastLoginAt.Valid {
+		user.LastLoginAt = &lastLoginAt.Time
+	}
+	return &user, nil
+}
+
+// getUser runs a single-row user query with the given condition
+func (s *UserStore) getUser(where string, arg interface{}) (*User, error) {
+	user, err := scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE "+where, arg))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询用户失败: %w", err)
+	}
+	return user, nil
+}
+
+// ListUsers returns all users ordered by id
+func (s *UserStore) ListUsers() ([]*User, error) {
+	rows, err := s.db.Query("SELECT " + userColumns + " FROM users ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("查询用户列表失败: %w", err)
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("读取用户失败: %w", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// CountUsersWithRole returns the number of users with the given role
+func (s *UserStore) CountUsersWithRole(role string) (int, error) {
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM users WHERE role = ?", role).Scan(&count); err != nil {
+		return 0, fmt.Errorf("获取用户数量失败: %w", err)
+	}
+	return count, nil
+}
+
+// UpdateRole changes a user's role
+func (s *UserStore) UpdateRole(id int64, role string) error {
+	if _, err := s.db.Exec("UPDATE users SET role = ? WHERE id = ?", role, id); err != nil {
+		return fmt.Errorf("更新用户角色失败: %w", err)
+	}
+	return nil
+}
+
+// UpdatePassword replaces a user's password hash
+func (s *UserStore) UpdatePassword(id int64, passwordHash string) error {
+	if _, err := s.db.Exec("UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, id); err != nil {
+		return fmt.Errorf("更新用户密码失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteUser removes a user together with their API keys, preferences and
+// playback positions, reporting whether the user existed
+func (s *UserStore) DeleteUser(id int64) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("删除用户失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"api_keys", "user_preferences", "playback_positions"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", id); err != nil {
+			return false, fmt.Errorf("删除用户数据失败: %w", err)
+		}
+	}
+	result, err := tx.Exec("DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return false, fmt.Errorf("删除用户失败: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("删除用户失败: %w", err)
+	}
+
+	return affected > 0, tx.Commit()
+}
+
+// CountUsers returns the number of registered users
+func (s *UserStore) CountUsers() (int, error) {
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return 0, fmt.Errorf("获取用户数量失败: %w", err)
+	}
+	return count, nil
+}
+
+// UpdateLastLogin records a successful login
+func (s *UserStore) UpdateLastLogin(id int64) error {
+	_, err := s.db.Exec("UPDATE users SET last_login_at = ? WHERE id = ?", time.Now(), id)
+	return err
+}
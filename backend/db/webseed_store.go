@@ -0,0 +1,79 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// WebseedEdits are the changes a user made to a torrent's web seeds. Like
+// tracker edits they are replayed when the torrent is restored.
+type WebseedEdits struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// WebseedStore handles the storage of per-torrent web seed edits
+type WebseedStore struct {
+	db *sql.DB
+}
+
+// NewWebseedStore creates a new WebseedStore sharing the manager's connection pool
+func NewWebseedStore(dbManager *DatabaseManager) *WebseedStore {
+	return &WebseedStore{
+		db: dbManager.GetDB(),
+	}
+}
+
+// GetWebseedEdits retrieves the web seed edits of a torrent
+func (s *WebseedStore) GetWebseedEdits(infoHash string) (*WebseedEdits, error) {
+	rows, err := s.db.Query(`
+		SELECT url, removed FROM torrent_webseeds
+		WHERE info_hash = ?
+		ORDER BY created_at
+	`, infoHash)
+	if err != nil {
+		return nil, fmt.Errorf("查询web seed记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	edits := &WebseedEdits{}
+	for rows.Next() {
+		var url string
+		var removed bool
+		if err := rows.Scan(&url, &removed); err != nil {
+			return nil, fmt.Errorf("读取web seed记录失败: %w", err)
+		}
+		if removed {
+			edits.Removed = append(edits.Removed, url)
+		} else {
+			edits.Added = append(edits.Added, url)
+		}
+	}
+
+	return edits, rows.Err()
+}
+
+// SaveWebseedEdit records that a web seed was added to or removed from a
+// torrent, replacing any earlier edit of the same URL
+func (s *WebseedStore) SaveWebseedEdit(infoHash, url string, removed bool) error {
+	_, err := s.db.Exec(`
+		INSERT INTO torrent_webseeds (info_hash, url, removed, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(info_hash, url) DO UPDATE SET
+			removed = excluded.removed,
+			created_at = excluded.created_at
+	`, infoHash, url, removed, time.Now())
+	if err != nil {
+		return fmt.Errorf("保存web seed记录失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteWebseedEdits removes all web seed edits of a torrent
+func (s *WebseedStore) DeleteWebseedEdits(infoHash string) error {
+	if _, err := s.db.Exec("DELETE FROM torrent_webseeds WHERE info_hash = ?", infoHash); err != nil {
+		return fmt.Errorf("删除web seed记录失败: %w", err)
+	}
+	return nil
+}
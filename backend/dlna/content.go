@@ -0,0 +1,350 @@
+package dlna
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/torrentplayer/backend/service"
+	"github.com/torrentplayer/backend/torrent"
+)
+
+const (
+	rootID = "0"
+
+	// contentFeatures 支持按字节拖动（DLNA.ORG_OP=01），未转码（DLNA.ORG_CI=0），流式传输
+	contentFeatures = "DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=01700000000000000000000000000000"
+)
+
+// errNoSuchObject 对象不存在，对应 UPnP 错误码 701
+var errNoSuchObject = errors.New("no such object")
+
+// mediaTypes 按扩展名识别的媒体类型和 UPnP 类别，不在表中的文件不出现在目录中
+var mediaTypes = map[string][2]string{
+	".mp4":  {"video/mp4", "object.item.videoItem"},
+	".m4v":  {"video/mp4", "object.item.videoItem"},
+	".mkv":  {"video/x-matroska", "object.item.videoItem"},
+	".avi":  {"video/x-msvideo", "object.item.videoItem"},
+	".mov":  {"video/quicktime", "object.item.videoItem"},
+	".wmv":  {"video/x-ms-wmv", "object.item.videoItem"},
+	".webm": {"video/webm", "object.item.videoItem"},
+	".ts":   {"video/mp2t", "object.item.videoItem"},
+	".m2ts": {"video/mp2t", "object.item.videoItem"},
+	".mpg":  {"video/mpeg", "object.item.videoItem"},
+	".mpeg": {"video/mpeg", "object.item.videoItem"},
+	".flv":  {"video/x-flv", "object.item.videoItem"},
+	".mp3":  {"audio/mpeg", "object.item.audioItem.musicTrack"},
+	".flac": {"audio/flac", "object.item.audioItem.musicTrack"},
+	".m4a":  {"audio/mp4", "object.item.audioItem.musicTrack"},
+	".aac":  {"audio/aac", "object.item.audioItem.musicTrack"},
+	".ogg":  {"audio/ogg", "object.item.audioItem.musicTrack"},
+	".wav":  {"audio/wav", "object.item.audioItem.musicTrack"},
+	".jpg":  {"image/jpeg", "object.item.imageItem.photo"},
+	".jpeg": {"image/jpeg", "object.item.imageItem.photo"},
+	".png":  {"image/png", "object.item.imageItem.photo"},
+}
+
+// mediaType 文件的 MIME 类型和 UPnP 类别，不是媒体文件时类别为空
+func mediaType(filePath string) (string, string) {
+	if t, ok := mediaTypes[strings.ToLower(path.Ext(filePath))]; ok {
+		return t[0], t[1]
+	}
+	return "application/octet-stream", ""
+}
+
+// browsable 可以在目录中出现的文件：可以边下边播的视频，或已下载完成的媒体文件
+func browsable(file torrent.FileInfo) bool {
+	if _, class := mediaType(file.Path); class == "" {
+		return false
+	}
+	return file.IsPlayable || (file.Length > 0 && file.BytesCompleted == file.Length)
+}
+
+// object 目录中的文件夹或条目
+type object struct {
+	id, parentID, title, class string
+	childCount                 int
+
+	// 以下字段只用于条目
+	mimeType string
+	size     int64
+	url      string
+}
+
+// didl 把对象编码为 DIDL-Lite
+func didl(objects []object) string {
+	var b strings.Builder
+	b.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/" xmlns:dlna="urn:schemas-dlna-org:metadata-1-0/">`)
+	for _, o := range objects {
+		if o.url == "" {
+			fmt.Fprintf(&b, `<container id="%s" parentID="%s" restricted="1" childCount="%d">`, xmlEscape(o.id), xmlEscape(o.parentID), o.childCount)
+		} else {
+			fmt.Fprintf(&b, `<item id="%s" parentID="%s" restricted="1">`, xmlEscape(o.id), xmlEscape(o.parentID))
+		}
+		fmt.Fprintf(&b, `<dc:title>%s</dc:title><upnp:class>%s</upnp:class>`, xmlEscape(o.title), o.class)
+		if o.url == "" {
+			b.WriteString(`</container>`)
+			continue
+		}
+		fmt.Fprintf(&b, `<res size="%d" protocolInfo="http-get:*:%s:%s">%s</res></item>`, o.size, o.mimeType, contentFeatures, xmlEscape(o.url))
+	}
+	b.WriteString(`</DIDL-Lite>`)
+	return b.String()
+}
+
+// browse 实现 ContentDirectory 的 Browse 动作，baseURL 为媒体文件地址的前缀
+// 根目录下每个种子是一个文件夹，文件夹 ID 为 infoHash，条目 ID 为 infoHash/文件索引
+func (s *Server) browse(baseURL, objectID, flag string, start, count int) ([]object, int, error) {
+	var parent object
+	var children []object
+
+	switch {
+	case objectID == rootID:
+		parent = object{id: rootID, parentID: "-1", title: s.name, class: "object.container"}
+		torrents, _, err := s.torrentService.ListTorrents(service.TorrentListQuery{Sort: "added", Desc: true})
+		if err != nil {
+			return nil, 0, err
+		}
+		for i := range torrents {
+			if folder, ok := torrentFolder(&torrents[i]); ok {
+				children = append(children, folder)
+			}
+		}
+	default:
+		infoHash, fileIndex, isItem := strings.Cut(objectID, "/")
+		info, err := s.torrentService.GetTorrent(infoHash)
+		if err != nil {
+			return nil, 0, errNoSuchObject
+		}
+		folder, ok := torrentFolder(info)
+		if !ok {
+			return nil, 0, errNoSuchObject
+		}
+		parent = folder
+		for _, file := range info.Files {
+			if browsable(file) {
+				children = append(children, fileItem(baseURL, info.InfoHash, file))
+			}
+		}
+		if isItem {
+			index, err := strconv.Atoi(fileIndex)
+			if err != nil || flag != "BrowseMetadata" {
+				return nil, 0, errNoSuchObject
+			}
+			for _, child := range children {
+				if child.id == infoHash+"/"+strconv.Itoa(index) {
+					return []object{child}, 1, nil
+				}
+			}
+			return nil, 0, errNoSuchObject
+		}
+	}
+
+	parent.childCount = len(children)
+	if flag == "BrowseMetadata" {
+		return []object{parent}, 1, nil
+	}
+
+	total := len(children)
+	if start > total {
+		start = total
+	}
+	children = children[start:]
+	if count > 0 && count < len(children) {
+		children = children[:count]
+	}
+	return children, total, nil
+}
+
+// torrentFolder 种子对应的文件夹，没有可浏览的文件时不显示
+func torrentFolder(info *torrent.TorrentInfo) (object, bool) {
+	count := 0
+	for _, file := range info.Files {
+		if browsable(file) {
+			count++
+		}
+	}
+	if count == 0 {
+		return object{}, false
+	}
+
+	title := info.Name
+	if details := info.MovieDetails; details != nil && details.Filename != "" {
+		title = details.Filename
+		if details.Year > 0 {
+			title += fmt.Sprintf(" (%d)", details.Year)
+		}
+	}
+	return object{
+		id:         info.InfoHash,
+		parentID:   rootID,
+		title:      title,
+		class:      "object.container.storageFolder",
+		childCount: count,
+	}, true
+}
+
+// fileItem 文件对应的条目
+func fileItem(baseURL, infoHash string, file torrent.FileInfo) object {
+	mimeType, class := mediaType(file.Path)
+	return object{
+		id:       infoHash + "/" + strconv.Itoa(file.FileIndex),
+		parentID: infoHash,
+		title:    file.Path,
+		class:    class,
+		mimeType: mimeType,
+		size:     file.Length,
+		url:      fmt.Sprintf("%s%s/media/%s/%d", baseURL, pathPrefix, infoHash, file.FileIndex),
+	}
+}
+
+// contentDirectoryControl ContentDirectory 的 SOAP 控制接口
+func (s *Server) contentDirectoryControl(w http.ResponseWriter, r *http.Request) {
+	action, args, err := readSOAPAction(r)
+	if err != nil {
+		writeSOAPFault(w, 401, "Invalid Action")
+		return
+	}
+
+	switch action {
+	case "Browse":
+		start, _ := strconv.Atoi(args["StartingIndex"])
+		count, _ := strconv.Atoi(args["RequestedCount"])
+		flag := args["BrowseFlag"]
+		if flag != "BrowseMetadata" && flag != "BrowseDirectChildren" || start < 0 || count < 0 {
+			writeSOAPFault(w, 402, "Invalid Args")
+			return
+		}
+
+		objects, total, err := s.browse("http://"+r.Host, args["ObjectID"], flag, start, count)
+		if errors.Is(err, errNoSuchObject) {
+			writeSOAPFault(w, 701, "No such object")
+			return
+		}
+		if err != nil {
+			writeSOAPFault(w, 501, "Action Failed")
+			return
+		}
+		writeSOAPResponse(w, contentDirectoryType, action,
+			"Result", didl(objects),
+			"NumberReturned", strconv.Itoa(len(objects)),
+			"TotalMatches", strconv.Itoa(total),
+			"UpdateID", strconv.FormatUint(uint64(s.updateID.Load()), 10))
+	case "GetSearchCapabilities":
+		writeSOAPResponse(w, contentDirectoryType, action, "SearchCaps", "")
+	case "GetSortCapabilities":
+		writeSOAPResponse(w, contentDirectoryType, action, "SortCaps", "")
+	case "GetSystemUpdateID":
+		writeSOAPResponse(w, contentDirectoryType, action, "Id", strconv.FormatUint(uint64(s.updateID.Load()), 10))
+	default:
+		writeSOAPFault(w, 401, "Invalid Action")
+	}
+}
+
+// connectionManagerControl ConnectionManager 的 SOAP 控制接口，只有一个默认连接 0
+func (s *Server) connectionManagerControl(w http.ResponseWriter, r *http.Request) {
+	action, _, err := readSOAPAction(r)
+	if err != nil {
+		writeSOAPFault(w, 401, "Invalid Action")
+		return
+	}
+
+	switch action {
+	case "GetProtocolInfo":
+		var sources []string
+		seen := make(map[string]bool)
+		for _, t := range mediaTypes {
+			if !seen[t[0]] {
+				seen[t[0]] = true
+				sources = append(sources, "http-get:*:"+t[0]+":*")
+			}
+		}
+		sort.Strings(sources)
+		writeSOAPResponse(w, connectionManagerType, action, "Source", strings.Join(sources, ","), "Sink", "")
+	case "GetCurrentConnectionIDs":
+		writeSOAPResponse(w, connectionManagerType, action, "ConnectionIDs", "0")
+	case "GetCurrentConnectionInfo":
+		writeSOAPResponse(w, connectionManagerType, action,
+			"RcsID", "-1",
+			"AVTransportID", "-1",
+			"ProtocolInfo", "",
+			"PeerConnectionManager", "",
+			"PeerConnectionID", "-1",
+			"Direction", "Output",
+			"Status", "OK")
+	default:
+		writeSOAPFault(w, 401, "Invalid Action")
+	}
+}
+
+// soapEnvelope SOAP 请求，动作的参数是 Body 中唯一元素的子元素
+type soapEnvelope struct {
+	Body struct {
+		Action struct {
+			Args []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// readSOAPAction 读取 SOAPACTION 头中的动作名称和请求体中的参数
+func readSOAPAction(r *http.Request) (string, map[string]string, error) {
+	// SOAPACTION: "urn:schemas-upnp-org:service:ContentDirectory:1#Browse"
+	_, action, ok := strings.Cut(strings.Trim(r.Header.Get("SOAPACTION"), `"`), "#")
+	if !ok || action == "" {
+		return "", nil, errors.New("missing SOAPACTION")
+	}
+
+	var envelope soapEnvelope
+	if err := xml.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&envelope); err != nil {
+		return "", nil, err
+	}
+	args := make(map[string]string, len(envelope.Body.Action.Args))
+	for _, arg := range envelope.Body.Action.Args {
+		args[arg.XMLName.Local] = arg.Value
+	}
+	return action, args, nil
+}
+
+// writeSOAPResponse 写入动作的响应，pairs 为输出参数的名称和值
+func writeSOAPResponse(w http.ResponseWriter, serviceType, action string, pairs ...string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<u:%sResponse xmlns:u="%s">`, action, serviceType)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fmt.Fprintf(&b, "<%s>%s</%s>", pairs[i], xmlEscape(pairs[i+1]), pairs[i])
+	}
+	fmt.Fprintf(&b, `</u:%sResponse>`, action)
+	writeSOAP(w, http.StatusOK, b.String())
+}
+
+// writeSOAPFault 写入 UPnP 错误
+func writeSOAPFault(w http.ResponseWriter, code int, description string) {
+	writeSOAP(w, http.StatusInternalServerError, fmt.Sprintf(`<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring>`+
+		`<detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode><errorDescription>%s</errorDescription></UPnPError></detail></s:Fault>`,
+		code, xmlEscape(description)))
+}
+
+func writeSOAP(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Header()["EXT"] = []string{""}
+	w.Header().Set("Server", serverHeader)
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>`+
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">`+
+		`<s:Body>%s</s:Body></s:Envelope>`, body)
+}
+
+// xmlEscape 转义 XML 文本和属性值
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package dlna
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/torrentplayer/backend/torrent"
+)
+
+func TestReadSOAPAction(t *testing.T) {
+	body := `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>
+<u:Browse xmlns:u="urn:schemas-upnp-org:service:ContentDirectory:1">
+<ObjectID>0</ObjectID><BrowseFlag>BrowseDirectChildren</BrowseFlag><StartingIndex>10</StartingIndex>
+</u:Browse></s:Body></s:Envelope>`
+	r := httptest.NewRequest("POST", "/dlna/control/ContentDirectory", strings.NewReader(body))
+	r.Header.Set("SOAPACTION", `"urn:schemas-upnp-org:service:ContentDirectory:1#Browse"`)
+
+	action, args, err := readSOAPAction(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != "Browse" || args["ObjectID"] != "0" || args["BrowseFlag"] != "BrowseDirectChildren" || args["StartingIndex"] != "10" {
+		t.Errorf("got %s %v", action, args)
+	}
+}
+
+func TestDIDLEscapesTitles(t *testing.T) {
+	item := fileItem("http://192.168.1.2:8080", "abc", torrent.FileInfo{Path: "Tom & Jerry <1>.mkv", Length: 42, FileIndex: 3})
+	result := didl([]object{item})
+	if !strings.Contains(result, "<dc:title>Tom &amp; Jerry &lt;1&gt;.mkv</dc:title>") {
+		t.Errorf("title not escaped: %s", result)
+	}
+	if !strings.Contains(result, `size="42" protocolInfo="http-get:*:video/x-matroska:`) ||
+		!strings.Contains(result, ">http://192.168.1.2:8080/dlna/media/abc/3</res>") {
+		t.Errorf("unexpected res: %s", result)
+	}
+}
+
+func TestBrowsable(t *testing.T) {
+	cases := []struct {
+		file torrent.FileInfo
+		want bool
+	}{
+		{torrent.FileInfo{Path: "a.mkv", Length: 100, IsPlayable: true}, true},
+		{torrent.FileInfo{Path: "a.mkv", Length: 100, BytesCompleted: 10}, false},
+		{torrent.FileInfo{Path: "a.flac", Length: 100, BytesCompleted: 100}, true},
+		{torrent.FileInfo{Path: "a.nfo", Length: 100, BytesCompleted: 100}, false},
+	}
+	for _, c := range cases {
+		if got := browsable(c.file); got != c.want {
+			t.Errorf("browsable(%+v): got %v", c.file, got)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Package dlna UPnP AV（DLNA）媒体服务器，通过 SSDP 在局域网内广播媒体库，
+// 智能电视和支持投屏的播放器可以直接浏览并播放种子中的文件
+//
+// 每个种子是一个文件夹，其中可以播放的视频、音频和图片是条目；媒体文件不需要认证，
+// 只应在可信的局域网中启用
+package dlna
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/torrentplayer/backend/events"
+	"github.com/torrentplayer/backend/service"
+	"github.com/torrentplayer/backend/torrent"
+)
+
+const (
+	deviceType            = "urn:schemas-upnp-org:device:MediaServer:1"
+	contentDirectoryType  = "urn:schemas-upnp-org:service:ContentDirectory:1"
+	connectionManagerType = "urn:schemas-upnp-org:service:ConnectionManager:1"
+
+	// pathPrefix 设备描述、控制接口和媒体文件的路径前缀
+	pathPrefix = "/dlna"
+)
+
+// serverHeader SSDP 和 HTTP 响应中的 SERVER 头
+var serverHeader = fmt.Sprintf("%s/1.0 UPnP/1.0 MagnetPlayer/1.0", runtime.GOOS)
+
+// Registrar 注册 HTTP 路由，handlers.Router 实现了该接口
+type Registrar interface {
+	Handle(method, pattern string, handler http.HandlerFunc)
+}
+
+// Server DLNA 媒体服务器
+type Server struct {
+	torrentService *service.TorrentService
+	bus            *events.Bus
+	name           string
+	uuid           string
+	port           int
+	advertiser     *advertiser
+
+	// updateID 媒体库变化时递增，客户端据此刷新缓存的目录
+	updateID atomic.Uint32
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewServer 创建 DLNA 媒体服务器，port 为提供设备描述和媒体文件的 HTTP 端口
+func NewServer(torrentService *service.TorrentService, bus *events.Bus, name string, port int) *Server {
+	s := &Server{
+		torrentService: torrentService,
+		bus:            bus,
+		name:           name,
+		uuid:           deviceUUID(port),
+		port:           port,
+	}
+	s.updateID.Store(1)
+	return s
+}
+
+// Register 注册设备描述、服务描述、控制接口和媒体文件路由
+func (s *Server) Register(registrar Registrar) {
+	registrar.Handle(http.MethodGet, pathPrefix+"/device.xml", s.deviceDescription)
+	registrar.Handle(http.MethodGet, pathPrefix+"/ContentDirectory.xml", serveXML(contentDirectorySCPD))
+	registrar.Handle(http.MethodGet, pathPrefix+"/ConnectionManager.xml", serveXML(connectionManagerSCPD))
+	registrar.Handle(http.MethodPost, pathPrefix+"/control/ContentDirectory", s.contentDirectoryControl)
+	registrar.Handle(http.MethodPost, pathPrefix+"/control/ConnectionManager", s.connectionManagerControl)
+	// 不发送事件通知，只应答订阅以免客户端报错
+	for _, name := range []string{"ContentDirectory", "ConnectionManager"} {
+		registrar.Handle("SUBSCRIBE", pathPrefix+"/event/"+name, subscribe)
+		registrar.Handle("UNSUBSCRIBE", pathPrefix+"/event/"+name, unsubscribe)
+	}
+	registrar.Handle(http.MethodGet, pathPrefix+"/media/{infoHash}/{fileIndex}", s.serveMedia)
+}
+
+// Start 开始 SSDP 广播，并在媒体库变化时更新 SystemUpdateID
+func (s *Server) Start() error {
+	s.advertiser = newAdvertiser(s.uuid, s.port)
+	if err := s.advertiser.start(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go s.watchLibrary(ctx)
+
+	log.Printf("DLNA 媒体服务器已启动: %s (uuid:%s)", s.name, s.uuid)
+	return nil
+}
+
+// Stop 发送 ssdp:byebye 并停止广播
+func (s *Server) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	s.advertiser.stop()
+}
+
+// watchLibrary 种子增删、元数据到达、状态变化或文件可播放时递增 SystemUpdateID
+func (s *Server) watchLibrary(ctx context.Context) {
+	defer close(s.done)
+
+	ch, unsubscribe := s.bus.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			switch event.Type {
+			case events.TorrentAdded, events.TorrentRemoved, events.TorrentMetadata, events.TorrentStateChanged, events.TorrentMatched, events.TorrentFilePlayable:
+				s.updateID.Add(1)
+			}
+		}
+	}
+}
+
+// deviceDescription 设备描述，SSDP 响应中的 LOCATION 指向这里
+func (s *Server) deviceDescription(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Header().Set("Server", serverHeader)
+	fmt.Fprintf(w, deviceDescriptionTemplate, xmlEscape(s.name), s.uuid)
+}
+
+// serveMedia 提供媒体文件，支持 Range 请求用于拖动进度
+func (s *Server) serveMedia(w http.ResponseWriter, r *http.Request) {
+	fileIndex, err := strconv.Atoi(r.PathValue("fileIndex"))
+	if err != nil {
+		http.Error(w, "invalid file index", http.StatusBadRequest)
+		return
+	}
+	client := service.StreamClient{UserID: service.LocalUserID, RemoteAddr: r.RemoteAddr, UserAgent: r.UserAgent(), Kind: service.StreamKindDLNA}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		client.RemoteAddr = host
+	}
+	reader, file, err := s.torrentService.OpenStream(client, r.PathValue("infoHash"), fileIndex)
+	if errors.Is(err, service.ErrTooManyStreams) {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer reader.Close()
+
+	// 播放时间不受服务器写超时限制
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	mimeType, _ := mediaType(file.Path)
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Server", serverHeader)
+	// 部分电视区分头部大小写，不使用 Set 的规范化写法
+	w.Header()["transferMode.dlna.org"] = []string{transferMode(r)}
+	w.Header()["contentFeatures.dlna.org"] = []string{contentFeatures}
+	http.ServeContent(streamWriter{ResponseWriter: w, ctx: r.Context()}, r, "", time.Time{}, contextReader{FileReader: reader, ctx: r.Context()})
+}
+
+// transferMode 按客户端请求的传输模式应答，默认为流式传输
+func transferMode(r *http.Request) string {
+	switch mode := r.Header.Get("transferMode.dlna.org"); mode {
+	case "Streaming", "Interactive", "Background":
+		return mode
+	}
+	return "Streaming"
+}
+
+// contextReader 读取受请求上下文控制，客户端断开后不再等待分片下载
+type contextReader struct {
+	torrent.FileReader
+	ctx context.Context
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	return r.ReadContext(r.ctx, p)
+}
+
+// streamWriter 让 http.ServeContent 通过 service.CopyStream 复制文件内容，
+// 使用缓冲池中的缓冲，客户端断开后立即停止读取
+type streamWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+}
+
+func (w streamWriter) ReadFrom(r io.Reader) (int64, error) {
+	return service.CopyStream(w.ctx, w.ResponseWriter, r)
+}
+
+// Unwrap 供 http.ResponseController 访问底层连接
+func (w streamWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// deviceUUID 由主机名和端口生成，重启后保持不变，电视不会把同一台服务器识别为新设备
+func deviceUUID(port int) string {
+	hostname, _ := os.Hostname()
+	sum := sha1.Sum([]byte("magnet-player-dlna:" + hostname + ":" + strconv.Itoa(port)))
+	// 按 RFC 4122 设置版本 5 和变体位
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+func serveXML(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+		w.Header().Set("Server", serverHeader)
+		w.Write([]byte(body))
+	}
+}
+
+func subscribe(w http.ResponseWriter, r *http.Request) {
+	var sid [16]byte
+	rand.Read(sid[:])
+	w.Header().Set("SID", fmt.Sprintf("uuid:%x-%x-%x-%x-%x", sid[0:4], sid[4:6], sid[6:8], sid[8:10], sid[10:16]))
+	w.Header().Set("TIMEOUT", "Second-1800")
+	w.Header().Set("Server", serverHeader)
+	w.WriteHeader(http.StatusOK)
+}
+
+func unsubscribe(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,261 @@
+package dlna
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	// ssdpMaxAge 广播的有效期（秒），过期前重新广播
+	ssdpMaxAge     = 1800
+	notifyInterval = 5 * time.Minute
+)
+
+var ssdpGroup = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+// advertiser 在所有支持组播的网卡上广播设备并应答 M-SEARCH 搜索
+type advertiser struct {
+	uuid   string
+	port   int
+	conn   *net.UDPConn
+	packet *ipv4.PacketConn
+
+	// writeLock 发送广播前要切换组播网卡，避免与其他发送交错
+	writeLock sync.Mutex
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+func newAdvertiser(uuid string, port int) *advertiser {
+	return &advertiser{uuid: uuid, port: port}
+}
+
+// start 加入 SSDP 组播组，开始应答搜索并定期广播 ssdp:alive
+func (a *advertiser) start() error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, ssdpGroup)
+	if err != nil {
+		return fmt.Errorf("监听 SSDP 端口失败: %w", err)
+	}
+	a.conn = conn
+	a.packet = ipv4.NewPacketConn(conn)
+	a.packet.SetMulticastTTL(2)
+	// ListenMulticastUDP 只在默认网卡上加入组播组，其余网卡在这里加入；已加入的网卡返回错误，忽略即可
+	for _, ifi := range multicastInterfaces() {
+		a.packet.JoinGroup(&ifi, ssdpGroup)
+	}
+
+	a.done = make(chan struct{})
+	a.wg.Add(2)
+	go a.serve()
+	go a.advertise()
+	return nil
+}
+
+// stop 广播 ssdp:byebye，电视会立即移除设备而不是等到广播过期
+func (a *advertiser) stop() {
+	close(a.done)
+	a.notify("ssdp:byebye")
+	a.conn.Close()
+	a.wg.Wait()
+}
+
+// targets 设备广播和应答的所有类型
+func (a *advertiser) targets() []string {
+	return []string{"upnp:rootdevice", "uuid:" + a.uuid, deviceType, contentDirectoryType, connectionManagerType}
+}
+
+// searchTargets M-SEARCH 的 ST 匹配的类型，不匹配时返回 nil
+func (a *advertiser) searchTargets(st string) []string {
+	if st == "ssdp:all" {
+		return a.targets()
+	}
+	for _, target := range a.targets() {
+		if st == target {
+			return []string{target}
+		}
+	}
+	return nil
+}
+
+// usn 类型对应的唯一服务名
+func (a *advertiser) usn(target string) string {
+	if target == "uuid:"+a.uuid {
+		return target
+	}
+	return "uuid:" + a.uuid + "::" + target
+}
+
+// location 设备描述地址，ip 为对方可以访问到的本机地址
+func (a *advertiser) location(ip net.IP) string {
+	return "http://" + net.JoinHostPort(ip.String(), strconv.Itoa(a.port)) + pathPrefix + "/device.xml"
+}
+
+// serve 应答 M-SEARCH，按 MX 随机延迟以免所有设备同时应答
+func (a *advertiser) serve() {
+	defer a.wg.Done()
+
+	buf := make([]byte, 4096)
+	for {
+		n, _, src, err := a.packet.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		addr, ok := src.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf[:n])))
+		if err != nil || req.Method != "M-SEARCH" || req.Header.Get("MAN") != `"ssdp:discover"` {
+			continue
+		}
+		targets := a.searchTargets(req.Header.Get("ST"))
+		if len(targets) == 0 {
+			continue
+		}
+
+		mx, _ := strconv.Atoi(req.Header.Get("MX"))
+		mx = max(1, min(mx, 5))
+		delay := rand.N(time.Duration(mx) * time.Second)
+		location := a.location(localIPFor(addr.IP))
+		time.AfterFunc(delay, func() {
+			for _, target := range targets {
+				a.writeTo(a.searchResponse(target, location), addr)
+			}
+		})
+	}
+}
+
+// advertise 启动时和之后每隔 notifyInterval 广播 ssdp:alive
+func (a *advertiser) advertise() {
+	defer a.wg.Done()
+
+	a.notify("ssdp:alive")
+	ticker := time.NewTicker(notifyInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			a.notify("ssdp:alive")
+		}
+	}
+}
+
+// notify 在每个网卡上以该网卡的地址广播所有类型
+func (a *advertiser) notify(nts string) {
+	for _, ifi := range multicastInterfaces() {
+		ip := interfaceIPv4(ifi)
+		if ip == nil {
+			continue
+		}
+
+		a.writeLock.Lock()
+		if err := a.packet.SetMulticastInterface(&ifi); err != nil {
+			a.writeLock.Unlock()
+			continue
+		}
+		for _, target := range a.targets() {
+			if _, err := a.packet.WriteTo(a.notifyMessage(target, nts, a.location(ip)), nil, ssdpGroup); err != nil {
+				log.Printf("SSDP 广播失败 (%s): %v", ifi.Name, err)
+				break
+			}
+		}
+		a.writeLock.Unlock()
+	}
+}
+
+func (a *advertiser) writeTo(message []byte, addr *net.UDPAddr) {
+	a.writeLock.Lock()
+	defer a.writeLock.Unlock()
+	a.packet.WriteTo(message, nil, addr)
+}
+
+// searchResponse M-SEARCH 的单播应答
+func (a *advertiser) searchResponse(target, location string) []byte {
+	return []byte("HTTP/1.1 200 OK\r\n" +
+		"CACHE-CONTROL: max-age=" + strconv.Itoa(ssdpMaxAge) + "\r\n" +
+		"DATE: " + time.Now().UTC().Format(http.TimeFormat) + "\r\n" +
+		"EXT:\r\n" +
+		"LOCATION: " + location + "\r\n" +
+		"SERVER: " + serverHeader + "\r\n" +
+		"ST: " + target + "\r\n" +
+		"USN: " + a.usn(target) + "\r\n\r\n")
+}
+
+// notifyMessage ssdp:alive 或 ssdp:byebye 广播
+func (a *advertiser) notifyMessage(target, nts, location string) []byte {
+	message := "NOTIFY * HTTP/1.1\r\n" +
+		"HOST: " + ssdpGroup.String() + "\r\n" +
+		"NT: " + target + "\r\n" +
+		"NTS: " + nts + "\r\n" +
+		"USN: " + a.usn(target) + "\r\n"
+	if nts == "ssdp:alive" {
+		message += "CACHE-CONTROL: max-age=" + strconv.Itoa(ssdpMaxAge) + "\r\n" +
+			"LOCATION: " + location + "\r\n" +
+			"SERVER: " + serverHeader + "\r\n"
+	}
+	return []byte(message + "\r\n")
+}
+
+// multicastInterfaces 已启用且支持组播的非回环网卡
+func multicastInterfaces() []net.Interface {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var result []net.Interface
+	for _, ifi := range interfaces {
+		if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagMulticast != 0 && ifi.Flags&net.FlagLoopback == 0 {
+			result = append(result, ifi)
+		}
+	}
+	return result
+}
+
+// interfaceIPv4 网卡的第一个 IPv4 地址
+func interfaceIPv4(ifi net.Interface) net.IP {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.To4()
+		}
+	}
+	return nil
+}
+
+// localIPFor 与 remote 在同一网段的本机地址，找不到时使用路由到 remote 的出口地址
+func localIPFor(remote net.IP) net.IP {
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && ipNet.Contains(remote) {
+				return ipNet.IP.To4()
+			}
+		}
+	}
+	// UDP 连接不发送数据，只用于查询路由选择的本机地址
+	conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: remote, Port: ssdpGroup.Port})
+	if err != nil {
+		return net.IPv4zero
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP
+}
@@ -0,0 +1,43 @@
+package dlna
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestSearchTargets(t *testing.T) {
+	a := newAdvertiser("1234", 8080)
+	if got := a.searchTargets("ssdp:all"); len(got) != 5 {
+		t.Errorf("ssdp:all: got %v", got)
+	}
+	if got := a.searchTargets(contentDirectoryType); len(got) != 1 || got[0] != contentDirectoryType {
+		t.Errorf("ContentDirectory: got %v", got)
+	}
+	if got := a.searchTargets("urn:schemas-upnp-org:device:MediaRenderer:1"); got != nil {
+		t.Errorf("MediaRenderer: got %v", got)
+	}
+
+	if got := a.usn("uuid:1234"); got != "uuid:1234" {
+		t.Errorf("usn of uuid: got %q", got)
+	}
+	if got := a.usn("upnp:rootdevice"); got != "uuid:1234::upnp:rootdevice" {
+		t.Errorf("usn of rootdevice: got %q", got)
+	}
+}
+
+func TestSearchResponseIsHTTP(t *testing.T) {
+	a := newAdvertiser("1234", 8080)
+	message := a.searchResponse(deviceType, "http://192.168.1.2:8080/dlna/device.xml")
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(message)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get("ST") != deviceType || resp.Header.Get("USN") != "uuid:1234::"+deviceType {
+		t.Errorf("unexpected headers: %v", resp.Header)
+	}
+	if resp.Header.Get("LOCATION") != "http://192.168.1.2:8080/dlna/device.xml" {
+		t.Errorf("location: got %q", resp.Header.Get("LOCATION"))
+	}
+}
@@ -0,0 +1,88 @@
+// Package events 进程内事件总线，后台任务通过它通知种子状态变化，
+// 再由 SSE 接口推送给前端
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	TorrentAdded           = "torrent.added"
+	TorrentMetadata        = "torrent.metadata"
+	TorrentMetadataRetry   = "torrent.metadata_retry"
+	TorrentMetadataFailed  = "torrent.metadata_failed"
+	TorrentMetadataTimeout = "torrent.metadata_timeout"
+	TorrentStateChanged    = "torrent.state"
+	TorrentRemoved         = "torrent.removed"
+	TorrentMatched         = "torrent.matched"
+	TorrentMatchFailed     = "torrent.match_failed"
+	TorrentFilePlayable    = "torrent.file_playable"
+	TorrentCompleted       = "torrent.completed"
+	TorrentPostProcessed   = "torrent.post_processed"
+	TorrentFailed          = "torrent.failed"
+)
+
+// subscriberBuffer 每个订阅者的缓冲大小，消费过慢时丢弃新事件而不是阻塞发布者
+const subscriberBuffer = 64
+
+// Event 事件
+type Event struct {
+	Type     string      `json:"type"`
+	InfoHash string      `json:"infoHash,omitempty"`
+	Data     interface{} `json:"data,omitempty"`
+	Time     time.Time   `json:"time"`
+}
+
+// Bus 事件总线
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[chan Event]struct{}
+}
+
+// NewBus 创建事件总线
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Publish 发布事件，不会阻塞
+func (b *Bus) Publish(eventType, infoHash string, data interface{}) {
+	event := Event{
+		Type:     eventType,
+		InfoHash: infoHash,
+		Data:     data,
+		Time:     time.Now(),
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe 订阅事件，返回事件通道和取消订阅函数
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package grpcapi
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/torrentplayer/backend/auth"
+	"github.com/torrentplayer/backend/grpcapi/pb"
+	"github.com/torrentplayer/backend/middleware"
+)
+
+// apiKeyMetadata 携带API密钥的 metadata 键（gRPC 要求小写）
+var apiKeyMetadata = strings.ToLower(middleware.APIKeyHeader)
+
+// adminMethods 只允许管理员调用的方法，相当于 HTTP 接口中的写操作；其余方法与对应的 HTTP 接口一样允许匿名访问
+var adminMethods = map[string]bool{
+	pb.TorrentService_AddMagnet_FullMethodName: true,
+}
+
+// Authenticator 按 HTTP 接口的规则校验 metadata 中的访问令牌或API密钥
+type Authenticator struct {
+	verifier middleware.TokenVerifier
+}
+
+// NewAuthenticator 创建认证器
+func NewAuthenticator(verifier middleware.TokenVerifier) *Authenticator {
+	return &Authenticator{verifier: verifier}
+}
+
+// UnaryInterceptor 一元调用的认证拦截器
+func (a *Authenticator) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor 流式调用的认证拦截器
+func (a *Authenticator) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate 校验凭据并把用户信息放入 context
+// 管理员方法要求有效凭据和可写权限；其余方法携带有效凭据时附加用户信息，无效凭据被忽略
+func (a *Authenticator) authenticate(ctx context.Context, method string) (context.Context, error) {
+	// 关闭认证时直接放行（仅本机部署）
+	if !a.verifier.Enabled() {
+		return ctx, nil
+	}
+
+	required := adminMethods[method]
+	claims, err := a.credentials(ctx)
+	if err != nil {
+		if required {
+			return nil, err
+		}
+		return ctx, nil
+	}
+	if claims == nil {
+		if required {
+			return nil, status.Error(codes.Unauthenticated, "缺少访问令牌")
+		}
+		return ctx, nil
+	}
+
+	if required {
+		// gRPC 方法没有 HTTP 方法之分，管理员方法都按写操作处理
+		if !claims.Allows(http.MethodPost) {
+			return nil, status.Error(codes.PermissionDenied, "API密钥权限不足")
+		}
+		if !claims.IsAdmin() {
+			return nil, status.Error(codes.PermissionDenied, "需要管理员权限")
+		}
+	}
+	return auth.WithClaims(ctx, claims), nil
+}
+
+// credentials 解析 metadata 中的API密钥或 Bearer 令牌，未携带凭据时返回 nil
+func (a *Authenticator) credentials(ctx context.Context) (*auth.Claims, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if keys := md.Get(apiKeyMetadata); len(keys) > 0 && keys[0] != "" {
+		claims, err := a.verifier.VerifyAPIKey(keys[0])
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "API密钥无效")
+		}
+		return claims, nil
+	}
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, nil
+	}
+	header := values[0]
+	if len(header) <= 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return nil, nil
+	}
+	claims, err := a.verifier.VerifyToken(strings.TrimSpace(header[7:]))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "访问令牌无效或已过期")
+	}
+	return claims, nil
+}
+
+// serverStream 替换流的 context，使处理器能读取认证信息
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
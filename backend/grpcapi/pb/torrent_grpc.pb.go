@@ -0,0 +1,256 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: magnetplayer/v1/torrent.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	TorrentService_AddMagnet_FullMethodName    = "/magnetplayer.v1.TorrentService/AddMagnet"
+	TorrentService_ListTorrents_FullMethodName = "/magnetplayer.v1.TorrentService/ListTorrents"
+	TorrentService_StreamFile_FullMethodName   = "/magnetplayer.v1.TorrentService/StreamFile"
+	TorrentService_Events_FullMethodName       = "/magnetplayer.v1.TorrentService/Events"
+)
+
+// TorrentServiceClient is the client API for TorrentService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// TorrentService 种子服务的 gRPC 接口，与 HTTP 接口共用同一套服务层
+// 认证方式与 HTTP 接口相同：metadata 中携带 authorization: Bearer <token> 或 x-api-key: <key>
+type TorrentServiceClient interface {
+	// AddMagnet 添加磁力链接，仅管理员可用
+	AddMagnet(ctx context.Context, in *AddMagnetRequest, opts ...grpc.CallOption) (*Torrent, error)
+	// ListTorrents 按条件排序、过滤和分页获取种子列表，参数含义与 GET /magnet/api/v1/torrents 相同
+	ListTorrents(ctx context.Context, in *ListTorrentsRequest, opts ...grpc.CallOption) (*ListTorrentsResponse, error)
+	// StreamFile 分块推送种子中一个文件的内容，尚未下载的部分会优先下载
+	StreamFile(ctx context.Context, in *StreamFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileChunk], error)
+	// Events 推送种子事件，直到客户端取消
+	Events(ctx context.Context, in *EventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type torrentServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTorrentServiceClient(cc grpc.ClientConnInterface) TorrentServiceClient {
+	return &torrentServiceClient{cc}
+}
+
+func (c *torrentServiceClient) AddMagnet(ctx context.Context, in *AddMagnetRequest, opts ...grpc.CallOption) (*Torrent, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Torrent)
+	err := c.cc.Invoke(ctx, TorrentService_AddMagnet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *torrentServiceClient) ListTorrents(ctx context.Context, in *ListTorrentsRequest, opts ...grpc.CallOption) (*ListTorrentsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListTorrentsResponse)
+	err := c.cc.Invoke(ctx, TorrentService_ListTorrents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *torrentServiceClient) StreamFile(ctx context.Context, in *StreamFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TorrentService_ServiceDesc.Streams[0], TorrentService_StreamFile_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamFileRequest, FileChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TorrentService_StreamFileClient = grpc.ServerStreamingClient[FileChunk]
+
+func (c *torrentServiceClient) Events(ctx context.Context, in *EventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TorrentService_ServiceDesc.Streams[1], TorrentService_Events_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EventsRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TorrentService_EventsClient = grpc.ServerStreamingClient[Event]
+
+// TorrentServiceServer is the server API for TorrentService service.
+// All implementations must embed UnimplementedTorrentServiceServer
+// for forward compatibility.
+//
+// TorrentService 种子服务的 gRPC 接口，与 HTTP 接口共用同一套服务层
+// 认证方式与 HTTP 接口相同：metadata 中携带 authorization: Bearer <token> 或 x-api-key: <key>
+type TorrentServiceServer interface {
+	// AddMagnet 添加磁力链接，仅管理员可用
+	AddMagnet(context.Context, *AddMagnetRequest) (*Torrent, error)
+	// ListTorrents 按条件排序、过滤和分页获取种子列表，参数含义与 GET /magnet/api/v1/torrents 相同
+	ListTorrents(context.Context, *ListTorrentsRequest) (*ListTorrentsResponse, error)
+	// StreamFile 分块推送种子中一个文件的内容，尚未下载的部分会优先下载
+	StreamFile(*StreamFileRequest, grpc.ServerStreamingServer[FileChunk]) error
+	// Events 推送种子事件，直到客户端取消
+	Events(*EventsRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedTorrentServiceServer()
+}
+
+// UnimplementedTorrentServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTorrentServiceServer struct{}
+
+func (UnimplementedTorrentServiceServer) AddMagnet(context.Context, *AddMagnetRequest) (*Torrent, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddMagnet not implemented")
+}
+func (UnimplementedTorrentServiceServer) ListTorrents(context.Context, *ListTorrentsRequest) (*ListTorrentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTorrents not implemented")
+}
+func (UnimplementedTorrentServiceServer) StreamFile(*StreamFileRequest, grpc.ServerStreamingServer[FileChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamFile not implemented")
+}
+func (UnimplementedTorrentServiceServer) Events(*EventsRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method Events not implemented")
+}
+func (UnimplementedTorrentServiceServer) mustEmbedUnimplementedTorrentServiceServer() {}
+func (UnimplementedTorrentServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafeTorrentServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TorrentServiceServer will
+// result in compilation errors.
+type UnsafeTorrentServiceServer interface {
+	mustEmbedUnimplementedTorrentServiceServer()
+}
+
+func RegisterTorrentServiceServer(s grpc.ServiceRegistrar, srv TorrentServiceServer) {
+	// If the following call pancis, it indicates UnimplementedTorrentServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&TorrentService_ServiceDesc, srv)
+}
+
+func _TorrentService_AddMagnet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddMagnetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TorrentServiceServer).AddMagnet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TorrentService_AddMagnet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TorrentServiceServer).AddMagnet(ctx, req.(*AddMagnetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TorrentService_ListTorrents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTorrentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TorrentServiceServer).ListTorrents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TorrentService_ListTorrents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TorrentServiceServer).ListTorrents(ctx, req.(*ListTorrentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TorrentService_StreamFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamFileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TorrentServiceServer).StreamFile(m, &grpc.GenericServerStream[StreamFileRequest, FileChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TorrentService_StreamFileServer = grpc.ServerStreamingServer[FileChunk]
+
+func _TorrentService_Events_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TorrentServiceServer).Events(m, &grpc.GenericServerStream[EventsRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TorrentService_EventsServer = grpc.ServerStreamingServer[Event]
+
+// TorrentService_ServiceDesc is the grpc.ServiceDesc for TorrentService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TorrentService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "magnetplayer.v1.TorrentService",
+	HandlerType: (*TorrentServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddMagnet",
+			Handler:    _TorrentService_AddMagnet_Handler,
+		},
+		{
+			MethodName: "ListTorrents",
+			Handler:    _TorrentService_ListTorrents_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamFile",
+			Handler:       _TorrentService_StreamFile_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Events",
+			Handler:       _TorrentService_Events_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "magnetplayer/v1/torrent.proto",
+}
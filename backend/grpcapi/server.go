@@ -0,0 +1,318 @@
+// Package grpcapi 种子服务的 gRPC 接口，供桌面和移动端原生客户端以及其他后端服务调用
+// 接口定义见 proto/magnetplayer/v1/torrent.proto，与 HTTP 接口共用服务层
+package grpcapi
+
+//go:generate protoc -I ../proto --go_out=.. --go_opt=module=github.com/torrentplayer/backend --go-grpc_out=.. --go-grpc_opt=module=github.com/torrentplayer/backend magnetplayer/v1/torrent.proto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/torrentplayer/backend/auth"
+	"github.com/torrentplayer/backend/events"
+	"github.com/torrentplayer/backend/grpcapi/pb"
+	"github.com/torrentplayer/backend/service"
+	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// Server 实现 pb.TorrentServiceServer
+type Server struct {
+	pb.UnimplementedTorrentServiceServer
+	torrentService *service.TorrentService
+	autoMatch      *service.AutoMatchService
+	bus            *events.Bus
+}
+
+// NewServer 创建 gRPC 服务
+func NewServer(torrentService *service.TorrentService, autoMatch *service.AutoMatchService, bus *events.Bus) *Server {
+	return &Server{
+		torrentService: torrentService,
+		autoMatch:      autoMatch,
+		bus:            bus,
+	}
+}
+
+// Register 把服务注册到 gRPC 服务器
+func (s *Server) Register(registrar grpc.ServiceRegistrar) {
+	pb.RegisterTorrentServiceServer(registrar, s)
+}
+
+// AddMagnet 添加磁力链接
+func (s *Server) AddMagnet(ctx context.Context, req *pb.AddMagnetRequest) (*pb.Torrent, error) {
+	magnetValidator := &validator.MagnetValidator{}
+	if err := magnetValidator.ValidateMagnetURI(req.GetMagnetUri()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	info, err := s.torrentService.AddMagnet(ctx, req.GetMagnetUri(), req.GetPrivate())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if req.GetAutoMatch() {
+		s.autoMatch.Request(info.InfoHash)
+	}
+	return torrentMessage(info), nil
+}
+
+// ListTorrents 获取种子列表
+func (s *Server) ListTorrents(ctx context.Context, req *pb.ListTorrentsRequest) (*pb.ListTorrentsResponse, error) {
+	query := service.TorrentListQuery{
+		TorrentFilter: service.TorrentFilter{
+			Category: strings.TrimSpace(req.GetCategory()),
+			Tags:     req.GetTags(),
+		},
+		State:  req.GetState(),
+		Sort:   req.GetSort(),
+		Limit:  int(req.GetLimit()),
+		Offset: int(req.GetOffset()),
+	}
+
+	// 默认按添加时间倒序，其余字段默认升序
+	switch req.GetOrder() {
+	case "":
+		query.Desc = query.Sort == "" || query.Sort == "added"
+	case "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return nil, status.Error(codes.InvalidArgument, "order参数必须为asc或desc")
+	}
+
+	if value := req.GetOwner(); value != "" {
+		owner := service.LocalUserID
+		if claims, ok := auth.ClaimsFromContext(ctx); ok {
+			owner = claims.UserID
+		}
+		if value != "me" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, "owner参数必须为用户ID或me")
+			}
+			owner = parsed
+		}
+		query.AddedBy = &owner
+	}
+
+	torrents, total, err := s.torrentService.ListTorrents(query)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.ListTorrentsResponse{
+		Torrents: make([]*pb.Torrent, 0, len(torrents)),
+		Total:    int32(total),
+	}
+	for i := range torrents {
+		resp.Torrents = append(resp.Torrents, torrentMessage(&torrents[i]))
+	}
+	return resp, nil
+}
+
+// StreamFile 分块推送文件内容，读取到尚未下载的分片时等待下载完成
+func (s *Server) StreamFile(req *pb.StreamFileRequest, stream pb.TorrentService_StreamFileServer) error {
+	if req.GetOffset() < 0 || req.GetLength() < 0 {
+		return status.Error(codes.InvalidArgument, "offset和length不能为负数")
+	}
+
+	reader, file, err := s.torrentService.OpenStream(streamClient(stream.Context()), req.GetInfoHash(), int(req.GetFileIndex()))
+	if err != nil {
+		return statusError(err)
+	}
+	defer reader.Close()
+
+	if req.GetOffset() > file.Length {
+		return status.Error(codes.OutOfRange, "offset超出文件大小")
+	}
+	end := file.Length
+	if req.GetLength() > 0 && req.GetOffset()+req.GetLength() < end {
+		end = req.GetOffset() + req.GetLength()
+	}
+	if _, err := reader.Seek(req.GetOffset(), io.SeekStart); err != nil {
+		return statusError(err)
+	}
+
+	// 每块使用缓冲池中的缓冲，客户端取消后不再读取
+	ctx := stream.Context()
+	chunks := &chunkWriter{stream: stream, offset: req.GetOffset(), fileLength: file.Length}
+	_, err = service.CopyStream(ctx, chunks, io.LimitReader(contextReader{FileReader: reader, ctx: ctx}, end-req.GetOffset()))
+	if err != nil {
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		if chunks.err != nil {
+			return chunks.err
+		}
+		return statusError(err)
+	}
+	return nil
+}
+
+// chunkWriter 把每次写入的数据作为一个 FileChunk 发送
+type chunkWriter struct {
+	stream     pb.TorrentService_StreamFileServer
+	offset     int64
+	fileLength int64
+	// err Send 返回的错误，与读取错误区分
+	err error
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	// Send 返回前已完成序列化，p 可以被复用
+	if err := w.stream.Send(&pb.FileChunk{Offset: w.offset, Data: p, FileLength: w.fileLength}); err != nil {
+		w.err = err
+		return 0, err
+	}
+	w.offset += int64(len(p))
+	return len(p), nil
+}
+
+// contextReader 读取受流的上下文控制，客户端取消后不再等待分片下载
+type contextReader struct {
+	torrent.FileReader
+	ctx context.Context
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	return r.ReadContext(r.ctx, p)
+}
+
+// Events 推送种子事件，直到客户端取消或服务器关闭
+func (s *Server) Events(req *pb.EventsRequest, stream pb.TorrentService_EventsServer) error {
+	types := make(map[string]bool, len(req.GetTypes()))
+	for _, eventType := range req.GetTypes() {
+		types[eventType] = true
+	}
+
+	ch, unsubscribe := s.bus.Subscribe()
+	defer unsubscribe()
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if req.GetInfoHash() != "" && event.InfoHash != req.GetInfoHash() {
+				continue
+			}
+			if len(types) > 0 && !types[event.Type] {
+				continue
+			}
+			message, err := eventMessage(event)
+			if err != nil {
+				continue
+			}
+			if err := stream.Send(message); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// streamClient 播放会话的客户端信息
+func streamClient(ctx context.Context) service.StreamClient {
+	client := service.StreamClient{UserID: service.LocalUserID, Kind: service.StreamKindGRPC}
+	if claims, ok := auth.ClaimsFromContext(ctx); ok {
+		client.UserID = claims.UserID
+		client.Username = claims.Username
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		client.RemoteAddr = p.Addr.String()
+		if host, _, err := net.SplitHostPort(client.RemoteAddr); err == nil {
+			client.RemoteAddr = host
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if userAgent := md.Get("user-agent"); len(userAgent) > 0 {
+			client.UserAgent = userAgent[0]
+		}
+	}
+	return client
+}
+
+// statusError 把服务层错误转换为 gRPC 状态码
+func statusError(err error) error {
+	var validationErr validator.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrTorrentNotFound), errors.Is(err, service.ErrFileNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrMetadataPending):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrTooManyStreams):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// torrentMessage 转换种子信息
+func torrentMessage(info *torrent.TorrentInfo) *pb.Torrent {
+	message := &pb.Torrent{
+		InfoHash:    info.InfoHash,
+		Name:        info.Name,
+		Length:      info.Length,
+		Files:       make([]*pb.File, 0, len(info.Files)),
+		Downloaded:  info.Downloaded,
+		Progress:    info.Progress,
+		Uploaded:    info.Uploaded,
+		Ratio:       info.Ratio,
+		State:       info.State,
+		StateReason: info.StateReason,
+		Private:     info.Private,
+		Category:    info.Category,
+		Tags:        info.Tags,
+		AddedBy:     info.AddedBy,
+		AddedAt:     timestamppb.New(info.AddedAt),
+	}
+	for _, file := range info.Files {
+		message.Files = append(message.Files, &pb.File{
+			Index:      int32(file.FileIndex),
+			Path:       file.Path,
+			Length:     file.Length,
+			Progress:   file.Progress,
+			IsVideo:    file.IsVideo,
+			IsPlayable: file.IsPlayable,
+		})
+	}
+	if info.MovieDetails != nil {
+		if data, err := json.Marshal(info.MovieDetails); err == nil {
+			message.MovieDetailsJson = string(data)
+		}
+	}
+	return message
+}
+
+// eventMessage 转换事件，事件数据按 SSE 接口的格式编码为 JSON
+func eventMessage(event events.Event) (*pb.Event, error) {
+	message := &pb.Event{
+		Type:     event.Type,
+		InfoHash: event.InfoHash,
+		Time:     timestamppb.New(event.Time),
+	}
+	if event.Data != nil {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return nil, err
+		}
+		message.DataJson = string(data)
+	}
+	return message, nil
+}
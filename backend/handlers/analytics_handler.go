@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/torrentplayer/backend/middleware"
+	"github.com/torrentplayer/backend/service"
+)
+
+// AnalyticsHandler 播放统计处理器
+type AnalyticsHandler struct {
+	analytics *service.StreamAnalyticsService
+}
+
+// NewAnalyticsHandler 创建播放统计处理器
+func NewAnalyticsHandler(analytics *service.StreamAnalyticsService) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		analytics: analytics,
+	}
+}
+
+// Titles 返回最近一段时间播放最多的影片和同时播放的峰值，range 默认为 30d
+func (h *AnalyticsHandler) Titles(w http.ResponseWriter, r *http.Request) {
+	var limit int
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			middleware.WriteError(w, middleware.CodeInvalidParameter, "limit必须为正整数", http.StatusBadRequest)
+			return
+		}
+	}
+
+	analytics, err := h.analytics.Titles(r.URL.Query().Get("range"), limit, time.Now())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analytics)
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/torrentplayer/backend/auth"
+	"github.com/torrentplayer/backend/middleware"
+	"github.com/torrentplayer/backend/service"
+)
+
+// AuthHandler 认证处理器
+type AuthHandler struct {
+	authService *service.AuthService
+}
+
+// NewAuthHandler 创建认证处理器
+func NewAuthHandler(authService *service.AuthService) *AuthHandler {
+	return &AuthHandler{
+		authService: authService,
+	}
+}
+
+// LoginRequest 登录请求
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Login 登录处理器
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	result, err := h.authService.Login(req.Username, req.Password)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Me 获取当前登录用户处理器
+func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		// 认证关闭时没有登录用户
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"authEnabled": h.authService.Enabled(),
+		})
+		return
+	}
+
+	// 配置文件中的静态API密钥不属于任何用户
+	if claims.IsAPIKey() && claims.UserID == service.LocalUserID {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"authEnabled": true,
+			"apiKey":      claims.Username,
+			"scope":       claims.Scope,
+		})
+		return
+	}
+
+	user, err := h.authService.GetUser(claims.UserID)
+	if err != nil {
+		// 令牌对应的用户已被删除
+		middleware.WriteError(w, middleware.CodeInvalidToken, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"authEnabled": true,
+		"user":        user,
+	})
+}
+
+// currentUserID 获取当前请求的用户ID，关闭认证时返回本地共享用户
+func currentUserID(r *http.Request) int64 {
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+		return claims.UserID
+	}
+	return service.LocalUserID
+}
+
+// APIKeyRequest 创建API密钥请求
+type APIKeyRequest struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+}
+
+// APIKeys API密钥管理处理器：GET 列出当前用户的密钥，POST 创建新密钥
+func (h *AuthHandler) APIKeys(w http.ResponseWriter, r *http.Request) {
+	if !h.allowKeyManagement(w, r) {
+		return
+	}
+
+	userID := currentUserID(r)
+
+	if r.Method == http.MethodGet {
+		keys, err := h.authService.ListAPIKeys(userID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keys)
+		return
+	}
+
+	var req APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	created, err := h.authService.CreateAPIKey(userID, req.Name, req.Scope)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// DeleteAPIKey 删除API密钥处理器，路径为 /auth/api-keys/{id}
+func (h *AuthHandler) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !h.allowKeyManagement(w, r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		middleware.WriteError(w, middleware.CodeInvalidParameter, "无效的API密钥ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.DeleteAPIKey(currentUserID(r), id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// allowKeyManagement API密钥本身不能用于管理密钥，必须使用登录令牌
+func (h *AuthHandler) allowKeyManagement(w http.ResponseWriter, r *http.Request) bool {
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims.IsAPIKey() {
+		middleware.WriteErrorResponse(w, "API密钥不能用于管理密钥，请使用登录令牌", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// CreateUserRequest 创建用户请求
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// Users 用户管理处理器（仅管理员）：GET 列出所有用户，POST 创建用户
+func (h *AuthHandler) Users(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		users, err := h.authService.ListUsers()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(users)
+		return
+	}
+
+	var req CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	user, err := h.authService.CreateUser(req.Username, req.Password, req.Role)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// User 修改（PUT）或删除（DELETE）用户处理器（仅管理员），路径为 /users/{id}
+func (h *AuthHandler) User(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		middleware.WriteError(w, middleware.CodeInvalidParameter, "无效的用户ID", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := h.authService.DeleteUser(id); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+		return
+	}
+
+	var update service.UserUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	user, err := h.authService.UpdateUser(id, &update)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/torrentplayer/backend/middleware"
+	"github.com/torrentplayer/backend/service"
+	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// DownloadHandler 下载处理器，以附件形式导出种子中的文件
+type DownloadHandler struct {
+	torrentService *service.TorrentService
+	completeOnly   bool // 只允许直接下载已完成的文件
+}
+
+// NewDownloadHandler 创建下载处理器
+func NewDownloadHandler(torrentService *service.TorrentService, completeOnly bool) *DownloadHandler {
+	return &DownloadHandler{
+		torrentService: torrentService,
+		completeOnly:   completeOnly,
+	}
+}
+
+// File 以附件形式下载单个文件，支持 Range 请求以便断点续传
+// 与 /stream 不同，浏览器会保存文件而不是播放
+func (h *DownloadHandler) File(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
+
+	// 验证InfoHash
+	ihValidator := &validator.InfoHashValidator{}
+	if err := ihValidator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	fileIndex, err := strconv.Atoi(r.PathValue("fileIndex"))
+	if err != nil || fileIndex < 0 {
+		middleware.WriteError(w, middleware.CodeInvalidParameter, "文件索引必须为非负整数", http.StatusBadRequest)
+		return
+	}
+
+	reader, file, err := h.torrentService.OpenStream(streamClient(r, service.StreamKindDownload), infoHash, fileIndex)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer reader.Close()
+
+	if h.completeOnly && file.BytesCompleted < file.Length {
+		writeError(w, service.ErrFileIncomplete)
+		return
+	}
+
+	// 下载时间取决于文件大小，不受服务器写超时限制
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("ETag", fileETag(infoHash, fileIndex))
+	w.Header().Set("Content-Type", getContentTypeFromPath(file.Path))
+	w.Header().Set("Content-Disposition", attachmentDisposition(path.Base(file.Path)))
+	http.ServeContent(streamWriter{ResponseWriter: w, ctx: r.Context()}, r, "", time.Time{}, contextReader{FileReader: reader, ctx: r.Context()})
+}
+
+// fileETag 种子中文件的 ETag
+// 文件内容由 infoHash 校验，不会改变，可以使用强校验 ETag 支持 If-Range 续传
+func fileETag(infoHash string, fileIndex int) string {
+	return fmt.Sprintf(`"%s-%d"`, strings.ToLower(infoHash), fileIndex)
+}
+
+// Archive 把整个种子或 files 参数选择的文件打包为 zip 下载
+// 压缩包边读取边生成，读取到尚未下载的分片时等待下载完成
+func (h *DownloadHandler) Archive(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
+
+	// 验证InfoHash
+	ihValidator := &validator.InfoHashValidator{}
+	if err := ihValidator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	fileIndexes, err := parseFileIndexes(r.URL.Query().Get("files"))
+	if err != nil {
+		middleware.WriteError(w, middleware.CodeInvalidParameter, "files参数必须为逗号分隔的文件索引", http.StatusBadRequest)
+		return
+	}
+
+	info, files, err := h.torrentService.SelectFiles(infoHash, fileIndexes)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// 响应头发送后无法再返回错误，先检查是否超过同时播放的上限
+	client := streamClient(r, service.StreamKindDownload)
+	if err := h.torrentService.Sessions().Check(client, infoHash, files[0].FileIndex); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// 下载时间取决于文件大小，不受服务器写超时限制
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	name := info.Name
+	if name == "" {
+		name = infoHash
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", attachmentDisposition(name+".zip"))
+
+	// 响应头已发送，之后的错误只能中断连接，客户端会得到不完整的压缩包
+	if err := h.writeArchive(r.Context(), w, client, info, files); err != nil && !isConnectionClosed(err) && r.Context().Err() == nil {
+		log.Printf("打包下载失败: %v", err)
+	}
+}
+
+// writeArchive 依次写入文件，视频等已压缩的内容不再压缩
+// 每个文件在写入时登记为播放会话，写完即结束
+func (h *DownloadHandler) writeArchive(ctx context.Context, w io.Writer, client service.StreamClient, info *torrent.TorrentInfo, files []torrent.FileInfo) error {
+	modified := info.AddedAt
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		reader, _, err := h.torrentService.OpenStream(client, info.InfoHash, file.FileIndex)
+		if err != nil {
+			return err
+		}
+
+		entry, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     archiveEntryName(file.Path),
+			Method:   zip.Store,
+			Modified: modified,
+		})
+		if err == nil {
+			_, err = service.CopyStream(ctx, entry, contextReader{FileReader: reader, ctx: ctx})
+		}
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// contextReader 读取受请求上下文控制，客户端断开后不再等待分片下载
+type contextReader struct {
+	torrent.FileReader
+	ctx context.Context
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	return r.ReadContext(r.ctx, p)
+}
+
+// streamWriter 让 http.ServeContent 通过 service.CopyStream 复制文件内容，
+// 使用缓冲池中的缓冲，客户端断开后立即停止读取
+type streamWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+}
+
+func (w streamWriter) ReadFrom(r io.Reader) (int64, error) {
+	return service.CopyStream(w.ctx, w.ResponseWriter, r)
+}
+
+// Unwrap 供 http.ResponseController 访问底层连接
+func (w streamWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// parseFileIndexes 解析逗号分隔的文件索引，忽略重复的索引；为空时返回 nil
+func parseFileIndexes(value string) ([]int, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var indexes []int
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(value, ",") {
+		index, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || index < 0 {
+			return nil, strconv.ErrSyntax
+		}
+		if !seen[index] {
+			seen[index] = true
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes, nil
+}
+
+// archiveEntryName 把种子中的文件路径转换为压缩包内的相对路径
+// 路径来自种子元数据，去掉绝对路径和 .. 以免解压时写到目标目录之外
+func archiveEntryName(filePath string) string {
+	cleaned := path.Clean("/" + strings.ReplaceAll(filePath, "\\", "/"))
+	return strings.TrimPrefix(cleaned, "/")
+}
+
+// attachmentDisposition 生成附件形式的 Content-Disposition，非 ASCII 文件名按 RFC 2231 编码
+func attachmentDisposition(filename string) string {
+	filename = strings.NewReplacer("/", "_", "\\", "_").Replace(filename)
+	if disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); disposition != "" {
+		return disposition
+	}
+	return "attachment"
+}
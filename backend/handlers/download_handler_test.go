@@ -0,0 +1,29 @@
+package handlers
+
+import "testing"
+
+func TestArchiveEntryName(t *testing.T) {
+	cases := map[string]string{
+		"Movie/movie.mkv":        "Movie/movie.mkv",
+		"../../etc/passwd":       "etc/passwd",
+		"/abs/file.srt":          "abs/file.srt",
+		"Season 1\\..\\ep01.mkv": "ep01.mkv",
+	}
+	for input, want := range cases {
+		if got := archiveEntryName(input); got != want {
+			t.Errorf("archiveEntryName(%q): got %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestParseFileIndexes(t *testing.T) {
+	indexes, err := parseFileIndexes("3, 1,3")
+	if err != nil || len(indexes) != 2 || indexes[0] != 3 || indexes[1] != 1 {
+		t.Errorf("got %v, %v", indexes, err)
+	}
+	for _, value := range []string{"1,", "a", "-1"} {
+		if _, err := parseFileIndexes(value); err == nil {
+			t.Errorf("parseFileIndexes(%q) should fail", value)
+		}
+	}
+}
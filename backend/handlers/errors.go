@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"syscall"
+
+	"github.com/torrentplayer/backend/auth"
+	"github.com/torrentplayer/backend/middleware"
+	"github.com/torrentplayer/backend/service"
+	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// sentinelError 服务层哨兵错误对应的错误码和状态码
+type sentinelError struct {
+	err    error
+	code   middleware.ErrorCode
+	status int
+}
+
+// sentinelErrors 按顺序用 errors.Is 匹配，新增哨兵错误时在这里登记
+var sentinelErrors = []sentinelError{
+	{service.ErrTorrentNotFound, middleware.CodeTorrentNotFound, http.StatusNotFound},
+	{torrent.ErrTorrentNotFound, middleware.CodeTorrentNotFound, http.StatusNotFound},
+	{service.ErrFileNotFound, middleware.CodeFileNotFound, http.StatusNotFound},
+	{torrent.ErrFileNotFound, middleware.CodeFileNotFound, http.StatusNotFound},
+	{service.ErrFileIncomplete, middleware.CodeFileIncomplete, http.StatusConflict},
+	{service.ErrTooManyStreams, middleware.CodeTooManyStreams, http.StatusTooManyRequests},
+	{service.ErrStreamSessionNotFound, middleware.CodeStreamSessionNotFound, http.StatusNotFound},
+	{service.ErrMetadataPending, middleware.CodeMetadataPending, http.StatusConflict},
+	{torrent.ErrMetadataIncomplete, middleware.CodeMetadataPending, http.StatusConflict},
+	{torrent.ErrMetadataTimeout, middleware.CodeMetadataTimeout, http.StatusGatewayTimeout},
+	{service.ErrUserNotFound, middleware.CodeUserNotFound, http.StatusNotFound},
+	{service.ErrAPIKeyNotFound, middleware.CodeAPIKeyNotFound, http.StatusNotFound},
+	{service.ErrInvalidCredentials, middleware.CodeInvalidCredentials, http.StatusUnauthorized},
+	{service.ErrInvalidAPIKey, middleware.CodeInvalidAPIKey, http.StatusUnauthorized},
+	{auth.ErrInvalidToken, middleware.CodeInvalidToken, http.StatusUnauthorized},
+	{service.ErrFeedNotFound, middleware.CodeFeedNotFound, http.StatusNotFound},
+	{service.ErrImageNotFound, middleware.CodeImageNotFound, http.StatusNotFound},
+	{service.ErrIndexerNotConfigured, middleware.CodeIndexerNotConfigured, http.StatusServiceUnavailable},
+	{service.ErrIndexerFailed, middleware.CodeIndexerFailed, http.StatusBadGateway},
+	{syscall.ENOSPC, middleware.CodeStorageFull, http.StatusInsufficientStorage},
+}
+
+// validationCodes 校验错误字段对应的错误码，其余字段为 VALIDATION_FAILED
+var validationCodes = map[string]middleware.ErrorCode{
+	"magnetUri": middleware.CodeInvalidMagnet,
+	"infoHash":  middleware.CodeInvalidInfoHash,
+}
+
+// writeError 按错误类型写入错误响应：已登记的哨兵错误使用对应的错误码和状态码，
+// 校验错误返回400，不允许的状态转换返回409，请求体过大返回413，其余返回500
+func writeError(w http.ResponseWriter, err error) {
+	for _, sentinel := range sentinelErrors {
+		if errors.Is(err, sentinel.err) {
+			middleware.WriteError(w, sentinel.code, err.Error(), sentinel.status)
+			return
+		}
+	}
+
+	var validationErr validator.ValidationError
+	var transitionErr *service.InvalidTransitionError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &validationErr):
+		code, ok := validationCodes[validationErr.Field]
+		if !ok {
+			code = middleware.CodeValidationFailed
+		}
+		middleware.WriteError(w, code, err.Error(), http.StatusBadRequest)
+	case errors.As(err, &transitionErr):
+		middleware.WriteError(w, middleware.CodeInvalidState, err.Error(), http.StatusConflict)
+	case errors.As(err, &maxBytesErr):
+		middleware.WriteError(w, middleware.CodePayloadTooLarge, "请求体过大", http.StatusRequestEntityTooLarge)
+	default:
+		middleware.WriteError(w, middleware.CodeInternal, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// writeInvalidBody 请求体无法解析为JSON
+func writeInvalidBody(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeError(w, err)
+		return
+	}
+	middleware.WriteError(w, middleware.CodeInvalidBody, "无效的请求格式", http.StatusBadRequest)
+}
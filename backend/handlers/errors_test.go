@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/torrentplayer/backend/middleware"
+	"github.com/torrentplayer/backend/service"
+	"github.com/torrentplayer/backend/validator"
+)
+
+func TestWriteErrorMapsErrorCodes(t *testing.T) {
+	cases := []struct {
+		err    error
+		code   middleware.ErrorCode
+		status int
+	}{
+		{fmt.Errorf("暂停失败: %w", service.ErrTorrentNotFound), middleware.CodeTorrentNotFound, http.StatusNotFound},
+		{service.ErrIndexerFailed, middleware.CodeIndexerFailed, http.StatusBadGateway},
+		{validator.ValidationError{Field: "magnetUri", Message: "x"}, middleware.CodeInvalidMagnet, http.StatusBadRequest},
+		{validator.ValidationError{Field: "sort", Message: "x"}, middleware.CodeValidationFailed, http.StatusBadRequest},
+		{&service.InvalidTransitionError{From: service.StatePaused, To: service.StatePaused}, middleware.CodeInvalidState, http.StatusConflict},
+		{errors.New("数据库已关闭"), middleware.CodeInternal, http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		writeError(rec, c.err)
+
+		var body middleware.ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%v: invalid body: %v", c.err, err)
+		}
+		if rec.Code != c.status || body.Code != c.status || body.ErrorCode != c.code {
+			t.Errorf("%v: got %d %s, want %d %s", c.err, rec.Code, body.ErrorCode, c.status, c.code)
+		}
+	}
+}
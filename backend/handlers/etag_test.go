@@ -0,0 +1,28 @@
+package handlers
+
+import "testing"
+
+func TestETagMatches(t *testing.T) {
+	etag := computeETag([]byte("[]\n"), []byte("0"))
+	if etag == computeETag([]byte("[]\n0")) {
+		t.Error("parts should be hashed separately")
+	}
+
+	cases := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{etag, true},
+		{"W/" + etag, true},
+		{`"other", ` + etag, true},
+		{"*", true},
+		{`"other"`, false},
+		{etag[1 : len(etag)-1], false},
+	}
+	for _, c := range cases {
+		if got := etagMatches(c.header, etag); got != c.want {
+			t.Errorf("etagMatches(%q): got %v, want %v", c.header, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/torrentplayer/backend/events"
+	"github.com/torrentplayer/backend/middleware"
+	"github.com/torrentplayer/backend/service"
+)
+
+// sseKeepAlive SSE 心跳间隔，防止代理关闭空闲连接
+const sseKeepAlive = 15 * time.Second
+
+// EventsHandler 事件推送处理器
+type EventsHandler struct {
+	bus            *events.Bus
+	torrentService *service.TorrentService
+}
+
+// NewEventsHandler 创建事件推送处理器
+func NewEventsHandler(bus *events.Bus, torrentService *service.TorrentService) *EventsHandler {
+	return &EventsHandler{
+		bus:            bus,
+		torrentService: torrentService,
+	}
+}
+
+// Stream 以 Server-Sent Events 推送种子事件，owner 参数与种子列表相同，只推送该用户添加的种子的事件
+func (h *EventsHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	owner, ok := ownerParam(w, r)
+	if !ok {
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// 长连接不受服务器写超时限制
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		middleware.WriteErrorResponse(w, "当前连接不支持事件推送", http.StatusInternalServerError)
+		return
+	}
+
+	ch, unsubscribe := h.bus.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	rc.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	// 种子删除后记录已不存在，按之前查到的添加者过滤它的删除事件
+	owners := make(map[string]int64)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if owner != nil && event.InfoHash != "" && !h.ownedBy(owners, event.InfoHash, *owner) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// ownedBy 种子是否由 owner 添加，查到的添加者记录在 owners 中；种子不存在且之前没有查到时视为不是
+func (h *EventsHandler) ownedBy(owners map[string]int64, infoHash string, owner int64) bool {
+	if addedBy, ok := h.torrentService.TorrentOwner(infoHash); ok {
+		owners[infoHash] = addedBy
+	}
+	addedBy, ok := owners[infoHash]
+	return ok && addedBy == owner
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/torrentplayer/backend/middleware"
+	"github.com/torrentplayer/backend/service"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// imageCacheControl 缓存的图片一周内不会变化，客户端可直接使用本地缓存
+const imageCacheControl = "public, max-age=604800"
+
+// ImageHandler 图片代理处理器
+type ImageHandler struct {
+	images *service.ImageCache
+}
+
+// NewImageHandler 创建图片代理处理器
+func NewImageHandler(images *service.ImageCache) *ImageHandler {
+	return &ImageHandler{
+		images: images,
+	}
+}
+
+// GetImage 返回媒体库中电影或剧集的海报、背景图: /magnet/api/images/{tmdbId}/{type}?media=tv
+func (h *ImageHandler) GetImage(w http.ResponseWriter, r *http.Request) {
+	tmdbID, err := strconv.Atoi(r.PathValue("tmdbId"))
+	if err != nil {
+		middleware.WriteError(w, middleware.CodeInvalidParameter, "无效的TMDB ID", http.StatusBadRequest)
+		return
+	}
+
+	file, err := h.images.GetImage(tmdbID, r.PathValue("type"), r.URL.Query().Get("media"))
+	if err != nil {
+		var validationErr validator.ValidationError
+		switch {
+		case errors.As(err, &validationErr), errors.Is(err, service.ErrImageNotFound):
+			writeError(w, err)
+		default:
+			log.Printf("获取图片失败: %v", err)
+			middleware.WriteErrorResponse(w, err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+
+	w.Header().Set("Cache-Control", imageCacheControl)
+	http.ServeFile(w, r, file)
+}
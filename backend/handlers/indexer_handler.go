@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/torrentplayer/backend/middleware"
+	"github.com/torrentplayer/backend/service"
+)
+
+// IndexerHandler 种子索引器搜索处理器
+type IndexerHandler struct {
+	indexer   *service.IndexerService
+	autoMatch *service.AutoMatchService
+}
+
+// NewIndexerHandler 创建种子索引器搜索处理器
+func NewIndexerHandler(indexer *service.IndexerService, autoMatch *service.AutoMatchService) *IndexerHandler {
+	return &IndexerHandler{
+		indexer:   indexer,
+		autoMatch: autoMatch,
+	}
+}
+
+// Search 搜索种子，查询参数：q（必填）、cat（Torznab 分类，逗号分隔）、limit
+func (h *IndexerHandler) Search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	searchQuery := service.IndexerSearchQuery{Query: query.Get("q")}
+
+	if value := query.Get("cat"); value != "" {
+		for _, part := range strings.Split(value, ",") {
+			category, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || category <= 0 {
+				middleware.WriteError(w, middleware.CodeInvalidParameter, "cat参数必须为逗号分隔的分类ID", http.StatusBadRequest)
+				return
+			}
+			searchQuery.Categories = append(searchQuery.Categories, category)
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			middleware.WriteError(w, middleware.CodeInvalidParameter, "limit参数必须为正整数", http.StatusBadRequest)
+			return
+		}
+		searchQuery.Limit = parsed
+	}
+
+	results, err := h.indexer.Search(r.Context(), searchQuery)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// IndexerAddRequest 添加搜索结果的请求
+type IndexerAddRequest struct {
+	service.IndexerAddRequest
+	// AutoMatch 元数据到达后自动识别并保存电影或剧集详情
+	AutoMatch bool `json:"autoMatch"`
+}
+
+// Add 添加一条搜索结果，请求体为搜索结果，可另加 private 和 autoMatch
+func (h *IndexerHandler) Add(w http.ResponseWriter, r *http.Request) {
+	var req IndexerAddRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	torrentInfo, err := h.indexer.AddResult(r.Context(), &req.IndexerAddRequest)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.AutoMatch {
+		h.autoMatch.Request(torrentInfo.InfoHash)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(torrentInfo)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/torrentplayer/backend/service"
+)
+
+// LibraryHandler 媒体库导出和导入处理器
+type LibraryHandler struct {
+	libraryService *service.LibraryService
+}
+
+// NewLibraryHandler 创建媒体库导出和导入处理器
+func NewLibraryHandler(libraryService *service.LibraryService) *LibraryHandler {
+	return &LibraryHandler{
+		libraryService: libraryService,
+	}
+}
+
+// Export 以附件形式下载整个媒体库的 JSON 导出文档
+func (h *LibraryHandler) Export(w http.ResponseWriter, r *http.Request) {
+	library, err := h.libraryService.Export()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", attachmentDisposition("library-"+library.ExportedAt.Format("20060102")+".json"))
+	json.NewEncoder(w).Encode(library)
+}
+
+// Import 导入另一台服务器导出的媒体库，已存在的种子跳过
+func (h *LibraryHandler) Import(w http.ResponseWriter, r *http.Request) {
+	var library service.LibraryExport
+	if err := json.NewDecoder(r.Body).Decode(&library); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	result, err := h.libraryService.Import(r.Context(), &library)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
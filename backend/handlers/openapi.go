@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/middleware"
+	"github.com/torrentplayer/backend/openapi"
+	"github.com/torrentplayer/backend/service"
+	"github.com/torrentplayer/backend/service/search"
+	"github.com/torrentplayer/backend/torrent"
+)
+
+const (
+	// APIPath 当前版本接口相对于基础路径（BASE_PATH）的前缀
+	APIPath = "/api/v1"
+
+	apiTitle   = "Magnet Player API"
+	apiVersion = "1.0.0"
+)
+
+// StatusResponse 只返回状态的响应，仅用于文档
+type StatusResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// MeResponse 当前登录用户的响应，仅用于文档；认证关闭时只有 authEnabled
+type MeResponse struct {
+	AuthEnabled bool     `json:"authEnabled"`
+	User        *db.User `json:"user,omitempty"`
+	// 使用配置文件中的静态API密钥时返回密钥名称和权限
+	APIKey string `json:"apiKey,omitempty"`
+	Scope  string `json:"scope,omitempty"`
+}
+
+// ImportResponse 导入种子的响应，仅用于文档
+type ImportResponse struct {
+	Results []service.ImportResult `json:"results"`
+}
+
+// TrashEmptyResponse 清空回收站的响应，仅用于文档
+type TrashEmptyResponse struct {
+	Purged int `json:"purged"`
+}
+
+// OpenAPIHandler OpenAPI 文档与 Swagger UI 处理器
+type OpenAPIHandler struct {
+	spec []byte
+	docs []byte
+}
+
+// NewOpenAPIHandler 创建 OpenAPI 文档处理器，文档在创建时生成一次；basePath 为服务器的基础路径，如 /magnet
+func NewOpenAPIHandler(basePath string) (*OpenAPIHandler, error) {
+	document := &openapi.Document{
+		Title:    apiTitle,
+		Version:  apiVersion,
+		BasePath: basePath + APIPath,
+		Description: "Magnet Player backend API. When authentication is disabled every endpoint is open and admin checks are skipped. " +
+			"Every error body carries a machine-readable errorCode such as TORRENT_NOT_FOUND.",
+		ErrorBody:  middleware.ErrorResponse{},
+		Operations: APIOperations(),
+	}
+	spec, err := json.Marshal(document.Build())
+	if err != nil {
+		return nil, err
+	}
+	docs, err := openapi.SwaggerUI(apiTitle, basePath+APIPath+"/openapi.json")
+	if err != nil {
+		return nil, err
+	}
+	return &OpenAPIHandler{
+		spec: spec,
+		docs: docs,
+	}, nil
+}
+
+// Spec 返回 OpenAPI 文档
+func (h *OpenAPIHandler) Spec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(h.spec)
+}
+
+// Docs 返回 Swagger UI 页面
+func (h *OpenAPIHandler) Docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(h.docs)
+}
+
+// APIOperations 全部接口的列表，路径相对于 BASE_PATH + APIPath，新增或修改路由时需同步更新
+func APIOperations() []openapi.Operation {
+	infoHash := openapi.PathParam("infoHash", "Torrent info hash (40 hex characters)")
+	category := openapi.Query("category", "string", "Only torrents in this category")
+	tag := openapi.Param{Name: "tag", In: "query", Type: "string", Description: "Only torrents with all of these tags", Repeated: true}
+	limit := openapi.Query("limit", "integer", "Maximum number of results")
+
+	return []openapi.Operation{
+		// 认证
+		{Method: http.MethodPost, Path: "/auth/login", Tag: "auth", Summary: "Log in", Access: openapi.Public,
+			Body: LoginRequest{}, Response: service.LoginResult{}, Errors: []int{400, 401}},
+		{Method: http.MethodGet, Path: "/auth/me", Tag: "auth", Summary: "Current user", Access: openapi.User,
+			Response: MeResponse{}},
+		{Method: http.MethodGet, Path: "/auth/api-keys", Tag: "auth", Summary: "List your API keys", Access: openapi.User,
+			Description: "Requires a login token; API keys cannot manage keys.",
+			Response:    []*db.APIKey{}, Errors: []int{403}},
+		{Method: http.MethodPost, Path: "/auth/api-keys", Tag: "auth", Summary: "Create an API key", Access: openapi.User,
+			Description: "The key is only returned once. Requires a login token; API keys cannot manage keys.",
+			Body:        APIKeyRequest{}, Status: http.StatusCreated, Response: service.CreatedAPIKey{}, Errors: []int{400, 403}},
+		{Method: http.MethodDelete, Path: "/auth/api-keys/{id}", Tag: "auth", Summary: "Revoke an API key", Access: openapi.User,
+			Response: StatusResponse{}, Errors: []int{400, 403, 404}},
+
+		// 用户
+		{Method: http.MethodGet, Path: "/users", Tag: "users", Summary: "List users", Access: openapi.Admin,
+			Response: []*db.User{}},
+		{Method: http.MethodPost, Path: "/users", Tag: "users", Summary: "Create a user", Access: openapi.Admin,
+			Body: CreateUserRequest{}, Status: http.StatusCreated, Response: db.User{}, Errors: []int{400}},
+		{Method: http.MethodPut, Path: "/users/{id}", Tag: "users", Summary: "Update a user", Access: openapi.Admin,
+			Body: service.UserUpdate{}, Response: db.User{}, Errors: []int{400, 404}},
+		{Method: http.MethodDelete, Path: "/users/{id}", Tag: "users", Summary: "Delete a user", Access: openapi.Admin,
+			Response: StatusResponse{}, Errors: []int{400, 404}},
+
+		// 播放
+		{Method: http.MethodGet, Path: "/preferences", Tag: "playback", Summary: "Get playback preferences", Access: openapi.User,
+			Response: db.PlaybackPreferences{}},
+		{Method: http.MethodPut, Path: "/preferences", Tag: "playback", Summary: "Update playback preferences", Access: openapi.User,
+			Body: service.PreferencesUpdate{}, Response: db.PlaybackPreferences{}, Errors: []int{400}},
+		{Method: http.MethodGet, Path: "/continue-watching", Tag: "playback", Summary: "Partly watched files", Access: openapi.User,
+			Params: []openapi.Param{limit}, Response: []service.ContinueWatchingItem{}, Errors: []int{400}},
+		{Method: http.MethodGet, Path: "/torrents/{infoHash}/playback", Tag: "playback", Summary: "Playback positions of a torrent's files", Access: openapi.User,
+			Params: []openapi.Param{infoHash}, Response: []*db.PlaybackPosition{}, Errors: []int{400, 404}},
+		{Method: http.MethodPut, Path: "/torrents/{infoHash}/playback", Tag: "playback", Summary: "Save the playback position of a file", Access: openapi.User,
+			Params: []openapi.Param{infoHash}, Body: service.PlaybackUpdate{}, Response: db.PlaybackPosition{}, Errors: []int{400, 404}},
+		{Method: http.MethodDelete, Path: "/torrents/{infoHash}/playback", Tag: "playback", Summary: "Clear the playback position of a file", Access: openapi.User,
+			Params:   []openapi.Param{infoHash, {Name: "fileIndex", In: "query", Type: "integer", Required: true}},
+			Response: StatusResponse{}, Errors: []int{400, 404}},
+		{Method: http.MethodGet, Path: "/stream/{infoHash}/{fileName}", Tag: "playback", Summary: "Stream a file", Access: openapi.Optional,
+			Description: "Supports Range requests, including several ranges answered as multipart/byteranges, and If-Range with the ETag. " +
+				"HEAD returns the headers only and does not count as a stream session. " +
+				"Query parameters override the user's playback preferences. The effective options are returned in the " +
+				"X-Audio-Language, X-Subtitle-Language, X-Max-Bitrate and X-Force-Transcode headers so the player can pick its tracks; " +
+				"the file itself is always served as stored, it is not transcoded.",
+			Params: []openapi.Param{
+				infoHash,
+				openapi.PathParam("fileName", "File path as listed in the torrent's files, may contain slashes"),
+				openapi.Query("maxBitrate", "integer", "Bitrate cap in kbps for the player"),
+				openapi.Query("audioLang", "string", "Preferred audio language"),
+				openapi.Query("subLang", "string", "Preferred subtitle language"),
+				openapi.Query("transcode", "boolean", "Ask for transcoding, passed on to the player"),
+				{Name: "Range", In: "header", Type: "string"},
+				{Name: "If-Range", In: "header", Type: "string", Description: "ETag of an earlier response; the range is only served while it matches"},
+			},
+			ResponseType: "application/octet-stream", Errors: []int{400, 404, 416, 429}},
+		{Method: http.MethodGet, Path: "/buffer/{infoHash}/{fileIndex}", Tag: "playback", Summary: "Buffer state of a file", Access: openapi.Optional,
+			Description: "How many bytes from offset on are downloaded without a gap, and the torrent's current download rate.",
+			Params: []openapi.Param{
+				infoHash,
+				{Name: "fileIndex", In: "path", Type: "integer", Description: "Index of the file in the torrent's files"},
+				openapi.Query("offset", "integer", "Playback position in bytes, 0 when omitted"),
+			},
+			Response: torrent.BufferInfo{}, Errors: []int{400, 404, 409}},
+		{Method: http.MethodGet, Path: "/sessions", Tag: "playback", Summary: "List active stream sessions", Access: openapi.Admin,
+			Description: "Requests from one client for the same file count as one session. " +
+				"Streams and downloads beyond TORRENT_MAX_STREAMS concurrent sessions are refused with 429.",
+			Response: SessionsResponse{}},
+		{Method: http.MethodPut, Path: "/sessions/{id}/rate-limit", Tag: "playback", Summary: "Limit the read rate of a stream session", Access: openapi.Admin,
+			Description: "Applies right away to every request of the session, until the session ends. 0 removes the limit.",
+			Body:        RateLimitRequest{}, Response: service.StreamSession{}, Errors: []int{400, 404}},
+		{Method: http.MethodDelete, Path: "/sessions/{id}/rate-limit", Tag: "playback", Summary: "Restore the default rate limit of a stream session", Access: openapi.Admin,
+			Description: "Goes back to the limit from TORRENT_STREAM_RATE_FACTOR.",
+			Response:    service.StreamSession{}, Errors: []int{404}},
+		{Method: http.MethodGet, Path: "/torrents/{infoHash}/download", Tag: "playback", Summary: "Download files as a zip archive", Access: openapi.Optional,
+			Description: "The archive is built while it is sent and waits for pieces that are not downloaded yet. Files are stored uncompressed.",
+			Params: []openapi.Param{
+				infoHash,
+				openapi.Query("files", "string", "Comma-separated file indexes, all files when omitted"),
+			},
+			ResponseType: "application/zip", Errors: []int{400, 404, 409, 429}},
+		{Method: http.MethodGet, Path: "/download/{infoHash}/{fileIndex}", Tag: "playback", Summary: "Download a file as an attachment", Access: openapi.Optional,
+			Description: "Supports Range and If-Range requests for resuming. Also available as {BASE_PATH}/download/{infoHash}/{fileIndex}. " +
+				"When TORRENT_DOWNLOAD_COMPLETE_ONLY is set, files that are not fully downloaded are refused with 409.",
+			Params: []openapi.Param{
+				infoHash,
+				{Name: "fileIndex", In: "path", Type: "integer", Description: "Index of the file in the torrent's files"},
+				{Name: "Range", In: "header", Type: "string"},
+			},
+			ResponseType: "application/octet-stream", Errors: []int{400, 404, 409, 416, 429}},
+
+		// 种子
+		{Method: http.MethodPost, Path: "/torrents", Tag: "torrents", Summary: "Add a magnet link", Access: openapi.Admin,
+			Params: []openapi.Param{
+				openapi.Query("timeoutSec", "integer", "Seconds to wait for metadata per attempt, instead of TORRENT_METADATA_TIMEOUT"),
+			},
+			Body: AddMagnetRequest{}, Response: torrent.TorrentInfo{}, Errors: []int{400}},
+		{Method: http.MethodGet, Path: "/torrents", Tag: "torrents", Summary: "List torrents", Access: openapi.Optional,
+			Description: "The number of matching torrents is returned in the X-Total-Count header. " +
+				"Responses carry an ETag; send it back in If-None-Match to get 304 while the list is unchanged, " +
+				"and add wait to hold the request until the list changes.",
+			Params: []openapi.Param{
+				openapi.Query("sort", "string", "name, added, progress, size or state"),
+				openapi.Query("order", "string", "asc or desc"),
+				openapi.Query("state", "string", "Only torrents in this state"),
+				category, tag,
+				openapi.Query("owner", "string", "User ID, or me for the current user"),
+				limit,
+				openapi.Query("offset", "integer", "Number of torrents to skip"),
+				openapi.Query("wait", "string", "With If-None-Match, how long to wait for a change before answering 304, such as 30s (at most 60s)"),
+				{Name: "If-None-Match", In: "header", Type: "string", Description: "ETag of the list the client already has"},
+			},
+			Response: []torrent.TorrentInfo{}, Errors: []int{304, 400}},
+		{Method: http.MethodDelete, Path: "/torrents/{infoHash}", Tag: "torrents", Summary: "Delete a torrent", Access: openapi.Admin,
+			Description: "Moves the torrent to the trash unless the trash is disabled or permanent is set.",
+			Params: []openapi.Param{infoHash,
+				openapi.Query("deleteData", "boolean", "Also delete downloaded data, when the torrent is purged from the trash"),
+				openapi.Query("permanent", "boolean", "Delete at once instead of moving to the trash"),
+			},
+			Response: StatusResponse{}, Errors: []int{400, 404}},
+		{Method: http.MethodGet, Path: "/trash", Tag: "torrents", Summary: "List torrents in the trash", Access: openapi.Admin,
+			Response: []service.TrashedTorrent{}},
+		{Method: http.MethodDelete, Path: "/trash", Tag: "torrents", Summary: "Empty the trash", Access: openapi.Admin,
+			Response: TrashEmptyResponse{}},
+		{Method: http.MethodPost, Path: "/trash/{infoHash}/restore", Tag: "torrents", Summary: "Restore a torrent from the trash", Access: openapi.Admin,
+			Params: []openapi.Param{infoHash}, Response: torrent.TorrentInfo{}, Errors: []int{400, 404}},
+		{Method: http.MethodDelete, Path: "/trash/{infoHash}", Tag: "torrents", Summary: "Purge a torrent from the trash", Access: openapi.Admin,
+			Params: []openapi.Param{infoHash}, Response: StatusResponse{}, Errors: []int{400, 404}},
+		{Method: http.MethodPost, Path: "/torrents/{infoHash}/pause", Tag: "torrents", Summary: "Pause a torrent", Access: openapi.Admin,
+			Params: []openapi.Param{infoHash}, Response: torrent.TorrentInfo{}, Errors: []int{400, 404, 409}},
+		{Method: http.MethodPost, Path: "/torrents/{infoHash}/resume", Tag: "torrents", Summary: "Resume a torrent", Access: openapi.Admin,
+			Description: "Also retries a torrent whose metadata fetch failed.",
+			Params:      []openapi.Param{infoHash}, Response: torrent.TorrentInfo{}, Errors: []int{400, 404, 409}},
+		{Method: http.MethodGet, Path: "/torrents/{infoHash}/diagnostics", Tag: "torrents", Summary: "Diagnose a torrent", Access: openapi.User,
+			Params:   []openapi.Param{infoHash, openapi.Query("probe", "boolean", "Set to false to skip live tracker, DHT and UPnP probes")},
+			Response: torrent.Diagnostics{}, Errors: []int{400, 404}},
+		{Method: http.MethodGet, Path: "/torrents/{infoHash}/pieces", Tag: "torrents", Summary: "Piece map of a torrent", Access: openapi.Optional,
+			Description: "Bitfields of completed and partial pieces, per-piece peer availability and the pieces each file spans. " +
+				"Byte fields are base64 encoded.",
+			Params: []openapi.Param{infoHash}, Response: torrent.PieceMap{}, Errors: []int{400, 404, 409}},
+		{Method: http.MethodPost, Path: "/torrents/{infoHash}/save-data", Tag: "torrents", Summary: "Save torrent data", Access: openapi.Admin,
+			Params: []openapi.Param{infoHash}, Body: service.TorrentUpdateData{}, Response: StatusResponse{}, Errors: []int{400}},
+		{Method: http.MethodPost, Path: "/torrents/import", Tag: "torrents", Summary: "Import from qBittorrent or Transmission", Access: openapi.Admin,
+			Description: "Multipart form: files holds .torrent, .fastresume, .resume, .json or .zip files; savePath is an optional default data directory.",
+			BodyType:    "multipart/form-data", Response: ImportResponse{}, Errors: []int{400}},
+		{Method: http.MethodPost, Path: "/create-torrent", Tag: "torrents", Summary: "Create a torrent from local files and seed it", Access: openapi.Admin,
+			Description: "path is a file or directory relative to the data directory. Hidden files are left out. torrent is the .torrent file, base64-encoded. Hashing reads all the data, so large directories take a while.",
+			Body:        service.CreateTorrentOptions{}, Response: torrent.CreatedTorrent{}, Errors: []int{400}},
+		{Method: http.MethodGet, Path: "/torrents/{infoHash}/seeding", Tag: "torrents", Summary: "Seeding statistics and limits", Access: openapi.User,
+			Params: []openapi.Param{infoHash}, Response: service.SeedingStatus{}, Errors: []int{400, 404}},
+		{Method: http.MethodPut, Path: "/torrents/{infoHash}/seeding", Tag: "torrents", Summary: "Override seeding limits", Access: openapi.Admin,
+			Params: []openapi.Param{infoHash}, Body: service.SeedingOverride{}, Response: service.SeedingStatus{}, Errors: []int{400, 404}},
+		{Method: http.MethodGet, Path: "/torrents/{infoHash}/connections", Tag: "torrents", Summary: "Connection limit", Access: openapi.User,
+			Params: []openapi.Param{infoHash}, Response: service.ConnectionStatus{}, Errors: []int{400, 404}},
+		{Method: http.MethodPut, Path: "/torrents/{infoHash}/connections", Tag: "torrents", Summary: "Override the connection limit", Access: openapi.Admin,
+			Params: []openapi.Param{infoHash}, Body: service.ConnectionOverride{}, Response: service.ConnectionStatus{}, Errors: []int{400, 404}},
+		{Method: http.MethodGet, Path: "/torrents/{infoHash}/trackers", Tag: "torrents", Summary: "List trackers", Access: openapi.User,
+			Params: []openapi.Param{infoHash}, Response: []torrent.TrackerInfo{}, Errors: []int{400, 404}},
+		{Method: http.MethodPost, Path: "/torrents/{infoHash}/trackers", Tag: "torrents", Summary: "Add trackers or reannounce", Access: openapi.Admin,
+			Params: []openapi.Param{infoHash}, Body: TrackersRequest{}, Response: []torrent.TrackerInfo{}, Errors: []int{400, 404}},
+		{Method: http.MethodDelete, Path: "/torrents/{infoHash}/trackers", Tag: "torrents", Summary: "Remove trackers", Access: openapi.Admin,
+			Params:   []openapi.Param{infoHash, {Name: "url", In: "query", Type: "string", Required: true, Repeated: true}},
+			Response: []torrent.TrackerInfo{}, Errors: []int{400, 404}},
+		{Method: http.MethodGet, Path: "/torrents/{infoHash}/webseeds", Tag: "torrents", Summary: "List web seeds", Access: openapi.User,
+			Params: []openapi.Param{infoHash}, Response: []string{}, Errors: []int{400, 404}},
+		{Method: http.MethodPost, Path: "/torrents/{infoHash}/webseeds", Tag: "torrents", Summary: "Add HTTP mirrors as web seeds", Access: openapi.Admin,
+			Params: []openapi.Param{infoHash}, Body: WebseedsRequest{}, Response: []string{}, Errors: []int{400, 404}},
+		{Method: http.MethodDelete, Path: "/torrents/{infoHash}/webseeds", Tag: "torrents", Summary: "Remove web seeds", Access: openapi.Admin,
+			Params:   []openapi.Param{infoHash, {Name: "url", In: "query", Type: "string", Required: true, Repeated: true}},
+			Response: []string{}, Errors: []int{400, 404}},
+		{Method: http.MethodPut, Path: "/torrents/{infoHash}/watched", Tag: "torrents", Summary: "Mark a torrent as watched", Access: openapi.Admin,
+			Params: []openapi.Param{infoHash}, Body: WatchedRequest{}, Response: WatchedRequest{}, Errors: []int{400, 404}},
+		{Method: http.MethodGet, Path: "/network/check", Tag: "torrents", Summary: "Check network connectivity", Access: openapi.Admin,
+			Response: torrent.NetworkCheck{}},
+		{Method: http.MethodGet, Path: "/stats/history", Tag: "torrents", Summary: "Transfer rate and peer history", Access: openapi.User,
+			Description: "Per-minute samples for ranges up to 24h, 15-minute buckets up to 7d and hourly buckets up to 90d.",
+			Params:      []openapi.Param{openapi.Query("range", "string", "How far back to go, such as 1h, 24h or 7d (default 24h)")},
+			Response:    service.StatsHistory{}, Errors: []int{400}},
+		{Method: http.MethodGet, Path: "/analytics/titles", Tag: "playback", Summary: "Most watched titles and peak concurrent streams", Access: openapi.Admin,
+			Description: "Summarizes the logged stream sessions by torrent. Downloads are not counted. Sessions are kept for 90 days.",
+			Params: []openapi.Param{
+				openapi.Query("range", "string", "How far back to go, such as 24h or 7d (default 30d, at most 90d)"),
+				openapi.Query("limit", "integer", "The number of titles to return, 1-100 (default 20)"),
+			},
+			Response: service.StreamAnalytics{}, Errors: []int{400}},
+		{Method: http.MethodGet, Path: "/events", Tag: "torrents", Summary: "Torrent events", Access: openapi.Optional,
+			Description: "Server-Sent Events. The event name is the event type, e.g. torrent.state; data is a JSON object with type, infoHash, data and time.",
+			Params: []openapi.Param{
+				openapi.Query("owner", "string", "Only events of torrents added by this user ID, or me for the current user"),
+			},
+			ResponseType: "text/event-stream", Errors: []int{400}},
+
+		// 分类和标签
+		{Method: http.MethodPut, Path: "/torrents/{infoHash}/category", Tag: "labels", Summary: "Set the category", Access: openapi.Admin,
+			Params: []openapi.Param{infoHash}, Body: CategoryRequest{}, Response: torrent.TorrentInfo{}, Errors: []int{400, 404}},
+		{Method: http.MethodPut, Path: "/torrents/{infoHash}/tags", Tag: "labels", Summary: "Replace the tags", Access: openapi.Admin,
+			Params: []openapi.Param{infoHash}, Body: TagsRequest{}, Response: torrent.TorrentInfo{}, Errors: []int{400, 404}},
+		{Method: http.MethodPost, Path: "/torrents/{infoHash}/tags", Tag: "labels", Summary: "Add tags", Access: openapi.Admin,
+			Params: []openapi.Param{infoHash}, Body: TagsRequest{}, Response: torrent.TorrentInfo{}, Errors: []int{400, 404}},
+		{Method: http.MethodDelete, Path: "/torrents/{infoHash}/tags", Tag: "labels", Summary: "Remove tags", Access: openapi.Admin,
+			Params:   []openapi.Param{infoHash, {Name: "tag", In: "query", Type: "string", Required: true, Repeated: true}},
+			Response: torrent.TorrentInfo{}, Errors: []int{400, 404}},
+		{Method: http.MethodGet, Path: "/labels", Tag: "labels", Summary: "Categories and tags with torrent counts", Access: openapi.User,
+			Response: service.LabelSummary{}},
+
+		// 媒体库
+		{Method: http.MethodGet, Path: "/movie-details", Tag: "library", Summary: "Torrents with their movie or show details", Access: openapi.Public,
+			Params: []openapi.Param{category, tag}, Response: []*db.TorrentRecord{}},
+		{Method: http.MethodPost, Path: "/torrents/{infoHash}/movie-details", Tag: "library", Summary: "Save movie or show details", Access: openapi.Admin,
+			Params: []openapi.Param{infoHash}, Body: MovieDetailsRequest{}, Response: StatusResponse{}, Errors: []int{400}},
+		{Method: http.MethodGet, Path: "/collections", Tag: "library", Summary: "Movie collections in the library", Access: openapi.Public,
+			Params: []openapi.Param{category, tag}, Response: []*service.Collection{}},
+		{Method: http.MethodGet, Path: "/images/{tmdbId}/{type}", Tag: "library", Summary: "Cached poster or backdrop", Access: openapi.Public,
+			Params: []openapi.Param{
+				{Name: "tmdbId", In: "path", Type: "integer", Required: true},
+				openapi.PathParam("type", "poster or backdrop"),
+				openapi.Query("media", "string", "tv for shows"),
+			},
+			ResponseType: "image/*", Errors: []int{400, 404, 502}},
+		{Method: http.MethodGet, Path: "/torrents/{infoHash}/episodes", Tag: "library", Summary: "Episodes matched to a torrent's files", Access: openapi.User,
+			Params: []openapi.Param{infoHash}, Response: []*db.Episode{}, Errors: []int{400, 404}},
+		{Method: http.MethodPost, Path: "/torrents/{infoHash}/episodes", Tag: "library", Summary: "Match a torrent's files to a show", Access: openapi.Admin,
+			Params: []openapi.Param{infoHash}, Body: service.ShowMatchRequest{}, Response: service.ShowMatch{}, Errors: []int{400, 404, 409}},
+		{Method: http.MethodPost, Path: "/torrents/{infoHash}/rematch", Tag: "library", Summary: "Re-match movie or show details", Access: openapi.Admin,
+			Params: []openapi.Param{infoHash}, Body: service.RematchRequest{}, Response: db.MovieDetails{}, Errors: []int{400, 404, 409}},
+		{Method: http.MethodGet, Path: "/search/movie", Tag: "library", Summary: "Recognize a movie from a file name", Access: openapi.Public,
+			Params:   []openapi.Param{{Name: "filename", In: "query", Type: "string", Required: true}},
+			Response: search.MovieInfo{}, Errors: []int{400}},
+		{Method: http.MethodGet, Path: "/search/tv", Tag: "library", Summary: "Search for a show", Access: openapi.Public,
+			Params:   []openapi.Param{{Name: "name", In: "query", Type: "string", Required: true}, openapi.Query("year", "integer", "First air year")},
+			Response: search.ShowInfo{}, Errors: []int{400}},
+		{Method: http.MethodGet, Path: "/library/export", Tag: "library", Summary: "Export the library as JSON", Access: openapi.Admin,
+			Response: service.LibraryExport{}},
+		{Method: http.MethodPost, Path: "/library/import", Tag: "library", Summary: "Import a library exported by another server", Access: openapi.Admin,
+			Body: service.LibraryExport{}, Response: service.LibraryImportResult{}, Errors: []int{400, 413}},
+
+		// 自动化
+		{Method: http.MethodGet, Path: "/retention/preview", Tag: "automation", Summary: "Preview retention rules", Access: openapi.Admin,
+			Response: service.RetentionReport{}},
+		{Method: http.MethodPost, Path: "/retention/run", Tag: "automation", Summary: "Run retention rules now", Access: openapi.Admin,
+			Response: service.RetentionReport{}},
+		{Method: http.MethodGet, Path: "/rss/feeds", Tag: "automation", Summary: "List RSS feeds", Access: openapi.User,
+			Response: []*db.RSSFeed{}},
+		{Method: http.MethodPost, Path: "/rss/feeds", Tag: "automation", Summary: "Add an RSS feed", Access: openapi.Admin,
+			Body: service.RSSFeedRequest{}, Status: http.StatusCreated, Response: db.RSSFeed{}, Errors: []int{400}},
+		{Method: http.MethodPut, Path: "/rss/feeds/{id}", Tag: "automation", Summary: "Update an RSS feed", Access: openapi.Admin,
+			Body: service.RSSFeedRequest{}, Response: db.RSSFeed{}, Errors: []int{400, 404}},
+		{Method: http.MethodDelete, Path: "/rss/feeds/{id}", Tag: "automation", Summary: "Delete an RSS feed", Access: openapi.Admin,
+			Response: StatusResponse{}, Errors: []int{400, 404}},
+		{Method: http.MethodPost, Path: "/rss/feeds/{id}/check", Tag: "automation", Summary: "Fetch an RSS feed now", Access: openapi.Admin,
+			Response: service.RSSCheckResult{}, Errors: []int{400, 404}},
+		{Method: http.MethodGet, Path: "/rss/items", Tag: "automation", Summary: "Matched RSS items", Access: openapi.User,
+			Params: []openapi.Param{openapi.Query("feedId", "integer", "Only items from this feed"), limit}, Response: []*db.RSSItem{}, Errors: []int{400}},
+		{Method: http.MethodGet, Path: "/indexer/search", Tag: "automation", Summary: "Search the Torznab indexer", Access: openapi.Admin,
+			Params: []openapi.Param{
+				{Name: "q", In: "query", Type: "string", Required: true},
+				openapi.Query("cat", "string", "Comma-separated Torznab category IDs"),
+				limit,
+			},
+			Response: []service.IndexerResult{}, Errors: []int{400, 502, 503}},
+		{Method: http.MethodPost, Path: "/indexer/add", Tag: "automation", Summary: "Add an indexer search result", Access: openapi.Admin,
+			Body: IndexerAddRequest{}, Response: torrent.TorrentInfo{}, Errors: []int{400, 502, 503}},
+
+		// 设置
+		{Method: http.MethodGet, Path: "/settings", Tag: "settings", Summary: "Runtime settings", Access: openapi.Admin,
+			Response: service.Settings{}},
+		{Method: http.MethodPatch, Path: "/settings", Tag: "settings", Summary: "Change runtime settings", Access: openapi.Admin,
+			Description: "Omitted sections and fields keep their values; arrays are replaced. Unknown fields are rejected.",
+			Body:        service.Settings{}, Response: service.Settings{}, Errors: []int{400}},
+
+		// 文档
+		{Method: http.MethodGet, Path: "/openapi.json", Tag: "docs", Summary: "This OpenAPI document", Access: openapi.Public,
+			ResponseType: "application/json"},
+		{Method: http.MethodGet, Path: "/docs", Tag: "docs", Summary: "Swagger UI", Access: openapi.Public,
+			ResponseType: "text/html"},
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/torrentplayer/backend/middleware"
+	"github.com/torrentplayer/backend/service"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// PlaybackHandler 播放进度处理器
+type PlaybackHandler struct {
+	playbackService *service.PlaybackService
+}
+
+// NewPlaybackHandler 创建播放进度处理器
+func NewPlaybackHandler(playbackService *service.PlaybackService) *PlaybackHandler {
+	return &PlaybackHandler{
+		playbackService: playbackService,
+	}
+}
+
+// Positions 当前用户在种子各文件上的播放进度
+// GET 获取各文件的播放进度；PUT 保存一个文件的播放位置；DELETE 清除 fileIndex 查询参数指定文件的播放进度
+func (h *PlaybackHandler) Positions(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
+
+	// 验证InfoHash
+	hashValidator := &validator.InfoHashValidator{}
+	if err := hashValidator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+	infoHash = strings.ToLower(infoHash)
+	userID := currentUserID(r)
+
+	var result interface{}
+	var err error
+	switch r.Method {
+	case http.MethodPut:
+		var update service.PlaybackUpdate
+		if decodeErr := json.NewDecoder(r.Body).Decode(&update); decodeErr != nil {
+			writeInvalidBody(w, decodeErr)
+			return
+		}
+		result, err = h.playbackService.SavePosition(userID, infoHash, &update)
+	case http.MethodDelete:
+		fileIndex, parseErr := strconv.Atoi(r.URL.Query().Get("fileIndex"))
+		if parseErr != nil {
+			middleware.WriteError(w, middleware.CodeInvalidParameter, "fileIndex参数必须为整数", http.StatusBadRequest)
+			return
+		}
+		err = h.playbackService.DeletePosition(userID, infoHash, fileIndex)
+		result = map[string]string{"status": "success"}
+	default:
+		result, err = h.playbackService.GetPositions(userID, infoHash)
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// ContinueWatching 获取当前用户看了一部分的文件，可用 limit 参数限制条数
+func (h *PlaybackHandler) ContinueWatching(w http.ResponseWriter, r *http.Request) {
+	var limit int
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			middleware.WriteError(w, middleware.CodeInvalidParameter, "limit参数必须为正整数", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	items, err := h.playbackService.ContinueWatching(currentUserID(r), limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/torrentplayer/backend/service"
+)
+
+// PreferencesHandler 播放偏好处理器
+type PreferencesHandler struct {
+	preferencesService *service.PreferencesService
+}
+
+// NewPreferencesHandler 创建播放偏好处理器
+func NewPreferencesHandler(preferencesService *service.PreferencesService) *PreferencesHandler {
+	return &PreferencesHandler{
+		preferencesService: preferencesService,
+	}
+}
+
+// Preferences 播放偏好处理器（GET获取，PUT更新）
+func (h *PreferencesHandler) Preferences(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		h.updatePreferences(w, r)
+	default:
+		h.getPreferences(w, r)
+	}
+}
+
+// getPreferences 获取当前用户的播放偏好
+func (h *PreferencesHandler) getPreferences(w http.ResponseWriter, r *http.Request) {
+	prefs, err := h.preferencesService.GetPreferences(currentUserID(r))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// updatePreferences 更新当前用户的播放偏好
+func (h *PreferencesHandler) updatePreferences(w http.ResponseWriter, r *http.Request) {
+	var update service.PreferencesUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	prefs, err := h.preferencesService.UpdatePreferences(currentUserID(r), &update)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
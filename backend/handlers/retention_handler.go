@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/torrentplayer/backend/service"
+)
+
+// RetentionHandler 自动清理处理器
+type RetentionHandler struct {
+	retentionService *service.RetentionService
+}
+
+// NewRetentionHandler 创建自动清理处理器
+func NewRetentionHandler(retentionService *service.RetentionService) *RetentionHandler {
+	return &RetentionHandler{
+		retentionService: retentionService,
+	}
+}
+
+// Preview 预览当前规则会删除哪些种子，不做任何修改
+func (h *RetentionHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	h.run(w, true)
+}
+
+// Run 立即执行清理规则
+func (h *RetentionHandler) Run(w http.ResponseWriter, r *http.Request) {
+	h.run(w, false)
+}
+
+func (h *RetentionHandler) run(w http.ResponseWriter, dryRun bool) {
+	report, err := h.retentionService.Run(dryRun)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
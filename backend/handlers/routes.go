@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/torrentplayer/backend/middleware"
+)
+
+// Router 按方法和路径模式分发请求
+// 模式中的 {name} 匹配一段路径，末尾的 {name...} 匹配剩余的全部路径，参数通过 r.PathValue(name) 获取。
+// 多个模式都匹配时逐段比较，静态段优先于参数，因此 /torrents/import 与 /torrents/{infoHash} 可以共存
+// （ServeMux 在这种情况下注册时会 panic）
+type Router struct {
+	routes []*route
+
+	// NotFound 处理没有匹配任何模式的请求，为空时返回404
+	NotFound http.HandlerFunc
+}
+
+type route struct {
+	pattern  string
+	segments []segment
+	handlers map[string]http.HandlerFunc
+}
+
+type segment struct {
+	value    string // 静态段的值或参数名
+	param    bool
+	wildcard bool
+}
+
+// NewRouter 创建路由器
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle 注册处理器，同一模式和方法重复注册或参数位置相同而名称不同时 panic
+func (rt *Router) Handle(method, pattern string, handler http.HandlerFunc) {
+	segments := parsePattern(pattern)
+	shape := patternShape(segments)
+	for _, existing := range rt.routes {
+		if patternShape(existing.segments) != shape {
+			continue
+		}
+		if existing.pattern != pattern {
+			panic("handlers: pattern " + pattern + " conflicts with " + existing.pattern)
+		}
+		if _, ok := existing.handlers[method]; ok {
+			panic("handlers: " + method + " " + pattern + " registered twice")
+		}
+		existing.handlers[method] = handler
+		return
+	}
+	rt.routes = append(rt.routes, &route{
+		pattern:  pattern,
+		segments: segments,
+		handlers: map[string]http.HandlerFunc{method: handler},
+	})
+}
+
+// ServeHTTP 找到最匹配的模式并按方法分发，路径不存在时返回404，方法不支持时返回405
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := splitPath(r.URL.Path)
+
+	var best *route
+	var bestValues map[string]string
+	for _, candidate := range rt.routes {
+		values, ok := candidate.match(path)
+		if !ok {
+			continue
+		}
+		if best == nil || moreSpecific(candidate.segments, best.segments) {
+			best, bestValues = candidate, values
+		}
+	}
+	if best == nil {
+		if rt.NotFound != nil {
+			rt.NotFound(w, r)
+			return
+		}
+		middleware.WriteErrorResponse(w, "资源不存在", http.StatusNotFound)
+		return
+	}
+
+	handler, ok := best.handlers[r.Method]
+	if !ok && r.Method == http.MethodHead {
+		handler, ok = best.handlers[http.MethodGet]
+	}
+	if !ok {
+		w.Header().Set("Allow", strings.Join(best.methods(), ", "))
+		middleware.WriteErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	for name, value := range bestValues {
+		r.SetPathValue(name, value)
+	}
+	handler(w, r)
+}
+
+// match 匹配路径并返回参数值
+func (rt *route) match(path []string) (map[string]string, bool) {
+	values := make(map[string]string)
+	for i, seg := range rt.segments {
+		if seg.wildcard {
+			rest := strings.Join(path[i:], "/")
+			if rest == "" {
+				return nil, false
+			}
+			values[seg.value] = rest
+			return values, true
+		}
+		if i >= len(path) {
+			return nil, false
+		}
+		switch {
+		case seg.param:
+			if path[i] == "" {
+				return nil, false
+			}
+			values[seg.value] = path[i]
+		case seg.value != path[i]:
+			return nil, false
+		}
+	}
+	return values, len(path) == len(rt.segments)
+}
+
+// methods 已注册的方法，GET 隐含 HEAD
+func (rt *route) methods() []string {
+	methods := make([]string, 0, len(rt.handlers)+1)
+	for method := range rt.handlers {
+		methods = append(methods, method)
+	}
+	if _, ok := rt.handlers[http.MethodGet]; ok {
+		if _, ok := rt.handlers[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// RouteGroup 共用路径前缀的一组路由，可同时注册在旧版前缀下
+type RouteGroup struct {
+	router       *Router
+	prefix       string
+	legacyPrefix string
+}
+
+// Group 创建前缀为 prefix 的路由组，legacyPrefix 为旧版接口的前缀
+func (rt *Router) Group(prefix, legacyPrefix string) *RouteGroup {
+	return &RouteGroup{
+		router:       rt,
+		prefix:       prefix,
+		legacyPrefix: legacyPrefix,
+	}
+}
+
+// Handle 在组前缀下注册处理器，返回值用于注册旧版路径
+func (g *RouteGroup) Handle(method, pattern string, handler http.HandlerFunc) *Endpoint {
+	g.router.Handle(method, g.prefix+pattern, handler)
+	return &Endpoint{group: g, method: method, pattern: pattern, handler: handler}
+}
+
+// Endpoint 已注册的接口
+type Endpoint struct {
+	group   *RouteGroup
+	method  string
+	pattern string
+	handler http.HandlerFunc
+}
+
+// Legacy 在旧版前缀下以相同路径注册
+func (e *Endpoint) Legacy() *Endpoint {
+	return e.Alias(e.group.legacyPrefix + e.pattern)
+}
+
+// Alias 以完整路径 pattern 注册旧版路径，参数名需与新路径一致
+func (e *Endpoint) Alias(pattern string) *Endpoint {
+	e.group.router.Handle(e.method, pattern, e.handler)
+	return e
+}
+
+// parsePattern 解析路径模式
+func parsePattern(pattern string) []segment {
+	parts := splitPath(pattern)
+	segments := make([]segment, len(parts))
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			segments[i] = segment{value: part}
+			continue
+		}
+		name := strings.Trim(part, "{}")
+		if strings.HasSuffix(name, "...") {
+			if i != len(parts)-1 {
+				panic("handlers: wildcard must be the last segment of " + pattern)
+			}
+			segments[i] = segment{value: strings.TrimSuffix(name, "..."), param: true, wildcard: true}
+			continue
+		}
+		segments[i] = segment{value: name, param: true}
+	}
+	return segments
+}
+
+// patternShape 忽略参数名后的模式，形状相同的模式匹配相同的路径
+func patternShape(segments []segment) string {
+	parts := make([]string, len(segments))
+	for i, seg := range segments {
+		switch {
+		case seg.wildcard:
+			parts[i] = "{...}"
+		case seg.param:
+			parts[i] = "{}"
+		default:
+			parts[i] = seg.value
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// moreSpecific 逐段比较，第一个不同的段上静态段优先于参数，参数优先于通配
+func moreSpecific(a, b []segment) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if rank(a[i]) != rank(b[i]) {
+			return rank(a[i]) > rank(b[i])
+		}
+	}
+	return len(a) > len(b)
+}
+
+func rank(seg segment) int {
+	switch {
+	case seg.wildcard:
+		return 0
+	case seg.param:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// splitPath 按 / 拆分路径，忽略首尾的 /
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
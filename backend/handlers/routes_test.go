@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterPrefersStaticSegments(t *testing.T) {
+	router := NewRouter()
+	api := router.Group("/api/v1", "/api")
+	handle := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + ":" + r.PathValue("infoHash") + r.PathValue("file")))
+		}
+	}
+	api.Handle("POST", "/torrents/{infoHash}/pause", handle("pause")).Legacy()
+	api.Handle("POST", "/torrents/{infoHash}/save-data", handle("save")).Alias("/api/torrents/save-data/{infoHash}")
+	api.Handle("POST", "/torrents/import", handle("import")).Legacy()
+	api.Handle("DELETE", "/torrents/{infoHash}", handle("delete"))
+	api.Handle("GET", "/stream/{infoHash}/{file...}", handle("stream"))
+
+	cases := []struct {
+		method, path, body string
+		status             int
+	}{
+		{"POST", "/api/v1/torrents/abc/pause", "pause:abc", 200},
+		{"POST", "/api/torrents/abc/pause", "pause:abc", 200},
+		{"POST", "/api/torrents/save-data/abc", "save:abc", 200},
+		{"POST", "/api/torrents/save-data/pause", "save:pause", 200},
+		{"POST", "/api/torrents/import", "import:", 200},
+		{"DELETE", "/api/v1/torrents/abc/", "delete:abc", 200},
+		{"GET", "/api/v1/stream/abc/dir/movie.mkv", "stream:abcdir/movie.mkv", 200},
+		{"HEAD", "/api/v1/stream/abc/movie.mkv", "", 200},
+		{"GET", "/api/v1/torrents/abc/pause", "", 405},
+		{"DELETE", "/api/torrents/abc", "", 404},
+		{"GET", "/api/v1/stream/abc", "", 404},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(c.method, c.path, nil))
+		if rec.Code != c.status {
+			t.Errorf("%s %s: status %d, want %d", c.method, c.path, rec.Code, c.status)
+			continue
+		}
+		if c.status == 200 && c.method != "HEAD" && rec.Body.String() != c.body {
+			t.Errorf("%s %s: body %q, want %q", c.method, c.path, rec.Body.String(), c.body)
+		}
+	}
+}
+
+func TestRouterRejectsConflictingPatterns(t *testing.T) {
+	router := NewRouter()
+	router.Handle("GET", "/torrents/{infoHash}", func(http.ResponseWriter, *http.Request) {})
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic for a conflicting parameter name")
+		}
+	}()
+	router.Handle("DELETE", "/torrents/{id}", func(http.ResponseWriter, *http.Request) {})
+}
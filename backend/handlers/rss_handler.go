@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/torrentplayer/backend/middleware"
+	"github.com/torrentplayer/backend/service"
+)
+
+// RSSHandler RSS订阅处理器
+type RSSHandler struct {
+	rssService *service.RSSService
+}
+
+// NewRSSHandler 创建RSS订阅处理器
+func NewRSSHandler(rssService *service.RSSService) *RSSHandler {
+	return &RSSHandler{
+		rssService: rssService,
+	}
+}
+
+// Feeds 列出（GET）或添加（POST）订阅
+func (h *RSSHandler) Feeds(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		feeds, err := h.rssService.ListFeeds()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(feeds)
+		return
+	}
+
+	var req service.RSSFeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	feed, err := h.rssService.CreateFeed(&req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(feed)
+}
+
+// Feed 修改（PUT）或删除（DELETE）订阅，路径为 /rss/feeds/{id}
+func (h *RSSHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	id, ok := feedID(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := h.rssService.DeleteFeed(id); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+		return
+	}
+
+	var req service.RSSFeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+	feed, err := h.rssService.UpdateFeed(id, &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(feed)
+}
+
+// CheckFeed 立即拉取订阅，路径为 /rss/feeds/{id}/check
+func (h *RSSHandler) CheckFeed(w http.ResponseWriter, r *http.Request) {
+	id, ok := feedID(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := h.rssService.CheckFeed(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// feedID 解析路径中的订阅ID
+func feedID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		middleware.WriteError(w, middleware.CodeInvalidParameter, "无效的订阅ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// Items 获取匹配记录，可用 feedId 和 limit 参数过滤
+func (h *RSSHandler) Items(w http.ResponseWriter, r *http.Request) {
+	var feedID int64
+	if value := r.URL.Query().Get("feedId"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			middleware.WriteError(w, middleware.CodeInvalidParameter, "feedId参数必须为整数", http.StatusBadRequest)
+			return
+		}
+		feedID = parsed
+	}
+
+	var limit int
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			middleware.WriteError(w, middleware.CodeInvalidParameter, "limit参数必须为正整数", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	items, err := h.rssService.ListItems(feedID, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
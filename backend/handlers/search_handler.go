@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/torrentplayer/backend/middleware"
 	"github.com/torrentplayer/backend/service"
@@ -26,30 +27,64 @@ func (h *SearchHandler) SearchMovie(w http.ResponseWriter, r *http.Request) {
 	// 获取查询参数
 	filename := r.URL.Query().Get("filename")
 	if filename == "" {
-		middleware.WriteErrorResponse(w, "缺少filename参数", http.StatusBadRequest)
+		middleware.WriteError(w, middleware.CodeInvalidParameter, "缺少filename参数", http.StatusBadRequest)
 		return
 	}
 
 	// 验证输入
 	stringValidator := &validator.StringValidator{}
 	if err := stringValidator.ValidateRequired(filename, "filename"); err != nil {
-		middleware.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
 	if err := stringValidator.ValidateMaxLength(filename, "filename", 500); err != nil {
-		middleware.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
 	// 调用搜索服务
 	movieInfo, err := h.searchService.SearchMovie(filename)
 	if err != nil {
-		middleware.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
 	// 返回结果
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(movieInfo)
-}
\ No newline at end of file
+}
+
+// SearchShow 搜索剧集处理器
+func (h *SearchHandler) SearchShow(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		middleware.WriteError(w, middleware.CodeInvalidParameter, "缺少name参数", http.StatusBadRequest)
+		return
+	}
+
+	stringValidator := &validator.StringValidator{}
+	if err := stringValidator.ValidateMaxLength(name, "name", 500); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var year int
+	if value := r.URL.Query().Get("year"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			middleware.WriteError(w, middleware.CodeInvalidParameter, "year参数必须为正整数", http.StatusBadRequest)
+			return
+		}
+		year = parsed
+	}
+
+	showInfo, err := h.searchService.SearchShow(name, year)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(showInfo)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/torrentplayer/backend/service"
+)
+
+// SettingsHandler 运行时设置处理器
+type SettingsHandler struct {
+	settings *service.SettingsService
+}
+
+// NewSettingsHandler 创建运行时设置处理器
+func NewSettingsHandler(settings *service.SettingsService) *SettingsHandler {
+	return &SettingsHandler{
+		settings: settings,
+	}
+}
+
+// Settings 运行时设置处理器（GET获取，PATCH修改）
+func (h *SettingsHandler) Settings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPatch:
+		h.updateSettings(w, r)
+	default:
+		h.getSettings(w, r)
+	}
+}
+
+// getSettings 获取当前设置
+func (h *SettingsHandler) getSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.settings.Get())
+}
+
+// updateSettings 修改设置，请求体中省略的分组和字段保持不变，数组整体替换
+func (h *SettingsHandler) updateSettings(w http.ResponseWriter, r *http.Request) {
+	settings := h.settings.Get()
+	decoder := json.NewDecoder(r.Body)
+	// 拼错的字段名会被静默忽略，因此拒绝未知字段
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&settings); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	updated, err := h.settings.Update(settings)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/torrentplayer/backend/service"
+)
+
+// StatsHandler 传输统计处理器
+type StatsHandler struct {
+	statsService *service.StatsHistoryService
+}
+
+// NewStatsHandler 创建传输统计处理器
+func NewStatsHandler(statsService *service.StatsHistoryService) *StatsHandler {
+	return &StatsHandler{
+		statsService: statsService,
+	}
+}
+
+// History 返回最近一段时间的下载、上传速率和 peer 数，range 默认为 24h
+func (h *StatsHandler) History(w http.ResponseWriter, r *http.Request) {
+	history, err := h.statsService.History(r.URL.Query().Get("range"), time.Now())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
@@ -1,110 +1,221 @@
 package handlers
 
 import (
-	"fmt"
-	"io"
-	"log"
+	"encoding/json"
+	"net"
 	"net/http"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/torrentplayer/backend/auth"
 	"github.com/torrentplayer/backend/middleware"
 	"github.com/torrentplayer/backend/service"
+	"github.com/torrentplayer/backend/torrent"
 	"github.com/torrentplayer/backend/validator"
 )
 
 // StreamHandler 流媒体处理器
 type StreamHandler struct {
-	torrentService *service.TorrentService
+	torrentService     *service.TorrentService
+	preferencesService *service.PreferencesService
 }
 
 // NewStreamHandler 创建流媒体处理器
-func NewStreamHandler(torrentService *service.TorrentService) *StreamHandler {
+func NewStreamHandler(torrentService *service.TorrentService, preferencesService *service.PreferencesService) *StreamHandler {
 	return &StreamHandler{
-		torrentService: torrentService,
+		torrentService:     torrentService,
+		preferencesService: preferencesService,
 	}
 }
 
 // StreamFile 流媒体文件处理器
 func (h *StreamHandler) StreamFile(w http.ResponseWriter, r *http.Request) {
-	// 解析URL路径: /stream/{infoHash}/{fileName}
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 4 {
-		middleware.WriteErrorResponse(w, "无效的URL格式", http.StatusBadRequest)
-		return
-	}
-
-	infoHash := pathParts[len(pathParts)-2]
-	fileName := pathParts[len(pathParts)-1]
+	// 路径为 /stream/{infoHash}/{fileName...}，文件名可以包含子目录
+	infoHash := r.PathValue("infoHash")
+	fileName := r.PathValue("fileName")
 
 	// 验证InfoHash
 	ihValidator := &validator.InfoHashValidator{}
 	if err := ihValidator.ValidateInfoHash(infoHash); err != nil {
-		middleware.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
 	// 验证文件路径
 	fpValidator := &validator.FilePathValidator{}
 	if err := fpValidator.ValidateFilePath(fileName); err != nil {
-		middleware.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
-	// 获取种子信息
-	torrentInfo, err := h.torrentService.GetTorrent(infoHash)
+	// 按路径查找文件，种子或文件不存在时返回 404
+	fileIndex, err := h.torrentService.FileIndex(infoHash, fileName)
 	if err != nil {
-		middleware.WriteErrorResponse(w, "种子不存在", http.StatusNotFound)
+		writeError(w, err)
 		return
 	}
 
-	// 获取文件列表
-	filesList, err := h.torrentService.ListFiles(infoHash)
+	// 合并用户播放偏好与请求参数
+	options, err := h.preferencesService.ResolvePlaybackOptions(currentUserID(r), r.URL.Query())
 	if err != nil {
-		middleware.WriteErrorResponse(w, "获取文件列表失败", http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	// 查找匹配的文件
-	var fileIndex int = -1
-	for _, f := range filesList {
-		if f.Path == fileName {
-			fileIndex = f.FileIndex
-			break
-		}
+	// 播放器用 HEAD 探测文件大小和是否支持 Range，不读取内容，不登记播放会话，也不计入同时播放上限
+	var reader torrent.FileReader
+	if r.Method == http.MethodHead {
+		reader, _, err = h.torrentService.OpenFile(infoHash, fileIndex)
+	} else {
+		reader, _, err = h.torrentService.OpenStream(streamClient(r, service.StreamKindStream), infoHash, fileIndex)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer reader.Close()
+
+	h.streamFileContent(w, r, reader, fileName, fileETag(infoHash, fileIndex), options)
+}
+
+// streamFileContent 流式传输文件内容，支持 Range 请求用于拖动进度，包括多个范围（multipart/byteranges）、
+// HEAD 请求和带 ETag 的 If-Range 请求；始终返回原始字节，生效的播放选项放在响应头中
+func (h *StreamHandler) streamFileContent(w http.ResponseWriter, r *http.Request, reader torrent.FileReader, fileName, etag string, options *service.PlaybackOptions) {
+	// 播放时间不受服务器写超时限制
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", getContentTypeFromPath(fileName))
+	if options != nil {
+		setPlaybackHeaders(w.Header(), options)
+	}
+	http.ServeContent(streamWriter{ResponseWriter: w, ctx: r.Context()}, r, "", time.Time{}, contextReader{FileReader: reader, ctx: r.Context()})
+}
+
+// 播放选项响应头
+const (
+	audioLanguageHeader    = "X-Audio-Language"
+	subtitleLanguageHeader = "X-Subtitle-Language"
+	maxBitrateHeader       = "X-Max-Bitrate"
+	forceTranscodeHeader   = "X-Force-Transcode"
+)
+
+// setPlaybackHeaders 返回本次播放生效的选项，播放器据此选择文件中的音轨和字幕。
+// 服务器不转码，码率上限和强制转码只告知播放器，不改变返回的内容
+func setPlaybackHeaders(header http.Header, options *service.PlaybackOptions) {
+	if options.AudioLanguage != "" {
+		header.Set(audioLanguageHeader, options.AudioLanguage)
+	}
+	if options.SubtitleLanguage != "" {
+		header.Set(subtitleLanguageHeader, options.SubtitleLanguage)
+	}
+	if options.MaxBitrateKbps > 0 {
+		header.Set(maxBitrateHeader, strconv.Itoa(options.MaxBitrateKbps))
+	}
+	if options.ForceTranscode {
+		header.Set(forceTranscodeHeader, "true")
 	}
+}
+
+// streamClient 播放会话的客户端信息
+func streamClient(r *http.Request, kind string) service.StreamClient {
+	client := service.StreamClient{UserID: currentUserID(r), RemoteAddr: r.RemoteAddr, UserAgent: r.UserAgent(), Kind: kind}
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+		client.Username = claims.Username
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		client.RemoteAddr = host
+	}
+	return client
+}
+
+// Buffer 文件从 offset 起已缓冲的字节数和当前下载速度，播放器据此显示缓冲状态并决定是否自动暂停
+func (h *StreamHandler) Buffer(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
 
-	if fileIndex == -1 {
-		middleware.WriteErrorResponse(w, "文件不存在", http.StatusNotFound)
+	// 验证InfoHash
+	ihValidator := &validator.InfoHashValidator{}
+	if err := ihValidator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
 		return
 	}
 
-	// 使用原始torrent客户端获取文件流
-	// 注意：这里需要访问底层的torrent客户端
-	// 在生产环境中，应该在服务层提供流媒体方法
-	if err := h.streamFileContent(w, r, infoHash, fileIndex, fileName); err != nil {
-		log.Printf("流媒体传输失败: %v", err)
-		if !isConnectionClosed(err) {
-			middleware.WriteErrorResponse(w, "流媒体传输失败", http.StatusInternalServerError)
+	fileIndex, err := strconv.Atoi(r.PathValue("fileIndex"))
+	if err != nil || fileIndex < 0 {
+		middleware.WriteError(w, middleware.CodeInvalidParameter, "文件索引必须为非负整数", http.StatusBadRequest)
+		return
+	}
+
+	var offset int64
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || offset < 0 {
+			middleware.WriteError(w, middleware.CodeInvalidParameter, "offset必须为非负整数", http.StatusBadRequest)
+			return
 		}
 	}
+
+	buffer, err := h.torrentService.FileBuffer(infoHash, fileIndex, offset)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// 缓冲状态随时变化，播放器轮询时不能使用缓存
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buffer)
 }
 
-// streamFileContent 流式传输文件内容
-func (h *StreamHandler) streamFileContent(w http.ResponseWriter, r *http.Request, infoHash string, fileIndex int, fileName string) error {
-	// 这里需要访问底层的torrent客户端
-	// 为了演示，我们假设可以通过服务层获取文件流
-	// 在实际实现中，需要在TorrentService中添加GetFileStream方法
-	
-	// 设置Content-Type
-	contentType := getContentTypeFromPath(fileName)
-	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Accept-Ranges", "bytes")
-
-	// 这里应该实现实际的文件流传输逻辑
-	// 由于需要访问底层torrent库，暂时返回错误提示
-	return fmt.Errorf("流媒体功能需要在服务层实现文件流接口")
+// SessionsResponse 播放会话列表响应
+type SessionsResponse struct {
+	// MaxStreams 同时播放的会话数上限，0 表示不限制
+	MaxStreams int                     `json:"maxStreams"`
+	Sessions   []service.StreamSession `json:"sessions"`
+}
+
+// Sessions 列出正在播放和下载的会话
+func (h *StreamHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	sessions := h.torrentService.Sessions()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SessionsResponse{
+		MaxStreams: sessions.MaxSessions(),
+		Sessions:   sessions.List(),
+	})
+}
+
+// RateLimitRequest 设置会话限速请求
+type RateLimitRequest struct {
+	// BytesPerSec 读取速度上限（字节/秒），0 表示不限速
+	BytesPerSec *int64 `json:"bytesPerSec"`
+}
+
+// RateLimit 设置（PUT）或恢复默认（DELETE）播放会话的读取速度上限，立即作用于会话中正在进行的请求
+func (h *StreamHandler) RateLimit(w http.ResponseWriter, r *http.Request) {
+	// 负数表示恢复按 TORRENT_STREAM_RATE_FACTOR 计算的默认限速
+	bytesPerSec := int64(-1)
+	if r.Method == http.MethodPut {
+		var req RateLimitRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeInvalidBody(w, err)
+			return
+		}
+		if req.BytesPerSec == nil || *req.BytesPerSec < 0 {
+			writeError(w, validator.ValidationError{Field: "bytesPerSec", Message: "必须为非负整数，0 表示不限速"})
+			return
+		}
+		bytesPerSec = *req.BytesPerSec
+	}
+
+	session, err := h.torrentService.Sessions().SetRateLimit(r.PathValue("id"), bytesPerSec)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
 }
 
 // getContentTypeFromPath 根据文件路径确定Content-Type
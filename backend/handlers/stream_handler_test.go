@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/torrentplayer/backend/service"
+)
+
+// memoryReader 内存中的文件，代替种子文件的读取器
+type memoryReader struct {
+	*bytes.Reader
+}
+
+func (memoryReader) Close() error { return nil }
+
+func (r memoryReader) ReadContext(_ context.Context, p []byte) (int, error) { return r.Read(p) }
+
+func (memoryReader) SetReadahead(int64) {}
+
+func (memoryReader) SetReadaheadFunc(torrent.ReadaheadFunc) {}
+
+func (memoryReader) SetResponsive() {}
+
+func serveTestStream(t *testing.T, method string, header http.Header, content []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, "/stream/abc/movie.mp4", nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	h := &StreamHandler{}
+	h.streamFileContent(w, r, memoryReader{bytes.NewReader(content)}, "movie.mp4", `"abc-0"`, nil)
+	return w
+}
+
+func TestStreamRanges(t *testing.T) {
+	content := make([]byte, 1000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	cases := []struct {
+		name         string
+		method       string
+		header       http.Header
+		status       int
+		contentRange string
+		body         []byte
+	}{
+		// 探测文件大小，只返回响应头
+		{"HEAD", http.MethodHead, nil, 200, "", nil},
+		{"HEAD range", http.MethodHead, http.Header{"Range": {"bytes=0-1"}}, 206, "bytes 0-1/1000", nil},
+		// Safari 先请求前两个字节确认支持 Range
+		{"Safari probe", http.MethodGet, http.Header{"Range": {"bytes=0-1"}}, 206, "bytes 0-1/1000", content[:2]},
+		// Chrome 从头请求到结尾，拖动时从新位置开始
+		{"Chrome open", http.MethodGet, http.Header{"Range": {"bytes=0-"}}, 206, "bytes 0-999/1000", content},
+		{"Chrome seek", http.MethodGet, http.Header{"Range": {"bytes=500-"}}, 206, "bytes 500-999/1000", content[500:]},
+		// VLC 读取文件末尾的索引
+		{"VLC index", http.MethodGet, http.Header{"Range": {"bytes=-100"}}, 206, "bytes 900-999/1000", content[900:]},
+		{"no range", http.MethodGet, nil, 200, "", content},
+		{"If-Range match", http.MethodGet, http.Header{"Range": {"bytes=10-19"}, "If-Range": {`"abc-0"`}}, 206, "bytes 10-19/1000", content[10:20]},
+		{"If-Range mismatch", http.MethodGet, http.Header{"Range": {"bytes=10-19"}, "If-Range": {`"abc-1"`}}, 200, "", content},
+		{"unsatisfiable", http.MethodGet, http.Header{"Range": {"bytes=1000-"}}, 416, "bytes */1000", nil},
+	}
+	for _, c := range cases {
+		w := serveTestStream(t, c.method, c.header, content)
+		if w.Code != c.status {
+			t.Errorf("%s: status %d, want %d", c.name, w.Code, c.status)
+			continue
+		}
+		if got := w.Header().Get("Content-Range"); got != c.contentRange {
+			t.Errorf("%s: Content-Range %q, want %q", c.name, got, c.contentRange)
+		}
+		if c.status == 416 {
+			continue
+		}
+		if got := w.Header().Get("Accept-Ranges"); got != "bytes" {
+			t.Errorf("%s: Accept-Ranges %q", c.name, got)
+		}
+		if got := w.Header().Get("ETag"); got != `"abc-0"` {
+			t.Errorf("%s: ETag %q", c.name, got)
+		}
+		if c.method == http.MethodHead {
+			if w.Body.Len() != 0 {
+				t.Errorf("%s: HEAD response has a body of %d bytes", c.name, w.Body.Len())
+			}
+			continue
+		}
+		if !bytes.Equal(w.Body.Bytes(), c.body) {
+			t.Errorf("%s: got %d bytes, want %d", c.name, w.Body.Len(), len(c.body))
+		}
+		if got := w.Header().Get("Content-Length"); got != strconv.Itoa(len(c.body)) {
+			t.Errorf("%s: Content-Length %s, want %d", c.name, got, len(c.body))
+		}
+	}
+}
+
+func TestStreamMultipleRanges(t *testing.T) {
+	content := make([]byte, 1000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	// 播放器同时读取文件头和文件末尾的索引
+	w := serveTestStream(t, http.MethodGet, http.Header{"Range": {"bytes=0-9,990-999"}}, content)
+	if w.Code != 206 {
+		t.Fatalf("status %d, want 206", w.Code)
+	}
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Content-Type %q", w.Header().Get("Content-Type"))
+	}
+	if got := w.Header().Get("Content-Length"); got != strconv.Itoa(w.Body.Len()) {
+		t.Errorf("Content-Length %s, body has %d bytes", got, w.Body.Len())
+	}
+
+	parts := multipart.NewReader(w.Body, params["boundary"])
+	want := []struct {
+		contentRange string
+		body         []byte
+	}{
+		{"bytes 0-9/1000", content[:10]},
+		{"bytes 990-999/1000", content[990:]},
+	}
+	for i, expected := range want {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		if got := part.Header.Get("Content-Range"); got != expected.contentRange {
+			t.Errorf("part %d: Content-Range %q, want %q", i, got, expected.contentRange)
+		}
+		if got := part.Header.Get("Content-Type"); got != "video/mp4" {
+			t.Errorf("part %d: Content-Type %q", i, got)
+		}
+		body, _ := io.ReadAll(part)
+		if !bytes.Equal(body, expected.body) {
+			t.Errorf("part %d: got %v, want %v", i, body, expected.body)
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("expected two parts, got more: %v", err)
+	}
+}
+
+func TestStreamPlaybackHeaders(t *testing.T) {
+	cases := map[string]struct {
+		options *service.PlaybackOptions
+		want    map[string]string
+	}{
+		"no options": {nil, map[string]string{}},
+		"defaults":   {&service.PlaybackOptions{}, map[string]string{}},
+		"all": {&service.PlaybackOptions{MaxBitrateKbps: 4000, AudioLanguage: "ja", SubtitleLanguage: "zh", ForceTranscode: true}, map[string]string{
+			audioLanguageHeader: "ja", subtitleLanguageHeader: "zh", maxBitrateHeader: "4000", forceTranscodeHeader: "true",
+		}},
+	}
+
+	for name, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/stream/abc/movie.mp4", nil)
+		w := httptest.NewRecorder()
+		h := &StreamHandler{}
+		h.streamFileContent(w, r, memoryReader{bytes.NewReader([]byte("movie"))}, "movie.mp4", `"abc-0"`, tc.options)
+
+		for _, header := range []string{audioLanguageHeader, subtitleLanguageHeader, maxBitrateHeader, forceTranscodeHeader} {
+			if got := w.Header().Get(header); got != tc.want[header] {
+				t.Errorf("%s: %s %q, want %q", name, header, got, tc.want[header])
+			}
+		}
+		// the file is served as stored, it is not transcoded
+		if w.Body.String() != "movie" {
+			t.Errorf("%s: body %q", name, w.Body.String())
+		}
+	}
+}
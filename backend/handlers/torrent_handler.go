@@ -2,12 +2,19 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/events"
+	"github.com/torrentplayer/backend/importer"
 	"github.com/torrentplayer/backend/middleware"
 	"github.com/torrentplayer/backend/service"
+	"github.com/torrentplayer/backend/torrent"
 	"github.com/torrentplayer/backend/validator"
 )
 
@@ -15,40 +22,65 @@ import (
 type TorrentHandler struct {
 	torrentService *service.TorrentService
 	searchService  *service.SearchService
+	autoMatch      *service.AutoMatchService
+	bus            *events.Bus
 }
 
 // NewTorrentHandler 创建种子处理器
-func NewTorrentHandler(torrentService *service.TorrentService, searchService *service.SearchService) *TorrentHandler {
+func NewTorrentHandler(torrentService *service.TorrentService, searchService *service.SearchService, autoMatch *service.AutoMatchService, bus *events.Bus) *TorrentHandler {
 	return &TorrentHandler{
 		torrentService: torrentService,
 		searchService:  searchService,
+		autoMatch:      autoMatch,
+		bus:            bus,
 	}
 }
 
+// AddMagnetRequest 添加磁力链接请求
+type AddMagnetRequest struct {
+	MagnetURI string `json:"magnetUri"`
+	// Private 按私有种子处理，在元数据到达前就不向公共 tracker 和 DHT 公开
+	Private bool `json:"private"`
+	// AutoMatch 元数据到达后自动识别并保存电影或剧集详情
+	AutoMatch bool `json:"autoMatch"`
+}
+
 // AddMagnet 添加磁力链接处理器
 func (h *TorrentHandler) AddMagnet(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		MagnetURI string `json:"magnetUri"`
-	}
+	var req AddMagnetRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		middleware.WriteErrorResponse(w, "无效的请求格式", http.StatusBadRequest)
+		writeInvalidBody(w, err)
 		return
 	}
 
 	// 验证磁力链接
 	magnetValidator := &validator.MagnetValidator{}
 	if err := magnetValidator.ValidateMagnetURI(req.MagnetURI); err != nil {
-		middleware.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
+	// timeoutSec 覆盖每次等待元数据的时间（TORRENT_METADATA_TIMEOUT）
+	var metadataTimeout time.Duration
+	if value := r.URL.Query().Get("timeoutSec"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			middleware.WriteError(w, middleware.CodeInvalidParameter, "timeoutSec参数必须为正整数", http.StatusBadRequest)
+			return
+		}
+		metadataTimeout = time.Duration(seconds) * time.Second
+	}
+
 	// 调用服务层
-	torrentInfo, err := h.torrentService.AddMagnet(req.MagnetURI)
+	torrentInfo, err := h.torrentService.AddMagnetWithTimeout(r.Context(), req.MagnetURI, req.Private, metadataTimeout)
 	if err != nil {
-		middleware.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
+	if req.AutoMatch {
+		h.autoMatch.Request(torrentInfo.InfoHash)
+	}
 
 	// 返回结果
 	w.Header().Set("Content-Type", "application/json")
@@ -56,55 +88,225 @@ func (h *TorrentHandler) AddMagnet(w http.ResponseWriter, r *http.Request) {
 }
 
 // ListTorrents 获取种子列表处理器
+// 查询参数：sort（name、added、progress、size、state）、order（asc、desc）、state、category、tag（可重复）、
+// owner（用户ID，me 表示当前用户）、limit、offset；
+// 符合条件的总数通过 X-Total-Count 响应头返回
+// 响应带有 ETag，If-None-Match 匹配时返回304；同时指定 wait（如 30s，最长60s）时先等待列表变化，超时仍未变化才返回304
 func (h *TorrentHandler) ListTorrents(w http.ResponseWriter, r *http.Request) {
-	torrents, err := h.torrentService.ListTorrents()
+	query := r.URL.Query()
+	listQuery := service.TorrentListQuery{
+		TorrentFilter: torrentFilter(r),
+		State:         query.Get("state"),
+		Sort:          query.Get("sort"),
+	}
+
+	// 默认按添加时间倒序，其余字段默认升序
+	switch query.Get("order") {
+	case "":
+		listQuery.Desc = listQuery.Sort == "" || listQuery.Sort == "added"
+	case "asc":
+	case "desc":
+		listQuery.Desc = true
+	default:
+		middleware.WriteError(w, middleware.CodeInvalidParameter, "order参数必须为asc或desc", http.StatusBadRequest)
+		return
+	}
+
+	owner, ok := ownerParam(w, r)
+	if !ok {
+		return
+	}
+	listQuery.AddedBy = owner
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			middleware.WriteError(w, middleware.CodeInvalidParameter, "limit参数必须为正整数", http.StatusBadRequest)
+			return
+		}
+		listQuery.Limit = parsed
+	}
+	if value := query.Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			middleware.WriteError(w, middleware.CodeInvalidParameter, "offset参数必须为非负整数", http.StatusBadRequest)
+			return
+		}
+		listQuery.Offset = parsed
+	}
+
+	var wait time.Duration
+	if value := query.Get("wait"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			// 也接受不带单位的秒数
+			seconds, atoiErr := strconv.Atoi(value)
+			if atoiErr != nil {
+				middleware.WriteError(w, middleware.CodeInvalidParameter, "wait参数必须为时长，例如30s", http.StatusBadRequest)
+				return
+			}
+			parsed = time.Duration(seconds) * time.Second
+		}
+		if parsed < 0 {
+			middleware.WriteError(w, middleware.CodeInvalidParameter, "wait参数不能为负数", http.StatusBadRequest)
+			return
+		}
+		wait = min(parsed, maxListWait)
+	}
+
+	list, err := h.listTorrents(listQuery)
 	if err != nil {
-		middleware.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
+		return
+	}
+
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if wait > 0 && etagMatches(ifNoneMatch, list.etag) {
+		list, err = h.waitForListChange(w, r, listQuery, list, wait)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if list == nil {
+			// 客户端已断开
+			return
+		}
+	}
+
+	w.Header().Set("ETag", list.etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Total-Count", strconv.Itoa(list.total))
+	if etagMatches(ifNoneMatch, list.etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(torrents)
+	w.Write(list.body)
+}
+
+const (
+	// maxListWait 种子列表长轮询的最长等待时间
+	maxListWait = 60 * time.Second
+	// listRecheckInterval 长轮询期间重新检查列表的间隔，下载进度的变化没有事件通知
+	listRecheckInterval = 2 * time.Second
+)
+
+// torrentList 编码后的种子列表
+type torrentList struct {
+	body  []byte
+	total int
+	etag  string
+}
+
+// listTorrents 查询并编码种子列表，ETag 由响应体和总数计算
+func (h *TorrentHandler) listTorrents(query service.TorrentListQuery) (*torrentList, error) {
+	torrents, total, err := h.torrentService.ListTorrents(query)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(torrents)
+	if err != nil {
+		return nil, err
+	}
+	body = append(body, '\n')
+	return &torrentList{
+		body:  body,
+		total: total,
+		etag:  computeETag(body, []byte(strconv.Itoa(total))),
+	}, nil
+}
+
+// waitForListChange 等待列表变化，收到种子事件或定期重新检查时比较 ETag
+// 超时时返回未变化的列表，客户端断开时返回 nil
+func (h *TorrentHandler) waitForListChange(w http.ResponseWriter, r *http.Request, query service.TorrentListQuery, list *torrentList, wait time.Duration) (*torrentList, error) {
+	// 等待时间可能超过服务器写超时
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + 10*time.Second))
+
+	ch, unsubscribe := h.bus.Subscribe()
+	defer unsubscribe()
+
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	recheck := time.NewTicker(listRecheckInterval)
+	defer recheck.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil, nil
+		case <-timeout.C:
+			return list, nil
+		case <-ch:
+		case <-recheck.C:
+		}
+
+		current, err := h.listTorrents(query)
+		if err != nil {
+			return nil, err
+		}
+		if current.etag != list.etag {
+			return current, nil
+		}
+	}
+}
+
+// MovieDetailsRequest 保存电影或剧集详情的请求，字段与搜索接口的返回值一致
+type MovieDetailsRequest struct {
+	Filename      string   `json:"filename,omitempty"`
+	Year          int      `json:"year,omitempty"`
+	PosterUrl     string   `json:"posterUrl,omitempty"`
+	BackdropUrl   string   `json:"backdropUrl,omitempty"`
+	Overview      string   `json:"overview,omitempty"`
+	Rating        float64  `json:"rating,omitempty"`
+	VoteCount     int      `json:"voteCount,omitempty"`
+	Genres        []string `json:"genres,omitempty"`
+	Runtime       int      `json:"runtime,omitempty"`
+	TmdbId        int      `json:"tmdbId,omitempty"`
+	ReleaseDate   string   `json:"releaseDate,omitempty"`
+	OriginalTitle string   `json:"originalTitle,omitempty"`
+	Popularity    float64  `json:"popularity,omitempty"`
+	Status        string   `json:"status,omitempty"`
+	Tagline       string   `json:"tagline,omitempty"`
+
+	// 剧集使用以下字段，mediaType 为 tv
+	MediaType        string `json:"mediaType,omitempty"`
+	NumberOfSeasons  int    `json:"numberOfSeasons,omitempty"`
+	NumberOfEpisodes int    `json:"numberOfEpisodes,omitempty"`
+
+	// IMDb和烂番茄评分，搜索接口在配置了OMDb时返回
+	ImdbId         string  `json:"imdbId,omitempty"`
+	ImdbRating     float64 `json:"imdbRating,omitempty"`
+	ImdbVotes      int     `json:"imdbVotes,omitempty"`
+	RottenTomatoes int     `json:"rottenTomatoes,omitempty"`
+	ContentRating  string  `json:"contentRating,omitempty"`
+
+	// 电影所属的TMDB合集，搜索接口返回的字段名为 id
+	Collection *struct {
+		ID          int    `json:"id"`
+		TmdbId      int    `json:"tmdbId"`
+		Name        string `json:"name"`
+		PosterUrl   string `json:"posterUrl,omitempty"`
+		BackdropUrl string `json:"backdropUrl,omitempty"`
+	} `json:"collection,omitempty"`
+	TrailerUrl string `json:"trailerUrl,omitempty"`
 }
 
 // UpdateMovieDetails 更新电影详情处理器
 func (h *TorrentHandler) UpdateMovieDetails(w http.ResponseWriter, r *http.Request) {
-	// 从URL路径中提取InfoHash
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 4 {
-		middleware.WriteErrorResponse(w, "缺少InfoHash参数", http.StatusBadRequest)
-		return
-	}
-	infoHash := pathParts[len(pathParts)-1]
+	infoHash := r.PathValue("infoHash")
 
 	// 验证InfoHash
 	validator := &validator.InfoHashValidator{}
 	if err := validator.ValidateInfoHash(infoHash); err != nil {
-		middleware.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
 	// 解析请求体
-	var movieDetails struct {
-		Filename      string   `json:"filename,omitempty"`
-		Year          int      `json:"year,omitempty"`
-		PosterUrl     string   `json:"posterUrl,omitempty"`
-		BackdropUrl   string   `json:"backdropUrl,omitempty"`
-		Overview      string   `json:"overview,omitempty"`
-		Rating        float64  `json:"rating,omitempty"`
-		VoteCount     int      `json:"voteCount,omitempty"`
-		Genres        []string `json:"genres,omitempty"`
-		Runtime       int      `json:"runtime,omitempty"`
-		TmdbId        int      `json:"tmdbId,omitempty"`
-		ReleaseDate   string   `json:"releaseDate,omitempty"`
-		OriginalTitle string   `json:"originalTitle,omitempty"`
-		Popularity    float64  `json:"popularity,omitempty"`
-		Status        string   `json:"status,omitempty"`
-		Tagline       string   `json:"tagline,omitempty"`
-	}
+	var movieDetails MovieDetailsRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&movieDetails); err != nil {
-		middleware.WriteErrorResponse(w, "无效的请求格式", http.StatusBadRequest)
+		writeInvalidBody(w, err)
 		return
 	}
 
@@ -125,11 +327,34 @@ func (h *TorrentHandler) UpdateMovieDetails(w http.ResponseWriter, r *http.Reque
 		Popularity:    movieDetails.Popularity,
 		Status:        movieDetails.Status,
 		Tagline:       movieDetails.Tagline,
+
+		MediaType:        movieDetails.MediaType,
+		NumberOfSeasons:  movieDetails.NumberOfSeasons,
+		NumberOfEpisodes: movieDetails.NumberOfEpisodes,
+
+		ImdbId:         movieDetails.ImdbId,
+		ImdbRating:     movieDetails.ImdbRating,
+		ImdbVotes:      movieDetails.ImdbVotes,
+		RottenTomatoes: movieDetails.RottenTomatoes,
+		ContentRating:  movieDetails.ContentRating,
+
+		TrailerUrl: movieDetails.TrailerUrl,
+	}
+	if c := movieDetails.Collection; c != nil && (c.ID > 0 || c.TmdbId > 0) {
+		dbMovieDetails.Collection = &db.MovieCollection{
+			TmdbId:      c.TmdbId,
+			Name:        c.Name,
+			PosterUrl:   c.PosterUrl,
+			BackdropUrl: c.BackdropUrl,
+		}
+		if c.ID > 0 {
+			dbMovieDetails.Collection.TmdbId = c.ID
+		}
 	}
 
 	// 调用服务层
 	if err := h.torrentService.UpdateMovieDetails(infoHash, dbMovieDetails); err != nil {
-		middleware.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -140,9 +365,9 @@ func (h *TorrentHandler) UpdateMovieDetails(w http.ResponseWriter, r *http.Reque
 
 // GetMovieDetails 获取电影详情处理器
 func (h *TorrentHandler) GetMovieDetails(w http.ResponseWriter, r *http.Request) {
-	records, err := h.torrentService.GetMovieDetails()
+	records, err := h.torrentService.GetMovieDetails(torrentFilter(r))
 	if err != nil {
-		middleware.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -150,39 +375,45 @@ func (h *TorrentHandler) GetMovieDetails(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(records)
 }
 
-// SaveTorrentData 保存种子数据处理器
-func (h *TorrentHandler) SaveTorrentData(w http.ResponseWriter, r *http.Request) {
-	// 从URL路径中提取InfoHash
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 5 {
-		middleware.WriteErrorResponse(w, "无效的URL路径", http.StatusBadRequest)
+// ListCollections 获取媒体库中的电影合集，可用 category 和 tag 参数过滤
+func (h *TorrentHandler) ListCollections(w http.ResponseWriter, r *http.Request) {
+	collections, err := h.torrentService.ListCollections(torrentFilter(r))
+	if err != nil {
+		writeError(w, err)
 		return
 	}
-	infoHash := pathParts[len(pathParts)-1]
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collections)
+}
+
+// SaveTorrentData 保存种子数据处理器
+func (h *TorrentHandler) SaveTorrentData(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
 
 	// 验证InfoHash
 	validator := &validator.InfoHashValidator{}
 	if err := validator.ValidateInfoHash(infoHash); err != nil {
-		middleware.WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
 	// 解析请求体
 	var torrentData service.TorrentUpdateData
 	if err := json.NewDecoder(r.Body).Decode(&torrentData); err != nil {
-		middleware.WriteErrorResponse(w, "无效的请求格式", http.StatusBadRequest)
+		writeInvalidBody(w, err)
 		return
 	}
 
 	// 验证InfoHash一致性
 	if infoHash != torrentData.InfoHash {
-		middleware.WriteErrorResponse(w, "InfoHash不匹配", http.StatusBadRequest)
+		middleware.WriteError(w, middleware.CodeValidationFailed, "InfoHash不匹配", http.StatusBadRequest)
 		return
 	}
 
 	// 调用服务层
 	if err := h.torrentService.SaveTorrentData(infoHash, &torrentData); err != nil {
-		middleware.WriteErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -192,4 +423,574 @@ func (h *TorrentHandler) SaveTorrentData(w http.ResponseWriter, r *http.Request)
 		"status":  "success",
 		"message": "种子数据保存成功",
 	})
-}
\ No newline at end of file
+}
+// Diagnostics 获取种子诊断报告处理器，probe=false 时跳过 tracker/DHT/UPnP 实时探测
+func (h *TorrentHandler) Diagnostics(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
+
+	// 验证InfoHash
+	validator := &validator.InfoHashValidator{}
+	if err := validator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	probe := true
+	if value := r.URL.Query().Get("probe"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			middleware.WriteError(w, middleware.CodeInvalidParameter, "probe参数必须为布尔值", http.StatusBadRequest)
+			return
+		}
+		probe = parsed
+	}
+
+	report, err := h.torrentService.GetDiagnostics(r.Context(), infoHash, probe)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// Pieces 分片图：每个分片是否已下载以及有多少 peer 拥有，用于绘制分片图和显示可以拖动到的位置
+func (h *TorrentHandler) Pieces(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
+
+	// 验证InfoHash
+	validator := &validator.InfoHashValidator{}
+	if err := validator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	pieces, err := h.torrentService.GetPieceMap(infoHash)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pieces)
+}
+
+// NetworkCheck 网络连通性检查处理器
+func (h *TorrentHandler) NetworkCheck(w http.ResponseWriter, r *http.Request) {
+	check := h.torrentService.CheckNetwork(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(check)
+}
+
+// PauseTorrent 暂停种子处理器
+func (h *TorrentHandler) PauseTorrent(w http.ResponseWriter, r *http.Request) {
+	h.changeState(w, r, h.torrentService.PauseTorrent)
+}
+
+// ResumeTorrent 恢复种子处理器，也可用于重试获取元数据失败的种子
+func (h *TorrentHandler) ResumeTorrent(w http.ResponseWriter, r *http.Request) {
+	h.changeState(w, r, h.torrentService.ResumeTorrent)
+}
+
+// Seeding 种子做种统计与限制处理器（GET获取，PUT更新）
+func (h *TorrentHandler) Seeding(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
+
+	// 验证InfoHash
+	hashValidator := &validator.InfoHashValidator{}
+	if err := hashValidator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+	infoHash = strings.ToLower(infoHash)
+
+	var status *service.SeedingStatus
+	var err error
+	if r.Method == http.MethodPut {
+		var override service.SeedingOverride
+		if decodeErr := json.NewDecoder(r.Body).Decode(&override); decodeErr != nil {
+			writeInvalidBody(w, decodeErr)
+			return
+		}
+		status, err = h.torrentService.UpdateSeedingLimits(infoHash, &override)
+	} else {
+		status, err = h.torrentService.GetSeedingStatus(infoHash)
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// Connections 种子连接数上限处理器（GET获取，PUT更新）
+func (h *TorrentHandler) Connections(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
+
+	// 验证InfoHash
+	hashValidator := &validator.InfoHashValidator{}
+	if err := hashValidator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+	infoHash = strings.ToLower(infoHash)
+
+	var status *service.ConnectionStatus
+	var err error
+	if r.Method == http.MethodPut {
+		var override service.ConnectionOverride
+		if decodeErr := json.NewDecoder(r.Body).Decode(&override); decodeErr != nil {
+			writeInvalidBody(w, decodeErr)
+			return
+		}
+		status, err = h.torrentService.UpdateConnections(infoHash, &override)
+	} else {
+		status, err = h.torrentService.GetConnections(infoHash)
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// TrackersRequest 添加 tracker 或强制重新汇报的请求
+type TrackersRequest struct {
+	URLs       []string `json:"urls"`
+	Reannounce bool     `json:"reannounce"`
+}
+
+// Trackers 种子 tracker 管理处理器
+// GET 获取 tracker 列表；POST 添加 urls 中的 tracker，reannounce 为 true 时立即向所有 tracker 汇报；
+// DELETE 移除 url 查询参数指定的 tracker（可重复）
+func (h *TorrentHandler) Trackers(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
+
+	// 验证InfoHash
+	hashValidator := &validator.InfoHashValidator{}
+	if err := hashValidator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+	infoHash = strings.ToLower(infoHash)
+
+	var trackers []torrent.TrackerInfo
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		var req TrackersRequest
+		if decodeErr := json.NewDecoder(r.Body).Decode(&req); decodeErr != nil {
+			writeInvalidBody(w, decodeErr)
+			return
+		}
+		if len(req.URLs) == 0 && !req.Reannounce {
+			middleware.WriteError(w, middleware.CodeValidationFailed, "urls和reannounce不能同时为空", http.StatusBadRequest)
+			return
+		}
+		if len(req.URLs) > 0 {
+			trackers, err = h.torrentService.AddTrackers(infoHash, req.URLs)
+		}
+		if err == nil && req.Reannounce {
+			trackers, err = h.torrentService.ReannounceTrackers(r.Context(), infoHash)
+		}
+	case http.MethodDelete:
+		trackers, err = h.torrentService.RemoveTrackers(infoHash, r.URL.Query()["url"])
+	default:
+		trackers, err = h.torrentService.ListTrackers(infoHash)
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trackers)
+}
+
+// WebseedsRequest 添加 web seed 的请求
+type WebseedsRequest struct {
+	URLs []string `json:"urls"`
+}
+
+// Webseeds 种子 web seed 管理处理器
+// GET 获取 web seed 列表；POST 添加 urls 中的 web seed；DELETE 移除 url 查询参数指定的 web seed（可重复）
+func (h *TorrentHandler) Webseeds(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
+
+	// 验证InfoHash
+	hashValidator := &validator.InfoHashValidator{}
+	if err := hashValidator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+	infoHash = strings.ToLower(infoHash)
+
+	var webseeds []string
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		var req WebseedsRequest
+		if decodeErr := json.NewDecoder(r.Body).Decode(&req); decodeErr != nil {
+			writeInvalidBody(w, decodeErr)
+			return
+		}
+		webseeds, err = h.torrentService.AddWebseeds(infoHash, req.URLs)
+	case http.MethodDelete:
+		webseeds, err = h.torrentService.RemoveWebseeds(infoHash, r.URL.Query()["url"])
+	default:
+		webseeds, err = h.torrentService.ListWebseeds(infoHash)
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webseeds)
+}
+
+// CreateTorrent 用数据目录下的文件制作种子并开始做种处理器
+// 返回磁力链接和 base64 编码的种子文件
+func (h *TorrentHandler) CreateTorrent(w http.ResponseWriter, r *http.Request) {
+	var req service.CreateTorrentOptions
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	// 计算哈希的时间取决于数据大小，不受服务器写超时限制
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	created, err := h.torrentService.CreateTorrent(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(created)
+}
+
+// WatchedRequest 观看状态请求
+type WatchedRequest struct {
+	Watched bool `json:"watched"`
+}
+
+// SetWatched 标记种子已看完处理器，已看完的种子可被自动清理规则删除
+func (h *TorrentHandler) SetWatched(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
+
+	// 验证InfoHash
+	validator := &validator.InfoHashValidator{}
+	if err := validator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req WatchedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	if err := h.torrentService.SetWatched(strings.ToLower(infoHash), req.Watched); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
+
+// torrentFilter 从 category 和 tag 查询参数构建列表过滤条件
+func torrentFilter(r *http.Request) service.TorrentFilter {
+	query := r.URL.Query()
+	return service.TorrentFilter{
+		Category: strings.TrimSpace(query.Get("category")),
+		Tags:     query["tag"],
+	}
+}
+
+// ownerParam 解析 owner 查询参数（用户ID，me 为当前用户），未指定时返回 nil；无效时写入错误响应并返回 false
+func ownerParam(w http.ResponseWriter, r *http.Request) (*int64, bool) {
+	value := r.URL.Query().Get("owner")
+	if value == "" {
+		return nil, true
+	}
+	owner := currentUserID(r)
+	if value != "me" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			middleware.WriteError(w, middleware.CodeInvalidParameter, "owner参数必须为用户ID或me", http.StatusBadRequest)
+			return nil, false
+		}
+		owner = parsed
+	}
+	return &owner, true
+}
+
+// CategoryRequest 种子分类请求
+type CategoryRequest struct {
+	Category string `json:"category"`
+}
+
+// SetCategory 设置种子分类处理器，空字符串表示取消分类
+func (h *TorrentHandler) SetCategory(w http.ResponseWriter, r *http.Request) {
+	var req CategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	h.updateLabels(w, r, func(infoHash string) (*torrent.TorrentInfo, error) {
+		return h.torrentService.SetCategory(infoHash, req.Category)
+	})
+}
+
+// TagsRequest 种子标签请求
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// Tags 种子标签处理器
+// PUT 替换全部标签；POST 添加 tags 中的标签；DELETE 移除 tag 查询参数指定的标签（可重复）
+func (h *TorrentHandler) Tags(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		tags := r.URL.Query()["tag"]
+		h.updateLabels(w, r, func(infoHash string) (*torrent.TorrentInfo, error) {
+			return h.torrentService.RemoveTags(infoHash, tags)
+		})
+		return
+	}
+
+	var req TagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	h.updateLabels(w, r, func(infoHash string) (*torrent.TorrentInfo, error) {
+		if r.Method == http.MethodPost {
+			return h.torrentService.AddTags(infoHash, req.Tags)
+		}
+		return h.torrentService.SetTags(infoHash, req.Tags)
+	})
+}
+
+// updateLabels 修改种子分类或标签并返回最新的种子信息
+func (h *TorrentHandler) updateLabels(w http.ResponseWriter, r *http.Request, action func(string) (*torrent.TorrentInfo, error)) {
+	infoHash := r.PathValue("infoHash")
+
+	// 验证InfoHash
+	hashValidator := &validator.InfoHashValidator{}
+	if err := hashValidator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	info, err := action(strings.ToLower(infoHash))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// ListLabels 获取所有分类和标签及其种子数处理器
+func (h *TorrentHandler) ListLabels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.torrentService.ListLabels())
+}
+
+// DeleteTorrent 删除种子处理器，deleteData=true 时同时删除已下载的数据，permanent=true 时不经过回收站
+func (h *TorrentHandler) DeleteTorrent(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
+
+	// 验证InfoHash
+	hashValidator := &validator.InfoHashValidator{}
+	if err := hashValidator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	deleteData := r.URL.Query().Get("deleteData") == "true"
+	permanent := r.URL.Query().Get("permanent") == "true"
+	if err := h.torrentService.DeleteTorrent(strings.ToLower(infoHash), deleteData, permanent); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// changeState 执行暂停/恢复等状态操作并返回最新的种子信息
+func (h *TorrentHandler) changeState(w http.ResponseWriter, r *http.Request, action func(string) (*torrent.TorrentInfo, error)) {
+	infoHash := r.PathValue("infoHash")
+
+	// 验证InfoHash
+	validator := &validator.InfoHashValidator{}
+	if err := validator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	info, err := action(strings.ToLower(infoHash))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// maxImportSize 导入请求的最大大小
+const maxImportSize = 256 << 20
+
+// ImportTorrents 从 qBittorrent/Transmission 导入种子处理器
+// multipart 表单：files 为 .torrent/.fastresume/.resume/.json/.zip 文件，savePath 为可选的默认数据目录
+func (h *TorrentHandler) ImportTorrents(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		middleware.WriteError(w, middleware.CodeInvalidBody, "无效的上传数据，请使用multipart/form-data", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var files []importer.File
+	for _, header := range r.MultipartForm.File["files"] {
+		f, err := header.Open()
+		if err != nil {
+			middleware.WriteError(w, middleware.CodeInvalidBody, "读取上传文件失败", http.StatusBadRequest)
+			return
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			middleware.WriteError(w, middleware.CodeInvalidBody, "读取上传文件失败", http.StatusBadRequest)
+			return
+		}
+		files = append(files, importer.File{Name: header.Filename, Data: data})
+	}
+
+	if len(files) == 0 {
+		middleware.WriteError(w, middleware.CodeValidationFailed, "缺少导入文件", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := importer.Parse(files)
+	if err != nil {
+		middleware.WriteError(w, middleware.CodeInvalidBody, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(entries) == 0 {
+		middleware.WriteError(w, middleware.CodeValidationFailed, "未找到可导入的种子", http.StatusBadRequest)
+		return
+	}
+
+	results := h.torrentService.ImportTorrents(r.Context(), entries, r.FormValue("savePath"))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+	})
+}
+
+// Episodes 种子剧集信息处理器
+// GET 获取各文件匹配到的剧集；POST 按请求中的剧集名称（或 tmdbId）查询TMDB并重新匹配
+func (h *TorrentHandler) Episodes(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
+
+	// 验证InfoHash
+	hashValidator := &validator.InfoHashValidator{}
+	if err := hashValidator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+	infoHash = strings.ToLower(infoHash)
+
+	if r.Method != http.MethodPost {
+		episodes, err := h.torrentService.GetEpisodes(infoHash)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(episodes)
+		return
+	}
+
+	var req service.ShowMatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	info, err := h.torrentService.GetTorrent(infoHash)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(info.Files) == 0 {
+		middleware.WriteError(w, middleware.CodeMetadataPending, "种子元数据尚未获取，无法匹配剧集", http.StatusConflict)
+		return
+	}
+
+	match, err := h.searchService.MatchShow(req, info.Files)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.torrentService.SetShowDetails(infoHash, match); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(match)
+}
+
+// Rematch 按TMDB ID或修正后的名称、年份重新匹配种子的电影或剧集详情，覆盖已有详情
+func (h *TorrentHandler) Rematch(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
+
+	// 验证InfoHash
+	hashValidator := &validator.InfoHashValidator{}
+	if err := hashValidator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req service.RematchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	details, err := h.autoMatch.Rematch(strings.ToLower(infoHash), req)
+	if err != nil {
+		if errors.Is(err, service.ErrMetadataPending) {
+			middleware.WriteError(w, middleware.CodeMetadataPending, "种子元数据尚未获取，无法匹配剧集", http.StatusConflict)
+			return
+		}
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(details)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/torrentplayer/backend/service"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// TrashHandler 回收站处理器
+type TrashHandler struct {
+	trashService *service.TrashService
+}
+
+// NewTrashHandler 创建回收站处理器
+func NewTrashHandler(trashService *service.TrashService) *TrashHandler {
+	return &TrashHandler{
+		trashService: trashService,
+	}
+}
+
+// List 列出回收站中的种子
+func (h *TrashHandler) List(w http.ResponseWriter, r *http.Request) {
+	trashed, err := h.trashService.List()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trashed)
+}
+
+// Restore 从回收站恢复种子
+func (h *TrashHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
+
+	hashValidator := &validator.InfoHashValidator{}
+	if err := hashValidator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	info, err := h.trashService.Restore(strings.ToLower(infoHash))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// Purge 立即清除回收站中的种子
+func (h *TrashHandler) Purge(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("infoHash")
+
+	hashValidator := &validator.InfoHashValidator{}
+	if err := hashValidator.ValidateInfoHash(infoHash); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := h.trashService.Purge(strings.ToLower(infoHash)); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// Empty 清空回收站
+func (h *TrashHandler) Empty(w http.ResponseWriter, r *http.Request) {
+	purged, err := h.trashService.Empty()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"purged": purged})
+}
@@ -0,0 +1,300 @@
+// Package importer 解析其他 BitTorrent 客户端（qBittorrent、Transmission）导出的种子数据，
+// 用于迁移到 magnet-player 时保留原有的数据目录
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// 来源客户端
+const (
+	SourceQBittorrent  = "qbittorrent"
+	SourceTransmission = "transmission"
+	SourceTorrentFile  = "torrent"
+	SourceJSON         = "json"
+)
+
+// maxZipEntrySize 压缩包内单个文件的最大解压大小
+const maxZipEntrySize = 64 << 20
+
+var hexHashPattern = regexp.MustCompile(`(?i)^[0-9a-f]{40}$`)
+
+// File 上传的单个文件
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Entry 解析出的待导入种子
+type Entry struct {
+	Source    string             `json:"source"`
+	InfoHash  string             `json:"infoHash"`
+	Name      string             `json:"name"`
+	SavePath  string             `json:"savePath"`
+	MagnetURI string             `json:"magnetUri,omitempty"`
+	MetaInfo  *metainfo.MetaInfo `json:"-"`
+}
+
+// qbtFastresume qBittorrent BT_backup 目录中的 .fastresume 文件（libtorrent 格式）
+type qbtFastresume struct {
+	InfoHash    string `bencode:"info-hash"`
+	SavePath    string `bencode:"save_path"`
+	QbtSavePath string `bencode:"qBt-savePath"`
+	QbtName     string `bencode:"qBt-name"`
+	Name        string `bencode:"name"`
+}
+
+// transmissionResume Transmission resume 目录中的 .resume 文件
+type transmissionResume struct {
+	Destination string `bencode:"destination"`
+	Name        string `bencode:"name"`
+}
+
+// jsonTorrent qBittorrent WebUI (/api/v2/torrents/info) 与 Transmission RPC (torrent-get) 导出字段的并集
+type jsonTorrent struct {
+	Hash        string `json:"hash"`
+	HashString  string `json:"hashString"`
+	Name        string `json:"name"`
+	SavePath    string `json:"save_path"`
+	DownloadDir string `json:"downloadDir"`
+	MagnetURI   string `json:"magnet_uri"`
+	MagnetLink  string `json:"magnetLink"`
+}
+
+// resumeData 从 resume 文件中提取的信息
+type resumeData struct {
+	source   string
+	infoHash string
+	name     string
+	savePath string
+}
+
+// Parse 解析上传的文件（支持 .torrent、.fastresume、.resume、.json 以及包含这些文件的 .zip），
+// 按文件名或 InfoHash 将 resume 数据与 .torrent 文件配对
+func Parse(files []File) ([]Entry, error) {
+	expanded, err := expandZips(files)
+	if err != nil {
+		return nil, err
+	}
+
+	torrentsByStem := make(map[string]*metainfo.MetaInfo)
+	torrentsByHash := make(map[string]*metainfo.MetaInfo)
+	resumesByStem := make(map[string]*resumeData)
+	var jsonEntries []Entry
+
+	for _, f := range expanded {
+		stem := fileStem(f.Name)
+
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".torrent":
+			mi, err := metainfo.Load(bytes.NewReader(f.Data))
+			if err != nil {
+				return nil, fmt.Errorf("解析种子文件 %s 失败: %w", f.Name, err)
+			}
+			torrentsByStem[stem] = mi
+			torrentsByHash[mi.HashInfoBytes().HexString()] = mi
+
+		case ".fastresume":
+			var fr qbtFastresume
+			if err := bencode.Unmarshal(f.Data, &fr); err != nil {
+				return nil, fmt.Errorf("解析 fastresume 文件 %s 失败: %w", f.Name, err)
+			}
+			data := &resumeData{
+				source:   SourceQBittorrent,
+				infoHash: hex.EncodeToString([]byte(fr.InfoHash)),
+				name:     firstNonEmpty(fr.QbtName, fr.Name),
+				savePath: firstNonEmpty(fr.QbtSavePath, fr.SavePath),
+			}
+			if len(fr.InfoHash) != 20 {
+				data.infoHash = hashFromStem(stem)
+			}
+			resumesByStem[stem] = data
+
+		case ".resume":
+			var tr transmissionResume
+			if err := bencode.Unmarshal(f.Data, &tr); err != nil {
+				return nil, fmt.Errorf("解析 resume 文件 %s 失败: %w", f.Name, err)
+			}
+			resumesByStem[stem] = &resumeData{
+				source:   SourceTransmission,
+				infoHash: hashFromStem(stem),
+				name:     tr.Name,
+				savePath: tr.Destination,
+			}
+
+		case ".json":
+			entries, err := parseJSON(f.Data)
+			if err != nil {
+				return nil, fmt.Errorf("解析 JSON 文件 %s 失败: %w", f.Name, err)
+			}
+			jsonEntries = append(jsonEntries, entries...)
+		}
+	}
+
+	var entries []Entry
+	seen := make(map[string]bool)
+	add := func(e Entry) {
+		if e.InfoHash == "" || seen[e.InfoHash] {
+			return
+		}
+		seen[e.InfoHash] = true
+		entries = append(entries, e)
+	}
+
+	stems := make([]string, 0, len(resumesByStem))
+	for stem := range resumesByStem {
+		stems = append(stems, stem)
+	}
+	sort.Strings(stems)
+
+	for _, stem := range stems {
+		data := resumesByStem[stem]
+		mi := torrentsByStem[stem]
+		if mi == nil && data.infoHash != "" {
+			mi = torrentsByHash[data.infoHash]
+		}
+
+		entry := Entry{Source: data.source, InfoHash: data.infoHash, Name: data.name, SavePath: data.savePath}
+		if mi != nil {
+			entry.MetaInfo = mi
+			entry.InfoHash = mi.HashInfoBytes().HexString()
+		} else if entry.InfoHash != "" {
+			// 没有对应的 .torrent 文件时退化为磁力链接，元数据需从 peer 获取
+			entry.MagnetURI = "magnet:?xt=urn:btih:" + entry.InfoHash
+		}
+		add(entry)
+	}
+
+	for _, e := range jsonEntries {
+		if mi := torrentsByHash[e.InfoHash]; mi != nil {
+			e.MetaInfo = mi
+		}
+		add(e)
+	}
+
+	// 没有 resume 数据的 .torrent 文件使用默认数据目录
+	for hash, mi := range torrentsByHash {
+		add(Entry{Source: SourceTorrentFile, InfoHash: hash, MetaInfo: mi})
+	}
+
+	for i := range entries {
+		if entries[i].Name == "" && entries[i].MetaInfo != nil {
+			if info, err := entries[i].MetaInfo.UnmarshalInfo(); err == nil {
+				entries[i].Name = info.BestName()
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// parseJSON 支持数组、{"torrents": [...]} 以及 Transmission RPC 的 {"arguments": {"torrents": [...]}}
+func parseJSON(data []byte) ([]Entry, error) {
+	var list []jsonTorrent
+	if err := json.Unmarshal(data, &list); err != nil {
+		var wrapped struct {
+			Torrents  []jsonTorrent `json:"torrents"`
+			Arguments struct {
+				Torrents []jsonTorrent `json:"torrents"`
+			} `json:"arguments"`
+		}
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return nil, err
+		}
+		list = append(wrapped.Torrents, wrapped.Arguments.Torrents...)
+	}
+
+	entries := make([]Entry, 0, len(list))
+	for _, t := range list {
+		hash := strings.ToLower(firstNonEmpty(t.Hash, t.HashString))
+		if !hexHashPattern.MatchString(hash) {
+			continue
+		}
+
+		source := SourceQBittorrent
+		if t.HashString != "" {
+			source = SourceTransmission
+		}
+
+		entries = append(entries, Entry{
+			Source:    source,
+			InfoHash:  hash,
+			Name:      t.Name,
+			SavePath:  firstNonEmpty(t.SavePath, t.DownloadDir),
+			MagnetURI: firstNonEmpty(t.MagnetURI, t.MagnetLink, "magnet:?xt=urn:btih:"+hash),
+		})
+	}
+	return entries, nil
+}
+
+// expandZips 展开上传的 zip 压缩包，其余文件原样返回
+func expandZips(files []File) ([]File, error) {
+	var expanded []File
+	for _, f := range files {
+		if strings.ToLower(path.Ext(f.Name)) != ".zip" {
+			expanded = append(expanded, f)
+			continue
+		}
+
+		zr, err := zip.NewReader(bytes.NewReader(f.Data), int64(len(f.Data)))
+		if err != nil {
+			return nil, fmt.Errorf("解析压缩包 %s 失败: %w", f.Name, err)
+		}
+
+		for _, zf := range zr.File {
+			if zf.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return nil, fmt.Errorf("读取压缩包文件 %s 失败: %w", zf.Name, err)
+			}
+			data, err := io.ReadAll(io.LimitReader(rc, maxZipEntrySize+1))
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("读取压缩包文件 %s 失败: %w", zf.Name, err)
+			}
+			if len(data) > maxZipEntrySize {
+				return nil, fmt.Errorf("压缩包文件 %s 过大", zf.Name)
+			}
+			expanded = append(expanded, File{Name: zf.Name, Data: data})
+		}
+	}
+	return expanded, nil
+}
+
+// fileStem 去掉目录和扩展名后的文件名
+func fileStem(name string) string {
+	base := path.Base(strings.ReplaceAll(name, "\\", "/"))
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// hashFromStem 从文件名中提取40位十六进制 InfoHash（qBittorrent 与 Transmission 4.x 的命名方式）
+func hashFromStem(stem string) string {
+	if hexHashPattern.MatchString(stem) {
+		return strings.ToLower(stem)
+	}
+	return ""
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -1,3 +1,8 @@
+//go:build ignore
+
+// Legacy server entry point, run with `go run main.go`.
+// The layered server lives in main_new.go.
+
 package main
 
 import (
@@ -6,11 +11,14 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/torrentplayer/backend/api"
 	searchhandle "github.com/torrentplayer/backend/api/search"
 	"github.com/torrentplayer/backend/backend"
+	"github.com/torrentplayer/backend/config"
 	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/middleware"
 	"github.com/torrentplayer/backend/torrent"
 )
 
@@ -25,16 +33,25 @@ func main() {
 		log.Fatalf("Failed to create data directory: %v", err)
 	}
 
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
 	// Initialize torrent client
-	torrentClient, err := torrent.NewClient(dataDir)
+	torrentClient, err := torrent.NewClientWithOptions(dataDir, torrent.ClientOptions{
+		PortForwarding:  true,
+		MetadataTimeout: time.Duration(cfg.Torrent.MetadataTimeoutSec) * time.Second,
+	})
 	if err != nil {
 		log.Fatalf("Failed to create torrent client: %v", err)
 	}
 	defer torrentClient.Close()
+	torrentClient.SetPublicTrackers(config.DefaultPublicTrackers)
 
 	// Initialize torrent store for database operations
 	dbPath := filepath.Join(dataDir, "torrents.db")
-	torrentStore, err := db.NewTorrentStore(dbPath)
+	torrentStore, err := db.NewTorrentStoreWithPath(dbPath)
 	if err != nil {
 		log.Fatalf("Failed to create torrent store: %v", err)
 	}
@@ -74,24 +91,18 @@ func main() {
 	// 保存files 下载进度
 	http.HandleFunc("/magnet/api/torrents/save-data/", apiHandler.SaveTorrentData)
 
-	// Enable CORS
-	http.HandleFunc("/magnet/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		http.Error(w, "Not found", http.StatusNotFound)
-	})
+	// CORS is handled by the same middleware as the layered server; the
+	// legacy server keeps allowing any origin unless CORS_ALLOWED_ORIGINS is set
+	corsConfig := middleware.DefaultCORSConfig()
+	corsConfig.AllowedOrigins = []string{"*"}
+	if origins := config.ParseList(os.Getenv("CORS_ALLOWED_ORIGINS")); len(origins) > 0 {
+		corsConfig.AllowedOrigins = origins
+	}
 
 	// Start server
 	port := "8080"
 	log.Printf("Starting server on port %s...", port)
-	if err := http.ListenAndServe("localhost:"+port, nil); err != nil {
+	if err := http.ListenAndServe("localhost:"+port, middleware.CORS(corsConfig)(http.DefaultServeMux)); err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
 }
@@ -2,19 +2,31 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/torrentplayer/backend/config"
 	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/dlna"
+	"github.com/torrentplayer/backend/events"
+	"github.com/torrentplayer/backend/grpcapi"
 	"github.com/torrentplayer/backend/handlers"
+	"github.com/torrentplayer/backend/logging"
 	"github.com/torrentplayer/backend/middleware"
 	"github.com/torrentplayer/backend/service"
 	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/web"
+	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc"
 )
 
 // Application represents the main application structure
@@ -23,9 +35,33 @@ type Application struct {
 	dbManager      *db.DatabaseManager
 	torrentClient  *torrent.Client
 	torrentStore   *db.TorrentStore
+	userStore      *db.UserStore
 	torrentService *service.TorrentService
 	searchService  *service.SearchService
+	images         *service.ImageCache
+	authService    *service.AuthService
+	prefsService   *service.PreferencesService
+	playback       *service.PlaybackService
+	library        *service.LibraryService
+	bus            *events.Bus
+	stateMachine   *service.StateMachine
+	metadataQueue  *service.MetadataQueue
+	seedingPolicy  *service.SeedingPolicy
+	postProcessor  *service.PostProcessor
+	organizer      *service.Organizer
+	retention      *service.RetentionService
+	trash          *service.TrashService
+	statsHistory   *service.StatsHistoryService
+	analytics      *service.StreamAnalyticsService
+	trackerList    *service.TrackerListUpdater
+	rss            *service.RSSService
+	indexer        *service.IndexerService
+	settings       *service.SettingsService
+	autoMatch      *service.AutoMatchService
 	server         *http.Server
+	httpServer     *http.Server // plain HTTP next to HTTPS, see setupTLS
+	grpcServer     *grpc.Server
+	dlna           *dlna.Server
 }
 
 // NewApplication creates a new application instance with all dependencies
@@ -36,6 +72,8 @@ func NewApplication() (*Application, error) {
 		return nil, err
 	}
 
+	logging.Setup(cfg.Log.Format, cfg.Log.Level)
+
 	log.Printf("Starting Magnet Player Server (Environment: %s)", cfg.Server.Env)
 
 	// Initialize database manager
@@ -48,13 +86,42 @@ func NewApplication() (*Application, error) {
 		return nil, err
 	}
 
+	// Settings saved through the API override the environment. Some of them
+	// are only read when the torrent client is created.
+	settingsStore := db.NewSettingsStore(dbManager)
+	settings := service.LoadSettings(settingsStore, cfg)
+
 	// Initialize torrent client
-	torrentClient, err := torrent.NewClient(cfg.Torrent.DataDir)
+	torrentClient, err := torrent.NewClientWithOptions(cfg.Torrent.DataDir, torrent.ClientOptions{
+		ListenPort:     cfg.Torrent.ListenPort,
+		PortForwarding: cfg.Torrent.PortForwarding,
+		ListenAddrs:    cfg.Torrent.ListenIPs(),
+		BindInterface:  cfg.Torrent.BindInterface,
+		DisableIPv6:    !cfg.Torrent.EnableIPv6,
+		Transport:      settings.Transport.Options(),
+		Peers:          settings.Peers.Options(),
+		WebRTC: torrent.WebRTCOptions{
+			ICEServers: cfg.Torrent.ICEServers,
+			Username:   cfg.Torrent.ICEUsername,
+			Credential: cfg.Torrent.ICECredential,
+		},
+		Readahead: torrent.ReadaheadOptions{
+			Duration:  time.Duration(cfg.Torrent.ReadaheadSeconds) * time.Second,
+			Min:       int64(cfg.Torrent.ReadaheadMinMB) << 20,
+			Max:       int64(cfg.Torrent.ReadaheadMaxMB) << 20,
+			EdgeBytes: int64(cfg.Torrent.PrebufferMB) << 20,
+		},
+		FailureRetries:  cfg.Torrent.FailureRetries,
+		MetadataTimeout: time.Duration(cfg.Torrent.MetadataTimeoutSec) * time.Second,
+	})
 	if err != nil {
 		dbManager.Close()
 		return nil, err
 	}
 
+	// Public trackers come from the config and, optionally, a remote list
+	trackerList := service.NewTrackerListUpdater(torrentClient, cfg)
+
 	// Initialize torrent store
 	torrentStore, err := db.NewTorrentStore(dbManager)
 	if err != nil {
@@ -63,117 +130,512 @@ func NewApplication() (*Application, error) {
 		return nil, err
 	}
 
+	userStore := db.NewUserStore(dbManager)
+	prefsStore := db.NewPreferencesStore(dbManager)
+	apiKeyStore := db.NewAPIKeyStore(dbManager)
+
+	// Torrent state changes and background metadata fetching publish to the event bus
+	bus := events.NewBus()
+	stateMachine := service.NewStateMachine(torrentClient, torrentStore, bus)
+	// Completion notifications must be handled before any torrent is restored
+	torrentClient.SetCompletionHandler(stateMachine.HandleCompletion)
+	torrentClient.SetFailureHandler(stateMachine.HandleFailure)
+	stateMachine.Start()
+	metadataQueue := service.NewMetadataQueue(torrentClient, torrentStore, stateMachine, bus, cfg)
+	metadataQueue.Start()
+	seedingPolicy := service.NewSeedingPolicy(torrentClient, db.NewSeedingStore(dbManager), stateMachine, cfg)
+	// Post-processing subscribes to completions before torrents are restored
+	postProcessor := service.NewPostProcessor(torrentClient, torrentStore, db.NewPostProcessStore(dbManager), bus, cfg)
+	postProcessor.Start()
+	episodeStore := db.NewEpisodeStore(dbManager)
+	// The organizer is started once torrents are restored, so the scan queued
+	// when its settings are applied can see their files
+	organizer := service.NewOrganizer(torrentClient, torrentStore, episodeStore, db.NewLibraryLinkStore(dbManager), bus)
+
 	// Initialize services
-	torrentService := service.NewTorrentService(torrentClient, torrentStore, cfg)
+	torrentService := service.NewTorrentService(torrentClient, torrentStore, db.NewTrackerStore(dbManager), db.NewWebseedStore(dbManager), db.NewConnectionStore(dbManager), episodeStore, db.NewCollectionStore(dbManager), stateMachine, metadataQueue, seedingPolicy, postProcessor, organizer, bus, cfg)
+	seedingPolicy.Start(torrentService)
+	retentionService := service.NewRetentionService(torrentService, torrentStore, cfg)
+	trashService := service.NewTrashService(torrentService, torrentStore)
+	statsHistory := service.NewStatsHistoryService(torrentClient, db.NewStatsStore(dbManager))
+	// Ended stream sessions are logged for the per-title analytics
+	analytics := service.NewStreamAnalyticsService(db.NewStreamLogStore(dbManager), torrentStore, torrentService.Sessions())
+	torrentService.Sessions().SetEndHandler(analytics.RecordSession)
+	rssService := service.NewRSSService(db.NewRSSStore(dbManager), torrentService)
+	indexerService := service.NewIndexerService(torrentService, cfg)
 	searchService := service.NewSearchService(cfg)
+	images := service.NewImageCache(torrentStore, cfg)
+	prefsService := service.NewPreferencesService(prefsStore)
+	// Runtime settings are applied before torrents are restored
+	settingsService := service.NewSettingsService(settingsStore, torrentClient, seedingPolicy, trackerList, prefsService, organizer, settings)
+	playbackStore := db.NewPlaybackStore(dbManager)
+	playbackService := service.NewPlaybackService(playbackStore, torrentService)
+	libraryService := service.NewLibraryService(torrentService, playbackStore, userStore)
+	authService, err := service.NewAuthService(userStore, apiKeyStore, cfg)
+	if err != nil {
+		postProcessor.Stop()
+		seedingPolicy.Stop()
+		metadataQueue.Stop()
+		stateMachine.Stop()
+		torrentClient.Close()
+		dbManager.Close()
+		return nil, err
+	}
+
+	// Create the initial admin account on first start
+	if cfg.Auth.Enabled {
+		if err := authService.EnsureAdminUser(); err != nil {
+			log.Printf("Warning: Failed to create admin user: %v", err)
+		}
+	}
+
+	// Subscribe before restoring so torrents whose metadata arrives during restore are matched too
+	autoMatch := service.NewAutoMatchService(torrentService, torrentStore, searchService, bus, cfg.API.AutoMatch)
+	autoMatch.Start()
 
 	// Restore torrents from database
 	if err := torrentService.RestoreTorrentsFromDB(); err != nil {
 		log.Printf("Warning: Failed to restore torrents from database: %v", err)
 	}
+	organizer.Start()
+	retentionService.Start()
+	trashService.Start()
+	statsHistory.Start()
+	trackerList.Start()
+	rssService.Start()
 
 	app := &Application{
 		config:         cfg,
 		dbManager:      dbManager,
 		torrentClient:  torrentClient,
 		torrentStore:   torrentStore,
+		userStore:      userStore,
 		torrentService: torrentService,
 		searchService:  searchService,
+		images:         images,
+		authService:    authService,
+		prefsService:   prefsService,
+		playback:       playbackService,
+		library:        libraryService,
+		bus:            bus,
+		stateMachine:   stateMachine,
+		metadataQueue:  metadataQueue,
+		seedingPolicy:  seedingPolicy,
+		postProcessor:  postProcessor,
+		organizer:      organizer,
+		retention:      retentionService,
+		trash:          trashService,
+		statsHistory:   statsHistory,
+		analytics:      analytics,
+		trackerList:    trackerList,
+		rss:            rssService,
+		indexer:        indexerService,
+		settings:       settingsService,
+		autoMatch:      autoMatch,
 	}
 
 	// Setup HTTP server
-	app.setupServer()
+	if err := app.setupServer(); err != nil {
+		return nil, err
+	}
 
 	return app, nil
 }
 
 // setupServer configures the HTTP server with middleware and routes
-func (app *Application) setupServer() {
+func (app *Application) setupServer() error {
 	// Create handlers
-	torrentHandler := handlers.NewTorrentHandler(app.torrentService, app.searchService)
-	streamHandler := handlers.NewStreamHandler(app.torrentService)
+	torrentHandler := handlers.NewTorrentHandler(app.torrentService, app.searchService, app.autoMatch, app.bus)
+	streamHandler := handlers.NewStreamHandler(app.torrentService, app.prefsService)
+	downloadHandler := handlers.NewDownloadHandler(app.torrentService, app.config.Torrent.DownloadCompleteOnly)
 	searchHandler := handlers.NewSearchHandler(app.searchService)
-
-	// Setup router with middleware
-	mux := http.NewServeMux()
+	authHandler := handlers.NewAuthHandler(app.authService)
+	preferencesHandler := handlers.NewPreferencesHandler(app.prefsService)
+	playbackHandler := handlers.NewPlaybackHandler(app.playback)
+	libraryHandler := handlers.NewLibraryHandler(app.library)
+	eventsHandler := handlers.NewEventsHandler(app.bus, app.torrentService)
+	retentionHandler := handlers.NewRetentionHandler(app.retention)
+	trashHandler := handlers.NewTrashHandler(app.trash)
+	statsHandler := handlers.NewStatsHandler(app.statsHistory)
+	analyticsHandler := handlers.NewAnalyticsHandler(app.analytics)
+	rssHandler := handlers.NewRSSHandler(app.rss)
+	imageHandler := handlers.NewImageHandler(app.images)
+	indexerHandler := handlers.NewIndexerHandler(app.indexer, app.autoMatch)
+	settingsHandler := handlers.NewSettingsHandler(app.settings)
+	openAPIHandler, err := handlers.NewOpenAPIHandler(app.config.Server.BasePath)
+	if err != nil {
+		return err
+	}
 
 	// Apply middleware
 	corsConfig := middleware.DefaultCORSConfig()
-	if app.config.IsDevelopment() {
-		// Allow all origins in development
-		corsConfig.AllowedOrigins = []string{"*"}
+	if origins := app.config.CORSOrigins(); origins != nil {
+		corsConfig.AllowedOrigins = origins
 	}
 
 	// Create middleware chain
 	chain := middleware.CORS(corsConfig)
 	logger := middleware.Logger
 	errorHandler := middleware.ErrorHandler
+	requireAuth := middleware.RequireAuth(app.authService)
+	optionalAuth := middleware.OptionalAuth(app.authService)
+	// 观众只能浏览和播放，添加、删除和管理种子需要管理员
+	requireAdmin := middleware.RequireAdmin(app.authService)
+	admin := func(next http.HandlerFunc) http.HandlerFunc {
+		return requireAuth(requireAdmin(next))
+	}
+	jsonBody := middleware.ValidateJSONBody(64 * 1024)
+
+	// 所有接口位于 {BASE_PATH}/api/v1 下（默认 /magnet/api/v1），旧路径作为别名保留；新增路由时需同步更新 handlers.APIOperations
+	base := app.config.Server.BasePath
+	router := handlers.NewRouter()
+	v1 := router.Group(base+handlers.APIPath, base+"/api")
+
+	// 认证与用户
+	v1.Handle("POST", "/auth/login", jsonBody(authHandler.Login)).Legacy()
+	v1.Handle("GET", "/auth/me", requireAuth(authHandler.Me)).Legacy()
+	v1.Handle("GET", "/auth/api-keys", requireAuth(authHandler.APIKeys)).Legacy()
+	v1.Handle("POST", "/auth/api-keys", requireAuth(jsonBody(authHandler.APIKeys))).Legacy()
+	v1.Handle("DELETE", "/auth/api-keys/{id}", requireAuth(authHandler.DeleteAPIKey)).Legacy()
+	v1.Handle("GET", "/users", admin(authHandler.Users)).Legacy()
+	v1.Handle("POST", "/users", admin(jsonBody(authHandler.Users))).Legacy()
+	v1.Handle("PUT", "/users/{id}", admin(jsonBody(authHandler.User))).Legacy()
+	v1.Handle("DELETE", "/users/{id}", admin(authHandler.User)).Legacy()
+
+	// 播放
+	v1.Handle("GET", "/preferences", requireAuth(preferencesHandler.Preferences)).Legacy()
+	v1.Handle("PUT", "/preferences", requireAuth(jsonBody(preferencesHandler.Preferences))).Legacy()
+	v1.Handle("GET", "/continue-watching", requireAuth(playbackHandler.ContinueWatching)).Legacy()
+	v1.Handle("GET", "/torrents/{infoHash}/playback", requireAuth(playbackHandler.Positions)).Legacy()
+	v1.Handle("PUT", "/torrents/{infoHash}/playback", requireAuth(jsonBody(playbackHandler.Positions))).Legacy()
+	v1.Handle("DELETE", "/torrents/{infoHash}/playback", requireAuth(playbackHandler.Positions)).Legacy()
+	v1.Handle("GET", "/stream/{infoHash}/{fileName...}", optionalAuth(streamHandler.StreamFile)).
+		Alias(base + "/stream/{infoHash}/{fileName...}")
+	v1.Handle("GET", "/buffer/{infoHash}/{fileIndex}", optionalAuth(streamHandler.Buffer)).Legacy()
+	v1.Handle("GET", "/sessions", admin(streamHandler.Sessions)).Legacy()
+	v1.Handle("PUT", "/sessions/{id}/rate-limit", admin(jsonBody(streamHandler.RateLimit))).Legacy()
+	v1.Handle("DELETE", "/sessions/{id}/rate-limit", admin(streamHandler.RateLimit)).Legacy()
+	// 下载与播放一样可以通过 token 查询参数认证，<a> 标签无法设置请求头
+	v1.Handle("GET", "/torrents/{infoHash}/download", optionalAuth(downloadHandler.Archive)).Legacy()
+	v1.Handle("GET", "/download/{infoHash}/{fileIndex}", optionalAuth(downloadHandler.File)).
+		Alias(base + "/download/{infoHash}/{fileIndex}")
+
+	// 种子
+	v1.Handle("POST", "/torrents", admin(middleware.ValidateJSONBody(1024*1024)(torrentHandler.AddMagnet))).
+		Alias(base + "/api/magnet")
+	v1.Handle("GET", "/torrents", optionalAuth(torrentHandler.ListTorrents)).Legacy()
+	v1.Handle("POST", "/torrents/import", admin(torrentHandler.ImportTorrents)).Legacy()
+	v1.Handle("POST", "/create-torrent", admin(jsonBody(torrentHandler.CreateTorrent))).Legacy()
+	v1.Handle("DELETE", "/torrents/{infoHash}", admin(torrentHandler.DeleteTorrent)).Legacy()
+	v1.Handle("GET", "/trash", admin(trashHandler.List)).Legacy()
+	v1.Handle("DELETE", "/trash", admin(trashHandler.Empty)).Legacy()
+	v1.Handle("POST", "/trash/{infoHash}/restore", admin(trashHandler.Restore)).Legacy()
+	v1.Handle("DELETE", "/trash/{infoHash}", admin(trashHandler.Purge)).Legacy()
+	v1.Handle("GET", "/torrents/{infoHash}/diagnostics", requireAuth(torrentHandler.Diagnostics)).Legacy()
+	v1.Handle("GET", "/torrents/{infoHash}/pieces", optionalAuth(torrentHandler.Pieces)).Legacy()
+	v1.Handle("POST", "/torrents/{infoHash}/pause", admin(torrentHandler.PauseTorrent)).Legacy()
+	v1.Handle("POST", "/torrents/{infoHash}/resume", admin(torrentHandler.ResumeTorrent)).Legacy()
+	v1.Handle("POST", "/torrents/{infoHash}/save-data", admin(middleware.ValidateJSONBody(2*1024*1024)(torrentHandler.SaveTorrentData))).
+		Alias(base + "/api/torrents/save-data/{infoHash}")
+	v1.Handle("GET", "/torrents/{infoHash}/seeding", requireAuth(torrentHandler.Seeding)).Legacy()
+	v1.Handle("PUT", "/torrents/{infoHash}/seeding", admin(jsonBody(torrentHandler.Seeding))).Legacy()
+	v1.Handle("GET", "/torrents/{infoHash}/connections", requireAuth(torrentHandler.Connections)).Legacy()
+	v1.Handle("PUT", "/torrents/{infoHash}/connections", admin(jsonBody(torrentHandler.Connections))).Legacy()
+	v1.Handle("GET", "/torrents/{infoHash}/trackers", requireAuth(torrentHandler.Trackers)).Legacy()
+	v1.Handle("POST", "/torrents/{infoHash}/trackers", admin(jsonBody(torrentHandler.Trackers))).Legacy()
+	v1.Handle("DELETE", "/torrents/{infoHash}/trackers", admin(torrentHandler.Trackers)).Legacy()
+	v1.Handle("GET", "/torrents/{infoHash}/webseeds", requireAuth(torrentHandler.Webseeds)).Legacy()
+	v1.Handle("POST", "/torrents/{infoHash}/webseeds", admin(jsonBody(torrentHandler.Webseeds))).Legacy()
+	v1.Handle("DELETE", "/torrents/{infoHash}/webseeds", admin(torrentHandler.Webseeds)).Legacy()
+	v1.Handle("PUT", "/torrents/{infoHash}/watched", admin(jsonBody(torrentHandler.SetWatched))).Legacy()
+	v1.Handle("GET", "/network/check", admin(torrentHandler.NetworkCheck)).Legacy()
+	v1.Handle("GET", "/stats/history", requireAuth(statsHandler.History)).Legacy()
+	v1.Handle("GET", "/analytics/titles", admin(analyticsHandler.Titles)).Legacy()
+	v1.Handle("GET", "/events", optionalAuth(eventsHandler.Stream)).Legacy()
+
+	// 分类和标签
+	v1.Handle("PUT", "/torrents/{infoHash}/category", admin(jsonBody(torrentHandler.SetCategory))).Legacy()
+	v1.Handle("PUT", "/torrents/{infoHash}/tags", admin(jsonBody(torrentHandler.Tags))).Legacy()
+	v1.Handle("POST", "/torrents/{infoHash}/tags", admin(jsonBody(torrentHandler.Tags))).Legacy()
+	v1.Handle("DELETE", "/torrents/{infoHash}/tags", admin(torrentHandler.Tags)).Legacy()
+	v1.Handle("GET", "/labels", requireAuth(torrentHandler.ListLabels)).Legacy()
+
+	// 媒体库，列表和图片无需登录，<img> 标签无法设置请求头
+	v1.Handle("GET", "/movie-details", torrentHandler.GetMovieDetails).
+		Alias(base + "/api/get-movie-details")
+	v1.Handle("POST", "/torrents/{infoHash}/movie-details", admin(middleware.ValidateJSONBody(1024*1024)(torrentHandler.UpdateMovieDetails))).
+		Alias(base + "/api/movie-details/{infoHash}")
+	v1.Handle("GET", "/collections", torrentHandler.ListCollections).Legacy()
+	v1.Handle("GET", "/images/{tmdbId}/{type}", imageHandler.GetImage).Legacy()
+	v1.Handle("GET", "/torrents/{infoHash}/episodes", requireAuth(torrentHandler.Episodes)).Legacy()
+	v1.Handle("POST", "/torrents/{infoHash}/episodes", admin(jsonBody(torrentHandler.Episodes))).Legacy()
+	v1.Handle("POST", "/torrents/{infoHash}/rematch", admin(jsonBody(torrentHandler.Rematch))).Legacy()
+	v1.Handle("GET", "/library/export", admin(libraryHandler.Export)).Legacy()
+	// 导出文档包含每个种子的元数据，体积可能较大
+	v1.Handle("POST", "/library/import", admin(middleware.ValidateJSONBody(256*1024*1024)(libraryHandler.Import))).Legacy()
+	v1.Handle("GET", "/search/movie", middleware.ValidateQueryParams(map[string]bool{
+		"filename": true,
+	})(searchHandler.SearchMovie)).Alias(base + "/search")
+	v1.Handle("GET", "/search/tv", middleware.ValidateQueryParams(map[string]bool{
+		"name": true,
+		"year": true,
+	})(searchHandler.SearchShow)).Alias(base + "/search/tv")
+
+	// 自动化
+	v1.Handle("GET", "/retention/preview", admin(retentionHandler.Preview)).Legacy()
+	v1.Handle("POST", "/retention/run", admin(retentionHandler.Run)).Legacy()
+	v1.Handle("GET", "/rss/feeds", requireAuth(rssHandler.Feeds)).Legacy()
+	v1.Handle("POST", "/rss/feeds", admin(jsonBody(rssHandler.Feeds))).Legacy()
+	v1.Handle("PUT", "/rss/feeds/{id}", admin(jsonBody(rssHandler.Feed))).Legacy()
+	v1.Handle("DELETE", "/rss/feeds/{id}", admin(rssHandler.Feed)).Legacy()
+	v1.Handle("POST", "/rss/feeds/{id}/check", admin(rssHandler.CheckFeed)).Legacy()
+	v1.Handle("GET", "/rss/items", requireAuth(rssHandler.Items)).Legacy()
+	// 索引器搜索结果用于添加种子，与添加种子一样需要管理员
+	v1.Handle("GET", "/indexer/search", admin(indexerHandler.Search)).Legacy()
+	v1.Handle("POST", "/indexer/add", admin(jsonBody(indexerHandler.Add))).Legacy()
+
+	// 设置与文档
+	v1.Handle("GET", "/settings", admin(settingsHandler.Settings)).Legacy()
+	v1.Handle("PATCH", "/settings", admin(jsonBody(settingsHandler.Settings))).Legacy()
+	v1.Handle("GET", "/openapi.json", openAPIHandler.Spec).Legacy()
+	v1.Handle("GET", "/docs", openAPIHandler.Docs).Legacy()
+
+	// DLNA 客户端无法认证，设备描述和媒体文件位于 /dlna 下且不经过认证
+	if app.config.DLNA.Enabled {
+		// HTTPS 下电视通过 TLS_HTTP_PORT 以 HTTP 访问
+		port, _ := strconv.Atoi(app.config.Server.Port)
+		if app.config.Server.TLS.Enabled() {
+			port, _ = strconv.Atoi(app.config.Server.TLS.HTTPPort)
+		}
+		app.dlna = dlna.NewServer(app.torrentService, app.bus, app.config.DLNA.FriendlyName, port)
+		app.dlna.Register(router)
+	}
 
-	// Register routes with middleware
-	mux.HandleFunc("/magnet/api/magnet", 
-		chain(logger(errorHandler(
-			middleware.ValidateMethod("POST", "OPTIONS")(
-				middleware.ValidateJSONBody(1024*1024)(
-					torrentHandler.AddMagnet))))).ServeHTTP)
-
-	mux.HandleFunc("/magnet/api/torrents", 
-		chain(logger(errorHandler(
-			middleware.ValidateMethod("GET", "OPTIONS")(
-				torrentHandler.ListTorrents)))).ServeHTTP)
-
-	mux.HandleFunc("/magnet/api/movie-details/", 
-		chain(logger(errorHandler(
-			middleware.ValidateMethod("POST", "OPTIONS")(
-				middleware.ValidateJSONBody(1024*1024)(
-					torrentHandler.UpdateMovieDetails))))).ServeHTTP)
-
-	mux.HandleFunc("/magnet/api/get-movie-details", 
-		chain(logger(errorHandler(
-			middleware.ValidateMethod("GET", "OPTIONS")(
-				torrentHandler.GetMovieDetails)))).ServeHTTP)
-
-	mux.HandleFunc("/magnet/api/torrents/save-data/", 
-		chain(logger(errorHandler(
-			middleware.ValidateMethod("POST", "OPTIONS")(
-				middleware.ValidateJSONBody(2*1024*1024)(
-					torrentHandler.SaveTorrentData))))).ServeHTTP)
-
-	mux.HandleFunc("/magnet/stream/", 
-		chain(logger(errorHandler(
-			middleware.ValidateMethod("GET", "OPTIONS")(
-				streamHandler.StreamFile)))).ServeHTTP)
-
-	mux.HandleFunc("/magnet/search", 
-		chain(logger(errorHandler(
-			middleware.ValidateMethod("GET", "OPTIONS")(
-				middleware.ValidateQueryParams(map[string]bool{
-					"filename": true,
-				})(searchHandler.SearchMovie))))).ServeHTTP)
+	// 其余 GET 请求返回前端页面，接口和 DLNA 路径下不存在的地址仍返回 JSON 格式的404
+	if app.config.Web.Enabled {
+		if err := app.setupWeb(router); err != nil {
+			return err
+		}
+	}
 
 	// Setup server
 	app.server = &http.Server{
 		Addr:         app.config.GetServerAddress(),
-		Handler:      mux,
+		Handler:      chain(logger(errorHandler(router.ServeHTTP))),
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
+	if app.config.Server.TLS.Enabled() {
+		app.setupTLS()
+	}
+
+	// gRPC 接口与 HTTP 接口共用服务层和认证规则，未配置端口时不启动
+	if app.config.Server.GRPCPort != "" {
+		authenticator := grpcapi.NewAuthenticator(app.authService)
+		app.grpcServer = grpc.NewServer(
+			grpc.ChainUnaryInterceptor(authenticator.UnaryInterceptor()),
+			grpc.ChainStreamInterceptor(authenticator.StreamInterceptor()),
+		)
+		grpcapi.NewServer(app.torrentService, app.autoMatch, app.bus).Register(app.grpcServer)
+	}
+	return nil
+}
+
+// setupWeb serves the web frontend from WEB_DIR, or from the build compiled
+// into the binary, at the site root
+func (app *Application) setupWeb(router *handlers.Router) error {
+	var files fs.FS
+	if app.config.Web.Dir != "" {
+		dir, err := web.Dir(app.config.Web.Dir)
+		if err != nil {
+			return fmt.Errorf("failed to open web frontend in %s: %w", app.config.Web.Dir, err)
+		}
+		files = dir
+		log.Printf("Serving web frontend from %s", app.config.Web.Dir)
+	} else {
+		embedded, ok := web.Embedded()
+		if !ok {
+			log.Printf("No web frontend compiled in; set WEB_DIR to serve one")
+			return nil
+		}
+		files = embedded
+		log.Printf("Serving embedded web frontend")
+	}
+	base := app.config.Server.BasePath
+	router.NotFound = web.NewHandler(files, base, base+"/api", base+"/stream", base+"/download", "/dlna").ServeHTTP
+	return nil
+}
+
+// setupTLS serves HTTPS with the configured certificate or with certificates
+// from Let's Encrypt, and sets up the plain HTTP listener on TLS_HTTP_PORT.
+// That listener answers ACME HTTP-01 challenges, keeps serving DLNA, which
+// TVs only speak over HTTP, and redirects everything else to HTTPS.
+func (app *Application) setupTLS() {
+	tlsConfig := app.config.Server.TLS
+	var fallback http.Handler = http.HandlerFunc(app.redirectToHTTPS)
+
+	if len(tlsConfig.AutocertDomains) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(tlsConfig.AutocertDomains...),
+			Cache:      autocert.DirCache(tlsConfig.AutocertDir),
+			Email:      tlsConfig.AutocertEmail,
+		}
+		// TLSConfig also answers TLS-ALPN-01 challenges, which need port 443
+		app.server.TLSConfig = manager.TLSConfig()
+		fallback = manager.HTTPHandler(fallback)
+	}
+
+	if tlsConfig.HTTPPort == "" {
+		return
+	}
+	mainHandler := app.server.Handler
+	app.httpServer = &http.Server{
+		Addr: app.config.Server.Host + ":" + tlsConfig.HTTPPort,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.dlna != nil && strings.HasPrefix(r.URL.Path, "/dlna/") {
+				mainHandler.ServeHTTP(w, r)
+				return
+			}
+			fallback.ServeHTTP(w, r)
+		}),
+		ReadTimeout: 30 * time.Second,
+		IdleTimeout: 120 * time.Second,
+	}
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL over HTTPS
+func (app *Application) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if port := app.config.Server.Port; port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
 }
 
 // Start starts the application server
 func (app *Application) Start() error {
-	log.Printf("Server starting on %s", app.config.GetServerAddress())
-	return app.server.ListenAndServe()
+	if app.grpcServer != nil {
+		listener, err := net.Listen("tcp", app.config.GetGRPCAddress())
+		if err != nil {
+			return err
+		}
+		log.Printf("gRPC server starting on %s", app.config.GetGRPCAddress())
+		go func() {
+			if err := app.grpcServer.Serve(listener); err != nil {
+				log.Printf("gRPC server error: %v", err)
+			}
+		}()
+	}
+
+	// SSDP 端口被占用时只影响 DLNA，不阻止服务启动
+	if app.dlna != nil {
+		if err := app.dlna.Start(); err != nil {
+			log.Printf("Warning: Failed to start DLNA media server: %v", err)
+		}
+	}
+
+	tlsConfig := app.config.Server.TLS
+	if !tlsConfig.Enabled() {
+		log.Printf("Server starting on %s", app.config.GetServerAddress())
+		return app.server.ListenAndServe()
+	}
+
+	if app.httpServer != nil {
+		log.Printf("HTTP server for redirects, certificate challenges and DLNA starting on %s", app.httpServer.Addr)
+		go func() {
+			if err := app.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("HTTP server error: %v", err)
+			}
+		}()
+	}
+	log.Printf("HTTPS server starting on %s", app.config.GetServerAddress())
+	// With autocert the certificates come from TLSConfig.GetCertificate
+	return app.server.ListenAndServeTLS(tlsConfig.CertFile, tlsConfig.KeyFile)
 }
 
 // Shutdown gracefully shuts down the application
 func (app *Application) Shutdown(ctx context.Context) error {
 	log.Println("Shutting down server...")
 
+	// Announce ssdp:byebye so TVs drop the server right away
+	if app.dlna != nil {
+		app.dlna.Stop()
+	}
+
 	// Shutdown HTTP server
 	if err := app.server.Shutdown(ctx); err != nil {
 		log.Printf("Server shutdown error: %v", err)
 	}
+	if app.httpServer != nil {
+		if err := app.httpServer.Shutdown(ctx); err != nil {
+			log.Printf("HTTP server shutdown error: %v", err)
+		}
+	}
+
+	// Shutdown gRPC server, cutting off open streams once the deadline passes
+	if app.grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			app.grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			app.grpcServer.Stop()
+		}
+	}
+
+	// Stop background jobs before closing the torrent client
+	if app.autoMatch != nil {
+		log.Println("Stopping metadata auto match...")
+		app.autoMatch.Stop()
+	}
+	if app.rss != nil {
+		log.Println("Stopping RSS watcher...")
+		app.rss.Stop()
+	}
+	if app.trackerList != nil {
+		log.Println("Stopping tracker list updater...")
+		app.trackerList.Stop()
+	}
+	if app.retention != nil {
+		log.Println("Stopping retention scheduler...")
+		app.retention.Stop()
+	}
+	if app.trash != nil {
+		log.Println("Stopping trash purge...")
+		app.trash.Stop()
+	}
+	if app.statsHistory != nil {
+		log.Println("Stopping stats history...")
+		app.statsHistory.Stop()
+	}
+	if app.organizer != nil {
+		log.Println("Stopping library organizer...")
+		app.organizer.Stop()
+	}
+	if app.postProcessor != nil {
+		log.Println("Stopping post-processing...")
+		app.postProcessor.Stop()
+	}
+	if app.seedingPolicy != nil {
+		log.Println("Stopping seeding policy...")
+		app.seedingPolicy.Stop()
+	}
+	if app.metadataQueue != nil {
+		log.Println("Stopping metadata queue...")
+		app.metadataQueue.Stop()
+	}
+	if app.stateMachine != nil {
+		log.Println("Stopping torrent state machine...")
+		app.stateMachine.Stop()
+	}
 
 	// Close torrent client
 	if app.torrentClient != nil {
@@ -200,8 +662,65 @@ func (app *Application) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// runMigrate handles `migrate status|up|down|to <version>`, which moves the
+// database schema without starting the server. Roll back with the binary
+// that applied the migrations before installing an older one.
+func runMigrate(args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	dbManager, err := db.OpenDatabaseManager(
+		cfg.Database.Path,
+		cfg.Database.MaxConnections,
+		time.Duration(cfg.Database.ConnMaxLifetime)*time.Second,
+	)
+	if err != nil {
+		return err
+	}
+	defer dbManager.Close()
+
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch {
+	case command == "status" && len(args) <= 1:
+	case command == "up" && len(args) <= 1:
+		err = dbManager.MigrateTo(db.LatestVersion())
+	case command == "down" && len(args) <= 1:
+		err = dbManager.MigrateDown()
+	case command == "to" && len(args) == 2:
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		err = dbManager.MigrateTo(version)
+	default:
+		return fmt.Errorf("usage: %s migrate [status|up|down|to <version>]", os.Args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := dbManager.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version %d, binary supports %d\n", version, db.LatestVersion())
+	return nil
+}
+
 // main is the application entry point
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
 	// Create application
 	app, err := NewApplication()
 	if err != nil {
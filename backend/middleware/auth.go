@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/torrentplayer/backend/auth"
+)
+
+// APIKeyHeader 携带API密钥的请求头
+const APIKeyHeader = "X-Api-Key"
+
+// TokenVerifier 访问令牌校验接口
+type TokenVerifier interface {
+	Enabled() bool
+	VerifyToken(token string) (*auth.Claims, error)
+	VerifyAPIKey(key string) (*auth.Claims, error)
+}
+
+// RequireAuth 认证中间件，要求请求携带有效的Bearer令牌或API密钥
+// 只读API密钥只能访问 GET/HEAD 请求
+func RequireAuth(verifier TokenVerifier) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			// 关闭认证时直接放行（仅本机部署）
+			if !verifier.Enabled() || r.Method == http.MethodOptions {
+				next(w, r)
+				return
+			}
+
+			if key := r.Header.Get(APIKeyHeader); key != "" {
+				claims, err := verifier.VerifyAPIKey(key)
+				if err != nil {
+					WriteError(w, CodeInvalidAPIKey, "API密钥无效", http.StatusUnauthorized)
+					return
+				}
+				if !claims.Allows(r.Method) {
+					WriteError(w, CodeAPIKeyReadOnly, "API密钥权限不足", http.StatusForbidden)
+					return
+				}
+				next(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
+				return
+			}
+
+			token := bearerToken(r)
+			if token == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="magnet-player"`)
+				WriteError(w, CodeTokenMissing, "缺少访问令牌", http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := verifier.VerifyToken(token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="magnet-player", error="invalid_token"`)
+				WriteError(w, CodeInvalidToken, "访问令牌无效或已过期", http.StatusUnauthorized)
+				return
+			}
+
+			next(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
+		}
+	}
+}
+
+// bearerToken 从Authorization头中提取Bearer令牌
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// OptionalAuth 可选认证中间件，携带有效令牌时附加用户信息但不拒绝匿名请求
+// 支持通过 token 查询参数传递令牌（<video> 标签无法设置请求头）
+func OptionalAuth(verifier TokenVerifier) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !verifier.Enabled() {
+				next(w, r)
+				return
+			}
+
+			token := bearerToken(r)
+			if token == "" {
+				token = r.URL.Query().Get("token")
+			}
+
+			if token != "" {
+				if claims, err := verifier.VerifyToken(token); err == nil {
+					r = r.WithContext(auth.WithClaims(r.Context(), claims))
+				}
+			} else if key := r.Header.Get(APIKeyHeader); key != "" {
+				if claims, err := verifier.VerifyAPIKey(key); err == nil {
+					r = r.WithContext(auth.WithClaims(r.Context(), claims))
+				}
+			}
+
+			next(w, r)
+		}
+	}
+}
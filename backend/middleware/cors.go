@@ -2,41 +2,85 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 // CORSConfig CORS配置结构
 type CORSConfig struct {
+	// AllowedOrigins 允许的来源，* 允许任意来源；此时不发送 Allow-Credentials（浏览器不接受二者同时出现）
 	AllowedOrigins []string
 	AllowedMethods []string
 	AllowedHeaders []string
+	// ExposedHeaders 允许前端脚本读取的响应头，播放器需要 Content-Range 和 Accept-Ranges 判断能否跳转
+	ExposedHeaders []string
+	// MaxAge 浏览器缓存预检结果的时间（秒）
+	MaxAge int
 }
 
 // DefaultCORSConfig 默认CORS配置
 func DefaultCORSConfig() *CORSConfig {
 	return &CORSConfig{
 		AllowedOrigins: []string{"http://localhost:3000", "http://127.0.0.1:3000"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Content-Type", "Authorization", "Range"},
+		AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-Api-Key", "X-Request-ID", "Range", "If-Range", "If-None-Match", "Last-Event-ID"},
+		ExposedHeaders: []string{"X-Request-ID", "ETag", "Content-Disposition", "Content-Range", "Accept-Ranges", "X-Total-Count",
+			"X-Audio-Language", "X-Subtitle-Language", "X-Max-Bitrate", "X-Force-Transcode"},
+		MaxAge: 600,
 	}
 }
 
-// CORS 创建CORS中间件
+// CORS 创建CORS中间件，新旧服务器共用，处理器中不再单独设置CORS头
 func CORS(config *CORSConfig) func(http.Handler) http.Handler {
+	allowAll := false
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			allowAll = true
+		}
+	}
+	methods := strings.Join(config.AllowedMethods, ", ")
+	headers := strings.Join(config.AllowedHeaders, ", ")
+	exposed := strings.Join(config.ExposedHeaders, ", ")
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// 设置CORS头
 			origin := r.Header.Get("Origin")
-			if origin != "" && isAllowedOrigin(origin, config.AllowedOrigins) {
-				w.Header().Set("Access-Control-Allow-Origin", origin)
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			// 响应随 Origin 变化，缓存不能把一个来源的响应返回给另一个来源
+			if !allowAll {
+				w.Header().Add("Vary", "Origin")
+			}
+
+			// 不允许的来源不设置任何CORS头，由浏览器拒绝
+			if origin != "" {
+				switch {
+				case allowAll:
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				case isAllowedOrigin(origin, config.AllowedOrigins):
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				default:
+					origin = ""
+				}
 			}
-			
-			w.Header().Set("Access-Control-Allow-Methods", joinStrings(config.AllowedMethods, ", "))
-			w.Header().Set("Access-Control-Allow-Headers", joinStrings(config.AllowedHeaders, ", "))
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
 
-			// 处理预检请求
-			if r.Method == http.MethodOptions {
-				w.WriteHeader(http.StatusOK)
+			if origin != "" {
+				if exposed != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposed)
+				}
+				if preflight {
+					w.Header().Set("Access-Control-Allow-Methods", methods)
+					w.Header().Set("Access-Control-Allow-Headers", headers)
+					if config.MaxAge > 0 {
+						w.Header().Set("Access-Control-Max-Age", strconv.Itoa(config.MaxAge))
+					}
+				}
+			}
+
+			// 预检请求不进入处理器，认证中间件也不会因缺少令牌拒绝
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
 				return
 			}
 
@@ -48,22 +92,9 @@ func CORS(config *CORSConfig) func(http.Handler) http.Handler {
 // isAllowedOrigin 检查origin是否被允许
 func isAllowedOrigin(origin string, allowedOrigins []string) bool {
 	for _, allowed := range allowedOrigins {
-		if allowed == "*" || allowed == origin {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
 			return true
 		}
 	}
 	return false
 }
-
-// joinStrings 连接字符串切片
-func joinStrings(strs []string, sep string) string {
-	if len(strs) == 0 {
-		return ""
-	}
-	
-	result := strs[0]
-	for i := 1; i < len(strs); i++ {
-		result += sep + strs[i]
-	}
-	return result
-}
\ No newline at end of file
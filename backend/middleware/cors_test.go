@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	whitelist := DefaultCORSConfig()
+	wildcard := DefaultCORSConfig()
+	wildcard.AllowedOrigins = []string{"*"}
+
+	cases := []struct {
+		name        string
+		config      *CORSConfig
+		method      string
+		origin      string
+		status      int
+		allowOrigin string
+		credentials string
+	}{
+		{"allowed origin", whitelist, "GET", "http://localhost:3000", http.StatusTeapot, "http://localhost:3000", "true"},
+		{"other origin", whitelist, "GET", "http://evil.example", http.StatusTeapot, "", ""},
+		{"no origin", whitelist, "GET", "", http.StatusTeapot, "", ""},
+		// 任意来源时不能同时允许携带凭据
+		{"wildcard", wildcard, "GET", "http://evil.example", http.StatusTeapot, "*", ""},
+		{"preflight", whitelist, "OPTIONS", "http://localhost:3000", http.StatusNoContent, "http://localhost:3000", "true"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "/magnet/api/v1/torrents", nil)
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+		if c.method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "DELETE")
+		}
+		rec := httptest.NewRecorder()
+		CORS(c.config)(next).ServeHTTP(rec, req)
+
+		if rec.Code != c.status {
+			t.Errorf("%s: status %d, want %d", c.name, rec.Code, c.status)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != c.allowOrigin {
+			t.Errorf("%s: Allow-Origin %q, want %q", c.name, got, c.allowOrigin)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != c.credentials {
+			t.Errorf("%s: Allow-Credentials %q, want %q", c.name, got, c.credentials)
+		}
+		if c.allowOrigin != "" && rec.Header().Get("Access-Control-Expose-Headers") == "" {
+			t.Errorf("%s: missing Expose-Headers", c.name)
+		}
+	}
+}
@@ -2,16 +2,18 @@ package middleware
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"runtime"
 )
 
 // ErrorResponse 统一错误响应结构
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
-	Code    int    `json:"code"`
+	Error     string    `json:"error"`
+	Message   string    `json:"message,omitempty"`
+	Code      int       `json:"code"`
+	ErrorCode ErrorCode `json:"errorCode"`
+	RequestID string    `json:"requestId,omitempty"`
 }
 
 // AppError 应用错误类型
@@ -41,11 +43,11 @@ func ErrorHandler(next http.HandlerFunc) http.HandlerFunc {
 			if err := recover(); err != nil {
 				// 获取错误堆栈信息
 				buf := make([]byte, 1024)
-				stack := runtime.Stack(buf, false)
-				log.Printf("Panic recovered: %v\nStack: %s", err, stack)
+				n := runtime.Stack(buf, false)
+				slog.ErrorContext(r.Context(), "panic recovered", "error", err, "stack", string(buf[:n]))
 				
 				// 返回500错误
-				writeErrorResponse(w, "Internal server error", http.StatusInternalServerError)
+				writeErrorResponse(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
 			}
 		}()
 		
@@ -53,24 +55,32 @@ func ErrorHandler(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// WriteErrorResponse 写入错误响应
+// WriteErrorResponse 写入错误响应，错误码按状态码选择通用错误码
 func WriteErrorResponse(w http.ResponseWriter, message string, statusCode int) {
-	writeErrorResponse(w, message, statusCode)
+	writeErrorResponse(w, CodeForStatus(statusCode), message, statusCode)
+}
+
+// WriteError 写入带有具体错误码的错误响应
+func WriteError(w http.ResponseWriter, code ErrorCode, message string, statusCode int) {
+	writeErrorResponse(w, code, message, statusCode)
 }
 
 // writeErrorResponse 内部错误响应写入函数
-func writeErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+func writeErrorResponse(w http.ResponseWriter, code ErrorCode, message string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	
 	errorResp := ErrorResponse{
-		Error:   http.StatusText(statusCode),
-		Message: message,
-		Code:    statusCode,
+		Error:     http.StatusText(statusCode),
+		Message:   message,
+		Code:      statusCode,
+		ErrorCode: code,
+		// Logger 中间件已将请求ID写入响应头，便于用户反馈时关联日志
+		RequestID: w.Header().Get(RequestIDHeader),
 	}
 	
 	if err := json.NewEncoder(w).Encode(errorResp); err != nil {
-		log.Printf("Failed to encode error response: %v", err)
+		slog.Error("failed to encode error response", "error", err, "request_id", errorResp.RequestID)
 	}
 }
 
@@ -0,0 +1,92 @@
+package middleware
+
+import "net/http"
+
+// ErrorCode 机器可读的错误码，每个错误响应都在 errorCode 字段中携带，前端据此显示本地化的提示
+// 错误码一经发布不再修改含义，只增加新值
+type ErrorCode string
+
+// 通用错误码，没有更具体的错误码时按状态码选择
+const (
+	CodeBadRequest           ErrorCode = "BAD_REQUEST"
+	CodeUnauthorized         ErrorCode = "UNAUTHORIZED"
+	CodeForbidden            ErrorCode = "FORBIDDEN"
+	CodeNotFound             ErrorCode = "NOT_FOUND"
+	CodeMethodNotAllowed     ErrorCode = "METHOD_NOT_ALLOWED"
+	CodeConflict             ErrorCode = "CONFLICT"
+	CodePayloadTooLarge      ErrorCode = "PAYLOAD_TOO_LARGE"
+	CodeRangeNotSatisfiable  ErrorCode = "RANGE_NOT_SATISFIABLE"
+	CodeTooManyRequests      ErrorCode = "TOO_MANY_REQUESTS"
+	CodeInternal             ErrorCode = "INTERNAL_ERROR"
+	CodeUpstreamFailed       ErrorCode = "UPSTREAM_FAILED"
+	CodeServiceUnavailable   ErrorCode = "SERVICE_UNAVAILABLE"
+	CodeTimeout              ErrorCode = "TIMEOUT"
+	CodeStorageFull          ErrorCode = "STORAGE_FULL"
+	CodeUnsupportedMediaType ErrorCode = "UNSUPPORTED_MEDIA_TYPE"
+)
+
+// 请求错误
+const (
+	CodeInvalidBody      ErrorCode = "INVALID_BODY"
+	CodeInvalidParameter ErrorCode = "INVALID_PARAMETER"
+	CodeValidationFailed ErrorCode = "VALIDATION_FAILED"
+	CodeInvalidMagnet    ErrorCode = "INVALID_MAGNET"
+	CodeInvalidInfoHash  ErrorCode = "INVALID_INFO_HASH"
+)
+
+// 认证和授权错误
+const (
+	CodeTokenMissing       ErrorCode = "TOKEN_MISSING"
+	CodeInvalidToken       ErrorCode = "INVALID_TOKEN"
+	CodeInvalidAPIKey      ErrorCode = "INVALID_API_KEY"
+	CodeAPIKeyReadOnly     ErrorCode = "API_KEY_READ_ONLY"
+	CodeInvalidCredentials ErrorCode = "INVALID_CREDENTIALS"
+	CodeAdminRequired      ErrorCode = "ADMIN_REQUIRED"
+)
+
+// 业务错误
+const (
+	CodeTorrentNotFound       ErrorCode = "TORRENT_NOT_FOUND"
+	CodeFileNotFound          ErrorCode = "FILE_NOT_FOUND"
+	CodeFileIncomplete        ErrorCode = "FILE_INCOMPLETE"
+	CodeTooManyStreams        ErrorCode = "TOO_MANY_STREAMS"
+	CodeStreamSessionNotFound ErrorCode = "STREAM_SESSION_NOT_FOUND"
+	CodeUserNotFound          ErrorCode = "USER_NOT_FOUND"
+	CodeAPIKeyNotFound        ErrorCode = "API_KEY_NOT_FOUND"
+	CodeFeedNotFound          ErrorCode = "FEED_NOT_FOUND"
+	CodeImageNotFound         ErrorCode = "IMAGE_NOT_FOUND"
+	CodeMetadataPending       ErrorCode = "METADATA_PENDING"
+	CodeMetadataTimeout       ErrorCode = "METADATA_TIMEOUT"
+	CodeInvalidState          ErrorCode = "INVALID_STATE"
+	CodeIndexerNotConfigured  ErrorCode = "INDEXER_NOT_CONFIGURED"
+	CodeIndexerFailed         ErrorCode = "INDEXER_FAILED"
+)
+
+// statusCodes 状态码对应的通用错误码
+var statusCodes = map[int]ErrorCode{
+	http.StatusBadRequest:                   CodeBadRequest,
+	http.StatusUnauthorized:                 CodeUnauthorized,
+	http.StatusForbidden:                    CodeForbidden,
+	http.StatusNotFound:                     CodeNotFound,
+	http.StatusMethodNotAllowed:             CodeMethodNotAllowed,
+	http.StatusConflict:                     CodeConflict,
+	http.StatusRequestEntityTooLarge:        CodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:         CodeUnsupportedMediaType,
+	http.StatusRequestedRangeNotSatisfiable: CodeRangeNotSatisfiable,
+	http.StatusTooManyRequests:              CodeTooManyRequests,
+	http.StatusBadGateway:                   CodeUpstreamFailed,
+	http.StatusServiceUnavailable:           CodeServiceUnavailable,
+	http.StatusGatewayTimeout:               CodeTimeout,
+	http.StatusInsufficientStorage:          CodeStorageFull,
+}
+
+// CodeForStatus 状态码对应的通用错误码，未知的4xx返回 BAD_REQUEST，其余返回 INTERNAL_ERROR
+func CodeForStatus(statusCode int) ErrorCode {
+	if code, ok := statusCodes[statusCode]; ok {
+		return code
+	}
+	if statusCode >= 400 && statusCode < 500 {
+		return CodeBadRequest
+	}
+	return CodeInternal
+}
@@ -1,35 +1,67 @@
 package middleware
 
 import (
-	"log"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
 	"net/http"
+	"regexp"
 	"time"
+
+	"github.com/torrentplayer/backend/logging"
 )
 
-// Logger 请求日志中间件
+// RequestIDHeader 请求ID响应头，客户端也可以通过该请求头传入自己的ID
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID 客户端传入的请求ID只允许安全字符，避免日志注入
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Logger 请求日志中间件，为每个请求分配请求ID并输出结构化访问日志
 func Logger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		
+
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		r = r.WithContext(logging.WithRequestID(r.Context(), requestID))
+
 		// 创建响应写入器包装器来捕获状态码
 		ww := &responseWriter{ResponseWriter: w}
-		
+
 		// 处理请求
 		next.ServeHTTP(ww, r)
-		
+
 		// 记录日志
-		duration := time.Since(start)
-		log.Printf(
-			"%s %s %d %v %s",
-			r.Method,
-			r.URL.Path,
-			ww.statusCode,
-			duration,
-			r.RemoteAddr,
+		level := slog.LevelInfo
+		if ww.statusCode >= http.StatusInternalServerError {
+			level = slog.LevelError
+		} else if ww.statusCode >= http.StatusBadRequest {
+			level = slog.LevelWarn
+		}
+
+		slog.Log(r.Context(), level, "http request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", ww.statusCode,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"remote_addr", r.RemoteAddr,
 		)
 	})
 }
 
+// newRequestID 生成16位十六进制请求ID
+func newRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
 // responseWriter 包装器用于捕获状态码
 type responseWriter struct {
 	http.ResponseWriter
@@ -46,4 +78,16 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 		rw.statusCode = http.StatusOK
 	}
 	return rw.ResponseWriter.Write(b)
-}
\ No newline at end of file
+}
+
+// Flush 支持流式响应
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 访问底层连接（如取消写超时）
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/torrentplayer/backend/auth"
+)
+
+// RequireAdmin 授权中间件，只允许管理员访问
+// 须放在 RequireAuth 之后；关闭认证时直接放行（仅本机部署）
+func RequireAdmin(verifier TokenVerifier) func(http.HandlerFunc) http.HandlerFunc {
+	return requireAdmin(verifier, false)
+}
+
+// RequireAdminForWrites 授权中间件，所有用户都可以读取（GET/HEAD），其余请求只允许管理员执行
+func RequireAdminForWrites(verifier TokenVerifier) func(http.HandlerFunc) http.HandlerFunc {
+	return requireAdmin(verifier, true)
+}
+
+func requireAdmin(verifier TokenVerifier, allowReads bool) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !verifier.Enabled() || r.Method == http.MethodOptions {
+				next(w, r)
+				return
+			}
+			if allowReads && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+				next(w, r)
+				return
+			}
+
+			claims, ok := auth.ClaimsFromContext(r.Context())
+			if !ok {
+				WriteError(w, CodeTokenMissing, "缺少访问令牌", http.StatusUnauthorized)
+				return
+			}
+			if !claims.IsAdmin() {
+				WriteError(w, CodeAdminRequired, "需要管理员权限", http.StatusForbidden)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
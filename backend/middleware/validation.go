@@ -13,11 +13,11 @@ import (
 func ValidateJSONBody(maxSize int64) func(http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			if r.Method == http.MethodPost || r.Method == http.MethodPut {
+			if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
 				// 检查Content-Type
 				contentType := r.Header.Get("Content-Type")
 				if contentType != "application/json" {
-					WriteErrorResponse(w, "Content-Type必须为application/json", http.StatusBadRequest)
+					WriteError(w, CodeInvalidBody, "Content-Type必须为application/json", http.StatusBadRequest)
 					return
 				}
 
@@ -41,7 +41,7 @@ func ValidateMagnetRequest(next http.HandlerFunc) http.HandlerFunc {
 		// 读取请求体
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			WriteErrorResponse(w, "读取请求体失败", http.StatusBadRequest)
+			WriteError(w, CodeInvalidBody, "读取请求体失败", http.StatusBadRequest)
 			return
 		}
 
@@ -51,14 +51,14 @@ func ValidateMagnetRequest(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		if err := json.Unmarshal(body, &req); err != nil {
-			WriteErrorResponse(w, "JSON格式无效", http.StatusBadRequest)
+			WriteError(w, CodeInvalidBody, "JSON格式无效", http.StatusBadRequest)
 			return
 		}
 
 		// 验证磁力链接
 		validator := &validator.MagnetValidator{}
 		if err := validator.ValidateMagnetURI(req.MagnetURI); err != nil {
-			WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, CodeInvalidMagnet, err.Error(), http.StatusBadRequest)
 			return
 		}
 
@@ -90,14 +90,14 @@ func ValidateInfoHash(paramName string) func(http.HandlerFunc) http.HandlerFunc
 			}
 
 			if infoHash == "" {
-				WriteErrorResponse(w, "缺少InfoHash参数", http.StatusBadRequest)
+				WriteError(w, CodeInvalidInfoHash, "缺少InfoHash参数", http.StatusBadRequest)
 				return
 			}
 
 			// 验证InfoHash格式
 			validator := &validator.InfoHashValidator{}
 			if err := validator.ValidateInfoHash(infoHash); err != nil {
-				WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+				WriteError(w, CodeInvalidInfoHash, err.Error(), http.StatusBadRequest)
 				return
 			}
 
@@ -112,7 +112,7 @@ func ValidateFilePath(next http.HandlerFunc) http.HandlerFunc {
 		// 从URL路径中提取文件路径
 		pathParts := splitPath(r.URL.Path)
 		if len(pathParts) < 2 {
-			WriteErrorResponse(w, "无效的文件路径", http.StatusBadRequest)
+			WriteError(w, CodeInvalidParameter, "无效的文件路径", http.StatusBadRequest)
 			return
 		}
 
@@ -121,7 +121,7 @@ func ValidateFilePath(next http.HandlerFunc) http.HandlerFunc {
 		// 验证文件路径安全性
 		validator := &validator.FilePathValidator{}
 		if err := validator.ValidateFilePath(filePath); err != nil {
-			WriteErrorResponse(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, CodeInvalidParameter, err.Error(), http.StatusBadRequest)
 			return
 		}
 
@@ -147,7 +147,7 @@ func ValidateQueryParams(validParams map[string]bool) func(http.HandlerFunc) htt
 			// 检查是否包含未授权的参数
 			for param := range r.URL.Query() {
 				if !validParams[param] {
-					WriteErrorResponse(w, "无效的查询参数: "+param, http.StatusBadRequest)
+					WriteError(w, CodeInvalidParameter, "无效的查询参数: "+param, http.StatusBadRequest)
 					return
 				}
 			}
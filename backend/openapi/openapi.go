@@ -0,0 +1,310 @@
+// Package openapi 根据接口列表生成 OpenAPI 3 文档，请求和响应的结构通过反射
+// 从处理器实际编解码的 Go 类型得到，避免文档与代码不一致
+package openapi
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Access 接口的访问权限
+type Access string
+
+const (
+	// Public 无需登录
+	Public Access = "public"
+	// Optional 可匿名访问，登录后按用户返回
+	Optional Access = "optional"
+	// User 需要登录
+	User Access = "user"
+	// Admin 需要管理员
+	Admin Access = "admin"
+)
+
+// Operation 一个接口：路径与方法的组合
+type Operation struct {
+	Method      string
+	Path        string // 路径参数写作 {name}，未在 Params 中声明的参数按必填字符串处理
+	Tag         string
+	Summary     string
+	Description string
+	Access      Access
+	Params      []Param
+
+	// Body 请求体类型的零值，如 AddMagnetRequest{}；为 nil 时没有请求体
+	Body interface{}
+	// BodyType 请求体的媒体类型，默认 application/json
+	BodyType string
+
+	// Status 成功时的状态码，默认 200
+	Status int
+	// Response 响应体类型的零值；为 nil 且 ResponseType 为空时只有状态码
+	Response interface{}
+	// ResponseType 响应的媒体类型，默认 application/json；非 JSON 响应不生成结构
+	ResponseType string
+	// Errors 其余可能返回的状态码，如 304、404；401 和 403 按 Access 自动添加
+	Errors []int
+}
+
+// Param 查询、路径或请求头参数
+type Param struct {
+	Name        string
+	In          string // query、path 或 header
+	Type        string // string、integer、number 或 boolean
+	Description string
+	Required    bool
+	Repeated    bool // 可重复的查询参数，如 tag=a&tag=b
+}
+
+// PathParam 路径参数
+func PathParam(name, description string) Param {
+	return Param{Name: name, In: "path", Type: "string", Description: description, Required: true}
+}
+
+// Query 可选的查询参数
+func Query(name, typ, description string) Param {
+	return Param{Name: name, In: "query", Type: typ, Description: description}
+}
+
+// Document OpenAPI 文档
+type Document struct {
+	Title       string
+	Version     string
+	Description string
+	// BasePath 所有路径的公共前缀，如 /magnet/api/v1
+	BasePath string
+	// ErrorBody 错误响应体类型的零值
+	ErrorBody  interface{}
+	Operations []Operation
+}
+
+// Build 生成 OpenAPI 3.0 文档，可直接编码为 JSON
+func (d *Document) Build() map[string]interface{} {
+	schemas := newSchemaBuilder()
+
+	var errorSchema map[string]interface{}
+	if d.ErrorBody != nil {
+		errorSchema = schemas.of(d.ErrorBody)
+	}
+
+	paths := make(map[string]interface{})
+	tags := make(map[string]bool)
+	for _, op := range d.Operations {
+		item, ok := paths[op.Path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = operation(op, schemas, errorSchema)
+		if op.Tag != "" {
+			tags[op.Tag] = true
+		}
+	}
+
+	tagList := make([]string, 0, len(tags))
+	for tag := range tags {
+		tagList = append(tagList, tag)
+	}
+	sort.Strings(tagList)
+	tagObjects := make([]interface{}, len(tagList))
+	for i, tag := range tagList {
+		tagObjects[i] = map[string]interface{}{"name": tag}
+	}
+
+	info := map[string]interface{}{
+		"title":   d.Title,
+		"version": d.Version,
+	}
+	if d.Description != "" {
+		info["description"] = d.Description
+	}
+
+	result := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    info,
+		"tags":    tagObjects,
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+					"description":  "Token from POST " + d.BasePath + "/auth/login",
+				},
+				"apiKey": map[string]interface{}{
+					"type": "apiKey",
+					"in":   "header",
+					"name": "X-Api-Key",
+				},
+			},
+		},
+	}
+	if d.BasePath != "" {
+		result["servers"] = []interface{}{map[string]interface{}{"url": d.BasePath}}
+	}
+	return result
+}
+
+// operation 生成一个接口的 Operation Object
+func operation(op Operation, schemas *schemaBuilder, errorSchema map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{
+		"operationId": operationID(op),
+		"responses":   responses(op, schemas, errorSchema),
+	}
+	if op.Tag != "" {
+		result["tags"] = []string{op.Tag}
+	}
+	if op.Summary != "" {
+		result["summary"] = op.Summary
+	}
+	description := op.Description
+	if op.Access == Admin {
+		description = strings.TrimSpace(description + "\n\nAdmin only.")
+	}
+	if description != "" {
+		result["description"] = description
+	}
+
+	switch op.Access {
+	case Public:
+		result["security"] = []interface{}{}
+	case Optional:
+		result["security"] = []interface{}{
+			map[string]interface{}{"bearerAuth": []string{}},
+			map[string]interface{}{"apiKey": []string{}},
+			map[string]interface{}{},
+		}
+	default:
+		result["security"] = []interface{}{
+			map[string]interface{}{"bearerAuth": []string{}},
+			map[string]interface{}{"apiKey": []string{}},
+		}
+	}
+
+	if params := parameters(op); len(params) > 0 {
+		result["parameters"] = params
+	}
+
+	if op.Body != nil || op.BodyType != "" {
+		bodyType := op.BodyType
+		if bodyType == "" {
+			bodyType = "application/json"
+		}
+		media := map[string]interface{}{}
+		if op.Body != nil {
+			media["schema"] = schemas.of(op.Body)
+		}
+		result["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{bodyType: media},
+		}
+	}
+	return result
+}
+
+// parameters 生成参数列表，补上未声明的路径参数
+func parameters(op Operation) []interface{} {
+	declared := make(map[string]bool)
+	params := append([]Param{}, op.Params...)
+	for _, p := range params {
+		if p.In == "path" {
+			declared[p.Name] = true
+		}
+	}
+	for _, name := range pathParams(op.Path) {
+		if !declared[name] {
+			params = append(params, PathParam(name, ""))
+		}
+	}
+
+	result := make([]interface{}, 0, len(params))
+	for _, p := range params {
+		schema := map[string]interface{}{"type": p.Type}
+		if p.Type == "" {
+			schema["type"] = "string"
+		}
+		if p.Repeated {
+			schema = map[string]interface{}{"type": "array", "items": schema}
+		}
+		param := map[string]interface{}{
+			"name":     p.Name,
+			"in":       p.In,
+			"required": p.Required || p.In == "path",
+			"schema":   schema,
+		}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		if p.Repeated {
+			param["style"] = "form"
+			param["explode"] = true
+		}
+		result = append(result, param)
+	}
+	return result
+}
+
+// responses 生成成功和错误响应
+func responses(op Operation, schemas *schemaBuilder, errorSchema map[string]interface{}) map[string]interface{} {
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	switch {
+	case op.ResponseType != "":
+		success["content"] = map[string]interface{}{op.ResponseType: map[string]interface{}{}}
+	case op.Response != nil:
+		success["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schemas.of(op.Response)},
+		}
+	}
+	result := map[string]interface{}{strconv.Itoa(status): success}
+
+	codes := append([]int{}, op.Errors...)
+	switch op.Access {
+	case User:
+		codes = append(codes, http.StatusUnauthorized)
+	case Admin:
+		codes = append(codes, http.StatusUnauthorized, http.StatusForbidden)
+	}
+	for _, code := range codes {
+		response := map[string]interface{}{"description": http.StatusText(code)}
+		// 304 等非错误状态码没有响应体
+		if errorSchema != nil && code >= http.StatusBadRequest {
+			response["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": errorSchema},
+			}
+		}
+		result[strconv.Itoa(code)] = response
+	}
+	return result
+}
+
+// pathParams 路径中的参数名
+func pathParams(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, strings.Trim(segment, "{}"))
+		}
+	}
+	return names
+}
+
+// operationID 由方法和路径生成唯一的 operationId，如 get_magnet_api_torrents_infoHash_seeding
+func operationID(op Operation) string {
+	var parts []string
+	for _, segment := range strings.Split(op.Path, "/") {
+		segment = strings.Trim(segment, "{}")
+		if segment != "" {
+			parts = append(parts, strings.ReplaceAll(segment, "-", "_"))
+		}
+	}
+	return strings.ToLower(op.Method) + "_" + strings.Join(parts, "_")
+}
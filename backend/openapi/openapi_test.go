@@ -0,0 +1,89 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type inner struct {
+	Hidden string `json:"-"`
+	Shared string `json:"shared"`
+	Nested *inner `json:"nested,omitempty"`
+}
+
+type outer struct {
+	inner
+	Shared  int               `json:"shared"`
+	Created time.Time         `json:"created"`
+	Labels  map[string]string `json:"labels"`
+	Data    []byte            `json:"data"`
+	Items   []inner           `json:"items"`
+	NoTag   bool
+	private int
+}
+
+func TestSchemaFollowsJSONEncoding(t *testing.T) {
+	b := newSchemaBuilder()
+	if ref := b.of(&outer{})["$ref"]; ref != "#/components/schemas/outer" {
+		t.Fatalf("unexpected ref %v", ref)
+	}
+
+	props := b.components["outer"].(map[string]interface{})["properties"].(map[string]interface{})
+	want := map[string]string{
+		"shared":  `{"type":"integer"}`,
+		"created": `{"format":"date-time","type":"string"}`,
+		"labels":  `{"additionalProperties":{"type":"string"},"type":"object"}`,
+		"data":    `{"format":"byte","type":"string"}`,
+		"items":   `{"items":{"$ref":"#/components/schemas/inner"},"type":"array"}`,
+		"NoTag":   `{"type":"boolean"}`,
+		"nested":  `{"$ref":"#/components/schemas/inner"}`,
+	}
+	if len(props) != len(want) {
+		t.Fatalf("unexpected properties %v", props)
+	}
+	for name, schema := range want {
+		got, _ := json.Marshal(props[name])
+		if string(got) != schema {
+			t.Errorf("%s: got %s, want %s", name, got, schema)
+		}
+	}
+
+	innerProps := b.components["inner"].(map[string]interface{})["properties"].(map[string]interface{})
+	if _, ok := innerProps["Hidden"]; ok {
+		t.Error("fields tagged - should be skipped")
+	}
+}
+
+func TestBuildAddsPathParamsAndAuthErrors(t *testing.T) {
+	doc := &Document{
+		Title:     "test",
+		Version:   "1",
+		ErrorBody: struct{ Error string }{},
+		Operations: []Operation{
+			{Method: "PUT", Path: "/torrents/{infoHash}/tags", Access: Admin, Body: outer{}},
+			{Method: "GET", Path: "/public", Access: Public},
+		},
+	}
+	paths := doc.Build()["paths"].(map[string]interface{})
+
+	put := paths["/torrents/{infoHash}/tags"].(map[string]interface{})["put"].(map[string]interface{})
+	if put["operationId"] != "put_torrents_infoHash_tags" {
+		t.Errorf("unexpected operationId %v", put["operationId"])
+	}
+	params := put["parameters"].([]interface{})
+	if len(params) != 1 || params[0].(map[string]interface{})["name"] != "infoHash" {
+		t.Errorf("path parameter not added: %v", params)
+	}
+	responses := put["responses"].(map[string]interface{})
+	for _, code := range []string{"200", "401", "403"} {
+		if _, ok := responses[code]; !ok {
+			t.Errorf("missing %s response", code)
+		}
+	}
+
+	get := paths["/public"].(map[string]interface{})["get"].(map[string]interface{})
+	if security := get["security"].([]interface{}); len(security) != 0 {
+		t.Errorf("public operation should not require auth: %v", security)
+	}
+}
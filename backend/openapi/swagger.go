@@ -0,0 +1,22 @@
+package openapi
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+)
+
+//go:embed swagger.html
+var swaggerHTML string
+
+var swaggerTemplate = template.Must(template.New("swagger").Parse(swaggerHTML))
+
+// SwaggerUI 生成加载 specURL 的 Swagger UI 页面，脚本和样式从 CDN 加载
+func SwaggerUI(title, specURL string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := swaggerTemplate.Execute(&buf, struct {
+		Title   string
+		SpecURL string
+	}{title, specURL})
+	return buf.Bytes(), err
+}
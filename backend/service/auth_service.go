@@ -0,0 +1,403 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/torrentplayer/backend/auth"
+	"github.com/torrentplayer/backend/config"
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// ErrInvalidCredentials 用户名或密码错误
+var ErrInvalidCredentials = errors.New("用户名或密码错误")
+
+// ErrInvalidAPIKey API密钥无效
+var ErrInvalidAPIKey = errors.New("无效的API密钥")
+
+// ErrAPIKeyNotFound API密钥不存在
+var ErrAPIKeyNotFound = errors.New("API密钥不存在")
+
+// ErrUserNotFound 用户不存在
+var ErrUserNotFound = errors.New("用户不存在")
+
+// minPasswordLength 新建用户和修改密码时的最短密码长度
+const minPasswordLength = 8
+
+// apiKeyPrefix 生成的API密钥前缀，便于识别和密钥扫描
+const apiKeyPrefix = "mpk_"
+
+// AuthService 认证服务层
+type AuthService struct {
+	userStore   *db.UserStore
+	apiKeyStore *db.APIKeyStore
+	tokens      *auth.TokenManager
+	config      *config.Config
+}
+
+// CreatedAPIKey 新建的API密钥，明文密钥仅在创建时返回一次
+type CreatedAPIKey struct {
+	Key string `json:"key"`
+	*db.APIKey
+}
+
+// LoginResult 登录结果
+type LoginResult struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	User      *db.User  `json:"user"`
+}
+
+// NewAuthService 创建认证服务实例
+func NewAuthService(userStore *db.UserStore, apiKeyStore *db.APIKeyStore, cfg *config.Config) (*AuthService, error) {
+	secret := cfg.Auth.JWTSecret
+	if cfg.Auth.Enabled && secret == "" {
+		// 未配置密钥时生成临时密钥，重启后已签发的令牌将全部失效
+		generated, err := randomHex(32)
+		if err != nil {
+			return nil, fmt.Errorf("生成JWT密钥失败: %w", err)
+		}
+		secret = generated
+		log.Println("警告: 未设置JWT_SECRET，已生成临时密钥，重启后需要重新登录")
+	}
+
+	return &AuthService{
+		userStore:   userStore,
+		apiKeyStore: apiKeyStore,
+		tokens:      auth.NewTokenManager(secret, time.Duration(cfg.Auth.TokenTTLHours)*time.Hour),
+		config:      cfg,
+	}, nil
+}
+
+// Enabled 是否启用认证
+func (s *AuthService) Enabled() bool {
+	return s.config.Auth.Enabled
+}
+
+// EnsureAdminUser 在没有任何用户时创建初始管理员账号
+func (s *AuthService) EnsureAdminUser() error {
+	count, err := s.userStore.CountUsers()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	password := s.config.Auth.AdminPassword
+	if password == "" {
+		password, err = randomHex(8)
+		if err != nil {
+			return fmt.Errorf("生成管理员密码失败: %w", err)
+		}
+		log.Printf("已生成初始管理员密码，用户名: %s 密码: %s", s.config.Auth.AdminUsername, password)
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.userStore.CreateUser(s.config.Auth.AdminUsername, hash, auth.RoleAdmin); err != nil {
+		return err
+	}
+
+	log.Printf("已创建初始管理员账号: %s", s.config.Auth.AdminUsername)
+	return nil
+}
+
+// Login 校验用户名密码并签发令牌
+func (s *AuthService) Login(username, password string) (*LoginResult, error) {
+	username = strings.TrimSpace(username)
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	user, err := s.userStore.GetUserByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("查询用户失败: %w", err)
+	}
+	if user == nil || !auth.CheckPassword(user.PasswordHash, password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	token, expiresAt, err := s.tokens.Issue(user.ID, user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.userStore.UpdateLastLogin(user.ID); err != nil {
+		log.Printf("警告: 更新最后登录时间失败: %v", err)
+	}
+
+	return &LoginResult{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		User:      user,
+	}, nil
+}
+
+// VerifyToken 校验访问令牌，并从数据库读取用户当前的角色；用户已删除时令牌失效
+func (s *AuthService) VerifyToken(token string) (*auth.Claims, error) {
+	claims, err := s.tokens.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userStore.GetUserByID(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, auth.ErrInvalidToken
+	}
+	claims.Role = user.Role
+	return claims, nil
+}
+
+// VerifyAPIKey 校验API密钥，依次匹配配置文件中的静态密钥和数据库中的用户密钥
+func (s *AuthService) VerifyAPIKey(key string) (*auth.Claims, error) {
+	if key == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	for _, static := range s.config.Auth.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(static.Key), []byte(key)) == 1 {
+			// 配置文件中的静态密钥由部署者设置，按管理员处理，权限由 scope 限制
+			return &auth.Claims{
+				UserID:   LocalUserID,
+				Username: "apikey:" + static.Name,
+				Scope:    static.Scope,
+				Role:     auth.RoleAdmin,
+			}, nil
+		}
+	}
+
+	record, err := s.apiKeyStore.GetAPIKeyByHash(hashAPIKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// 密钥继承所属用户的角色
+	user, err := s.userStore.GetUserByID(record.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if err := s.apiKeyStore.UpdateLastUsed(record.ID); err != nil {
+		log.Printf("警告: 更新API密钥使用时间失败: %v", err)
+	}
+
+	return &auth.Claims{
+		UserID:   record.UserID,
+		Username: "apikey:" + record.Name,
+		Scope:    record.Scope,
+		Role:     user.Role,
+	}, nil
+}
+
+// CreateAPIKey 为用户生成新的API密钥
+func (s *AuthService) CreateAPIKey(userID int64, name, scope string) (*CreatedAPIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, validator.ValidationError{Field: "name", Message: "名称不能为空"}
+	}
+	if len(name) > 64 {
+		return nil, validator.ValidationError{Field: "name", Message: "名称不能超过64个字符"}
+	}
+	if scope != auth.ScopeRead && scope != auth.ScopeWrite {
+		return nil, validator.ValidationError{Field: "scope", Message: "权限必须为 read 或 write"}
+	}
+
+	secret, err := randomHex(24)
+	if err != nil {
+		return nil, fmt.Errorf("生成API密钥失败: %w", err)
+	}
+	key := apiKeyPrefix + secret
+
+	record := &db.APIKey{
+		UserID: userID,
+		Name:   name,
+		Prefix: key[:len(apiKeyPrefix)+6],
+		Scope:  scope,
+	}
+	if err := s.apiKeyStore.CreateAPIKey(record, hashAPIKey(key)); err != nil {
+		return nil, err
+	}
+
+	return &CreatedAPIKey{Key: key, APIKey: record}, nil
+}
+
+// ListAPIKeys 获取用户的API密钥列表（不含明文密钥）
+func (s *AuthService) ListAPIKeys(userID int64) ([]*db.APIKey, error) {
+	return s.apiKeyStore.ListAPIKeys(userID)
+}
+
+// DeleteAPIKey 删除用户的API密钥
+func (s *AuthService) DeleteAPIKey(userID, id int64) error {
+	deleted, err := s.apiKeyStore.DeleteAPIKey(userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// GetUser 获取用户信息
+func (s *AuthService) GetUser(id int64) (*db.User, error) {
+	user, err := s.userStore.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// UserUpdate 用户修改数据，nil字段表示不修改
+type UserUpdate struct {
+	Role     *string `json:"role"`
+	Password *string `json:"password"`
+}
+
+// ListUsers 获取所有用户
+func (s *AuthService) ListUsers() ([]*db.User, error) {
+	return s.userStore.ListUsers()
+}
+
+// CreateUser 创建用户，role 为空时创建观众
+func (s *AuthService) CreateUser(username, password, role string) (*db.User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, validator.ValidationError{Field: "username", Message: "用户名不能为空"}
+	}
+	if len(username) > 64 {
+		return nil, validator.ValidationError{Field: "username", Message: "用户名不能超过64个字符"}
+	}
+	if role == "" {
+		role = auth.RoleViewer
+	}
+	if !auth.ValidRole(role) {
+		return nil, validator.ValidationError{Field: "role", Message: "角色必须为 admin 或 viewer"}
+	}
+	if len(password) < minPasswordLength {
+		return nil, validator.ValidationError{Field: "password", Message: fmt.Sprintf("密码不能少于%d个字符", minPasswordLength)}
+	}
+
+	existing, err := s.userStore.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, validator.ValidationError{Field: "username", Message: "用户名已存在"}
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	return s.userStore.CreateUser(username, hash, role)
+}
+
+// UpdateUser 修改用户角色或密码，不允许取消最后一个管理员
+func (s *AuthService) UpdateUser(id int64, update *UserUpdate) (*db.User, error) {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Password != nil {
+		if len(*update.Password) < minPasswordLength {
+			return nil, validator.ValidationError{Field: "password", Message: fmt.Sprintf("密码不能少于%d个字符", minPasswordLength)}
+		}
+		hash, err := auth.HashPassword(*update.Password)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.userStore.UpdatePassword(id, hash); err != nil {
+			return nil, err
+		}
+	}
+
+	if update.Role != nil && *update.Role != user.Role {
+		if !auth.ValidRole(*update.Role) {
+			return nil, validator.ValidationError{Field: "role", Message: "角色必须为 admin 或 viewer"}
+		}
+		if err := s.ensureOtherAdmin(user); err != nil {
+			return nil, err
+		}
+		if err := s.userStore.UpdateRole(id, *update.Role); err != nil {
+			return nil, err
+		}
+		user.Role = *update.Role
+	}
+
+	return user, nil
+}
+
+// DeleteUser 删除用户及其API密钥、偏好和播放进度，不允许删除最后一个管理员
+func (s *AuthService) DeleteUser(id int64) error {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return err
+	}
+	if err := s.ensureOtherAdmin(user); err != nil {
+		return err
+	}
+
+	deleted, err := s.userStore.DeleteUser(id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// ensureOtherAdmin 取消管理员角色或删除管理员前，确认还有其他管理员
+func (s *AuthService) ensureOtherAdmin(user *db.User) error {
+	if user.Role != auth.RoleAdmin {
+		return nil
+	}
+	admins, err := s.userStore.CountUsersWithRole(auth.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return validator.ValidationError{Field: "role", Message: "至少需要保留一个管理员"}
+	}
+	return nil
+}
+
+// hashAPIKey 计算API密钥的SHA-256哈希，密钥本身为高熵随机串，无需bcrypt
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex 生成指定字节数的随机十六进制字符串
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
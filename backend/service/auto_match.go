@@ -0,0 +1,346 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/events"
+	"github.com/torrentplayer/backend/service/search"
+	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// autoMatchQueueSize 等待自动匹配的种子数上限，超出时丢弃并记录警告
+const autoMatchQueueSize = 256
+
+// ErrMetadataPending 种子元数据尚未获取，无法按文件匹配剧集
+var ErrMetadataPending = errors.New("种子元数据尚未获取")
+
+// RematchRequest 手动重新匹配请求
+// TmdbId 不为 0 时直接使用该电影或剧集，否则按 Title 和 Year 搜索；两者都为空时重新识别种子名称
+type RematchRequest struct {
+	TmdbId int    `json:"tmdbId"`
+	Title  string `json:"title"`
+	Year   int    `json:"year"`
+	// MediaType 为 movie 或 tv，为空时沿用当前详情的类型，没有详情时按文件名是否带有季集编号判断
+	MediaType string `json:"mediaType"`
+	// Provider 为 tmdb 或 anilist，为空时指定了 AnilistId 或动画字幕组发布的种子使用AniList
+	Provider  string `json:"provider"`
+	AnilistId int    `json:"anilistId"`
+}
+
+// AutoMatchService 元数据到达后在后台识别种子名称并查询TMDB，自动保存电影或剧集详情，
+// 前端无需再调用搜索接口并回传详情。配置开启时对所有种子生效，否则只处理添加时请求了自动匹配的种子
+type AutoMatchService struct {
+	torrents     *TorrentService
+	torrentStore *db.TorrentStore
+	search       *SearchService
+	bus          *events.Bus
+	enabled      bool
+
+	// requested 添加时请求了自动匹配、元数据尚未到达的种子，只保存在内存中
+	mu        sync.Mutex
+	requested map[string]bool
+
+	jobs   chan string
+	cancel func()
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewAutoMatchService 创建自动匹配服务
+func NewAutoMatchService(torrents *TorrentService, store *db.TorrentStore, search *SearchService, bus *events.Bus, enabled bool) *AutoMatchService {
+	return &AutoMatchService{
+		torrents:     torrents,
+		torrentStore: store,
+		search:       search,
+		bus:          bus,
+		enabled:      enabled,
+		requested:    make(map[string]bool),
+		jobs:         make(chan string, autoMatchQueueSize),
+		stop:         make(chan struct{}),
+	}
+}
+
+// Start 订阅元数据事件并启动匹配任务
+// TMDB 和文件名识别请求较慢，由单独的 goroutine 依次处理，避免订阅通道积压丢事件
+func (s *AutoMatchService) Start() {
+	eventsCh, cancel := s.bus.Subscribe()
+	s.cancel = cancel
+
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		for event := range eventsCh {
+			switch event.Type {
+			case events.TorrentMetadata:
+				if s.takeRequest(event.InfoHash) || s.enabled {
+					s.enqueue(event.InfoHash)
+				}
+			case events.TorrentRemoved:
+				s.takeRequest(event.InfoHash)
+			}
+		}
+	}()
+	go func() {
+		defer s.wg.Done()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case infoHash := <-s.jobs:
+				s.run(infoHash)
+			}
+		}
+	}()
+}
+
+// Stop 停止自动匹配，正在进行的匹配完成后返回
+func (s *AutoMatchService) Stop() {
+	s.cancel()
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// Request 为种子请求自动匹配，元数据到达后处理
+func (s *AutoMatchService) Request(infoHash string) {
+	s.mu.Lock()
+	s.requested[infoHash] = true
+	s.mu.Unlock()
+
+	// 元数据可能已经到达（重复添加或获取很快），之后不会再有元数据事件
+	if info, err := s.torrents.GetTorrent(infoHash); err == nil && len(info.Files) > 0 && s.takeRequest(infoHash) {
+		s.enqueue(infoHash)
+	}
+}
+
+// takeRequest 取出种子的自动匹配请求
+func (s *AutoMatchService) takeRequest(infoHash string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requested := s.requested[infoHash]
+	delete(s.requested, infoHash)
+	return requested
+}
+
+// enqueue 将种子加入匹配队列
+func (s *AutoMatchService) enqueue(infoHash string) {
+	select {
+	case s.jobs <- infoHash:
+	default:
+		log.Printf("警告: 自动匹配队列已满，跳过种子 %s", infoHash)
+	}
+}
+
+// run 匹配一个种子并发布结果事件
+func (s *AutoMatchService) run(infoHash string) {
+	details, err := s.match(infoHash)
+	if err != nil {
+		log.Printf("警告: 自动匹配种子 %s 失败: %v", infoHash, err)
+		s.bus.Publish(events.TorrentMatchFailed, infoHash, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if details != nil {
+		s.bus.Publish(events.TorrentMatched, infoHash, details)
+	}
+}
+
+// match 识别种子名称，动画字幕组的发布先从AniList匹配，视频文件名带有季集编号时按剧集匹配，否则按电影匹配
+// 已有详情（手动保存或之前匹配过）的种子不再处理，返回 nil
+func (s *AutoMatchService) match(infoHash string) (*db.MovieDetails, error) {
+	record, err := s.torrentStore.GetTorrent(infoHash)
+	if err != nil || record == nil {
+		return nil, ErrTorrentNotFound
+	}
+	if record.MovieDetails != nil {
+		return nil, nil
+	}
+
+	info, err := s.torrents.GetTorrent(infoHash)
+	if err != nil {
+		return nil, err
+	}
+
+	title, err := s.search.IdentifyTitle(info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// 查询较慢，匹配期间客户端可能已经保存了详情，只在种子仍没有详情时保存结果；
+	// 期间写入的进度、名称和文件列表不影响保存
+	if isAnime(info) {
+		target := ShowMatchRequest{Name: search.AnimeTitle(title.Title), Year: title.Year, Provider: ProviderAniList}
+		details, err := s.save(infoHash, info.Files, MediaTV, target, title.Method, true)
+		if err == nil || errors.Is(err, db.ErrConcurrentUpdate) {
+			return matched(infoHash, details, err)
+		}
+		log.Printf("警告: 从AniList匹配种子 %s 失败，改用TMDB: %v", infoHash, err)
+	}
+
+	mediaType := MediaMovie
+	if hasEpisodes(info.Files) {
+		mediaType = MediaTV
+	}
+	details, err := s.save(infoHash, info.Files, mediaType, ShowMatchRequest{Name: title.Title, Year: title.Year}, title.Method, true)
+	return matched(infoHash, details, err)
+}
+
+// matched 返回自动匹配的结果；匹配期间详情已被修改时放弃结果，不算作失败
+func matched(infoHash string, details *db.MovieDetails, err error) (*db.MovieDetails, error) {
+	if errors.Is(err, db.ErrConcurrentUpdate) {
+		log.Printf("种子 %s 的详情在自动匹配期间已被修改，放弃匹配结果", infoHash)
+		return nil, nil
+	}
+	return details, err
+}
+
+// Rematch 按请求重新查询TMDB并覆盖种子的详情，用于自动匹配选错了电影的情况
+// 指定了 TmdbId 或 Title 时 matchedBy 为空，与客户端保存的详情相同
+func (s *AutoMatchService) Rematch(infoHash string, req RematchRequest) (*db.MovieDetails, error) {
+	req.Title = strings.TrimSpace(req.Title)
+	if req.TmdbId < 0 {
+		return nil, validator.ValidationError{Field: "tmdbId", Message: "TMDB ID不能为负数"}
+	}
+	if req.Year < 0 {
+		return nil, validator.ValidationError{Field: "year", Message: "年份不能为负数"}
+	}
+	if req.MediaType != "" && req.MediaType != MediaMovie && req.MediaType != MediaTV {
+		return nil, validator.ValidationError{Field: "mediaType", Message: "媒体类型必须为 movie 或 tv"}
+	}
+	if req.Provider != "" && req.Provider != ProviderTMDB && req.Provider != ProviderAniList {
+		return nil, validator.ValidationError{Field: "provider", Message: "数据来源必须为 tmdb 或 anilist"}
+	}
+
+	record, err := s.torrentStore.GetTorrent(infoHash)
+	if err != nil || record == nil {
+		return nil, ErrTorrentNotFound
+	}
+	info, err := s.torrents.GetTorrent(infoHash)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType := req.MediaType
+	if mediaType == "" {
+		switch {
+		case record.MovieDetails != nil && record.MovieDetails.MediaType == MediaTV:
+			mediaType = MediaTV
+		case record.MovieDetails == nil && hasEpisodes(info.Files):
+			mediaType = MediaTV
+		default:
+			mediaType = MediaMovie
+		}
+	}
+
+	provider := req.Provider
+	if provider == "" {
+		switch {
+		case req.AnilistId > 0:
+			provider = ProviderAniList
+		case req.TmdbId > 0:
+			provider = ProviderTMDB
+		case record.MovieDetails != nil && record.MovieDetails.Provider != "":
+			provider = record.MovieDetails.Provider
+		case record.MovieDetails == nil && isAnime(info):
+			provider = ProviderAniList
+		}
+	}
+
+	target := ShowMatchRequest{Name: req.Title, Year: req.Year, TmdbId: req.TmdbId}
+	matchedBy := ""
+	if req.TmdbId == 0 && req.AnilistId == 0 && req.Title == "" {
+		title, err := s.search.IdentifyTitle(info.Name)
+		if err != nil {
+			return nil, err
+		}
+		target.Name, target.Year, matchedBy = title.Title, title.Year, title.Method
+		if provider == ProviderAniList {
+			target.Name = search.AnimeTitle(target.Name)
+		}
+	}
+	// AniList 的电影和剧集都按剧集匹配，电影格式不会匹配文件
+	if provider == ProviderAniList {
+		target.Provider, target.AnilistId, target.TmdbId = ProviderAniList, req.AnilistId, 0
+		mediaType = MediaTV
+	}
+
+	details, err := s.save(infoHash, info.Files, mediaType, target, matchedBy, false)
+	if err != nil {
+		return nil, err
+	}
+	s.bus.Publish(events.TorrentMatched, infoHash, details)
+	return details, nil
+}
+
+// save 查询TMDB电影或剧集详情并保存到种子
+// ifNoDetails 为 true 时只在种子仍没有详情时保存，否则返回 db.ErrConcurrentUpdate
+func (s *AutoMatchService) save(infoHash string, files []torrent.FileInfo, mediaType string, target ShowMatchRequest, matchedBy string, ifNoDetails bool) (*db.MovieDetails, error) {
+	if mediaType == MediaTV {
+		if len(files) == 0 {
+			return nil, ErrMetadataPending
+		}
+		match, err := s.search.MatchShow(target, files)
+		if err != nil {
+			return nil, err
+		}
+		match.Show.MatchedBy = matchedBy
+		if ifNoDetails {
+			err = s.torrents.SetMatchedDetails(infoHash, match.Show, match.Episodes)
+		} else {
+			err = s.torrents.SetShowDetails(infoHash, match)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return match.Show, nil
+	}
+
+	var details *db.MovieDetails
+	var err error
+	if target.TmdbId > 0 {
+		details, err = s.search.MatchMovieByID(target.TmdbId)
+	} else {
+		details, err = s.search.MatchMovie(target.Name, target.Year)
+	}
+	if err != nil {
+		return nil, err
+	}
+	details.MatchedBy = matchedBy
+	if ifNoDetails {
+		err = s.torrents.SetMatchedDetails(infoHash, details, nil)
+	} else {
+		err = s.torrents.SetMovieDetails(infoHash, details)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// isAnime 种子名称或视频文件名是否像动画字幕组的发布
+func isAnime(info *torrent.TorrentInfo) bool {
+	if search.IsAnimeRelease(info.Name) {
+		return true
+	}
+	for _, file := range info.Files {
+		if file.IsVideo && search.IsAnimeRelease(file.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasEpisodes 是否有视频文件名带有季集编号
+func hasEpisodes(files []torrent.FileInfo) bool {
+	for _, file := range files {
+		if _, _, ok := search.ParseEpisode(file.Path); ok && file.IsVideo {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/torrentplayer/backend/config"
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/events"
+)
+
+// newTestTorrentService 创建只使用数据库的种子服务，并添加一个下载中的种子 abc
+func newTestTorrentService(t *testing.T) (*TorrentService, *db.TorrentStore) {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	manager, err := db.NewDatabaseManager(filepath.Join(t.TempDir(), "torrents.db"), 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { manager.Close() })
+	store, err := db.NewTorrentStore(manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	episodes := db.NewEpisodeStore(manager)
+	bus := events.NewBus()
+	states := NewStateMachine(nil, store, bus)
+	organizer := NewOrganizer(nil, store, episodes, db.NewLibraryLinkStore(manager), bus)
+	service := NewTorrentService(nil, store, nil, nil, nil, episodes, db.NewCollectionStore(manager), states, nil, nil, nil, organizer, bus, &config.Config{})
+
+	if err := store.AddTorrent(&db.TorrentRecord{InfoHash: "abc", Name: "movie", MagnetURI: "magnet:?xt=urn:btih:abc"}); err != nil {
+		t.Fatal(err)
+	}
+	states.Track("abc", StateDownloading, "")
+	return service, store
+}
+
+// TestMatchedDetailsAfterSave 自动匹配期间前端保存种子数据（添加磁力链接后立即保存）不应使匹配结果被丢弃
+func TestMatchedDetailsAfterSave(t *testing.T) {
+	service, store := newTestTorrentService(t)
+
+	// match 读取记录时种子还没有详情
+	record, err := store.GetTorrent("abc")
+	if err != nil || record.MovieDetails != nil {
+		t.Fatalf("记录 %+v, err = %v", record, err)
+	}
+
+	downloaded, progress := int64(21), float32(0.5)
+	if err := service.SaveTorrentData("abc", &TorrentUpdateData{
+		Name:       "movie 2020",
+		Length:     42,
+		Files:      []db.FileInfo{{Path: "movie.mkv", Length: 42, IsVideo: true}},
+		Downloaded: &downloaded,
+		Progress:   &progress,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	details := &db.MovieDetails{Filename: "movie.mkv", Year: 2020, MatchedBy: "llm"}
+	if err := service.SetMatchedDetails("abc", details, nil); err != nil {
+		t.Fatalf("保存种子数据后保存匹配结果: %v", err)
+	}
+	record, err = store.GetTorrent("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.MovieDetails == nil || record.MovieDetails.Year != 2020 || record.Name != "movie 2020" {
+		t.Errorf("详情 %+v，名称 %q", record.MovieDetails, record.Name)
+	}
+}
+
+// TestMatchedDetailsKeepsClientDetails 匹配期间客户端保存的详情不被自动匹配覆盖
+func TestMatchedDetailsKeepsClientDetails(t *testing.T) {
+	service, store := newTestTorrentService(t)
+
+	if err := service.UpdateMovieDetails("abc", &db.MovieDetails{Filename: "movie.mkv", Year: 1999}); err != nil {
+		t.Fatal(err)
+	}
+	err := service.SetMatchedDetails("abc", &db.MovieDetails{Filename: "movie.mkv", Year: 2020}, nil)
+	if !errors.Is(err, db.ErrConcurrentUpdate) {
+		t.Fatalf("err = %v，应为 ErrConcurrentUpdate", err)
+	}
+	record, err := store.GetTorrent("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.MovieDetails == nil || record.MovieDetails.Year != 1999 {
+		t.Errorf("详情 %+v，客户端保存的详情被覆盖", record.MovieDetails)
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/torrentplayer/backend/db"
+)
+
+// Collection 媒体库中的一个TMDB合集（如指环王系列）及其中的电影
+type Collection struct {
+	TmdbId      int                `json:"tmdbId"`
+	Name        string             `json:"name"`
+	PosterUrl   string             `json:"posterUrl,omitempty"`
+	BackdropUrl string             `json:"backdropUrl,omitempty"`
+	Movies      []*CollectionMovie `json:"movies"`
+}
+
+// CollectionMovie 合集中的一个种子
+type CollectionMovie struct {
+	InfoHash    string  `json:"infoHash"`
+	Name        string  `json:"name"`
+	Title       string  `json:"title"`
+	Year        int     `json:"year,omitempty"`
+	ReleaseDate string  `json:"releaseDate,omitempty"`
+	TmdbId      int     `json:"tmdbId,omitempty"`
+	PosterUrl   string  `json:"posterUrl,omitempty"`
+	Rating      float64 `json:"rating,omitempty"`
+	State       string  `json:"state"`
+}
+
+// ListCollections 获取媒体库中的合集，合集内按上映日期排列，只包含符合过滤条件的种子
+func (s *TorrentService) ListCollections(filter TorrentFilter) ([]*Collection, error) {
+	stored, err := s.collections.ListCollections()
+	if err != nil {
+		return nil, err
+	}
+	records, err := s.torrentStore.GetAllTorrents()
+	if err != nil {
+		return nil, err
+	}
+	byHash := make(map[string]*db.TorrentRecord, len(records))
+	for _, record := range records {
+		byHash[record.InfoHash] = record
+	}
+
+	collections := []*Collection{}
+	for _, c := range stored {
+		collection := &Collection{
+			TmdbId:      c.TmdbId,
+			Name:        c.Name,
+			PosterUrl:   c.PosterUrl,
+			BackdropUrl: c.BackdropUrl,
+			Movies:      []*CollectionMovie{},
+		}
+		for _, infoHash := range c.InfoHashes {
+			record := byHash[infoHash]
+			if record == nil || record.MovieDetails == nil || !filter.Match(record.Category, record.Tags) {
+				continue
+			}
+			movie := collectionMovie(record)
+			if state, _, ok := s.states.Get(infoHash); ok {
+				movie.State = string(state)
+			}
+			collection.Movies = append(collection.Movies, movie)
+		}
+		if len(collection.Movies) == 0 {
+			continue
+		}
+
+		// 没有上映日期的排在最后
+		sort.SliceStable(collection.Movies, func(i, j int) bool {
+			a, b := collection.Movies[i].ReleaseDate, collection.Movies[j].ReleaseDate
+			return a != "" && (b == "" || a < b)
+		})
+		collections = append(collections, collection)
+	}
+	return collections, nil
+}
+
+// collectionMovie 将种子记录转换为合集中的电影
+func collectionMovie(record *db.TorrentRecord) *CollectionMovie {
+	details := record.MovieDetails
+	movie := &CollectionMovie{
+		InfoHash:    record.InfoHash,
+		Name:        record.Name,
+		Title:       details.Filename,
+		Year:        details.Year,
+		ReleaseDate: details.ReleaseDate,
+		TmdbId:      details.TmdbId,
+		PosterUrl:   details.PosterUrl,
+		Rating:      details.Rating,
+		State:       record.State,
+	}
+	if movie.Title == "" {
+		movie.Title = record.Name
+	}
+	return movie
+}
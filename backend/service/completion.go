@@ -0,0 +1,99 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/torrentplayer/backend/events"
+	"github.com/torrentplayer/backend/torrent"
+)
+
+// HandleCompletion 处理 torrent 客户端的完成通知：立即更新种子状态，记录到数据库并发布事件
+// 客户端每次启动都会为已有数据重新通知，数据库中的记录保证每个文件和种子只发布一次事件
+func (m *StateMachine) HandleCompletion(c torrent.Completion) {
+	switch c.Kind {
+	case torrent.FilePlayable:
+		first, err := m.torrentStore.MarkFilePlayable(c.InfoHash, c.File.FileIndex, time.Now())
+		if err != nil {
+			log.Printf("警告: %v", err)
+			return
+		}
+		if first {
+			m.bus.Publish(events.TorrentFilePlayable, c.InfoHash, c.File)
+		}
+
+	case torrent.TorrentComplete:
+		m.SyncCompletion(c.InfoHash)
+
+		first, err := m.torrentStore.MarkCompleted(c.InfoHash, time.Now())
+		if err != nil {
+			log.Printf("警告: %v", err)
+			return
+		}
+		if !first {
+			return
+		}
+		info, ok := m.torrentClient.GetTorrentInfo(c.InfoHash)
+		if !ok {
+			return
+		}
+		state, reason, _ := m.Get(c.InfoHash)
+		info.State, info.StateReason = string(state), reason
+		m.bus.Publish(events.TorrentCompleted, c.InfoHash, info)
+	}
+}
+
+// Failure torrent.failed 事件数据
+type Failure struct {
+	Operation string `json:"operation"`
+	Error     string `json:"error"`
+	Attempts  int    `json:"attempts"`
+}
+
+// HandleFailure 处理 torrent 客户端报告的失败（重试后仍然失败）：种子转为 error 状态，
+// 错误保存到 last_error 并发布 torrent.failed 事件；暂停中的种子保持暂停，只记录错误
+func (m *StateMachine) HandleFailure(f torrent.Failure) {
+	message := fmt.Sprintf("%s: %v", f.Op, f.Err)
+	log.Printf("种子操作失败 %s: %s（共尝试 %d 次）", f.InfoHash, message, f.Attempts)
+
+	if err := m.torrentStore.SetLastError(f.InfoHash, message); err != nil {
+		log.Printf("警告: %v", err)
+	}
+
+	m.mu.Lock()
+	if entry, ok := m.states[f.InfoHash]; ok {
+		entry.lastError = message
+		if entry.state.CanTransitionTo(StateError) {
+			if err := m.transitionLocked(f.InfoHash, entry, StateError, message); err != nil {
+				log.Printf("警告: 同步种子状态失败 %s: %v", f.InfoHash, err)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	m.bus.Publish(events.TorrentFailed, f.InfoHash, Failure{Operation: f.Op, Error: f.Err.Error(), Attempts: f.Attempts})
+}
+
+// SyncCompletion 已下载完成的种子立即从 downloading 或 stalled 转换为 completed 或 seeding，
+// 不必等下一次 Reconcile；未完成或暂停中的种子不变
+func (m *StateMachine) SyncCompletion(infoHash string) {
+	activity, ok := m.torrentClient.Activity(infoHash)
+	if !ok || !activity.Complete || activity.Paused {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.states[infoHash]
+	if !ok {
+		return
+	}
+	switch entry.state {
+	case StateDownloading, StateStalled:
+		if err := m.transitionLocked(infoHash, entry, observedState(activity), ""); err != nil {
+			log.Printf("警告: 同步种子状态失败 %s: %v", infoHash, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+	"log"
+
+	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// ConnectionOverride 单个种子的连接数设置，MaxConnections 为 nil 时使用全局设置
+type ConnectionOverride struct {
+	MaxConnections *int `json:"maxConnections"`
+}
+
+// ConnectionStatus 种子的连接数设置
+type ConnectionStatus struct {
+	InfoHash string             `json:"infoHash"`
+	Override ConnectionOverride `json:"override"`
+	// MaxConnections 生效的连接数上限
+	MaxConnections int `json:"maxConnections"`
+}
+
+// GetConnections 获取种子的连接数设置
+func (s *TorrentService) GetConnections(infoHash string) (*ConnectionStatus, error) {
+	if _, err := s.GetTorrent(infoHash); err != nil {
+		return nil, err
+	}
+	stored, err := s.connStore.GetMaxConnections(infoHash)
+	if err != nil {
+		return nil, err
+	}
+	return s.connectionStatus(infoHash, stored), nil
+}
+
+// UpdateConnections 设置单个种子的连接数上限并立即生效，MaxConnections 为 nil 时恢复全局设置
+func (s *TorrentService) UpdateConnections(infoHash string, override *ConnectionOverride) (*ConnectionStatus, error) {
+	if override == nil {
+		override = &ConnectionOverride{}
+	}
+	maxConnections := 0
+	if override.MaxConnections != nil {
+		if *override.MaxConnections <= 0 {
+			return nil, validator.ValidationError{Field: "maxConnections", Message: "必须大于0"}
+		}
+		maxConnections = *override.MaxConnections
+	}
+
+	if err := s.torrentClient.SetTorrentMaxConnections(infoHash, maxConnections); err != nil {
+		if errors.Is(err, torrent.ErrTorrentNotFound) {
+			return nil, ErrTorrentNotFound
+		}
+		return nil, err
+	}
+	if err := s.connStore.SaveMaxConnections(infoHash, maxConnections); err != nil {
+		return nil, err
+	}
+	return s.connectionStatus(infoHash, maxConnections), nil
+}
+
+// restoreConnections 恢复种子时重新应用单独设置的连接数上限
+func (s *TorrentService) restoreConnections(infoHash string) {
+	maxConnections, err := s.connStore.GetMaxConnections(infoHash)
+	if err != nil {
+		log.Printf("警告: %v", err)
+		return
+	}
+	if maxConnections == 0 {
+		return
+	}
+	if err := s.torrentClient.SetTorrentMaxConnections(infoHash, maxConnections); err != nil {
+		log.Printf("警告: 恢复连接数设置失败 %s: %v", infoHash, err)
+	}
+}
+
+// connectionStatus 组合保存的设置与生效的上限，stored 为 0 表示没有单独设置
+func (s *TorrentService) connectionStatus(infoHash string, stored int) *ConnectionStatus {
+	status := &ConnectionStatus{
+		InfoHash:       infoHash,
+		MaxConnections: s.torrentClient.MaxConnections(infoHash),
+	}
+	if stored > 0 {
+		status.Override.MaxConnections = &stored
+	}
+	return status
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/events"
+	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// CreateTorrentOptions 用本地文件制作种子的参数
+type CreateTorrentOptions struct {
+	// Path 数据目录下的文件或目录，相对于数据目录
+	Path string `json:"path"`
+	// PieceLength 分片大小（字节），为 0 时按总大小自动选择
+	PieceLength int64 `json:"pieceLength"`
+	// Trackers 为空时公开种子使用公共 tracker 列表
+	Trackers []string `json:"trackers"`
+	Private  bool     `json:"private"`
+	Comment  string   `json:"comment"`
+}
+
+// CreateTorrent 把数据目录下的文件或目录制作成种子并开始做种，返回磁力链接和种子文件
+// 计算哈希需要读取全部数据，请求取消时停止
+func (s *TorrentService) CreateTorrent(ctx context.Context, opts CreateTorrentOptions) (*torrent.CreatedTorrent, error) {
+	root, err := s.createTorrentRoot(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	pieceLength := opts.PieceLength
+	if pieceLength != 0 && (pieceLength < torrent.MinPieceLength || pieceLength > torrent.MaxPieceLength || pieceLength&(pieceLength-1) != 0) {
+		return nil, validator.ValidationError{Field: "pieceLength", Message: "必须为 16KiB 到 16MiB 之间的 2 的幂"}
+	}
+	trackers := opts.Trackers
+	if len(trackers) > 0 {
+		if err := validateTrackerURLs(trackers); err != nil {
+			var validationErr validator.ValidationError
+			if errors.As(err, &validationErr) {
+				validationErr.Field = "trackers"
+				return nil, validationErr
+			}
+			return nil, err
+		}
+	} else if opts.Private {
+		// 私有种子不使用 DHT 和 PEX，只能通过 tracker 找到 peer
+		return nil, validator.ValidationError{Field: "trackers", Message: "私有种子至少需要一个 tracker"}
+	} else {
+		trackers = s.torrentClient.PublicTrackers()
+	}
+
+	created, err := s.torrentClient.CreateTorrent(ctx, torrent.CreateOptions{
+		Root:        root,
+		PieceLength: pieceLength,
+		Trackers:    trackers,
+		Private:     opts.Private,
+		Comment:     opts.Comment,
+	})
+	switch {
+	case errors.Is(err, torrent.ErrNoFiles):
+		return nil, validator.ValidationError{Field: "path", Message: "没有可制作种子的文件"}
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case err != nil:
+		return nil, fmt.Errorf("制作种子失败: %w", err)
+	}
+
+	// 已存在的种子直接返回，不改动其记录和状态
+	if _, _, tracked := s.states.Get(created.InfoHash); tracked || !created.New {
+		return created, nil
+	}
+
+	record := &db.TorrentRecord{
+		InfoHash:  created.InfoHash,
+		Name:      created.Name,
+		MagnetURI: created.MagnetURI,
+		DataPath:  created.DataPath,
+		Length:    created.Length,
+		Private:   created.Private,
+		AddedAt:   time.Now(),
+		State:     string(StateQueued),
+		AddedBy:   userIDFromContext(ctx),
+	}
+	if err := s.torrentStore.AddTorrent(record); err != nil {
+		slog.WarnContext(ctx, "保存制作的种子到数据库失败", "info_hash", created.InfoHash, "error", err)
+	}
+	// 没有其他 peer 有这个种子的元数据，重启后只能从保存的元数据恢复
+	if infoBytes, ok := s.torrentClient.InfoBytes(created.InfoHash); ok {
+		if err := s.torrentStore.SaveInfoBytes(created.InfoHash, infoBytes); err != nil {
+			slog.WarnContext(ctx, "保存种子元数据失败", "info_hash", created.InfoHash, "error", err)
+		}
+	}
+
+	s.states.Track(created.InfoHash, StateQueued, "")
+	s.metadataQueue.Enqueue(created.InfoHash)
+	if info, err := s.GetTorrent(created.InfoHash); err == nil {
+		s.bus.Publish(events.TorrentAdded, created.InfoHash, info)
+	}
+
+	slog.InfoContext(ctx, "已制作种子", "info_hash", created.InfoHash, "name", created.Name, "pieces", created.Pieces)
+	return created, nil
+}
+
+// createTorrentRoot 把相对于数据目录的路径转换为绝对路径，不允许离开数据目录或使用隐藏目录
+func (s *TorrentService) createTorrentRoot(path string) (string, error) {
+	if path == "" {
+		return "", validator.ValidationError{Field: "path", Message: "不能为空"}
+	}
+	rel := filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(rel) || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", validator.ValidationError{Field: "path", Message: "必须为数据目录下的相对路径"}
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.HasPrefix(part, ".") {
+			return "", validator.ValidationError{Field: "path", Message: "不能使用隐藏文件或目录"}
+		}
+	}
+
+	// 符号链接解析后仍须在数据目录中
+	dataDir, err := filepath.Abs(s.config.Torrent.DataDir)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(dataDir); err == nil {
+		dataDir = resolved
+	}
+	root, err := filepath.EvalSymlinks(filepath.Join(dataDir, rel))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", validator.ValidationError{Field: "path", Message: "文件或目录不存在"}
+	}
+	if err != nil {
+		return "", err
+	}
+	if inside, err := filepath.Rel(dataDir, root); err != nil || inside == "." || inside == ".." || strings.HasPrefix(inside, ".."+string(filepath.Separator)) {
+		return "", validator.ValidationError{Field: "path", Message: "必须为数据目录下的相对路径"}
+	}
+	return root, nil
+}
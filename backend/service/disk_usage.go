@@ -0,0 +1,22 @@
+package service
+
+// DiskUsage 磁盘空间使用情况
+type DiskUsage struct {
+	Path        string  `json:"path"`
+	Total       uint64  `json:"total"`
+	Free        uint64  `json:"free"`
+	Used        uint64  `json:"used"`
+	UsedPercent float64 `json:"usedPercent"`
+}
+
+// newDiskUsage 根据总空间和可用空间计算使用率
+func newDiskUsage(path string, total, free uint64) *DiskUsage {
+	usage := &DiskUsage{Path: path, Total: total, Free: free}
+	if total > free {
+		usage.Used = total - free
+	}
+	if total > 0 {
+		usage.UsedPercent = float64(usage.Used) / float64(total) * 100
+	}
+	return usage
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package service
+
+import "syscall"
+
+// diskUsage 获取 path 所在磁盘的使用情况
+func diskUsage(path string) (*DiskUsage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return nil, err
+	}
+
+	blockSize := uint64(stat.Bsize)
+	return newDiskUsage(path, stat.Blocks*blockSize, stat.Bavail*blockSize), nil
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package service
+
+import "errors"
+
+// diskUsage Windows 下暂不支持磁盘使用率规则
+func diskUsage(path string) (*DiskUsage, error) {
+	return nil, errors.New("当前平台不支持获取磁盘使用率")
+}
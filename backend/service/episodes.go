@@ -0,0 +1,85 @@
+package service
+
+import (
+	"github.com/torrentplayer/backend/db"
+)
+
+// 剧集和电影详情的数据来源
+const (
+	ProviderTMDB    = "tmdb"
+	ProviderAniList = "anilist"
+)
+
+// ShowMatchRequest 剧集匹配请求，TmdbId 不为 0 时直接使用该剧集，否则按 Name 和 Year 搜索
+// Provider 为 anilist 或 AnilistId 不为 0 时从AniList查找动画，文件的绝对集数会换算为季集编号
+type ShowMatchRequest struct {
+	Name      string `json:"name"`
+	Year      int    `json:"year"`
+	TmdbId    int    `json:"tmdbId"`
+	AnilistId int    `json:"anilistId"`
+	Provider  string `json:"provider"`
+}
+
+// ShowMatch 剧集匹配结果
+type ShowMatch struct {
+	Show     *db.MovieDetails `json:"show"`
+	Episodes []*db.Episode    `json:"episodes"`
+	// UnmatchedFiles 文件名中没有季集编号的视频文件索引
+	UnmatchedFiles []int `json:"unmatchedFiles"`
+}
+
+// SetShowDetails 保存剧集匹配结果：剧集详情写入种子的电影详情，各文件的剧集信息整体替换
+func (s *TorrentService) SetShowDetails(infoHash string, match *ShowMatch) error {
+	if _, _, ok := s.states.Get(infoHash); !ok {
+		return ErrTorrentNotFound
+	}
+
+	for _, episode := range match.Episodes {
+		episode.InfoHash = infoHash
+	}
+	if err := s.episodeStore.ReplaceEpisodes(infoHash, match.Episodes); err != nil {
+		return err
+	}
+	return s.UpdateMovieDetails(infoHash, match.Show)
+}
+
+// GetEpisodes 获取种子各文件匹配到的剧集信息
+func (s *TorrentService) GetEpisodes(infoHash string) ([]*db.Episode, error) {
+	if _, _, ok := s.states.Get(infoHash); !ok {
+		return nil, ErrTorrentNotFound
+	}
+	return s.episodeStore.ListEpisodes(infoHash)
+}
+
+// SetMovieDetails 保存电影详情，并删除之前按剧集匹配时保存的各文件剧集信息
+func (s *TorrentService) SetMovieDetails(infoHash string, details *db.MovieDetails) error {
+	if _, _, ok := s.states.Get(infoHash); !ok {
+		return ErrTorrentNotFound
+	}
+
+	if err := s.episodeStore.DeleteTorrentEpisodes(infoHash); err != nil {
+		return err
+	}
+	return s.UpdateMovieDetails(infoHash, details)
+}
+
+// SetMatchedDetails 保存后台自动匹配的结果。详情只在种子仍没有详情时写入，
+// 匹配期间详情被客户端保存或重新匹配过时返回 db.ErrConcurrentUpdate，不覆盖新的详情；
+// 写入后再整体替换各文件的剧集信息，电影的 episodes 为 nil
+func (s *TorrentService) SetMatchedDetails(infoHash string, details *db.MovieDetails, episodes []*db.Episode) error {
+	if _, _, ok := s.states.Get(infoHash); !ok {
+		return ErrTorrentNotFound
+	}
+
+	if err := s.torrentStore.UpdateFieldsIfDetailsUnchanged(infoHash, map[string]any{"movie_details": details}, nil); err != nil {
+		return err
+	}
+	for _, episode := range episodes {
+		episode.InfoHash = infoHash
+	}
+	if err := s.episodeStore.ReplaceEpisodes(infoHash, episodes); err != nil {
+		return err
+	}
+	s.detailsSaved(infoHash, details)
+	return nil
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/torrentplayer/backend/config"
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/validator"
+)
+
+const (
+	// imageCacheDirName 图片缓存目录，位于数据目录下，以点开头避免与种子目录重名
+	imageCacheDirName = ".images"
+	// imageFetchTimeout 下载一张图片的超时时间
+	imageFetchTimeout = 30 * time.Second
+	// imageMaxSize 图片的最大字节数
+	imageMaxSize = 20 << 20
+)
+
+// 支持的图片类型和媒体类型
+const (
+	ImagePoster     = "poster"
+	ImageBackdrop   = "backdrop"
+	MediaMovie      = "movie"
+	MediaTV         = "tv"
+	MediaCollection = "collection"
+)
+
+// imageExtensions 允许缓存的图片扩展名
+var imageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
+
+// ErrImageNotFound 媒体库中没有该图片
+var ErrImageNotFound = errors.New("图片不存在")
+
+// ImageCache 代理并缓存媒体库的海报和背景图，客户端不必直接访问 image.tmdb.org，离线时也能浏览
+// 图片地址来自已保存的电影或剧集详情，首次请求时下载，之后直接读取本地文件
+type ImageCache struct {
+	dir          string
+	torrentStore *db.TorrentStore
+	httpClient   *http.Client
+
+	// downloads 每张图片一把锁，避免同一张图片被并发请求重复下载
+	mu        sync.Mutex
+	downloads map[string]*sync.Mutex
+}
+
+// NewImageCache 创建图片缓存
+func NewImageCache(store *db.TorrentStore, cfg *config.Config) *ImageCache {
+	return &ImageCache{
+		dir:          filepath.Join(cfg.Torrent.DataDir, imageCacheDirName),
+		torrentStore: store,
+		httpClient:   &http.Client{Timeout: imageFetchTimeout},
+		downloads:    make(map[string]*sync.Mutex),
+	}
+}
+
+// GetImage 返回图片的本地文件路径，未缓存时从详情中的地址下载
+// media 为 movie、tv 或 collection，TMDB 的电影、剧集和合集ID互相独立
+func (c *ImageCache) GetImage(tmdbID int, imageType, media string) (string, error) {
+	if tmdbID <= 0 {
+		return "", validator.ValidationError{Field: "tmdbId", Message: "TMDB ID必须为正整数"}
+	}
+	if imageType != ImagePoster && imageType != ImageBackdrop {
+		return "", validator.ValidationError{Field: "type", Message: "图片类型必须为 poster 或 backdrop"}
+	}
+	if media == "" {
+		media = MediaMovie
+	}
+	if media != MediaMovie && media != MediaTV && media != MediaCollection {
+		return "", validator.ValidationError{Field: "media", Message: "媒体类型必须为 movie、tv 或 collection"}
+	}
+
+	key := fmt.Sprintf("%s-%d-%s", media, tmdbID, imageType)
+	if cached := c.cachedFile(key); cached != "" {
+		return cached, nil
+	}
+
+	lock := c.downloadLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// 等待锁期间其他请求可能已经下载完成
+	if cached := c.cachedFile(key); cached != "" {
+		return cached, nil
+	}
+
+	sourceURL, err := c.sourceURL(tmdbID, imageType, media)
+	if err != nil {
+		return "", err
+	}
+	return c.download(key, sourceURL)
+}
+
+// cachedFile 查找已缓存的图片，不存在时返回空字符串
+func (c *ImageCache) cachedFile(key string) string {
+	matches, _ := filepath.Glob(filepath.Join(c.dir, key+".*"))
+	for _, match := range matches {
+		if imageExtensions[filepath.Ext(match)] {
+			return match
+		}
+	}
+	return ""
+}
+
+// downloadLock 返回图片对应的下载锁
+func (c *ImageCache) downloadLock(key string) *sync.Mutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lock, ok := c.downloads[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		c.downloads[key] = lock
+	}
+	return lock
+}
+
+// sourceURL 从已保存的详情中查找图片地址
+func (c *ImageCache) sourceURL(tmdbID int, imageType, media string) (string, error) {
+	records, err := c.torrentStore.GetAllTorrents()
+	if err != nil {
+		return "", err
+	}
+
+	for _, record := range records {
+		details := record.MovieDetails
+		if details == nil {
+			continue
+		}
+		var imageURL string
+		switch {
+		case media == MediaCollection:
+			if details.Collection == nil || details.Collection.TmdbId != tmdbID {
+				continue
+			}
+			imageURL = details.Collection.PosterUrl
+			if imageType == ImageBackdrop {
+				imageURL = details.Collection.BackdropUrl
+			}
+		case details.TmdbId != tmdbID || (details.MediaType == MediaTV) != (media == MediaTV):
+			continue
+		default:
+			imageURL = details.PosterUrl
+			if imageType == ImageBackdrop {
+				imageURL = details.BackdropUrl
+			}
+		}
+		// 没有图片时旧数据只保存了图片地址前缀，没有文件扩展名
+		if imageExt(imageURL) != "" {
+			return imageURL, nil
+		}
+	}
+	return "", ErrImageNotFound
+}
+
+// download 下载图片到缓存目录，先写入临时文件再重命名，避免读取到不完整的图片
+func (c *ImageCache) download(key, sourceURL string) (string, error) {
+	resp, err := c.httpClient.Get(sourceURL)
+	if err != nil {
+		return "", fmt.Errorf("下载图片失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrImageNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("下载图片失败: %s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "image/") {
+		return "", fmt.Errorf("下载图片失败: 不是图片 (%s)", mediaType)
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return "", fmt.Errorf("创建图片缓存目录失败: %w", err)
+	}
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("保存图片失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, io.LimitReader(resp.Body, imageMaxSize+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("保存图片失败: %w", err)
+	}
+	if n > imageMaxSize {
+		return "", fmt.Errorf("下载图片失败: 图片超过 %d 字节", imageMaxSize)
+	}
+
+	target := filepath.Join(c.dir, key+imageExt(sourceURL))
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", fmt.Errorf("保存图片失败: %w", err)
+	}
+	return target, nil
+}
+
+// imageExt 返回图片地址的扩展名，不支持的格式返回空字符串
+func imageExt(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	ext := strings.ToLower(path.Ext(u.Path))
+	if !imageExtensions[ext] {
+		return ""
+	}
+	return ext
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/torrentplayer/backend/config"
+	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/validator"
+)
+
+const (
+	// indexerDefaultLimit 默认返回的搜索结果数
+	indexerDefaultLimit = 50
+	// indexerMaxLimit 最多返回的搜索结果数
+	indexerMaxLimit = 100
+	// indexerMaxResponseSize 搜索结果的最大字节数
+	indexerMaxResponseSize = 10 << 20
+)
+
+var (
+	// ErrIndexerNotConfigured 未设置 INDEXER_URL
+	ErrIndexerNotConfigured = errors.New("未配置种子索引器")
+	// ErrIndexerFailed 索引器请求失败或返回了错误
+	ErrIndexerFailed = errors.New("索引器搜索失败")
+)
+
+// IndexerSearchQuery 搜索条件
+type IndexerSearchQuery struct {
+	Query      string
+	Categories []int // Torznab 分类，如 2000 电影、5000 剧集，为空时搜索所有分类
+	Limit      int
+}
+
+// IndexerResult 一条搜索结果，添加时把整条结果提交给 AddResult
+type IndexerResult struct {
+	Title       string     `json:"title"`
+	Indexer     string     `json:"indexer,omitempty"`
+	Size        int64      `json:"size"`
+	Seeders     int        `json:"seeders"`
+	Leechers    int        `json:"leechers"`
+	Grabs       int        `json:"grabs,omitempty"`
+	Categories  []int      `json:"categories,omitempty"`
+	InfoHash    string     `json:"infoHash,omitempty"`
+	MagnetURI   string     `json:"magnetUri,omitempty"`
+	DownloadURL string     `json:"downloadUrl,omitempty"`
+	InfoURL     string     `json:"infoUrl,omitempty"`
+	PublishedAt *time.Time `json:"publishedAt,omitempty"`
+}
+
+// IndexerAddRequest 添加搜索结果的请求，优先使用磁力链接，其次下载种子文件，最后使用 info hash
+type IndexerAddRequest struct {
+	Title       string `json:"title"`
+	MagnetURI   string `json:"magnetUri"`
+	DownloadURL string `json:"downloadUrl"`
+	InfoHash    string `json:"infoHash"`
+	Private     bool   `json:"private"`
+}
+
+// IndexerService 通过 Torznab 接口（Jackett、Prowlarr）搜索种子，并把搜索结果添加为种子
+type IndexerService struct {
+	endpoint   *url.URL
+	apiKey     string
+	torrents   *TorrentService
+	httpClient *http.Client
+}
+
+// NewIndexerService 创建索引器搜索服务，未设置 INDEXER_URL 时搜索返回 ErrIndexerNotConfigured
+func NewIndexerService(torrents *TorrentService, cfg *config.Config) *IndexerService {
+	s := &IndexerService{
+		apiKey:     cfg.Indexer.APIKey,
+		torrents:   torrents,
+		httpClient: newTorrentHTTPClient(time.Duration(cfg.Indexer.TimeoutSec) * time.Second),
+	}
+	if cfg.Indexer.URL != "" {
+		s.endpoint, _ = url.Parse(torznabEndpoint(cfg.Indexer.URL))
+	}
+	return s
+}
+
+// Search 搜索种子，结果按做种数从多到少排列
+func (s *IndexerService) Search(ctx context.Context, query IndexerSearchQuery) ([]IndexerResult, error) {
+	if s.endpoint == nil {
+		return nil, ErrIndexerNotConfigured
+	}
+	query.Query = strings.TrimSpace(query.Query)
+	if query.Query == "" {
+		return nil, validator.ValidationError{Field: "q", Message: "搜索关键词不能为空"}
+	}
+	if query.Limit <= 0 {
+		query.Limit = indexerDefaultLimit
+	}
+	if query.Limit > indexerMaxLimit {
+		query.Limit = indexerMaxLimit
+	}
+
+	params := s.endpoint.Query()
+	params.Set("t", "search")
+	params.Set("q", query.Query)
+	params.Set("limit", strconv.Itoa(query.Limit))
+	if s.apiKey != "" {
+		params.Set("apikey", s.apiKey)
+	}
+	if len(query.Categories) > 0 {
+		categories := make([]string, len(query.Categories))
+		for i, category := range query.Categories {
+			categories[i] = strconv.Itoa(category)
+		}
+		params.Set("cat", strings.Join(categories, ","))
+	}
+	searchURL := *s.endpoint
+	searchURL.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, searchURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		// 错误信息中的地址带有 API 密钥，不返回给客户端
+		return nil, fmt.Errorf("%w: 无法连接索引器", ErrIndexerFailed)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, indexerMaxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIndexerFailed, err)
+	}
+	// Torznab 的错误以 <error code="100" description="..."/> 返回，状态码可能是 200
+	var torznabErr struct {
+		XMLName     xml.Name `xml:"error"`
+		Code        string   `xml:"code,attr"`
+		Description string   `xml:"description,attr"`
+	}
+	if xml.Unmarshal(data, &torznabErr) == nil {
+		return nil, fmt.Errorf("%w: %s (%s)", ErrIndexerFailed, torznabErr.Description, torznabErr.Code)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: HTTP %d", ErrIndexerFailed, resp.StatusCode)
+	}
+
+	results, err := parseTorznabResults(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIndexerFailed, err)
+	}
+	if len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+	return results, nil
+}
+
+// AddResult 把搜索结果添加为种子，种子文件只从索引器的地址下载
+func (s *IndexerService) AddResult(ctx context.Context, req *IndexerAddRequest) (*torrent.TorrentInfo, error) {
+	magnetURI, private := strings.TrimSpace(req.MagnetURI), req.Private
+	switch {
+	case magnetURI != "":
+	case req.DownloadURL != "":
+		if err := s.validateDownloadURL(req.DownloadURL); err != nil {
+			return nil, err
+		}
+		var privateFile bool
+		var err error
+		magnetURI, privateFile, err = resolveTorrentURL(s.httpClient, req.DownloadURL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrIndexerFailed, err)
+		}
+		private = private || privateFile
+	case req.InfoHash != "":
+		magnetURI = magnetFromInfoHash(req.InfoHash, req.Title)
+	default:
+		return nil, validator.ValidationError{Field: "magnetUri", Message: "需要磁力链接、种子文件地址或 info hash"}
+	}
+
+	magnetValidator := &validator.MagnetValidator{}
+	if err := magnetValidator.ValidateMagnetURI(magnetURI); err != nil {
+		return nil, err
+	}
+	return s.torrents.AddMagnet(ctx, magnetURI, private)
+}
+
+// validateDownloadURL 种子文件地址必须指向配置的索引器，避免服务器替客户端请求任意地址
+func (s *IndexerService) validateDownloadURL(rawURL string) error {
+	if s.endpoint == nil {
+		return ErrIndexerNotConfigured
+	}
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || !isHTTPURL(rawURL) || !strings.EqualFold(u.Host, s.endpoint.Host) {
+		return validator.ValidationError{Field: "downloadUrl", Message: "必须为索引器提供的地址"}
+	}
+	return nil
+}
+
+// torznabEndpoint 补全 Torznab 接口路径，Jackett 的地址通常以 /torznab/ 结尾，
+// 与 Sonarr、Radarr 一样在其后加上 api
+func torznabEndpoint(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), "/api") {
+		return rawURL
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api"
+	return u.String()
+}
+
+// parseTorznabResults 解析 Torznab 搜索结果，忽略没有磁力链接、种子文件和 info hash 的条目
+func parseTorznabResults(data []byte) ([]IndexerResult, error) {
+	var doc rssDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("解析搜索结果失败: %w", err)
+	}
+
+	results := make([]IndexerResult, 0, len(doc.Channel.Items))
+	for _, e := range doc.Channel.Items {
+		item := e.item()
+		if item.TorrentURL == "" {
+			// Jackett 的下载地址是 link，通常没有 .torrent 后缀
+			for _, link := range e.Links {
+				if isHTTPURL(link) {
+					item.TorrentURL = strings.TrimSpace(link)
+					break
+				}
+			}
+		}
+		if item.MagnetURI == "" && item.TorrentURL == "" && item.InfoHash == "" {
+			continue
+		}
+
+		result := IndexerResult{
+			Title:       item.Title,
+			Indexer:     firstNonEmpty(e.JackettIndexer, e.ProwlarrIndexer),
+			Size:        e.Size,
+			Seeders:     atoiOrZero(e.attr("seeders")),
+			Grabs:       atoiOrZero(e.attr("grabs")),
+			InfoHash:    strings.ToLower(item.InfoHash),
+			MagnetURI:   item.MagnetURI,
+			DownloadURL: item.TorrentURL,
+			InfoURL:     strings.TrimSpace(e.Comments),
+		}
+		if size, err := strconv.ParseInt(e.attr("size"), 10, 64); err == nil && size > 0 {
+			result.Size = size
+		}
+		if result.Size == 0 {
+			result.Size = e.Enclosure.Length
+		}
+		// peers 是做种和下载的总数
+		if peers := atoiOrZero(e.attr("peers")); peers > result.Seeders {
+			result.Leechers = peers - result.Seeders
+		}
+		for _, attr := range e.Attrs {
+			if strings.EqualFold(attr.Name, "category") {
+				if category, err := strconv.Atoi(strings.TrimSpace(attr.Value)); err == nil {
+					result.Categories = append(result.Categories, category)
+				}
+			}
+		}
+		if published, err := time.Parse(time.RFC1123Z, strings.TrimSpace(e.PubDate)); err == nil {
+			result.PublishedAt = &published
+		}
+		results = append(results, result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Seeders > results[j].Seeders
+	})
+	return results, nil
+}
+
+// atoiOrZero 解析整数，无效时返回 0
+func atoiOrZero(value string) int {
+	number, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0
+	}
+	return number
+}
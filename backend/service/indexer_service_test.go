@@ -0,0 +1,61 @@
+package service
+
+import "testing"
+
+func TestParseTorznabResults(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:torznab="http://torznab.com/schemas/2015/feed">
+<channel>
+	<item>
+		<title>Few seeders</title>
+		<jackettindexer id="x">Indexer</jackettindexer>
+		<size>1000</size>
+		<link>http://jackett:9117/dl/x/?path=1</link>
+		<pubDate>Mon, 12 Oct 2026 10:00:00 +0000</pubDate>
+		<torznab:attr name="category" value="2000"/>
+		<torznab:attr name="seeders" value="5"/>
+		<torznab:attr name="peers" value="12"/>
+	</item>
+	<item>
+		<title>Many seeders</title>
+		<torznab:attr name="size" value="2000"/>
+		<torznab:attr name="seeders" value="50"/>
+		<torznab:attr name="magneturl" value="magnet:?xt=urn:btih:1111111111111111111111111111111111111111"/>
+	</item>
+	<item>
+		<title>Nothing to add</title>
+		<comments>https://example.org/details/3</comments>
+	</item>
+</channel>
+</rss>`)
+
+	results, err := parseTorznabResults(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+
+	if results[0].Title != "Many seeders" || results[0].Size != 2000 || results[0].MagnetURI == "" {
+		t.Errorf("magnet result: %+v", results[0])
+	}
+	r := results[1]
+	if r.Indexer != "Indexer" || r.Size != 1000 || r.Seeders != 5 || r.Leechers != 7 ||
+		r.DownloadURL != "http://jackett:9117/dl/x/?path=1" || len(r.Categories) != 1 || r.PublishedAt == nil {
+		t.Errorf("download result: %+v", r)
+	}
+}
+
+func TestTorznabEndpoint(t *testing.T) {
+	tests := map[string]string{
+		"http://jackett:9117/api/v2.0/indexers/all/results/torznab/":    "http://jackett:9117/api/v2.0/indexers/all/results/torznab/api",
+		"http://jackett:9117/api/v2.0/indexers/all/results/torznab/api": "http://jackett:9117/api/v2.0/indexers/all/results/torznab/api",
+		"http://prowlarr:9696/1/api":                                    "http://prowlarr:9696/1/api",
+	}
+	for raw, want := range tests {
+		if got := torznabEndpoint(raw); got != want {
+			t.Errorf("torznabEndpoint(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
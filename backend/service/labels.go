@@ -0,0 +1,259 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/validator"
+)
+
+const (
+	// maxLabelLength 分类和单个标签的最大长度（字符数）
+	maxLabelLength = 64
+	// maxTags 单个种子的最大标签数
+	maxTags = 32
+)
+
+// Labels 种子的分类和标签
+type Labels struct {
+	Category string
+	Tags     []string
+}
+
+// LabelCount 分类或标签下的种子数
+type LabelCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// LabelSummary 所有分类和标签的使用情况
+type LabelSummary struct {
+	Categories []LabelCount `json:"categories"`
+	Tags       []LabelCount `json:"tags"`
+}
+
+// TorrentFilter 种子列表过滤条件，Category 为空时不按分类过滤，Tags 需全部匹配
+type TorrentFilter struct {
+	Category string
+	Tags     []string
+}
+
+// Match 判断分类和标签是否满足过滤条件
+func (f TorrentFilter) Match(category string, tags []string) bool {
+	if f.Category != "" && !strings.EqualFold(f.Category, category) {
+		return false
+	}
+	for _, want := range f.Tags {
+		found := false
+		for _, tag := range tags {
+			if strings.EqualFold(want, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// labelIndex 种子分类和标签的内存索引，列表过滤时无需查询数据库
+type labelIndex struct {
+	mu     sync.RWMutex
+	labels map[string]Labels
+}
+
+func newLabelIndex() *labelIndex {
+	return &labelIndex{labels: make(map[string]Labels)}
+}
+
+// get 获取种子的分类和标签
+func (l *labelIndex) get(infoHash string) Labels {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.labels[infoHash]
+}
+
+// set 记录种子的分类和标签
+func (l *labelIndex) set(infoHash string, labels Labels) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if labels.Category == "" && len(labels.Tags) == 0 {
+		delete(l.labels, infoHash)
+		return
+	}
+	l.labels[infoHash] = labels
+}
+
+// forget 移除种子的分类和标签
+func (l *labelIndex) forget(infoHash string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.labels, infoHash)
+}
+
+// update 在锁内修改种子的标签，save 成功后才更新索引
+func (l *labelIndex) update(infoHash string, change func(Labels) (Labels, error), save func(Labels) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	labels, err := change(l.labels[infoHash])
+	if err != nil {
+		return err
+	}
+	if err := save(labels); err != nil {
+		return err
+	}
+	if labels.Category == "" && len(labels.Tags) == 0 {
+		delete(l.labels, infoHash)
+	} else {
+		l.labels[infoHash] = labels
+	}
+	return nil
+}
+
+// summary 统计各分类和标签下的种子数，按名称排序
+func (l *labelIndex) summary() *LabelSummary {
+	l.mu.RLock()
+	categories := make(map[string]int)
+	tags := make(map[string]int)
+	for _, labels := range l.labels {
+		if labels.Category != "" {
+			categories[labels.Category]++
+		}
+		for _, tag := range labels.Tags {
+			tags[tag]++
+		}
+	}
+	l.mu.RUnlock()
+
+	return &LabelSummary{
+		Categories: sortedCounts(categories),
+		Tags:       sortedCounts(tags),
+	}
+}
+
+func sortedCounts(counts map[string]int) []LabelCount {
+	result := make([]LabelCount, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, LabelCount{Name: name, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// normalizeLabel 去除首尾空白并转为小写，过滤时不区分大小写
+func normalizeLabel(field, label string) (string, error) {
+	label = strings.ToLower(strings.TrimSpace(label))
+	if utf8.RuneCountInString(label) > maxLabelLength {
+		return "", validator.ValidationError{Field: field, Message: fmt.Sprintf("不能超过%d个字符", maxLabelLength)}
+	}
+	return label, nil
+}
+
+// normalizeTags 规范化标签并去重，忽略空标签
+func normalizeTags(tags []string) ([]string, error) {
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag, err := normalizeLabel("tags", tag)
+		if err != nil {
+			return nil, err
+		}
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	if len(result) > maxTags {
+		return nil, validator.ValidationError{Field: "tags", Message: fmt.Sprintf("标签不能超过%d个", maxTags)}
+	}
+	return result, nil
+}
+
+// SetCategory 设置种子分类，空字符串表示取消分类
+func (s *TorrentService) SetCategory(infoHash, category string) (*torrent.TorrentInfo, error) {
+	category, err := normalizeLabel("category", category)
+	if err != nil {
+		return nil, err
+	}
+	return s.updateLabels(infoHash, func(labels Labels) (Labels, error) {
+		labels.Category = category
+		return labels, nil
+	})
+}
+
+// SetTags 替换种子的全部标签
+func (s *TorrentService) SetTags(infoHash string, tags []string) (*torrent.TorrentInfo, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	return s.updateLabels(infoHash, func(labels Labels) (Labels, error) {
+		labels.Tags = tags
+		return labels, nil
+	})
+}
+
+// AddTags 为种子添加标签，已有的标签保持不变
+func (s *TorrentService) AddTags(infoHash string, tags []string) (*torrent.TorrentInfo, error) {
+	return s.updateLabels(infoHash, func(labels Labels) (Labels, error) {
+		merged, err := normalizeTags(append(append([]string{}, labels.Tags...), tags...))
+		if err != nil {
+			return Labels{}, err
+		}
+		labels.Tags = merged
+		return labels, nil
+	})
+}
+
+// RemoveTags 移除种子的指定标签
+func (s *TorrentService) RemoveTags(infoHash string, tags []string) (*torrent.TorrentInfo, error) {
+	removed := make(map[string]bool)
+	for _, tag := range tags {
+		removed[strings.ToLower(strings.TrimSpace(tag))] = true
+	}
+	return s.updateLabels(infoHash, func(labels Labels) (Labels, error) {
+		kept := make([]string, 0, len(labels.Tags))
+		for _, tag := range labels.Tags {
+			if !removed[tag] {
+				kept = append(kept, tag)
+			}
+		}
+		labels.Tags = kept
+		return labels, nil
+	})
+}
+
+// updateLabels 修改种子分类或标签并保存到数据库，返回最新的种子信息
+func (s *TorrentService) updateLabels(infoHash string, change func(Labels) (Labels, error)) (*torrent.TorrentInfo, error) {
+	if _, _, ok := s.states.Get(infoHash); !ok {
+		return nil, ErrTorrentNotFound
+	}
+
+	err := s.labels.update(infoHash, change, func(labels Labels) error {
+		return s.torrentStore.SetLabels(infoHash, labels.Category, labels.Tags)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTorrent(infoHash)
+}
+
+// ListLabels 获取所有分类和标签及其种子数
+func (s *TorrentService) ListLabels() *LabelSummary {
+	return s.labels.summary()
+}
+
+// applyLabels 用内存索引中的分类和标签填充种子信息
+func (s *TorrentService) applyLabels(info *torrent.TorrentInfo) {
+	labels := s.labels.get(info.InfoHash)
+	info.Category = labels.Category
+	info.Tags = labels.Tags
+}
@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/events"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// LibraryExportVersion 媒体库导出格式的版本，格式不兼容地变化时递增
+const LibraryExportVersion = 1
+
+// LibraryExport 可移植的媒体库导出文档，用于迁移到另一台服务器
+type LibraryExport struct {
+	Version    int              `json:"version"`
+	ExportedAt time.Time        `json:"exportedAt"`
+	Torrents   []LibraryTorrent `json:"torrents"`
+}
+
+// LibraryTorrent 导出的单个种子，不包含下载的数据和数据目录
+type LibraryTorrent struct {
+	InfoHash  string `json:"infoHash"`
+	Name      string `json:"name"`
+	MagnetURI string `json:"magnetUri"`
+	// Info 种子的元数据，导入后无需再从 peer 获取
+	Info         []byte            `json:"info,omitempty"`
+	Private      bool              `json:"private,omitempty"`
+	Category     string            `json:"category,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	AddedAt      time.Time         `json:"addedAt"`
+	WatchedAt    *time.Time        `json:"watchedAt,omitempty"`
+	MovieDetails *db.MovieDetails  `json:"movieDetails,omitempty"`
+	Episodes     []*db.Episode     `json:"episodes,omitempty"`
+	Playback     []LibraryPosition `json:"playback,omitempty"`
+}
+
+// LibraryPosition 导出的播放进度，导入时按用户名对应到本机用户；关闭认证时记录的进度用户名为空
+type LibraryPosition struct {
+	Username  string    `json:"username,omitempty"`
+	FileIndex int       `json:"fileIndex"`
+	Position  float64   `json:"position"`
+	Duration  float64   `json:"duration"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// LibraryImportResult 媒体库导入结果
+type LibraryImportResult struct {
+	Results []LibraryImportItem `json:"results"`
+	// Positions 导入的播放进度数，PositionsSkipped 因本机没有同名用户而跳过的播放进度数
+	Positions        int `json:"positions"`
+	PositionsSkipped int `json:"positionsSkipped"`
+}
+
+// LibraryImportItem 单个种子的导入结果
+type LibraryImportItem struct {
+	InfoHash string `json:"infoHash"`
+	Name     string `json:"name"`
+	Status   string `json:"status"` // imported、exists、failed
+	Error    string `json:"error,omitempty"`
+}
+
+// LibraryService 媒体库导出和导入服务
+type LibraryService struct {
+	torrentService *TorrentService
+	playbackStore  *db.PlaybackStore
+	userStore      *db.UserStore
+}
+
+// NewLibraryService 创建媒体库导出和导入服务实例
+func NewLibraryService(torrentService *TorrentService, playbackStore *db.PlaybackStore, userStore *db.UserStore) *LibraryService {
+	return &LibraryService{
+		torrentService: torrentService,
+		playbackStore:  playbackStore,
+		userStore:      userStore,
+	}
+}
+
+// Export 导出所有种子的磁力链接、元数据、电影详情、分类标签和所有用户的播放进度
+func (s *LibraryService) Export() (*LibraryExport, error) {
+	store := s.torrentService.torrentStore
+
+	records, err := store.GetAllTorrents()
+	if err != nil {
+		return nil, err
+	}
+	retention, err := store.ListRetention()
+	if err != nil {
+		return nil, err
+	}
+	watched := make(map[string]*time.Time, len(retention))
+	for _, record := range retention {
+		watched[record.InfoHash] = record.WatchedAt
+	}
+
+	users, err := s.userStore.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	usernames := make(map[int64]string, len(users))
+	for _, user := range users {
+		usernames[user.ID] = user.Username
+	}
+	positions, err := s.playbackStore.ListAllPositions()
+	if err != nil {
+		return nil, err
+	}
+	playback := make(map[string][]LibraryPosition)
+	for _, position := range positions {
+		username, ok := usernames[position.UserID]
+		if !ok && position.UserID != LocalUserID {
+			continue // 已删除的用户
+		}
+		playback[position.InfoHash] = append(playback[position.InfoHash], LibraryPosition{
+			Username:  username,
+			FileIndex: position.FileIndex,
+			Position:  position.Position,
+			Duration:  position.Duration,
+			UpdatedAt: position.UpdatedAt,
+		})
+	}
+
+	export := &LibraryExport{
+		Version:    LibraryExportVersion,
+		ExportedAt: time.Now(),
+		Torrents:   make([]LibraryTorrent, 0, len(records)),
+	}
+	for _, record := range records {
+		info, err := store.GetInfoBytes(record.InfoHash)
+		if err != nil {
+			return nil, err
+		}
+		episodes, err := s.torrentService.episodeStore.ListEpisodes(record.InfoHash)
+		if err != nil {
+			return nil, err
+		}
+		export.Torrents = append(export.Torrents, LibraryTorrent{
+			InfoHash:     record.InfoHash,
+			Name:         record.Name,
+			MagnetURI:    record.MagnetURI,
+			Info:         info,
+			Private:      record.Private,
+			Category:     record.Category,
+			Tags:         record.Tags,
+			AddedAt:      record.AddedAt,
+			WatchedAt:    watched[record.InfoHash],
+			MovieDetails: record.MovieDetails,
+			Episodes:     episodes,
+			Playback:     playback[record.InfoHash],
+		})
+	}
+	return export, nil
+}
+
+// Import 导入另一台服务器导出的媒体库，已存在的种子（按 InfoHash 判断）保持不变
+// 种子按导出的磁力链接和元数据添加，数据需要重新下载
+func (s *LibraryService) Import(ctx context.Context, library *LibraryExport) (*LibraryImportResult, error) {
+	if library.Version < 1 || library.Version > LibraryExportVersion {
+		return nil, validator.ValidationError{
+			Field:   "version",
+			Message: fmt.Sprintf("不支持的导出格式版本 %d", library.Version),
+		}
+	}
+
+	users, err := s.userStore.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	userIDs := map[string]int64{"": LocalUserID}
+	for _, user := range users {
+		userIDs[user.Username] = user.ID
+	}
+
+	result := &LibraryImportResult{Results: make([]LibraryImportItem, 0, len(library.Torrents))}
+	for i := range library.Torrents {
+		item := &library.Torrents[i]
+		status := LibraryImportItem{InfoHash: item.InfoHash, Name: item.Name}
+		added, err := s.importTorrent(ctx, item)
+		switch {
+		case err != nil:
+			slog.WarnContext(ctx, "导入媒体库种子失败", "info_hash", item.InfoHash, "error", err)
+			status.Status = "failed"
+			status.Error = err.Error()
+		case !added:
+			status.Status = "exists"
+		default:
+			status.Status = "imported"
+			imported, skipped := s.importPositions(item, userIDs)
+			result.Positions += imported
+			result.PositionsSkipped += skipped
+		}
+		result.Results = append(result.Results, status)
+	}
+	return result, nil
+}
+
+// importTorrent 添加一个导出的种子并恢复其详情、分类标签和观看标记，种子已存在时返回 false
+func (s *LibraryService) importTorrent(ctx context.Context, item *LibraryTorrent) (bool, error) {
+	ts := s.torrentService
+
+	hashValidator := &validator.InfoHashValidator{}
+	if err := hashValidator.ValidateInfoHash(item.InfoHash); err != nil {
+		return false, err
+	}
+	infoHash := strings.ToLower(item.InfoHash)
+	if _, _, ok := ts.states.Get(infoHash); ok {
+		return false, nil
+	}
+
+	magnetURI := item.MagnetURI
+	if magnetURI == "" {
+		magnetURI = "magnet:?xt=urn:btih:" + infoHash
+	} else if !strings.Contains(strings.ToLower(magnetURI), infoHash) {
+		return false, validator.ValidationError{Field: "magnetUri", Message: "磁力链接与InfoHash不一致"}
+	}
+
+	info, err := ts.torrentClient.RestoreMagnet(magnetURI, item.Info, item.Private)
+	if err != nil {
+		return false, fmt.Errorf("添加磁力链接失败: %w", err)
+	}
+
+	name := item.Name
+	if name == "" {
+		name = info.Name
+	}
+	ts.states.Track(infoHash, StateQueued, "")
+	record := &db.TorrentRecord{
+		InfoHash:     infoHash,
+		Name:         name,
+		MagnetURI:    magnetURI,
+		AddedAt:      item.AddedAt,
+		State:        string(StateQueued),
+		Private:      info.Private,
+		AddedBy:      userIDFromContext(ctx),
+		MovieDetails: item.MovieDetails,
+	}
+	if err := ts.torrentStore.AddTorrent(record); err != nil {
+		return false, err
+	}
+
+	// 分类和标签经过与接口相同的校验，无效时只跳过标签
+	if item.Category != "" {
+		if _, err := ts.SetCategory(infoHash, item.Category); err != nil {
+			slog.WarnContext(ctx, "导入分类失败", "info_hash", infoHash, "error", err)
+		}
+	}
+	if len(item.Tags) > 0 {
+		if _, err := ts.SetTags(infoHash, item.Tags); err != nil {
+			slog.WarnContext(ctx, "导入标签失败", "info_hash", infoHash, "error", err)
+		}
+	}
+	if item.MovieDetails != nil {
+		if err := ts.collections.SetTorrentCollection(infoHash, item.MovieDetails.Collection); err != nil {
+			slog.WarnContext(ctx, "导入合集失败", "info_hash", infoHash, "error", err)
+		}
+	}
+	if len(item.Episodes) > 0 {
+		for _, episode := range item.Episodes {
+			episode.InfoHash = infoHash
+		}
+		if err := ts.episodeStore.ReplaceEpisodes(infoHash, item.Episodes); err != nil {
+			slog.WarnContext(ctx, "导入剧集信息失败", "info_hash", infoHash, "error", err)
+		}
+	}
+	if item.WatchedAt != nil {
+		if err := ts.torrentStore.SetWatched(infoHash, true); err != nil {
+			slog.WarnContext(ctx, "导入观看标记失败", "info_hash", infoHash, "error", err)
+		}
+	}
+
+	ts.applyState(info)
+	ts.bus.Publish(events.TorrentAdded, infoHash, info)
+	ts.metadataQueue.Enqueue(infoHash)
+	return true, nil
+}
+
+// importPositions 导入种子的播放进度，返回导入和跳过的条数
+func (s *LibraryService) importPositions(item *LibraryTorrent, userIDs map[string]int64) (imported, skipped int) {
+	for _, position := range item.Playback {
+		userID, ok := userIDs[position.Username]
+		if !ok || position.FileIndex < 0 || position.Position < 0 || position.Duration < 0 {
+			skipped++
+			continue
+		}
+		if err := s.playbackStore.ImportPosition(&db.PlaybackPosition{
+			UserID:    userID,
+			InfoHash:  strings.ToLower(item.InfoHash),
+			FileIndex: position.FileIndex,
+			Position:  position.Position,
+			Duration:  position.Duration,
+			UpdatedAt: position.UpdatedAt,
+		}); err != nil {
+			slog.Warn("导入播放进度失败", "info_hash", item.InfoHash, "error", err)
+			skipped++
+			continue
+		}
+		imported++
+	}
+	return imported, skipped
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/torrentplayer/backend/config"
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/events"
+	"github.com/torrentplayer/backend/torrent"
+)
+
+// metadataRetryBaseDelay 第一次重试前的等待时间，之后每次翻倍
+const metadataRetryBaseDelay = 30 * time.Second
+
+// metadataJob 元数据获取任务
+type metadataJob struct {
+	infoHash string
+	attempt  int
+	timeout  time.Duration // 每次等待的时间，为 0 时使用 TORRENT_METADATA_TIMEOUT
+}
+
+// MetadataQueue 后台获取种子元数据的任务队列
+// 添加磁力链接后立即返回，由队列等待元数据、更新数据库并发布事件，超时后按指数退避重试；
+// 重试次数用完后种子保持 fetching-metadata 状态，在后台继续等待，较慢的种子最终仍能获取到元数据
+type MetadataQueue struct {
+	torrentClient *torrent.Client
+	torrentStore  *db.TorrentStore
+	states        *StateMachine
+	bus           *events.Bus
+	timeout       time.Duration
+	maxRetries    int
+	workers       int
+
+	jobs    chan metadataJob
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	pending sync.Map // infoHash -> struct{}，避免重复入队
+	running sync.Map // infoHash -> context.CancelFunc，正在等待元数据的任务
+}
+
+// NewMetadataQueue 创建元数据任务队列
+func NewMetadataQueue(client *torrent.Client, store *db.TorrentStore, states *StateMachine, bus *events.Bus, cfg *config.Config) *MetadataQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MetadataQueue{
+		torrentClient: client,
+		torrentStore:  store,
+		states:        states,
+		bus:           bus,
+		timeout:       time.Duration(cfg.Torrent.MetadataTimeoutSec) * time.Second,
+		maxRetries:    cfg.Torrent.MetadataRetries,
+		workers:       cfg.Torrent.MetadataWorkers,
+		jobs:          make(chan metadataJob, 1024),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Start 启动后台工作协程
+func (q *MetadataQueue) Start() {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+}
+
+// Stop 停止所有工作协程并等待其退出
+func (q *MetadataQueue) Stop() {
+	q.cancel()
+	q.wg.Wait()
+}
+
+// Enqueue 提交元数据获取任务，同一种子重复提交会被忽略
+func (q *MetadataQueue) Enqueue(infoHash string) {
+	q.EnqueueWithTimeout(infoHash, 0)
+}
+
+// EnqueueWithTimeout 提交元数据获取任务，每次等待 timeout，为 0 时使用 TORRENT_METADATA_TIMEOUT
+func (q *MetadataQueue) EnqueueWithTimeout(infoHash string, timeout time.Duration) {
+	if _, loaded := q.pending.LoadOrStore(infoHash, struct{}{}); loaded {
+		return
+	}
+	q.submit(metadataJob{infoHash: infoHash, timeout: timeout})
+}
+
+// Cancel 取消正在等待元数据的任务（例如种子被暂停），不会触发重试
+func (q *MetadataQueue) Cancel(infoHash string) {
+	if cancel, ok := q.running.Load(infoHash); ok {
+		cancel.(context.CancelFunc)()
+	}
+}
+
+// submit 将任务放入队列，队列关闭时丢弃
+func (q *MetadataQueue) submit(job metadataJob) {
+	select {
+	case q.jobs <- job:
+	case <-q.ctx.Done():
+	}
+}
+
+// worker 处理元数据任务
+func (q *MetadataQueue) worker() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case job := <-q.jobs:
+			q.process(job)
+		}
+	}
+}
+
+// process 等待单个种子的元数据
+func (q *MetadataQueue) process(job metadataJob) {
+	// 暂停的种子不再等待元数据，恢复时会重新入队
+	if state, _, _ := q.states.Get(job.infoHash); state == StatePaused {
+		q.pending.Delete(job.infoHash)
+		return
+	}
+	q.transition(job.infoHash, StateQueued, StateFetchingMetadata, "")
+
+	timeout := job.timeout
+	if timeout <= 0 {
+		timeout = q.timeout
+	}
+	ctx, cancel := context.WithTimeout(q.ctx, timeout)
+	q.running.Store(job.infoHash, cancel)
+	err := q.torrentClient.WaitForMetadata(ctx, job.infoHash)
+	q.running.Delete(job.infoHash)
+	cancel()
+
+	if err == nil {
+		q.pending.Delete(job.infoHash)
+		q.onMetadata(job.infoHash)
+		return
+	}
+
+	if q.ctx.Err() != nil {
+		return
+	}
+	if state, _, _ := q.states.Get(job.infoHash); state == StatePaused {
+		q.pending.Delete(job.infoHash)
+		return
+	}
+
+	if errors.Is(err, torrent.ErrMetadataTimeout) && job.attempt >= q.maxRetries {
+		// 重试次数用完，不再占用工作协程，在后台一直等待到元数据到达、种子被暂停或删除
+		log.Printf("获取种子元数据超时 %s，继续在后台等待", job.infoHash)
+		q.bus.Publish(events.TorrentMetadataTimeout, job.infoHash, map[string]interface{}{
+			"attempts": job.attempt + 1,
+		})
+		go q.waitInBackground(job.infoHash)
+		return
+	}
+	if !errors.Is(err, torrent.ErrMetadataTimeout) {
+		q.pending.Delete(job.infoHash)
+		log.Printf("获取种子元数据失败 %s: %v", job.infoHash, err)
+		q.transition(job.infoHash, StateFetchingMetadata, StateError, err.Error())
+		q.bus.Publish(events.TorrentMetadataFailed, job.infoHash, map[string]interface{}{
+			"error":    err.Error(),
+			"attempts": job.attempt + 1,
+		})
+		return
+	}
+
+	// 指数退避后重新入队，等待期间不占用工作协程
+	delay := metadataRetryBaseDelay << job.attempt
+	job.attempt++
+	q.transition(job.infoHash, StateFetchingMetadata, StateQueued, "等待重试获取元数据")
+	q.bus.Publish(events.TorrentMetadataRetry, job.infoHash, map[string]interface{}{
+		"attempt": job.attempt,
+		"retryIn": delay.Seconds(),
+	})
+
+	time.AfterFunc(delay, func() { q.submit(job) })
+}
+
+// waitInBackground 不限时等待种子的元数据，暂停时通过 Cancel 结束等待
+func (q *MetadataQueue) waitInBackground(infoHash string) {
+	ctx, cancel := context.WithCancel(q.ctx)
+	q.running.Store(infoHash, cancel)
+	err := q.torrentClient.WaitForMetadata(ctx, infoHash)
+	q.running.Delete(infoHash)
+	cancel()
+
+	if q.ctx.Err() != nil {
+		return
+	}
+	q.pending.Delete(infoHash)
+	if err == nil {
+		q.onMetadata(infoHash)
+		return
+	}
+	if state, _, _ := q.states.Get(infoHash); state == StatePaused || errors.Is(err, torrent.ErrTorrentNotFound) {
+		return
+	}
+
+	log.Printf("获取种子元数据失败 %s: %v", infoHash, err)
+	q.transition(infoHash, StateFetchingMetadata, StateError, err.Error())
+	q.bus.Publish(events.TorrentMetadataFailed, infoHash, map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+// onMetadata 元数据到达后更新数据库并发布事件
+func (q *MetadataQueue) onMetadata(infoHash string) {
+	// 暂停中的种子保持 paused，恢复时再根据传输情况确定状态
+	q.transition(infoHash, StateFetchingMetadata, StateDownloading, "")
+	// 数据已在磁盘上的种子在元数据到达前就可能已经完成
+	q.states.SyncCompletion(infoHash)
+
+	info, ok := q.torrentClient.GetTorrentInfo(infoHash)
+	if !ok {
+		return
+	}
+	state, reason, _ := q.states.Get(infoHash)
+	info.State, info.StateReason = string(state), reason
+
+	record, err := q.torrentStore.GetTorrent(infoHash)
+	if err != nil || record == nil {
+		log.Printf("警告: 元数据到达但数据库中没有种子记录 %s: %v", infoHash, err)
+	} else {
+		update := db.TorrentUpdate{
+			Name:        &info.Name,
+			Length:      &info.Length,
+			Files:       toDBFiles(info.Files),
+			Downloaded:  &info.Downloaded,
+			Progress:    &info.Progress,
+			State:       &info.State,
+			StateReason: &info.StateReason,
+		}
+		if err := q.torrentStore.UpdateTorrent(infoHash, update); err != nil {
+			log.Printf("警告: 更新种子元数据失败 %s: %v", infoHash, err)
+		}
+		if info.Private && !record.Private {
+			if err := q.torrentStore.MarkPrivate(infoHash); err != nil {
+				log.Printf("警告: %v", err)
+			}
+		}
+		// 保存元数据，重启后直接恢复而不必再从 DHT 和 peer 获取
+		if infoBytes, ok := q.torrentClient.InfoBytes(infoHash); ok {
+			if err := q.torrentStore.SaveInfoBytes(infoHash, infoBytes); err != nil {
+				log.Printf("警告: %v", err)
+			}
+		}
+	}
+
+	q.bus.Publish(events.TorrentMetadata, infoHash, info)
+}
+
+// transition 仅当种子仍处于 from 状态时转换，用户暂停的种子不受后台任务影响
+func (q *MetadataQueue) transition(infoHash string, from, to TorrentState, reason string) {
+	if _, err := q.states.TransitionFrom(infoHash, from, to, reason); err != nil {
+		log.Printf("警告: 更新种子状态失败 %s: %v", infoHash, err)
+	}
+}
+
+// toDBFiles 转换文件列表为数据库模型
+func toDBFiles(files []torrent.FileInfo) []db.FileInfo {
+	result := make([]db.FileInfo, 0, len(files))
+	for _, f := range files {
+		result = append(result, db.FileInfo{
+			Path:       f.Path,
+			Length:     f.Length,
+			Progress:   f.Progress,
+			FileIndex:  f.FileIndex,
+			TorrentID:  f.TorrentID,
+			IsVideo:    f.IsVideo,
+			IsPlayable: f.IsPlayable,
+		})
+	}
+	return result
+}
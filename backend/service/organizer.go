@@ -0,0 +1,428 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/events"
+	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// organizerQueueSize 等待整理的种子数上限，超出时丢弃并记录警告
+const organizerQueueSize = 256
+
+// organizerPlaceholder 命名模板中的占位符，如 {title}
+var organizerPlaceholder = regexp.MustCompile(`\{([a-zA-Z]+)\}`)
+
+// organizerPlaceholders 命名模板支持的占位符，季和集补零到两位
+var organizerPlaceholders = map[string]bool{
+	"title":         true,
+	"originalTitle": true,
+	"year":          true,
+	"season":        true,
+	"episode":       true,
+	"episodeTitle":  true,
+	"ext":           true,
+}
+
+// unsafeNameChars 各平台文件名中不能使用的字符
+var unsafeNameChars = regexp.MustCompile(`[\\/:*?"<>|\x00-\x1f]`)
+
+// OrganizerSettings 媒体库整理设置，关闭后保留已创建的链接
+type OrganizerSettings struct {
+	Enabled    bool   `json:"enabled"`
+	LibraryDir string `json:"libraryDir"` // 需与种子数据在同一文件系统
+	// MovieTemplate 和 EpisodeTemplate 是相对媒体库目录的路径模板，/ 分隔目录
+	MovieTemplate   string `json:"movieTemplate"`
+	EpisodeTemplate string `json:"episodeTemplate"`
+}
+
+// Organizer 识别出影片信息并下载完成后，按命名模板在媒体库目录中为视频文件创建硬链接，
+// 得到 Movies/标题 (年份)/标题 (年份).mkv 这样整齐的目录供其他播放器使用，
+// 原文件保持不变，种子继续从原路径做种
+type Organizer struct {
+	torrentClient *torrent.Client
+	torrentStore  *db.TorrentStore
+	episodeStore  *db.EpisodeStore
+	store         *db.LibraryLinkStore
+	bus           *events.Bus
+
+	mu       sync.Mutex
+	settings OrganizerSettings
+
+	jobs chan string
+	// rescan 设置修改后重新整理所有种子
+	rescan chan struct{}
+	cancel func()
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewOrganizer 创建媒体库整理服务，设置服务应用设置之前不整理任何种子
+func NewOrganizer(client *torrent.Client, torrentStore *db.TorrentStore, episodeStore *db.EpisodeStore, store *db.LibraryLinkStore, bus *events.Bus) *Organizer {
+	return &Organizer{
+		torrentClient: client,
+		torrentStore:  torrentStore,
+		episodeStore:  episodeStore,
+		store:         store,
+		bus:           bus,
+		jobs:          make(chan string, organizerQueueSize),
+		rescan:        make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+	}
+}
+
+// Start 订阅下载完成事件，整理由单独的 goroutine 依次执行，避免订阅通道积压丢事件
+func (o *Organizer) Start() {
+	eventsCh, cancel := o.bus.Subscribe()
+	o.cancel = cancel
+
+	o.wg.Add(2)
+	go func() {
+		defer o.wg.Done()
+		for event := range eventsCh {
+			if event.Type == events.TorrentCompleted {
+				o.Queue(event.InfoHash)
+			}
+		}
+	}()
+	go func() {
+		defer o.wg.Done()
+		for {
+			select {
+			case <-o.stop:
+				return
+			case <-o.rescan:
+				o.organizeAll()
+			case infoHash := <-o.jobs:
+				o.organize(infoHash)
+			}
+		}
+	}()
+}
+
+// Stop 停止整理
+func (o *Organizer) Stop() {
+	if o.cancel != nil {
+		o.cancel()
+	}
+	close(o.stop)
+	o.wg.Wait()
+}
+
+// SetSettings 修改整理设置，启用或修改目录和模板后重新整理所有种子；
+// 启动时第一次应用设置也会整理所有种子，补上服务未运行时完成的种子
+func (o *Organizer) SetSettings(settings OrganizerSettings) {
+	o.mu.Lock()
+	changed := settings != o.settings
+	o.settings = settings
+	o.mu.Unlock()
+
+	if changed && settings.Enabled {
+		select {
+		case o.rescan <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Queue 整理种子，用于识别或修改影片信息之后
+func (o *Organizer) Queue(infoHash string) {
+	select {
+	case o.jobs <- infoHash:
+	default:
+		log.Printf("警告: 媒体库整理队列已满，跳过种子 %s", infoHash)
+	}
+}
+
+// Forget 删除种子在媒体库中的链接，不影响种子数据
+func (o *Organizer) Forget(infoHash string) {
+	links, err := o.store.ListLinks(infoHash)
+	if err != nil {
+		log.Printf("警告: %v", err)
+		return
+	}
+	libraryDir := o.currentSettings().LibraryDir
+	for _, path := range links {
+		removeLibraryLink(path, libraryDir)
+	}
+	if err := o.store.DeleteTorrentLinks(infoHash); err != nil {
+		log.Printf("警告: %v", err)
+	}
+}
+
+func (o *Organizer) currentSettings() OrganizerSettings {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.settings
+}
+
+// organizeAll 整理所有已识别的种子
+func (o *Organizer) organizeAll() {
+	if !o.currentSettings().Enabled {
+		return
+	}
+	records, err := o.torrentStore.GetAllTorrents()
+	if err != nil {
+		log.Printf("警告: 整理媒体库失败: %v", err)
+		return
+	}
+	for _, record := range records {
+		if record.MovieDetails != nil {
+			o.organize(record.InfoHash)
+		}
+	}
+}
+
+// organize 为种子已下载完成的视频文件创建链接，模板或影片信息变化后移动到新路径，
+// 不再属于媒体库的文件的链接被删除
+func (o *Organizer) organize(infoHash string) {
+	settings := o.currentSettings()
+	if !settings.Enabled {
+		return
+	}
+	record, err := o.torrentStore.GetTorrent(infoHash)
+	if err != nil || record == nil || record.MovieDetails == nil {
+		return
+	}
+	info, ok := o.torrentClient.GetTorrentInfo(infoHash)
+	if !ok || len(info.Files) == 0 {
+		return
+	}
+	libraryDir, err := filepath.Abs(settings.LibraryDir)
+	if err != nil {
+		log.Printf("警告: 获取媒体库目录失败: %v", err)
+		return
+	}
+
+	targets, err := o.targets(record, info.Files, settings)
+	if err != nil {
+		log.Printf("警告: 整理种子失败 %s: %v", info.Name, err)
+		return
+	}
+	links, err := o.store.ListLinks(infoHash)
+	if err != nil {
+		log.Printf("警告: %v", err)
+		return
+	}
+
+	for index, path := range links {
+		if _, ok := targets[index]; !ok {
+			removeLibraryLink(path, libraryDir)
+			if err := o.store.DeleteLink(infoHash, index); err != nil {
+				log.Printf("警告: %v", err)
+			}
+		}
+	}
+
+	for _, file := range info.Files {
+		rel, ok := targets[file.FileIndex]
+		if !ok || file.BytesCompleted < file.Length {
+			continue
+		}
+		target := filepath.Join(libraryDir, rel)
+		source, err := o.torrentClient.FilePath(infoHash, file.FileIndex)
+		if err != nil {
+			log.Printf("警告: 获取文件路径失败 %s: %v", file.Path, err)
+			continue
+		}
+		if err := linkLibraryFile(source, target); err != nil {
+			log.Printf("警告: 创建媒体库链接失败 %s: %v", file.Path, err)
+			continue
+		}
+
+		old, linked := links[file.FileIndex]
+		if linked && old == target {
+			continue
+		}
+		if linked {
+			removeLibraryLink(old, libraryDir)
+		}
+		if err := o.store.SaveLink(infoHash, file.FileIndex, target); err != nil {
+			log.Printf("警告: %v", err)
+			continue
+		}
+		log.Printf("已添加到媒体库: %s", target)
+	}
+}
+
+// targets 按影片信息和命名模板计算各文件在媒体库中的相对路径：
+// 电影只链接最大的视频文件，剧集链接每个匹配到季集的文件
+func (o *Organizer) targets(record *db.TorrentRecord, files []torrent.FileInfo, settings OrganizerSettings) (map[int]string, error) {
+	details := record.MovieDetails
+	values := map[string]string{
+		"title":         details.Filename,
+		"originalTitle": details.OriginalTitle,
+		"year":          "",
+	}
+	if values["originalTitle"] == "" {
+		values["originalTitle"] = details.Filename
+	}
+	if details.Year > 0 {
+		values["year"] = strconv.Itoa(details.Year)
+	}
+
+	targets := make(map[int]string)
+	if details.MediaType == MediaTV {
+		episodes, err := o.episodeStore.ListEpisodes(record.InfoHash)
+		if err != nil {
+			return nil, err
+		}
+		for _, episode := range episodes {
+			if episode.FileIndex < 0 || episode.FileIndex >= len(files) {
+				continue
+			}
+			values["season"] = fmt.Sprintf("%02d", episode.Season)
+			values["episode"] = fmt.Sprintf("%02d", episode.Episode)
+			values["episodeTitle"] = episode.Title
+			values["ext"] = filepath.Ext(files[episode.FileIndex].Path)
+			rel, err := renderLibraryPath(settings.EpisodeTemplate, values)
+			if err != nil {
+				return nil, err
+			}
+			targets[episode.FileIndex] = rel
+		}
+		return targets, nil
+	}
+
+	movie := -1
+	for i, file := range files {
+		if file.IsVideo && (movie < 0 || file.Length > files[movie].Length) {
+			movie = i
+		}
+	}
+	if movie < 0 {
+		return targets, nil
+	}
+	values["ext"] = filepath.Ext(files[movie].Path)
+	rel, err := renderLibraryPath(settings.MovieTemplate, values)
+	if err != nil {
+		return nil, err
+	}
+	targets[files[movie].FileIndex] = rel
+	return targets, nil
+}
+
+// renderLibraryPath 用 values 替换模板中的占位符，得到相对媒体库目录的路径。
+// 年份未知时去掉 ({year}) 整个括号，各级名称中的非法字符替换为空格
+func renderLibraryPath(template string, values map[string]string) (string, error) {
+	if values["year"] == "" {
+		template = strings.ReplaceAll(template, " ({year})", "")
+		template = strings.ReplaceAll(template, "({year})", "")
+	}
+
+	var parts []string
+	for _, part := range strings.Split(template, "/") {
+		name := organizerPlaceholder.ReplaceAllStringFunc(part, func(placeholder string) string {
+			key := placeholder[1 : len(placeholder)-1]
+			if key == "ext" {
+				return values[key]
+			}
+			return unsafeNameChars.ReplaceAllString(values[key], " ")
+		})
+		name = strings.Trim(strings.Join(strings.Fields(name), " "), ". ")
+		if name == "" {
+			continue
+		}
+		parts = append(parts, name)
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("命名模板生成的路径为空")
+	}
+	return filepath.Join(parts...), nil
+}
+
+// linkLibraryFile 为 source 创建硬链接 target，target 已是同一文件时不做任何事
+func linkLibraryFile(source, target string) error {
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if targetInfo, err := os.Stat(target); err == nil {
+		if os.SameFile(sourceInfo, targetInfo) {
+			return nil
+		}
+		return fmt.Errorf("%s 已存在且不是该文件", target)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if err := os.Link(source, target); err != nil {
+		if errors.Is(err, syscall.EXDEV) {
+			return fmt.Errorf("媒体库目录与种子数据不在同一文件系统，无法创建硬链接")
+		}
+		return err
+	}
+	return nil
+}
+
+// removeLibraryLink 删除媒体库中的链接，并删除因此变空的上级目录，直到媒体库目录为止
+func removeLibraryLink(path, libraryDir string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("警告: 删除媒体库链接失败: %v", err)
+		return
+	}
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		rel, err := filepath.Rel(libraryDir, dir)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return
+		}
+		// 目录不为空时删除失败
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// validateOrganizer 校验媒体库整理设置
+func validateOrganizer(settings OrganizerSettings) error {
+	if settings.Enabled && strings.TrimSpace(settings.LibraryDir) == "" {
+		return validator.ValidationError{Field: "organizer.libraryDir", Message: "启用媒体库整理时不能为空"}
+	}
+	templates := []struct {
+		field    string
+		template string
+		required []string
+	}{
+		{"organizer.movieTemplate", settings.MovieTemplate, []string{"ext"}},
+		{"organizer.episodeTemplate", settings.EpisodeTemplate, []string{"season", "episode", "ext"}},
+	}
+	for _, t := range templates {
+		if strings.TrimSpace(t.template) == "" {
+			return validator.ValidationError{Field: t.field, Message: "不能为空"}
+		}
+		if strings.HasPrefix(t.template, "/") || strings.Contains(t.template, "\\") {
+			return validator.ValidationError{Field: t.field, Message: "必须是以 / 分隔的相对路径"}
+		}
+		for _, part := range strings.Split(t.template, "/") {
+			if part == ".." {
+				return validator.ValidationError{Field: t.field, Message: "不能包含 .."}
+			}
+		}
+		for _, match := range organizerPlaceholder.FindAllStringSubmatch(t.template, -1) {
+			if !organizerPlaceholders[match[1]] {
+				return validator.ValidationError{Field: t.field, Message: fmt.Sprintf("不支持的占位符 {%s}", match[1])}
+			}
+		}
+		for _, key := range t.required {
+			if !strings.Contains(t.template, "{"+key+"}") {
+				return validator.ValidationError{Field: t.field, Message: fmt.Sprintf("必须包含 {%s}", key)}
+			}
+		}
+	}
+	if strings.Contains(settings.MovieTemplate, "{season}") || strings.Contains(settings.MovieTemplate, "{episode}") {
+		return validator.ValidationError{Field: "organizer.movieTemplate", Message: "电影没有季和集"}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderLibraryPath(t *testing.T) {
+	tests := []struct {
+		template string
+		values   map[string]string
+		want     string
+	}{
+		{
+			"Movies/{title} ({year})/{title} ({year}){ext}",
+			map[string]string{"title": "Blade Runner 2049", "year": "2017", "ext": ".mkv"},
+			"Movies/Blade Runner 2049 (2017)/Blade Runner 2049 (2017).mkv",
+		},
+		{
+			// 年份未知时去掉括号，非法字符替换为空格
+			"Movies/{title} ({year})/{title} ({year}){ext}",
+			map[string]string{"title": "Mission: Impossible", "ext": ".mp4"},
+			"Movies/Mission Impossible/Mission Impossible.mp4",
+		},
+		{
+			"TV/{title}/Season {season}/{title} - S{season}E{episode}{ext}",
+			map[string]string{"title": "Dark", "season": "01", "episode": "02", "ext": ".mkv"},
+			"TV/Dark/Season 01/Dark - S01E02.mkv",
+		},
+		{
+			// 标题中的 / 和 .. 不会产生新的目录层级
+			"{title}/{title}{ext}",
+			map[string]string{"title": "../AC/DC", "ext": ".mkv"},
+			"AC DC/AC DC.mkv",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := renderLibraryPath(tt.template, tt.values)
+		if err != nil {
+			t.Errorf("%q: %v", tt.template, err)
+			continue
+		}
+		if want := filepath.FromSlash(tt.want); got != want {
+			t.Errorf("%q: got %q, want %q", tt.template, got, want)
+		}
+	}
+}
+
+func TestValidateOrganizer(t *testing.T) {
+	valid := OrganizerSettings{
+		Enabled:         true,
+		LibraryDir:      "/data/library",
+		MovieTemplate:   "Movies/{title} ({year})/{title} ({year}){ext}",
+		EpisodeTemplate: "TV/{title}/Season {season}/{title} - S{season}E{episode}{ext}",
+	}
+	if err := validateOrganizer(valid); err != nil {
+		t.Fatalf("valid settings: %v", err)
+	}
+
+	invalid := []func(*OrganizerSettings){
+		func(s *OrganizerSettings) { s.LibraryDir = "" },
+		func(s *OrganizerSettings) { s.MovieTemplate = "/Movies/{title}{ext}" },
+		func(s *OrganizerSettings) { s.MovieTemplate = "../{title}{ext}" },
+		func(s *OrganizerSettings) { s.MovieTemplate = "{name}{ext}" },
+		func(s *OrganizerSettings) { s.MovieTemplate = "{title}" },
+		func(s *OrganizerSettings) { s.EpisodeTemplate = "TV/{title}{ext}" },
+	}
+	for i, modify := range invalid {
+		settings := valid
+		modify(&settings)
+		if err := validateOrganizer(settings); err == nil {
+			t.Errorf("case %d: expected an error for %+v", i, settings)
+		}
+	}
+}
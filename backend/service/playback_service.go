@@ -0,0 +1,145 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/validator"
+)
+
+const (
+	// finishedRatio 播放位置达到时长的该比例时视为已看完，不再出现在继续观看列表中
+	finishedRatio = 0.95
+	// defaultContinueWatchingLimit 继续观看列表的默认条数
+	defaultContinueWatchingLimit = 20
+)
+
+// PlaybackUpdate 播放进度上报数据，单位为秒
+type PlaybackUpdate struct {
+	FileIndex int     `json:"fileIndex"`
+	Position  float64 `json:"position"`
+	Duration  float64 `json:"duration"`
+}
+
+// ContinueWatchingItem 继续观看列表中的一项
+type ContinueWatchingItem struct {
+	InfoHash  string    `json:"infoHash"`
+	Name      string    `json:"name"`
+	FileIndex int       `json:"fileIndex"`
+	FilePath  string    `json:"filePath,omitempty"`
+	Position  float64   `json:"position"`
+	Duration  float64   `json:"duration"`
+	Progress  float64   `json:"progress"` // position / duration，时长未知时为 0
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// PlaybackService 播放进度服务层，按用户记录每个文件最后的播放位置
+type PlaybackService struct {
+	store          *db.PlaybackStore
+	torrentService *TorrentService
+}
+
+// NewPlaybackService 创建播放进度服务实例
+func NewPlaybackService(store *db.PlaybackStore, torrentService *TorrentService) *PlaybackService {
+	return &PlaybackService{
+		store:          store,
+		torrentService: torrentService,
+	}
+}
+
+// GetPositions 获取用户在种子各文件上的播放进度
+func (s *PlaybackService) GetPositions(userID int64, infoHash string) ([]*db.PlaybackPosition, error) {
+	if _, err := s.torrentService.GetTorrent(infoHash); err != nil {
+		return nil, err
+	}
+	return s.store.ListPositions(userID, infoHash)
+}
+
+// SavePosition 保存用户在某个文件上的播放位置
+func (s *PlaybackService) SavePosition(userID int64, infoHash string, update *PlaybackUpdate) (*db.PlaybackPosition, error) {
+	info, err := s.torrentService.GetTorrent(infoHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// 元数据未获取前文件列表为空，此时不校验文件索引
+	if update.FileIndex < 0 || (len(info.Files) > 0 && update.FileIndex >= len(info.Files)) {
+		return nil, validator.ValidationError{Field: "fileIndex", Message: "文件索引超出范围"}
+	}
+	if update.Position < 0 || update.Duration < 0 {
+		return nil, validator.ValidationError{Field: "position", Message: "播放位置和时长不能为负数"}
+	}
+	if update.Duration > 0 && update.Position > update.Duration {
+		return nil, validator.ValidationError{Field: "position", Message: "播放位置不能超过时长"}
+	}
+
+	position := &db.PlaybackPosition{
+		UserID:    userID,
+		InfoHash:  infoHash,
+		FileIndex: update.FileIndex,
+		Position:  update.Position,
+		Duration:  update.Duration,
+	}
+	if err := s.store.SavePosition(position); err != nil {
+		return nil, err
+	}
+	return position, nil
+}
+
+// DeletePosition 清除用户在某个文件上的播放进度
+func (s *PlaybackService) DeletePosition(userID int64, infoHash string, fileIndex int) error {
+	if _, err := s.torrentService.GetTorrent(infoHash); err != nil {
+		return err
+	}
+	return s.store.DeletePosition(userID, infoHash, fileIndex)
+}
+
+// ContinueWatching 获取用户看了一部分的文件，最近观看的在前
+// 已删除的种子的播放进度在这里顺带清理
+func (s *PlaybackService) ContinueWatching(userID int64, limit int) ([]ContinueWatchingItem, error) {
+	if limit <= 0 {
+		limit = defaultContinueWatchingLimit
+	}
+
+	positions, err := s.store.ListInProgress(userID, finishedRatio)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []ContinueWatchingItem{}
+	for _, position := range positions {
+		if len(items) >= limit {
+			break
+		}
+
+		info, err := s.torrentService.GetTorrent(position.InfoHash)
+		if errors.Is(err, ErrTorrentNotFound) {
+			if err := s.store.DeleteTorrentPositions(position.InfoHash); err != nil {
+				log.Printf("警告: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		item := ContinueWatchingItem{
+			InfoHash:  position.InfoHash,
+			Name:      info.Name,
+			FileIndex: position.FileIndex,
+			Position:  position.Position,
+			Duration:  position.Duration,
+			UpdatedAt: position.UpdatedAt,
+		}
+		if position.FileIndex < len(info.Files) {
+			item.FilePath = info.Files[position.FileIndex].Path
+		}
+		if position.Duration > 0 {
+			item.Progress = position.Position / position.Duration
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/torrentplayer/backend/config"
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/events"
+	"github.com/torrentplayer/backend/torrent"
+)
+
+const (
+	// postProcessQueueSize 等待执行后处理命令的种子数上限，超出时丢弃并记录警告
+	postProcessQueueSize = 256
+	// postProcessOutputLimit 保存到数据库的命令输出上限，完整输出只写入日志
+	postProcessOutputLimit = 16 * 1024
+	// postProcessWaitDelay 命令结束或超时被结束后，等待其子进程关闭输出的时间
+	postProcessWaitDelay = 5 * time.Second
+)
+
+// PostProcessor 种子下载完成后执行配置的外部命令，通过环境变量传入种子信息，
+// 输出写入日志，结果保存到数据库并显示在种子详情中
+type PostProcessor struct {
+	torrentClient *torrent.Client
+	torrentStore  *db.TorrentStore
+	store         *db.PostProcessStore
+	bus           *events.Bus
+	command       string
+	timeout       time.Duration
+	dataDir       string
+
+	mu      sync.Mutex
+	results map[string]*db.PostProcessResult
+
+	jobs   chan string
+	cancel func()
+	// stopRun 结束正在执行的命令
+	stopRun context.CancelFunc
+	ctx     context.Context
+	wg      sync.WaitGroup
+}
+
+// NewPostProcessor 创建后处理服务并加载保存的结果，上次退出时仍在执行的命令记为失败
+func NewPostProcessor(client *torrent.Client, torrentStore *db.TorrentStore, store *db.PostProcessStore, bus *events.Bus, cfg *config.Config) *PostProcessor {
+	ctx, stopRun := context.WithCancel(context.Background())
+	p := &PostProcessor{
+		torrentClient: client,
+		torrentStore:  torrentStore,
+		store:         store,
+		bus:           bus,
+		command:       cfg.PostProcess.Command,
+		timeout:       time.Duration(cfg.PostProcess.TimeoutSec) * time.Second,
+		dataDir:       cfg.Torrent.DataDir,
+		results:       make(map[string]*db.PostProcessResult),
+		jobs:          make(chan string, postProcessQueueSize),
+		stopRun:       stopRun,
+		ctx:           ctx,
+	}
+
+	results, err := store.ListResults()
+	if err != nil {
+		log.Printf("警告: %v", err)
+		return p
+	}
+	for infoHash, result := range results {
+		if result.Status == db.PostProcessRunning {
+			result.Status = db.PostProcessFailed
+			result.Error = "服务退出时命令仍在执行"
+			if err := store.SaveResult(infoHash, result); err != nil {
+				log.Printf("警告: %v", err)
+			}
+		}
+		p.results[infoHash] = result
+	}
+	return p
+}
+
+// Start 订阅下载完成事件，未配置命令时不做任何事
+// 命令由单独的 goroutine 依次执行，避免多个脚本同时移动文件，也避免订阅通道积压丢事件
+func (p *PostProcessor) Start() {
+	if p.command == "" {
+		return
+	}
+
+	eventsCh, cancel := p.bus.Subscribe()
+	p.cancel = cancel
+
+	p.wg.Add(2)
+	go func() {
+		defer p.wg.Done()
+		for event := range eventsCh {
+			if event.Type != events.TorrentCompleted {
+				continue
+			}
+			select {
+			case p.jobs <- event.InfoHash:
+			default:
+				log.Printf("警告: 后处理队列已满，跳过种子 %s", event.InfoHash)
+			}
+		}
+	}()
+	go func() {
+		defer p.wg.Done()
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+			case infoHash := <-p.jobs:
+				p.run(infoHash)
+			}
+		}
+	}()
+}
+
+// Stop 停止后处理，正在执行的命令会被结束
+func (p *PostProcessor) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.stopRun()
+	p.wg.Wait()
+}
+
+// Apply 用种子的后处理结果填充种子信息
+func (p *PostProcessor) Apply(info *torrent.TorrentInfo) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if result, ok := p.results[info.InfoHash]; ok {
+		copied := *result
+		info.PostProcess = &copied
+	}
+}
+
+// Forget 删除种子的后处理结果
+func (p *PostProcessor) Forget(infoHash string) {
+	p.mu.Lock()
+	delete(p.results, infoHash)
+	p.mu.Unlock()
+
+	if err := p.store.DeleteResult(infoHash); err != nil {
+		log.Printf("警告: %v", err)
+	}
+}
+
+// run 为下载完成的种子执行后处理命令并保存结果
+func (p *PostProcessor) run(infoHash string) {
+	info, ok := p.torrentClient.GetTorrentInfo(infoHash)
+	if !ok {
+		return
+	}
+	record, err := p.torrentStore.GetTorrent(infoHash)
+	if err != nil || record == nil {
+		log.Printf("警告: 种子下载完成但数据库中没有种子记录 %s: %v", infoHash, err)
+		return
+	}
+
+	// 导入的种子数据在原客户端的保存目录中
+	baseDir := record.DataPath
+	if baseDir == "" {
+		baseDir = p.dataDir
+	}
+	baseDir, err = filepath.Abs(baseDir)
+	if err != nil {
+		log.Printf("警告: 获取种子数据目录失败 %s: %v", infoHash, err)
+		return
+	}
+
+	result := &db.PostProcessResult{Status: db.PostProcessRunning, StartedAt: time.Now()}
+	p.save(infoHash, result)
+	log.Printf("开始执行后处理命令: %s", info.Name)
+
+	ctx, cancel := context.WithTimeout(p.ctx, p.timeout)
+	defer cancel()
+
+	output := &postProcessOutput{name: info.Name}
+	cmd := shellCommand(ctx, p.command)
+	cmd.Dir = baseDir
+	cmd.Env = append(os.Environ(),
+		"MP_INFO_HASH="+infoHash,
+		"MP_NAME="+info.Name,
+		"MP_PATH="+filepath.Join(baseDir, info.Name),
+		"MP_CATEGORY="+record.Category,
+		"MP_TAGS="+strings.Join(record.Tags, ","),
+	)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.WaitDelay = postProcessWaitDelay
+	err = cmd.Run()
+	output.flush()
+
+	finishedAt := time.Now()
+	result = &db.PostProcessResult{
+		Status:     db.PostProcessSucceeded,
+		Output:     output.String(),
+		StartedAt:  result.StartedAt,
+		FinishedAt: &finishedAt,
+	}
+	if err != nil {
+		result.Status = db.PostProcessFailed
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			result.ExitCode = exitErr.ExitCode()
+		}
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			result.Error = fmt.Sprintf("执行超过 %s，已结束", p.timeout)
+		case p.ctx.Err() != nil:
+			result.Error = "服务退出时命令仍在执行"
+		case exitErr != nil:
+			result.Error = fmt.Sprintf("命令以退出码 %d 结束", result.ExitCode)
+		default:
+			result.Error = err.Error()
+		}
+		log.Printf("警告: 后处理命令失败 %s: %s", info.Name, result.Error)
+	} else {
+		log.Printf("后处理命令完成: %s", info.Name)
+	}
+	p.save(infoHash, result)
+	p.bus.Publish(events.TorrentPostProcessed, infoHash, result)
+}
+
+// save 保存种子的后处理结果
+func (p *PostProcessor) save(infoHash string, result *db.PostProcessResult) {
+	p.mu.Lock()
+	p.results[infoHash] = result
+	p.mu.Unlock()
+
+	if err := p.store.SaveResult(infoHash, result); err != nil {
+		log.Printf("警告: %v", err)
+	}
+}
+
+// postProcessOutput 把命令输出逐行写入日志，并保留最后 postProcessOutputLimit 字节
+type postProcessOutput struct {
+	name string
+	line []byte
+	tail []byte
+}
+
+func (o *postProcessOutput) Write(b []byte) (int, error) {
+	o.tail = append(o.tail, b...)
+	if len(o.tail) > postProcessOutputLimit {
+		o.tail = append(o.tail[:0], o.tail[len(o.tail)-postProcessOutputLimit:]...)
+	}
+
+	o.line = append(o.line, b...)
+	for {
+		i := bytes.IndexByte(o.line, '\n')
+		if i < 0 {
+			break
+		}
+		o.log(o.line[:i])
+		o.line = o.line[i+1:]
+	}
+	return len(b), nil
+}
+
+// flush 写入最后一行没有换行符的输出
+func (o *postProcessOutput) flush() {
+	if len(o.line) > 0 {
+		o.log(o.line)
+		o.line = nil
+	}
+}
+
+func (o *postProcessOutput) log(line []byte) {
+	log.Printf("后处理输出 [%s]: %s", o.name, bytes.TrimRight(line, "\r"))
+}
+
+// String 保留的输出，截断处可能切开的多字节字符会被去掉
+func (o *postProcessOutput) String() string {
+	return strings.ToValidUTF8(string(o.tail), "")
+}
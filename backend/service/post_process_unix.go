@@ -0,0 +1,20 @@
+//go:build !windows
+
+package service
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// shellCommand 通过 /bin/sh 执行命令，以便使用管道和引号
+// 命令在单独的进程组中运行，超时时连同脚本启动的子进程一起结束
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	return cmd
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package service
+
+import (
+	"context"
+	"os/exec"
+)
+
+// shellCommand 通过 cmd.exe 执行命令
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd.exe", "/C", command)
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// LocalUserID 关闭认证时所有请求共享的用户ID
+const LocalUserID int64 = 0
+
+// PlaybackOptions 单次播放请求最终生效的选项（用户偏好 + 请求参数覆盖）
+type PlaybackOptions struct {
+	MaxBitrateKbps   int    `json:"maxBitrateKbps"`
+	AudioLanguage    string `json:"audioLanguage"`
+	SubtitleLanguage string `json:"subtitleLanguage"`
+	ForceTranscode   bool   `json:"forceTranscode"`
+}
+
+// PreferencesUpdate 播放偏好更新数据，nil字段表示不修改
+type PreferencesUpdate struct {
+	MaxBitrateKbps   *int    `json:"maxBitrateKbps"`
+	AudioLanguage    *string `json:"audioLanguage"`
+	SubtitleLanguage *string `json:"subtitleLanguage"`
+	ForceTranscode   *bool   `json:"forceTranscode"`
+}
+
+// PreferencesService 播放偏好服务层
+type PreferencesService struct {
+	store *db.PreferencesStore
+
+	mu          sync.RWMutex
+	transcoding TranscodingSettings
+}
+
+// NewPreferencesService 创建播放偏好服务实例
+func NewPreferencesService(store *db.PreferencesStore) *PreferencesService {
+	return &PreferencesService{
+		store:       store,
+		transcoding: TranscodingSettings{Enabled: true},
+	}
+}
+
+// SetTranscoding 修改服务器的转码限制，之后的播放请求生效
+func (s *PreferencesService) SetTranscoding(transcoding TranscodingSettings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transcoding = transcoding
+}
+
+// GetPreferences 获取用户播放偏好，未设置时返回默认值
+func (s *PreferencesService) GetPreferences(userID int64) (*db.PlaybackPreferences, error) {
+	prefs, err := s.store.GetPreferences(userID)
+	if err != nil {
+		return nil, err
+	}
+	if prefs == nil {
+		prefs = &db.PlaybackPreferences{UserID: userID}
+	}
+	return prefs, nil
+}
+
+// UpdatePreferences 更新用户播放偏好
+func (s *PreferencesService) UpdatePreferences(userID int64, update *PreferencesUpdate) (*db.PlaybackPreferences, error) {
+	if update == nil {
+		return nil, fmt.Errorf("播放偏好不能为空")
+	}
+
+	prefs, err := s.GetPreferences(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.MaxBitrateKbps != nil {
+		prefs.MaxBitrateKbps = *update.MaxBitrateKbps
+	}
+	if update.AudioLanguage != nil {
+		prefs.AudioLanguage = *update.AudioLanguage
+	}
+	if update.SubtitleLanguage != nil {
+		prefs.SubtitleLanguage = *update.SubtitleLanguage
+	}
+	if update.ForceTranscode != nil {
+		prefs.ForceTranscode = *update.ForceTranscode
+	}
+
+	if err := validatePlaybackOptions(prefs.MaxBitrateKbps, prefs.AudioLanguage, prefs.SubtitleLanguage); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.SavePreferences(prefs); err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+// ResolvePlaybackOptions 合并用户偏好与请求参数（maxBitrate、audioLang、subLang、transcode）
+func (s *PreferencesService) ResolvePlaybackOptions(userID int64, query url.Values) (*PlaybackOptions, error) {
+	prefs, err := s.GetPreferences(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &PlaybackOptions{
+		MaxBitrateKbps:   prefs.MaxBitrateKbps,
+		AudioLanguage:    prefs.AudioLanguage,
+		SubtitleLanguage: prefs.SubtitleLanguage,
+		ForceTranscode:   prefs.ForceTranscode,
+	}
+
+	if value := query.Get("maxBitrate"); value != "" {
+		bitrate, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, validator.ValidationError{Field: "maxBitrate", Message: "必须为整数（kbps）"}
+		}
+		options.MaxBitrateKbps = bitrate
+	}
+	if value := query.Get("audioLang"); value != "" {
+		options.AudioLanguage = value
+	}
+	if value := query.Get("subLang"); value != "" {
+		options.SubtitleLanguage = value
+	}
+	if value := query.Get("transcode"); value != "" {
+		force, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, validator.ValidationError{Field: "transcode", Message: "必须为布尔值"}
+		}
+		options.ForceTranscode = force
+	}
+
+	if err := validatePlaybackOptions(options.MaxBitrateKbps, options.AudioLanguage, options.SubtitleLanguage); err != nil {
+		return nil, err
+	}
+
+	// 服务器的转码限制优先于用户偏好
+	s.mu.RLock()
+	transcoding := s.transcoding
+	s.mu.RUnlock()
+	if !transcoding.Enabled {
+		options.ForceTranscode = false
+	}
+	if transcoding.MaxBitrateKbps > 0 && (options.MaxBitrateKbps == 0 || options.MaxBitrateKbps > transcoding.MaxBitrateKbps) {
+		options.MaxBitrateKbps = transcoding.MaxBitrateKbps
+	}
+
+	return options, nil
+}
+
+// validatePlaybackOptions 校验码率和语言代码
+func validatePlaybackOptions(maxBitrateKbps int, audioLanguage, subtitleLanguage string) error {
+	if maxBitrateKbps < 0 {
+		return validator.ValidationError{Field: "maxBitrateKbps", Message: "不能为负数"}
+	}
+
+	stringValidator := &validator.StringValidator{}
+	if err := stringValidator.ValidateMaxLength(audioLanguage, "audioLanguage", 16); err != nil {
+		return err
+	}
+	return stringValidator.ValidateMaxLength(subtitleLanguage, "subtitleLanguage", 16)
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/torrentplayer/backend/db"
+)
+
+func TestResolvePlaybackOptions(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	manager, err := db.NewDatabaseManager(filepath.Join(t.TempDir(), "torrents.db"), 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	preferences := NewPreferencesService(db.NewPreferencesStore(manager))
+
+	bitrate, audio, subtitle, force := 4000, "ja", "zh", true
+	if _, err := preferences.UpdatePreferences(1, &PreferencesUpdate{
+		MaxBitrateKbps: &bitrate, AudioLanguage: &audio, SubtitleLanguage: &subtitle, ForceTranscode: &force,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		userID      int64
+		query       string
+		transcoding TranscodingSettings
+		want        PlaybackOptions
+		wantErr     bool
+	}{
+		"preferences":        {userID: 1, transcoding: TranscodingSettings{Enabled: true}, want: PlaybackOptions{4000, "ja", "zh", true}},
+		"no preferences":     {userID: 2, transcoding: TranscodingSettings{Enabled: true}, want: PlaybackOptions{}},
+		"query overrides":    {userID: 1, query: "maxBitrate=2000&audioLang=en&subLang=fr&transcode=false", transcoding: TranscodingSettings{Enabled: true}, want: PlaybackOptions{2000, "en", "fr", false}},
+		"server cap":         {userID: 1, query: "maxBitrate=8000", transcoding: TranscodingSettings{Enabled: true, MaxBitrateKbps: 3000}, want: PlaybackOptions{3000, "ja", "zh", true}},
+		"server cap no pref": {userID: 2, transcoding: TranscodingSettings{Enabled: true, MaxBitrateKbps: 3000}, want: PlaybackOptions{MaxBitrateKbps: 3000}},
+		"transcoding off":    {userID: 1, query: "transcode=true", transcoding: TranscodingSettings{}, want: PlaybackOptions{4000, "ja", "zh", false}},
+		"bad bitrate":        {userID: 1, query: "maxBitrate=fast", transcoding: TranscodingSettings{Enabled: true}, wantErr: true},
+		"negative bitrate":   {userID: 1, query: "maxBitrate=-1", transcoding: TranscodingSettings{Enabled: true}, wantErr: true},
+		"bad transcode":      {userID: 1, query: "transcode=maybe", transcoding: TranscodingSettings{Enabled: true}, wantErr: true},
+	}
+
+	for name, tc := range cases {
+		preferences.SetTranscoding(tc.transcoding)
+		query, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		options, err := preferences.ResolvePlaybackOptions(tc.userID, query)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: 应返回错误，得到 %+v", name, options)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if *options != tc.want {
+			t.Errorf("%s: 选项 %+v，应为 %+v", name, *options, tc.want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/torrentplayer/backend/config"
+	"github.com/torrentplayer/backend/db"
+)
+
+// 清理规则
+const (
+	RetentionRuleCompleted = "completed-age"
+	RetentionRuleWatched   = "watched"
+	RetentionRuleDiskUsage = "disk-usage"
+)
+
+// RetentionCandidate 命中清理规则的种子
+type RetentionCandidate struct {
+	InfoHash string `json:"infoHash"`
+	Name     string `json:"name"`
+	Rule     string `json:"rule"`
+	Reason   string `json:"reason"`
+	Size     int64  `json:"size"`
+	Removed  bool   `json:"removed"`
+	Error    string `json:"error,omitempty"`
+}
+
+// RetentionReport 一次清理（或预览）的结果
+type RetentionReport struct {
+	DryRun     bool                   `json:"dryRun"`
+	Rules      config.RetentionConfig `json:"rules"`
+	Disk       *DiskUsage             `json:"disk,omitempty"`
+	Candidates []RetentionCandidate   `json:"candidates"`
+	// FreedBytes 删除（或预计删除）的数据大小
+	FreedBytes int64     `json:"freedBytes"`
+	RanAt      time.Time `json:"ranAt"`
+}
+
+// RetentionService 按规则定期删除已完成种子及其数据：完成 N 天后、看完后、或磁盘使用率过高时
+type RetentionService struct {
+	torrents     *TorrentService
+	torrentStore *db.TorrentStore
+	rules        config.RetentionConfig
+	dataDir      string
+
+	// runMu 避免后台清理与手动触发同时执行
+	runMu sync.Mutex
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewRetentionService 创建清理服务
+func NewRetentionService(torrents *TorrentService, store *db.TorrentStore, cfg *config.Config) *RetentionService {
+	return &RetentionService{
+		torrents:     torrents,
+		torrentStore: store,
+		rules:        cfg.Retention,
+		dataDir:      cfg.Torrent.DataDir,
+		stop:         make(chan struct{}),
+	}
+}
+
+// Start 启用了任一规则时启动后台清理
+func (s *RetentionService) Start() {
+	if !s.rules.Enabled() {
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(time.Duration(s.rules.IntervalMinutes) * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				report, err := s.Run(false)
+				if err != nil {
+					log.Printf("自动清理失败: %v", err)
+					continue
+				}
+				if len(report.Candidates) > 0 {
+					log.Printf("自动清理完成: 删除 %d 个种子，释放 %d 字节", len(report.Candidates), report.FreedBytes)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止后台清理
+func (s *RetentionService) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// Run 执行清理规则，dryRun 为 true 时只返回将被删除的种子
+func (s *RetentionService) Run(dryRun bool) (*RetentionReport, error) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	report, err := s.plan(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	report.DryRun = dryRun
+	if dryRun {
+		return report, nil
+	}
+
+	var freed int64
+	for i := range report.Candidates {
+		c := &report.Candidates[i]
+		if err := s.torrents.removeTorrent(c.InfoHash, "自动清理: "+c.Reason, true); err != nil {
+			c.Error = err.Error()
+			continue
+		}
+		c.Removed = true
+		freed += c.Size
+	}
+	report.FreedBytes = freed
+
+	return report, nil
+}
+
+// plan 计算命中规则的种子，每个种子只记录第一条命中的规则
+func (s *RetentionService) plan(now time.Time) (*RetentionReport, error) {
+	records, err := s.torrentStore.ListRetention()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RetentionReport{
+		Rules:      s.rules,
+		Candidates: []RetentionCandidate{},
+		RanAt:      now,
+	}
+	selected := make(map[string]bool)
+	add := func(r db.RetentionRecord, rule, reason string) {
+		selected[r.InfoHash] = true
+		report.Candidates = append(report.Candidates, RetentionCandidate{
+			InfoHash: r.InfoHash,
+			Name:     r.Name,
+			Rule:     rule,
+			Reason:   reason,
+			Size:     r.Length,
+		})
+		report.FreedBytes += r.Length
+	}
+
+	for _, r := range records {
+		if s.rules.CompletedDays > 0 && r.CompletedAt != nil &&
+			now.Sub(*r.CompletedAt) >= days(s.rules.CompletedDays) {
+			add(r, RetentionRuleCompleted, fmt.Sprintf("下载完成已超过 %d 天", s.rules.CompletedDays))
+			continue
+		}
+		if s.rules.DeleteWatched && r.WatchedAt != nil &&
+			now.Sub(*r.WatchedAt) >= days(s.rules.WatchedDays) {
+			add(r, RetentionRuleWatched, "已看完")
+		}
+	}
+
+	if s.rules.MaxDiskPercent <= 0 {
+		return report, nil
+	}
+
+	usage, err := diskUsage(s.dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("获取磁盘使用率失败: %w", err)
+	}
+	report.Disk = usage
+	if usage.UsedPercent <= s.rules.MaxDiskPercent {
+		return report, nil
+	}
+
+	// 需要释放的空间，已命中其他规则且位于数据目录的种子也计入
+	limit := uint64(float64(usage.Total) * s.rules.MaxDiskPercent / 100)
+	needed := int64(usage.Used - limit)
+	for _, r := range records {
+		if selected[r.InfoHash] && r.DataPath == "" {
+			needed -= r.Length
+		}
+	}
+
+	// 只删除默认数据目录中已完成的种子，按完成时间从早到晚
+	var oldest []db.RetentionRecord
+	for _, r := range records {
+		if !selected[r.InfoHash] && r.DataPath == "" && r.CompletedAt != nil {
+			oldest = append(oldest, r)
+		}
+	}
+	sort.Slice(oldest, func(i, j int) bool {
+		return oldest[i].CompletedAt.Before(*oldest[j].CompletedAt)
+	})
+
+	reason := fmt.Sprintf("磁盘使用率 %.1f%% 超过上限 %.1f%%", usage.UsedPercent, s.rules.MaxDiskPercent)
+	for _, r := range oldest {
+		if needed <= 0 {
+			break
+		}
+		add(r, RetentionRuleDiskUsage, reason)
+		needed -= r.Length
+	}
+
+	return report, nil
+}
+
+// days 天数转换为时长
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
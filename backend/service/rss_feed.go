@@ -0,0 +1,184 @@
+package service
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// feedItem 订阅中的一个条目
+type feedItem struct {
+	GUID  string
+	Title string
+	// MagnetURI 条目直接给出的磁力链接
+	MagnetURI string
+	// TorrentURL 条目的 .torrent 文件地址
+	TorrentURL string
+	// InfoHash 条目给出的 info hash，只有它时生成不带 tracker 的磁力链接
+	InfoHash string
+}
+
+// rssDocument 同时兼容 RSS 2.0（channel/item）和 Atom（entry）
+type rssDocument struct {
+	Channel struct {
+		Items []rssEntry `xml:"item"`
+	} `xml:"channel"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// rssEntry RSS 条目，包含 ezRSS（torrent 元素）、nyaa（infoHash）和 Torznab（attr）扩展
+type rssEntry struct {
+	Title     string   `xml:"title"`
+	GUID      string   `xml:"guid"`
+	Links     []string `xml:"link"`
+	Comments  string   `xml:"comments"`
+	PubDate   string   `xml:"pubDate"`
+	Size      int64    `xml:"size"`
+	Enclosure struct {
+		URL    string `xml:"url,attr"`
+		Type   string `xml:"type,attr"`
+		Length int64  `xml:"length,attr"`
+	} `xml:"enclosure"`
+	// Jackett 和 Prowlarr 在聚合搜索结果中标注来源索引器
+	JackettIndexer  string `xml:"jackettindexer"`
+	ProwlarrIndexer string `xml:"prowlarrindexer"`
+	Torrent         struct {
+		MagnetURI string `xml:"magnetURI"`
+		InfoHash  string `xml:"infoHash"`
+	} `xml:"torrent"`
+	InfoHash string `xml:"infoHash"`
+	Attrs    []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"attr"`
+}
+
+// atomEntry Atom 条目
+type atomEntry struct {
+	Title string `xml:"title"`
+	ID    string `xml:"id"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"link"`
+}
+
+// parseFeed 解析 RSS 或 Atom 订阅，按订阅中的顺序返回条目
+func parseFeed(data []byte) ([]feedItem, error) {
+	var doc rssDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("解析订阅失败: %w", err)
+	}
+
+	items := make([]feedItem, 0, len(doc.Channel.Items)+len(doc.Entries))
+	for _, e := range doc.Channel.Items {
+		items = append(items, e.item())
+	}
+
+	for _, e := range doc.Entries {
+		item := feedItem{Title: strings.TrimSpace(e.Title)}
+		var alternate string
+		for _, link := range e.Links {
+			switch {
+			case strings.HasPrefix(link.Href, "magnet:"):
+				item.use(link.Href)
+			case link.Rel == "enclosure" || link.Type == "application/x-bittorrent" || isTorrentFileURL(link.Href):
+				if item.TorrentURL == "" && isHTTPURL(link.Href) {
+					item.TorrentURL = strings.TrimSpace(link.Href)
+				}
+			case alternate == "":
+				alternate = link.Href
+			}
+		}
+		item.GUID = firstNonEmpty(e.ID, item.MagnetURI, item.TorrentURL, alternate, item.Title)
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// item 从 RSS 条目中找出磁力链接、种子文件地址和 info hash
+func (e rssEntry) item() feedItem {
+	item := feedItem{Title: strings.TrimSpace(e.Title)}
+
+	candidates := []string{e.Torrent.MagnetURI, e.Enclosure.URL}
+	for _, attr := range e.Attrs {
+		switch strings.ToLower(attr.Name) {
+		case "magneturl":
+			candidates = append(candidates, attr.Value)
+		case "infohash":
+			item.InfoHash = attr.Value
+		}
+	}
+	candidates = append(candidates, e.Links...)
+	for _, c := range candidates {
+		item.use(c)
+	}
+
+	// 只有 enclosure 或以 .torrent 结尾的链接才当作种子文件下载
+	if item.TorrentURL == "" && isHTTPURL(e.Enclosure.URL) {
+		item.TorrentURL = strings.TrimSpace(e.Enclosure.URL)
+	}
+	for _, link := range e.Links {
+		if item.TorrentURL == "" && isTorrentFileURL(link) {
+			item.TorrentURL = strings.TrimSpace(link)
+		}
+	}
+
+	if item.InfoHash == "" {
+		item.InfoHash = firstNonEmpty(e.Torrent.InfoHash, e.InfoHash)
+	}
+	item.GUID = firstNonEmpty(e.GUID, item.MagnetURI, item.TorrentURL, firstNonEmpty(e.Links...), item.Title)
+	return item
+}
+
+// attr 返回 Torznab 属性的值，属性不存在时返回空字符串
+func (e rssEntry) attr(name string) string {
+	for _, attr := range e.Attrs {
+		if strings.EqualFold(attr.Name, name) {
+			return strings.TrimSpace(attr.Value)
+		}
+	}
+	return ""
+}
+
+// use 记录条目中找到的第一个磁力链接
+func (item *feedItem) use(link string) {
+	link = strings.TrimSpace(link)
+	if item.MagnetURI == "" && strings.HasPrefix(link, "magnet:?") {
+		item.MagnetURI = link
+	}
+}
+
+// magnetFromInfoHash 用 info hash 和标题生成磁力链接
+func magnetFromInfoHash(infoHash, title string) string {
+	magnet := "magnet:?xt=urn:btih:" + strings.TrimSpace(infoHash)
+	if title != "" {
+		magnet += "&dn=" + url.QueryEscape(title)
+	}
+	return magnet
+}
+
+// isHTTPURL 判断是否为 http(s) 地址
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// isTorrentFileURL 判断是否为 .torrent 文件地址
+func isTorrentFileURL(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	return err == nil && isHTTPURL(raw) && strings.HasSuffix(strings.ToLower(u.Path), ".torrent")
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
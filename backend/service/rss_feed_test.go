@@ -0,0 +1,65 @@
+package service
+
+import "testing"
+
+func TestParseFeed(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:nyaa="https://nyaa.si/xmlns/nyaa" xmlns:torznab="http://torznab.com/schemas/2015/feed">
+<channel>
+	<item>
+		<title>Magnet link</title>
+		<guid>a</guid>
+		<link>magnet:?xt=urn:btih:1111111111111111111111111111111111111111</link>
+	</item>
+	<item>
+		<title>Torrent file</title>
+		<link>https://example.org/2.torrent</link>
+		<nyaa:infoHash>2222222222222222222222222222222222222222</nyaa:infoHash>
+	</item>
+	<item>
+		<title>Torznab</title>
+		<guid>c</guid>
+		<enclosure url="https://example.org/download?id=3" type="application/x-bittorrent"/>
+		<torznab:attr name="magneturl" value="magnet:?xt=urn:btih:3333333333333333333333333333333333333333"/>
+	</item>
+</channel>
+</rss>`)
+
+	items, err := parseFeed(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("got %d items, want 3", len(items))
+	}
+
+	if items[0].GUID != "a" || items[0].MagnetURI == "" {
+		t.Errorf("magnet item: %+v", items[0])
+	}
+	if items[1].GUID != "https://example.org/2.torrent" || items[1].TorrentURL != items[1].GUID ||
+		items[1].InfoHash != "2222222222222222222222222222222222222222" {
+		t.Errorf("torrent file item: %+v", items[1])
+	}
+	if items[2].MagnetURI != "magnet:?xt=urn:btih:3333333333333333333333333333333333333333" {
+		t.Errorf("torznab item: %+v", items[2])
+	}
+}
+
+func TestParseAtomFeed(t *testing.T) {
+	data := []byte(`<feed xmlns="http://www.w3.org/2005/Atom">
+	<entry>
+		<title>Entry</title>
+		<id>urn:1</id>
+		<link rel="alternate" href="https://example.org/1"/>
+		<link rel="enclosure" type="application/x-bittorrent" href="https://example.org/1.torrent"/>
+	</entry>
+</feed>`)
+
+	items, err := parseFeed(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].GUID != "urn:1" || items[0].TorrentURL != "https://example.org/1.torrent" {
+		t.Errorf("got %+v", items)
+	}
+}
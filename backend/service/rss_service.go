@@ -0,0 +1,408 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/validator"
+)
+
+const (
+	// rssSchedulerInterval 检查哪些订阅需要拉取的间隔
+	rssSchedulerInterval = time.Minute
+	// rssDefaultIntervalMinutes 订阅默认拉取间隔（分钟）
+	rssDefaultIntervalMinutes = 30
+	// rssMinIntervalMinutes 订阅最短拉取间隔（分钟）
+	rssMinIntervalMinutes = 5
+	// rssFetchTimeout 下载订阅或种子文件的超时时间
+	rssFetchTimeout = 30 * time.Second
+	// rssMaxFeedSize 订阅内容的最大字节数
+	rssMaxFeedSize = 5 << 20
+	// rssMaxTorrentSize 种子文件的最大字节数
+	rssMaxTorrentSize = 10 << 20
+	// rssDefaultHistoryLimit 匹配记录默认返回条数
+	rssDefaultHistoryLimit = 100
+)
+
+// ErrFeedNotFound RSS订阅不存在
+var ErrFeedNotFound = errors.New("RSS订阅不存在")
+
+// RSSFeedRequest 创建或修改订阅的请求
+type RSSFeedRequest struct {
+	Name            string `json:"name"`
+	URL             string `json:"url"`
+	Include         string `json:"include"`
+	Exclude         string `json:"exclude"`
+	IntervalMinutes int    `json:"intervalMinutes"`
+	Private         bool   `json:"private"`
+	Enabled         *bool  `json:"enabled"`
+}
+
+// RSSCheckResult 一次拉取的结果
+type RSSCheckResult struct {
+	FeedID    int64         `json:"feedId"`
+	Items     int           `json:"items"`
+	Matched   []*db.RSSItem `json:"matched"`
+	Error     string        `json:"error,omitempty"`
+	CheckedAt time.Time     `json:"checkedAt"`
+}
+
+// RSSService 定期拉取 RSS 订阅，标题匹配 include 且不匹配 exclude 的新条目自动添加为种子
+type RSSService struct {
+	store      *db.RSSStore
+	torrents   *TorrentService
+	httpClient *http.Client
+
+	// checkMu 避免后台拉取与手动触发同时处理同一批条目
+	checkMu sync.Mutex
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewRSSService 创建 RSS 订阅服务
+func NewRSSService(store *db.RSSStore, torrents *TorrentService) *RSSService {
+	return &RSSService{
+		store:      store,
+		torrents:   torrents,
+		httpClient: newTorrentHTTPClient(rssFetchTimeout),
+		stop:       make(chan struct{}),
+	}
+}
+
+// Start 启动后台拉取，启动时立即检查一次到期的订阅
+func (s *RSSService) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(rssSchedulerInterval)
+		defer ticker.Stop()
+
+		for {
+			s.checkDue()
+
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop 停止后台拉取
+func (s *RSSService) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// checkDue 拉取所有已启用且到期的订阅
+func (s *RSSService) checkDue() {
+	feeds, err := s.store.ListFeeds()
+	if err != nil {
+		log.Printf("警告: 加载RSS订阅失败: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, feed := range feeds {
+		if !feed.Enabled {
+			continue
+		}
+		if feed.LastCheckedAt != nil && now.Sub(*feed.LastCheckedAt) < time.Duration(feed.IntervalMinutes)*time.Minute {
+			continue
+		}
+
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		result := s.check(feed)
+		if result.Error != "" {
+			log.Printf("拉取RSS订阅 %s 失败: %s", feed.Name, result.Error)
+		} else if len(result.Matched) > 0 {
+			log.Printf("RSS订阅 %s 匹配 %d 个新条目", feed.Name, len(result.Matched))
+		}
+	}
+}
+
+// ListFeeds 获取所有订阅
+func (s *RSSService) ListFeeds() ([]*db.RSSFeed, error) {
+	return s.store.ListFeeds()
+}
+
+// CreateFeed 添加订阅，下次调度时开始拉取
+func (s *RSSService) CreateFeed(req *RSSFeedRequest) (*db.RSSFeed, error) {
+	feed := &db.RSSFeed{Enabled: true}
+	if err := applyFeedRequest(feed, req); err != nil {
+		return nil, err
+	}
+	if err := s.store.CreateFeed(feed); err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+// UpdateFeed 修改订阅设置
+func (s *RSSService) UpdateFeed(id int64, req *RSSFeedRequest) (*db.RSSFeed, error) {
+	feed, err := s.store.GetFeed(id)
+	if err != nil {
+		return nil, err
+	}
+	if feed == nil {
+		return nil, ErrFeedNotFound
+	}
+
+	if err := applyFeedRequest(feed, req); err != nil {
+		return nil, err
+	}
+	updated, err := s.store.UpdateFeed(feed)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrFeedNotFound
+	}
+	return feed, nil
+}
+
+// DeleteFeed 删除订阅及其匹配记录，已添加的种子保留
+func (s *RSSService) DeleteFeed(id int64) error {
+	deleted, err := s.store.DeleteFeed(id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrFeedNotFound
+	}
+	return nil
+}
+
+// CheckFeed 立即拉取订阅，不受拉取间隔和启用状态限制
+func (s *RSSService) CheckFeed(id int64) (*RSSCheckResult, error) {
+	feed, err := s.store.GetFeed(id)
+	if err != nil {
+		return nil, err
+	}
+	if feed == nil {
+		return nil, ErrFeedNotFound
+	}
+	return s.check(feed), nil
+}
+
+// ListItems 获取匹配记录，feedID 为 0 时返回所有订阅的记录
+func (s *RSSService) ListItems(feedID int64, limit int) ([]*db.RSSItem, error) {
+	if limit <= 0 {
+		limit = rssDefaultHistoryLimit
+	}
+	return s.store.ListItems(feedID, limit)
+}
+
+// check 拉取订阅并添加匹配的新条目，结果记录到订阅的最后检查时间和错误
+func (s *RSSService) check(feed *db.RSSFeed) *RSSCheckResult {
+	s.checkMu.Lock()
+	defer s.checkMu.Unlock()
+
+	result := &RSSCheckResult{
+		FeedID:    feed.ID,
+		Matched:   []*db.RSSItem{},
+		CheckedAt: time.Now(),
+	}
+	if err := s.checkItems(feed, result); err != nil {
+		result.Error = err.Error()
+	}
+	if err := s.store.MarkChecked(feed.ID, result.CheckedAt, result.Error); err != nil {
+		log.Printf("警告: %v", err)
+	}
+	return result
+}
+
+func (s *RSSService) checkItems(feed *db.RSSFeed, result *RSSCheckResult) error {
+	include, exclude, err := compileFeedFilters(feed.IncludePattern, feed.ExcludePattern)
+	if err != nil {
+		return err
+	}
+
+	data, err := s.download(feed.URL, rssMaxFeedSize)
+	if err != nil {
+		return fmt.Errorf("下载订阅失败: %w", err)
+	}
+	items, err := parseFeed(data)
+	if err != nil {
+		return err
+	}
+	result.Items = len(items)
+
+	handled, err := s.store.HandledGUIDs(feed.ID)
+	if err != nil {
+		return err
+	}
+
+	// 订阅通常按从新到旧排列，从最旧的条目开始添加
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		if handled[item.GUID] || !include.MatchString(item.Title) {
+			continue
+		}
+		if exclude != nil && exclude.MatchString(item.Title) {
+			continue
+		}
+
+		record := &db.RSSItem{FeedID: feed.ID, GUID: item.GUID, Title: item.Title}
+		if err := s.addItem(feed, item, record); err != nil {
+			record.Error = err.Error()
+		}
+		if err := s.store.SaveItem(record); err != nil {
+			log.Printf("警告: %v", err)
+		}
+		handled[item.GUID] = true
+		result.Matched = append(result.Matched, record)
+	}
+
+	return nil
+}
+
+// addItem 把条目添加为种子，私有订阅或私有种子文件的条目添加为私有种子
+func (s *RSSService) addItem(feed *db.RSSFeed, item feedItem, record *db.RSSItem) error {
+	magnetURI, private := item.MagnetURI, feed.Private
+	switch {
+	case magnetURI != "":
+	case item.TorrentURL != "":
+		var privateFile bool
+		var err error
+		magnetURI, privateFile, err = resolveTorrentURL(s.httpClient, item.TorrentURL)
+		if err != nil {
+			return err
+		}
+		private = private || privateFile
+	case item.InfoHash != "":
+		magnetURI = magnetFromInfoHash(item.InfoHash, item.Title)
+	default:
+		return fmt.Errorf("条目没有磁力链接或种子文件")
+	}
+	record.MagnetURI = magnetURI
+
+	info, err := s.torrents.AddMagnet(context.Background(), magnetURI, private)
+	if err != nil {
+		return err
+	}
+	record.InfoHash = info.InfoHash
+	return nil
+}
+
+// newTorrentHTTPClient 创建下载种子文件的客户端
+func newTorrentHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		// 种子下载地址可能重定向到磁力链接（如 Jackett），此时停止跟随并读取 Location
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme == "magnet" {
+				return http.ErrUseLastResponse
+			}
+			if len(via) >= 10 {
+				return errors.New("重定向次数过多")
+			}
+			return nil
+		},
+	}
+}
+
+// resolveTorrentURL 下载种子文件并转换为磁力链接，地址重定向到磁力链接时直接使用
+func resolveTorrentURL(client *http.Client, rawURL string) (string, bool, error) {
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return "", false, fmt.Errorf("下载种子文件失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if location := resp.Header.Get("Location"); strings.HasPrefix(location, "magnet:?") {
+		return location, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("下载种子文件失败: HTTP %d", resp.StatusCode)
+	}
+
+	magnetURI, private, err := torrent.MagnetFromTorrentFile(io.LimitReader(resp.Body, rssMaxTorrentSize))
+	if err != nil {
+		return "", false, fmt.Errorf("解析种子文件失败: %w", err)
+	}
+	return magnetURI, private, nil
+}
+
+// download 下载地址内容，最多读取 limit 字节
+func (s *RSSService) download(rawURL string, limit int64) ([]byte, error) {
+	resp, err := s.httpClient.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// applyFeedRequest 校验请求并写入订阅
+func applyFeedRequest(feed *db.RSSFeed, req *RSSFeedRequest) error {
+	req.URL = strings.TrimSpace(req.URL)
+	if !isHTTPURL(req.URL) {
+		return validator.ValidationError{Field: "url", Message: "必须为 http 或 https 地址"}
+	}
+	if strings.TrimSpace(req.Include) == "" {
+		return validator.ValidationError{Field: "include", Message: "不能为空，匹配所有条目请使用 .*"}
+	}
+	if _, _, err := compileFeedFilters(req.Include, req.Exclude); err != nil {
+		return err
+	}
+
+	interval := req.IntervalMinutes
+	if interval == 0 {
+		interval = rssDefaultIntervalMinutes
+	}
+	if interval < rssMinIntervalMinutes {
+		return validator.ValidationError{Field: "intervalMinutes", Message: fmt.Sprintf("不能少于 %d 分钟", rssMinIntervalMinutes)}
+	}
+
+	feed.Name = strings.TrimSpace(req.Name)
+	if feed.Name == "" {
+		feed.Name = req.URL
+	}
+	feed.URL = req.URL
+	feed.IncludePattern = req.Include
+	feed.ExcludePattern = req.Exclude
+	feed.IntervalMinutes = interval
+	feed.Private = req.Private
+	if req.Enabled != nil {
+		feed.Enabled = *req.Enabled
+	}
+	return nil
+}
+
+// compileFeedFilters 编译订阅的过滤规则，exclude 为空时返回 nil
+func compileFeedFilters(includePattern, excludePattern string) (*regexp.Regexp, *regexp.Regexp, error) {
+	include, err := regexp.Compile(includePattern)
+	if err != nil {
+		return nil, nil, validator.ValidationError{Field: "include", Message: "无效的正则表达式: " + err.Error()}
+	}
+	if excludePattern == "" {
+		return include, nil, nil
+	}
+	exclude, err := regexp.Compile(excludePattern)
+	if err != nil {
+		return nil, nil, validator.ValidationError{Field: "exclude", Message: "无效的正则表达式: " + err.Error()}
+	}
+	return include, exclude, nil
+}
@@ -0,0 +1,298 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// anilistAPIURL is the AniList GraphQL endpoint
+var anilistAPIURL = "https://graphql.anilist.co"
+
+// anilistClient is used for AniList requests
+var anilistClient = &http.Client{Timeout: 15 * time.Second}
+
+// anilistMaxSeasons bounds the walk along prequel and sequel relations
+const anilistMaxSeasons = 20
+
+// AniList formats that make up the seasons of a series. Movies, OVAs and
+// specials are related entries but are not numbered with the series.
+var anilistSeasonFormats = map[string]bool{"TV": true, "TV_SHORT": true, "ONA": true}
+
+// htmlBreakPattern and htmlTagPattern clean up the HTML AniList puts in
+// descriptions, line breaks become newlines
+var (
+	htmlBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>`)
+	htmlTagPattern   = regexp.MustCompile(`<[^>]+>`)
+)
+
+const anilistMediaFields = `
+	id
+	format
+	status
+	episodes
+	seasonYear
+	startDate { year month day }
+	title { romaji english native }
+	description(asHtml: false)
+	coverImage { extraLarge large }
+	bannerImage
+	averageScore
+	popularity
+	genres
+	relations { edges { relationType node { id type format episodes } } }
+`
+
+// AnimeInfo represents an anime on AniList. AniList has one entry per
+// season (or cour), so a series is a chain of entries linked as sequels.
+type AnimeInfo struct {
+	AnilistID   int      `json:"anilistId"`
+	Title       string   `json:"title"`
+	RomajiTitle string   `json:"romajiTitle,omitempty"`
+	NativeTitle string   `json:"nativeTitle,omitempty"`
+	Year        int      `json:"year,omitempty"`
+	StartDate   string   `json:"startDate,omitempty"`
+	PosterURL   string   `json:"posterUrl,omitempty"`
+	BannerURL   string   `json:"bannerUrl,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Score       float64  `json:"score,omitempty"` // 0-10, like TMDB ratings
+	Popularity  int      `json:"popularity,omitempty"`
+	Genres      []string `json:"genres,omitempty"`
+	Status      string   `json:"status,omitempty"`
+	Format      string   `json:"format,omitempty"` // TV, MOVIE, OVA, ...
+	Episodes    int      `json:"episodes,omitempty"`
+
+	prequelID, sequelID int
+}
+
+// IsSeries reports whether the anime is a season of a series rather than a
+// movie, OVA or special
+func (a AnimeInfo) IsSeries() bool {
+	return anilistSeasonFormats[a.Format]
+}
+
+// AnimeSeason is one entry of a series in airing order
+type AnimeSeason struct {
+	AnilistID int `json:"anilistId"`
+	Episodes  int `json:"episodes"` // 0 while the number is unknown
+}
+
+// anilistMedia is the Media object returned by the AniList API
+type anilistMedia struct {
+	ID         int    `json:"id"`
+	Format     string `json:"format"`
+	Status     string `json:"status"`
+	Episodes   int    `json:"episodes"`
+	SeasonYear int    `json:"seasonYear"`
+	StartDate  struct {
+		Year  int `json:"year"`
+		Month int `json:"month"`
+		Day   int `json:"day"`
+	} `json:"startDate"`
+	Title struct {
+		Romaji  string `json:"romaji"`
+		English string `json:"english"`
+		Native  string `json:"native"`
+	} `json:"title"`
+	Description string `json:"description"`
+	CoverImage  struct {
+		ExtraLarge string `json:"extraLarge"`
+		Large      string `json:"large"`
+	} `json:"coverImage"`
+	BannerImage  string   `json:"bannerImage"`
+	AverageScore int      `json:"averageScore"`
+	Popularity   int      `json:"popularity"`
+	Genres       []string `json:"genres"`
+	Relations    struct {
+		Edges []struct {
+			RelationType string `json:"relationType"`
+			Node         struct {
+				ID       int    `json:"id"`
+				Type     string `json:"type"`
+				Format   string `json:"format"`
+				Episodes int    `json:"episodes"`
+			} `json:"node"`
+		} `json:"edges"`
+	} `json:"relations"`
+}
+
+// SearchAnime searches AniList for an anime and returns the best match.
+// year filters on the season year and is ignored when 0.
+func SearchAnime(name string, year int) (AnimeInfo, error) {
+	query := `query ($search: String, $year: Int) {
+		Page(perPage: 1) {
+			media(search: $search, type: ANIME, seasonYear: $year, sort: SEARCH_MATCH) {` + anilistMediaFields + `}
+		}
+	}`
+	variables := map[string]interface{}{"search": name}
+	if year > 0 {
+		variables["year"] = year
+	}
+
+	var data struct {
+		Page struct {
+			Media []anilistMedia `json:"media"`
+		} `json:"Page"`
+	}
+	if err := anilistQuery(query, variables, &data); err != nil {
+		return AnimeInfo{}, err
+	}
+	if len(data.Page.Media) == 0 {
+		return AnimeInfo{}, fmt.Errorf("no anime found matching '%s'", name)
+	}
+	return animeInfo(data.Page.Media[0]), nil
+}
+
+// GetAnime fetches an anime by its AniList ID
+func GetAnime(anilistID int) (AnimeInfo, error) {
+	query := `query ($id: Int) { Media(id: $id, type: ANIME) {` + anilistMediaFields + `} }`
+
+	var data struct {
+		Media *anilistMedia `json:"Media"`
+	}
+	if err := anilistQuery(query, map[string]interface{}{"id": anilistID}, &data); err != nil {
+		return AnimeInfo{}, err
+	}
+	if data.Media == nil {
+		return AnimeInfo{}, fmt.Errorf("anime %d not found", anilistID)
+	}
+	return animeInfo(*data.Media), nil
+}
+
+// GetAnimeSeasons follows the prequel and sequel relations of an anime and
+// returns the seasons of its series in airing order, together with the
+// index of the given anime in that list.
+func GetAnimeSeasons(anime AnimeInfo) ([]AnimeSeason, int, error) {
+	seasons := []AnimeSeason{{AnilistID: anime.AnilistID, Episodes: anime.Episodes}}
+	index := 0
+
+	for prequel := anime.prequelID; prequel != 0 && len(seasons) < anilistMaxSeasons; {
+		entry, err := GetAnime(prequel)
+		if err != nil {
+			return nil, 0, err
+		}
+		seasons = append([]AnimeSeason{{AnilistID: entry.AnilistID, Episodes: entry.Episodes}}, seasons...)
+		index++
+		prequel = entry.prequelID
+	}
+	for sequel := anime.sequelID; sequel != 0 && len(seasons) < anilistMaxSeasons; {
+		entry, err := GetAnime(sequel)
+		if err != nil {
+			return nil, 0, err
+		}
+		seasons = append(seasons, AnimeSeason{AnilistID: entry.AnilistID, Episodes: entry.Episodes})
+		sequel = entry.sequelID
+	}
+	return seasons, index, nil
+}
+
+// MapAbsoluteEpisode converts an episode number of the season at index into
+// a season and episode. Fansub releases of a later season either restart
+// counting (Title S2 - 03) or keep counting from the first season (Title -
+// 27): numbers that fit into the season are taken as counted from its start,
+// larger ones as counted from the start of the series. Seasons are numbered
+// from 1 and the last season takes any episodes beyond the known counts.
+func MapAbsoluteEpisode(seasons []AnimeSeason, index, episode int) (int, int) {
+	if len(seasons) == 0 {
+		return 1, episode
+	}
+	if index < 0 || index >= len(seasons) {
+		index = 0
+	}
+	if seasons[index].Episodes == 0 || episode <= seasons[index].Episodes {
+		return index + 1, episode
+	}
+
+	remaining := episode
+	for i, season := range seasons {
+		if season.Episodes == 0 || remaining <= season.Episodes || i == len(seasons)-1 {
+			return i + 1, remaining
+		}
+		remaining -= season.Episodes
+	}
+	return len(seasons), remaining
+}
+
+// anilistQuery posts a GraphQL query to AniList and decodes the data into out
+func anilistQuery(query string, variables map[string]interface{}, out interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", anilistAPIURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := anilistClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 4<<20)).Decode(&result); err != nil {
+		return fmt.Errorf("AniList request failed: %s", res.Status)
+	}
+	// a missing Media is reported as a 404 error with null data
+	if len(result.Errors) > 0 && (res.StatusCode != http.StatusNotFound || len(result.Data) == 0) {
+		return fmt.Errorf("AniList request failed: %s %s", res.Status, result.Errors[0].Message)
+	}
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("AniList request failed: %s", res.Status)
+	}
+	return json.Unmarshal(result.Data, out)
+}
+
+// animeInfo converts an AniList Media object
+func animeInfo(media anilistMedia) AnimeInfo {
+	info := AnimeInfo{
+		AnilistID:   media.ID,
+		Title:       firstNonEmpty(media.Title.English, media.Title.Romaji, media.Title.Native),
+		RomajiTitle: media.Title.Romaji,
+		NativeTitle: media.Title.Native,
+		Year:        media.SeasonYear,
+		PosterURL:   firstNonEmpty(media.CoverImage.ExtraLarge, media.CoverImage.Large),
+		BannerURL:   media.BannerImage,
+		Description: strings.TrimSpace(htmlTagPattern.ReplaceAllString(htmlBreakPattern.ReplaceAllString(media.Description, "\n"), "")),
+		Score:       float64(media.AverageScore) / 10,
+		Popularity:  media.Popularity,
+		Genres:      media.Genres,
+		Status:      media.Status,
+		Format:      media.Format,
+		Episodes:    media.Episodes,
+	}
+	if info.Year == 0 {
+		info.Year = media.StartDate.Year
+	}
+	if media.StartDate.Year > 0 && media.StartDate.Month > 0 && media.StartDate.Day > 0 {
+		info.StartDate = fmt.Sprintf("%04d-%02d-%02d", media.StartDate.Year, media.StartDate.Month, media.StartDate.Day)
+	}
+
+	for _, edge := range media.Relations.Edges {
+		node := edge.Node
+		if node.Type != "ANIME" || !anilistSeasonFormats[node.Format] {
+			continue
+		}
+		switch {
+		case edge.RelationType == "PREQUEL" && info.prequelID == 0:
+			info.prequelID = node.ID
+		case edge.RelationType == "SEQUEL" && info.sequelID == 0:
+			info.sequelID = node.ID
+		}
+	}
+	return info
+}
@@ -0,0 +1,102 @@
+package search
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// crcPattern matches the CRC32 checksum fansub groups put in file names, e.g. [ABCD1234]
+	crcPattern = regexp.MustCompile(`[\[(][0-9A-Fa-f]{8}[\])]`)
+	// creditlessPattern matches creditless openings and endings (NCOP, NCED1)
+	creditlessPattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])NC(?:OP|ED)\d*(?:[^a-z0-9]|$)`)
+	// batchPattern matches episode ranges of batch releases, e.g. (01-28) or [Batch]
+	batchPattern = regexp.MustCompile(`(?i)[\[(](?:\d{1,4}\s*[-~]\s*\d{1,4}|batch)[\])]`)
+
+	// absoluteEpisodePatterns match episode numbers without a season, most
+	// specific first. Each pattern captures the episode.
+	absoluteEpisodePatterns = []*regexp.Regexp{
+		// Title - 05, Title - 1000v2
+		regexp.MustCompile(`\s-\s(\d{1,4})(?:v\d)?(?:\s|[\[(]|$)`),
+		// Title [05], Title【05】
+		regexp.MustCompile(`[\[【](\d{1,3})(?:v\d)?[\]】]`),
+		// 第05话
+		regexp.MustCompile(`第\s*(\d{1,4})\s*[话話集]`),
+		// EP05, Ep.05, E05
+		regexp.MustCompile(`(?i)(?:^|[^a-z0-9])ep?\.?\s?(\d{1,4})(?:v\d)?(?:[^0-9a-z]|$)`),
+	}
+
+	// trailingEpisodePattern matches the episode left at the end of a parsed title
+	trailingEpisodePattern = regexp.MustCompile(`\s+-\s+\d{1,4}(?:v\d)?$`)
+)
+
+// IsAnimeRelease guesses whether a torrent or file name is an anime release.
+// Fansub releases start with the group in brackets and carry an absolute
+// episode number, a CRC32 checksum, a batch range or creditless OP/ED files.
+func IsAnimeRelease(name string) bool {
+	name = strings.TrimSpace(path.Base(strings.ReplaceAll(name, "\\", "/")))
+
+	score := 0
+	if leadingGroupPattern.MatchString(name) {
+		score++
+	}
+	if crcPattern.MatchString(name) {
+		score += 2
+	}
+	if creditlessPattern.MatchString(name) {
+		score += 2
+	}
+	if batchPattern.MatchString(name) {
+		score++
+	}
+	if _, ok := ParseAbsoluteEpisode(name); ok {
+		score++
+	}
+	return score >= 2
+}
+
+// IsCreditless reports whether a file is a creditless opening or ending,
+// which belongs to no episode
+func IsCreditless(filename string) bool {
+	return creditlessPattern.MatchString(path.Base(filename))
+}
+
+// ParseAbsoluteEpisode extracts an episode number that is counted from the
+// first episode of the series, as in "[Group] Title - 27 (1080p).mkv".
+// Names with a season marker and creditless OP/ED files have none.
+func ParseAbsoluteEpisode(filename string) (int, bool) {
+	name := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	if releaseExtensions[strings.ToLower(path.Ext(name))] {
+		name = strings.TrimSuffix(name, path.Ext(name))
+	}
+	if IsCreditless(name) {
+		return 0, false
+	}
+	if _, _, ok := ParseEpisode(name); ok {
+		return 0, false
+	}
+	// the leading group may contain digits, e.g. [Erai-raws] or [VCB-Studio]
+	if loc := leadingGroupPattern.FindStringIndex(name); loc != nil {
+		name = name[loc[1]:]
+	}
+
+	for _, pattern := range absoluteEpisodePatterns {
+		match := pattern.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		episode, _ := strconv.Atoi(match[1])
+		if episode > 0 {
+			return episode, true
+		}
+	}
+	return 0, false
+}
+
+// AnimeTitle removes the episode number left at the end of a title parsed
+// from an anime release, e.g. "Sousou no Frieren - 05"
+func AnimeTitle(title string) string {
+	return strings.TrimSpace(trailingEpisodePattern.ReplaceAllString(title, ""))
+}
@@ -0,0 +1,83 @@
+package search
+
+import "testing"
+
+func TestParseAbsoluteEpisode(t *testing.T) {
+	tests := []struct {
+		filename string
+		episode  int
+		ok       bool
+	}{
+		{"[SubsPlease] Sousou no Frieren - 05 (1080p) [ABCD1234].mkv", 5, true},
+		{"[SubsPlease] Sousou no Frieren - 27v2 (1080p).mkv", 27, true},
+		{"One Piece - 1000 [1080p].mkv", 1000, true},
+		{"[Nekomoe kissaten] Title [05][1080p].mp4", 5, true},
+		{"[喵萌奶茶屋&LoliHouse] 葬送的芙莉莲 - 05 [WebRip 1080p HEVC-10bit AAC].mkv", 5, true},
+		{"[Group] 某动画 第12话 [1080p].mp4", 12, true},
+		{"Show EP05 1080p.mkv", 5, true},
+		{"[VCB-Studio] Title [NCOP1][Ma10p_1080p].mkv", 0, false},
+		{"Show.Name.S01E02.1080p.mkv", 0, false},
+		{"The.Matrix.1999.1080p.BluRay.x264-GRP.mkv", 0, false},
+	}
+
+	for _, tt := range tests {
+		episode, ok := ParseAbsoluteEpisode(tt.filename)
+		if episode != tt.episode || ok != tt.ok {
+			t.Errorf("ParseAbsoluteEpisode(%q) = %d, %v; want %d, %v", tt.filename, episode, ok, tt.episode, tt.ok)
+		}
+	}
+}
+
+func TestIsAnimeRelease(t *testing.T) {
+	tests := []struct {
+		name  string
+		anime bool
+	}{
+		{"[SubsPlease] Sousou no Frieren - 05 (1080p) [ABCD1234].mkv", true},
+		{"[SubsPlease] Sousou no Frieren (01-28) (1080p) [Batch]", true},
+		{"[Nekomoe kissaten] Title [05][1080p].mp4", true},
+		{"[VCB-Studio] Title [NCOP1][Ma10p_1080p].mkv", true},
+		{"[YTS.MX] Movie (2020) [1080p]", false},
+		{"[rarbg] Show.S01E02.1080p", false},
+		{"The.Matrix.1999.1080p.BluRay.x264-GRP.mkv", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsAnimeRelease(tt.name); got != tt.anime {
+			t.Errorf("IsAnimeRelease(%q) = %v; want %v", tt.name, got, tt.anime)
+		}
+	}
+}
+
+func TestAnimeTitle(t *testing.T) {
+	release := ParseRelease("[SubsPlease] Sousou no Frieren - 05 (1080p) [ABCD1234].mkv")
+	if got := AnimeTitle(release.Title); got != "Sousou no Frieren" {
+		t.Errorf("AnimeTitle(%q) = %q; want %q", release.Title, got, "Sousou no Frieren")
+	}
+}
+
+func TestMapAbsoluteEpisode(t *testing.T) {
+	// two seasons of 12 and 13 episodes and a third that is still airing
+	seasons := []AnimeSeason{{AnilistID: 1, Episodes: 12}, {AnilistID: 2, Episodes: 13}, {AnilistID: 3}}
+	tests := []struct {
+		index, absolute int
+		season, episode int
+	}{
+		{0, 5, 1, 5},
+		{0, 15, 2, 3},
+		{0, 30, 3, 5},
+		// numbering restarted with the matched season
+		{1, 3, 2, 3},
+		// numbering continued from the first season
+		{1, 20, 2, 8},
+		{2, 40, 3, 40},
+	}
+
+	for _, tt := range tests {
+		season, episode := MapAbsoluteEpisode(seasons, tt.index, tt.absolute)
+		if season != tt.season || episode != tt.episode {
+			t.Errorf("MapAbsoluteEpisode(%d, %d) = %d, %d; want %d, %d",
+				tt.index, tt.absolute, season, episode, tt.season, tt.episode)
+		}
+	}
+}
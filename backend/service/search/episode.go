@@ -0,0 +1,36 @@
+package search
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+)
+
+// episodePatterns match season/episode markers in release file names, most
+// specific first. Each pattern captures the season and then the episode.
+var episodePatterns = []*regexp.Regexp{
+	// S01E02, S01.E02, s1e2, S01E02-E03 (the first episode wins)
+	regexp.MustCompile(`(?i)(?:^|[^a-z0-9])s(\d{1,2})[ ._-]?e(\d{1,4})(?:[^0-9]|$)`),
+	// 1x02, 01x02
+	regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(\d{1,2})x(\d{2,3})(?:[^0-9]|$)`),
+	// 第1季第2集
+	regexp.MustCompile(`第\s*(\d{1,2})\s*季.*?第\s*(\d{1,4})\s*[集话話]`),
+}
+
+// ParseEpisode extracts the season and episode numbers from a file name or
+// path. The base name is tried first so that a pack folder such as
+// Show.S01E01-E10 does not shadow the marker of the file inside it.
+func ParseEpisode(filename string) (season, episode int, ok bool) {
+	for _, candidate := range []string{path.Base(filename), filename} {
+		for _, pattern := range episodePatterns {
+			match := pattern.FindStringSubmatch(candidate)
+			if match == nil {
+				continue
+			}
+			season, _ = strconv.Atoi(match[1])
+			episode, _ = strconv.Atoi(match[2])
+			return season, episode, true
+		}
+	}
+	return 0, 0, false
+}
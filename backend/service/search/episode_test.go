@@ -0,0 +1,30 @@
+package search
+
+import "testing"
+
+func TestParseEpisode(t *testing.T) {
+	tests := []struct {
+		filename        string
+		season, episode int
+		ok              bool
+	}{
+		{"Show.Name.S01E02.1080p.WEB-DL.mkv", 1, 2, true},
+		{"show name s2e10 720p.mp4", 2, 10, true},
+		{"Show.S03.E04.mkv", 3, 4, true},
+		{"Show.S01E01-E02.mkv", 1, 1, true},
+		{"Show.1x05.avi", 1, 5, true},
+		{"Show.S01E01-E10/Show.S01E07.mkv", 1, 7, true},
+		{"Show.S02E01/extras/sample.mkv", 2, 1, true},
+		{"某剧.第2季.第13集.mp4", 2, 13, true},
+		{"Movie.2024.1920x1080.x264.mkv", 0, 0, false},
+		{"Movie.2024.mkv", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		season, episode, ok := ParseEpisode(tt.filename)
+		if season != tt.season || episode != tt.episode || ok != tt.ok {
+			t.Errorf("ParseEpisode(%q) = %d, %d, %v; want %d, %d, %v",
+				tt.filename, season, episode, ok, tt.season, tt.episode, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	jsonschema "github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// LLM providers that can recognize titles
+const (
+	ProviderNone   = "none"
+	ProviderCoze   = "coze"
+	ProviderOpenAI = "openai"
+	ProviderJina   = "jina"
+	ProviderAzure  = "azure"
+	ProviderOllama = "ollama"
+)
+
+// Providers lists every supported LLM provider
+var Providers = []string{ProviderNone, ProviderCoze, ProviderOpenAI, ProviderJina, ProviderAzure, ProviderOllama}
+
+// providerDefaults are the base URL and model used when none is configured
+var providerDefaults = map[string]struct{ baseURL, model string }{
+	ProviderOpenAI: {"https://api.openai.com/v1", "gpt-4o-mini"},
+	ProviderJina:   {"https://deepsearch.jina.ai/v1", "jina-deepsearch-v1"},
+	ProviderOllama: {"http://localhost:11434/v1", "qwen2.5:7b"},
+}
+
+const (
+	titlePrompt            = "你现在要帮用户根据一个magnet 文件名获取这个magnet 中的电影名称，以及电影上映的年份，并且最后只返回json格式的数据，例如用户输入的是\"s子w：m法s传q.2024.HD1080p.中文字幕.mp4\"，那么你就要在网上搜索用户要处理的信息并加上\"电影\" 关键字，并根据互联网信息然后推断出这部电影的名字是\"狮子王: 木法沙传奇\",然后你回答的就只能是一个json格式的字符串数据\"{\"filename\":\"狮子王: 木法沙传奇\",\"year\":2024}\"\", 不要带任何\"根据提供的文件...\" 等等这种额外信息。"
+	titleSchemaDescription = "你现在要帮用户根据一个magnet 文件名获取这个magnet 中的电影名称，以及电影上映的年份，并且最后只返回json格式的数据，例如用户输入的是\"s子w：m法s传q.2024.HD1080p.中文字幕.mp4\", 然后你回答的就只能是一个json格式的字符串数据\"{\"filename\":\"狮子王: 木法沙传奇\",\"year\":2024}\""
+)
+
+// LLMConfig selects the LLM used to recognize titles. BaseURL and Model
+// fall back to the provider's defaults; Azure needs both, with Model being
+// the deployment name.
+type LLMConfig struct {
+	Provider   string
+	BaseURL    string
+	Model      string
+	APIKey     string
+	APIVersion string // Azure only
+	Timeout    time.Duration
+	Retries    int
+}
+
+// TitleRecognizer asks an LLM for the title and year of a release name
+type TitleRecognizer interface {
+	RecognizeTitle(ctx context.Context, name string) (SearchFileResponse, error)
+}
+
+// NewTitleRecognizer creates the recognizer for the configured provider,
+// nil for ProviderNone. Each request is limited to Timeout and failed
+// requests are retried Retries times with exponential backoff.
+func NewTitleRecognizer(cfg LLMConfig) (TitleRecognizer, error) {
+	var recognizer TitleRecognizer
+	switch cfg.Provider {
+	case ProviderNone:
+		return nil, nil
+	case ProviderCoze:
+		recognizer = cozeRecognizer{}
+	case ProviderOpenAI, ProviderJina, ProviderOllama:
+		defaults := providerDefaults[cfg.Provider]
+		clientConfig := openai.DefaultConfig(cfg.APIKey)
+		clientConfig.BaseURL = firstNonEmpty(cfg.BaseURL, defaults.baseURL)
+		recognizer = &chatRecognizer{
+			client: openai.NewClientWithConfig(clientConfig),
+			model:  firstNonEmpty(cfg.Model, defaults.model),
+		}
+	case ProviderAzure:
+		if cfg.BaseURL == "" || cfg.Model == "" {
+			return nil, fmt.Errorf("azure needs a base URL and a deployment name as the model")
+		}
+		clientConfig := openai.DefaultAzureConfig(cfg.APIKey, cfg.BaseURL)
+		if cfg.APIVersion != "" {
+			clientConfig.APIVersion = cfg.APIVersion
+		}
+		// the model is the deployment name as configured
+		clientConfig.AzureModelMapperFunc = func(model string) string { return model }
+		recognizer = &chatRecognizer{
+			client: openai.NewClientWithConfig(clientConfig),
+			model:  cfg.Model,
+		}
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", cfg.Provider)
+	}
+
+	return &retryingRecognizer{
+		recognizer: recognizer,
+		timeout:    cfg.Timeout,
+		retries:    cfg.Retries,
+	}, nil
+}
+
+// chatRecognizer uses an OpenAI compatible chat completions API
+type chatRecognizer struct {
+	client *openai.Client
+	model  string
+}
+
+func (r *chatRecognizer) RecognizeTitle(ctx context.Context, name string) (SearchFileResponse, error) {
+	schema, _ := jsonschema.GenerateSchemaForType(SearchFileResponse{})
+	resp, err := r.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: r.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: titlePrompt},
+			{Role: openai.ChatMessageRoleUser, Content: name},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:        "SearchFileResponse",
+				Description: titleSchemaDescription,
+				Strict:      true,
+				Schema:      schema,
+			},
+		},
+	})
+	if err != nil {
+		return SearchFileResponse{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return SearchFileResponse{}, fmt.Errorf("empty response from model %s", r.model)
+	}
+	return parseTitleContent(resp.Choices[0].Message.Content)
+}
+
+// cozeRecognizer uses the Coze bot configured through the COZECOM* variables
+type cozeRecognizer struct{}
+
+func (cozeRecognizer) RecognizeTitle(ctx context.Context, name string) (SearchFileResponse, error) {
+	return structSearchFileViaCoze(ctx, name)
+}
+
+// retryingRecognizer adds a per-request timeout and retries to a recognizer
+type retryingRecognizer struct {
+	recognizer TitleRecognizer
+	timeout    time.Duration
+	retries    int
+}
+
+func (r *retryingRecognizer) RecognizeTitle(ctx context.Context, name string) (SearchFileResponse, error) {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if r.timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, r.timeout)
+		}
+		result, err := r.recognizer.RecognizeTitle(attemptCtx, name)
+		cancel()
+		if err == nil || attempt >= r.retries || !retryable(err) {
+			return result, err
+		}
+
+		log.Printf("Warning: title recognition failed (attempt %d/%d), retrying in %s: %v", attempt+1, r.retries+1, backoff, err)
+		select {
+		case <-ctx.Done():
+			return SearchFileResponse{}, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// retryable reports whether a failed request may succeed when sent again.
+// Client errors other than rate limiting are not retried.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusTooManyRequests || apiErr.HTTPStatusCode >= 500
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.HTTPStatusCode == http.StatusTooManyRequests || requestErr.HTTPStatusCode >= 500
+	}
+	return true
+}
+
+// parseTitleContent extracts the JSON object from a model answer, which may
+// be wrapped in reasoning or markdown
+func parseTitleContent(content string) (SearchFileResponse, error) {
+	if idx := strings.Index(content, "{"); idx >= 0 {
+		content = content[idx:]
+	}
+	if idx := strings.LastIndex(content, "}"); idx >= 0 {
+		content = content[:idx+1]
+	}
+	var result SearchFileResponse
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return SearchFileResponse{}, fmt.Errorf("error parsing content as SearchFileResponse: %w", err)
+	}
+	return result, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
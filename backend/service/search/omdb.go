@@ -0,0 +1,100 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	urlPkg "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// omdbAPIBaseURL is the OMDb API endpoint
+var omdbAPIBaseURL = "https://www.omdbapi.com/"
+
+// omdbClient is used for OMDb requests, which are optional and must not hold up a match
+var omdbClient = &http.Client{Timeout: 10 * time.Second}
+
+// Ratings are the IMDb and Rotten Tomatoes ratings and the content rating
+// of a title from OMDb. Missing values are zero or empty.
+type Ratings struct {
+	ImdbID         string  `json:"imdbId,omitempty"`
+	ImdbRating     float64 `json:"imdbRating,omitempty"`
+	ImdbVotes      int     `json:"imdbVotes,omitempty"`
+	RottenTomatoes int     `json:"rottenTomatoes,omitempty"` // Tomatometer in percent
+	ContentRating  string  `json:"contentRating,omitempty"`  // PG-13, TV-MA etc.
+}
+
+// OMDbResponse represents the response structure from the OMDb API
+type OMDbResponse struct {
+	Response   string `json:"Response"`
+	Error      string `json:"Error"`
+	ImdbID     string `json:"imdbID"`
+	ImdbRating string `json:"imdbRating"`
+	ImdbVotes  string `json:"imdbVotes"`
+	Rated      string `json:"Rated"`
+	Ratings    []struct {
+		Source string `json:"Source"`
+		Value  string `json:"Value"`
+	} `json:"Ratings"`
+}
+
+// GetRatings fetches the ratings of an IMDb title such as "tt0133093" from OMDb
+func GetRatings(apiKey, imdbID string) (Ratings, error) {
+	if apiKey == "" {
+		return Ratings{}, fmt.Errorf("OMDb API key not set")
+	}
+	if imdbID == "" {
+		return Ratings{}, fmt.Errorf("no IMDb ID")
+	}
+
+	query := urlPkg.Values{}
+	query.Set("i", imdbID)
+	query.Set("apikey", apiKey)
+
+	res, err := omdbClient.Get(omdbAPIBaseURL + "?" + query.Encode())
+	if err != nil {
+		return Ratings{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return Ratings{}, fmt.Errorf("OMDb request for %s failed: %s %s", imdbID, res.Status, strings.TrimSpace(string(body)))
+	}
+
+	var omdbResp OMDbResponse
+	if err := json.NewDecoder(res.Body).Decode(&omdbResp); err != nil {
+		return Ratings{}, err
+	}
+	if omdbResp.Response != "True" {
+		return Ratings{}, fmt.Errorf("OMDb request for %s failed: %s", imdbID, omdbResp.Error)
+	}
+
+	ratings := Ratings{
+		ImdbID:        omdbResp.ImdbID,
+		ImdbRating:    parseOMDbFloat(omdbResp.ImdbRating),
+		ImdbVotes:     int(parseOMDbFloat(strings.ReplaceAll(omdbResp.ImdbVotes, ",", ""))),
+		ContentRating: omdbResp.Rated,
+	}
+	if ratings.ContentRating == "N/A" {
+		ratings.ContentRating = ""
+	}
+	for _, rating := range omdbResp.Ratings {
+		if rating.Source == "Rotten Tomatoes" {
+			ratings.RottenTomatoes = int(parseOMDbFloat(strings.TrimSuffix(rating.Value, "%")))
+		}
+	}
+	return ratings, nil
+}
+
+// parseOMDbFloat parses an OMDb number, which is "N/A" when unknown
+func parseOMDbFloat(value string) float64 {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return number
+}
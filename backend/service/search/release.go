@@ -0,0 +1,275 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Ways a title can be identified, reported in TitleMatch.Method
+const (
+	MethodParser = "parser"
+	MethodLLM    = "llm"
+)
+
+// minParserConfidence is the confidence from which the parsed title is used
+// without asking the LLM
+const minParserConfidence = 0.7
+
+// TitleMatch is the title and year identified from a release name
+type TitleMatch struct {
+	Title   string  `json:"title"`
+	Year    int     `json:"year,omitempty"`
+	Method  string  `json:"method"`
+	Release Release `json:"release"`
+}
+
+// Release is a release name broken into its parts, in the spirit of guessit.
+// Confidence is between 0 and 1 and says how likely Title is the real title.
+type Release struct {
+	Title      string  `json:"title"`
+	Year       int     `json:"year,omitempty"`
+	Season     int     `json:"season,omitempty"`
+	Episode    int     `json:"episode,omitempty"`
+	Resolution string  `json:"resolution,omitempty"`
+	Source     string  `json:"source,omitempty"`
+	Codec      string  `json:"codec,omitempty"`
+	Group      string  `json:"group,omitempty"`
+	Confidence float64 `json:"confidence"`
+}
+
+var (
+	// releaseExtensions are stripped from the end of file names
+	releaseExtensions = map[string]bool{
+		".mkv": true, ".mp4": true, ".avi": true, ".mov": true, ".wmv": true,
+		".flv": true, ".webm": true, ".m4v": true, ".ts": true, ".m2ts": true,
+		".rmvb": true, ".torrent": true,
+	}
+
+	leadingGroupPattern  = regexp.MustCompile(`^\s*[\[【]([^\]】]+)[\]】]\s*`)
+	trailingGroupPattern = regexp.MustCompile(`-([A-Za-z0-9][A-Za-z0-9@&]*)\s*$`)
+	bracketPattern       = regexp.MustCompile(`[\[【(（][^\]】)）]*[\]】)）]`)
+	yearPattern          = regexp.MustCompile(`(?:19|20)\d{2}`)
+	resolutionPattern    = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(2160p|1440p|1080[pi]|720p|576p|480p|4k|uhd)(?:[^a-z0-9]|$)`)
+	sourcePattern        = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(blu-?ray|bdrip|brrip|bdremux|remux|web-?dl|web-?rip|webrip|hdtv|hdrip|dvdrip|dvd|hdtc|hdts|cam|web)(?:[^a-z0-9]|$)`)
+	seasonPattern        = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(?:s|season[ ._]?)(\d{1,2})(?:[^a-z0-9]|$)`)
+	codecPattern         = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(x\.?26[45]|h\.?26[45]|hevc|avc|xvid|divx|av1)(?:[^a-z0-9]|$)`)
+	separatorPattern     = regexp.MustCompile(`[._\s]+`)
+)
+
+// sourceNames maps source tags to a canonical spelling
+var sourceNames = map[string]string{
+	"bluray": "BluRay", "blu-ray": "BluRay", "bdrip": "BDRip", "brrip": "BDRip",
+	"bdremux": "Remux", "remux": "Remux", "web-dl": "WEB-DL", "webdl": "WEB-DL",
+	"web-rip": "WEBRip", "webrip": "WEBRip", "web": "WEB", "hdtv": "HDTV",
+	"hdrip": "HDRip", "dvdrip": "DVDRip", "dvd": "DVD", "hdtc": "TC", "hdts": "TS",
+	"cam": "CAM",
+}
+
+// ParseRelease parses a torrent or file name such as
+// "The.Matrix.1999.1080p.BluRay.x264-GROUP.mkv" without any network calls.
+// The title is everything before the first year, episode or quality marker.
+func ParseRelease(name string) Release {
+	name = strings.TrimSpace(path.Base(strings.ReplaceAll(name, "\\", "/")))
+	if releaseExtensions[strings.ToLower(path.Ext(name))] {
+		name = strings.TrimSuffix(name, path.Ext(name))
+	}
+
+	var release Release
+	if match := leadingGroupPattern.FindStringSubmatch(name); match != nil {
+		release.Group = strings.TrimSpace(match[1])
+		name = name[len(match[0]):]
+	}
+
+	// end marks where the title stops: the first marker found in the name
+	end := len(name)
+	// tagsEnd is where the last quality tag stops, a scene group can only follow it
+	tagsEnd := 0
+	mark := func(pattern *regexp.Regexp) string {
+		loc := pattern.FindStringSubmatchIndex(name)
+		if loc == nil {
+			return ""
+		}
+		if loc[2] < end {
+			end = loc[2]
+		}
+		if loc[3] > tagsEnd {
+			tagsEnd = loc[3]
+		}
+		return name[loc[2]:loc[3]]
+	}
+
+	release.Resolution = strings.ToLower(mark(resolutionPattern))
+	if release.Resolution == "4k" || release.Resolution == "uhd" {
+		release.Resolution = "2160p"
+	}
+	if source := mark(sourcePattern); source != "" {
+		release.Source = sourceNames[strings.ToLower(source)]
+	}
+	release.Codec = normalizeCodec(mark(codecPattern))
+	for _, pattern := range episodePatterns {
+		if loc := pattern.FindStringSubmatchIndex(name); loc != nil {
+			release.Season, _ = strconv.Atoi(name[loc[2]:loc[3]])
+			release.Episode, _ = strconv.Atoi(name[loc[4]:loc[5]])
+			// the captures start at the season number, the marker at the whole match
+			if loc[0] < end {
+				end = loc[0]
+			}
+			break
+		}
+	}
+	if release.Episode == 0 {
+		if loc := seasonPattern.FindStringSubmatchIndex(name); loc != nil {
+			release.Season, _ = strconv.Atoi(name[loc[2]:loc[3]])
+			if loc[0] < end {
+				end = loc[0]
+			}
+		}
+	}
+
+	// A year at the very start is part of the title (2001 A Space Odyssey).
+	// Of the other years, the last one before the quality tags is the release
+	// year, so a year in the title (Blade Runner 2049 (2017)) is kept.
+	yearStart := -1
+	for _, loc := range yearPattern.FindAllStringIndex(name, -1) {
+		if loc[0] == 0 || isDigit(name[loc[0]-1]) || loc[1] < len(name) && isDigit(name[loc[1]]) {
+			continue
+		}
+		if yearStart >= 0 && loc[0] > end {
+			break
+		}
+		yearStart = loc[0]
+		release.Year, _ = strconv.Atoi(name[loc[0]:loc[1]])
+	}
+	if yearStart >= 0 && yearStart < end {
+		end = yearStart
+	}
+
+	// Scene groups follow the last dash, after the quality tags
+	if release.Group == "" && tagsEnd > 0 {
+		loc := trailingGroupPattern.FindStringSubmatchIndex(name)
+		if loc != nil && loc[0] >= tagsEnd {
+			release.Group = name[loc[2]:loc[3]]
+		}
+	}
+
+	release.Title = cleanTitle(name[:end])
+	release.Confidence = releaseConfidence(release, end < len(name))
+	return release
+}
+
+// IdentifyTitle finds the title and year of a release name. The local parser
+// is tried first and the LLM is only asked when the parse has low confidence
+// and a recognizer is given. If the LLM fails, a non-empty parsed title is
+// still returned.
+func IdentifyTitle(name string, recognizer TitleRecognizer) (TitleMatch, error) {
+	release := ParseRelease(name)
+	match := TitleMatch{Title: release.Title, Year: release.Year, Method: MethodParser, Release: release}
+	if release.Confidence >= minParserConfidence {
+		return match, nil
+	}
+	if recognizer == nil {
+		if release.Title == "" {
+			return TitleMatch{}, fmt.Errorf("no title found in '%s'", name)
+		}
+		return match, nil
+	}
+
+	result, err := recognizer.RecognizeTitle(context.Background(), name)
+	if err == nil && result.FileName != "" {
+		match.Title, match.Method = result.FileName, MethodLLM
+		if result.Year > 0 {
+			match.Year = result.Year
+		}
+		return match, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("no title found in '%s'", name)
+	}
+	if release.Title != "" {
+		log.Printf("Warning: AI title search failed, using the parsed title %q: %v", release.Title, err)
+		return match, nil
+	}
+	return TitleMatch{}, err
+}
+
+// cleanTitle removes bracketed notes and separators from a raw title
+func cleanTitle(title string) string {
+	title = bracketPattern.ReplaceAllString(title, " ")
+	title = separatorPattern.ReplaceAllString(title, " ")
+	return strings.Trim(title, " -–—:：,，[]【】()（）")
+}
+
+// releaseConfidence scores how trustworthy the parsed title is
+func releaseConfidence(release Release, delimited bool) float64 {
+	length := utf8.RuneCountInString(release.Title)
+	if length < 2 || length > 100 {
+		return 0
+	}
+
+	// scored in percent so that the result is an exact decimal
+	score := 50
+	if release.Year > 0 {
+		score += 30
+	}
+	if delimited && (release.Resolution != "" || release.Source != "" || release.Codec != "" || release.Episode > 0) {
+		score += 20
+	}
+	// Latin letters glued to CJK characters are usually an obfuscated title
+	// such as "s子w：m法s传q" that only a search can resolve
+	if mixesScripts(release.Title) {
+		score -= 50
+	}
+	if score < 0 {
+		score = 0
+	}
+	return float64(score) / 100
+}
+
+// mixesScripts reports whether an ASCII letter sits directly next to a CJK character
+func mixesScripts(title string) bool {
+	var previous rune
+	for _, r := range title {
+		if previous != 0 && (isCJK(previous) && isASCIILetter(r) || isASCIILetter(previous) && isCJK(r)) {
+			return true
+		}
+		previous = r
+	}
+	return false
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isASCIILetter(r rune) bool {
+	return r < utf8.RuneSelf && unicode.IsLetter(r)
+}
+
+// normalizeCodec maps codec tags to a canonical spelling, empty for unknown tags
+func normalizeCodec(codec string) string {
+	switch strings.ToLower(strings.ReplaceAll(codec, ".", "")) {
+	case "x264", "h264", "avc":
+		return "H.264"
+	case "x265", "h265", "hevc":
+		return "H.265"
+	case "xvid":
+		return "XviD"
+	case "divx":
+		return "DivX"
+	case "av1":
+		return "AV1"
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package search
+
+import "testing"
+
+func TestParseRelease(t *testing.T) {
+	tests := []struct {
+		name string
+		want Release
+	}{
+		{
+			"The.Matrix.1999.1080p.BluRay.x264-GROUP.mkv",
+			Release{Title: "The Matrix", Year: 1999, Resolution: "1080p", Source: "BluRay", Codec: "H.264", Group: "GROUP", Confidence: 1},
+		},
+		{
+			"蜡笔小新：我们的恐龙日记[国日多音轨+中文字幕].2024.1080p.HamiVideo.WEB-DL.AAC2.0.H.264-DreamHD",
+			Release{Title: "蜡笔小新：我们的恐龙日记", Year: 2024, Resolution: "1080p", Source: "WEB-DL", Codec: "H.264", Group: "DreamHD", Confidence: 1},
+		},
+		{
+			"2001.A.Space.Odyssey.1968.2160p.UHD.BluRay.x265",
+			Release{Title: "2001 A Space Odyssey", Year: 1968, Resolution: "2160p", Source: "BluRay", Codec: "H.265", Confidence: 1},
+		},
+		{
+			"Show.Name.S02E05.720p.HDTV.x264-LOL",
+			Release{Title: "Show Name", Season: 2, Episode: 5, Resolution: "720p", Source: "HDTV", Codec: "H.264", Group: "LOL", Confidence: 0.7},
+		},
+		{
+			"[SubsPlease] Some Anime - 1x03 (1080p) [ABCD1234].mkv",
+			Release{Title: "Some Anime", Season: 1, Episode: 3, Resolution: "1080p", Group: "SubsPlease", Confidence: 0.7},
+		},
+		{
+			"Blade Runner 2049 (2017) 2160p",
+			Release{Title: "Blade Runner 2049", Year: 2017, Resolution: "2160p", Confidence: 1},
+		},
+		{
+			"The.Office.US.S01.1080p.WEB-DL",
+			Release{Title: "The Office US", Season: 1, Resolution: "1080p", Source: "WEB-DL", Confidence: 0.7},
+		},
+		{
+			"Just A Title",
+			Release{Title: "Just A Title", Confidence: 0.5},
+		},
+		{
+			"s子w：m法s传q.2024.HD1080p.中文字幕.mp4",
+			Release{Title: "s子w：m法s传q", Year: 2024, Confidence: 0.3},
+		},
+	}
+
+	for _, tt := range tests {
+		got := ParseRelease(tt.name)
+		if got != tt.want {
+			t.Errorf("ParseRelease(%q)\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -13,8 +13,6 @@ import (
 	"strings"
 	"time"
 
-	openai "github.com/sashabaranov/go-openai"
-	jsonschema "github.com/sashabaranov/go-openai/jsonschema"
 	"github.com/torrentplayer/backend/backend"
 	"github.com/torrentplayer/backend/coze"
 )
@@ -37,6 +35,27 @@ type MovieInfo struct {
 	Popularity    float64  `json:"popularity,omitempty"`
 	Status        string   `json:"status,omitempty"`
 	Tagline       string   `json:"tagline,omitempty"`
+	// MatchedBy tells whether the local parser or the LLM identified the title
+	MatchedBy string   `json:"matchedBy,omitempty"`
+	Release   *Release `json:"release,omitempty"`
+	// IMDb ID from TMDB, the ratings are filled in from OMDb when it is configured
+	ImdbID         string  `json:"imdbId,omitempty"`
+	ImdbRating     float64 `json:"imdbRating,omitempty"`
+	ImdbVotes      int     `json:"imdbVotes,omitempty"`
+	RottenTomatoes int     `json:"rottenTomatoes,omitempty"`
+	ContentRating  string  `json:"contentRating,omitempty"`
+	// Collection is the franchise the movie belongs to, e.g. The Lord of the Rings
+	Collection *Collection `json:"collection,omitempty"`
+	// TrailerURL is a YouTube link to the movie's trailer
+	TrailerURL string `json:"trailerUrl,omitempty"`
+}
+
+// Collection is a TMDB collection, a series of movies such as a franchise
+type Collection struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	PosterURL   string `json:"posterUrl,omitempty"`
+	BackdropURL string `json:"backdropUrl,omitempty"`
 }
 
 // JinaResponse represents the response structure from the Jina API
@@ -92,10 +111,30 @@ type TMDBMovieDetails struct {
 	Adult         bool    `json:"adult"`
 	Status        string  `json:"status"`
 	Tagline       string  `json:"tagline"`
+	ImdbID        string  `json:"imdb_id"`
 	Genres        []struct {
 		ID   int    `json:"id"`
 		Name string `json:"name"`
 	} `json:"genres"`
+	BelongsToCollection *struct {
+		ID           int    `json:"id"`
+		Name         string `json:"name"`
+		PosterPath   string `json:"poster_path"`
+		BackdropPath string `json:"backdrop_path"`
+	} `json:"belongs_to_collection"`
+	Videos struct {
+		Results []TMDBVideo `json:"results"`
+	} `json:"videos"`
+}
+
+// TMDBVideo is a trailer, teaser or other video of a movie on TMDB
+type TMDBVideo struct {
+	Key         string `json:"key"`
+	Site        string `json:"site"`
+	Type        string `json:"type"`
+	Official    bool   `json:"official"`
+	Language    string `json:"iso_639_1"`
+	PublishedAt string `json:"published_at"`
 }
 
 type SearchFileResponse struct {
@@ -104,6 +143,13 @@ type SearchFileResponse struct {
 }
 
 func StructSearchFileViaCoze(magnet_filename string) (SearchFileResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Second)
+	defer cancel()
+	return structSearchFileViaCoze(ctx, magnet_filename)
+}
+
+// structSearchFileViaCoze asks the Coze bot and polls for its answer until ctx is done
+func structSearchFileViaCoze(ctx context.Context, magnet_filename string) (SearchFileResponse, error) {
 	var cozeClient = coze.NewCozeClient(coze.RegionCOM)
 
 	apiResp, err := cozeClient.RequestBot(magnet_filename)
@@ -112,11 +158,10 @@ func StructSearchFileViaCoze(magnet_filename string) (SearchFileResponse, error)
 	}
 	log.Println("apiResp:", apiResp)
 
-	timeout := time.After(50 * time.Second)
 	for {
 		select {
-		case <-timeout:
-			return SearchFileResponse{}, fmt.Errorf("timeout waiting for response")
+		case <-ctx.Done():
+			return SearchFileResponse{}, fmt.Errorf("timeout waiting for response: %w", ctx.Err())
 		default:
 			apiResp, err = cozeClient.GetResponse(apiResp.Data.ConversationID, apiResp.Data.ID)
 			if err != nil {
@@ -149,73 +194,42 @@ func StructSearchFileViaCoze(magnet_filename string) (SearchFileResponse, error)
 	}
 }
 
+// StructSearchFile asks Jina deepsearch with the JINA_API_KEY environment variable
 func StructSearchFile(magnet_filename string) (SearchFileResponse, error) {
-
-	config := openai.DefaultConfig(backend.GetEnv("JINA_API_KEY"))
-	config.BaseURL = "https://deepsearch.jina.ai/v1"
-	client := openai.NewClientWithConfig(config)
-
-	schema, _ := jsonschema.GenerateSchemaForType(SearchFileResponse{})
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: "jina-deepsearch-v1",
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: "你现在要帮用户根据一个magnet 文件名获取这个magnet 中的电影名称，以及电影上映的年份，并且最后只返回json格式的数据，例如用户输入的是\"s子w：m法s传q.2024.HD1080p.中文字幕.mp4\"，那么你就要在网上搜索用户要处理的信息并加上\"电影\" 关键字，并根据互联网信息然后推断出这部电影的名字是\"狮子王: 木法沙传奇\",然后你回答的就只能是一个json格式的字符串数据\"{\"filename\":\"狮子王: 木法沙传奇\",\"year\":2024}\"\", 不要带任何\"根据提供的文件...\" 等等这种额外信息。",
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: magnet_filename,
-				},
-			},
-			ResponseFormat: &openai.ChatCompletionResponseFormat{
-				Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
-				JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
-					Name:        "SearchFileResponse",
-					Description: "你现在要帮用户根据一个magnet 文件名获取这个magnet 中的电影名称，以及电影上映的年份，并且最后只返回json格式的数据，例如用户输入的是\"s子w：m法s传q.2024.HD1080p.中文字幕.mp4\", 然后你回答的就只能是一个json格式的字符串数据\"{\"filename\":\"狮子王: 木法沙传奇\",\"year\":2024}\"",
-					Strict:      true,
-					Schema:      schema,
-				},
-			},
-		},
-	)
-
+	recognizer, err := NewTitleRecognizer(LLMConfig{
+		Provider: ProviderJina,
+		APIKey:   backend.GetEnv("JINA_API_KEY"),
+	})
 	if err != nil {
-		fmt.Printf("ChatCompletion error: %v\n", err)
-		return SearchFileResponse{}, errors.New("error making API request: " + err.Error())
+		return SearchFileResponse{}, err
 	}
 
-	fmt.Println(resp.Choices[0].Message.Content)
-	// Extract the content which should be a JSON string
-	content := resp.Choices[0].Message.Content
-
-	// Find the closing curly brace and trim everything after it
-	if idx := strings.LastIndex(content, "}"); idx >= 0 {
-		content = content[:idx+1]
-	}
-	fmt.Println("content", content)
-	var result SearchFileResponse
-	if err := json.Unmarshal([]byte(content), &result); err != nil {
-		return SearchFileResponse{}, fmt.Errorf("error parsing content as SearchFileResponse: %w", err)
+	result, err := recognizer.RecognizeTitle(context.Background(), magnet_filename)
+	if err != nil {
+		return SearchFileResponse{}, errors.New("error making API request: " + err.Error())
 	}
-
 	return result, nil
 }
 
+// SearchMovie identifies the title with the Coze bot as the AI fallback and looks it up on TMDB
 func SearchMovie(magnet_filename string) (MovieInfo, error) {
+	recognizer, _ := NewTitleRecognizer(LLMConfig{Provider: ProviderCoze, Timeout: 50 * time.Second})
+	return SearchMovieUsing(magnet_filename, recognizer)
+}
+
+// SearchMovieUsing is SearchMovie with the given AI fallback, nil to only use the local parser
+func SearchMovieUsing(magnet_filename string, recognizer TitleRecognizer) (MovieInfo, error) {
 	if magnet_filename == "" {
 		return MovieInfo{}, fmt.Errorf("missing magnet_filename parameter")
 	}
 
-	movieInfo, err := StructSearchFileViaCoze(magnet_filename)
+	title, err := IdentifyTitle(magnet_filename, recognizer)
 	if err != nil {
 		return MovieInfo{}, fmt.Errorf("error struct searching file: %w", err)
 	}
 
 	// Try to get complete movie details from TMDB
-	updatedMovieInfo, err := GetMovieDetails(movieInfo.FileName, movieInfo.Year)
+	updatedMovieInfo, err := GetMovieDetails(title.Title, title.Year)
 	if err != nil {
 		// Just log the error and continue with basic info
 		fmt.Printf("Warning: couldn't get movie details: %v\n", err)
@@ -223,7 +237,9 @@ func SearchMovie(magnet_filename string) (MovieInfo, error) {
 	}
 
 	// Copy over the original filename to preserve it
-	updatedMovieInfo.Filename = movieInfo.FileName
+	updatedMovieInfo.Filename = title.Title
+	updatedMovieInfo.MatchedBy = title.Method
+	updatedMovieInfo.Release = &title.Release
 
 	// Return the complete movie info
 	return updatedMovieInfo, nil
@@ -246,7 +262,10 @@ func GetMovieDetails(movieName string, year int) (MovieInfo, error) {
 		return MovieInfo{}, fmt.Errorf("TMDB_API_KEY environment variable not set")
 	}
 
-	url := "https://api.themoviedb.org/3/search/movie?query=%s&include_adult=true&page=1"
+	url := tmdbAPIBaseURL + "/search/movie?query=%s&include_adult=true&page=1"
+	if year > 0 {
+		url += "&year=" + strconv.Itoa(year)
+	}
 
 	req, _ := http.NewRequest("GET", fmt.Sprintf(url, urlPkg.QueryEscape(movieName)), nil)
 
@@ -270,52 +289,51 @@ func GetMovieDetails(movieName string, year int) (MovieInfo, error) {
 		return MovieInfo{}, fmt.Errorf("no movies found matching '%s'", movieName)
 	}
 
-	// Get the first result's ID
-	movieID := searchResp.Results[0].ID
-
-	detailUrl := "https://api.themoviedb.org/3/movie/%d?language=zh-CN"
-
-	detailReq, _ := http.NewRequest("GET", fmt.Sprintf(detailUrl, movieID), nil)
-
-	detailReq.Header.Add("accept", "application/json")
-	detailReq.Header.Add("Authorization", "Bearer "+tmdbAPIKey)
-
-	detailRes, err := http.DefaultClient.Do(detailReq)
+	// Get the first result's details
+	movieInfo, err := GetMovieDetailsByID(searchResp.Results[0].ID)
 	if err != nil {
 		return MovieInfo{}, err
 	}
+	movieInfo.Filename = movieName
+	return movieInfo, nil
+}
 
-	defer detailRes.Body.Close()
-	detailBody, _ := io.ReadAll(detailRes.Body)
+// GetMovieDetailsByID fetches complete movie information for a TMDB movie ID
+func GetMovieDetailsByID(movieID int) (MovieInfo, error) {
+	query := urlPkg.Values{}
+	lang := Language()
+	query.Set("language", lang)
+	// videos are filtered by the language, most movies only have English trailers
+	query.Set("append_to_response", "videos")
+	query.Set("include_video_language", videoLanguage(lang)+",en,null")
 
-	// Read and parse the details response
 	var details TMDBMovieDetails
-	json.Unmarshal(detailBody, &details)
-
-	// Extract the release year from release date
-	releaseYear := 0
-	if details.ReleaseDate != "" {
-		parts := strings.Split(details.ReleaseDate, "-")
-		if len(parts) > 0 {
-			releaseYear, _ = strconv.Atoi(parts[0])
-		}
+	if err := tmdbGet(fmt.Sprintf("/movie/%d", movieID), query, &details); err != nil {
+		return MovieInfo{}, err
 	}
 
-	// Base URL for poster and backdrop images
-	imageBaseURL := "https://image.tmdb.org/t/p/original"
-
 	// Prepare genres array
 	genres := make([]string, 0, len(details.Genres))
 	for _, genre := range details.Genres {
 		genres = append(genres, genre.Name)
 	}
 
+	var collection *Collection
+	if details.BelongsToCollection != nil && details.BelongsToCollection.ID > 0 {
+		collection = &Collection{
+			ID:          details.BelongsToCollection.ID,
+			Name:        details.BelongsToCollection.Name,
+			PosterURL:   imageURL(details.BelongsToCollection.PosterPath),
+			BackdropURL: imageURL(details.BelongsToCollection.BackdropPath),
+		}
+	}
+
 	// Create and populate the MovieInfo struct
-	movieInfo := MovieInfo{
-		Filename:      movieName,
-		Year:          releaseYear,
-		PosterURL:     imageBaseURL + details.PosterPath,
-		BackdropURL:   imageBaseURL + details.BackdropPath,
+	return MovieInfo{
+		Filename:      details.Title,
+		Year:          yearOf(details.ReleaseDate),
+		PosterURL:     imageURL(details.PosterPath),
+		BackdropURL:   imageURL(details.BackdropPath),
 		Overview:      details.Overview,
 		Rating:        details.VoteAverage,
 		VoteCount:     details.VoteCount,
@@ -328,7 +346,53 @@ func GetMovieDetails(movieName string, year int) (MovieInfo, error) {
 		Popularity:    details.Popularity,
 		Status:        details.Status,
 		Tagline:       details.Tagline,
+		ImdbID:        details.ImdbID,
+		Collection:    collection,
+		TrailerURL:    TrailerURL(details.Videos.Results),
+	}, nil
+}
+
+// videoLanguage is the ISO 639-1 part of a TMDB language such as "zh-CN"
+func videoLanguage(lang string) string {
+	code, _, _ := strings.Cut(lang, "-")
+	return code
+}
+
+// TrailerURL picks the best trailer from the videos of a movie and returns
+// its YouTube URL, or "" when there is none. Trailers come before teasers,
+// then official videos, ones in the metadata language and newer ones are preferred.
+func TrailerURL(videos []TMDBVideo) string {
+	preferred := videoLanguage(Language())
+	rank := func(video TMDBVideo) int {
+		score := 0
+		switch video.Type {
+		case "Trailer":
+			score += 8
+		case "Teaser":
+			score += 4
+		}
+		if video.Official {
+			score += 2
+		}
+		if video.Language == preferred {
+			score++
+		}
+		return score
 	}
 
-	return movieInfo, nil
+	var best *TMDBVideo
+	for i := range videos {
+		video := &videos[i]
+		if video.Site != "YouTube" || video.Key == "" || (video.Type != "Trailer" && video.Type != "Teaser") {
+			continue
+		}
+		if best == nil || rank(*video) > rank(*best) ||
+			(rank(*video) == rank(*best) && video.PublishedAt > best.PublishedAt) {
+			best = video
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return "https://www.youtube.com/watch?v=" + urlPkg.QueryEscape(best.Key)
 }
@@ -21,3 +21,23 @@ func TestGetMovieDetail(t *testing.T) {
 	movieDetail, _ := GetMovieDetails("蜡笔小新：我们的恐龙日记", 2024)
 	log.Println(movieDetail)
 }
+
+func TestTrailerURL(t *testing.T) {
+	videos := []TMDBVideo{
+		{Key: "clip", Site: "YouTube", Type: "Clip", Official: true},
+		{Key: "teaser", Site: "YouTube", Type: "Teaser", Official: true, Language: "zh"},
+		{Key: "vimeo", Site: "Vimeo", Type: "Trailer", Official: true},
+		{Key: "old", Site: "YouTube", Type: "Trailer", Official: true, Language: "en", PublishedAt: "2020-01-01T00:00:00.000Z"},
+		{Key: "new", Site: "YouTube", Type: "Trailer", Official: true, Language: "en", PublishedAt: "2021-01-01T00:00:00.000Z"},
+		{Key: "fan", Site: "YouTube", Type: "Trailer", Language: "zh"},
+	}
+	if got := TrailerURL(videos); got != "https://www.youtube.com/watch?v=new" {
+		t.Errorf("TrailerURL() = %q", got)
+	}
+	if got := TrailerURL(videos[:3]); got != "https://www.youtube.com/watch?v=teaser" {
+		t.Errorf("TrailerURL() without trailers = %q", got)
+	}
+	if got := TrailerURL(nil); got != "" {
+		t.Errorf("TrailerURL(nil) = %q", got)
+	}
+}
@@ -0,0 +1,264 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	urlPkg "net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/torrentplayer/backend/backend"
+)
+
+// tmdbAPIBaseURL is the TMDB v3 API root
+var tmdbAPIBaseURL = "https://api.themoviedb.org/3"
+
+// DefaultLanguage is the TMDB metadata language used until SetLanguage is called
+const DefaultLanguage = "zh-CN"
+
+var (
+	languageMu sync.RWMutex
+	language   = DefaultLanguage
+)
+
+// SetLanguage changes the language of titles and overviews fetched from
+// TMDB, such as "en-US". Details already saved are not refetched.
+func SetLanguage(lang string) {
+	languageMu.Lock()
+	defer languageMu.Unlock()
+	language = lang
+}
+
+// Language returns the TMDB metadata language
+func Language() string {
+	languageMu.RLock()
+	defer languageMu.RUnlock()
+	return language
+}
+
+// tmdbImageBaseURL is the prefix for poster, backdrop and still paths
+const tmdbImageBaseURL = "https://image.tmdb.org/t/p/original"
+
+// ShowInfo represents a TV series returned to the frontend
+type ShowInfo struct {
+	Name             string   `json:"name"`
+	OriginalName     string   `json:"originalName,omitempty"`
+	Year             int      `json:"year,omitempty"`
+	FirstAirDate     string   `json:"firstAirDate,omitempty"`
+	PosterURL        string   `json:"posterUrl,omitempty"`
+	BackdropURL      string   `json:"backdropUrl,omitempty"`
+	Overview         string   `json:"overview,omitempty"`
+	Rating           float64  `json:"rating,omitempty"`
+	VoteCount        int      `json:"voteCount,omitempty"`
+	Genres           []string `json:"genres,omitempty"`
+	TMDBID           int      `json:"tmdbId,omitempty"`
+	Popularity       float64  `json:"popularity,omitempty"`
+	Status           string   `json:"status,omitempty"`
+	Tagline          string   `json:"tagline,omitempty"`
+	NumberOfSeasons  int      `json:"numberOfSeasons,omitempty"`
+	NumberOfEpisodes int      `json:"numberOfEpisodes,omitempty"`
+	// IMDb ID from TMDB, the ratings are filled in from OMDb when it is configured
+	ImdbID         string  `json:"imdbId,omitempty"`
+	ImdbRating     float64 `json:"imdbRating,omitempty"`
+	ImdbVotes      int     `json:"imdbVotes,omitempty"`
+	RottenTomatoes int     `json:"rottenTomatoes,omitempty"`
+	ContentRating  string  `json:"contentRating,omitempty"`
+}
+
+// EpisodeInfo represents one episode of a TV season
+type EpisodeInfo struct {
+	SeasonNumber  int     `json:"seasonNumber"`
+	EpisodeNumber int     `json:"episodeNumber"`
+	Name          string  `json:"name,omitempty"`
+	Overview      string  `json:"overview,omitempty"`
+	AirDate       string  `json:"airDate,omitempty"`
+	StillURL      string  `json:"stillUrl,omitempty"`
+	Rating        float64 `json:"rating,omitempty"`
+	Runtime       int     `json:"runtime,omitempty"`
+	TMDBID        int     `json:"tmdbId,omitempty"`
+}
+
+// TMDBTVSearchResponse represents the response structure from the TMDB TV search API
+type TMDBTVSearchResponse struct {
+	Page         int `json:"page"`
+	TotalResults int `json:"total_results"`
+	Results      []struct {
+		ID           int     `json:"id"`
+		Name         string  `json:"name"`
+		OriginalName string  `json:"original_name"`
+		FirstAirDate string  `json:"first_air_date"`
+		Popularity   float64 `json:"popularity"`
+	} `json:"results"`
+}
+
+// TMDBTVDetails represents the response structure from the TMDB TV details API
+type TMDBTVDetails struct {
+	ID               int     `json:"id"`
+	Name             string  `json:"name"`
+	OriginalName     string  `json:"original_name"`
+	Overview         string  `json:"overview"`
+	PosterPath       string  `json:"poster_path"`
+	BackdropPath     string  `json:"backdrop_path"`
+	FirstAirDate     string  `json:"first_air_date"`
+	VoteAverage      float64 `json:"vote_average"`
+	VoteCount        int     `json:"vote_count"`
+	Popularity       float64 `json:"popularity"`
+	Status           string  `json:"status"`
+	Tagline          string  `json:"tagline"`
+	NumberOfSeasons  int     `json:"number_of_seasons"`
+	NumberOfEpisodes int     `json:"number_of_episodes"`
+	Genres           []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"genres"`
+	ExternalIDs struct {
+		ImdbID string `json:"imdb_id"`
+	} `json:"external_ids"`
+}
+
+// TMDBSeasonDetails represents the response structure from the TMDB season details API
+type TMDBSeasonDetails struct {
+	ID           int `json:"id"`
+	SeasonNumber int `json:"season_number"`
+	Episodes     []struct {
+		ID            int     `json:"id"`
+		SeasonNumber  int     `json:"season_number"`
+		EpisodeNumber int     `json:"episode_number"`
+		Name          string  `json:"name"`
+		Overview      string  `json:"overview"`
+		AirDate       string  `json:"air_date"`
+		StillPath     string  `json:"still_path"`
+		VoteAverage   float64 `json:"vote_average"`
+		Runtime       int     `json:"runtime"`
+	} `json:"episodes"`
+}
+
+// SearchShow searches TMDB for a TV series and returns the details of the
+// best match. year filters on the first air date and is ignored when 0.
+func SearchShow(showName string, year int) (ShowInfo, error) {
+	query := urlPkg.Values{}
+	query.Set("query", showName)
+	query.Set("include_adult", "true")
+	query.Set("page", "1")
+	if year > 0 {
+		query.Set("first_air_date_year", strconv.Itoa(year))
+	}
+
+	var searchResp TMDBTVSearchResponse
+	if err := tmdbGet("/search/tv", query, &searchResp); err != nil {
+		return ShowInfo{}, err
+	}
+	if len(searchResp.Results) == 0 {
+		return ShowInfo{}, fmt.Errorf("no tv shows found matching '%s'", showName)
+	}
+
+	return GetShowDetails(searchResp.Results[0].ID)
+}
+
+// GetShowDetails fetches complete TV series information from TMDB API
+func GetShowDetails(tvID int) (ShowInfo, error) {
+	query := urlPkg.Values{}
+	query.Set("language", Language())
+	query.Set("append_to_response", "external_ids")
+
+	var details TMDBTVDetails
+	if err := tmdbGet(fmt.Sprintf("/tv/%d", tvID), query, &details); err != nil {
+		return ShowInfo{}, err
+	}
+
+	genres := make([]string, 0, len(details.Genres))
+	for _, genre := range details.Genres {
+		genres = append(genres, genre.Name)
+	}
+
+	return ShowInfo{
+		Name:             details.Name,
+		OriginalName:     details.OriginalName,
+		Year:             yearOf(details.FirstAirDate),
+		FirstAirDate:     details.FirstAirDate,
+		PosterURL:        imageURL(details.PosterPath),
+		BackdropURL:      imageURL(details.BackdropPath),
+		Overview:         details.Overview,
+		Rating:           details.VoteAverage,
+		VoteCount:        details.VoteCount,
+		Genres:           genres,
+		TMDBID:           details.ID,
+		Popularity:       details.Popularity,
+		Status:           details.Status,
+		Tagline:          details.Tagline,
+		NumberOfSeasons:  details.NumberOfSeasons,
+		NumberOfEpisodes: details.NumberOfEpisodes,
+		ImdbID:           details.ExternalIDs.ImdbID,
+	}, nil
+}
+
+// GetSeasonEpisodes fetches the episodes of one season of a TV series
+func GetSeasonEpisodes(tvID, season int) ([]EpisodeInfo, error) {
+	query := urlPkg.Values{}
+	query.Set("language", Language())
+
+	var details TMDBSeasonDetails
+	if err := tmdbGet(fmt.Sprintf("/tv/%d/season/%d", tvID, season), query, &details); err != nil {
+		return nil, err
+	}
+
+	episodes := make([]EpisodeInfo, 0, len(details.Episodes))
+	for _, episode := range details.Episodes {
+		episodes = append(episodes, EpisodeInfo{
+			SeasonNumber:  episode.SeasonNumber,
+			EpisodeNumber: episode.EpisodeNumber,
+			Name:          episode.Name,
+			Overview:      episode.Overview,
+			AirDate:       episode.AirDate,
+			StillURL:      imageURL(episode.StillPath),
+			Rating:        episode.VoteAverage,
+			Runtime:       episode.Runtime,
+			TMDBID:        episode.ID,
+		})
+	}
+	return episodes, nil
+}
+
+// tmdbGet performs an authenticated GET against the TMDB API and decodes the JSON body into out
+func tmdbGet(path string, query urlPkg.Values, out interface{}) error {
+	tmdbAPIKey := backend.GetEnv("TMDB_API_KEY")
+	if tmdbAPIKey == "" {
+		return fmt.Errorf("TMDB_API_KEY environment variable not set")
+	}
+
+	req, err := http.NewRequest("GET", tmdbAPIBaseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("accept", "application/json")
+	req.Header.Add("Authorization", "Bearer "+tmdbAPIKey)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("TMDB request %s failed: %s %s", path, res.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// imageURL turns a TMDB image path into a full URL, empty paths stay empty
+func imageURL(path string) string {
+	if path == "" {
+		return ""
+	}
+	return tmdbImageBaseURL + path
+}
+
+// yearOf extracts the year from a YYYY-MM-DD date
+func yearOf(date string) int {
+	year, _ := strconv.Atoi(strings.SplitN(date, "-", 2)[0])
+	return year
+}
@@ -2,20 +2,42 @@ package service
 
 import (
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/torrentplayer/backend/config"
+	"github.com/torrentplayer/backend/db"
 	"github.com/torrentplayer/backend/service/search"
+	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/validator"
 )
 
 // SearchService 搜索服务层
 type SearchService struct {
 	config *config.Config
+	// recognizer 本地解析置信度低时使用的AI识别服务，为 nil 时只使用本地解析
+	recognizer search.TitleRecognizer
 }
 
 // NewSearchService 创建搜索服务实例
 func NewSearchService(cfg *config.Config) *SearchService {
+	recognizer, err := search.NewTitleRecognizer(search.LLMConfig{
+		Provider:   cfg.API.LLMProvider,
+		BaseURL:    cfg.API.LLMBaseURL,
+		Model:      cfg.API.LLMModel,
+		APIKey:     cfg.API.LLMAPIKey,
+		APIVersion: cfg.API.LLMAPIVersion,
+		Timeout:    time.Duration(cfg.API.LLMTimeoutSec) * time.Second,
+		Retries:    cfg.API.LLMRetries,
+	})
+	if err != nil {
+		log.Printf("警告: AI识别服务配置无效，只使用本地解析: %v", err)
+	}
+
 	return &SearchService{
-		config: cfg,
+		config:     cfg,
+		recognizer: recognizer,
 	}
 }
 
@@ -26,10 +48,11 @@ func (s *SearchService) SearchMovie(filename string) (*search.MovieInfo, error)
 	}
 
 	// 调用搜索服务
-	movieInfo, err := search.SearchMovie(filename)
+	movieInfo, err := search.SearchMovieUsing(filename, s.recognizer)
 	if err != nil {
 		return nil, fmt.Errorf("搜索电影失败: %w", err)
 	}
+	s.enrichMovie(&movieInfo)
 
 	return &movieInfo, nil
 }
@@ -44,6 +67,7 @@ func (s *SearchService) GetMovieDetails(movieName string, year int) (*search.Mov
 	if err != nil {
 		return nil, fmt.Errorf("获取电影详情失败: %w", err)
 	}
+	s.enrichMovie(&movieInfo)
 
 	return &movieInfo, nil
 }
@@ -60,4 +84,324 @@ func (s *SearchService) GetMoviePoster(movieName string, year int) (string, erro
 	}
 
 	return posterURL, nil
-}
\ No newline at end of file
+}
+
+// IdentifyTitle 从种子或文件名称中识别出影片标题和年份，优先使用本地解析，置信度低时才调用AI
+func (s *SearchService) IdentifyTitle(filename string) (*search.TitleMatch, error) {
+	if filename == "" {
+		return nil, fmt.Errorf("文件名不能为空")
+	}
+
+	title, err := search.IdentifyTitle(filename, s.recognizer)
+	if err != nil {
+		return nil, fmt.Errorf("识别文件名失败: %w", err)
+	}
+
+	return &title, nil
+}
+
+// MatchMovie 查询TMDB电影详情，转换为种子记录中保存的详情
+func (s *SearchService) MatchMovie(movieName string, year int) (*db.MovieDetails, error) {
+	movieInfo, err := s.GetMovieDetails(movieName, year)
+	if err != nil {
+		return nil, err
+	}
+
+	return movieDetails(*movieInfo), nil
+}
+
+// MatchMovieByID 按TMDB ID查询电影详情，转换为种子记录中保存的详情
+func (s *SearchService) MatchMovieByID(tmdbID int) (*db.MovieDetails, error) {
+	movieInfo, err := search.GetMovieDetailsByID(tmdbID)
+	if err != nil {
+		return nil, fmt.Errorf("获取电影详情失败: %w", err)
+	}
+	s.enrichMovie(&movieInfo)
+
+	return movieDetails(movieInfo), nil
+}
+
+// SearchShow 搜索剧集信息
+func (s *SearchService) SearchShow(showName string, year int) (*search.ShowInfo, error) {
+	if showName == "" {
+		return nil, fmt.Errorf("剧集名称不能为空")
+	}
+
+	showInfo, err := search.SearchShow(showName, year)
+	if err != nil {
+		return nil, fmt.Errorf("搜索剧集失败: %w", err)
+	}
+	s.enrichShow(&showInfo)
+
+	return &showInfo, nil
+}
+
+// MatchShow 查找剧集并按文件名中的季集编号（如 S01E02）为视频文件匹配剧集信息
+// 每季只请求一次TMDB；某一季获取失败时仍记录季集编号，只是没有标题等详情
+func (s *SearchService) MatchShow(req ShowMatchRequest, files []torrent.FileInfo) (*ShowMatch, error) {
+	name := strings.TrimSpace(req.Name)
+	if req.Provider != "" && req.Provider != ProviderTMDB && req.Provider != ProviderAniList {
+		return nil, validator.ValidationError{Field: "provider", Message: "数据来源必须为 tmdb 或 anilist"}
+	}
+	if req.Provider == ProviderAniList || req.AnilistId > 0 {
+		return s.matchAnime(name, req, files)
+	}
+	if name == "" && req.TmdbId == 0 {
+		return nil, validator.ValidationError{Field: "name", Message: "剧集名称和tmdbId不能同时为空"}
+	}
+
+	var show search.ShowInfo
+	var err error
+	if req.TmdbId > 0 {
+		show, err = search.GetShowDetails(req.TmdbId)
+	} else {
+		show, err = search.SearchShow(name, req.Year)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取剧集详情失败: %w", err)
+	}
+	s.enrichShow(&show)
+
+	match := &ShowMatch{
+		Show:           showDetails(show),
+		Episodes:       []*db.Episode{},
+		UnmatchedFiles: []int{},
+	}
+	seasons := make(map[int]map[int]search.EpisodeInfo)
+	for _, file := range files {
+		if !file.IsVideo {
+			continue
+		}
+		season, number, ok := search.ParseEpisode(file.Path)
+		if !ok {
+			match.UnmatchedFiles = append(match.UnmatchedFiles, file.FileIndex)
+			continue
+		}
+
+		episodes, fetched := seasons[season]
+		if !fetched {
+			episodes = make(map[int]search.EpisodeInfo)
+			list, err := search.GetSeasonEpisodes(show.TMDBID, season)
+			if err != nil {
+				log.Printf("警告: 获取第%d季剧集信息失败: %v", season, err)
+			}
+			for _, episode := range list {
+				episodes[episode.EpisodeNumber] = episode
+			}
+			seasons[season] = episodes
+		}
+
+		info := episodes[number]
+		match.Episodes = append(match.Episodes, &db.Episode{
+			FileIndex: file.FileIndex,
+			Season:    season,
+			Episode:   number,
+			Title:     info.Name,
+			Overview:  info.Overview,
+			AirDate:   info.AirDate,
+			StillUrl:  info.StillURL,
+			Rating:    info.Rating,
+			Runtime:   info.Runtime,
+			TmdbId:    info.TMDBID,
+		})
+	}
+
+	return match, nil
+}
+
+// matchAnime 从AniList查找动画并为视频文件匹配季集
+// 文件名带有 S01E02 时直接使用；只有绝对集数（如 "- 27"）时，带有 S2 等季标记的按该季计数，否则沿续集关系换算到对应的季
+// 剧场版等非 TV 格式只保存详情，不匹配剧集
+func (s *SearchService) matchAnime(name string, req ShowMatchRequest, files []torrent.FileInfo) (*ShowMatch, error) {
+	if name == "" && req.AnilistId == 0 {
+		return nil, validator.ValidationError{Field: "name", Message: "动画名称和anilistId不能同时为空"}
+	}
+
+	var anime search.AnimeInfo
+	var err error
+	if req.AnilistId > 0 {
+		anime, err = search.GetAnime(req.AnilistId)
+	} else {
+		anime, err = search.SearchAnime(name, req.Year)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取动画详情失败: %w", err)
+	}
+
+	match := &ShowMatch{
+		Show:           animeDetails(anime),
+		Episodes:       []*db.Episode{},
+		UnmatchedFiles: []int{},
+	}
+	if !anime.IsSeries() {
+		match.Show.MediaType = ""
+		return match, nil
+	}
+
+	seasons, index, err := search.GetAnimeSeasons(anime)
+	if err != nil {
+		log.Printf("警告: 获取动画 %d 的续集信息失败，只按当前季匹配: %v", anime.AnilistID, err)
+		seasons, index = []search.AnimeSeason{{AnilistID: anime.AnilistID, Episodes: anime.Episodes}}, 0
+	}
+	match.Show.NumberOfSeasons = len(seasons)
+	match.Show.NumberOfEpisodes = 0
+	for _, season := range seasons {
+		match.Show.NumberOfEpisodes += season.Episodes
+	}
+
+	// 同一种子的编号方式一致：有集数超过匹配到的这一季时，全部按从第一季开始计数
+	for _, file := range files {
+		absolute, found := search.ParseAbsoluteEpisode(file.Path)
+		if found && file.IsVideo && seasons[index].Episodes > 0 && absolute > seasons[index].Episodes {
+			index = 0
+			break
+		}
+	}
+
+	for _, file := range files {
+		if !file.IsVideo {
+			continue
+		}
+		season, number, ok := search.ParseEpisode(file.Path)
+		if !ok {
+			if absolute, found := search.ParseAbsoluteEpisode(file.Path); found {
+				season, number, ok = search.ParseRelease(file.Path).Season, absolute, true
+				if season == 0 {
+					season, number = search.MapAbsoluteEpisode(seasons, index, absolute)
+				}
+			}
+		}
+		if !ok {
+			match.UnmatchedFiles = append(match.UnmatchedFiles, file.FileIndex)
+			continue
+		}
+		match.Episodes = append(match.Episodes, &db.Episode{
+			FileIndex: file.FileIndex,
+			Season:    season,
+			Episode:   number,
+		})
+	}
+
+	return match, nil
+}
+
+// animeDetails 将AniList动画信息转换为种子记录中保存的详情
+func animeDetails(anime search.AnimeInfo) *db.MovieDetails {
+	return &db.MovieDetails{
+		Filename:         anime.Title,
+		Year:             anime.Year,
+		PosterUrl:        anime.PosterURL,
+		BackdropUrl:      anime.BannerURL,
+		Overview:         anime.Description,
+		Rating:           anime.Score,
+		Genres:           anime.Genres,
+		ReleaseDate:      anime.StartDate,
+		OriginalTitle:    anime.NativeTitle,
+		Popularity:       float64(anime.Popularity),
+		Status:           anime.Status,
+		MediaType:        "tv",
+		NumberOfEpisodes: anime.Episodes,
+		Provider:         ProviderAniList,
+		AnilistId:        anime.AnilistID,
+	}
+}
+
+// movieDetails 将电影信息转换为种子记录中保存的详情
+func movieDetails(movieInfo search.MovieInfo) *db.MovieDetails {
+	details := &db.MovieDetails{
+		Filename:      movieInfo.Filename,
+		Year:          movieInfo.Year,
+		PosterUrl:     movieInfo.PosterURL,
+		BackdropUrl:   movieInfo.BackdropURL,
+		Overview:      movieInfo.Overview,
+		Rating:        movieInfo.Rating,
+		VoteCount:     movieInfo.VoteCount,
+		Genres:        movieInfo.Genres,
+		Runtime:       movieInfo.Runtime,
+		TmdbId:        movieInfo.TMDBID,
+		ReleaseDate:   movieInfo.ReleaseDate,
+		OriginalTitle: movieInfo.OriginalTitle,
+		Popularity:    movieInfo.Popularity,
+		Status:        movieInfo.Status,
+		Tagline:       movieInfo.Tagline,
+
+		ImdbId:         movieInfo.ImdbID,
+		ImdbRating:     movieInfo.ImdbRating,
+		ImdbVotes:      movieInfo.ImdbVotes,
+		RottenTomatoes: movieInfo.RottenTomatoes,
+		ContentRating:  movieInfo.ContentRating,
+
+		TrailerUrl: movieInfo.TrailerURL,
+	}
+	if movieInfo.Collection != nil {
+		details.Collection = &db.MovieCollection{
+			TmdbId:      movieInfo.Collection.ID,
+			Name:        movieInfo.Collection.Name,
+			PosterUrl:   movieInfo.Collection.PosterURL,
+			BackdropUrl: movieInfo.Collection.BackdropURL,
+		}
+	}
+	return details
+}
+
+// showDetails 将剧集信息转换为种子记录中保存的详情
+func showDetails(show search.ShowInfo) *db.MovieDetails {
+	return &db.MovieDetails{
+		Filename:         show.Name,
+		Year:             show.Year,
+		PosterUrl:        show.PosterURL,
+		BackdropUrl:      show.BackdropURL,
+		Overview:         show.Overview,
+		Rating:           show.Rating,
+		VoteCount:        show.VoteCount,
+		Genres:           show.Genres,
+		TmdbId:           show.TMDBID,
+		ReleaseDate:      show.FirstAirDate,
+		OriginalTitle:    show.OriginalName,
+		Popularity:       show.Popularity,
+		Status:           show.Status,
+		Tagline:          show.Tagline,
+		MediaType:        "tv",
+		NumberOfSeasons:  show.NumberOfSeasons,
+		NumberOfEpisodes: show.NumberOfEpisodes,
+
+		ImdbId:         show.ImdbID,
+		ImdbRating:     show.ImdbRating,
+		ImdbVotes:      show.ImdbVotes,
+		RottenTomatoes: show.RottenTomatoes,
+		ContentRating:  show.ContentRating,
+	}
+}
+
+// ratings 从OMDb查询IMDb评分等信息，未配置 OMDB_API_KEY 或查询失败时返回 false，不影响匹配
+func (s *SearchService) ratings(imdbID string) (search.Ratings, bool) {
+	if s.config.API.OMDbAPIKey == "" || imdbID == "" {
+		return search.Ratings{}, false
+	}
+	ratings, err := search.GetRatings(s.config.API.OMDbAPIKey, imdbID)
+	if err != nil {
+		log.Printf("警告: 获取 %s 的OMDb评分失败: %v", imdbID, err)
+		return search.Ratings{}, false
+	}
+	return ratings, true
+}
+
+// enrichMovie 用OMDb评分补充电影信息
+func (s *SearchService) enrichMovie(movieInfo *search.MovieInfo) {
+	if ratings, ok := s.ratings(movieInfo.ImdbID); ok {
+		movieInfo.ImdbRating = ratings.ImdbRating
+		movieInfo.ImdbVotes = ratings.ImdbVotes
+		movieInfo.RottenTomatoes = ratings.RottenTomatoes
+		movieInfo.ContentRating = ratings.ContentRating
+	}
+}
+
+// enrichShow 用OMDb评分补充剧集信息
+func (s *SearchService) enrichShow(show *search.ShowInfo) {
+	if ratings, ok := s.ratings(show.ImdbID); ok {
+		show.ImdbRating = ratings.ImdbRating
+		show.ImdbVotes = ratings.ImdbVotes
+		show.RottenTomatoes = ratings.RottenTomatoes
+		show.ContentRating = ratings.ContentRating
+	}
+}
@@ -0,0 +1,329 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/torrentplayer/backend/config"
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// seedingCheckInterval 统计上传量并检查做种限制的间隔
+const seedingCheckInterval = 30 * time.Second
+
+// 达到做种上限后的操作
+const (
+	SeedLimitPause  = "pause"
+	SeedLimitRemove = "remove"
+)
+
+// SeedingLimits 做种限制，RatioLimit 和 TimeLimitMinutes 为 0 表示不限制
+type SeedingLimits struct {
+	RatioLimit       float64 `json:"ratioLimit"`
+	TimeLimitMinutes int     `json:"timeLimitMinutes"`
+	Action           string  `json:"action"`
+}
+
+// SeedingOverride 单个种子的做种限制，为 nil 或空字符串的字段使用全局设置
+type SeedingOverride struct {
+	RatioLimit       *float64 `json:"ratioLimit"`
+	TimeLimitMinutes *int     `json:"timeLimitMinutes"`
+	Action           string   `json:"action"`
+}
+
+// SeedingStatus 种子的做种统计与限制
+type SeedingStatus struct {
+	InfoHash       string          `json:"infoHash"`
+	Uploaded       int64           `json:"uploaded"`
+	Ratio          float64         `json:"ratio"`
+	SeedingSeconds int64           `json:"seedingSeconds"`
+	Override       SeedingOverride `json:"override"`
+	Effective      SeedingLimits   `json:"effective"`
+}
+
+// seedingEntry 单个种子的累计上传统计
+type seedingEntry struct {
+	record db.SeedingRecord
+	// counted 本次进程中已计入 record.Uploaded 的上传量
+	counted int64
+	dirty   bool
+}
+
+// SeedingPolicy 记录每个种子的累计上传量与做种时长，达到分享率或时长上限后自动暂停或移除种子
+type SeedingPolicy struct {
+	torrentClient *torrent.Client
+	store         *db.SeedingStore
+	states        *StateMachine
+
+	mu        sync.Mutex
+	defaults  SeedingLimits
+	entries   map[string]*seedingEntry
+	lastCheck time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewSeedingPolicy 创建做种策略并加载已保存的上传统计
+func NewSeedingPolicy(client *torrent.Client, store *db.SeedingStore, states *StateMachine, cfg *config.Config) *SeedingPolicy {
+	p := &SeedingPolicy{
+		torrentClient: client,
+		store:         store,
+		states:        states,
+		defaults: SeedingLimits{
+			RatioLimit:       cfg.Torrent.SeedRatioLimit,
+			TimeLimitMinutes: cfg.Torrent.SeedTimeLimitMinutes,
+			Action:           cfg.Torrent.SeedLimitAction,
+		},
+		entries: make(map[string]*seedingEntry),
+		stop:    make(chan struct{}),
+	}
+
+	records, err := store.ListSeeding()
+	if err != nil {
+		log.Printf("警告: 加载做种统计失败: %v", err)
+	}
+	for _, record := range records {
+		p.entries[record.InfoHash] = &seedingEntry{record: *record}
+	}
+
+	return p
+}
+
+// Start 启动后台检查，达到上限的种子通过 torrents 暂停或移除
+func (p *SeedingPolicy) Start(torrents *TorrentService) {
+	p.lastCheck = time.Now()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(seedingCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.stop:
+				p.flush()
+				return
+			case <-ticker.C:
+				p.check(torrents)
+			}
+		}
+	}()
+}
+
+// Stop 停止后台检查并保存未写入的统计
+func (p *SeedingPolicy) Stop() {
+	close(p.stop)
+	p.wg.Wait()
+}
+
+// check 累计上传量和做种时长，并对达到上限的种子执行操作
+func (p *SeedingPolicy) check(torrents *TorrentService) {
+	now := time.Now()
+	elapsed := int64(now.Sub(p.lastCheck) / time.Second)
+	p.lastCheck = now
+
+	for infoHash, state := range p.states.Snapshot() {
+		activity, ok := p.torrentClient.Activity(infoHash)
+		if !ok {
+			continue
+		}
+
+		p.mu.Lock()
+		entry := p.entryLocked(infoHash)
+		p.countLocked(entry, activity)
+		if state == StateSeeding && elapsed > 0 {
+			entry.record.SeedingSeconds += elapsed
+			entry.dirty = true
+		}
+		record := entry.record
+		limits := p.effectiveLocked(entry)
+		p.mu.Unlock()
+
+		if state != StateSeeding {
+			continue
+		}
+
+		reason := limitReached(record.Uploaded, record.SeedingSeconds, activity.Length, limits)
+		if reason == "" {
+			continue
+		}
+
+		log.Printf("种子 %s %s，执行 %s", infoHash, reason, limits.Action)
+		var err error
+		if limits.Action == SeedLimitRemove {
+			err = torrents.removeTorrent(infoHash, reason, false)
+		} else {
+			err = torrents.pauseTorrent(infoHash, reason)
+		}
+		if err != nil {
+			log.Printf("警告: 执行做种限制失败 %s: %v", infoHash, err)
+		}
+	}
+
+	p.flush()
+}
+
+// countLocked 把本次进程中新增的上传量计入累计值，调用方需持有 p.mu
+func (p *SeedingPolicy) countLocked(entry *seedingEntry, activity torrent.Activity) {
+	// 种子被移除后重新添加时客户端的计数会归零
+	if activity.Uploaded < entry.counted {
+		entry.counted = 0
+	}
+	if delta := activity.Uploaded - entry.counted; delta > 0 {
+		entry.record.Uploaded += delta
+		entry.counted = activity.Uploaded
+		entry.dirty = true
+	}
+}
+
+// flush 保存有变化的统计
+func (p *SeedingPolicy) flush() {
+	p.mu.Lock()
+	var dirty []db.SeedingRecord
+	for _, entry := range p.entries {
+		if entry.dirty {
+			dirty = append(dirty, entry.record)
+			entry.dirty = false
+		}
+	}
+	p.mu.Unlock()
+
+	for _, record := range dirty {
+		if err := p.store.UpdateStats(record.InfoHash, record.Uploaded, record.SeedingSeconds); err != nil {
+			log.Printf("警告: %v", err)
+		}
+	}
+}
+
+// Apply 填充种子信息中的累计上传量和分享率
+func (p *SeedingPolicy) Apply(info *torrent.TorrentInfo) {
+	activity, ok := p.torrentClient.Activity(info.InfoHash)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry := p.entryLocked(info.InfoHash)
+	if ok {
+		p.countLocked(entry, activity)
+	}
+	info.Uploaded = entry.record.Uploaded
+	info.Ratio = ratio(entry.record.Uploaded, info.Length)
+}
+
+// Status 获取种子的做种统计与限制
+func (p *SeedingPolicy) Status(infoHash string, length int64) *SeedingStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry := p.entryLocked(infoHash)
+	if activity, ok := p.torrentClient.Activity(infoHash); ok {
+		p.countLocked(entry, activity)
+	}
+
+	return &SeedingStatus{
+		InfoHash:       infoHash,
+		Uploaded:       entry.record.Uploaded,
+		Ratio:          ratio(entry.record.Uploaded, length),
+		SeedingSeconds: entry.record.SeedingSeconds,
+		Override: SeedingOverride{
+			RatioLimit:       entry.record.RatioLimit,
+			TimeLimitMinutes: entry.record.TimeLimitMinutes,
+			Action:           entry.record.LimitAction,
+		},
+		Effective: p.effectiveLocked(entry),
+	}
+}
+
+// SetDefaults 修改全局做种限制，下次检查时对没有单独设置的种子生效，调用方需先校验
+func (p *SeedingPolicy) SetDefaults(limits SeedingLimits) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.defaults = limits
+}
+
+// SetOverride 设置单个种子的做种限制
+func (p *SeedingPolicy) SetOverride(infoHash string, override *SeedingOverride) error {
+	if override.RatioLimit != nil && *override.RatioLimit < 0 {
+		return validator.ValidationError{Field: "ratioLimit", Message: "不能为负数"}
+	}
+	if override.TimeLimitMinutes != nil && *override.TimeLimitMinutes < 0 {
+		return validator.ValidationError{Field: "timeLimitMinutes", Message: "不能为负数"}
+	}
+	switch override.Action {
+	case "", SeedLimitPause, SeedLimitRemove:
+	default:
+		return validator.ValidationError{Field: "action", Message: "必须为 pause 或 remove"}
+	}
+
+	p.mu.Lock()
+	entry := p.entryLocked(infoHash)
+	entry.record.RatioLimit = override.RatioLimit
+	entry.record.TimeLimitMinutes = override.TimeLimitMinutes
+	entry.record.LimitAction = override.Action
+	record := entry.record
+	p.mu.Unlock()
+
+	return p.store.SaveLimits(&record)
+}
+
+// Forget 删除种子的做种统计
+func (p *SeedingPolicy) Forget(infoHash string) {
+	p.mu.Lock()
+	delete(p.entries, infoHash)
+	p.mu.Unlock()
+
+	if err := p.store.DeleteSeeding(infoHash); err != nil {
+		log.Printf("警告: %v", err)
+	}
+}
+
+// entryLocked 获取或创建种子的统计，调用方需持有 p.mu
+func (p *SeedingPolicy) entryLocked(infoHash string) *seedingEntry {
+	entry, ok := p.entries[infoHash]
+	if !ok {
+		entry = &seedingEntry{record: db.SeedingRecord{InfoHash: infoHash}}
+		p.entries[infoHash] = entry
+	}
+	return entry
+}
+
+// effectiveLocked 合并单个种子的设置与全局设置，调用方需持有 p.mu
+func (p *SeedingPolicy) effectiveLocked(entry *seedingEntry) SeedingLimits {
+	limits := p.defaults
+	if entry.record.RatioLimit != nil {
+		limits.RatioLimit = *entry.record.RatioLimit
+	}
+	if entry.record.TimeLimitMinutes != nil {
+		limits.TimeLimitMinutes = *entry.record.TimeLimitMinutes
+	}
+	if entry.record.LimitAction != "" {
+		limits.Action = entry.record.LimitAction
+	}
+	return limits
+}
+
+// limitReached 返回达到的上限说明，未达到时返回空字符串
+func limitReached(uploaded, seedingSeconds, length int64, limits SeedingLimits) string {
+	if limits.RatioLimit > 0 && length > 0 && ratio(uploaded, length) >= limits.RatioLimit {
+		return fmt.Sprintf("达到分享率上限 %.2f", limits.RatioLimit)
+	}
+	if limits.TimeLimitMinutes > 0 && seedingSeconds >= int64(limits.TimeLimitMinutes)*60 {
+		return fmt.Sprintf("达到做种时长上限 %d 分钟", limits.TimeLimitMinutes)
+	}
+	return ""
+}
+
+// ratio 分享率：累计上传量与种子大小之比
+func ratio(uploaded, length int64) float64 {
+	if length <= 0 {
+		return 0
+	}
+	return float64(uploaded) / float64(length)
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"sync"
+
+	"github.com/torrentplayer/backend/config"
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/service/search"
+	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// metadataLanguagePattern TMDB 语言代码，如 zh-CN、en-US、ja
+var metadataLanguagePattern = regexp.MustCompile(`^[a-z]{2}(-[A-Z]{2})?$`)
+
+// Settings 可在运行时修改的设置，默认值来自环境变量，通过接口修改后保存到数据库并优先于环境变量
+type Settings struct {
+	Bandwidth   BandwidthSettings   `json:"bandwidth"`
+	Seeding     SeedingLimits       `json:"seeding"`
+	Metadata    MetadataSettings    `json:"metadata"`
+	Trackers    TrackerSettings     `json:"trackers"`
+	Transcoding TranscodingSettings `json:"transcoding"`
+	Transport   TransportSettings   `json:"transport"`
+	Peers       PeerSettings        `json:"peers"`
+	Organizer   OrganizerSettings   `json:"organizer"`
+	// RestartRequired 已保存但要重启服务才生效的分组，只读
+	RestartRequired []string `json:"restartRequired,omitempty"`
+}
+
+// BandwidthSettings 所有种子合计的速度上限（KiB/s），0 表示不限制
+type BandwidthSettings struct {
+	DownloadLimitKBps int `json:"downloadLimitKBps"`
+	UploadLimitKBps   int `json:"uploadLimitKBps"`
+}
+
+// MetadataSettings 元数据设置
+type MetadataSettings struct {
+	Language string `json:"language"` // TMDB 元数据语言，只影响之后识别的种子
+}
+
+// TrackerSettings tracker 设置
+type TrackerSettings struct {
+	// PublicTrackers 添加到公开磁力链接的 tracker，只影响之后添加的种子
+	PublicTrackers []string `json:"publicTrackers"`
+}
+
+// TranscodingSettings 服务器的转码限制，优先于用户的播放偏好
+type TranscodingSettings struct {
+	Enabled        bool `json:"enabled"`        // 关闭后忽略强制转码
+	MaxBitrateKbps int  `json:"maxBitrateKbps"` // 转码码率上限，0 表示不限制
+}
+
+// TransportSettings peer 连接的协议和加密策略，种子客户端只在启动时读取，修改后重启服务生效
+type TransportSettings struct {
+	DisableUTP bool `json:"disableUTP"`
+	DisableTCP bool `json:"disableTCP"`
+	// Encryption prefer 优先加密并接受明文连接，require 只连接加密的 peer，disable 只使用明文
+	Encryption string `json:"encryption"`
+}
+
+// Options 转换为种子客户端的选项
+func (t TransportSettings) Options() torrent.TransportOptions {
+	return torrent.TransportOptions{
+		DisableUTP: t.DisableUTP,
+		DisableTCP: t.DisableTCP,
+		Encryption: torrent.EncryptionPolicy(t.Encryption),
+	}
+}
+
+// PeerSettings 公开种子的连接数上限和 peer 来源。连接数上限立即应用到没有单独设置的种子，
+// 其余字段只在创建种子客户端时读取，修改后重启服务生效；私有种子始终不使用 DHT 和 PEX
+type PeerSettings struct {
+	MaxConnectionsPerTorrent int  `json:"maxConnectionsPerTorrent"`
+	MaxPeersPerTorrent       int  `json:"maxPeersPerTorrent"` // 每个种子保留的已知 peer 数
+	DHT                      bool `json:"dht"`
+	PEX                      bool `json:"pex"`
+	// WebTorrent 通过 WebRTC 连接浏览器中的 peer，绑定网卡（TORRENT_BIND_INTERFACE）时不生效
+	WebTorrent bool `json:"webtorrent"`
+}
+
+// Options 转换为种子客户端的选项
+func (p PeerSettings) Options() torrent.PeerOptions {
+	return torrent.PeerOptions{
+		MaxConnsPerTorrent: p.MaxConnectionsPerTorrent,
+		MaxPeersPerTorrent: p.MaxPeersPerTorrent,
+		DisableDHT:         !p.DHT,
+		DisablePEX:         !p.PEX,
+		DisableWebTorrent:  !p.WebTorrent,
+	}
+}
+
+// settingsKeys 每组设置在 settings 表中的键
+var settingsKeys = []string{"bandwidth", "seeding", "metadata", "trackers", "transcoding", "transport", "peers", "organizer"}
+
+// SettingsService 管理运行时设置：启动时加载已保存的设置，修改后立即应用到各个服务
+type SettingsService struct {
+	store         *db.SettingsStore
+	torrentClient *torrent.Client
+	seeding       *SeedingPolicy
+	trackers      *TrackerListUpdater
+	preferences   *PreferencesService
+	organizer     *Organizer
+
+	mu      sync.Mutex
+	current Settings
+}
+
+// LoadSettings 合并环境变量与已保存的设置，已保存的设置无效时使用环境变量中的设置。
+// 种子客户端的部分设置只在创建时读取，因此在创建客户端之前调用
+func LoadSettings(store *db.SettingsStore, cfg *config.Config) Settings {
+	defaults := Settings{
+		Bandwidth: BandwidthSettings{
+			DownloadLimitKBps: cfg.Torrent.DownloadLimitKBps,
+			UploadLimitKBps:   cfg.Torrent.UploadLimitKBps,
+		},
+		Seeding: SeedingLimits{
+			RatioLimit:       cfg.Torrent.SeedRatioLimit,
+			TimeLimitMinutes: cfg.Torrent.SeedTimeLimitMinutes,
+			Action:           cfg.Torrent.SeedLimitAction,
+		},
+		Metadata: MetadataSettings{Language: cfg.API.MetadataLanguage},
+		Trackers: TrackerSettings{PublicTrackers: append([]string{}, cfg.Torrent.PublicTrackers...)},
+		Transcoding: TranscodingSettings{
+			Enabled: true,
+		},
+		Transport: TransportSettings{
+			DisableUTP: cfg.Torrent.DisableUTP,
+			DisableTCP: cfg.Torrent.DisableTCP,
+			Encryption: cfg.Torrent.Encryption,
+		},
+		Peers: PeerSettings{
+			MaxConnectionsPerTorrent: cfg.Torrent.MaxConnections,
+			MaxPeersPerTorrent:       cfg.Torrent.MaxPeers,
+			DHT:                      cfg.Torrent.EnableDHT,
+			PEX:                      cfg.Torrent.EnablePEX,
+			WebTorrent:               cfg.Torrent.EnableWebTorrent,
+		},
+		Organizer: OrganizerSettings{
+			Enabled:         cfg.Organizer.Enabled,
+			LibraryDir:      cfg.Organizer.LibraryDir,
+			MovieTemplate:   cfg.Organizer.MovieTemplate,
+			EpisodeTemplate: cfg.Organizer.EpisodeTemplate,
+		},
+	}
+
+	settings, err := loadSettings(store, defaults)
+	if err != nil {
+		log.Printf("警告: 加载设置失败，使用环境变量中的设置: %v", err)
+		return defaults
+	}
+	return settings
+}
+
+// NewSettingsService 创建设置服务并立即应用 LoadSettings 读取的设置
+func NewSettingsService(store *db.SettingsStore, client *torrent.Client, seeding *SeedingPolicy,
+	trackers *TrackerListUpdater, preferences *PreferencesService, organizer *Organizer, settings Settings) *SettingsService {
+	s := &SettingsService{
+		store:         store,
+		torrentClient: client,
+		seeding:       seeding,
+		trackers:      trackers,
+		preferences:   preferences,
+		organizer:     organizer,
+		current:       cloneSettings(settings),
+	}
+	s.apply(s.current)
+	return s
+}
+
+// Get 获取当前设置
+func (s *SettingsService) Get() Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.withStatus(s.current)
+}
+
+// withStatus 复制设置并标出需要重启才生效的分组
+func (s *SettingsService) withStatus(settings Settings) Settings {
+	settings = cloneSettings(settings)
+	settings.RestartRequired = nil
+	if settings.Transport.Options() != s.torrentClient.Transport() {
+		settings.RestartRequired = append(settings.RestartRequired, "transport")
+	}
+	// 连接数上限立即生效，其余字段只在创建客户端时读取
+	if settings.Peers.Options() != s.torrentClient.Peers() {
+		settings.RestartRequired = append(settings.RestartRequired, "peers")
+	}
+	return settings
+}
+
+// Update 校验并保存设置后立即应用，只保存有变化的分组
+func (s *SettingsService) Update(settings Settings) (Settings, error) {
+	if err := validateSettings(settings); err != nil {
+		return Settings{}, err
+	}
+	if settings.Trackers.PublicTrackers == nil {
+		settings.Trackers.PublicTrackers = []string{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := make(map[string]string)
+	next, current := settingsSections(&settings), settingsSections(&s.current)
+	for _, key := range settingsKeys {
+		if reflect.DeepEqual(next[key], current[key]) {
+			continue
+		}
+		data, err := json.Marshal(next[key])
+		if err != nil {
+			return Settings{}, err
+		}
+		changed[key] = string(data)
+	}
+	if len(changed) > 0 {
+		if err := s.store.SaveSettings(changed); err != nil {
+			return Settings{}, err
+		}
+	}
+
+	settings.RestartRequired = nil
+	s.current = cloneSettings(settings)
+	s.apply(s.current)
+	return s.withStatus(s.current), nil
+}
+
+// loadSettings 在默认设置上覆盖已保存的设置
+func loadSettings(store *db.SettingsStore, defaults Settings) (Settings, error) {
+	stored, err := store.GetSettings()
+	if err != nil {
+		return defaults, err
+	}
+
+	settings := cloneSettings(defaults)
+	sections := settingsSections(&settings)
+	for _, key := range settingsKeys {
+		value, ok := stored[key]
+		if !ok {
+			continue
+		}
+		// 保存后新增的字段保留默认值
+		if err := json.Unmarshal([]byte(value), sections[key]); err != nil {
+			return defaults, fmt.Errorf("解析设置 %s 失败: %w", key, err)
+		}
+	}
+	if err := validateSettings(settings); err != nil {
+		return defaults, err
+	}
+	return settings, nil
+}
+
+// apply 把设置应用到各个服务，调用前需校验
+func (s *SettingsService) apply(settings Settings) {
+	s.torrentClient.SetRateLimits(int64(settings.Bandwidth.DownloadLimitKBps)*1024, int64(settings.Bandwidth.UploadLimitKBps)*1024)
+	s.seeding.SetDefaults(settings.Seeding)
+	if err := s.trackers.SetConfigured(settings.Trackers.PublicTrackers); err != nil {
+		log.Printf("警告: %v", err)
+	}
+	search.SetLanguage(settings.Metadata.Language)
+	s.preferences.SetTranscoding(settings.Transcoding)
+	s.torrentClient.SetMaxConnections(settings.Peers.MaxConnectionsPerTorrent)
+	s.organizer.SetSettings(settings.Organizer)
+}
+
+// validateSettings 校验所有设置，任一无效时不应用任何设置
+func validateSettings(settings Settings) error {
+	if settings.Bandwidth.DownloadLimitKBps < 0 {
+		return validator.ValidationError{Field: "bandwidth.downloadLimitKBps", Message: "不能为负数"}
+	}
+	if settings.Bandwidth.UploadLimitKBps < 0 {
+		return validator.ValidationError{Field: "bandwidth.uploadLimitKBps", Message: "不能为负数"}
+	}
+	if settings.Seeding.RatioLimit < 0 {
+		return validator.ValidationError{Field: "seeding.ratioLimit", Message: "不能为负数"}
+	}
+	if settings.Seeding.TimeLimitMinutes < 0 {
+		return validator.ValidationError{Field: "seeding.timeLimitMinutes", Message: "不能为负数"}
+	}
+	if settings.Seeding.Action != SeedLimitPause && settings.Seeding.Action != SeedLimitRemove {
+		return validator.ValidationError{Field: "seeding.action", Message: "必须为 pause 或 remove"}
+	}
+	if !metadataLanguagePattern.MatchString(settings.Metadata.Language) {
+		return validator.ValidationError{Field: "metadata.language", Message: "必须为语言代码，如 zh-CN 或 en-US"}
+	}
+	if len(settings.Trackers.PublicTrackers) > 0 {
+		if err := validateTrackerURLs(settings.Trackers.PublicTrackers); err != nil {
+			var validationErr validator.ValidationError
+			if errors.As(err, &validationErr) {
+				validationErr.Field = "trackers.publicTrackers"
+				return validationErr
+			}
+			return err
+		}
+	}
+	if settings.Transcoding.MaxBitrateKbps < 0 {
+		return validator.ValidationError{Field: "transcoding.maxBitrateKbps", Message: "不能为负数"}
+	}
+	if settings.Peers.MaxConnectionsPerTorrent <= 0 {
+		return validator.ValidationError{Field: "peers.maxConnectionsPerTorrent", Message: "必须大于0"}
+	}
+	if settings.Peers.MaxPeersPerTorrent <= 0 {
+		return validator.ValidationError{Field: "peers.maxPeersPerTorrent", Message: "必须大于0"}
+	}
+	if err := validateOrganizer(settings.Organizer); err != nil {
+		return err
+	}
+	return validateTransport(settings.Transport)
+}
+
+// validateTransport 校验连接设置
+func validateTransport(transport TransportSettings) error {
+	if transport.DisableUTP && transport.DisableTCP {
+		return validator.ValidationError{Field: "transport.disableTCP", Message: "不能同时禁用 uTP 和 TCP"}
+	}
+	if !torrent.EncryptionPolicy(transport.Encryption).Valid() {
+		return validator.ValidationError{Field: "transport.encryption", Message: "必须为 prefer、require 或 disable"}
+	}
+	return nil
+}
+
+// settingsSections 按 settings 表的键返回各组设置的指针
+func settingsSections(settings *Settings) map[string]interface{} {
+	return map[string]interface{}{
+		"bandwidth":   &settings.Bandwidth,
+		"seeding":     &settings.Seeding,
+		"metadata":    &settings.Metadata,
+		"trackers":    &settings.Trackers,
+		"transcoding": &settings.Transcoding,
+		"transport":   &settings.Transport,
+		"peers":       &settings.Peers,
+		"organizer":   &settings.Organizer,
+	}
+}
+
+// cloneSettings 复制设置，避免调用方修改 tracker 列表
+func cloneSettings(settings Settings) Settings {
+	settings.Trackers.PublicTrackers = append([]string{}, settings.Trackers.PublicTrackers...)
+	return settings
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// statsTier 统计历史的一级精度：记录保留 keep 后合并到下一级
+type statsTier struct {
+	resolution time.Duration
+	keep       time.Duration
+}
+
+// statsTiers 每分钟记录保留 25 小时，15 分钟精度保留 8 天，1 小时精度保留 90 天
+// 保留时间比对应精度可查询的最长范围多一些，查询范围内不会出现刚合并到下一级的记录
+var statsTiers = []statsTier{
+	{resolution: time.Minute, keep: 25 * time.Hour},
+	{resolution: 15 * time.Minute, keep: 8 * 24 * time.Hour},
+	{resolution: time.Hour, keep: 90 * 24 * time.Hour},
+}
+
+// statsSteps 按查询范围选择的数据点间隔，每个范围最多约 1500 个数据点
+var statsSteps = []struct {
+	maxRange time.Duration
+	step     time.Duration
+}{
+	{24 * time.Hour, time.Minute},
+	{7 * 24 * time.Hour, 15 * time.Minute},
+	{90 * 24 * time.Hour, time.Hour},
+}
+
+// StatsPoint 统计历史的一个数据点，速率为该时段内服务运行期间的平均值（字节/秒）
+type StatsPoint struct {
+	Time         time.Time `json:"time"`
+	DownloadRate float64   `json:"downloadRate"`
+	UploadRate   float64   `json:"uploadRate"`
+	Downloaded   int64     `json:"downloaded"`
+	Uploaded     int64     `json:"uploaded"`
+	Peers        float64   `json:"peers"` // 平均连接的 peer 数
+}
+
+// StatsHistory 统计历史查询结果
+type StatsHistory struct {
+	Range  string       `json:"range"`
+	Step   int          `json:"step"` // 数据点间隔（秒）
+	Points []StatsPoint `json:"points"`
+}
+
+// StatsHistoryService 每分钟记录总下载、上传速率和连接的 peer 数，并按时间降低精度保存
+type StatsHistoryService struct {
+	torrentClient *torrent.Client
+	store         *db.StatsStore
+
+	// last 上一次采样时客户端的累计传输量
+	last torrent.TransferTotals
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewStatsHistoryService 创建统计历史服务
+func NewStatsHistoryService(client *torrent.Client, store *db.StatsStore) *StatsHistoryService {
+	return &StatsHistoryService{
+		torrentClient: client,
+		store:         store,
+		stop:          make(chan struct{}),
+	}
+}
+
+// Start 启动后台采样，启动时先合并停机期间过期的记录
+func (s *StatsHistoryService) Start() {
+	s.last = s.torrentClient.TransferTotals()
+	if err := s.compact(time.Now()); err != nil {
+		log.Printf("警告: 合并统计历史失败: %v", err)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case now := <-ticker.C:
+				if err := s.record(now); err != nil {
+					log.Printf("警告: 记录统计历史失败: %v", err)
+				}
+				// 每小时合并一次旧记录
+				if now.Minute() == 0 {
+					if err := s.compact(now); err != nil {
+						log.Printf("警告: 合并统计历史失败: %v", err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止后台采样
+func (s *StatsHistoryService) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// record 记录上一分钟的传输量和当前连接的 peer 数
+func (s *StatsHistoryService) record(now time.Time) error {
+	totals := s.torrentClient.TransferTotals()
+	sample := db.StatsSample{
+		Resolution: time.Minute,
+		At:         now.Add(-time.Minute).Truncate(time.Minute),
+		Downloaded: max(totals.Downloaded-s.last.Downloaded, 0),
+		Uploaded:   max(totals.Uploaded-s.last.Uploaded, 0),
+		PeerSum:    int64(totals.ActivePeers),
+		Samples:    1,
+	}
+	s.last = totals
+	return s.store.AddSample(sample)
+}
+
+// compact 把超过保留时间的记录合并到下一级精度，删除最后一级中过期的记录
+func (s *StatsHistoryService) compact(now time.Time) error {
+	for i, tier := range statsTiers {
+		cutoff := now.Add(-tier.keep)
+		if i == len(statsTiers)-1 {
+			return s.store.DeleteBefore(tier.resolution, cutoff)
+		}
+		// 只合并完整的下一级时段，时段中剩余的记录下次再合并
+		next := statsTiers[i+1].resolution
+		if err := s.store.Rollup(tier.resolution, next, cutoff.Truncate(next)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// History 返回最近一段时间的统计历史，rangeText 为 30m、24h、7d 这样的时长，最长 90 天
+func (s *StatsHistoryService) History(rangeText string, now time.Time) (*StatsHistory, error) {
+	if rangeText == "" {
+		rangeText = "24h"
+	}
+	length, err := parseStatsRange(rangeText)
+	if err != nil {
+		return nil, err
+	}
+
+	step := statsSteps[len(statsSteps)-1].step
+	for _, candidate := range statsSteps {
+		if length <= candidate.maxRange {
+			step = candidate.step
+			break
+		}
+	}
+
+	samples, err := s.store.History(now.Add(-length).Truncate(step), step)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &StatsHistory{
+		Range:  rangeText,
+		Step:   int(step / time.Second),
+		Points: make([]StatsPoint, 0, len(samples)),
+	}
+	for _, sample := range samples {
+		point := StatsPoint{
+			Time:       sample.At,
+			Downloaded: sample.Downloaded,
+			Uploaded:   sample.Uploaded,
+		}
+		if sample.Samples > 0 {
+			seconds := float64(sample.Samples) * time.Minute.Seconds()
+			point.DownloadRate = float64(sample.Downloaded) / seconds
+			point.UploadRate = float64(sample.Uploaded) / seconds
+			point.Peers = float64(sample.PeerSum) / float64(sample.Samples)
+		}
+		history.Points = append(history.Points, point)
+	}
+	return history, nil
+}
+
+// parseStatsRange 解析查询范围，支持 Go 时长格式和以 d 结尾的天数
+func parseStatsRange(text string) (time.Duration, error) {
+	var length time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(text, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		length = time.Duration(n) * 24 * time.Hour
+	} else {
+		length, err = time.ParseDuration(text)
+	}
+
+	maxRange := statsSteps[len(statsSteps)-1].maxRange
+	if err != nil || length < time.Minute || length > maxRange {
+		return 0, validator.ValidationError{
+			Field:   "range",
+			Message: fmt.Sprintf("范围必须为 1m 到 %dd 之间的时长，如 24h 或 7d", int(maxRange.Hours()/24)),
+		}
+	}
+	return length, nil
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/validator"
+)
+
+// streamLogMergeWindow 同一客户端在会话结束后这段时间内再次打开同一文件时合并为一次播放
+// 播放器探测文件、拖动进度时会关闭会话再重新打开
+const streamLogMergeWindow = 30 * time.Second
+
+// streamLogKeep 播放记录的保留时间，与统计可查询的最长范围一致
+const streamLogKeep = 90 * 24 * time.Hour
+
+// 按影片统计返回的影片数
+const (
+	defaultAnalyticsTitles = 20
+	maxAnalyticsTitles     = 100
+)
+
+// TitleAnalytics 一部影片（种子）在统计范围内的播放情况
+type TitleAnalytics struct {
+	InfoHash string `json:"infoHash"`
+	Title    string `json:"title"`
+	Plays    int64  `json:"plays"`
+	// Viewers 播放过的用户数
+	Viewers int64 `json:"viewers"`
+	// WatchSeconds 所有播放会话的总时长（秒）
+	WatchSeconds int64 `json:"watchSeconds"`
+	BytesServed  int64 `json:"bytesServed"`
+	// CompletionPercent 平均播放进度（0-100），按会话最后读取的位置估算
+	CompletionPercent float64   `json:"completionPercent"`
+	LastPlayedAt      time.Time `json:"lastPlayedAt"`
+}
+
+// StreamAnalytics 播放统计结果
+type StreamAnalytics struct {
+	Range string `json:"range"`
+	// PeakConcurrent 统计范围内同时播放的最大会话数，包括正在进行的会话
+	PeakConcurrent int              `json:"peakConcurrent"`
+	PeakAt         *time.Time       `json:"peakAt,omitempty"`
+	Titles         []TitleAnalytics `json:"titles"`
+}
+
+// StreamAnalyticsService 记录结束的播放会话，按影片统计播放次数、时长和同时播放数
+// 文件下载不是播放，不记录
+type StreamAnalyticsService struct {
+	store        *db.StreamLogStore
+	torrentStore *db.TorrentStore
+	sessions     *StreamSessions
+}
+
+// NewStreamAnalyticsService 创建播放统计服务，需把 RecordSession 设为 sessions 的结束回调
+func NewStreamAnalyticsService(store *db.StreamLogStore, torrentStore *db.TorrentStore, sessions *StreamSessions) *StreamAnalyticsService {
+	return &StreamAnalyticsService{
+		store:        store,
+		torrentStore: torrentStore,
+		sessions:     sessions,
+	}
+}
+
+// RecordSession 记录一个结束的会话，没有读取数据的会话不记录
+func (s *StreamAnalyticsService) RecordSession(session StreamSession, endedAt time.Time) {
+	if session.Kind == StreamKindDownload || session.BytesRead == 0 {
+		return
+	}
+
+	entry := &db.StreamLogEntry{
+		UserID:     session.UserID,
+		RemoteAddr: session.RemoteAddr,
+		UserAgent:  session.UserAgent,
+		Kind:       session.Kind,
+		InfoHash:   session.InfoHash,
+		FileIndex:  session.FileIndex,
+		FilePath:   session.FilePath,
+		FileLength: session.FileLength,
+		Title:      s.title(session.InfoHash),
+		StartedAt:  session.StartedAt,
+		EndedAt:    endedAt,
+		BytesRead:  session.BytesRead,
+		LastOffset: session.Offset,
+	}
+	if err := s.store.AddEntry(entry, streamLogMergeWindow); err != nil {
+		log.Printf("警告: 记录播放会话失败: %v", err)
+		return
+	}
+	if err := s.store.DeleteBefore(endedAt.Add(-streamLogKeep)); err != nil {
+		log.Printf("警告: 清理播放记录失败: %v", err)
+	}
+}
+
+// title 影片标题：匹配到电影或剧集时使用其标题，否则使用种子名称
+// 标题随记录保存，种子删除后统计中仍能显示
+func (s *StreamAnalyticsService) title(infoHash string) string {
+	record, err := s.torrentStore.GetTorrent(infoHash)
+	if err != nil || record == nil {
+		return ""
+	}
+	if record.MovieDetails != nil && record.MovieDetails.Filename != "" {
+		return record.MovieDetails.Filename
+	}
+	return record.Name
+}
+
+// Titles 返回最近一段时间播放最多的影片和同时播放的峰值
+// rangeText 为 24h、7d 这样的时长，默认 30d，最长 90 天；limit 为 0 时返回 20 部
+func (s *StreamAnalyticsService) Titles(rangeText string, limit int, now time.Time) (*StreamAnalytics, error) {
+	if rangeText == "" {
+		rangeText = "30d"
+	}
+	length, err := parseStatsRange(rangeText)
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 {
+		limit = defaultAnalyticsTitles
+	}
+	if limit < 0 || limit > maxAnalyticsTitles {
+		return nil, validator.ValidationError{Field: "limit", Message: "必须为 1 到 100 之间的整数"}
+	}
+
+	since := now.Add(-length)
+	stats, err := s.store.TitleStats(since, limit)
+	if err != nil {
+		return nil, err
+	}
+	intervals, err := s.store.Intervals(since)
+	if err != nil {
+		return nil, err
+	}
+	// 正在进行的会话尚未记录
+	for _, session := range s.sessions.List() {
+		if session.Kind != StreamKindDownload {
+			intervals = append(intervals, db.StreamInterval{Start: session.StartedAt.Truncate(time.Second).UTC(), End: now})
+		}
+	}
+
+	analytics := &StreamAnalytics{
+		Range:  rangeText,
+		Titles: make([]TitleAnalytics, 0, len(stats)),
+	}
+	analytics.PeakConcurrent, analytics.PeakAt = peakConcurrent(intervals, since)
+	for _, title := range stats {
+		analytics.Titles = append(analytics.Titles, TitleAnalytics{
+			InfoHash:          title.InfoHash,
+			Title:             title.Title,
+			Plays:             title.Plays,
+			Viewers:           title.Viewers,
+			WatchSeconds:      title.WatchSeconds,
+			BytesServed:       title.BytesServed,
+			CompletionPercent: math.Round(title.Completion*1000) / 10,
+			LastPlayedAt:      title.LastPlayedAt,
+		})
+	}
+	return analytics, nil
+}
+
+// peakConcurrent 同时进行的会话数的最大值及其开始时间，since 之前的部分不计
+func peakConcurrent(intervals []db.StreamInterval, since time.Time) (int, *time.Time) {
+	type change struct {
+		at    time.Time
+		delta int
+	}
+	changes := make([]change, 0, 2*len(intervals))
+	for _, interval := range intervals {
+		start := interval.Start
+		if start.Before(since) {
+			start = since
+		}
+		// 记录精确到秒，不足一秒的会话（如播放器探测文件）不计
+		if !interval.End.After(start) {
+			continue
+		}
+		changes = append(changes, change{start, 1}, change{interval.End, -1})
+	}
+	// 同一时刻先结束后开始，首尾相接的会话不算同时进行
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].at.Equal(changes[j].at) {
+			return changes[i].delta < changes[j].delta
+		}
+		return changes[i].at.Before(changes[j].at)
+	})
+
+	var current, peak int
+	var peakAt *time.Time
+	for _, c := range changes {
+		current += c.delta
+		if current > peak {
+			peak = current
+			at := c.at
+			peakAt = &at
+		}
+	}
+	return peak, peakAt
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/torrentplayer/backend/db"
+)
+
+func TestPeakConcurrent(t *testing.T) {
+	start := time.Date(2026, 1, 1, 20, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	intervals := []db.StreamInterval{
+		{Start: at(-30), End: at(10)},
+		{Start: at(5), End: at(60)},
+		// 首尾相接，不算同时播放
+		{Start: at(10), End: at(20)},
+		{Start: at(15), End: at(16)},
+		// 探测请求
+		{Start: at(30), End: at(30)},
+	}
+	peak, peakAt := peakConcurrent(intervals, start)
+	if peak != 3 || peakAt == nil || !peakAt.Equal(at(15)) {
+		t.Fatalf("peak %d at %v, want 3 at %v", peak, peakAt, at(15))
+	}
+
+	if peak, peakAt := peakConcurrent(nil, start); peak != 0 || peakAt != nil {
+		t.Errorf("peak %d at %v without sessions", peak, peakAt)
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// streamBufferSize 播放和下载每次从种子读取的字节数
+const streamBufferSize = 256 * 1024
+
+// streamBuffers 读取缓冲池，播放请求之间复用缓冲而不是每个请求分配一次
+var streamBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, streamBufferSize)
+		return &buf
+	},
+}
+
+// CopyStream 使用缓冲池中的缓冲把 src 写入 dst，每次写入的数据不超过 streamBufferSize
+// ctx 结束（客户端断开）后不再读取，返回 ctx 的错误
+func CopyStream(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	bufp := streamBuffers.Get().(*[]byte)
+	defer streamBuffers.Put(bufp)
+	buf := *bufp
+
+	var written int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			m, werr := dst.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+			if m < n {
+				return written, io.ErrShortWrite
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
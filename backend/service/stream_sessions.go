@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/torrentplayer/backend/torrent"
+	"golang.org/x/time/rate"
+)
+
+// ErrTooManyStreams 同时播放的会话数已达上限
+var ErrTooManyStreams = errors.New("同时播放的数量已达上限")
+
+// ErrStreamSessionNotFound 播放会话不存在或已结束
+var ErrStreamSessionNotFound = errors.New("播放会话不存在")
+
+// 会话类型
+const (
+	StreamKindStream   = "stream"
+	StreamKindDownload = "download"
+	StreamKindDLNA     = "dlna"
+	StreamKindGRPC     = "grpc"
+)
+
+// throughputWindow 计算吞吐量的时间窗口
+const throughputWindow = 2 * time.Second
+
+// rateBurst 限速会话可以一次读取的数据量，按限速换算为时长；播放器开始播放和拖动后可以先快速填充缓冲
+const rateBurst = 10 * time.Second
+
+// minRateBurst 限速会话一次读取的下限，限速很低时也不会把读取切得过碎
+const minRateBurst = 64 * 1024
+
+// StreamClient 打开文件的客户端
+type StreamClient struct {
+	UserID     int64
+	Username   string
+	RemoteAddr string // 客户端IP，不含端口
+	UserAgent  string
+	Kind       string
+}
+
+// StreamSession 正在播放或下载的会话
+// 播放器拖动进度时会关闭旧请求并发起新的 Range 请求，同一客户端读取同一文件的所有请求属于一个会话
+type StreamSession struct {
+	ID         string    `json:"id"`
+	UserID     int64     `json:"userId"`
+	Username   string    `json:"username,omitempty"`
+	RemoteAddr string    `json:"remoteAddr"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	Kind       string    `json:"kind"`
+	InfoHash   string    `json:"infoHash"`
+	FileIndex  int       `json:"fileIndex"`
+	FilePath   string    `json:"filePath"`
+	FileLength int64     `json:"fileLength"`
+	StartedAt  time.Time `json:"startedAt"`
+	// Offset 最近一次读取后的位置
+	Offset    int64 `json:"offset"`
+	BytesRead int64 `json:"bytesRead"`
+	// ThroughputBps 最近的读取速度（字节/秒）
+	ThroughputBps float64 `json:"throughputBps"`
+	// Connections 属于该会话的请求数
+	Connections int `json:"connections"`
+	// RateLimitBps 会话的读取速度上限（字节/秒），0 表示不限速
+	RateLimitBps int64 `json:"rateLimitBps"`
+	// RateLimitOverride 限速由管理员为该会话单独设置，而不是按 TORRENT_STREAM_RATE_FACTOR 计算
+	RateLimitOverride bool `json:"rateLimitOverride,omitempty"`
+
+	windowStart time.Time
+	windowBytes int64
+	autoRate    int64         // 按码率计算的默认限速，0 表示不限速
+	limiter     *rate.Limiter // 会话的所有请求共用
+}
+
+// StreamSessions 会话登记表，限制同时播放的会话数和每个会话的读取速度
+type StreamSessions struct {
+	maxSessions int     // 0 表示不限制
+	rateFactor  float64 // 视频播放会话的限速为估算码率的倍数，0 表示不限速
+
+	mu       sync.Mutex
+	sessions map[string]*StreamSession // 键为 sessionKey
+	onEnd    func(session StreamSession, endedAt time.Time)
+}
+
+// NewStreamSessions 创建会话登记表，maxSessions 为 0 时不限制
+// rateFactor 大于 0 时按视频文件估算码率的 rateFactor 倍限制播放会话的读取速度，
+// 避免一个预读过多的播放器占满带宽，影响其他播放和种子下载
+func NewStreamSessions(maxSessions int, rateFactor float64) *StreamSessions {
+	return &StreamSessions{
+		maxSessions: maxSessions,
+		rateFactor:  rateFactor,
+		sessions:    make(map[string]*StreamSession),
+	}
+}
+
+// SetEndHandler 设置会话结束时的回调，用于记录播放日志；需在打开文件前设置
+func (s *StreamSessions) SetEndHandler(handler func(session StreamSession, endedAt time.Time)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onEnd = handler
+}
+
+// sessionKey 同一用户从同一地址以同一方式读取同一文件的请求共用一个会话
+func sessionKey(client StreamClient, infoHash string, fileIndex int) string {
+	return fmt.Sprintf("%d|%s|%s|%s|%d", client.UserID, client.RemoteAddr, client.Kind, infoHash, fileIndex)
+}
+
+// open 登记一个请求，加入已有会话或新建会话；新建会话超过上限时返回 ErrTooManyStreams
+// runtime 为文件的片长，用于估算码率，未知时为 0
+func (s *StreamSessions) open(client StreamClient, file *torrent.FileInfo, runtime time.Duration) (string, error) {
+	key := sessionKey(client, file.TorrentID, file.FileIndex)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, ok := s.sessions[key]; ok {
+		session.Connections++
+		return key, nil
+	}
+	if err := s.checkLimit(); err != nil {
+		return "", err
+	}
+
+	// 下载不是播放，没有码率可言，只对视频的播放会话自动限速
+	var autoRate int64
+	if s.rateFactor > 0 && file.IsVideo && client.Kind != StreamKindDownload {
+		autoRate = int64(s.rateFactor * torrent.EstimateBitrate(file.Length, runtime))
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	now := time.Now()
+	s.sessions[key] = &StreamSession{
+		ID:           hex.EncodeToString(id),
+		UserID:       client.UserID,
+		Username:     client.Username,
+		RemoteAddr:   client.RemoteAddr,
+		UserAgent:    client.UserAgent,
+		Kind:         client.Kind,
+		InfoHash:     file.TorrentID,
+		FileIndex:    file.FileIndex,
+		FilePath:     file.Path,
+		FileLength:   file.Length,
+		StartedAt:    now,
+		Connections:  1,
+		RateLimitBps: autoRate,
+		windowStart:  now,
+		autoRate:     autoRate,
+		limiter:      newRateLimiter(autoRate),
+	}
+	return key, nil
+}
+
+// newRateLimiter 每秒 bytesPerSec 字节的限速器，0 表示不限速
+func newRateLimiter(bytesPerSec int64) *rate.Limiter {
+	if bytesPerSec <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSec), rateBurstSize(bytesPerSec))
+}
+
+// rateBurstSize 限速为 bytesPerSec 时一次可以读取的字节数
+func rateBurstSize(bytesPerSec int64) int {
+	return int(max(bytesPerSec*int64(rateBurst/time.Second), minRateBurst))
+}
+
+// limiter 会话的限速器，会话的所有请求共用
+func (s *StreamSessions) limiter(key string) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, ok := s.sessions[key]; ok {
+		return session.limiter
+	}
+	return newRateLimiter(0)
+}
+
+// SetRateLimit 设置会话的读取速度上限（字节/秒），立即作用于会话中正在进行的请求
+// bytesPerSec 为 0 时不限速，为负数时恢复按 TORRENT_STREAM_RATE_FACTOR 计算的默认限速
+func (s *StreamSessions) SetRateLimit(id string, bytesPerSec int64) (*StreamSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.sessions {
+		if session.ID != id {
+			continue
+		}
+		session.RateLimitOverride = bytesPerSec >= 0
+		if bytesPerSec < 0 {
+			bytesPerSec = session.autoRate
+		}
+		session.RateLimitBps = bytesPerSec
+		if bytesPerSec == 0 {
+			session.limiter.SetLimit(rate.Inf)
+		} else {
+			session.limiter.SetBurst(rateBurstSize(bytesPerSec))
+			session.limiter.SetLimit(rate.Limit(bytesPerSec))
+		}
+		snapshot := *session
+		return &snapshot, nil
+	}
+	return nil, ErrStreamSessionNotFound
+}
+
+// Check 检查能否打开文件而不超过上限，用于在发送响应头之前提前拒绝
+func (s *StreamSessions) Check(client StreamClient, infoHash string, fileIndex int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[sessionKey(client, infoHash, fileIndex)]; ok {
+		return nil
+	}
+	return s.checkLimit()
+}
+
+// checkLimit 新建会话是否超过上限，调用时需持有锁
+func (s *StreamSessions) checkLimit() error {
+	if s.maxSessions > 0 && len(s.sessions) >= s.maxSessions {
+		return fmt.Errorf("%w（%d）", ErrTooManyStreams, s.maxSessions)
+	}
+	return nil
+}
+
+// close 请求结束，会话没有其他请求时移除并调用结束回调
+func (s *StreamSessions) close(key string) {
+	s.mu.Lock()
+	session, ok := s.sessions[key]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	session.Connections--
+	if session.Connections > 0 {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.sessions, key)
+	snapshot, onEnd := *session, s.onEnd
+	s.mu.Unlock()
+
+	// 回调会写数据库，不能持有锁
+	if onEnd != nil {
+		onEnd(snapshot, time.Now())
+	}
+}
+
+// record 记录一次读取
+func (s *StreamSessions) record(key string, offset int64, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[key]
+	if !ok {
+		return
+	}
+	session.Offset = offset
+	session.BytesRead += int64(n)
+	session.windowBytes += int64(n)
+	if elapsed := time.Since(session.windowStart); elapsed >= throughputWindow {
+		session.ThroughputBps = float64(session.windowBytes) / elapsed.Seconds()
+		session.windowStart = time.Now()
+		session.windowBytes = 0
+	}
+}
+
+// List 当前的会话，按开始时间排序
+func (s *StreamSessions) List() []StreamSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	sessions := make([]StreamSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		snapshot := *session
+		// 读取暂停（如播放器缓冲已满）超过一个窗口时按当前窗口计算，否则速度会停留在暂停前的值
+		if elapsed := now.Sub(session.windowStart); elapsed >= 2*throughputWindow {
+			snapshot.ThroughputBps = float64(session.windowBytes) / elapsed.Seconds()
+		}
+		sessions = append(sessions, snapshot)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt.Before(sessions[j].StartedAt)
+	})
+	return sessions
+}
+
+// MaxSessions 同时播放的会话数上限，0 表示不限制
+func (s *StreamSessions) MaxSessions() int {
+	return s.maxSessions
+}
+
+// trackedReader 统计读取位置和字节数，按会话的限速读取，关闭时结束会话
+type trackedReader struct {
+	torrent.FileReader
+	sessions *StreamSessions
+	key      string
+	limiter  *rate.Limiter
+	offset   int64
+	once     sync.Once
+}
+
+func (r *trackedReader) Read(p []byte) (int, error) {
+	return r.ReadContext(context.Background(), p)
+}
+
+func (r *trackedReader) ReadContext(ctx context.Context, p []byte) (int, error) {
+	// 每次读取不超过限速器允许的突发量，读取后等待到限速允许为止
+	if r.limiter.Limit() != rate.Inf && len(p) > r.limiter.Burst() {
+		p = p[:r.limiter.Burst()]
+	}
+	n, err := r.FileReader.ReadContext(ctx, p)
+	r.advance(n)
+	if n > 0 && err == nil {
+		err = r.wait(ctx, n)
+	}
+	return n, err
+}
+
+// wait 等待限速器放行 n 字节，客户端断开时返回 ctx 的错误
+func (r *trackedReader) wait(ctx context.Context, n int) error {
+	if err := r.limiter.WaitN(ctx, n); err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// 其他错误只可能是限速在读取期间被调低，使 n 超过了新的突发量，不再等待
+	return nil
+}
+
+func (r *trackedReader) Seek(offset int64, whence int) (int64, error) {
+	position, err := r.FileReader.Seek(offset, whence)
+	if err == nil {
+		r.offset = position
+	}
+	return position, err
+}
+
+func (r *trackedReader) Close() error {
+	r.once.Do(func() { r.sessions.close(r.key) })
+	return r.FileReader.Close()
+}
+
+func (r *trackedReader) advance(n int) {
+	if n > 0 {
+		r.offset += int64(n)
+		r.sessions.record(r.key, r.offset, n)
+	}
+}
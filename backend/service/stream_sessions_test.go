@@ -0,0 +1,91 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/torrentplayer/backend/torrent"
+	"golang.org/x/time/rate"
+)
+
+func TestStreamSessionsLimit(t *testing.T) {
+	sessions := NewStreamSessions(1, 0)
+	alice := StreamClient{UserID: 1, RemoteAddr: "10.0.0.2", Kind: StreamKindStream}
+	bob := StreamClient{UserID: 2, RemoteAddr: "10.0.0.3", Kind: StreamKindStream}
+	movie := &torrent.FileInfo{TorrentID: "abc", FileIndex: 0, Path: "movie.mkv", Length: 100}
+
+	first, err := sessions.open(alice, movie, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	// 拖动进度时的第二个 Range 请求加入同一会话，不占用名额
+	second, err := sessions.open(alice, movie, 0)
+	if err != nil {
+		t.Fatalf("open same file again: %v", err)
+	}
+	if first != second {
+		t.Fatalf("expected one session for the same client and file")
+	}
+	if _, err := sessions.open(bob, movie, 0); !errors.Is(err, ErrTooManyStreams) {
+		t.Fatalf("expected ErrTooManyStreams, got %v", err)
+	}
+
+	sessions.record(first, 60, 60)
+	list := sessions.List()
+	if len(list) != 1 || list[0].Connections != 2 || list[0].Offset != 60 || list[0].BytesRead != 60 {
+		t.Fatalf("unexpected sessions: %+v", list)
+	}
+
+	sessions.close(first)
+	if len(sessions.List()) != 1 {
+		t.Fatalf("session should stay open while a request remains")
+	}
+	sessions.close(second)
+	if _, err := sessions.open(bob, movie, 0); err != nil {
+		t.Fatalf("open after the session ended: %v", err)
+	}
+}
+
+func TestStreamSessionsRateLimit(t *testing.T) {
+	sessions := NewStreamSessions(0, 1.5)
+	alice := StreamClient{UserID: 1, RemoteAddr: "10.0.0.2", Kind: StreamKindStream}
+	download := StreamClient{UserID: 1, RemoteAddr: "10.0.0.2", Kind: StreamKindDownload}
+	// 两小时 7.2 GB，码率 1 MB/s
+	movie := &torrent.FileInfo{TorrentID: "abc", FileIndex: 0, Path: "movie.mkv", Length: 7_200_000_000, IsVideo: true}
+
+	key, err := sessions.open(alice, movie, 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessions.open(download, movie, 2*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	limits := map[string]int64{}
+	var id string
+	for _, session := range sessions.List() {
+		limits[session.Kind] = session.RateLimitBps
+		if session.Kind == StreamKindStream {
+			id = session.ID
+		}
+	}
+	if limits[StreamKindStream] != 1_500_000 || limits[StreamKindDownload] != 0 {
+		t.Fatalf("unexpected rate limits: %v", limits)
+	}
+	if limiter := sessions.limiter(key); limiter.Limit() != 1_500_000 {
+		t.Fatalf("limiter allows %v bytes per second", limiter.Limit())
+	}
+
+	// 管理员单独设置的限速立即作用于会话的限速器，负数恢复默认限速
+	session, err := sessions.SetRateLimit(id, 0)
+	if err != nil || session.RateLimitBps != 0 || !session.RateLimitOverride || sessions.limiter(key).Limit() != rate.Inf {
+		t.Fatalf("remove limit: %+v, %v", session, err)
+	}
+	session, err = sessions.SetRateLimit(id, -1)
+	if err != nil || session.RateLimitBps != 1_500_000 || session.RateLimitOverride || sessions.limiter(key).Limit() != 1_500_000 {
+		t.Fatalf("restore limit: %+v, %v", session, err)
+	}
+	if _, err := sessions.SetRateLimit("missing", 0); !errors.Is(err, ErrStreamSessionNotFound) {
+		t.Fatalf("expected ErrStreamSessionNotFound, got %v", err)
+	}
+}
@@ -1,45 +1,117 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/torrentplayer/backend/auth"
 	"github.com/torrentplayer/backend/config"
 	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/events"
+	"github.com/torrentplayer/backend/importer"
 	"github.com/torrentplayer/backend/torrent"
+	"github.com/torrentplayer/backend/validator"
 )
 
+// ErrTorrentNotFound 种子不存在
+var ErrTorrentNotFound = errors.New("种子不存在")
+
+// ErrFileNotFound 种子中不存在该文件
+var ErrFileNotFound = errors.New("文件不存在")
+
+// ErrFileIncomplete 文件尚未下载完成
+var ErrFileIncomplete = errors.New("文件尚未下载完成")
+
 // TorrentService 种子服务层
 type TorrentService struct {
 	torrentClient *torrent.Client
 	torrentStore  *db.TorrentStore
+	trackerStore  *db.TrackerStore
+	webseedStore  *db.WebseedStore
+	connStore     *db.ConnectionStore
+	episodeStore  *db.EpisodeStore
+	collections   *db.CollectionStore
+	states        *StateMachine
+	metadataQueue *MetadataQueue
+	seeding       *SeedingPolicy
+	postProcess   *PostProcessor
+	organizer     *Organizer
+	bus           *events.Bus
 	config        *config.Config
+	labels        *labelIndex
+	streams       *StreamSessions
 }
 
 // NewTorrentService 创建种子服务实例
-func NewTorrentService(client *torrent.Client, store *db.TorrentStore, cfg *config.Config) *TorrentService {
+func NewTorrentService(client *torrent.Client, store *db.TorrentStore, trackerStore *db.TrackerStore, webseedStore *db.WebseedStore, connStore *db.ConnectionStore, episodeStore *db.EpisodeStore, collections *db.CollectionStore, states *StateMachine, queue *MetadataQueue, seeding *SeedingPolicy, postProcess *PostProcessor, organizer *Organizer, bus *events.Bus, cfg *config.Config) *TorrentService {
 	return &TorrentService{
 		torrentClient: client,
 		torrentStore:  store,
+		trackerStore:  trackerStore,
+		webseedStore:  webseedStore,
+		connStore:     connStore,
+		episodeStore:  episodeStore,
+		collections:   collections,
+		states:        states,
+		metadataQueue: queue,
+		seeding:       seeding,
+		postProcess:   postProcess,
+		organizer:     organizer,
+		bus:           bus,
 		config:        cfg,
+		labels:        newLabelIndex(),
+		streams:       NewStreamSessions(cfg.Torrent.MaxStreams, cfg.Torrent.StreamRateFactor),
 	}
 }
 
-// AddMagnet 添加磁力链接
-func (s *TorrentService) AddMagnet(magnetURI string) (*torrent.TorrentInfo, error) {
+// AddMagnet 添加磁力链接，立即返回 queued 状态，元数据由后台队列获取
+// private 为 true 时按私有种子处理（不添加公共 tracker，不使用 DHT 和 PEX）；元数据带有 private 标记的种子也会自动按私有种子处理
+func (s *TorrentService) AddMagnet(ctx context.Context, magnetURI string, private bool) (*torrent.TorrentInfo, error) {
+	return s.AddMagnetWithTimeout(ctx, magnetURI, private, 0)
+}
+
+// AddMagnetWithTimeout 添加磁力链接，每次等待元数据 metadataTimeout，为 0 时使用 TORRENT_METADATA_TIMEOUT
+func (s *TorrentService) AddMagnetWithTimeout(ctx context.Context, magnetURI string, private bool, metadataTimeout time.Duration) (*torrent.TorrentInfo, error) {
 	// 验证磁力链接
 	if magnetURI == "" {
 		return nil, fmt.Errorf("磁力链接不能为空")
 	}
 
 	// 调用torrent客户端添加磁力链接
-	torrentInfo, err := s.torrentClient.AddMagnet(magnetURI)
+	torrentInfo, err := s.torrentClient.AddMagnetAsync(magnetURI, private)
 	if err != nil {
+		slog.ErrorContext(ctx, "添加磁力链接失败", "error", err)
 		return nil, fmt.Errorf("添加磁力链接失败: %w", err)
 	}
 
-	// 保存到数据库
+	// 已存在的种子直接返回现有记录，不改动其状态、数据库记录和队列
+	if _, _, tracked := s.states.Get(torrentInfo.InfoHash); tracked {
+		if existing, err := s.torrentStore.GetTorrent(torrentInfo.InfoHash); err == nil && existing != nil {
+			torrentInfo.AddedBy = existing.AddedBy
+			torrentInfo.AddedAt = existing.AddedAt
+			if torrentInfo.MovieDetails == nil {
+				torrentInfo.MovieDetails = existing.MovieDetails
+			}
+		}
+		s.applyState(torrentInfo)
+		torrentInfo.AlreadyExists = true
+
+		slog.InfoContext(ctx, "种子已存在", "info_hash", torrentInfo.InfoHash, "name", torrentInfo.Name)
+		return torrentInfo, nil
+	}
+
+	torrentInfo.AddedBy = userIDFromContext(ctx)
+	s.states.Track(torrentInfo.InfoHash, StateQueued, "")
+	s.applyState(torrentInfo)
+
+	// 保存到数据库，记录已存在（如回收站中的种子）时保留电影详情和创建时间，进度清零并归当前用户所有
 	record := &db.TorrentRecord{
 		InfoHash:  torrentInfo.InfoHash,
 		Name:      torrentInfo.Name,
@@ -48,19 +120,157 @@ func (s *TorrentService) AddMagnet(magnetURI string) (*torrent.TorrentInfo, erro
 		Length:    torrentInfo.Length,
 		Progress:  torrentInfo.Progress,
 		State:     torrentInfo.State,
+		Private:   torrentInfo.Private,
+		Category:  torrentInfo.Category,
+		Tags:      torrentInfo.Tags,
+		AddedBy:   torrentInfo.AddedBy,
 	}
 
 	if err := s.torrentStore.AddTorrent(record); err != nil {
-		log.Printf("警告: 保存种子到数据库失败: %v", err)
+		slog.WarnContext(ctx, "保存种子到数据库失败", "info_hash", torrentInfo.InfoHash, "error", err)
 		// 不阻断流程，继续返回种子信息
 	}
 
+	s.bus.Publish(events.TorrentAdded, torrentInfo.InfoHash, torrentInfo)
+	s.metadataQueue.EnqueueWithTimeout(torrentInfo.InfoHash, metadataTimeout)
+
+	slog.InfoContext(ctx, "已添加种子", "info_hash", torrentInfo.InfoHash, "name", torrentInfo.Name)
 	return torrentInfo, nil
 }
 
-// ListTorrents 获取所有种子列表
-func (s *TorrentService) ListTorrents() ([]torrent.TorrentInfo, error) {
-	return s.torrentClient.ListTorrents(), nil
+// TorrentListQuery 种子列表查询条件
+type TorrentListQuery struct {
+	TorrentFilter
+	AddedBy *int64 // 只列出该用户添加的种子
+	State   string
+	Sort    string // name、added、progress、size、state，默认 added
+	Desc    bool
+	Limit   int // 0 表示不分页
+	Offset  int
+}
+
+// torrentSortKeys 支持的排序字段
+var torrentSortKeys = map[string]bool{
+	"name":     true,
+	"added":    true,
+	"progress": true,
+	"size":     true,
+	"state":    true,
+}
+
+// ListTorrents 按条件排序、过滤和分页获取种子列表，同时返回符合条件的总数
+// 分页由数据库完成，再合并客户端中的实时进度；进度只在客户端中实时更新，按进度排序时在内存中排序后分页
+func (s *TorrentService) ListTorrents(query TorrentListQuery) ([]torrent.TorrentInfo, int, error) {
+	if query.Sort == "" {
+		query.Sort = "added"
+	}
+	if !torrentSortKeys[query.Sort] {
+		return nil, 0, validator.ValidationError{Field: "sort", Message: "必须为 name、added、progress、size 或 state"}
+	}
+	if query.State != "" && !TorrentState(query.State).Valid() {
+		return nil, 0, validator.ValidationError{Field: "state", Message: "未知的种子状态"}
+	}
+	if query.Limit < 0 || query.Offset < 0 {
+		return nil, 0, validator.ValidationError{Field: "limit", Message: "limit和offset不能为负数"}
+	}
+
+	dbQuery := db.TorrentQuery{
+		State:    query.State,
+		Category: query.Category,
+		Tags:     query.Tags,
+		AddedBy:  query.AddedBy,
+		SortBy:   query.Sort,
+		Desc:     query.Desc,
+		Limit:    query.Limit,
+		Offset:   query.Offset,
+	}
+	liveSort := query.Sort == "progress"
+	if liveSort {
+		dbQuery.Limit, dbQuery.Offset = 0, 0
+	}
+
+	records, total, err := s.torrentStore.GetTorrentsPaginated(dbQuery)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询种子列表失败: %w", err)
+	}
+
+	torrents := make([]torrent.TorrentInfo, 0, len(records))
+	for _, record := range records {
+		torrents = append(torrents, *s.liveTorrentInfo(record))
+	}
+
+	if liveSort {
+		sort.SliceStable(torrents, func(i, j int) bool {
+			if query.Desc {
+				return torrents[i].Progress > torrents[j].Progress
+			}
+			return torrents[i].Progress < torrents[j].Progress
+		})
+		torrents = paginate(torrents, query.Limit, query.Offset)
+	}
+	return torrents, total, nil
+}
+
+// liveTorrentInfo 用客户端快照中的数据（最多延迟几秒）填充数据库记录，客户端中不存在时使用记录中保存的数据
+func (s *TorrentService) liveTorrentInfo(record *db.TorrentRecord) *torrent.TorrentInfo {
+	info, ok := s.torrentClient.CachedTorrentInfo(record.InfoHash)
+	if !ok {
+		info = &torrent.TorrentInfo{
+			InfoHash:   record.InfoHash,
+			Name:       record.Name,
+			Length:     record.Length,
+			Files:      []torrent.FileInfo{},
+			Downloaded: record.Downloaded,
+			Progress:   record.Progress,
+			Private:    record.Private,
+			AddedAt:    record.AddedAt,
+		}
+	}
+	if info.MovieDetails == nil {
+		info.MovieDetails = record.MovieDetails
+	}
+	info.AddedBy = record.AddedBy
+
+	s.applyState(info)
+	if !ok {
+		info.State = record.State
+		info.StateReason = record.StateReason
+		info.LastError = record.LastError
+		info.Category = record.Category
+		info.Tags = record.Tags
+	}
+	return info
+}
+
+// paginate 截取 offset 开始的最多 limit 个元素，limit 为 0 时不限制
+func paginate(torrents []torrent.TorrentInfo, limit, offset int) []torrent.TorrentInfo {
+	if offset >= len(torrents) {
+		return []torrent.TorrentInfo{}
+	}
+	torrents = torrents[offset:]
+	if limit > 0 && limit < len(torrents) {
+		torrents = torrents[:limit]
+	}
+	return torrents
+}
+
+// userIDFromContext 获取请求的用户ID，没有登录用户时（关闭认证或后台任务）返回本地共享用户
+func userIDFromContext(ctx context.Context) int64 {
+	if claims, ok := auth.ClaimsFromContext(ctx); ok {
+		return claims.UserID
+	}
+	return LocalUserID
+}
+
+// applyState 用状态机中的状态、累计上传统计、后处理结果以及分类和标签填充种子信息
+func (s *TorrentService) applyState(info *torrent.TorrentInfo) {
+	state, reason, _ := s.states.Get(info.InfoHash)
+	info.State = string(state)
+	info.StateReason = reason
+	info.LastError = s.states.LastError(info.InfoHash)
+	s.seeding.Apply(info)
+	s.postProcess.Apply(info)
+	s.applyLabels(info)
 }
 
 // GetTorrent 获取指定种子信息
@@ -69,20 +279,408 @@ func (s *TorrentService) GetTorrent(infoHash string) (*torrent.TorrentInfo, erro
 		return nil, fmt.Errorf("InfoHash不能为空")
 	}
 
-	torrentClient, exists := s.torrentClient.GetTorrent(infoHash)
+	_, exists := s.torrentClient.GetTorrent(infoHash)
 	if !exists {
-		return nil, fmt.Errorf("种子不存在")
+		return nil, ErrTorrentNotFound
 	}
 
 	// 获取详细信息
-	torrents := s.torrentClient.ListTorrents()
-	for _, t := range torrents {
-		if t.InfoHash == infoHash {
-			return &t, nil
+	info, ok := s.torrentClient.GetTorrentInfo(infoHash)
+	if !ok {
+		return nil, fmt.Errorf("种子信息获取失败")
+	}
+	s.applyState(info)
+
+	return info, nil
+}
+
+// PauseTorrent 暂停种子的下载与上传
+func (s *TorrentService) PauseTorrent(infoHash string) (*torrent.TorrentInfo, error) {
+	if err := s.pauseTorrent(infoHash, "用户暂停"); err != nil {
+		return nil, err
+	}
+	return s.GetTorrent(infoHash)
+}
+
+// pauseTorrent 暂停种子并记录原因
+func (s *TorrentService) pauseTorrent(infoHash, reason string) error {
+	state, _, ok := s.states.Get(infoHash)
+	if !ok {
+		return ErrTorrentNotFound
+	}
+	if state == StatePaused {
+		return nil
+	}
+	if !state.CanTransitionTo(StatePaused) {
+		return &InvalidTransitionError{From: state, To: StatePaused}
+	}
+
+	if err := s.torrentClient.Pause(infoHash); err != nil {
+		if errors.Is(err, torrent.ErrTorrentNotFound) {
+			return ErrTorrentNotFound
+		}
+		return fmt.Errorf("暂停种子失败: %w", err)
+	}
+	if err := s.states.Transition(infoHash, StatePaused, reason); err != nil {
+		return err
+	}
+	s.metadataQueue.Cancel(infoHash)
+
+	return nil
+}
+
+// ResumeTorrent 恢复暂停的种子，也用于重试出错（error 状态）的种子
+func (s *TorrentService) ResumeTorrent(infoHash string) (*torrent.TorrentInfo, error) {
+	state, _, ok := s.states.Get(infoHash)
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+	if state != StatePaused && state != StateError {
+		return nil, &InvalidTransitionError{From: state, To: StateDownloading}
+	}
+
+	if err := s.torrentClient.Resume(infoHash); err != nil {
+		if errors.Is(err, torrent.ErrTorrentNotFound) {
+			return nil, ErrTorrentNotFound
 		}
+		return nil, fmt.Errorf("恢复种子失败: %w", err)
 	}
 
-	return nil, fmt.Errorf("种子信息获取失败")
+	activity, _ := s.torrentClient.Activity(infoHash)
+	if activity.HasInfo && state != StateError {
+		if err := s.states.Transition(infoHash, observedState(activity), "用户恢复"); err != nil {
+			return nil, err
+		}
+	} else {
+		// 元数据尚未获取或种子出错，重新交给后台队列；已有元数据时队列会立即重新启动下载
+		if err := s.states.Transition(infoHash, StateQueued, "用户恢复"); err != nil {
+			return nil, err
+		}
+		s.metadataQueue.Enqueue(infoHash)
+	}
+
+	return s.GetTorrent(infoHash)
+}
+
+// CheckNetwork 检查监听端口、端口映射、外网可达性和 DHT 状态
+func (s *TorrentService) CheckNetwork(ctx context.Context) *torrent.NetworkCheck {
+	return s.torrentClient.CheckNetwork(ctx, s.config.Torrent.IPCheckURL)
+}
+
+// GetDiagnostics 获取种子下载诊断报告（tracker、DHT、端口映射、peer 趋势、校验失败）
+func (s *TorrentService) GetDiagnostics(ctx context.Context, infoHash string, probe bool) (*torrent.Diagnostics, error) {
+	if infoHash == "" {
+		return nil, fmt.Errorf("InfoHash不能为空")
+	}
+
+	report, err := s.torrentClient.Diagnostics(ctx, strings.ToLower(infoHash), probe)
+	if err != nil {
+		if errors.Is(err, torrent.ErrTorrentNotFound) {
+			return nil, ErrTorrentNotFound
+		}
+		return nil, fmt.Errorf("生成诊断报告失败: %w", err)
+	}
+
+	return report, nil
+}
+
+// GetPieceMap 获取种子每个分片的下载状态和可用性
+func (s *TorrentService) GetPieceMap(infoHash string) (*torrent.PieceMap, error) {
+	pieces, err := s.torrentClient.GetPieceMap(infoHash)
+	switch {
+	case errors.Is(err, torrent.ErrTorrentNotFound):
+		return nil, ErrTorrentNotFound
+	case errors.Is(err, torrent.ErrMetadataIncomplete):
+		return nil, ErrMetadataPending
+	case err != nil:
+		return nil, err
+	}
+	return pieces, nil
+}
+
+// GetSeedingStatus 获取种子的上传统计与做种限制
+func (s *TorrentService) GetSeedingStatus(infoHash string) (*SeedingStatus, error) {
+	info, err := s.GetTorrent(infoHash)
+	if err != nil {
+		return nil, err
+	}
+	return s.seeding.Status(infoHash, info.Length), nil
+}
+
+// UpdateSeedingLimits 设置单个种子的做种限制，字段为空时使用全局设置
+func (s *TorrentService) UpdateSeedingLimits(infoHash string, override *SeedingOverride) (*SeedingStatus, error) {
+	if override == nil {
+		return nil, fmt.Errorf("做种限制不能为空")
+	}
+
+	info, err := s.GetTorrent(infoHash)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.seeding.SetOverride(infoHash, override); err != nil {
+		return nil, err
+	}
+	return s.seeding.Status(infoHash, info.Length), nil
+}
+
+// ListTrackers 获取种子的 tracker 列表及最近一次强制汇报的结果
+func (s *TorrentService) ListTrackers(infoHash string) ([]torrent.TrackerInfo, error) {
+	trackers, err := s.torrentClient.Trackers(infoHash)
+	if err != nil {
+		return nil, trackerError(err)
+	}
+	return trackers, nil
+}
+
+// AddTrackers 为种子添加自定义 tracker，重启后仍然保留
+func (s *TorrentService) AddTrackers(infoHash string, urls []string) ([]torrent.TrackerInfo, error) {
+	if err := validateTrackerURLs(urls); err != nil {
+		return nil, err
+	}
+	if err := s.torrentClient.AddTrackers(infoHash, urls); err != nil {
+		return nil, trackerError(err)
+	}
+	for _, u := range urls {
+		if err := s.trackerStore.SaveTrackerEdit(infoHash, u, false); err != nil {
+			return nil, err
+		}
+	}
+	return s.ListTrackers(infoHash)
+}
+
+// RemoveTrackers 从种子中移除 tracker（包括添加磁力链接时自动加入的公共 tracker），重启后不会再加回
+func (s *TorrentService) RemoveTrackers(infoHash string, urls []string) ([]torrent.TrackerInfo, error) {
+	if len(urls) == 0 {
+		return nil, validator.ValidationError{Field: "url", Message: "至少需要一个 tracker"}
+	}
+	if err := s.torrentClient.RemoveTrackers(infoHash, urls); err != nil {
+		return nil, trackerError(err)
+	}
+	for _, u := range urls {
+		if err := s.trackerStore.SaveTrackerEdit(infoHash, u, true); err != nil {
+			return nil, err
+		}
+	}
+	return s.ListTrackers(infoHash)
+}
+
+// ReannounceTrackers 立即向所有 tracker 汇报并加入返回的 peer
+func (s *TorrentService) ReannounceTrackers(ctx context.Context, infoHash string) ([]torrent.TrackerInfo, error) {
+	trackers, err := s.torrentClient.Reannounce(ctx, infoHash)
+	if err != nil {
+		return nil, trackerError(err)
+	}
+	return trackers, nil
+}
+
+// restoreTrackers 恢复种子时重新应用用户对 tracker 列表的修改
+func (s *TorrentService) restoreTrackers(infoHash string) {
+	edits, err := s.trackerStore.GetTrackerEdits(infoHash)
+	if err != nil {
+		log.Printf("警告: %v", err)
+		return
+	}
+	if err := s.torrentClient.AddTrackers(infoHash, edits.Added); err != nil {
+		log.Printf("警告: 恢复自定义 tracker 失败 %s: %v", infoHash, err)
+	}
+	if len(edits.Removed) > 0 {
+		if err := s.torrentClient.RemoveTrackers(infoHash, edits.Removed); err != nil {
+			log.Printf("警告: 恢复已移除的 tracker 失败 %s: %v", infoHash, err)
+		}
+	}
+}
+
+// validateTrackerURLs 检查 tracker 地址，只接受 udp、http(s) 和 ws(s)
+func validateTrackerURLs(urls []string) error {
+	if len(urls) == 0 {
+		return validator.ValidationError{Field: "urls", Message: "至少需要一个 tracker"}
+	}
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return validator.ValidationError{Field: "urls", Message: "无效的 tracker 地址: " + raw}
+		}
+		switch u.Scheme {
+		case "udp", "http", "https", "ws", "wss":
+		default:
+			return validator.ValidationError{Field: "urls", Message: "不支持的 tracker 协议: " + raw}
+		}
+	}
+	return nil
+}
+
+// trackerError 转换 torrent 客户端的错误
+func trackerError(err error) error {
+	if errors.Is(err, torrent.ErrTorrentNotFound) {
+		return ErrTorrentNotFound
+	}
+	return fmt.Errorf("修改 tracker 失败: %w", err)
+}
+
+// ListWebseeds 获取种子的 HTTP web seed 列表
+func (s *TorrentService) ListWebseeds(infoHash string) ([]string, error) {
+	webseeds, err := s.torrentClient.Webseeds(infoHash)
+	if err != nil {
+		return nil, webseedError(err)
+	}
+	return webseeds, nil
+}
+
+// AddWebseeds 为种子添加 HTTP 镜像作为 web seed，立即开始从镜像下载，重启后仍然保留
+func (s *TorrentService) AddWebseeds(infoHash string, urls []string) ([]string, error) {
+	if err := validateWebseedURLs(urls); err != nil {
+		return nil, err
+	}
+	if err := s.torrentClient.AddWebseeds(infoHash, urls); err != nil {
+		return nil, webseedError(err)
+	}
+	for _, u := range urls {
+		if err := s.webseedStore.SaveWebseedEdit(infoHash, u, false); err != nil {
+			log.Printf("警告: %v", err)
+		}
+	}
+	return s.ListWebseeds(infoHash)
+}
+
+// RemoveWebseeds 从种子中移除 web seed（包括种子文件和磁力链接自带的），重启后不会再加回
+func (s *TorrentService) RemoveWebseeds(infoHash string, urls []string) ([]string, error) {
+	if len(urls) == 0 {
+		return nil, validator.ValidationError{Field: "url", Message: "至少需要一个 web seed"}
+	}
+	if err := s.torrentClient.RemoveWebseeds(infoHash, urls); err != nil {
+		return nil, webseedError(err)
+	}
+	for _, u := range urls {
+		if err := s.webseedStore.SaveWebseedEdit(infoHash, u, true); err != nil {
+			log.Printf("警告: %v", err)
+		}
+	}
+	return s.ListWebseeds(infoHash)
+}
+
+// restoreWebseeds 恢复种子时重新应用用户对 web seed 的修改
+func (s *TorrentService) restoreWebseeds(infoHash string) {
+	edits, err := s.webseedStore.GetWebseedEdits(infoHash)
+	if err != nil {
+		log.Printf("警告: %v", err)
+		return
+	}
+	if err := s.torrentClient.AddWebseeds(infoHash, edits.Added); err != nil {
+		log.Printf("警告: 恢复 web seed 失败 %s: %v", infoHash, err)
+	}
+	if len(edits.Removed) > 0 {
+		if err := s.torrentClient.RemoveWebseeds(infoHash, edits.Removed); err != nil {
+			log.Printf("警告: 恢复已移除的 web seed 失败 %s: %v", infoHash, err)
+		}
+	}
+}
+
+// validateWebseedURLs 检查 web seed 地址，只接受 http(s)
+func validateWebseedURLs(urls []string) error {
+	if len(urls) == 0 {
+		return validator.ValidationError{Field: "urls", Message: "至少需要一个 web seed"}
+	}
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return validator.ValidationError{Field: "urls", Message: "web seed 必须为 http 或 https 地址: " + raw}
+		}
+	}
+	return nil
+}
+
+// webseedError 转换 torrent 客户端的错误
+func webseedError(err error) error {
+	if errors.Is(err, torrent.ErrTorrentNotFound) {
+		return ErrTorrentNotFound
+	}
+	return fmt.Errorf("修改 web seed 失败: %w", err)
+}
+
+// SetWatched 标记种子已看完或取消标记，供清理规则使用
+func (s *TorrentService) SetWatched(infoHash string, watched bool) error {
+	if _, _, ok := s.states.Get(infoHash); !ok {
+		return ErrTorrentNotFound
+	}
+	return s.torrentStore.SetWatched(infoHash, watched)
+}
+
+// ImportResult 单个种子的导入结果
+type ImportResult struct {
+	InfoHash string `json:"infoHash"`
+	Name     string `json:"name"`
+	Source   string `json:"source"`
+	SavePath string `json:"savePath"`
+	Status   string `json:"status"` // imported、exists、failed
+	Error    string `json:"error,omitempty"`
+}
+
+// ImportTorrents 导入其他客户端的种子，沿用原有数据目录并校验已有数据而不是重新下载
+// defaultSavePath 用于导出数据中没有保存路径的种子，为空时使用默认下载目录
+func (s *TorrentService) ImportTorrents(ctx context.Context, entries []importer.Entry, defaultSavePath string) []ImportResult {
+	results := make([]ImportResult, 0, len(entries))
+
+	for _, entry := range entries {
+		result := ImportResult{
+			InfoHash: entry.InfoHash,
+			Name:     entry.Name,
+			Source:   entry.Source,
+			SavePath: entry.SavePath,
+		}
+		if result.SavePath == "" {
+			result.SavePath = defaultSavePath
+		}
+
+		if _, exists := s.torrentClient.GetTorrent(entry.InfoHash); exists {
+			result.Status = "exists"
+			results = append(results, result)
+			continue
+		}
+
+		imported, err := s.torrentClient.ImportTorrent(torrent.ImportSource{
+			MetaInfo:  entry.MetaInfo,
+			MagnetURI: entry.MagnetURI,
+			DataPath:  result.SavePath,
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "导入种子失败", "info_hash", entry.InfoHash, "error", err)
+			result.Status = "failed"
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		if !imported.New {
+			result.Status = "exists"
+			results = append(results, result)
+			continue
+		}
+		if result.Name == "" {
+			result.Name = imported.Name
+		}
+
+		record := &db.TorrentRecord{
+			InfoHash:  imported.InfoHash,
+			Name:      result.Name,
+			MagnetURI: imported.MagnetURI,
+			DataPath:  imported.DataPath,
+			Private:   imported.Private,
+			AddedAt:   time.Now(),
+			State:     string(StateQueued),
+			AddedBy:   userIDFromContext(ctx),
+		}
+		if err := s.torrentStore.AddTorrent(record); err != nil {
+			slog.WarnContext(ctx, "保存导入的种子到数据库失败", "info_hash", imported.InfoHash, "error", err)
+		}
+
+		s.states.Track(imported.InfoHash, StateQueued, "")
+		s.metadataQueue.Enqueue(imported.InfoHash)
+
+		result.Status = "imported"
+		results = append(results, result)
+	}
+
+	return results
 }
 
 // ListFiles 获取种子文件列表
@@ -94,6 +692,122 @@ func (s *TorrentService) ListFiles(infoHash string) ([]torrent.FileInfo, error)
 	return s.torrentClient.ListFiles(infoHash)
 }
 
+// FileIndex 按路径查找种子中的文件，路径与 ListFiles 返回的 Path 相同
+func (s *TorrentService) FileIndex(infoHash, path string) (int, error) {
+	index, err := s.torrentClient.FileIndex(infoHash, path)
+	switch {
+	case errors.Is(err, torrent.ErrTorrentNotFound):
+		return -1, ErrTorrentNotFound
+	case errors.Is(err, torrent.ErrMetadataIncomplete):
+		return -1, ErrMetadataPending
+	case errors.Is(err, torrent.ErrFileNotFound):
+		return -1, ErrFileNotFound
+	case err != nil:
+		return -1, err
+	}
+	return index, nil
+}
+
+// OpenFile 打开种子中的一个文件用于流式读取，读取时优先下载读取位置之后的分片，调用方负责关闭
+func (s *TorrentService) OpenFile(infoHash string, fileIndex int) (torrent.FileReader, *torrent.FileInfo, error) {
+	return s.openFile(infoHash, fileIndex, s.fileRuntime(infoHash, fileIndex))
+}
+
+// openFile 打开文件，runtime 为文件的片长，用于确定预读大小
+func (s *TorrentService) openFile(infoHash string, fileIndex int, runtime time.Duration) (torrent.FileReader, *torrent.FileInfo, error) {
+	reader, file, err := s.torrentClient.OpenFile(infoHash, fileIndex, runtime)
+	switch {
+	case errors.Is(err, torrent.ErrTorrentNotFound):
+		return nil, nil, ErrTorrentNotFound
+	case errors.Is(err, torrent.ErrMetadataIncomplete):
+		return nil, nil, ErrMetadataPending
+	case errors.Is(err, torrent.ErrFileNotFound):
+		return nil, nil, ErrFileNotFound
+	case err != nil:
+		return nil, nil, err
+	}
+	return reader, file, nil
+}
+
+// FileBuffer 文件从 offset 起已连续下载的字节数和种子当前的下载速度，供播放器显示缓冲状态
+func (s *TorrentService) FileBuffer(infoHash string, fileIndex int, offset int64) (*torrent.BufferInfo, error) {
+	buffer, err := s.torrentClient.FileBuffer(infoHash, fileIndex, offset)
+	switch {
+	case errors.Is(err, torrent.ErrTorrentNotFound):
+		return nil, ErrTorrentNotFound
+	case errors.Is(err, torrent.ErrMetadataIncomplete):
+		return nil, ErrMetadataPending
+	case errors.Is(err, torrent.ErrFileNotFound):
+		return nil, ErrFileNotFound
+	case errors.Is(err, torrent.ErrOffsetOutOfRange):
+		return nil, validator.ValidationError{Field: "offset", Message: "超出文件大小"}
+	case err != nil:
+		return nil, err
+	}
+	return buffer, nil
+}
+
+// fileRuntime 文件的片长，用于估算码率以确定预读大小：剧集使用匹配到的单集时长，电影使用电影时长；未知时返回 0
+func (s *TorrentService) fileRuntime(infoHash string, fileIndex int) time.Duration {
+	if episodes, err := s.episodeStore.ListEpisodes(infoHash); err == nil {
+		for _, episode := range episodes {
+			if episode.FileIndex == fileIndex && episode.Runtime > 0 {
+				return time.Duration(episode.Runtime) * time.Minute
+			}
+		}
+	}
+	record, err := s.torrentStore.GetTorrent(infoHash)
+	if err != nil || record == nil || record.MovieDetails == nil || record.MovieDetails.MediaType == "tv" {
+		return 0
+	}
+	return time.Duration(record.MovieDetails.Runtime) * time.Minute
+}
+
+// OpenStream 打开文件并登记为播放会话，关闭读取器时会话结束，为预读提高的分片优先级也随之恢复
+// 同时播放的会话数超过上限时返回 ErrTooManyStreams；读取速度受会话限速限制
+func (s *TorrentService) OpenStream(client StreamClient, infoHash string, fileIndex int) (torrent.FileReader, *torrent.FileInfo, error) {
+	runtime := s.fileRuntime(infoHash, fileIndex)
+	reader, file, err := s.openFile(infoHash, fileIndex, runtime)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := s.streams.open(client, file, runtime)
+	if err != nil {
+		reader.Close()
+		return nil, nil, err
+	}
+	return &trackedReader{FileReader: reader, sessions: s.streams, key: key, limiter: s.streams.limiter(key)}, file, nil
+}
+
+// Sessions 当前的播放会话
+func (s *TorrentService) Sessions() *StreamSessions {
+	return s.streams
+}
+
+// SelectFiles 按文件索引选择种子中的文件，fileIndexes 为空时选择全部文件
+func (s *TorrentService) SelectFiles(infoHash string, fileIndexes []int) (*torrent.TorrentInfo, []torrent.FileInfo, error) {
+	info, err := s.GetTorrent(infoHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 获取元数据后种子至少有一个文件
+	if len(info.Files) == 0 {
+		return nil, nil, ErrMetadataPending
+	}
+	if len(fileIndexes) == 0 {
+		return info, info.Files, nil
+	}
+
+	files := make([]torrent.FileInfo, 0, len(fileIndexes))
+	for _, index := range fileIndexes {
+		if index < 0 || index >= len(info.Files) {
+			return nil, nil, fmt.Errorf("%w: %d", ErrFileNotFound, index)
+		}
+		files = append(files, info.Files[index])
+	}
+	return info, files, nil
+}
+
 // UpdateMovieDetails 更新电影详情
 func (s *TorrentService) UpdateMovieDetails(infoHash string, movieDetails *db.MovieDetails) error {
 	if infoHash == "" {
@@ -122,12 +836,43 @@ func (s *TorrentService) UpdateMovieDetails(infoHash string, movieDetails *db.Mo
 		return fmt.Errorf("更新电影详情失败: %w", err)
 	}
 
+	s.detailsSaved(infoHash, movieDetails)
 	return nil
 }
 
-// GetMovieDetails 获取所有电影详情
-func (s *TorrentService) GetMovieDetails() ([]*db.TorrentRecord, error) {
-	return s.torrentStore.GetAllTorrents()
+// detailsSaved 在种子的详情保存后更新合集并整理媒体库
+func (s *TorrentService) detailsSaved(infoHash string, details *db.MovieDetails) {
+	// 详情中的合集同时记录到合集表，剧集和不属于合集的电影从原合集中移除
+	if err := s.collections.SetTorrentCollection(infoHash, details.Collection); err != nil {
+		log.Printf("警告: %v", err)
+	}
+
+	// 已下载完成的种子立即整理到媒体库，修改影片信息后链接移动到新路径
+	s.organizer.Queue(infoHash)
+}
+
+// TorrentOwner 返回添加种子的用户ID，种子不存在时 ok 为 false
+func (s *TorrentService) TorrentOwner(infoHash string) (addedBy int64, ok bool) {
+	record, err := s.torrentStore.GetTorrent(infoHash)
+	if err != nil || record == nil {
+		return 0, false
+	}
+	return record.AddedBy, true
+}
+
+// GetMovieDetails 获取符合过滤条件的电影详情
+func (s *TorrentService) GetMovieDetails(filter TorrentFilter) ([]*db.TorrentRecord, error) {
+	records, err := s.torrentStore.GetAllTorrents()
+	if err != nil {
+		return nil, err
+	}
+	matched := records[:0]
+	for _, record := range records {
+		if filter.Match(record.Category, record.Tags) {
+			matched = append(matched, record)
+		}
+	}
+	return matched, nil
 }
 
 // SaveTorrentData 保存种子数据
@@ -140,41 +885,98 @@ func (s *TorrentService) SaveTorrentData(infoHash string, torrentData *TorrentUp
 		return fmt.Errorf("种子数据不能为空")
 	}
 
-	// 构建更新记录
-	record := &db.TorrentRecord{
-		InfoHash:   infoHash,
-		Name:       torrentData.Name,
-		Length:     torrentData.Length,
-		Files:      torrentData.Files,
-		Downloaded: torrentData.Downloaded,
-		Progress:   torrentData.Progress,
-		State:      torrentData.State,
-		MagnetURI:  torrentData.InfoHash, // 这里可能需要修正
-		AddedAt:    torrentData.AddedAt,
+	// 只更新前端提供的字段：磁力链接和导入种子的数据目录前端不会回传，
+	// 状态由状态机维护，不使用前端回传的值
+	var update db.TorrentUpdate
+	if torrentData.Name != "" {
+		update.Name = &torrentData.Name
+	}
+	if torrentData.Length > 0 {
+		update.Length = &torrentData.Length
+	}
+	if len(torrentData.Files) > 0 {
+		update.Files = torrentData.Files
+	}
+	if !torrentData.AddedAt.IsZero() {
+		update.AddedAt = &torrentData.AddedAt
+	}
+	// 进度只在请求带有时保存，两项都有时使用专用的进度查询
+	withProgress := torrentData.Downloaded != nil && torrentData.Progress != nil
+	if !withProgress {
+		update.Downloaded = torrentData.Downloaded
+		update.Progress = torrentData.Progress
 	}
 
 	// 更新到数据库
-	if err := s.torrentStore.UpdateTorrent(record); err != nil {
+	if err := s.torrentStore.UpdateTorrent(infoHash, update); err != nil {
 		return fmt.Errorf("保存种子数据失败: %w", err)
 	}
+	if withProgress {
+		if err := s.torrentStore.UpdateProgress(infoHash, *torrentData.Downloaded, *torrentData.Progress); err != nil {
+			return fmt.Errorf("保存种子进度失败: %w", err)
+		}
+	}
 
 	return nil
 }
 
-// DeleteTorrent 删除种子
-func (s *TorrentService) DeleteTorrent(infoHash string) error {
+// DeleteTorrent 删除种子，deleteData 为 false 时已下载的数据保留在磁盘上
+// 启用回收站时种子先暂停并移入回收站，permanent 为 true 时跳过回收站直接删除
+func (s *TorrentService) DeleteTorrent(infoHash string, deleteData, permanent bool) error {
 	if infoHash == "" {
 		return fmt.Errorf("InfoHash不能为空")
 	}
+	if _, _, ok := s.states.Get(infoHash); !ok {
+		return ErrTorrentNotFound
+	}
 
-	// 从数据库删除
-	if err := s.torrentStore.DeleteTorrent(infoHash); err != nil {
-		return fmt.Errorf("删除种子记录失败: %w", err)
+	// 启用回收站时先移入回收站，数据保留到清除时再删除
+	if !permanent && s.config.Retention.TrashDays > 0 {
+		return s.trashTorrent(infoHash, deleteData)
+	}
+	return s.removeTorrent(infoHash, "用户删除", deleteData)
+}
+
+// removeTorrent 从 torrent 客户端和数据库中移除种子并发布事件，deleteData 为 true 时同时删除已下载的数据
+func (s *TorrentService) removeTorrent(infoHash, reason string, deleteData bool) error {
+	s.metadataQueue.Cancel(infoHash)
+	if err := s.torrentClient.RemoveTorrent(infoHash, deleteData); err != nil && !errors.Is(err, torrent.ErrTorrentNotFound) {
+		return fmt.Errorf("移除种子失败: %w", err)
 	}
 
-	// TODO: 从torrent客户端删除
-	// s.torrentClient.RemoveTorrent(infoHash)
+	if err := s.deleteRecords(infoHash); err != nil {
+		return err
+	}
+	s.states.Forget(infoHash)
+	s.labels.forget(infoHash)
 
+	s.bus.Publish(events.TorrentRemoved, infoHash, map[string]interface{}{
+		"reason":      reason,
+		"dataDeleted": deleteData,
+	})
+	return nil
+}
+
+// deleteRecords 从数据库删除种子及其做种统计、tracker 和 web seed 修改、连接数设置和剧集信息
+func (s *TorrentService) deleteRecords(infoHash string) error {
+	if err := s.torrentStore.DeleteTorrent(infoHash); err != nil {
+		return fmt.Errorf("删除种子记录失败: %w", err)
+	}
+	s.seeding.Forget(infoHash)
+	s.postProcess.Forget(infoHash)
+	s.organizer.Forget(infoHash)
+	if err := s.trackerStore.DeleteTrackerEdits(infoHash); err != nil {
+		log.Printf("警告: %v", err)
+	}
+	if err := s.webseedStore.DeleteWebseedEdits(infoHash); err != nil {
+		log.Printf("警告: %v", err)
+	}
+	if err := s.connStore.DeleteConnections(infoHash); err != nil {
+		log.Printf("警告: %v", err)
+	}
+	if err := s.episodeStore.DeleteTorrentEpisodes(infoHash); err != nil {
+		log.Printf("警告: %v", err)
+	}
 	return nil
 }
 
@@ -191,15 +993,7 @@ func (s *TorrentService) RestoreTorrentsFromDB() error {
 	for _, t := range torrents {
 		if t.MagnetURI != "" {
 			log.Printf("正在恢复种子: %s, %s", t.Name, t.InfoHash)
-			
-			// 构建完整的磁力链接
-			magnetURI := t.MagnetURI
-			if !containsString(magnetURI, "magnet:?") {
-				magnetURI = "magnet:?xt=urn:btih:" + t.InfoHash
-			}
-			
-			_, err := s.torrentClient.AddMagnet(magnetURI)
-			if err != nil {
+			if err := s.restoreTorrent(t); err != nil {
 				log.Printf("恢复种子失败 %s: %v", t.InfoHash, err)
 				continue
 			}
@@ -211,14 +1005,64 @@ func (s *TorrentService) RestoreTorrentsFromDB() error {
 	return nil
 }
 
+// restoreTorrent 把数据库中的种子重新添加到torrent客户端，并恢复其 tracker、web seed、连接数、分类标签和状态
+func (s *TorrentService) restoreTorrent(t *db.TorrentRecord) error {
+	// 构建完整的磁力链接
+	magnetURI := t.MagnetURI
+	if !containsString(magnetURI, "magnet:?") {
+		magnetURI = "magnet:?xt=urn:btih:" + t.InfoHash
+	}
+
+	// 使用保存的元数据恢复，无需等待 DHT 和 peer，已完成的 piece 也不会重新下载
+	infoBytes, err := s.torrentStore.GetInfoBytes(t.InfoHash)
+	if err != nil {
+		log.Printf("警告: %v", err)
+	}
+	if t.DataPath != "" {
+		// 导入的种子保存在原客户端的数据目录中
+		_, err = s.torrentClient.ImportTorrent(torrent.ImportSource{
+			MagnetURI: magnetURI,
+			DataPath:  t.DataPath,
+			Private:   t.Private,
+			InfoBytes: infoBytes,
+		})
+	} else {
+		_, err = s.torrentClient.RestoreMagnet(magnetURI, infoBytes, t.Private)
+	}
+	if err != nil {
+		return err
+	}
+	s.restoreTrackers(t.InfoHash)
+	s.restoreWebseeds(t.InfoHash)
+	s.restoreConnections(t.InfoHash)
+	s.labels.set(t.InfoHash, Labels{Category: t.Category, Tags: t.Tags})
+
+	// 暂停的种子保持暂停，其余种子重新排队由后台队列获取元数据
+	if TorrentState(t.State) == StatePaused {
+		if err := s.torrentClient.Pause(t.InfoHash); err != nil {
+			log.Printf("恢复暂停状态失败 %s: %v", t.InfoHash, err)
+		}
+		s.states.Track(t.InfoHash, StatePaused, t.StateReason)
+		s.states.setLastError(t.InfoHash, t.LastError)
+	} else {
+		s.states.Track(t.InfoHash, StateQueued, "")
+		s.states.setLastError(t.InfoHash, t.LastError)
+		if err := s.torrentStore.UpdateState(t.InfoHash, string(StateQueued), ""); err != nil {
+			log.Printf("警告: 保存种子状态失败 %s: %v", t.InfoHash, err)
+		}
+		s.metadataQueue.Enqueue(t.InfoHash)
+	}
+	return nil
+}
+
 // TorrentUpdateData 种子更新数据结构
 type TorrentUpdateData struct {
 	InfoHash   string            `json:"infoHash"`
 	Name       string            `json:"name"`
 	Length     int64             `json:"length"`
 	Files      []db.FileInfo     `json:"files"`
-	Downloaded int64             `json:"downloaded"`
-	Progress   float32           `json:"progress"`
+	Downloaded *int64            `json:"downloaded,omitempty"` // nil 时保留已保存的进度
+	Progress   *float32          `json:"progress,omitempty"`
 	State      string            `json:"state"`
 	AddedAt    time.Time         `json:"addedAt"`
 }
@@ -0,0 +1,34 @@
+package service
+
+import "testing"
+
+// TestSaveTorrentDataProgress 保存种子数据时只在请求带有进度时更新进度
+func TestSaveTorrentDataProgress(t *testing.T) {
+	service, store := newTestTorrentService(t)
+	if err := store.UpdateProgress("abc", 21, 0.5); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.SaveTorrentData("abc", &TorrentUpdateData{InfoHash: "abc", Name: "movie 2020"}); err != nil {
+		t.Fatal(err)
+	}
+	record, err := store.GetTorrent("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Name != "movie 2020" || record.Downloaded != 21 || record.Progress != 0.5 {
+		t.Errorf("不带进度保存后：名称 %q，已下载 %d，进度 %v，应保留已保存的进度", record.Name, record.Downloaded, record.Progress)
+	}
+
+	downloaded, progress := int64(42), float32(1)
+	if err := service.SaveTorrentData("abc", &TorrentUpdateData{InfoHash: "abc", Downloaded: &downloaded, Progress: &progress}); err != nil {
+		t.Fatal(err)
+	}
+	record, err = store.GetTorrent("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Name != "movie 2020" || record.Downloaded != 42 || record.Progress != 1 {
+		t.Errorf("带进度保存后：名称 %q，已下载 %d，进度 %v", record.Name, record.Downloaded, record.Progress)
+	}
+}
@@ -0,0 +1,309 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/events"
+	"github.com/torrentplayer/backend/torrent"
+)
+
+// TorrentState 种子生命周期状态
+type TorrentState string
+
+// 种子状态
+const (
+	StateQueued           TorrentState = "queued"
+	StateFetchingMetadata TorrentState = "fetching-metadata"
+	StateDownloading      TorrentState = "downloading"
+	StateStalled          TorrentState = "stalled"
+	StateCompleted        TorrentState = "completed"
+	StateSeeding          TorrentState = "seeding"
+	StatePaused           TorrentState = "paused"
+	StateError            TorrentState = "error"
+)
+
+// stateReconcileInterval 根据传输情况刷新 downloading/stalled/completed/seeding 的间隔
+const stateReconcileInterval = 5 * time.Second
+
+// stateTransitions 允许的状态转换
+var stateTransitions = map[TorrentState][]TorrentState{
+	StateQueued:           {StateFetchingMetadata, StatePaused, StateError},
+	StateFetchingMetadata: {StateQueued, StateDownloading, StatePaused, StateError},
+	StateDownloading:      {StateStalled, StateCompleted, StateSeeding, StatePaused, StateError},
+	StateStalled:          {StateDownloading, StateCompleted, StateSeeding, StatePaused, StateError},
+	StateCompleted:        {StateSeeding, StateDownloading, StatePaused, StateError},
+	StateSeeding:          {StateCompleted, StateDownloading, StatePaused, StateError},
+	StatePaused:           {StateQueued, StateDownloading, StateStalled, StateCompleted, StateSeeding},
+	StateError:            {StateQueued, StatePaused},
+}
+
+// CanTransitionTo 判断是否允许从当前状态转换到 next
+func (s TorrentState) CanTransitionTo(next TorrentState) bool {
+	for _, allowed := range stateTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid 判断是否为已知状态
+func (s TorrentState) Valid() bool {
+	_, ok := stateTransitions[s]
+	return ok
+}
+
+// InvalidTransitionError 不允许的状态转换
+type InvalidTransitionError struct {
+	From TorrentState
+	To   TorrentState
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("种子状态不能从 %s 变为 %s", e.From, e.To)
+}
+
+// StateChange 状态变化事件数据
+type StateChange struct {
+	From   TorrentState `json:"from"`
+	To     TorrentState `json:"to"`
+	Reason string       `json:"reason,omitempty"`
+}
+
+// stateEntry 单个种子的当前状态
+type stateEntry struct {
+	state  TorrentState
+	reason string
+	since  time.Time
+	// downloaded 最近一次写入数据库的已下载字节数
+	downloaded int64
+	// lastError 最近一次操作失败的原因，种子恢复后仍然保留
+	lastError string
+}
+
+// StateMachine 种子状态机，是种子状态的唯一来源
+// 状态转换会写入数据库并发布 torrent.state 事件；下载完成由 torrent 客户端的完成通知立即触发，
+// 见 HandleCompletion，downloading、stalled、seeding 之间的切换由定期对比传输情况完成
+type StateMachine struct {
+	torrentClient *torrent.Client
+	torrentStore  *db.TorrentStore
+	bus           *events.Bus
+
+	mu     sync.Mutex
+	states map[string]*stateEntry
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewStateMachine 创建种子状态机
+func NewStateMachine(client *torrent.Client, store *db.TorrentStore, bus *events.Bus) *StateMachine {
+	return &StateMachine{
+		torrentClient: client,
+		torrentStore:  store,
+		bus:           bus,
+		states:        make(map[string]*stateEntry),
+		stop:          make(chan struct{}),
+	}
+}
+
+// Start 启动后台状态同步
+func (m *StateMachine) Start() {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(stateReconcileInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.Reconcile()
+			}
+		}
+	}()
+}
+
+// Stop 停止后台状态同步
+func (m *StateMachine) Stop() {
+	close(m.stop)
+	m.wg.Wait()
+}
+
+// Track 开始跟踪种子并设置初始状态，不做转换校验也不发布事件
+func (m *StateMachine) Track(infoHash string, state TorrentState, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.states[infoHash] = &stateEntry{state: state, reason: reason, since: time.Now()}
+}
+
+// Forget 停止跟踪种子
+func (m *StateMachine) Forget(infoHash string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.states, infoHash)
+}
+
+// Snapshot 获取所有种子的当前状态
+func (m *StateMachine) Snapshot() map[string]TorrentState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make(map[string]TorrentState, len(m.states))
+	for infoHash, entry := range m.states {
+		snapshot[infoHash] = entry.state
+	}
+	return snapshot
+}
+
+// Get 获取种子的当前状态和最近一次转换的原因
+func (m *StateMachine) Get(infoHash string) (TorrentState, string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.states[infoHash]
+	if !ok {
+		return "", "", false
+	}
+	return entry.state, entry.reason, true
+}
+
+// LastError 获取种子最近一次操作失败的原因
+func (m *StateMachine) LastError(infoHash string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.states[infoHash]; ok {
+		return entry.lastError
+	}
+	return ""
+}
+
+// setLastError 恢复数据库中保存的最近错误，种子未被跟踪时忽略
+func (m *StateMachine) setLastError(infoHash, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.states[infoHash]; ok {
+		entry.lastError = message
+	}
+}
+
+// Transition 将种子转换到新状态，不允许的转换返回 *InvalidTransitionError
+func (m *StateMachine) Transition(infoHash string, to TorrentState, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.states[infoHash]
+	if !ok {
+		return ErrTorrentNotFound
+	}
+	return m.transitionLocked(infoHash, entry, to, reason)
+}
+
+// TransitionFrom 仅当种子当前处于 from 状态时才转换，用于后台任务避免覆盖用户操作（例如暂停）
+func (m *StateMachine) TransitionFrom(infoHash string, from, to TorrentState, reason string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.states[infoHash]
+	if !ok || entry.state != from {
+		return false, nil
+	}
+	if err := m.transitionLocked(infoHash, entry, to, reason); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// transitionLocked 执行状态转换，调用方需持有 m.mu，保证数据库与事件顺序一致
+func (m *StateMachine) transitionLocked(infoHash string, entry *stateEntry, to TorrentState, reason string) error {
+	from := entry.state
+	if from == to {
+		return nil
+	}
+	if !from.CanTransitionTo(to) {
+		return &InvalidTransitionError{From: from, To: to}
+	}
+
+	entry.state = to
+	entry.reason = reason
+	entry.since = time.Now()
+
+	if err := m.torrentStore.UpdateState(infoHash, string(to), reason); err != nil {
+		log.Printf("警告: 保存种子状态失败 %s: %v", infoHash, err)
+	}
+
+	m.bus.Publish(events.TorrentStateChanged, infoHash, StateChange{From: from, To: to, Reason: reason})
+	return nil
+}
+
+// Reconcile 根据 torrent 客户端的传输情况更新已获取元数据的种子状态，并批量保存下载进度
+func (m *StateMachine) Reconcile() {
+	m.mu.Lock()
+	hashes := make([]string, 0, len(m.states))
+	for infoHash, entry := range m.states {
+		switch entry.state {
+		case StateDownloading, StateStalled, StateCompleted, StateSeeding:
+			hashes = append(hashes, infoHash)
+		}
+	}
+	m.mu.Unlock()
+
+	var progress []db.ProgressUpdate
+	for _, infoHash := range hashes {
+		activity, ok := m.torrentClient.Activity(infoHash)
+		if !ok || !activity.HasInfo || activity.Paused {
+			continue
+		}
+
+		m.mu.Lock()
+		entry, ok := m.states[infoHash]
+		if ok {
+			switch entry.state {
+			case StateDownloading, StateStalled, StateCompleted, StateSeeding:
+				if err := m.transitionLocked(infoHash, entry, observedState(activity), ""); err != nil {
+					log.Printf("警告: 同步种子状态失败 %s: %v", infoHash, err)
+				}
+			}
+			// 只保存有变化的进度，已完成的种子不会每次都写入
+			if activity.Downloaded != entry.downloaded && activity.Length > 0 {
+				entry.downloaded = activity.Downloaded
+				progress = append(progress, db.ProgressUpdate{
+					InfoHash:   infoHash,
+					Downloaded: activity.Downloaded,
+					Progress:   float32(activity.Downloaded) / float32(activity.Length),
+				})
+			}
+		}
+		m.mu.Unlock()
+	}
+
+	// 所有种子的进度在一个事务中写入
+	if err := m.torrentStore.UpdateProgressBatch(progress); err != nil {
+		log.Printf("警告: 保存下载进度失败: %v", err)
+	}
+}
+
+// observedState 根据传输情况推断已获取元数据的种子应处的状态
+func observedState(a torrent.Activity) TorrentState {
+	switch {
+	case a.Complete && a.Seeding:
+		return StateSeeding
+	case a.Complete:
+		return StateCompleted
+	case a.ActivePeers == 0:
+		return StateStalled
+	default:
+		return StateDownloading
+	}
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/torrentplayer/backend/torrent"
+)
+
+func TestStateTransitions(t *testing.T) {
+	cases := []struct {
+		from, to TorrentState
+		allowed  bool
+	}{
+		{StateQueued, StateFetchingMetadata, true},
+		{StateFetchingMetadata, StateDownloading, true},
+		{StateFetchingMetadata, StateQueued, true},
+		{StateDownloading, StateStalled, true},
+		{StateCompleted, StateSeeding, true},
+		{StatePaused, StateQueued, true},
+		{StateError, StateQueued, true},
+		{StateQueued, StateDownloading, false},
+		{StateError, StateDownloading, false},
+		{StatePaused, StateFetchingMetadata, false},
+		{StateSeeding, StateFetchingMetadata, false},
+	}
+
+	for _, c := range cases {
+		if got := c.from.CanTransitionTo(c.to); got != c.allowed {
+			t.Errorf("%s -> %s: got %v, want %v", c.from, c.to, got, c.allowed)
+		}
+	}
+}
+
+func TestTransitionTargetsKnown(t *testing.T) {
+	for from, targets := range stateTransitions {
+		for _, to := range targets {
+			if !to.Valid() {
+				t.Errorf("%s -> %s: unknown target state", from, to)
+			}
+		}
+	}
+}
+
+func TestObservedState(t *testing.T) {
+	cases := []struct {
+		activity torrent.Activity
+		want     TorrentState
+	}{
+		{torrent.Activity{HasInfo: true, ActivePeers: 3}, StateDownloading},
+		{torrent.Activity{HasInfo: true}, StateStalled},
+		{torrent.Activity{HasInfo: true, Complete: true}, StateCompleted},
+		{torrent.Activity{HasInfo: true, Complete: true, Seeding: true}, StateSeeding},
+	}
+
+	for _, c := range cases {
+		if got := observedState(c.activity); got != c.want {
+			t.Errorf("observedState(%+v) = %s, want %s", c.activity, got, c.want)
+		}
+	}
+}
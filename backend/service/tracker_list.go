@@ -0,0 +1,175 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/torrentplayer/backend/config"
+	"github.com/torrentplayer/backend/torrent"
+)
+
+// trackerListFetchTimeout 拉取 tracker 列表的超时时间
+const trackerListFetchTimeout = 30 * time.Second
+
+// trackerListMaxSize tracker 列表的最大字节数
+const trackerListMaxSize = 1 << 20
+
+// TrackerListUpdater 维护添加到公开磁力链接的 tracker：使用配置中的列表，
+// 并在设置了 TORRENT_TRACKERS_URL 时定期拉取列表（如 ngosang/trackerslist）追加到后面。
+// 只影响之后添加的种子，已有种子保留添加时的 tracker。
+type TrackerListUpdater struct {
+	torrentClient *torrent.Client
+	listURL       string
+	interval      time.Duration
+	httpClient    *http.Client
+
+	mu         sync.Mutex
+	configured []string
+	fetched    []string // 最近一次拉取到的列表
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewTrackerListUpdater 创建 tracker 列表更新器，并立即应用配置中的列表
+func NewTrackerListUpdater(client *torrent.Client, cfg *config.Config) *TrackerListUpdater {
+	ctx, cancel := context.WithCancel(context.Background())
+	u := &TrackerListUpdater{
+		torrentClient: client,
+		configured:    cfg.Torrent.PublicTrackers,
+		listURL:       cfg.Torrent.TrackersListURL,
+		interval:      time.Duration(cfg.Torrent.TrackersRefreshHours) * time.Hour,
+		httpClient:    &http.Client{Timeout: trackerListFetchTimeout},
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+	client.SetPublicTrackers(u.configured)
+	return u
+}
+
+// Start 设置了列表地址时启动后台拉取，启动后立即拉取一次
+func (u *TrackerListUpdater) Start() {
+	if u.listURL == "" {
+		return
+	}
+
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+
+		ticker := time.NewTicker(u.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := u.Refresh(); err != nil {
+				log.Printf("警告: 更新tracker列表失败: %v", err)
+			}
+
+			select {
+			case <-u.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop 停止后台拉取
+func (u *TrackerListUpdater) Stop() {
+	u.cancel()
+	u.wg.Wait()
+}
+
+// Refresh 拉取 tracker 列表并与配置中的列表合并，拉取失败时保留当前列表
+func (u *TrackerListUpdater) Refresh() error {
+	fetched, err := u.fetch()
+	if err != nil {
+		return err
+	}
+	if len(fetched) == 0 {
+		return fmt.Errorf("tracker列表为空")
+	}
+
+	u.mu.Lock()
+	u.fetched = fetched
+	trackers := mergeTrackers(u.configured, fetched)
+	u.torrentClient.SetPublicTrackers(trackers)
+	u.mu.Unlock()
+	log.Printf("tracker列表已更新: 共 %d 个", len(trackers))
+	return nil
+}
+
+// SetConfigured 替换配置的 tracker 列表，与最近一次拉取到的列表合并后立即生效
+func (u *TrackerListUpdater) SetConfigured(trackers []string) error {
+	// 列表可以为空，此时只使用拉取到的列表
+	if len(trackers) > 0 {
+		if err := validateTrackerURLs(trackers); err != nil {
+			return err
+		}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.configured = append([]string{}, trackers...)
+	u.torrentClient.SetPublicTrackers(mergeTrackers(u.configured, u.fetched))
+	return nil
+}
+
+// fetch 下载 tracker 列表，每行一个地址，忽略空行、注释和无效地址
+func (u *TrackerListUpdater) fetch() ([]string, error) {
+	req, err := http.NewRequestWithContext(u.ctx, http.MethodGet, u.listURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("请求失败: HTTP %d", resp.StatusCode)
+	}
+
+	var trackers []string
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, trackerListMaxSize))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := validateTrackerURLs([]string{line}); err != nil {
+			continue
+		}
+		trackers = append(trackers, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取tracker列表失败: %w", err)
+	}
+
+	return trackers, nil
+}
+
+// mergeTrackers 合并多个 tracker 列表，保持顺序并去重
+func mergeTrackers(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, list := range lists {
+		for _, tracker := range list {
+			if !seen[tracker] {
+				seen[tracker] = true
+				merged = append(merged, tracker)
+			}
+		}
+	}
+	return merged
+}
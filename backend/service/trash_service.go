@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/torrentplayer/backend/db"
+	"github.com/torrentplayer/backend/events"
+	"github.com/torrentplayer/backend/torrent"
+)
+
+// TrashedTorrent 回收站中的种子，PurgeAt 之后被自动清除
+type TrashedTorrent struct {
+	db.TrashRecord
+	PurgeAt time.Time `json:"purgeAt"`
+}
+
+// TrashService 回收站：用户删除的种子暂停并隐藏，保留 N 天后连同数据清除，期间可以恢复
+type TrashService struct {
+	torrents        *TorrentService
+	torrentStore    *db.TorrentStore
+	days            int
+	intervalMinutes int
+
+	// mu 避免恢复与清除同一个种子同时执行
+	mu   sync.Mutex
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewTrashService 创建回收站服务
+func NewTrashService(torrents *TorrentService, store *db.TorrentStore) *TrashService {
+	return &TrashService{
+		torrents:        torrents,
+		torrentStore:    store,
+		days:            torrents.config.Retention.TrashDays,
+		intervalMinutes: torrents.config.Retention.IntervalMinutes,
+		stop:            make(chan struct{}),
+	}
+}
+
+// Start 启动后台清除过期的种子；未启用回收站时也会清除之前留下的种子
+func (s *TrashService) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(time.Duration(s.intervalMinutes) * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if purged, err := s.purgeExpired(time.Now()); err != nil {
+					log.Printf("清除回收站失败: %v", err)
+				} else if purged > 0 {
+					log.Printf("已清除回收站中过期的 %d 个种子", purged)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止后台清除
+func (s *TrashService) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// List 列出回收站中的种子，最近删除的在前
+func (s *TrashService) List() ([]TrashedTorrent, error) {
+	records, err := s.torrentStore.ListTrash()
+	if err != nil {
+		return nil, err
+	}
+
+	trashed := make([]TrashedTorrent, 0, len(records))
+	for _, record := range records {
+		trashed = append(trashed, TrashedTorrent{
+			TrashRecord: record,
+			PurgeAt:     s.purgeAt(record.DeletedAt),
+		})
+	}
+	return trashed, nil
+}
+
+// Restore 把种子从回收站恢复到删除前的状态，已下载的数据无需重新下载
+func (s *TrashService) Restore(infoHash string) (*torrent.TorrentInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts := s.torrents
+	trashed, err := s.torrentStore.GetTrashRecord(infoHash)
+	if err != nil {
+		return nil, err
+	}
+	if trashed == nil {
+		return nil, ErrTorrentNotFound
+	}
+	record, err := s.torrentStore.GetTorrent(infoHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ts.restoreTorrent(record); err != nil {
+		return nil, fmt.Errorf("恢复种子失败: %w", err)
+	}
+	if _, err := s.torrentStore.UntrashTorrent(infoHash); err != nil {
+		// 数据库仍记录在回收站中，撤销客户端中的恢复
+		ts.metadataQueue.Cancel(infoHash)
+		ts.torrentClient.RemoveTorrent(infoHash, false)
+		ts.states.Forget(infoHash)
+		ts.labels.forget(infoHash)
+		return nil, err
+	}
+
+	info, err := ts.GetTorrent(infoHash)
+	if err != nil {
+		return nil, err
+	}
+	ts.bus.Publish(events.TorrentAdded, infoHash, info)
+	return info, nil
+}
+
+// Purge 立即清除回收站中的种子，删除时选择了删除数据的种子同时删除已下载的数据
+func (s *TrashService) Purge(infoHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.torrentStore.GetTrashRecord(infoHash)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return ErrTorrentNotFound
+	}
+	return s.purge(record)
+}
+
+// Empty 清空回收站，返回清除的种子数
+func (s *TrashService) Empty() (int, error) {
+	return s.purgeWhere(func(db.TrashRecord) bool { return true })
+}
+
+// purgeExpired 清除保留期已过的种子
+func (s *TrashService) purgeExpired(now time.Time) (int, error) {
+	return s.purgeWhere(func(record db.TrashRecord) bool {
+		return !now.Before(s.purgeAt(record.DeletedAt))
+	})
+}
+
+// purgeWhere 清除回收站中满足条件的种子，单个种子失败时继续清除其余种子
+func (s *TrashService) purgeWhere(match func(db.TrashRecord) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.torrentStore.ListTrash()
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	var errs []error
+	for i := range records {
+		if !match(records[i]) {
+			continue
+		}
+		if err := s.purge(&records[i]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", records[i].InfoHash, err))
+			continue
+		}
+		purged++
+	}
+	return purged, errors.Join(errs...)
+}
+
+// purge 删除种子的数据（如果删除时选择了）和数据库记录，调用方需持有 s.mu
+func (s *TrashService) purge(record *db.TrashRecord) error {
+	if record.DeleteData {
+		info, err := s.torrentStore.GetInfoBytes(record.InfoHash)
+		if err != nil {
+			return err
+		}
+		// 没有元数据的种子还没有下载任何数据
+		if info != nil {
+			if err := s.torrents.torrentClient.RemoveData(info, record.DataPath); err != nil {
+				return fmt.Errorf("删除种子数据失败: %w", err)
+			}
+		}
+	}
+	return s.torrents.deleteRecords(record.InfoHash)
+}
+
+// purgeAt 返回在 deletedAt 删除的种子被自动清除的时间
+func (s *TrashService) purgeAt(deletedAt time.Time) time.Time {
+	return deletedAt.AddDate(0, 0, s.days)
+}
+
+// trashTorrent 暂停种子并移入回收站：从客户端移除但保留数据和数据库记录
+func (s *TorrentService) trashTorrent(infoHash string, deleteData bool) error {
+	s.metadataQueue.Cancel(infoHash)
+	if err := s.torrentClient.RemoveTorrent(infoHash, false); err != nil && !errors.Is(err, torrent.ErrTorrentNotFound) {
+		return fmt.Errorf("移除种子失败: %w", err)
+	}
+
+	if err := s.torrentStore.TrashTorrent(infoHash, deleteData, time.Now()); err != nil {
+		return err
+	}
+	s.states.Forget(infoHash)
+	s.labels.forget(infoHash)
+
+	s.bus.Publish(events.TorrentRemoved, infoHash, map[string]interface{}{
+		"reason":      "移入回收站",
+		"dataDeleted": false,
+		"trashed":     true,
+	})
+	return nil
+}
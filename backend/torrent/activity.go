@@ -0,0 +1,129 @@
+package torrent
+
+import "github.com/anacrolix/torrent"
+
+// Activity is a point-in-time observation of a torrent's transfer activity.
+// It carries no lifecycle state; the service layer owns the state machine and
+// uses Activity to decide between downloading, stalled, completed and seeding.
+type Activity struct {
+	HasInfo     bool
+	Complete    bool
+	Paused      bool
+	ActivePeers int
+	Length      int64
+	// Downloaded is the number of bytes verified so far
+	Downloaded int64
+	// Uploaded is the payload uploaded since the torrent was added to this
+	// process; cumulative totals across restarts are kept by the service layer
+	Uploaded int64
+	// Seeding is true when the torrent is complete and uploading is enabled
+	Seeding bool
+}
+
+// Activity returns the current transfer activity of a torrent
+func (c *Client) Activity(infoHash string) (Activity, bool) {
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return Activity{}, false
+	}
+
+	c.torrentsLock.RLock()
+	paused := c.paused[infoHash]
+	c.torrentsLock.RUnlock()
+
+	stats := t.Stats()
+	a := Activity{
+		HasInfo:     t.Info() != nil,
+		Paused:      paused,
+		ActivePeers: stats.ActivePeers,
+		Uploaded:    stats.BytesWrittenData.Int64(),
+	}
+	if a.HasInfo {
+		a.Length = t.Length()
+		a.Downloaded = t.BytesCompleted()
+		a.Complete = t.Complete().Bool()
+		a.Seeding = a.Complete && c.config.Seed && !c.config.NoUpload && !paused
+	}
+	return a, true
+}
+
+// Pause stops all data transfer for a torrent and drops its peer connections.
+// Without peers no metadata arrives either; the metadata queue skips paused
+// torrents and resuming queues them again.
+func (c *Client) Pause(infoHash string) error {
+	unlock := c.torrentLocks.lock(infoHash)
+	defer unlock()
+
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return ErrTorrentNotFound
+	}
+
+	c.torrentsLock.Lock()
+	paused := c.paused[infoHash]
+	c.paused[infoHash] = true
+	c.torrentsLock.Unlock()
+	if paused {
+		return nil
+	}
+
+	t.DisallowDataDownload()
+	t.DisallowDataUpload()
+	t.SetMaxEstablishedConns(0)
+	return nil
+}
+
+// Resume re-enables data transfer for a paused torrent
+func (c *Client) Resume(infoHash string) error {
+	unlock := c.torrentLocks.lock(infoHash)
+	defer unlock()
+
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return ErrTorrentNotFound
+	}
+
+	c.torrentsLock.Lock()
+	paused := c.paused[infoHash]
+	delete(c.paused, infoHash)
+	c.torrentsLock.Unlock()
+	if !paused {
+		return nil
+	}
+
+	t.AllowDataDownload()
+	t.AllowDataUpload()
+	c.applyMaxConnections(infoHash, t)
+
+	// Metadata that arrived as the torrent was paused, or was restored with
+	// a paused torrent, has not started the download or prioritized the video edges
+	// yet. Doing it again for a torrent that was already downloading is
+	// harmless.
+	if t.Info() != nil {
+		c.startDownload(infoHash, t)
+	}
+	return nil
+}
+
+// TransferTotals is the data transferred by the client since it started,
+// including torrents that have since been removed, and its current peers
+type TransferTotals struct {
+	Downloaded  int64
+	Uploaded    int64
+	ActivePeers int
+}
+
+// TransferTotals returns the client-wide transfer totals. The service layer
+// samples them to record the transfer history.
+func (c *Client) TransferTotals() TransferTotals {
+	var totals TransferTotals
+	for _, cl := range []*torrent.Client{c.client, c.privateClient} {
+		stats := cl.Stats()
+		totals.Downloaded += stats.BytesReadData.Int64()
+		totals.Uploaded += stats.BytesWrittenData.Int64()
+		for _, t := range cl.Torrents() {
+			totals.ActivePeers += t.Stats().ActivePeers
+		}
+	}
+	return totals
+}
@@ -0,0 +1,176 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+)
+
+// networkBinding decides which local addresses the clients use. With listen
+// addresses the peer sockets, and with them DHT and outgoing peer connections,
+// are bound to those addresses. With an interface the addresses come from the
+// interface, and tracker and web seed requests are bound to it as well, so no
+// torrent traffic leaves through another route when a VPN goes down.
+type networkBinding struct {
+	iface string
+	ipv4  net.IP
+	ipv6  net.IP
+	// disableIPv6 turns IPv6 off entirely
+	disableIPv6 bool
+}
+
+// resolveBinding picks the addresses for the clients from opts. It fails when
+// the interface does not exist or has no usable address, rather than falling
+// back to every interface.
+func resolveBinding(opts ClientOptions) (*networkBinding, error) {
+	b := &networkBinding{iface: opts.BindInterface, disableIPv6: opts.DisableIPv6}
+
+	addrs := opts.ListenAddrs
+	if opts.BindInterface != "" {
+		if len(addrs) > 0 {
+			return nil, errors.New("listen addresses and a bind interface are mutually exclusive")
+		}
+		iface, err := net.InterfaceByName(opts.BindInterface)
+		if err != nil {
+			return nil, fmt.Errorf("bind interface %s: %w", opts.BindInterface, err)
+		}
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("bind interface %s: %w", opts.BindInterface, err)
+		}
+		for _, addr := range ifaceAddrs {
+			ipNet, ok := addr.(*net.IPNet)
+			// Link-local addresses cannot reach peers
+			if !ok || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			addrs = append(addrs, ipNet.IP)
+		}
+	}
+
+	for _, ip := range addrs {
+		switch {
+		case ip.To4() != nil:
+			if b.ipv4 != nil {
+				return nil, fmt.Errorf("more than one IPv4 listen address: %s and %s", b.ipv4, ip)
+			}
+			b.ipv4 = ip.To4()
+		case !opts.DisableIPv6:
+			if b.ipv6 != nil {
+				return nil, fmt.Errorf("more than one IPv6 listen address: %s and %s", b.ipv6, ip)
+			}
+			b.ipv6 = ip
+		}
+	}
+	if opts.BindInterface != "" && b.ipv4 == nil && b.ipv6 == nil {
+		return nil, fmt.Errorf("bind interface %s has no usable address", opts.BindInterface)
+	}
+	return b, nil
+}
+
+// restricted reports whether the clients listen on specific addresses. An
+// address family without one is then turned off.
+func (b *networkBinding) restricted() bool {
+	return b.ipv4 != nil || b.ipv6 != nil
+}
+
+// apply sets the listen hosts and, for a bound interface, the tracker and web
+// seed dialers on cfg
+func (b *networkBinding) apply(cfg *torrent.ClientConfig) {
+	cfg.DisableIPv6 = b.disableIPv6 || (b.restricted() && b.ipv6 == nil)
+	cfg.DisableIPv4 = b.restricted() && b.ipv4 == nil
+	cfg.ListenHost = b.listenHost
+	if b.iface != "" {
+		cfg.TrackerDialContext = b.dialContext
+		cfg.HTTPDialContext = b.dialContext
+		cfg.TrackerListenPacket = b.listenPacket
+	}
+}
+
+// listenHost returns the address to listen on for a network such as tcp4 or
+// udp6, empty for every address
+func (b *networkBinding) listenHost(network string) string {
+	if ip := b.addrFor(network); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// addrFor returns the bound address for a network; networks without a family
+// suffix prefer IPv4
+func (b *networkBinding) addrFor(network string) net.IP {
+	switch {
+	case strings.HasSuffix(network, "4"):
+		return b.ipv4
+	case strings.HasSuffix(network, "6"):
+		return b.ipv6
+	case b.ipv4 != nil:
+		return b.ipv4
+	}
+	return b.ipv6
+}
+
+// dialContext dials from the bound addresses, trying IPv4 first
+func (b *networkBinding) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	candidates := []net.IP{b.ipv4, b.ipv6}
+	// A network that names a family can only be dialed from that family
+	if strings.HasSuffix(network, "4") || strings.HasSuffix(network, "6") {
+		candidates = []net.IP{b.addrFor(network)}
+	}
+	base := strings.TrimRight(network, "46")
+
+	var lastErr error
+	for _, ip := range candidates {
+		if ip == nil {
+			continue
+		}
+		dialNetwork := base + "6"
+		if ip.To4() != nil {
+			dialNetwork = base + "4"
+		}
+		dialer := net.Dialer{LocalAddr: localAddr(base, ip)}
+		conn, err := dialer.DialContext(ctx, dialNetwork, addr)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no %s address on interface %s", network, b.iface)
+	}
+	return nil, lastErr
+}
+
+// listenPacket opens the UDP socket for a UDP tracker on the bound address
+func (b *networkBinding) listenPacket(network, addr string) (net.PacketConn, error) {
+	ip := b.addrFor(network)
+	if ip == nil {
+		return nil, fmt.Errorf("no %s address on interface %s", network, b.iface)
+	}
+	return net.ListenPacket(network, net.JoinHostPort(ip.String(), "0"))
+}
+
+// localAddr is the source address for dialing network from ip
+func localAddr(network string, ip net.IP) net.Addr {
+	if strings.HasPrefix(network, "udp") {
+		return &net.UDPAddr{IP: ip}
+	}
+	return &net.TCPAddr{IP: ip}
+}
+
+// httpClient returns a client whose requests leave through the bound
+// interface, or the default client when no interface is bound
+func (b *networkBinding) httpClient() *http.Client {
+	if b == nil || b.iface == "" {
+		return http.DefaultClient
+	}
+	return &http.Client{Transport: &http.Transport{
+		Proxy:       http.ProxyFromEnvironment,
+		DialContext: b.dialContext,
+	}}
+}
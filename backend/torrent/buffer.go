@@ -0,0 +1,160 @@
+package torrent
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// rateSampleInterval is how often the download rate of each torrent is
+// measured. Short enough for a player polling the buffer state to see a
+// stall within a few seconds.
+const rateSampleInterval = 2 * time.Second
+
+// ErrOffsetOutOfRange is returned when an offset lies beyond the end of a file
+var ErrOffsetOutOfRange = errors.New("offset beyond end of file")
+
+// BufferInfo is how much of a file is downloaded ahead of a playback position
+type BufferInfo struct {
+	InfoHash   string `json:"infoHash"`
+	FileIndex  int    `json:"fileIndex"`
+	FileLength int64  `json:"fileLength"`
+	Offset     int64  `json:"offset"`
+	// BufferedBytes is how many bytes from Offset on are downloaded and
+	// verified without a gap, counted in whole pieces
+	BufferedBytes int64 `json:"bufferedBytes"`
+	// Complete is set when everything from Offset to the end of the file
+	// is downloaded
+	Complete bool `json:"complete"`
+	// DownloadRate is the rate at which the torrent receives piece data,
+	// in bytes per second, measured over the last few seconds
+	DownloadRate float64 `json:"downloadRate"`
+}
+
+// FileBuffer reports how many contiguous bytes of a file are downloaded
+// from offset on, and the current download rate of its torrent
+func (c *Client) FileBuffer(infoHash string, fileIndex int, offset int64) (*BufferInfo, error) {
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+	info := t.Info()
+	if info == nil {
+		return nil, ErrMetadataIncomplete
+	}
+
+	files := t.Files()
+	if fileIndex < 0 || fileIndex >= len(files) {
+		return nil, ErrFileNotFound
+	}
+	f := files[fileIndex]
+	if offset < 0 || offset > f.Length() {
+		return nil, ErrOffsetOutOfRange
+	}
+
+	buffered := contiguousBytes(f, offset)
+	return &BufferInfo{
+		InfoHash:      infoHash,
+		FileIndex:     fileIndex,
+		FileLength:    f.Length(),
+		Offset:        offset,
+		BufferedBytes: buffered,
+		Complete:      offset+buffered == f.Length(),
+		DownloadRate:  c.rates.get(infoHash),
+	}, nil
+}
+
+// contiguousBytes returns how many bytes of f from offset on are downloaded
+// and verified without a gap, counted in whole pieces. The torrent must have
+// its metadata.
+func contiguousBytes(f *torrent.File, offset int64) int64 {
+	if f.BytesCompleted() == f.Length() {
+		return f.Length() - offset
+	}
+
+	// Piece boundaries are in torrent offsets, which differ from file
+	// offsets by the file's position in the torrent
+	t := f.Torrent()
+	pieceLength := t.Info().PieceLength
+	fileEnd := f.Offset() + f.Length()
+	start := f.Offset() + offset
+	position := start
+	for piece := int(start / pieceLength); position < fileEnd && t.PieceState(piece).Complete; piece++ {
+		position = min(int64(piece+1)*pieceLength, fileEnd)
+	}
+	return position - start
+}
+
+// downloadRates keeps the latest measured download rate of each torrent
+type downloadRates struct {
+	mu    sync.Mutex
+	bytes map[string]int64
+	at    map[string]time.Time
+	rates map[string]float64
+}
+
+func newDownloadRates() *downloadRates {
+	return &downloadRates{
+		bytes: make(map[string]int64),
+		at:    make(map[string]time.Time),
+		rates: make(map[string]float64),
+	}
+}
+
+// record stores a new total of useful bytes received and updates the rate
+func (r *downloadRates) record(infoHash string, total int64, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if last, ok := r.at[infoHash]; ok && now.After(last) {
+		// The total restarts from zero when a torrent is re-added
+		r.rates[infoHash] = float64(max(total-r.bytes[infoHash], 0)) / now.Sub(last).Seconds()
+	}
+	r.bytes[infoHash] = total
+	r.at[infoHash] = now
+}
+
+// prune forgets torrents that are no longer in the client
+func (r *downloadRates) prune(active map[string]bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for infoHash := range r.at {
+		if !active[infoHash] {
+			delete(r.bytes, infoHash)
+			delete(r.at, infoHash)
+			delete(r.rates, infoHash)
+		}
+	}
+}
+
+func (r *downloadRates) get(infoHash string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rates[infoHash]
+}
+
+// sampleRates measures the download rate of every torrent until the client
+// is closed
+func (c *Client) sampleRates() {
+	ticker := time.NewTicker(rateSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		case now := <-ticker.C:
+			active := make(map[string]bool)
+			for _, t := range append(c.client.Torrents(), c.privateClient.Torrents()...) {
+				infoHash := t.InfoHash().HexString()
+				active[infoHash] = true
+				stats := t.Stats()
+				c.rates.record(infoHash, stats.BytesReadUsefulData.Int64(), now)
+			}
+			c.rates.prune(active)
+		}
+	}
+}
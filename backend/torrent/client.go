@@ -1,21 +1,79 @@
 package torrent
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
 	"github.com/torrentplayer/backend/db"
+	"golang.org/x/time/rate"
 )
 
 // Client wraps the anacrolix/torrent client with our own functions
 type Client struct {
 	client       *torrent.Client
+	config       *torrent.ClientConfig
+	// privateClient runs BEP 27 private torrents with DHT and PEX disabled,
+	// which anacrolix/torrent can only turn off for a whole client
+	privateClient  *torrent.Client
+	privateStorage storage.ClientImplCloser
+	// torrentsLock guards the registry: torrents and the per-torrent maps
+	// below. It is only held to read or update them; work on a torrent
+	// itself happens under its own lock, see torrentLocks.
 	torrents     map[string]*torrent.Torrent
-	torrentsLock sync.Mutex
+	torrentsLock sync.RWMutex
+	torrentLocks *torrentLocks
+	peerHistory  *peerHistory
+	rates        *downloadRates
+	storages     map[string]storage.ClientImplCloser // per-torrent storage for imported data paths
+	paused       map[string]bool
+	connLimits   map[string]int // per-torrent connection limits, see SetTorrentMaxConnections
+	dataDirs     map[string]string // data directories of imported torrents
+	trackerStats map[string]map[string]TrackerInfo // outcome of the last forced reannounce per tracker URL
+	// publicTrackers are added to every public magnet to speed up peer
+	// discovery; injected remembers which of them each torrent received
+	publicTrackers []string
+	injected       map[string][]string
+	portForwarding bool
+	// binding holds the addresses and interface the clients are bound to
+	binding        *networkBinding
+	transport      TransportOptions
+	peers          PeerOptions
+	// maxConnsPerTorrent is the connection limit of torrents without their own
+	maxConnsPerTorrent int
+	portMu         sync.Mutex
+	portMappings   []PortMapping
+	portMapped     bool // UPnP discovery and mapping have finished
+	// downloadLimiter and uploadLimiter are shared by the public and
+	// private clients so a cap applies to all torrents together
+	downloadLimiter *rate.Limiter
+	uploadLimiter   *rate.Limiter
+	readahead       ReadaheadOptions
+	// completions holds the milestones reported by the completion watchers,
+	// see SetCompletionHandler
+	completionMu sync.Mutex
+	completions  map[string]*completionState
+	onCompletion func(Completion)
+	// onFailure is called for operations that failed after failureRetries
+	// retries, see SetFailureHandler
+	onFailure      func(Failure)
+	failureRetries int
+	// metadataTimeout bounds the wait for metadata in AddMagnet
+	metadataTimeout time.Duration
+	// snapshots serves torrent and file lists to requests, see snapshot
+	snapshots    *snapshotCache
+	closed       chan struct{}
+	closeOnce    sync.Once
 }
 
 // TorrentInfo represents information about a torrent
@@ -26,38 +84,230 @@ type TorrentInfo struct {
 	Files        []FileInfo `json:"files"`
 	Downloaded   int64      `json:"downloaded"`
 	Progress     float32    `json:"progress"`
+	// Uploaded and Ratio are cumulative across restarts and filled in by
+	// the service layer
+	Uploaded     int64      `json:"uploaded"`
+	Ratio        float64    `json:"ratio"`
+	// State is the lifecycle state owned by the service layer; the client
+	// leaves it empty and reports raw transfer activity through Activity
 	State        string     `json:"state"`
+	StateReason  string     `json:"stateReason,omitempty"`
+	// LastError is the last failure of an operation on the torrent, filled
+	// in by the service layer
+	LastError    string     `json:"lastError,omitempty"`
+	// Private torrents only talk to their own trackers: no public trackers,
+	// DHT or PEX
+	Private      bool       `json:"private"`
+	// Category and Tags are library labels filled in by the service layer
+	Category     string     `json:"category,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	// AddedBy is the id of the user who added the torrent
+	AddedBy      int64      `json:"addedBy,omitempty"`
 	AddedAt      time.Time  `json:"addedAt"`
 	MovieDetails *db.MovieDetails `json:"movieDetails,omitempty"`
+	// PostProcess is the outcome of the post-download command, filled in by
+	// the service layer once it has run
+	PostProcess  *db.PostProcessResult `json:"postProcess,omitempty"`
+	// AlreadyExists is set by the service layer when an add returned a
+	// torrent that was already in the library
+	AlreadyExists bool `json:"alreadyExists,omitempty"`
 }
 
 // FileInfo represents information about a file in a torrent
 type FileInfo struct {
-	Path       string  `json:"path"`
-	Length     int64   `json:"length"`
-	Progress   float32 `json:"progress"`
-	FileIndex  int     `json:"fileIndex"`
-	TorrentID  string  `json:"torrentId"`
-	IsVideo    bool    `json:"isVideo"`
-	IsPlayable bool    `json:"isPlayable"`
+	Path     string  `json:"path"`
+	Length   int64   `json:"length"`
+	Progress float32 `json:"progress"`
+	// BytesCompleted is exact, unlike Progress which loses precision on large files
+	BytesCompleted int64  `json:"bytesCompleted"`
+	FileIndex      int    `json:"fileIndex"`
+	TorrentID      string `json:"torrentId"`
+	IsVideo        bool   `json:"isVideo"`
+	IsPlayable     bool   `json:"isPlayable"`
+	// PlayableBytes is how much of the file from its start is downloaded
+	// without a gap, which is what a player can read right away
+	PlayableBytes int64 `json:"playableBytes"`
 }
 
-// NewClient creates a new torrent client
+// ClientOptions are the network settings of a client
+type ClientOptions struct {
+	// ListenPort is the port for incoming peers, 0 picks a random one. The
+	// private client listens on the next port.
+	ListenPort int
+	// PortForwarding maps the listen ports on UPnP gateways
+	PortForwarding bool
+	// Readahead tunes streaming, see ReadaheadOptions
+	Readahead ReadaheadOptions
+	// ListenAddrs restricts the peer sockets to at most one IPv4 and one IPv6
+	// address; an address family without one is disabled. Empty listens on
+	// every interface.
+	ListenAddrs []net.IP
+	// BindInterface forces all torrent traffic, including trackers and web
+	// seeds, over the named interface such as a VPN tunnel. The client fails
+	// to start when the interface has no address. Port forwarding is skipped
+	// because UPnP would map the port on the LAN gateway instead.
+	BindInterface string
+	// DisableIPv6 turns off IPv6 peers, DHT and trackers
+	DisableIPv6 bool
+	// Transport selects the peer protocols and encryption policy
+	Transport TransportOptions
+	// Peers sets the connection limits and peer sources
+	Peers PeerOptions
+	// WebRTC sets the ICE servers for WebTorrent peers
+	WebRTC WebRTCOptions
+	// FailureRetries is how many times an operation on a torrent that
+	// panicked in the library runs again before the failure is reported
+	FailureRetries int
+	// MetadataTimeout is how long AddMagnet waits for a torrent's metadata,
+	// 30 seconds when 0
+	MetadataTimeout time.Duration
+}
+
+// defaultMetadataTimeout is the metadata timeout of AddMagnet when
+// ClientOptions leaves it unset
+const defaultMetadataTimeout = 30 * time.Second
+
+// NewClient creates a new torrent client on a random port with port forwarding
 func NewClient(dataDir string) (*Client, error) {
+	return NewClientWithOptions(dataDir, ClientOptions{PortForwarding: true})
+}
+
+// NewClientWithOptions creates a new torrent client with the given network settings
+func NewClientWithOptions(dataDir string, opts ClientOptions) (*Client, error) {
+	binding, err := resolveBinding(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.BindInterface != "" {
+		opts.PortForwarding = false
+	}
+
+	downloadLimiter := rate.NewLimiter(rate.Inf, 0)
+	uploadLimiter := rate.NewLimiter(rate.Inf, 0)
+
+	cfg := newClientConfig(dataDir)
+	cfg.ListenPort = opts.ListenPort
+	binding.apply(cfg)
+	if err := opts.Transport.apply(cfg); err != nil {
+		return nil, err
+	}
+	opts.Peers.apply(cfg)
+	cfg.NoDHT = opts.Peers.DisableDHT
+	cfg.DisablePEX = opts.Peers.DisablePEX
+	// WebRTC connections cannot be bound to an interface and would bypass it
+	webtorrent := !opts.Peers.DisableWebTorrent && opts.BindInterface == ""
+	cfg.DisableWebtorrent = !webtorrent
+	opts.WebRTC.apply(cfg)
+	cfg.DownloadRateLimiter = downloadLimiter
+	cfg.UploadRateLimiter = uploadLimiter
+
+	// 创建客户端实例
+	client, err := torrent.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	
+	// 在创建客户端后，我们将手动为每个新添加的种子配置公共 trackers
+
+	// 私有种子使用单独的客户端，关闭 DHT 和 PEX；数据目录相同，但 piece 完成记录分开保存以免数据库文件冲突
+	privateDir := filepath.Join(dataDir, ".private")
+	if err := os.MkdirAll(privateDir, 0o755); err != nil {
+		client.Close()
+		return nil, err
+	}
+	completion, err := storage.NewDefaultPieceCompletionForDir(privateDir)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("create private piece completion: %w", err)
+	}
+	privateStorage := storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dataDir,
+		PieceCompletion: completion,
+	})
+	privateCfg := newClientConfig(dataDir)
+	if opts.ListenPort > 0 {
+		privateCfg.ListenPort = opts.ListenPort + 1
+	}
+	binding.apply(privateCfg)
+	opts.Transport.apply(privateCfg)
+	opts.Peers.apply(privateCfg)
+	privateCfg.NoDHT = true
+	privateCfg.DisablePEX = true
+	privateCfg.DisableWebtorrent = !webtorrent
+	opts.WebRTC.apply(privateCfg)
+	privateCfg.DefaultStorage = privateStorage
+	privateCfg.DownloadRateLimiter = downloadLimiter
+	privateCfg.UploadRateLimiter = uploadLimiter
+	privateClient, err := torrent.NewClient(privateCfg)
+	if err != nil {
+		privateStorage.Close()
+		client.Close()
+		return nil, err
+	}
+
+	c := &Client{
+		client:         client,
+		config:         cfg,
+		privateClient:  privateClient,
+		privateStorage: privateStorage,
+		torrents:       make(map[string]*torrent.Torrent),
+		torrentLocks:   newTorrentLocks(),
+		peerHistory:    newPeerHistory(),
+		rates:          newDownloadRates(),
+		storages:       make(map[string]storage.ClientImplCloser),
+		paused:         make(map[string]bool),
+		connLimits:     make(map[string]int),
+		dataDirs:       make(map[string]string),
+		trackerStats:   make(map[string]map[string]TrackerInfo),
+		injected:       make(map[string][]string),
+		portForwarding: opts.PortForwarding,
+		binding:        binding,
+		transport:      opts.Transport,
+		peers:          opts.Peers,
+		maxConnsPerTorrent: cfg.EstablishedConnsPerTorrent,
+		completions:    make(map[string]*completionState),
+		snapshots:      newSnapshotCache(),
+		closed:         make(chan struct{}),
+
+		downloadLimiter: downloadLimiter,
+		uploadLimiter:   uploadLimiter,
+		readahead:       opts.Readahead,
+		failureRetries:  opts.FailureRetries,
+		metadataTimeout: opts.MetadataTimeout,
+	}
+	if c.metadataTimeout <= 0 {
+		c.metadataTimeout = defaultMetadataTimeout
+	}
+
+	// 端口映射由我们自己完成，以便记录结果供网络检查使用
+	if opts.PortForwarding {
+		go c.forwardPorts()
+	}
+
+	// 定期记录 peer 数量，供诊断报告展示趋势
+	go c.samplePeers()
+	// 定期测量下载速度，供播放器判断缓冲状态
+	go c.sampleRates()
+	// 定期重建种子和文件列表的快照，请求直接读取快照而不必遍历所有文件
+	go c.sampleSnapshots()
+
+	return c, nil
+}
+
+// newClientConfig returns the settings shared by the public and private clients
+func newClientConfig(dataDir string) *torrent.ClientConfig {
 	cfg := torrent.NewDefaultClientConfig()
 
 	// 基本设置
 	cfg.DataDir = dataDir
 	cfg.NoUpload = false
 	cfg.DisableWebseeds = false
-	cfg.DisableTCP = false
-	cfg.DisableUTP = false
 
 	// 性能优化配置
 	cfg.Seed = true                     // 启用做种
 	cfg.ListenPort = 0                  // 随机端口以避免冲突
 	cfg.NoDHT = false                   // 启用 DHT
-	cfg.NoDefaultPortForwarding = false // 尝试使用 upnp 端口转发
+	cfg.NoDefaultPortForwarding = true  // 端口转发见 forwardPorts
 	cfg.DisablePEX = false              // 启用 PEX (Peer Exchange)
 	cfg.DropDuplicatePeerIds = true     // 优化连接管理
 
@@ -66,143 +316,352 @@ func NewClient(dataDir string) (*Client, error) {
 	cfg.TotalHalfOpenConns = 100        // 增加半开连接数
 	cfg.TorrentPeersHighWater = 500     // 增加每个种子的最大 peer 数
 
-	// 创建客户端实例
-	client, err := torrent.NewClient(cfg)
-	if err != nil {
-		return nil, err
-	}
-	
-	// 在创建客户端后，我们将手动为每个新添加的种子配置公共 trackers
-	
-	return &Client{
-		client:   client,
-		torrents: make(map[string]*torrent.Torrent),
-	}, nil
+	return cfg
 }
 
 // Close shuts down the torrent client
 func (c *Client) Close() {
+	c.closeOnce.Do(func() { close(c.closed) })
+	c.clearPortMappings()
 	c.client.Close()
+	c.privateClient.Close()
+	c.privateStorage.Close()
+
+	c.torrentsLock.Lock()
+	defer c.torrentsLock.Unlock()
+	for _, s := range c.storages {
+		s.Close()
+	}
+}
+
+// SetPublicTrackers replaces the trackers added to public magnets. Torrents
+// that are already running keep the trackers they were added with.
+func (c *Client) SetPublicTrackers(urls []string) {
+	c.torrentsLock.Lock()
+	defer c.torrentsLock.Unlock()
+	c.publicTrackers = append([]string(nil), urls...)
+}
+
+// PublicTrackers returns the trackers added to public magnets
+func (c *Client) PublicTrackers() []string {
+	c.torrentsLock.RLock()
+	defer c.torrentsLock.RUnlock()
+	return append([]string(nil), c.publicTrackers...)
+}
+
+// rateLimitBurst is the burst of a capped rate limiter. anacrolix/torrent
+// needs it to hold a whole 16 KiB chunk and the largest read from a peer
+// connection, and it is never lowered because a read may be checking it.
+const rateLimitBurst = 256 << 10
+
+// SetRateLimits caps the total download and upload rate in bytes per second,
+// 0 removes the cap. The limits apply to running torrents immediately.
+func (c *Client) SetRateLimits(downloadBytesPerSec, uploadBytesPerSec int64) {
+	setRateLimit(c.downloadLimiter, downloadBytesPerSec)
+	setRateLimit(c.uploadLimiter, uploadBytesPerSec)
+}
+
+func setRateLimit(limiter *rate.Limiter, bytesPerSec int64) {
+	if bytesPerSec <= 0 {
+		limiter.SetLimit(rate.Inf)
+		return
+	}
+	// the burst must be large enough before the limit leaves rate.Inf
+	if limiter.Burst() < rateLimitBurst {
+		limiter.SetBurst(rateLimitBurst)
+	}
+	limiter.SetLimit(rate.Limit(bytesPerSec))
 }
 
-// AddMagnet adds a magnet link to the client
+// ErrMetadataTimeout is returned when a torrent's metadata does not arrive in time
+var ErrMetadataTimeout = errors.New("timeout waiting for torrent metadata")
+
+// AddMagnet adds a magnet link to the client and blocks until its metadata
+// arrives, for at most ClientOptions.MetadataTimeout. New code should prefer
+// AddMagnetAsync.
 func (c *Client) AddMagnet(magnetURI string) (*TorrentInfo, error) {
+	info, err := c.AddMagnetAsync(magnetURI, false)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.metadataTimeout)
+	defer cancel()
+
+	if err := c.WaitForMetadata(ctx, info.InfoHash); err != nil {
+		return nil, err
+	}
+
+	t, _ := c.GetTorrent(info.InfoHash)
+	return c.getTorrentInfo(t), nil
+}
+
+// AddMagnetAsync adds a magnet link and returns immediately. The torrent is
+// tracked right away in the "fetching-metadata" state; call WaitForMetadata
+// to start downloading once the info dictionary has been received.
+//
+// private marks a torrent as private before its metadata is known, so it is
+// never announced to public trackers or the DHT. Torrents whose metadata
+// turns out to carry the private flag are switched over in WaitForMetadata.
+func (c *Client) AddMagnetAsync(magnetURI string, private bool) (*TorrentInfo, error) {
+	return c.addMagnet(magnetURI, nil, private)
+}
+
+// addMagnet adds a magnet link, with its info dictionary when it is already
+// known so the metadata does not have to be fetched from peers
+func (c *Client) addMagnet(magnetURI string, infoBytes []byte, private bool) (*TorrentInfo, error) {
 	// 验证磁力链接格式
 	if !strings.HasPrefix(magnetURI, "magnet:?") {
 		return nil, fmt.Errorf("invalid magnet URI format")
 	}
 
+	// 重复添加时返回已有的种子，避免同一种子同时存在于两个客户端
+	magnet, err := metainfo.ParseMagnetUri(magnetURI)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := c.GetTorrent(magnet.InfoHash.HexString()); ok {
+		return c.getTorrentInfo(t), nil
+	}
+
 	// 添加磁力链接
-	t, err := c.client.AddMagnet(magnetURI)
+	cl := c.client
+	if private {
+		cl = c.privateClient
+	}
+	spec, err := torrent.TorrentSpecFromMagnetUri(magnetURI)
+	if err != nil {
+		return nil, err
+	}
+	spec.InfoBytes = infoBytes
+	t, _, err := cl.AddTorrentSpec(spec)
+	if err != nil && infoBytes != nil {
+		// 保存的元数据无效时退回到从 peer 获取
+		spec.InfoBytes = nil
+		t, _, err = cl.AddTorrentSpec(spec)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	// 为种子添加更多的 trackers 以提高发现速度
-	publicTrackers := []string{
-		"udp://tracker.opentrackr.org:1337/announce",
-		"udp://tracker.openbittorrent.com:6969/announce",
-		"udp://open.stealth.si:80/announce",
-		"udp://exodus.desync.com:6969/announce",
-		"udp://explodie.org:6969/announce",
-		"http://tracker.opentrackr.org:1337/announce",
-		"http://tracker.openbittorrent.com:80/announce",
-		"udp://tracker.torrent.eu.org:451/announce",
-		"udp://tracker.moeking.me:6969/announce",
-		"udp://bt.oiyo.tk:6969/announce",
-		"https://tracker.nanoha.org:443/announce",
-		"https://tracker.lilithraws.org:443/announce",
+	infoHash := t.InfoHash().String()
+	unlock := c.torrentLocks.lock(infoHash)
+	defer unlock()
+
+	// 为种子添加更多的 trackers 以提高发现速度，私有种子只能使用自己的 tracker
+	c.torrentsLock.RLock()
+	trackers := c.publicTrackers
+	c.torrentsLock.RUnlock()
+	if !private {
+		for _, tracker := range trackers {
+			t.AddTrackers([][]string{{tracker}})
+		}
 	}
 
-	for _, tracker := range publicTrackers {
-		t.AddTrackers([][]string{{tracker}})
+	// 保存种子信息，统计和文件列表在注册表锁之外计算
+	c.torrentsLock.Lock()
+	if !private && len(trackers) > 0 {
+		c.injected[infoHash] = trackers
 	}
+	c.torrents[infoHash] = t
+	c.watchLocked(infoHash, t)
+	c.torrentsLock.Unlock()
+	c.applyMaxConnections(infoHash, t)
+	c.cacheTorrent(infoHash, t)
+
+	return c.getTorrentInfo(t), nil
+}
 
-	// 等待元数据，设置超时 (降低超时时间以提高体验)
-	metadataTimeout := time.NewTimer(30 * time.Second)
-	defer metadataTimeout.Stop()
+// WaitForMetadata blocks until the torrent's metadata is available or ctx is
+// done, then starts downloading all files
+func (c *Client) WaitForMetadata(ctx context.Context, infoHash string) error {
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return ErrTorrentNotFound
+	}
 
-	select {
-	case <-t.GotInfo():
-		// 继续处理
-	case <-metadataTimeout.C:
-		return nil, fmt.Errorf("timeout waiting for torrent metadata")
+	for waiting := true; waiting; {
+		select {
+		case <-t.GotInfo():
+			waiting = false
+		case <-t.Closed():
+			// RemoveTrackers drops the torrent and adds it back under the same info hash
+			next, ok := c.GetTorrent(infoHash)
+			if !ok || next == t {
+				return ErrTorrentNotFound
+			}
+			t = next
+		case <-c.closed:
+			return fmt.Errorf("client closed")
+		case <-ctx.Done():
+			return ErrMetadataTimeout
+		}
 	}
 
 	// 安全检查 - 确保 Info() 不为 nil
 	if t.Info() == nil {
-		return nil, fmt.Errorf("failed to get torrent info")
+		return fmt.Errorf("failed to get torrent info")
 	}
 
-	// 开始下载前进行额外的安全检查
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("Recovered from panic in DownloadAll: %v\n", r)
+	// 元数据中带有 private 标记的种子转到私有客户端，并去掉自动添加的公共 tracker
+	if isPrivateInfo(t.Info()) && !c.isPrivate(t) {
+		moved, err := c.moveToPrivate(infoHash)
+		if err != nil {
+			return fmt.Errorf("move private torrent: %w", err)
 		}
-	}()
+		t = moved
+	}
 
-	// 尝试启动下载
-	safeDownloadAll(t)
+	// 尝试启动下载，视频文件首尾的容器索引优先下载；失败已报告给失败处理函数，元数据本身已经获取
+	c.startDownload(infoHash, t)
 
-	// 设置高优先级
-	t.SetMaxEstablishedConns(100) // 允许更多的连接
+	// 应用连接数上限，暂停中的种子在恢复时再应用
+	unlock := c.torrentLocks.lock(infoHash)
+	if current, ok := c.GetTorrent(infoHash); ok && current == t {
+		c.applyMaxConnections(infoHash, t)
+	}
+	unlock()
 
-	c.torrentsLock.Lock()
-	defer c.torrentsLock.Unlock()
+	return nil
+}
 
-	// 保存种子信息
-	infoHash := t.InfoHash().String()
-	c.torrents[infoHash] = t
 
-	// 返回种子信息
-	return c.getTorrentInfo(t), nil
+// GetTorrent returns a torrent by info hash
+func (c *Client) GetTorrent(infoHash string) (*torrent.Torrent, bool) {
+	c.torrentsLock.RLock()
+	defer c.torrentsLock.RUnlock()
+
+	t, ok := c.torrents[infoHash]
+	return t, ok
 }
 
-// safeDownloadAll 是 DownloadAll 的安全包装版本
-func safeDownloadAll(t *torrent.Torrent) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("Recovered from panic in DownloadAll: %v\n", r)
-		}
-	}()
+// GetTorrentInfo returns the current information of a single torrent
+func (c *Client) GetTorrentInfo(infoHash string) (*TorrentInfo, bool) {
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return nil, false
+	}
+	return c.getTorrentInfo(t), true
+}
+
+// FilePath returns where a file of a torrent is stored on disk, under the
+// save path of imported torrents and the data directory otherwise
+func (c *Client) FilePath(infoHash string, fileIndex int) (string, error) {
+	c.torrentsLock.RLock()
+	t, ok := c.torrents[infoHash]
+	baseDir, imported := c.dataDirs[infoHash]
+	c.torrentsLock.RUnlock()
 
-	if t != nil && t.Info() != nil {
-		t.DownloadAll()
+	if !ok {
+		return "", ErrTorrentNotFound
+	}
+	if !imported {
+		baseDir = c.config.DataDir
+	}
+	if t.Info() == nil {
+		return "", ErrMetadataIncomplete
+	}
+	files := t.Files()
+	if fileIndex < 0 || fileIndex >= len(files) {
+		return "", ErrFileNotFound
 	}
+	return filepath.Abs(filepath.Join(baseDir, filepath.FromSlash(files[fileIndex].Path())))
 }
 
-// GetTorrent returns a torrent by info hash
-func (c *Client) GetTorrent(infoHash string) (*torrent.Torrent, bool) {
+// RemoveTorrent drops a torrent from the client. The downloaded data is left
+// on disk unless deleteData is set.
+func (c *Client) RemoveTorrent(infoHash string, deleteData bool) error {
+	unlock := c.torrentLocks.lock(infoHash)
+	defer unlock()
+
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return ErrTorrentNotFound
+	}
+
 	c.torrentsLock.Lock()
-	defer c.torrentsLock.Unlock()
+	baseDir, imported := c.dataDirs[infoHash]
+	if !imported {
+		baseDir = c.config.DataDir
+	}
+	delete(c.torrents, infoHash)
+	c.uncacheLocked(infoHash)
+	delete(c.paused, infoHash)
+	delete(c.connLimits, infoHash)
+	delete(c.dataDirs, infoHash)
+	delete(c.trackerStats, infoHash)
+	delete(c.injected, infoHash)
+	files := c.storages[infoHash]
+	delete(c.storages, infoHash)
+	c.torrentsLock.Unlock()
+	c.forgetCompletion(infoHash)
 
-	t, ok := c.torrents[infoHash]
-	return t, ok
+	var name string
+	if info := t.Info(); info != nil {
+		name = info.BestName()
+	}
+	t.Drop()
+	// the torrent is no longer tracked, so a sample taken before removal is
+	// not recorded after this
+	c.peerHistory.forget(infoHash)
+	if files != nil {
+		files.Close()
+		if err := os.RemoveAll(c.importedCompletionDir(infoHash)); err != nil {
+			return fmt.Errorf("remove piece completion: %w", err)
+		}
+	}
+
+	if !deleteData || name == "" {
+		return nil
+	}
+	return removeTorrentData(baseDir, name)
 }
 
-// ListTorrents returns a list of all torrents
-func (c *Client) ListTorrents() []TorrentInfo {
-	c.torrentsLock.Lock()
-	defer c.torrentsLock.Unlock()
+// removeTorrentData deletes a torrent's top-level file or directory, refusing
+// any name that would escape baseDir
+func removeTorrentData(baseDir, name string) error {
+	base, err := filepath.Abs(baseDir)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(base, name)
+	if rel, err := filepath.Rel(base, target); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("refusing to delete %q outside %s", name, base)
+	}
+
+	if err := os.RemoveAll(target); err != nil {
+		return fmt.Errorf("delete torrent data: %w", err)
+	}
+	return nil
+}
 
+// ListTorrents returns a list of all torrents from the snapshot, up to
+// snapshotInterval old
+func (c *Client) ListTorrents() []TorrentInfo {
 	var infos []TorrentInfo
-	for _, t := range c.torrents {
-		infos = append(infos, *c.getTorrentInfo(t))
+	for _, cached := range c.snapshots.current.Load().torrents {
+		infos = append(infos, *cached.info)
 	}
 	return infos
 }
 
-// ListFiles returns a list of all files in a torrent
+// ListFiles returns a list of all files in a torrent. They come from the
+// snapshot once it has the metadata, so progress is up to snapshotInterval
+// old.
 func (c *Client) ListFiles(infoHash string) ([]FileInfo, error) {
-	c.torrentsLock.Lock()
-	t, ok := c.torrents[infoHash]
-	c.torrentsLock.Unlock()
+	if cached, ok := c.snapshots.get(infoHash); ok && len(cached.info.Files) > 0 {
+		return append([]FileInfo(nil), cached.info.Files...), nil
+	}
 
+	t, ok := c.GetTorrent(infoHash)
 	if !ok {
 		return nil, fmt.Errorf("torrent not found")
 	}
 
 	// 确保我们有种子信息
+	if t.Info() == nil {
+		return nil, fmt.Errorf("torrent metadata not yet complete")
+	}
 	if !t.Info().IsDir() && len(t.Files()) == 0 {
 		// 单文件种子但文件列表为空，可能是元数据尚未完全下载
 		return nil, fmt.Errorf("torrent metadata not yet complete")
@@ -225,53 +684,129 @@ func (c *Client) ListFiles(infoHash string) ([]FileInfo, error) {
 			progress = float32(bytesCompleted) / float32(fileLength)
 		}
 
-		// 判断是否可播放 (对视频文件，如果有至少5%的内容已下载，就认为可以开始播放)
-		isPlayable := false
-		if isVideo {
-			// 对于视频文件：
-			// 1. 如果已完成超过5%，认为有足够的缓冲可播放
-			// 2. 或者已下载至少5MB数据（足够播放开头）
-			isPlayable = progress >= 0.05 || bytesCompleted >= 5*1024*1024
-
-			// 如果文件很小（小于10MB），只需要下载更少的部分
-			if fileLength < 10*1024*1024 {
-				isPlayable = progress >= 0.02
-			}
-		}
-
 		files = append(files, FileInfo{
-			Path:       f.DisplayPath(),
-			Length:     fileLength,
-			Progress:   progress,
-			FileIndex:  i,
-			TorrentID:  infoHash,
-			IsVideo:    isVideo,
-			IsPlayable: isPlayable,
+			Path:           f.DisplayPath(),
+			Length:         fileLength,
+			Progress:       progress,
+			BytesCompleted: bytesCompleted,
+			FileIndex:      i,
+			TorrentID:      infoHash,
+			IsVideo:        isVideo,
+			// 是否可播放由完成监听器在 piece 下载完成时判断，见 watchCompletion
+			IsPlayable:     c.isPlayable(infoHash, i),
+			PlayableBytes:  contiguousBytes(f, 0),
 		})
 	}
 
 	return files, nil
 }
 
+// ErrMetadataIncomplete is returned when a file is requested before the
+// torrent's metadata has been received
+var ErrMetadataIncomplete = errors.New("torrent metadata not yet complete")
+
+// ErrFileNotFound is returned when the file index is out of range
+var ErrFileNotFound = errors.New("file not found in torrent")
+
+// FileReader reads one file of a torrent, see OpenFile
+type FileReader = torrent.Reader
+
+// OpenFile opens a reader over one file of a torrent, fileIndex being the
+// FileIndex reported by ListFiles. Reads block until the pieces they cover
+// have been downloaded, and pieces ahead of the read position are
+// prioritised. runtime is the playback length of the file, used to size the
+// readahead; 0 if unknown. The caller must close the reader.
+func (c *Client) OpenFile(infoHash string, fileIndex int, runtime time.Duration) (FileReader, *FileInfo, error) {
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return nil, nil, ErrTorrentNotFound
+	}
+	if t.Info() == nil {
+		return nil, nil, ErrMetadataIncomplete
+	}
+
+	files := t.Files()
+	if fileIndex < 0 || fileIndex >= len(files) {
+		return nil, nil, ErrFileNotFound
+	}
+	f := files[fileIndex]
+
+	reader := f.NewReader()
+	reader.SetResponsive()
+	reader.SetReadaheadFunc(c.readahead.readaheadFunc(f.Length(), runtime))
+	return &fileReader{Reader: reader, length: f.Length()}, &FileInfo{
+		Path:           f.DisplayPath(),
+		Length:         f.Length(),
+		BytesCompleted: f.BytesCompleted(),
+		FileIndex:      fileIndex,
+		TorrentID:      infoHash,
+		IsVideo:        isVideoFile(strings.ToLower(filepath.Ext(f.DisplayPath()))),
+	}, nil
+}
+
+// fileReader stops reads at the end of the file. The library's file reader
+// only checks the position before a read, so a read near the end of a file
+// returns the start of the next file in the torrent.
+type fileReader struct {
+	torrent.Reader
+	length int64
+	pos    int64
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	return r.ReadContext(context.Background(), p)
+}
+
+func (r *fileReader) ReadContext(ctx context.Context, p []byte) (int, error) {
+	if r.pos >= r.length {
+		return 0, io.EOF
+	}
+	if remaining := r.length - r.pos; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := r.Reader.ReadContext(ctx, p)
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *fileReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.Reader.Seek(offset, whence)
+	if err == nil {
+		r.pos = pos
+	}
+	return pos, err
+}
+
 // getTorrentInfo creates a TorrentInfo struct from a torrent
 func (c *Client) getTorrentInfo(t *torrent.Torrent) *TorrentInfo {
 	info := t.Info()
 
+	// Files are only available once the metadata has been received
+	var torrentFiles []*torrent.File
+	if info != nil {
+		torrentFiles = t.Files()
+	}
+
 	// Calculate total downloaded
 	var downloaded int64
-	for _, file := range t.Files() {
+	for _, file := range torrentFiles {
 		downloaded += file.BytesCompleted()
 	}
 
 	// Calculate progress
+	var length int64
 	progress := float32(0)
-	if info != nil && info.TotalLength() > 0 {
-		progress = float32(downloaded) / float32(info.TotalLength())
+	if info != nil {
+		length = info.TotalLength()
+	}
+	if length > 0 {
+		progress = float32(downloaded) / float32(length)
 	}
 
 	// Get files info
-	files := make([]FileInfo, 0, len(t.Files()))
-	for i, file := range t.Files() {
+	infoHash := t.InfoHash().String()
+	files := make([]FileInfo, 0, len(torrentFiles))
+	for i, file := range torrentFiles {
 		fileProgress := float32(0)
 		if file.Length() > 0 {
 			fileProgress = float32(file.BytesCompleted()) / float32(file.Length())
@@ -281,35 +816,26 @@ func (c *Client) getTorrentInfo(t *torrent.Torrent) *TorrentInfo {
 		ext := filepath.Ext(file.DisplayPath())
 		isVideo := isVideoFile(ext)
 
-		// A file is considered playable if it's a video and has at least some data
-		isPlayable := isVideo && file.BytesCompleted() > 0
-
 		files = append(files, FileInfo{
-			Path:       file.DisplayPath(),
-			Length:     file.Length(),
-			Progress:   fileProgress,
-			FileIndex:  i,
-			TorrentID:  t.InfoHash().String(),
-			IsVideo:    isVideo,
-			IsPlayable: isPlayable,
+			Path:           file.DisplayPath(),
+			Length:         file.Length(),
+			Progress:       fileProgress,
+			BytesCompleted: file.BytesCompleted(),
+			FileIndex:      i,
+			TorrentID:      infoHash,
+			IsVideo:        isVideo,
+			IsPlayable:     c.isPlayable(infoHash, i),
+			PlayableBytes:  contiguousBytes(file, 0),
 		})
 	}
 
-	// Determine state
-	state := "downloading"
-	if t.Complete().Bool() {
-		state = "completed"
-	} else if t.Stats().ActivePeers == 0 {
-		state = "stalled"
-	}
-
 	return &TorrentInfo{
-		InfoHash:   t.InfoHash().String(),
+		InfoHash:   infoHash,
 		Name:       t.Name(),
-		Length:     info.TotalLength(),
+		Private:    c.isPrivate(t),
+		Length:     length,
 		Downloaded: downloaded,
 		Progress:   progress,
-		State:      state,
 		Files:      files,
 		AddedAt:    time.Now(),
 		MovieDetails: nil,
@@ -0,0 +1,201 @@
+package torrent
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+)
+
+// CompletionKind tells what a Completion reports
+type CompletionKind string
+
+const (
+	// FilePlayable is reported when enough of a video file has been
+	// downloaded to start playing it
+	FilePlayable CompletionKind = "file-playable"
+	// TorrentComplete is reported when every piece has been verified
+	TorrentComplete CompletionKind = "torrent-complete"
+)
+
+// Completion is a download milestone reported by the completion watcher.
+// Each one is reported once per torrent while the client runs, including
+// for data already on disk when the torrent is added; the service layer
+// records them to tell milestones from earlier runs apart.
+type Completion struct {
+	Kind     CompletionKind
+	InfoHash string
+	// File is the file that became playable, nil for TorrentComplete
+	File *FileInfo
+}
+
+// completionState is what has been reported for a torrent. It outlives the
+// *torrent.Torrent so torrents re-added by readd do not report again.
+type completionState struct {
+	playable map[int]bool
+	complete bool
+}
+
+// playableHead is how much of the start of a video has to be downloaded
+// without a gap before it is reported playable; smaller files need a share of
+// their length instead
+const playableHead = 5 * 1024 * 1024
+
+// SetCompletionHandler sets the function called for each Completion. It is
+// called from the watcher goroutines and must be set before torrents are
+// added.
+func (c *Client) SetCompletionHandler(fn func(Completion)) {
+	c.completionMu.Lock()
+	defer c.completionMu.Unlock()
+	c.onCompletion = fn
+}
+
+// isPlayable reports whether a file of a torrent has been reported playable
+func (c *Client) isPlayable(infoHash string, fileIndex int) bool {
+	c.completionMu.Lock()
+	defer c.completionMu.Unlock()
+	state, ok := c.completions[infoHash]
+	return ok && state.playable[fileIndex]
+}
+
+// watchLocked starts the completion watcher of a torrent added under
+// infoHash, keeping what was already reported for it; the caller must hold
+// torrentsLock
+func (c *Client) watchLocked(infoHash string, t *torrent.Torrent) {
+	c.completionMu.Lock()
+	if _, ok := c.completions[infoHash]; !ok {
+		c.completions[infoHash] = &completionState{playable: make(map[int]bool)}
+	}
+	c.completionMu.Unlock()
+	go c.supervise(infoHash, "watch completion", func() { c.watchCompletion(infoHash, t) })
+}
+
+// forgetCompletion drops the reported milestones of a removed torrent
+func (c *Client) forgetCompletion(infoHash string) {
+	c.completionMu.Lock()
+	defer c.completionMu.Unlock()
+	delete(c.completions, infoHash)
+}
+
+// watchCompletion reports the milestones of t until it is dropped. It waits
+// for the metadata, checks the pieces already on disk and then follows the
+// piece state changes published by anacrolix/torrent, so nothing polls.
+func (c *Client) watchCompletion(infoHash string, t *torrent.Torrent) {
+	select {
+	case <-t.GotInfo():
+	case <-t.Closed():
+		return
+	case <-c.closed:
+		return
+	}
+
+	pieces := t.SubscribePieceStateChanges()
+	defer pieces.Close()
+
+	files := t.Files()
+	c.checkFiles(infoHash, files, -1)
+	complete := t.Complete().On()
+
+	for {
+		select {
+		case change, ok := <-pieces.Values:
+			if !ok {
+				return
+			}
+			if change.Complete {
+				c.checkFiles(infoHash, files, change.Index)
+			}
+		case <-complete:
+			// The channel stays closed once complete
+			complete = nil
+			c.report(infoHash, Completion{Kind: TorrentComplete, InfoHash: infoHash}, func(s *completionState) bool {
+				if s.complete {
+					return false
+				}
+				s.complete = true
+				return true
+			})
+		case <-t.Closed():
+			return
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// checkFiles reports the video files that became playable, only those
+// covering piece unless it is negative
+func (c *Client) checkFiles(infoHash string, files []*torrent.File, piece int) {
+	for i, f := range files {
+		if piece >= 0 && (piece < f.BeginPieceIndex() || piece >= f.EndPieceIndex()) {
+			continue
+		}
+		if c.isPlayable(infoHash, i) || !c.filePlayable(f) {
+			continue
+		}
+		length, completed := f.Length(), f.BytesCompleted()
+		file := &FileInfo{
+			Path:           f.DisplayPath(),
+			Length:         length,
+			Progress:       float32(completed) / float32(length),
+			BytesCompleted: completed,
+			FileIndex:      i,
+			TorrentID:      infoHash,
+			IsVideo:        true,
+			IsPlayable:     true,
+			PlayableBytes:  contiguousBytes(f, 0),
+		}
+		c.report(infoHash, Completion{Kind: FilePlayable, InfoHash: infoHash, File: file}, func(s *completionState) bool {
+			if s.playable[i] {
+				return false
+			}
+			s.playable[i] = true
+			return true
+		})
+	}
+}
+
+// report records a milestone with mark, which returns false when it was
+// already reported, and passes new ones to the completion handler. Nothing is
+// reported for torrents removed in the meantime.
+func (c *Client) report(infoHash string, completion Completion, mark func(*completionState) bool) {
+	c.completionMu.Lock()
+	state, ok := c.completions[infoHash]
+	if !ok || !mark(state) {
+		c.completionMu.Unlock()
+		return
+	}
+	fn := c.onCompletion
+	c.completionMu.Unlock()
+
+	if fn != nil {
+		fn(completion)
+	}
+}
+
+// filePlayable reports whether enough of a video file has been downloaded to
+// start playing it. Players read from the start, so only bytes downloaded
+// without a gap from offset 0 count: playableHead or 5% of the file, or 2% of
+// files under 10 MiB. The end of the file, where MP4 and MKV files often keep
+// their index, must be downloaded as well, as far as prioritizeEdges
+// requests it.
+func (c *Client) filePlayable(f *torrent.File) bool {
+	if !isVideoFile(strings.ToLower(filepath.Ext(f.DisplayPath()))) {
+		return false
+	}
+	length := f.Length()
+	if length == 0 {
+		return false
+	}
+
+	need := min(playableHead, (length+19)/20)
+	if length < 2*playableHead {
+		need = (length + 49) / 50
+	}
+	if contiguousBytes(f, 0) < need {
+		return false
+	}
+
+	tail := min(c.readahead.EdgeBytes, length)
+	return tail <= 0 || contiguousBytes(f, length-tail) == tail
+}
@@ -0,0 +1,227 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Piece lengths accepted by CreateTorrent. Smaller pieces cost more hashes
+// and messages, larger ones hold back streaming until a whole piece arrived.
+const (
+	MinPieceLength = 16 << 10
+	MaxPieceLength = 16 << 20
+)
+
+// createdBy is written to the created_by field of created torrents
+const createdBy = "magnet-player"
+
+// ErrNoFiles is returned when there is nothing to put in a torrent
+var ErrNoFiles = errors.New("no files to add to the torrent")
+
+// CreateOptions describes a torrent built from local files
+type CreateOptions struct {
+	// Root is the file or directory to share; its base name becomes the
+	// torrent's name. Hidden files and directories below it are left out.
+	Root string
+	// PieceLength is a power of two between MinPieceLength and
+	// MaxPieceLength; 0 picks one giving about 1000 to 2000 pieces
+	PieceLength int64
+	// Trackers are announced to in order, one tier each
+	Trackers []string
+	// Private sets the BEP 27 flag, so the torrent is only shared through
+	// its trackers and runs in the private client
+	Private bool
+	Comment string
+}
+
+// CreatedTorrent is a torrent built by CreateTorrent
+type CreatedTorrent struct {
+	InfoHash    string `json:"infoHash"`
+	Name        string `json:"name"`
+	MagnetURI   string `json:"magnetUri"`
+	Length      int64  `json:"length"`
+	Files       int    `json:"files"`
+	PieceLength int64  `json:"pieceLength"`
+	Pieces      int    `json:"pieces"`
+	Private     bool   `json:"private"`
+	// DataPath is the directory holding the torrent's data, empty when it
+	// is the client's data directory
+	DataPath string `json:"dataPath"`
+	// Torrent is the bencoded .torrent file
+	Torrent []byte `json:"torrent"`
+	New     bool   `json:"new"`
+}
+
+// CreateTorrent hashes the files under opts.Root into a new torrent and adds
+// it to the client, seeding from the files in place. Hashing reads all the
+// data and stops when ctx is done. The pieces are checked once more when the
+// torrent is added, as for an import. Creating a torrent that already runs,
+// i.e. the same files with the same piece length and private flag, returns
+// it with New unset.
+func (c *Client) CreateTorrent(ctx context.Context, opts CreateOptions) (*CreatedTorrent, error) {
+	root := filepath.Clean(opts.Root)
+	info := metainfo.Info{
+		Name:        filepath.Base(root),
+		PieceLength: opts.PieceLength,
+	}
+	if opts.Private {
+		private := true
+		info.Private = &private
+	}
+	if err := addInfoFiles(&info, root); err != nil {
+		return nil, err
+	}
+	if info.PieceLength == 0 {
+		info.PieceLength = metainfo.ChoosePieceLength(info.TotalLength())
+	}
+	err := info.GeneratePieces(func(fi metainfo.FileInfo) (io.ReadCloser, error) {
+		path := root
+		if len(fi.Path) > 0 {
+			path = filepath.Join(root, filepath.Join(fi.Path...))
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return ctxReadCloser{ctx, f}, nil
+	})
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("hash files: %w", err)
+	}
+
+	mi := &metainfo.MetaInfo{
+		Comment:      opts.Comment,
+		CreatedBy:    createdBy,
+		CreationDate: time.Now().Unix(),
+	}
+	if len(opts.Trackers) > 0 {
+		mi.Announce = opts.Trackers[0]
+		for _, tracker := range opts.Trackers {
+			mi.AnnounceList = append(mi.AnnounceList, []string{tracker})
+		}
+	}
+	if mi.InfoBytes, err = bencode.Marshal(info); err != nil {
+		return nil, fmt.Errorf("encode info: %w", err)
+	}
+	var torrentFile bytes.Buffer
+	if err := mi.Write(&torrentFile); err != nil {
+		return nil, fmt.Errorf("encode torrent: %w", err)
+	}
+
+	// 数据在数据目录中时按普通种子添加，否则像导入的种子一样使用其所在目录
+	dataPath := filepath.Dir(root)
+	if sameDir(dataPath, c.config.DataDir) {
+		dataPath = ""
+	}
+	added, err := c.ImportTorrent(ImportSource{MetaInfo: mi, DataPath: dataPath})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreatedTorrent{
+		InfoHash:    added.InfoHash,
+		Name:        info.Name,
+		MagnetURI:   mi.Magnet(nil, &info).String(),
+		Length:      info.TotalLength(),
+		Files:       len(info.UpvertedFiles()),
+		PieceLength: info.PieceLength,
+		Pieces:      info.NumPieces(),
+		Private:     added.Private,
+		DataPath:    dataPath,
+		Torrent:     torrentFile.Bytes(),
+		New:         added.New,
+	}, nil
+}
+
+// addInfoFiles sets the length or file list of info from the regular files
+// at root, skipping hidden ones and symlinks
+func addInfoFiles(info *metainfo.Info, root string) error {
+	stat, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		if !stat.Mode().IsRegular() || stat.Size() == 0 {
+			return ErrNoFiles
+		}
+		info.Length = stat.Size()
+		return nil
+	}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		info.Files = append(info.Files, metainfo.FileInfo{
+			Path:   strings.Split(filepath.ToSlash(rel), "/"),
+			Length: fi.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if info.TotalLength() == 0 {
+		return ErrNoFiles
+	}
+	sort.Slice(info.Files, func(i, j int) bool {
+		return strings.Join(info.Files[i].Path, "/") < strings.Join(info.Files[j].Path, "/")
+	})
+	return nil
+}
+
+// sameDir reports whether a and b name the same directory
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// ctxReadCloser fails reads once its context is done, so hashing a large
+// directory can be cancelled
+type ctxReadCloser struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (r ctxReadCloser) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(p)
+}
@@ -0,0 +1,481 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/tracker"
+	"github.com/anacrolix/upnp"
+)
+
+// ErrTorrentNotFound is returned when the info hash is unknown to the client
+var ErrTorrentNotFound = errors.New("torrent not found")
+
+const (
+	// peerSampleInterval is how often peer counts are recorded for every torrent
+	peerSampleInterval = 30 * time.Second
+	// peerHistoryLimit keeps one hour of samples per torrent
+	peerHistoryLimit = 120
+	// diagnosticsProbeTimeout bounds each tracker/DHT/UPnP probe so the report stays responsive
+	diagnosticsProbeTimeout = 10 * time.Second
+)
+
+// PeerSample is a point-in-time snapshot of a torrent's swarm
+type PeerSample struct {
+	Time             time.Time `json:"time"`
+	TotalPeers       int       `json:"totalPeers"`
+	PendingPeers     int       `json:"pendingPeers"`
+	ActivePeers      int       `json:"activePeers"`
+	ConnectedSeeders int       `json:"connectedSeeders"`
+	HalfOpenPeers    int       `json:"halfOpenPeers"`
+	// WebRTCPeers are the active peers connected over WebRTC, usually browsers
+	WebRTCPeers int `json:"webrtcPeers"`
+}
+
+// TrackerStatus is the result of announcing to a single tracker
+type TrackerStatus struct {
+	URL             string `json:"url"`
+	Tier            int    `json:"tier"`
+	OK              bool   `json:"ok"`
+	Error           string `json:"error,omitempty"`
+	Peers           int    `json:"peers"`
+	Seeders         int32  `json:"seeders"`
+	Leechers        int32  `json:"leechers"`
+	IntervalSeconds int32  `json:"intervalSeconds"`
+	LatencyMs       int64  `json:"latencyMs"`
+}
+
+// DHTServerStatus describes one DHT server and the outcome of announcing on it
+type DHTServerStatus struct {
+	Addr          string      `json:"addr"`
+	Stats         interface{} `json:"stats"`
+	AnnounceOK    bool        `json:"announceOk"`
+	AnnounceError string      `json:"announceError,omitempty"`
+	PeersFound    int         `json:"peersFound"`
+	Responses     int         `json:"responses"`
+}
+
+// DHTStatus aggregates the DHT servers of the client
+type DHTStatus struct {
+	Enabled bool              `json:"enabled"`
+	Servers []DHTServerStatus `json:"servers"`
+}
+
+// UPnPGateway is a UPnP device discovered on the local network
+type UPnPGateway struct {
+	ID         string `json:"id"`
+	LocalIP    string `json:"localIp"`
+	ExternalIP string `json:"externalIp,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// PortMappingStatus describes how reachable the client is for incoming peers
+type PortMappingStatus struct {
+	Enabled     bool          `json:"enabled"`
+	LocalPort   int           `json:"localPort"`
+	ListenAddrs []string      `json:"listenAddrs"`
+	PublicIPs   []string      `json:"publicIps"`
+	Gateways    []UPnPGateway `json:"gateways"`
+	Mappings    []PortMapping `json:"mappings"`
+}
+
+// HashFailureStats counts piece verification results
+type HashFailureStats struct {
+	PiecesVerified int64    `json:"piecesVerified"`
+	PiecesFailed   int64    `json:"piecesFailed"`
+	BadPeerIPs     []string `json:"badPeerIps"`
+}
+
+// Diagnostics is the full "why isn't this downloading" report for a torrent
+type Diagnostics struct {
+	InfoHash       string            `json:"infoHash"`
+	Name           string            `json:"name"`
+	HasMetadata    bool              `json:"hasMetadata"`
+	Private        bool              `json:"private"`
+	Complete       bool              `json:"complete"`
+	PiecesComplete int               `json:"piecesComplete"`
+	NumPieces      int               `json:"numPieces"`
+	BytesRead      int64             `json:"bytesRead"`
+	BytesUseful    int64             `json:"bytesUseful"`
+	BytesWritten   int64             `json:"bytesWritten"`
+	KnownPeers     int               `json:"knownPeers"`
+	Peers          PeerSample        `json:"peers"`
+	PeerHistory    []PeerSample      `json:"peerHistory"`
+	Trackers       []TrackerStatus   `json:"trackers"`
+	DHT            DHTStatus         `json:"dht"`
+	PortMapping    PortMappingStatus `json:"portMapping"`
+	HashFailures   HashFailureStats  `json:"hashFailures"`
+	Hints          []string          `json:"hints"`
+	GeneratedAt    time.Time         `json:"generatedAt"`
+}
+
+// peerHistory is a bounded ring of peer samples per torrent
+type peerHistory struct {
+	mu      sync.Mutex
+	samples map[string][]PeerSample
+}
+
+func newPeerHistory() *peerHistory {
+	return &peerHistory{samples: make(map[string][]PeerSample)}
+}
+
+// record appends a sample if the torrent is still tracked. The sampler lists
+// torrents before recording, so a torrent may be removed and forgotten in
+// between; checking under the lock keeps its history from coming back.
+func (h *peerHistory) record(infoHash string, sample PeerSample, tracked func(infoHash string) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !tracked(infoHash) {
+		return
+	}
+	samples := append(h.samples[infoHash], sample)
+	if len(samples) > peerHistoryLimit {
+		samples = samples[len(samples)-peerHistoryLimit:]
+	}
+	h.samples[infoHash] = samples
+}
+
+func (h *peerHistory) get(infoHash string) []PeerSample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]PeerSample(nil), h.samples[infoHash]...)
+}
+
+// forget drops the samples of a removed torrent
+func (h *peerHistory) forget(infoHash string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.samples, infoHash)
+}
+
+// samplePeers periodically records peer counts until the client is closed
+func (c *Client) samplePeers() {
+	ticker := time.NewTicker(peerSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			for _, t := range append(c.client.Torrents(), c.privateClient.Torrents()...) {
+				c.peerHistory.record(t.InfoHash().HexString(), peerSample(t), c.tracked)
+			}
+		}
+	}
+}
+
+// tracked reports whether a torrent is in the client, it is false as soon
+// as RemoveTorrent starts
+func (c *Client) tracked(infoHash string) bool {
+	_, ok := c.GetTorrent(infoHash)
+	return ok
+}
+
+func peerSample(t *torrent.Torrent) PeerSample {
+	stats := t.Stats()
+	return PeerSample{
+		Time:             time.Now(),
+		TotalPeers:       stats.TotalPeers,
+		PendingPeers:     stats.PendingPeers,
+		ActivePeers:      stats.ActivePeers,
+		ConnectedSeeders: stats.ConnectedSeeders,
+		HalfOpenPeers:    stats.HalfOpenPeers,
+		WebRTCPeers:      webrtcPeers(t),
+	}
+}
+
+// logger returns the logger the underlying client was configured with
+func (c *Client) logger() log.Logger {
+	if c.config.Logger.IsZero() {
+		return log.Default
+	}
+	return c.config.Logger
+}
+
+// lookupTorrent finds a torrent by info hash, including torrents that are still
+// waiting for metadata and therefore not yet tracked in c.torrents
+func (c *Client) lookupTorrent(infoHash string) (*torrent.Torrent, bool) {
+	if t, ok := c.GetTorrent(infoHash); ok {
+		return t, true
+	}
+
+	var hash metainfo.Hash
+	if err := hash.FromHexString(infoHash); err != nil {
+		return nil, false
+	}
+	if t, ok := c.client.Torrent(hash); ok {
+		return t, true
+	}
+	return c.privateClient.Torrent(hash)
+}
+
+// Diagnostics builds a structured report of everything that affects download
+// progress. When probe is true the trackers, DHT and UPnP gateways are queried
+// live, which can take up to diagnosticsProbeTimeout.
+func (c *Client) Diagnostics(ctx context.Context, infoHash string, probe bool) (*Diagnostics, error) {
+	t, ok := c.lookupTorrent(infoHash)
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+
+	cl := c.owner(t)
+	stats := t.Stats()
+	report := &Diagnostics{
+		InfoHash:       t.InfoHash().HexString(),
+		Name:           t.Name(),
+		HasMetadata:    t.Info() != nil,
+		Private:        c.isPrivate(t),
+		PiecesComplete: stats.PiecesComplete,
+		BytesRead:      stats.BytesRead.Int64(),
+		BytesUseful:    stats.BytesReadUsefulData.Int64(),
+		BytesWritten:   stats.BytesWritten.Int64(),
+		KnownPeers:     len(t.KnownSwarm()),
+		Peers:          peerSample(t),
+		PeerHistory:    c.peerHistory.get(infoHash),
+		HashFailures: HashFailureStats{
+			PiecesVerified: stats.PiecesDirtiedGood.Int64(),
+			PiecesFailed:   stats.PiecesDirtiedBad.Int64(),
+			BadPeerIPs:     cl.BadPeerIPs(),
+		},
+		GeneratedAt: time.Now(),
+	}
+	if report.HasMetadata {
+		report.NumPieces = t.NumPieces()
+		report.Complete = t.Complete().Bool()
+	}
+
+	report.PortMapping = PortMappingStatus{
+		Enabled:   c.portForwarding,
+		LocalPort: cl.LocalPort(),
+		Mappings:  c.PortForwarding().Mappings,
+	}
+	for _, addr := range cl.ListenAddrs() {
+		report.PortMapping.ListenAddrs = append(report.PortMapping.ListenAddrs, addr.String())
+	}
+	for _, ip := range cl.PublicIPs() {
+		report.PortMapping.PublicIPs = append(report.PortMapping.PublicIPs, ip.String())
+	}
+
+	// 私有种子不使用 DHT
+	report.DHT.Enabled = !c.config.NoDHT && !report.Private
+	report.Trackers = trackerList(t)
+
+	ctx, cancel := context.WithTimeout(ctx, diagnosticsProbeTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	if probe {
+		for i := range report.Trackers {
+			wg.Add(1)
+			go func(status *TrackerStatus) {
+				defer wg.Done()
+				c.probeTracker(ctx, t, status)
+			}(&report.Trackers[i])
+		}
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			report.DHT.Servers = c.probeDHT(ctx, t)
+		}()
+		go func() {
+			defer wg.Done()
+			if report.PortMapping.Enabled {
+				report.PortMapping.Gateways = probeUPnP(c.logger())
+			}
+		}()
+	} else {
+		for _, s := range cl.DhtServers() {
+			report.DHT.Servers = append(report.DHT.Servers, DHTServerStatus{
+				Addr:  s.Addr().String(),
+				Stats: s.Stats(),
+			})
+		}
+	}
+	wg.Wait()
+
+	report.Hints = diagnosticHints(report, probe)
+	return report, nil
+}
+
+// trackerList flattens the torrent's announce list into statuses ordered by tier
+func trackerList(t *torrent.Torrent) []TrackerStatus {
+	mi := t.Metainfo()
+	var statuses []TrackerStatus
+	seen := make(map[string]bool)
+
+	for tier, urls := range mi.UpvertedAnnounceList() {
+		for _, u := range urls {
+			if u == "" || seen[u] {
+				continue
+			}
+			seen[u] = true
+			statuses = append(statuses, TrackerStatus{URL: u, Tier: tier})
+		}
+	}
+	return statuses
+}
+
+// probeTracker performs a single announce against a tracker, records the
+// result and returns the peers the tracker handed out
+func (c *Client) probeTracker(ctx context.Context, t *torrent.Torrent, status *TrackerStatus) []tracker.Peer {
+	cl := c.owner(t)
+	left := int64(-1)
+	if t.Info() != nil {
+		left = t.BytesMissing()
+	}
+
+	start := time.Now()
+	resp, err := tracker.Announce{
+		TrackerUrl: status.URL,
+		Request: tracker.AnnounceRequest{
+			InfoHash: t.InfoHash(),
+			PeerId:   cl.PeerID(),
+			Left:     left,
+			Event:    tracker.None,
+			NumWant:  -1,
+			Port:     uint16(cl.LocalPort()),
+		},
+		Context: ctx,
+		Logger:  c.logger(),
+	}.Do()
+	status.LatencyMs = time.Since(start).Milliseconds()
+
+	if err != nil {
+		status.Error = err.Error()
+		return nil
+	}
+	status.OK = true
+	status.Peers = len(resp.Peers)
+	status.Seeders = resp.Seeders
+	status.Leechers = resp.Leechers
+	status.IntervalSeconds = resp.Interval
+	return resp.Peers
+}
+
+// probeDHT announces the torrent on each DHT server and counts the peers returned
+func (c *Client) probeDHT(ctx context.Context, t *torrent.Torrent) []DHTServerStatus {
+	cl := c.owner(t)
+	servers := cl.DhtServers()
+	statuses := make([]DHTServerStatus, len(servers))
+
+	var wg sync.WaitGroup
+	for i, s := range servers {
+		statuses[i] = DHTServerStatus{Addr: s.Addr().String()}
+
+		wg.Add(1)
+		go func(s torrent.DhtServer, status *DHTServerStatus) {
+			defer wg.Done()
+			defer func() { status.Stats = s.Stats() }()
+
+			announce, err := s.Announce(t.InfoHash(), cl.LocalPort(), false)
+			if err != nil {
+				status.AnnounceError = err.Error()
+				return
+			}
+			defer announce.Close()
+
+			peers := make(map[string]bool)
+			for {
+				select {
+				case <-ctx.Done():
+					status.AnnounceOK = status.Responses > 0
+					status.PeersFound = len(peers)
+					return
+				case values, ok := <-announce.Peers():
+					if !ok {
+						status.AnnounceOK = status.Responses > 0
+						status.PeersFound = len(peers)
+						return
+					}
+					status.Responses++
+					for _, p := range values.Peers {
+						peers[p.String()] = true
+					}
+				}
+			}
+		}(s, &statuses[i])
+	}
+	wg.Wait()
+
+	return statuses
+}
+
+// probeUPnP discovers UPnP gateways and asks each for its external address
+func probeUPnP(logger log.Logger) []UPnPGateway {
+	devices := upnp.Discover(0, 2*time.Second, logger)
+
+	gateways := make([]UPnPGateway, 0, len(devices))
+	for _, d := range devices {
+		gw := UPnPGateway{ID: d.ID()}
+		if ip := d.GetLocalIPAddress(); ip != nil {
+			gw.LocalIP = ip.String()
+		}
+		ip, err := d.GetExternalIPAddress()
+		if err != nil {
+			gw.Error = err.Error()
+		} else if ip != nil {
+			gw.ExternalIP = ip.String()
+		}
+		gateways = append(gateways, gw)
+	}
+
+	sort.Slice(gateways, func(i, j int) bool { return gateways[i].ID < gateways[j].ID })
+	return gateways
+}
+
+// diagnosticHints turns the raw report into human readable explanations
+func diagnosticHints(d *Diagnostics, probed bool) []string {
+	hints := []string{}
+
+	if !d.HasMetadata {
+		hints = append(hints, "metadata not received yet: at least one reachable peer is needed to fetch the torrent info")
+	}
+	if d.Peers.TotalPeers == 0 && d.KnownPeers == 0 {
+		hints = append(hints, "no peers discovered: the torrent may have no seeders")
+	} else if d.Peers.ActivePeers == 0 {
+		hints = append(hints, "peers are known but none are connected: they may be unreachable or blocked by a firewall")
+	}
+	if d.HashFailures.PiecesFailed > 0 {
+		hints = append(hints, fmt.Sprintf("%d pieces failed hash verification: some peers may be sending corrupt data", d.HashFailures.PiecesFailed))
+	}
+
+	if probed {
+		reachable := 0
+		for _, tr := range d.Trackers {
+			if tr.OK {
+				reachable++
+			}
+		}
+		if len(d.Trackers) > 0 && reachable == 0 {
+			hints = append(hints, "no tracker responded: check network connectivity and DNS")
+		}
+
+		if d.DHT.Enabled {
+			dhtPeers := 0
+			for _, s := range d.DHT.Servers {
+				dhtPeers += s.PeersFound
+			}
+			if dhtPeers == 0 {
+				hints = append(hints, "DHT returned no peers for this torrent")
+			}
+		}
+
+		if d.PortMapping.Enabled && len(d.PortMapping.Gateways) == 0 {
+			hints = append(hints, "no UPnP gateway found: incoming connections require a manual port forward")
+		}
+	}
+
+	return hints
+}
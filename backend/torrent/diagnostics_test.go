@@ -0,0 +1,49 @@
+package torrent
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestPeerHistoryRecordAfterForget covers a sampler that listed a torrent
+// before it was removed and records its sample after forget
+func TestPeerHistoryRecordAfterForget(t *testing.T) {
+	var mu sync.Mutex
+	active := map[string]bool{"abc": true, "def": true}
+	tracked := func(infoHash string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return active[infoHash]
+	}
+	remove := func(infoHash string) {
+		mu.Lock()
+		delete(active, infoHash)
+		mu.Unlock()
+	}
+
+	h := newPeerHistory()
+	h.record("abc", PeerSample{TotalPeers: 1}, tracked)
+	remove("abc")
+	h.forget("abc")
+	h.record("abc", PeerSample{TotalPeers: 2}, tracked)
+	if samples := h.get("abc"); len(samples) != 0 {
+		t.Errorf("removed torrent has %d samples after a late record", len(samples))
+	}
+
+	// the same with the sampler and the removal running concurrently
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			h.record("def", PeerSample{TotalPeers: i}, tracked)
+		}
+	}()
+	h.record("def", PeerSample{}, tracked)
+	remove("def")
+	h.forget("def")
+	wg.Wait()
+	if samples := h.get("def"); len(samples) != 0 {
+		t.Errorf("removed torrent has %d samples after concurrent records", len(samples))
+	}
+}
@@ -0,0 +1,157 @@
+package torrent
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// ImportSource describes a torrent whose data already exists on disk, typically
+// migrated from another BitTorrent client
+type ImportSource struct {
+	// MetaInfo is the parsed .torrent file; nil when only a magnet link is known
+	MetaInfo  *metainfo.MetaInfo
+	MagnetURI string
+	// DataPath is the directory containing the torrent's top-level file or folder
+	DataPath string
+	// Private adds the torrent to the private client even when MetaInfo is
+	// unknown, e.g. when restoring a private torrent from its magnet link
+	Private bool
+	// InfoBytes is the info dictionary saved from an earlier run, used with
+	// a magnet link so the metadata need not be fetched again
+	InfoBytes []byte
+}
+
+// ImportedTorrent is the result of importing a single torrent
+type ImportedTorrent struct {
+	InfoHash  string `json:"infoHash"`
+	Name      string `json:"name"`
+	MagnetURI string `json:"magnetUri"`
+	DataPath  string `json:"dataPath"`
+	Private   bool   `json:"private"`
+	New       bool   `json:"new"`
+}
+
+// ImportTorrent adds a torrent that stores its data at src.DataPath instead of
+// the client's data directory. Piece completion starts out unknown, so every
+// piece is hash-checked against the existing files and only missing or corrupt
+// pieces are downloaded. The result is recorded, so restoring the torrent
+// later does not check it all again. It does not block waiting for metadata; call
+// WaitForMetadata to start downloading, as with AddMagnetAsync.
+func (c *Client) ImportTorrent(src ImportSource) (*ImportedTorrent, error) {
+	var spec *torrent.TorrentSpec
+	var err error
+	if src.MetaInfo != nil {
+		spec, err = torrent.TorrentSpecFromMetaInfoErr(src.MetaInfo)
+	} else {
+		spec, err = torrent.TorrentSpecFromMagnetUri(src.MagnetURI)
+		if err == nil {
+			spec.InfoBytes = src.InfoBytes
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid torrent: %w", err)
+	}
+
+	infoHash := spec.InfoHash.HexString()
+	unlock := c.torrentLocks.lock(infoHash)
+	defer unlock()
+
+	// 已存在的种子直接返回，避免同一种子同时存在于两个客户端
+	if t, ok := c.GetTorrent(infoHash); ok {
+		return &ImportedTorrent{
+			InfoHash:  t.InfoHash().HexString(),
+			Name:      t.Name(),
+			MagnetURI: src.MagnetURI,
+			DataPath:  src.DataPath,
+			Private:   c.isPrivate(t),
+		}, nil
+	}
+
+	private := src.Private
+	if src.MetaInfo != nil {
+		if info, err := src.MetaInfo.UnmarshalInfo(); err == nil && isPrivateInfo(&info) {
+			private = true
+		}
+	}
+
+	if src.DataPath != "" {
+		stat, err := os.Stat(src.DataPath)
+		if err != nil || !stat.IsDir() {
+			return nil, fmt.Errorf("data path %s is not a directory", src.DataPath)
+		}
+
+		// 存储在种子自己的锁下创建，打开 piece 完成状态数据库时不阻塞其他种子
+		c.torrentsLock.RLock()
+		files, ok := c.storages[infoHash]
+		c.torrentsLock.RUnlock()
+		if !ok {
+			files, err = c.newImportedStorage(infoHash, src.DataPath)
+			if err != nil {
+				return nil, err
+			}
+			c.torrentsLock.Lock()
+			c.storages[infoHash] = files
+			c.dataDirs[infoHash] = src.DataPath
+			c.torrentsLock.Unlock()
+		}
+		spec.Storage = files
+	}
+
+	cl := c.client
+	if private {
+		cl = c.privateClient
+	}
+	t, isNew, err := cl.AddTorrentSpec(spec)
+	if err != nil && src.MetaInfo == nil && spec.InfoBytes != nil {
+		// 保存的元数据无效时退回到从 peer 获取
+		spec.InfoBytes = nil
+		t, isNew, err = cl.AddTorrentSpec(spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	magnetURI := src.MagnetURI
+	if src.MetaInfo != nil {
+		info, err := src.MetaInfo.UnmarshalInfo()
+		if err == nil {
+			magnetURI = src.MetaInfo.Magnet(nil, &info).String()
+		}
+	}
+
+	if isNew {
+		c.torrentsLock.Lock()
+		c.torrents[infoHash] = t
+		c.watchLocked(infoHash, t)
+		c.torrentsLock.Unlock()
+		c.applyMaxConnections(infoHash, t)
+		c.cacheTorrent(infoHash, t)
+	}
+
+	return &ImportedTorrent{
+		InfoHash:  t.InfoHash().HexString(),
+		Name:      t.Name(),
+		MagnetURI: magnetURI,
+		DataPath:  src.DataPath,
+		Private:   c.isPrivate(t),
+		New:       isNew,
+	}, nil
+}
+
+// MagnetFromTorrentFile reads a .torrent file and returns a magnet link
+// carrying its trackers, and whether the torrent is private
+func MagnetFromTorrentFile(r io.Reader) (string, bool, error) {
+	mi, err := metainfo.Load(r)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid torrent file: %w", err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return "", false, fmt.Errorf("invalid torrent info: %w", err)
+	}
+	return mi.Magnet(nil, &info).String(), isPrivateInfo(&info), nil
+}
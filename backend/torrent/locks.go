@@ -0,0 +1,51 @@
+package torrent
+
+import "sync"
+
+// torrentLocks serializes the operations that change one torrent, such as
+// pausing it or re-adding it with other trackers. anacrolix/torrent does that
+// work while only the torrent's own lock is held, so a torrent that is slow
+// to drop or re-add does not block the registry (torrentsLock) and with it
+// every other torrent.
+//
+// The lock order is a torrent's lock, then torrentsLock, then the snapshot
+// lock. A torrent's lock must never be taken while torrentsLock is held.
+type torrentLocks struct {
+	mu    sync.Mutex
+	locks map[string]*torrentLock
+}
+
+// torrentLock is the lock of one torrent, kept while anyone holds or waits
+// for it
+type torrentLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newTorrentLocks() *torrentLocks {
+	return &torrentLocks{locks: make(map[string]*torrentLock)}
+}
+
+// lock locks the torrent and returns the function that unlocks it
+func (l *torrentLocks) lock(infoHash string) func() {
+	l.mu.Lock()
+	tl, ok := l.locks[infoHash]
+	if !ok {
+		tl = &torrentLock{}
+		l.locks[infoHash] = tl
+	}
+	tl.refs++
+	l.mu.Unlock()
+
+	tl.Lock()
+	return func() {
+		tl.Unlock()
+
+		l.mu.Lock()
+		tl.refs--
+		if tl.refs == 0 {
+			delete(l.locks, infoHash)
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,364 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/upnp"
+)
+
+const (
+	// portMappingDiscoveryTimeout is how long to wait for UPnP gateways to answer
+	portMappingDiscoveryTimeout = 2 * time.Second
+	// inboundDialTimeout bounds the connection attempt to our own external address
+	inboundDialTimeout = 5 * time.Second
+	// dhtHealthyGoodNodes is the number of responsive nodes (one full bucket)
+	// above which a DHT server is considered bootstrapped
+	dhtHealthyGoodNodes = 8
+)
+
+// PortMapping is a port forward requested from a UPnP gateway
+type PortMapping struct {
+	Gateway      string `json:"gateway"`
+	LocalIP      string `json:"localIp,omitempty"`
+	ExternalIP   string `json:"externalIp,omitempty"`
+	Protocol     string `json:"protocol"`
+	InternalPort int    `json:"internalPort"`
+	ExternalPort int    `json:"externalPort,omitempty"`
+	OK           bool   `json:"ok"`
+	Error        string `json:"error,omitempty"`
+
+	device upnp.Device
+}
+
+// PortForwardingStatus is the outcome of mapping the listen ports
+type PortForwardingStatus struct {
+	Enabled bool `json:"enabled"`
+	// Finished is false while gateways are still being discovered
+	Finished bool          `json:"finished"`
+	Mappings []PortMapping `json:"mappings"`
+}
+
+// InboundCheck is the result of connecting to our own external address
+type InboundCheck struct {
+	Checked   bool   `json:"checked"`
+	Addr      string `json:"addr,omitempty"`
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+}
+
+// DHTServerHealth is the routing table of one DHT server
+type DHTServerHealth struct {
+	Addr                    string `json:"addr"`
+	GoodNodes               int    `json:"goodNodes"`
+	Nodes                   int    `json:"nodes"`
+	BadNodes                uint   `json:"badNodes"`
+	OutstandingTransactions int    `json:"outstandingTransactions"`
+	SuccessfulAnnounces     int64  `json:"successfulAnnounces"`
+}
+
+// DHTHealth summarises the DHT servers of the public client
+type DHTHealth struct {
+	Enabled bool              `json:"enabled"`
+	Healthy bool              `json:"healthy"`
+	Servers []DHTServerHealth `json:"servers"`
+}
+
+// NetworkCheck reports how reachable the client is for other peers
+type NetworkCheck struct {
+	ListenPort        int      `json:"listenPort"`
+	PrivateListenPort int      `json:"privateListenPort"`
+	ListenAddrs       []string `json:"listenAddrs"`
+	// BindInterface is the interface all torrent traffic is bound to
+	BindInterface string `json:"bindInterface,omitempty"`
+	// WebTorrent is true when browser peers can connect over WebRTC
+	WebTorrent     bool                 `json:"webtorrent"`
+	PortForwarding PortForwardingStatus `json:"portForwarding"`
+	ExternalIP     string               `json:"externalIp,omitempty"`
+	// ExternalIPSource is "upnp" or "http"
+	ExternalIPSource string       `json:"externalIpSource,omitempty"`
+	ExternalIPError  string       `json:"externalIpError,omitempty"`
+	Inbound          InboundCheck `json:"inbound"`
+	DHT              DHTHealth    `json:"dht"`
+	Hints            []string     `json:"hints"`
+	CheckedAt        time.Time    `json:"checkedAt"`
+}
+
+// forwardPorts maps the TCP and UDP listen ports of both clients on every
+// UPnP gateway and records the outcome for NetworkCheck
+func (c *Client) forwardPorts() {
+	devices := upnp.Discover(0, portMappingDiscoveryTimeout, c.logger())
+	ports := []int{c.client.LocalPort(), c.privateClient.LocalPort()}
+
+	for _, d := range devices {
+		var localIP, externalIP string
+		if ip := d.GetLocalIPAddress(); ip != nil {
+			localIP = ip.String()
+		}
+		if ip, err := d.GetExternalIPAddress(); err == nil && ip != nil {
+			externalIP = ip.String()
+		}
+
+		for _, port := range ports {
+			for _, proto := range []upnp.Protocol{upnp.TCP, upnp.UDP} {
+				m := PortMapping{
+					Gateway:      d.ID(),
+					LocalIP:      localIP,
+					ExternalIP:   externalIP,
+					Protocol:     string(proto),
+					InternalPort: port,
+					device:       d,
+				}
+				external, err := d.AddPortMapping(proto, port, port, c.config.UpnpID, 0)
+				if err != nil {
+					m.Error = err.Error()
+				} else {
+					m.OK = true
+					m.ExternalPort = external
+				}
+
+				c.portMu.Lock()
+				select {
+				case <-c.closed:
+					// Close has already cleared the mappings
+					c.portMu.Unlock()
+					if m.OK {
+						d.DeletePortMapping(proto, external)
+					}
+					return
+				default:
+				}
+				c.portMappings = append(c.portMappings, m)
+				c.portMu.Unlock()
+			}
+		}
+	}
+
+	c.portMu.Lock()
+	c.portMapped = true
+	c.portMu.Unlock()
+}
+
+// clearPortMappings removes the port forwards created by forwardPorts
+func (c *Client) clearPortMappings() {
+	c.portMu.Lock()
+	mappings := c.portMappings
+	c.portMappings = nil
+	c.portMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, m := range mappings {
+		if !m.OK {
+			continue
+		}
+		wg.Add(1)
+		go func(m PortMapping) {
+			defer wg.Done()
+			m.device.DeletePortMapping(upnp.Protocol(m.Protocol), m.ExternalPort)
+		}(m)
+	}
+	wg.Wait()
+}
+
+// PortForwarding returns the outcome of mapping the listen ports
+func (c *Client) PortForwarding() PortForwardingStatus {
+	c.portMu.Lock()
+	defer c.portMu.Unlock()
+
+	return PortForwardingStatus{
+		Enabled:  c.portForwarding,
+		Finished: !c.portForwarding || c.portMapped,
+		Mappings: append([]PortMapping{}, c.portMappings...),
+	}
+}
+
+// DHTHealth reports the routing tables of the public client's DHT servers
+func (c *Client) DHTHealth() DHTHealth {
+	health := DHTHealth{
+		Enabled: !c.config.NoDHT,
+		Servers: []DHTServerHealth{},
+	}
+	for _, s := range c.client.DhtServers() {
+		server := DHTServerHealth{Addr: s.Addr().String()}
+		if stats, ok := s.Stats().(dht.ServerStats); ok {
+			server.GoodNodes = stats.GoodNodes
+			server.Nodes = stats.Nodes
+			server.BadNodes = stats.BadNodes
+			server.OutstandingTransactions = stats.OutstandingTransactions
+			server.SuccessfulAnnounces = stats.SuccessfulOutboundAnnouncePeerQueries
+		}
+		if server.GoodNodes >= dhtHealthyGoodNodes {
+			health.Healthy = true
+		}
+		health.Servers = append(health.Servers, server)
+	}
+	return health
+}
+
+// CheckNetwork reports the listen ports, port forwarding and DHT state, and
+// tests whether the listen port accepts connections on the external address.
+// The external address is taken from a UPnP gateway or, failing that, from
+// ipCheckURL, which must answer with the caller's IP as plain text.
+func (c *Client) CheckNetwork(ctx context.Context, ipCheckURL string) *NetworkCheck {
+	ctx, cancel := context.WithTimeout(ctx, diagnosticsProbeTimeout)
+	defer cancel()
+
+	check := &NetworkCheck{
+		ListenPort:        c.client.LocalPort(),
+		PrivateListenPort: c.privateClient.LocalPort(),
+		ListenAddrs:       []string{},
+		BindInterface:     c.binding.iface,
+		WebTorrent:        !c.config.DisableWebtorrent,
+		PortForwarding:    c.PortForwarding(),
+		DHT:               c.DHTHealth(),
+		CheckedAt:         time.Now(),
+	}
+	// TCP 和 UDP 监听同一地址，只列出一次
+	seen := make(map[string]bool)
+	for _, addr := range c.client.ListenAddrs() {
+		if !seen[addr.String()] {
+			seen[addr.String()] = true
+			check.ListenAddrs = append(check.ListenAddrs, addr.String())
+		}
+	}
+
+	// 优先使用端口映射成功的网关报告的外网地址和端口
+	port := check.ListenPort
+	for _, m := range check.PortForwarding.Mappings {
+		if m.OK && m.Protocol == string(upnp.TCP) && m.InternalPort == check.ListenPort && m.ExternalIP != "" {
+			check.ExternalIP = m.ExternalIP
+			check.ExternalIPSource = "upnp"
+			port = m.ExternalPort
+			break
+		}
+	}
+	if check.ExternalIP == "" && ipCheckURL != "" {
+		// 绑定网卡时通过该网卡查询，得到的是 VPN 的出口地址
+		ip, err := fetchExternalIP(ctx, c.binding.httpClient(), ipCheckURL)
+		if err != nil {
+			check.ExternalIPError = err.Error()
+		} else {
+			check.ExternalIP = ip.String()
+			check.ExternalIPSource = "http"
+		}
+	}
+
+	if check.ExternalIP != "" && port > 0 {
+		check.Inbound = probeInbound(ctx, net.JoinHostPort(check.ExternalIP, strconv.Itoa(port)))
+	}
+
+	check.Hints = networkHints(check)
+	return check
+}
+
+// fetchExternalIP asks an IP echo service for our external address
+func fetchExternalIP(ctx context.Context, client *http.Client, url string) (net.IP, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("external IP lookup returned HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return nil, fmt.Errorf("external IP lookup returned %q", strings.TrimSpace(string(body)))
+	}
+	return ip, nil
+}
+
+// probeInbound connects to addr over TCP. Behind a NAT this only succeeds when
+// the port is forwarded and the router supports hairpin connections.
+func probeInbound(ctx context.Context, addr string) InboundCheck {
+	check := InboundCheck{Checked: true, Addr: addr}
+
+	dialer := net.Dialer{Timeout: inboundDialTimeout}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	check.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	conn.Close()
+	check.Reachable = true
+	return check
+}
+
+// isLocalIP reports whether ip is assigned to one of this host's interfaces
+func isLocalIP(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// networkHints turns the network check into human readable explanations
+func networkHints(n *NetworkCheck) []string {
+	hints := []string{}
+
+	if n.PortForwarding.Enabled && n.PortForwarding.Finished {
+		mapped := false
+		for _, m := range n.PortForwarding.Mappings {
+			if m.OK {
+				mapped = true
+				break
+			}
+		}
+		if len(n.PortForwarding.Mappings) == 0 {
+			hints = append(hints, "no UPnP gateway found: forward the listen port on the router manually, and set TORRENT_LISTEN_PORT so it does not change on restart")
+		} else if !mapped {
+			hints = append(hints, "the UPnP gateway refused every port mapping: forward the listen port on the router manually")
+		}
+	} else if n.PortForwarding.Enabled {
+		hints = append(hints, "port forwarding is still in progress")
+	} else if n.BindInterface != "" {
+		hints = append(hints, fmt.Sprintf("traffic is bound to %s, so UPnP port forwarding is skipped: forward the listen port with the VPN provider if it supports it", n.BindInterface))
+	}
+	if n.BindInterface != "" {
+		hints = append(hints, "WebTorrent is off while traffic is bound to an interface, because WebRTC connections cannot be bound to it: browser peers cannot connect")
+	}
+
+	switch {
+	case n.ExternalIP == "":
+		hints = append(hints, "the external IP address is unknown, so inbound reachability was not tested")
+	case n.Inbound.Reachable:
+	case isLocalIP(net.ParseIP(n.ExternalIP)):
+		hints = append(hints, "the listen port is not reachable on this host's public address: check the firewall")
+	default:
+		hints = append(hints, "the listen port is not reachable from the external address: peers cannot connect to us, which limits download speed. Routers without NAT loopback also fail this check even when the port is forwarded")
+	}
+
+	if !n.DHT.Enabled {
+		hints = append(hints, "DHT is disabled: magnets without trackers cannot find peers")
+	} else if !n.DHT.Healthy {
+		hints = append(hints, fmt.Sprintf("DHT has fewer than %d responsive nodes: it may still be bootstrapping, or UDP traffic is blocked", dhtHealthyGoodNodes))
+	}
+
+	return hints
+}
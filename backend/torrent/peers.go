@@ -0,0 +1,122 @@
+package torrent
+
+import (
+	"github.com/anacrolix/torrent"
+)
+
+// PeerOptions are the connection limits and peer sources of the public
+// client. Private torrents never use DHT or PEX.
+type PeerOptions struct {
+	// MaxConnsPerTorrent is the default number of established connections
+	// of a torrent, see SetMaxConnections
+	MaxConnsPerTorrent int
+	// MaxPeersPerTorrent caps the known peers kept for a torrent; it is read
+	// when the client is created
+	MaxPeersPerTorrent int
+	// DisableDHT and DisablePEX turn off peer discovery for all public
+	// torrents; anacrolix/torrent reads them when the client is created
+	DisableDHT bool
+	DisablePEX bool
+	// DisableWebTorrent turns off WebRTC connections to browser peers found
+	// through WebTorrent (wss://) trackers, for public and private torrents
+	DisableWebTorrent bool
+}
+
+// apply sets the limits on cfg; the peer sources are set by the caller since
+// they differ between the public and private clients
+func (o PeerOptions) apply(cfg *torrent.ClientConfig) {
+	if o.MaxConnsPerTorrent > 0 {
+		cfg.EstablishedConnsPerTorrent = o.MaxConnsPerTorrent
+	}
+	if o.MaxPeersPerTorrent > 0 {
+		cfg.TorrentPeersHighWater = o.MaxPeersPerTorrent
+	}
+}
+
+// Peers returns the peer options the client was created with. The default
+// connection limit reflects later calls to SetMaxConnections.
+func (c *Client) Peers() PeerOptions {
+	c.torrentsLock.RLock()
+	defer c.torrentsLock.RUnlock()
+	peers := c.peers
+	peers.MaxConnsPerTorrent = c.maxConnsPerTorrent
+	return peers
+}
+
+// SetMaxConnections changes the default connection limit. It applies right
+// away to running torrents without their own limit.
+func (c *Client) SetMaxConnections(n int) {
+	if n <= 0 {
+		return
+	}
+
+	c.torrentsLock.Lock()
+	c.maxConnsPerTorrent = n
+	var defaults []string
+	for infoHash := range c.torrents {
+		if _, ok := c.connLimits[infoHash]; !ok {
+			defaults = append(defaults, infoHash)
+		}
+	}
+	c.torrentsLock.Unlock()
+
+	for _, infoHash := range defaults {
+		unlock := c.torrentLocks.lock(infoHash)
+		if t, ok := c.GetTorrent(infoHash); ok {
+			c.applyMaxConnections(infoHash, t)
+		}
+		unlock()
+	}
+}
+
+// SetTorrentMaxConnections sets the connection limit of one torrent, 0
+// returns it to the default
+func (c *Client) SetTorrentMaxConnections(infoHash string, n int) error {
+	unlock := c.torrentLocks.lock(infoHash)
+	defer unlock()
+
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return ErrTorrentNotFound
+	}
+
+	c.torrentsLock.Lock()
+	if n > 0 {
+		c.connLimits[infoHash] = n
+	} else {
+		delete(c.connLimits, infoHash)
+	}
+	c.torrentsLock.Unlock()
+	c.applyMaxConnections(infoHash, t)
+	return nil
+}
+
+// MaxConnections returns the connection limit in effect for a torrent
+func (c *Client) MaxConnections(infoHash string) int {
+	c.torrentsLock.RLock()
+	defer c.torrentsLock.RUnlock()
+	return c.maxConnectionsLocked(infoHash)
+}
+
+// maxConnectionsLocked returns the torrent's own limit or the default; the
+// caller must hold torrentsLock
+func (c *Client) maxConnectionsLocked(infoHash string) int {
+	if n, ok := c.connLimits[infoHash]; ok {
+		return n
+	}
+	return c.maxConnsPerTorrent
+}
+
+// applyMaxConnections sets the torrent's connection limit unless it is
+// paused, in which case Resume applies it; the caller must hold the torrent's
+// lock but not torrentsLock
+func (c *Client) applyMaxConnections(infoHash string, t *torrent.Torrent) {
+	c.torrentsLock.RLock()
+	paused := c.paused[infoHash]
+	n := c.maxConnectionsLocked(infoHash)
+	c.torrentsLock.RUnlock()
+
+	if !paused {
+		t.SetMaxEstablishedConns(n)
+	}
+}
@@ -0,0 +1,105 @@
+package torrent
+
+// PieceMap is the state of every piece of a torrent, compact enough to poll
+// for a piece-map visualization of torrents with many thousands of pieces
+type PieceMap struct {
+	InfoHash    string `json:"infoHash"`
+	NumPieces   int    `json:"numPieces"`
+	PieceLength int64  `json:"pieceLength"`
+	// Completed is a bitfield of the verified pieces. As in the BitTorrent
+	// protocol the high bit of the first byte is piece 0. Like every byte
+	// slice it is base64 encoded in JSON.
+	Completed []byte `json:"completed"`
+	// Partial is a bitfield of the pieces of which some data has arrived
+	// but that are not verified yet
+	Partial []byte `json:"partial"`
+	// Availability holds one byte per piece: how many connected peers have
+	// it, capped at 255
+	Availability []byte `json:"availability"`
+	// Histogram[n] is the number of pieces exactly n connected peers have
+	Histogram []int `json:"histogram"`
+	Peers     int   `json:"peers"`
+	// Files maps each file to the pieces it spans
+	Files []FilePieces `json:"files"`
+}
+
+// FilePieces locates a file within the pieces of its torrent
+type FilePieces struct {
+	FileIndex int    `json:"fileIndex"`
+	Path      string `json:"path"`
+	// Offset is where the file starts in the torrent's data, so byte b of
+	// the file is in piece (Offset+b)/PieceLength
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+	// BeginPiece and EndPiece are the half-open range of pieces that hold
+	// the file
+	BeginPiece int `json:"beginPiece"`
+	EndPiece   int `json:"endPiece"`
+}
+
+// GetPieceMap returns the piece states and availability of a torrent
+func (c *Client) GetPieceMap(infoHash string) (*PieceMap, error) {
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+	info := t.Info()
+	if info == nil {
+		return nil, ErrMetadataIncomplete
+	}
+
+	numPieces := t.NumPieces()
+	pieces := &PieceMap{
+		InfoHash:     infoHash,
+		NumPieces:    numPieces,
+		PieceLength:  info.PieceLength,
+		Completed:    make([]byte, (numPieces+7)/8),
+		Partial:      make([]byte, (numPieces+7)/8),
+		Availability: make([]byte, numPieces),
+		Files:        make([]FilePieces, 0, len(t.Files())),
+	}
+
+	// Runs of equal state are far fewer than pieces on most torrents
+	index := 0
+	for _, run := range t.PieceStateRuns() {
+		for end := index + run.Length; index < end; index++ {
+			switch {
+			case run.Complete:
+				pieces.Completed[index/8] |= 0x80 >> (index % 8)
+			case run.Partial:
+				pieces.Partial[index/8] |= 0x80 >> (index % 8)
+			}
+		}
+	}
+
+	counts := make([]int, numPieces)
+	for _, conn := range t.PeerConns() {
+		pieces.Peers++
+		conn.PeerPieces().Iterate(func(piece uint32) bool {
+			if int(piece) >= numPieces {
+				return false
+			}
+			counts[piece]++
+			return true
+		})
+	}
+	for i, count := range counts {
+		pieces.Availability[i] = byte(min(count, 255))
+		for len(pieces.Histogram) <= count {
+			pieces.Histogram = append(pieces.Histogram, 0)
+		}
+		pieces.Histogram[count]++
+	}
+
+	for i, f := range t.Files() {
+		pieces.Files = append(pieces.Files, FilePieces{
+			FileIndex:  i,
+			Path:       f.DisplayPath(),
+			Offset:     f.Offset(),
+			Length:     f.Length(),
+			BeginPiece: f.BeginPieceIndex(),
+			EndPiece:   f.EndPieceIndex(),
+		})
+	}
+	return pieces, nil
+}
@@ -0,0 +1,55 @@
+package torrent
+
+import (
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// isPrivateInfo reports whether an info dictionary carries the BEP 27 private flag
+func isPrivateInfo(info *metainfo.Info) bool {
+	return info != nil && info.Private != nil && *info.Private
+}
+
+// isPrivate reports whether t runs in the private client
+func (c *Client) isPrivate(t *torrent.Torrent) bool {
+	pt, ok := c.privateClient.Torrent(t.InfoHash())
+	return ok && pt == t
+}
+
+// owner returns the underlying client t was added to
+func (c *Client) owner(t *torrent.Torrent) *torrent.Client {
+	if c.isPrivate(t) {
+		return c.privateClient
+	}
+	return c.client
+}
+
+// moveToPrivate re-adds a torrent whose metadata turned out to be private to
+// the private client, without the public trackers added by AddMagnetAsync.
+// It runs before any data is downloaded, so nothing is lost by switching to
+// the private client's piece completion.
+func (c *Client) moveToPrivate(infoHash string) (*torrent.Torrent, error) {
+	unlock := c.torrentLocks.lock(infoHash)
+	defer unlock()
+
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+	if c.isPrivate(t) {
+		return t, nil
+	}
+
+	c.torrentsLock.Lock()
+	injected := make(map[string]bool, len(c.injected[infoHash]))
+	for _, u := range c.injected[infoHash] {
+		injected[u] = true
+	}
+	delete(c.injected, infoHash)
+	c.torrentsLock.Unlock()
+	announceList, _ := withoutTrackers(t, injected)
+
+	// 只保留磁力链接中直接给出的 peer，DHT、PEX 和公共 tracker 找到的 peer 不能用于私有种子
+	direct := func(p torrent.PeerInfo) bool { return p.Source == torrent.PeerSourceDirect }
+	return c.readd(infoHash, t, announceList, t.Metainfo().UrlList, c.privateClient, direct)
+}
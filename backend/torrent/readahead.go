@@ -0,0 +1,83 @@
+package torrent
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// assumedRuntime is used to estimate the bitrate of a file whose runtime is
+// unknown. Most files streamed are feature films; a shorter episode gets a
+// smaller readahead than configured, bounded below by ReadaheadOptions.Min.
+const assumedRuntime = 2 * time.Hour
+
+// ReadaheadOptions tune how far ahead of the read position file readers
+// request pieces, and which pieces of new torrents are downloaded first
+type ReadaheadOptions struct {
+	// Duration is how much playback to buffer ahead of the read position,
+	// converted to bytes with the bitrate estimated from the file length
+	// and its runtime
+	Duration time.Duration
+	// Min and Max bound the readahead in bytes. Max 0 means no upper bound.
+	Min int64
+	Max int64
+	// EdgeBytes at the start and the end of every video file are
+	// downloaded before the rest once the metadata arrives. Players read
+	// the container index there before they can play or seek: MP4 keeps
+	// its moov atom at either end and MKV its cues near the end.
+	EdgeBytes int64
+}
+
+// EstimateBitrate returns the average bitrate in bytes per second of a file
+// of the given length and playback runtime, assuming assumedRuntime if the
+// runtime is unknown (0)
+func EstimateBitrate(length int64, runtime time.Duration) float64 {
+	if runtime <= 0 {
+		runtime = assumedRuntime
+	}
+	return float64(length) / runtime.Seconds()
+}
+
+// readaheadFunc returns the readahead for a reader over a file of the given
+// length. The library default reads ahead as far as the reader has read
+// contiguously, so right after a seek almost nothing is requested and
+// playback stalls on cold regions. Starting from the bitrate-based target
+// keeps the player fed right away; long contiguous reads still grow the
+// window like the default does.
+func (o ReadaheadOptions) readaheadFunc(length int64, runtime time.Duration) torrent.ReadaheadFunc {
+	target := int64(EstimateBitrate(length, runtime) * o.Duration.Seconds())
+	target = max(target, o.Min)
+
+	return func(r torrent.ReadaheadContext) int64 {
+		readahead := max(target, r.CurrentPos-r.ContiguousReadStartPos)
+		if o.Max > 0 {
+			readahead = min(readahead, o.Max)
+		}
+		return readahead
+	}
+}
+
+// prioritizeEdges raises the priority of the first and last EdgeBytes of
+// every video file in the torrent
+func (c *Client) prioritizeEdges(t *torrent.Torrent) {
+	info := t.Info()
+	if c.readahead.EdgeBytes <= 0 || info == nil || info.PieceLength <= 0 {
+		return
+	}
+
+	edgePieces := int((c.readahead.EdgeBytes + info.PieceLength - 1) / info.PieceLength)
+	for _, f := range t.Files() {
+		if f.Length() == 0 || !isVideoFile(strings.ToLower(filepath.Ext(f.DisplayPath()))) {
+			continue
+		}
+		begin, end := f.BeginPieceIndex(), f.EndPieceIndex()
+		for i := begin; i < min(begin+edgePieces, end); i++ {
+			t.Piece(i).SetPriority(torrent.PiecePriorityHigh)
+		}
+		for i := max(end-edgePieces, begin+edgePieces); i < end; i++ {
+			t.Piece(i).SetPriority(torrent.PiecePriorityHigh)
+		}
+	}
+}
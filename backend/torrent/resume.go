@@ -0,0 +1,73 @@
+package torrent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// importedDir holds the piece completion of imported torrents, one directory
+// per torrent so it can be deleted with the torrent. Torrents in the data
+// directory keep theirs in the client's own completion database.
+const importedDir = ".imported"
+
+// InfoBytes returns the bencoded info dictionary of a torrent, which is
+// enough to restore it without fetching the metadata from peers. ok is false
+// while the metadata has not arrived.
+func (c *Client) InfoBytes(infoHash string) (infoBytes []byte, ok bool) {
+	t, found := c.GetTorrent(infoHash)
+	if !found || t.Info() == nil {
+		return nil, false
+	}
+	return t.Metainfo().InfoBytes, true
+}
+
+// RestoreMagnet adds a magnet link like AddMagnetAsync, with the info
+// dictionary saved from an earlier run. The metadata is available at once
+// and pieces recorded as complete are not downloaded again, so restoring
+// works without peers. Info bytes that do not match the info hash are
+// ignored and the metadata is fetched as usual.
+func (c *Client) RestoreMagnet(magnetURI string, infoBytes []byte, private bool) (*TorrentInfo, error) {
+	return c.addMagnet(magnetURI, infoBytes, private)
+}
+
+// RemoveData deletes the downloaded data of a torrent that is no longer in the
+// client, such as one purged from the trash. infoBytes is its saved info
+// dictionary, which names the data; dataPath is the directory of an imported
+// torrent and empty for torrents in the data directory.
+func (c *Client) RemoveData(infoBytes []byte, dataPath string) error {
+	var info metainfo.Info
+	if err := bencode.Unmarshal(infoBytes, &info); err != nil {
+		return fmt.Errorf("decode info: %w", err)
+	}
+	if dataPath == "" {
+		dataPath = c.config.DataDir
+	}
+	return removeTorrentData(dataPath, info.BestName())
+}
+
+// newImportedStorage returns the storage of a torrent whose data lives in
+// dataPath. Its piece completion is kept under the client's data directory,
+// so a restored import only hash-checks pieces not yet recorded as complete.
+func (c *Client) newImportedStorage(infoHash, dataPath string) (storage.ClientImplCloser, error) {
+	dir := c.importedCompletionDir(infoHash)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	completion, err := storage.NewDefaultPieceCompletionForDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("create piece completion: %w", err)
+	}
+	return storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dataPath,
+		PieceCompletion: completion,
+	}), nil
+}
+
+func (c *Client) importedCompletionDir(infoHash string) string {
+	return filepath.Join(c.config.DataDir, importedDir, infoHash)
+}
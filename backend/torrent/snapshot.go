@@ -0,0 +1,177 @@
+package torrent
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// snapshotInterval is how often the cached torrent and file lists are rebuilt
+const snapshotInterval = 2 * time.Second
+
+// snapshot is an immutable view of every torrent, rebuilt in the background
+// so listing torrents and files does not walk all files on each request.
+// Readers load it without locking.
+type snapshot struct {
+	torrents map[string]*cachedTorrent
+}
+
+// cachedTorrent is the information of one torrent as of the last rebuild
+type cachedTorrent struct {
+	t    *torrent.Torrent
+	info *TorrentInfo
+	// paths indexes info.Files by path for stream lookups
+	paths map[string]int
+}
+
+// snapshotCache holds the current snapshot. Writers hold mu while they
+// replace it, after torrentsLock when they need both.
+type snapshotCache struct {
+	mu      sync.Mutex
+	current atomic.Pointer[snapshot]
+}
+
+func newSnapshotCache() *snapshotCache {
+	s := &snapshotCache{}
+	s.current.Store(&snapshot{torrents: make(map[string]*cachedTorrent)})
+	return s
+}
+
+func (s *snapshotCache) get(infoHash string) (*cachedTorrent, bool) {
+	cached, ok := s.current.Load().torrents[infoHash]
+	return cached, ok
+}
+
+// updateLocked replaces the snapshot with a copy changed by fn; the caller
+// must hold s.mu
+func (s *snapshotCache) updateLocked(fn func(torrents map[string]*cachedTorrent)) {
+	old := s.current.Load().torrents
+	torrents := make(map[string]*cachedTorrent, len(old)+1)
+	for infoHash, cached := range old {
+		torrents[infoHash] = cached
+	}
+	fn(torrents)
+	s.current.Store(&snapshot{torrents: torrents})
+}
+
+// newCachedTorrent builds the cached information of t
+func (c *Client) newCachedTorrent(t *torrent.Torrent) *cachedTorrent {
+	info := c.getTorrentInfo(t)
+	paths := make(map[string]int, len(info.Files))
+	for _, f := range info.Files {
+		paths[f.Path] = f.FileIndex
+	}
+	return &cachedTorrent{t: t, info: info, paths: paths}
+}
+
+// cacheTorrent adds a torrent that was just added or re-added to the
+// snapshot, so it is listed before the next rebuild. Nothing is stored when t
+// has been removed or replaced in the meantime.
+func (c *Client) cacheTorrent(infoHash string, t *torrent.Torrent) {
+	cached := c.newCachedTorrent(t)
+
+	c.torrentsLock.RLock()
+	defer c.torrentsLock.RUnlock()
+	if current, ok := c.torrents[infoHash]; !ok || current != t {
+		return
+	}
+	c.snapshots.mu.Lock()
+	defer c.snapshots.mu.Unlock()
+	c.snapshots.updateLocked(func(torrents map[string]*cachedTorrent) {
+		torrents[infoHash] = cached
+	})
+}
+
+// uncacheLocked drops a removed torrent from the snapshot; the caller must
+// hold torrentsLock
+func (c *Client) uncacheLocked(infoHash string) {
+	c.snapshots.mu.Lock()
+	defer c.snapshots.mu.Unlock()
+	c.snapshots.updateLocked(func(torrents map[string]*cachedTorrent) {
+		delete(torrents, infoHash)
+	})
+}
+
+// refreshSnapshot rebuilds the snapshot. The files are walked without
+// holding torrentsLock; torrents removed or re-added in the meantime keep
+// what cacheTorrent and uncacheLocked stored for them.
+func (c *Client) refreshSnapshot() {
+	c.torrentsLock.RLock()
+	current := make(map[string]*torrent.Torrent, len(c.torrents))
+	for infoHash, t := range c.torrents {
+		current[infoHash] = t
+	}
+	c.torrentsLock.RUnlock()
+
+	rebuilt := make(map[string]*cachedTorrent, len(current))
+	for infoHash, t := range current {
+		rebuilt[infoHash] = c.newCachedTorrent(t)
+	}
+
+	c.torrentsLock.RLock()
+	defer c.torrentsLock.RUnlock()
+	c.snapshots.mu.Lock()
+	defer c.snapshots.mu.Unlock()
+	c.snapshots.updateLocked(func(torrents map[string]*cachedTorrent) {
+		for infoHash, cached := range rebuilt {
+			if t, ok := c.torrents[infoHash]; ok && t == cached.t {
+				torrents[infoHash] = cached
+			}
+		}
+	})
+}
+
+// sampleSnapshots periodically rebuilds the snapshot until the client is closed
+func (c *Client) sampleSnapshots() {
+	ticker := time.NewTicker(snapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			c.refreshSnapshot()
+		}
+	}
+}
+
+// CachedTorrentInfo returns the information of a torrent from the snapshot,
+// up to snapshotInterval old. The Files slice is shared and must not be
+// modified. Use GetTorrentInfo when current progress matters.
+func (c *Client) CachedTorrentInfo(infoHash string) (*TorrentInfo, bool) {
+	cached, ok := c.snapshots.get(infoHash)
+	if !ok {
+		return nil, false
+	}
+	info := *cached.info
+	return &info, true
+}
+
+// FileIndex returns the index of the file of a torrent with the given path,
+// as reported in FileInfo.Path
+func (c *Client) FileIndex(infoHash, path string) (int, error) {
+	if cached, ok := c.snapshots.get(infoHash); ok && len(cached.info.Files) > 0 {
+		if index, ok := cached.paths[path]; ok {
+			return index, nil
+		}
+		return -1, ErrFileNotFound
+	}
+
+	// The metadata may have arrived since the last rebuild
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return -1, ErrTorrentNotFound
+	}
+	if t.Info() == nil {
+		return -1, ErrMetadataIncomplete
+	}
+	for i, f := range t.Files() {
+		if f.DisplayPath() == path {
+			return i, nil
+		}
+	}
+	return -1, ErrFileNotFound
+}
@@ -0,0 +1,106 @@
+package torrent
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// failureRetryDelay is the wait before a failed operation runs again
+const failureRetryDelay = 2 * time.Second
+
+// PanicError is a panic recovered from anacrolix/torrent while working on a
+// torrent
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Failure reports an operation on a torrent that failed in the background,
+// after its retries, see SetFailureHandler
+type Failure struct {
+	InfoHash string
+	// Op names the operation, such as "start download"
+	Op  string
+	Err error
+	// Attempts is how many times the operation ran
+	Attempts int
+}
+
+// SetFailureHandler sets the function called for each Failure. Like the
+// completion handler it must be set before torrents are added.
+func (c *Client) SetFailureHandler(fn func(Failure)) {
+	c.completionMu.Lock()
+	defer c.completionMu.Unlock()
+	c.onFailure = fn
+}
+
+// supervise runs fn for a torrent and recovers a panic in it, so a bug in the
+// library fails that torrent instead of the whole process. A panicking fn
+// runs again up to failureRetries times; the last panic is passed to the
+// failure handler and returned.
+func (c *Client) supervise(infoHash, op string, fn func()) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = recoverPanic(fn); err == nil {
+			return nil
+		}
+		log.Printf("torrent %s: %s failed (attempt %d): %v\n%s", infoHash, op, attempt, err, err.(*PanicError).Stack)
+
+		if attempt > c.failureRetries {
+			c.reportFailure(Failure{InfoHash: infoHash, Op: op, Err: err, Attempts: attempt})
+			return err
+		}
+		select {
+		case <-time.After(failureRetryDelay):
+		case <-c.closed:
+			return err
+		}
+	}
+}
+
+// recoverPanic runs fn and returns the panic it raised as a *PanicError
+func recoverPanic(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	fn()
+	return nil
+}
+
+// reportFailure passes a failure to the failure handler, unless the torrent
+// has been removed in the meantime
+func (c *Client) reportFailure(f Failure) {
+	if _, ok := c.GetTorrent(f.InfoHash); !ok {
+		return
+	}
+
+	c.completionMu.Lock()
+	fn := c.onFailure
+	c.completionMu.Unlock()
+
+	if fn != nil {
+		fn(f)
+	}
+}
+
+// startDownload requests every piece of t, the edges of its video files
+// first. It runs supervised, see supervise.
+func (c *Client) startDownload(infoHash string, t *torrent.Torrent) error {
+	return c.supervise(infoHash, "start download", func() {
+		if t.Info() == nil {
+			return
+		}
+		t.DownloadAll()
+		c.prioritizeEdges(t)
+	})
+}
@@ -0,0 +1,227 @@
+package torrent
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// trackerReannounceTimeout bounds a forced reannounce across all trackers
+const trackerReannounceTimeout = 15 * time.Second
+
+// TrackerInfo is one tracker of a torrent with the outcome of the last forced
+// reannounce. Announces made by the library's background announcers are not
+// observable, so LastAnnounce stays nil until Reannounce has run.
+type TrackerInfo struct {
+	TrackerStatus
+	LastAnnounce *time.Time `json:"lastAnnounce,omitempty"`
+}
+
+// Trackers lists a torrent's trackers ordered by tier
+func (c *Client) Trackers(infoHash string) ([]TrackerInfo, error) {
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+
+	c.torrentsLock.RLock()
+	stats := make(map[string]TrackerInfo, len(c.trackerStats[infoHash]))
+	for u, last := range c.trackerStats[infoHash] {
+		stats[u] = last
+	}
+	c.torrentsLock.RUnlock()
+
+	trackers := []TrackerInfo{}
+	for _, status := range trackerList(t) {
+		if last, ok := stats[status.URL]; ok {
+			last.Tier = status.Tier
+			trackers = append(trackers, last)
+			continue
+		}
+		trackers = append(trackers, TrackerInfo{TrackerStatus: status})
+	}
+	return trackers, nil
+}
+
+// AddTrackers adds trackers to the first tier of a torrent's announce list and
+// starts announcing to them. Trackers already in the list are ignored.
+func (c *Client) AddTrackers(infoHash string, urls []string) error {
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return ErrTorrentNotFound
+	}
+	if len(urls) > 0 {
+		t.AddTrackers([][]string{urls})
+	}
+	return nil
+}
+
+// RemoveTrackers removes trackers from a torrent's announce list.
+//
+// Torrent.ModifyTrackers stops every announcer but keeps them registered, so
+// the trackers that remain would never announce again. Instead the torrent is
+// dropped and added back with the remaining trackers, keeping its storage,
+// piece completion and pause state. Peer connections and open readers are
+// closed in the process.
+func (c *Client) RemoveTrackers(infoHash string, urls []string) error {
+	remove := make(map[string]bool, len(urls))
+	for _, u := range urls {
+		remove[u] = true
+	}
+
+	unlock := c.torrentLocks.lock(infoHash)
+	defer unlock()
+
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return ErrTorrentNotFound
+	}
+	announceList, changed := withoutTrackers(t, remove)
+	if !changed {
+		return nil
+	}
+
+	if _, err := c.readd(infoHash, t, announceList, t.Metainfo().UrlList, c.owner(t), nil); err != nil {
+		return err
+	}
+
+	c.torrentsLock.Lock()
+	defer c.torrentsLock.Unlock()
+	for u := range remove {
+		delete(c.trackerStats[infoHash], u)
+	}
+	return nil
+}
+
+// withoutTrackers returns a torrent's announce list minus the given trackers
+// and whether any of them was present
+func withoutTrackers(t *torrent.Torrent, remove map[string]bool) ([][]string, bool) {
+	mi := t.Metainfo()
+	changed := false
+	var announceList [][]string
+	for _, tier := range mi.UpvertedAnnounceList() {
+		var kept []string
+		for _, u := range tier {
+			if remove[u] {
+				changed = true
+				continue
+			}
+			kept = append(kept, u)
+		}
+		if len(kept) > 0 {
+			announceList = append(announceList, kept)
+		}
+	}
+	return announceList, changed
+}
+
+// readd drops a torrent and adds it back to cl with the given announce list
+// and web seeds, keeping its storage, pause state and the known peers accepted
+// by keepPeer (all of them when nil). The caller must hold the torrent's lock;
+// WaitForMetadata follows the replacement.
+func (c *Client) readd(infoHash string, t *torrent.Torrent, announceList [][]string, webseeds []string, cl *torrent.Client, keepPeer func(torrent.PeerInfo) bool) (*torrent.Torrent, error) {
+	var peers []torrent.PeerInfo
+	for _, p := range t.KnownSwarm() {
+		if keepPeer == nil || keepPeer(p) {
+			peers = append(peers, p)
+		}
+	}
+
+	mi := t.Metainfo()
+	spec := &torrent.TorrentSpec{
+		InfoHash:    t.InfoHash(),
+		Trackers:    announceList,
+		DisplayName: t.Name(),
+		Webseeds:    webseeds,
+	}
+	if t.Info() != nil {
+		spec.InfoBytes = mi.InfoBytes
+	}
+	c.torrentsLock.RLock()
+	files, ok := c.storages[infoHash]
+	c.torrentsLock.RUnlock()
+	if ok {
+		spec.Storage = files
+	}
+	t.Drop()
+
+	readded, _, err := cl.AddTorrentSpec(spec)
+	c.torrentsLock.Lock()
+	if err != nil {
+		delete(c.torrents, infoHash)
+		c.uncacheLocked(infoHash)
+		c.torrentsLock.Unlock()
+		return nil, err
+	}
+	c.torrents[infoHash] = readded
+	c.watchLocked(infoHash, readded)
+	paused := c.paused[infoHash]
+	c.torrentsLock.Unlock()
+	readded.AddPeers(peers)
+
+	if paused {
+		readded.DisallowDataDownload()
+		readded.DisallowDataUpload()
+		readded.SetMaxEstablishedConns(0)
+	}
+	if readded.Info() != nil {
+		c.startDownload(infoHash, readded)
+		c.applyMaxConnections(infoHash, readded)
+	}
+	c.cacheTorrent(infoHash, readded)
+	return readded, nil
+}
+
+// Reannounce announces to every tracker of a torrent right away instead of
+// waiting for the next interval, adds the returned peers and records the
+// outcome for Trackers
+func (c *Client) Reannounce(ctx context.Context, infoHash string) ([]TrackerInfo, error) {
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, trackerReannounceTimeout)
+	defer cancel()
+
+	statuses := trackerList(t)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func(status *TrackerStatus) {
+			defer wg.Done()
+
+			var peers []torrent.PeerInfo
+			for _, p := range c.probeTracker(ctx, t, status) {
+				peers = append(peers, torrent.PeerInfo{
+					Addr:   &net.TCPAddr{IP: p.IP, Port: p.Port},
+					Source: torrent.PeerSourceTracker,
+				})
+			}
+			if len(peers) > 0 {
+				t.AddPeers(peers)
+			}
+		}(&statuses[i])
+	}
+	wg.Wait()
+
+	now := time.Now()
+	trackers := make([]TrackerInfo, 0, len(statuses))
+	stats := make(map[string]TrackerInfo, len(statuses))
+	for _, status := range statuses {
+		info := TrackerInfo{TrackerStatus: status, LastAnnounce: &now}
+		trackers = append(trackers, info)
+		stats[status.URL] = info
+	}
+
+	c.torrentsLock.Lock()
+	if _, ok := c.torrents[infoHash]; ok {
+		c.trackerStats[infoHash] = stats
+	}
+	c.torrentsLock.Unlock()
+
+	return trackers, nil
+}
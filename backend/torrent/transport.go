@@ -0,0 +1,76 @@
+package torrent
+
+import (
+	"fmt"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/mse"
+)
+
+// EncryptionPolicy decides whether peer connections are encrypted with
+// Message Stream Encryption
+type EncryptionPolicy string
+
+const (
+	// EncryptionPrefer tries an obfuscated handshake first and accepts
+	// plaintext peers; the payload stays unencrypted when both sides allow it
+	EncryptionPrefer EncryptionPolicy = "prefer"
+	// EncryptionRequire only talks to peers that encrypt the handshake and
+	// the whole stream, which hides the traffic from ISPs that throttle
+	// BitTorrent but loses peers without encryption support
+	EncryptionRequire EncryptionPolicy = "require"
+	// EncryptionDisable only uses plaintext connections
+	EncryptionDisable EncryptionPolicy = "disable"
+)
+
+// Valid reports whether p is one of the known policies
+func (p EncryptionPolicy) Valid() bool {
+	switch p {
+	case EncryptionPrefer, EncryptionRequire, EncryptionDisable:
+		return true
+	}
+	return false
+}
+
+// TransportOptions select the peer protocols. anacrolix/torrent reads them
+// without locking while connections are made, so they only take effect when
+// a client is created.
+type TransportOptions struct {
+	// DisableUTP and DisableTCP turn off a peer protocol; at least one must
+	// stay enabled. The DHT keeps using UDP when uTP is disabled.
+	DisableUTP bool
+	DisableTCP bool
+	// Encryption is EncryptionPrefer when empty
+	Encryption EncryptionPolicy
+}
+
+// apply sets the protocols and encryption policy on cfg
+func (o TransportOptions) apply(cfg *torrent.ClientConfig) error {
+	if o.DisableUTP && o.DisableTCP {
+		return fmt.Errorf("uTP and TCP cannot both be disabled")
+	}
+	cfg.DisableUTP = o.DisableUTP
+	cfg.DisableTCP = o.DisableTCP
+
+	switch o.Encryption {
+	case EncryptionPrefer, "":
+		cfg.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{Preferred: true}
+		cfg.CryptoProvides = mse.AllSupportedCrypto
+		cfg.CryptoSelector = mse.DefaultCryptoSelector
+	case EncryptionRequire:
+		cfg.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{Preferred: true, RequirePreferred: true}
+		cfg.CryptoProvides = mse.CryptoMethodRC4
+		// Peers that only offer plaintext get no method and the handshake fails
+		cfg.CryptoSelector = func(provided mse.CryptoMethod) mse.CryptoMethod { return provided & mse.CryptoMethodRC4 }
+	case EncryptionDisable:
+		cfg.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{Preferred: false, RequirePreferred: true}
+	default:
+		return fmt.Errorf("unknown encryption policy %q", o.Encryption)
+	}
+	return nil
+}
+
+// Transport returns the protocols and encryption policy the client runs with
+func (c *Client) Transport() TransportOptions {
+	return c.transport
+}
@@ -0,0 +1,42 @@
+package torrent
+
+import (
+	"github.com/anacrolix/torrent"
+	"github.com/pion/webrtc/v4"
+)
+
+// WebRTCOptions are the ICE servers used to connect to WebTorrent peers.
+// Browsers behind NAT can only be reached with the help of a STUN server,
+// and some only through a TURN relay.
+type WebRTCOptions struct {
+	// ICEServers are stun:, stuns:, turn: or turns: URLs
+	ICEServers []string
+	// Username and Credential authenticate with the TURN servers
+	Username   string
+	Credential string
+}
+
+// apply sets the ICE servers on cfg; without servers only peers on the
+// local network can connect
+func (o WebRTCOptions) apply(cfg *torrent.ClientConfig) {
+	if len(o.ICEServers) == 0 {
+		return
+	}
+	server := webrtc.ICEServer{URLs: o.ICEServers}
+	if o.Username != "" {
+		server.Username = o.Username
+		server.Credential = o.Credential
+	}
+	cfg.ICEServerList = []webrtc.ICEServer{server}
+}
+
+// webrtcPeers counts the connections to WebTorrent peers
+func webrtcPeers(t *torrent.Torrent) int {
+	n := 0
+	for _, conn := range t.PeerConns() {
+		if conn.Network == "webrtc" {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,60 @@
+package torrent
+
+import (
+	"sort"
+)
+
+// Webseeds lists the HTTP web seeds (BEP 19 url-list) of a torrent, sorted
+func (c *Client) Webseeds(infoHash string) ([]string, error) {
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+	urls := append([]string{}, t.Metainfo().UrlList...)
+	sort.Strings(urls)
+	return urls, nil
+}
+
+// AddWebseeds adds HTTP web seeds to a torrent. Pieces are requested from
+// them right away, alongside the peers. Web seeds already added are ignored.
+func (c *Client) AddWebseeds(infoHash string, urls []string) error {
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return ErrTorrentNotFound
+	}
+	if len(urls) > 0 {
+		t.AddWebSeeds(urls)
+	}
+	return nil
+}
+
+// RemoveWebseeds removes web seeds from a torrent. The library cannot drop a
+// web seed, so like RemoveTrackers the torrent is re-added without them,
+// closing its peer connections and open readers.
+func (c *Client) RemoveWebseeds(infoHash string, urls []string) error {
+	remove := make(map[string]bool, len(urls))
+	for _, u := range urls {
+		remove[u] = true
+	}
+
+	unlock := c.torrentLocks.lock(infoHash)
+	defer unlock()
+
+	t, ok := c.GetTorrent(infoHash)
+	if !ok {
+		return ErrTorrentNotFound
+	}
+	mi := t.Metainfo()
+	var kept []string
+	for _, u := range mi.UrlList {
+		if !remove[u] {
+			kept = append(kept, u)
+		}
+	}
+	if len(kept) == len(mi.UrlList) {
+		return nil
+	}
+
+	_, err := c.readd(infoHash, t, mi.UpvertedAnnounceList(), kept, c.owner(t), nil)
+	return err
+}
@@ -143,7 +143,10 @@ func (ihv *InfoHashValidator) ValidateInfoHash(infoHash string) error {
 	}
 
 	mv := &MagnetValidator{}
-	return mv.validateInfoHash(infoHash)
+	if err := mv.validateInfoHash(infoHash); err != nil {
+		return ValidationError{Field: "infoHash", Message: err.Error()}
+	}
+	return nil
 }
 
 // StringValidator 字符串验证器
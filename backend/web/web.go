@@ -0,0 +1,184 @@
+// Package web 提供构建好的前端静态文件，单个程序即可同时提供接口和网页
+//
+// 前端构建结果复制到 web/dist 后重新编译即可编译进程序，也可以通过 WEB_DIR 指定构建目录。
+// 找不到文件且路径没有扩展名时返回 index.html，由前端路由处理（SPA history 回退）。
+// 前端同时位于根路径和基础路径（BASE_PATH）下，反向代理只转发基础路径时也能访问。
+package web
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/torrentplayer/backend/middleware"
+)
+
+// dist 编译进程序的前端构建结果
+// all: 前缀使 Next.js 的 _next 目录也被编译进来，未构建前端时目录中只有 .gitignore
+//
+//go:embed all:dist
+var dist embed.FS
+
+// immutablePrefixes 文件名带内容哈希的目录，可以长期缓存
+var immutablePrefixes = []string{"_next/static/", "assets/"}
+
+// Embedded 返回编译进程序的前端文件，未编译前端时返回 false
+func Embedded() (fs.FS, bool) {
+	files, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil, false
+	}
+	if _, err := fs.Stat(files, "index.html"); err != nil {
+		return nil, false
+	}
+	return files, true
+}
+
+// Dir 返回目录中的前端文件，目录中没有 index.html 时返回错误
+func Dir(dir string) (fs.FS, error) {
+	files := os.DirFS(dir)
+	if _, err := fs.Stat(files, "index.html"); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Handler 提供前端静态文件
+type Handler struct {
+	files    fs.FS
+	basePath string
+	// reserved 接口路径前缀，这些路径下不存在的地址返回 JSON 格式的404而不是前端页面
+	reserved []string
+
+	// etags 编译进程序的文件没有修改时间，按内容计算 ETag 后缓存
+	mu    sync.Mutex
+	etags map[string]string
+}
+
+// NewHandler 创建前端文件处理器，basePath 下的请求去掉该前缀后查找文件，reserved 为不回退到前端页面的接口路径前缀
+func NewHandler(files fs.FS, basePath string, reserved ...string) *Handler {
+	return &Handler{
+		files:    files,
+		basePath: basePath,
+		reserved: reserved,
+		etags:    make(map[string]string),
+	}
+}
+
+// ServeHTTP 按路径返回静态文件，找不到页面时返回 index.html
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, prefix := range h.reserved {
+		if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/") {
+			middleware.WriteErrorResponse(w, "资源不存在", http.StatusNotFound)
+			return
+		}
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		middleware.WriteErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	urlPath := r.URL.Path
+	if h.basePath != "" && (urlPath == h.basePath || strings.HasPrefix(urlPath, h.basePath+"/")) {
+		urlPath = strings.TrimPrefix(urlPath, h.basePath)
+	}
+	name, ok := h.resolve(urlPath)
+	if !ok {
+		middleware.WriteErrorResponse(w, "资源不存在", http.StatusNotFound)
+		return
+	}
+	if err := h.serveFile(w, r, name); err != nil {
+		middleware.WriteErrorResponse(w, "读取前端文件失败", http.StatusInternalServerError)
+	}
+}
+
+// resolve 把请求路径映射到文件：先找同名文件、目录下的 index.html 和 Next.js 导出的 .html 页面，
+// 都不存在且路径没有扩展名时回退到 index.html；以 . 开头的文件不对外提供
+func (h *Handler) resolve(urlPath string) (string, bool) {
+	name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		return "index.html", true
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return "", false
+		}
+	}
+
+	for _, candidate := range []string{name, name + "/index.html", name + ".html"} {
+		if info, err := fs.Stat(h.files, candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+	// 缺少的脚本、图片等资源返回404，否则浏览器会把 index.html 当作脚本解析
+	if path.Ext(name) != "" {
+		return "", false
+	}
+	return "index.html", true
+}
+
+// serveFile 返回文件内容并设置缓存头：带哈希的资源长期缓存，其余文件每次向服务器确认
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, name string) error {
+	file, err := h.files.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		return errors.New("文件不支持随机读取")
+	}
+
+	cacheControl := "no-cache"
+	for _, prefix := range immutablePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			cacheControl = "public, max-age=31536000, immutable"
+			break
+		}
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+
+	modTime := info.ModTime()
+	if modTime.IsZero() {
+		etag, err := h.etag(name, content)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("ETag", etag)
+	}
+	http.ServeContent(w, r, name, modTime, content)
+	return nil
+}
+
+// etag 计算并缓存文件内容的 ETag，计算后把读取位置恢复到文件开头
+func (h *Handler) etag(name string, content io.ReadSeeker) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if etag, ok := h.etags[name]; ok {
+		return etag, nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	h.etags[name] = etag
+	return etag, nil
+}
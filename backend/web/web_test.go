@@ -0,0 +1,71 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestHandlerFallsBackToIndex(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":                 {Data: []byte("home")},
+		"about.html":                 {Data: []byte("about")},
+		"docs/index.html":            {Data: []byte("docs")},
+		"favicon.ico":                {Data: []byte("icon")},
+		"_next/static/chunks/app.js": {Data: []byte("js")},
+		".env":                       {Data: []byte("secret")},
+	}
+	handler := NewHandler(files, "/magnet", "/magnet/api")
+
+	cases := []struct {
+		method, path, body, cacheControl string
+		status                           int
+	}{
+		{"GET", "/", "home", "no-cache", 200},
+		{"GET", "/about", "about", "no-cache", 200},
+		{"GET", "/docs/", "docs", "no-cache", 200},
+		{"GET", "/favicon.ico", "icon", "no-cache", 200},
+		{"GET", "/_next/static/chunks/app.js", "js", "public, max-age=31536000, immutable", 200},
+		{"GET", "/torrent/abc", "home", "no-cache", 200},
+		{"GET", "/magnet/about", "about", "no-cache", 200},
+		{"GET", "/magnet", "home", "no-cache", 200},
+		{"HEAD", "/player/abc/0", "", "no-cache", 200},
+		{"GET", "/_next/static/chunks/missing.js", "", "", 404},
+		{"GET", "/.env", "", "", 404},
+		{"GET", "/magnet/api/v1/nope", "", "", 404},
+		{"POST", "/torrent/abc", "", "", 405},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(c.method, c.path, nil))
+		if rec.Code != c.status {
+			t.Errorf("%s %s: status %d, want %d", c.method, c.path, rec.Code, c.status)
+			continue
+		}
+		if c.status != 200 {
+			continue
+		}
+		if c.method == "GET" && rec.Body.String() != c.body {
+			t.Errorf("%s %s: body %q, want %q", c.method, c.path, rec.Body.String(), c.body)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != c.cacheControl {
+			t.Errorf("%s %s: Cache-Control %q, want %q", c.method, c.path, got, c.cacheControl)
+		}
+	}
+
+	// 编译进程序的文件没有修改时间，重复请求通过 ETag 返回304
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag")
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("conditional request: status %d, want 304", rec.Code)
+	}
+}
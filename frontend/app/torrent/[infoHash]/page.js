@@ -111,7 +111,22 @@ export default function TorrentDetailsPage({ params }) {
       </div>
       
       {torrent && <TorrentCard torrent={torrent} />}
-      
+
+      {/* 下载完成后执行的命令失败时显示原因和输出 */}
+      {torrent?.postProcess?.status === 'failed' && (
+        <Alert variant="destructive">
+          <AlertTitle>后处理失败</AlertTitle>
+          <AlertDescription>
+            <p>{torrent.postProcess.error}</p>
+            {torrent.postProcess.output && (
+              <pre className="mt-2 max-h-48 overflow-auto whitespace-pre-wrap text-xs">
+                {torrent.postProcess.output}
+              </pre>
+            )}
+          </AlertDescription>
+        </Alert>
+      )}
+
       <div className="space-y-4">
         <h3 className="text-xl font-bold">文件列表</h3>
         <FileList files={files} infoHash={infoHash} />
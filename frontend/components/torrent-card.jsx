@@ -11,11 +11,14 @@ export function TorrentCard({ torrent }) {
   const getStateBadgeVariant = (state) => {
     switch (state) {
       case 'completed':
+      case 'seeding':
         return 'success';
       case 'downloading':
         return 'default';
       case 'stalled':
         return 'warning';
+      case 'error':
+        return 'destructive';
       default:
         return 'secondary';
     }
@@ -138,7 +138,9 @@ const MovieCard = ({ movie: initialMovie }) => {
                             {file.isVideo ? 'Video' : 'Other'} • Progress: {formatProgress(file.progress)}
                           </span>
                           {file.isVideo && !file.isPlayable && (
-                            <span className="text-yellow-500">Not yet playable</span>
+                            <span className="text-yellow-500">
+                              Not yet playable{file.playableBytes > 0 && ` • ${formatFileSize(file.playableBytes)} ready`}
+                            </span>
                           )}
                         </div>
                       </div>
@@ -41,9 +41,10 @@ async function fetchWithErrorHandling(url, options = {}) {
 /**
  * 添加一个磁力链接
  * @param {string} magnetUri 磁力链接
- * @returns {Promise<Object>} 添加的种子信息
+ * @param {boolean} [isPrivate] 按私有种子处理，不添加公共 tracker，不使用 DHT 和 PEX
+ * @returns {Promise<Object>} 添加的种子信息，种子已存在时返回现有种子并带有 alreadyExists: true
  */
-export async function addMagnet(magnetUri) {
+export async function addMagnet(magnetUri, isPrivate = false) {
   if (!magnetUri || !magnetUri.trim()) {
     throw new Error('磁力链接不能为空');
   }
@@ -57,7 +58,7 @@ export async function addMagnet(magnetUri) {
     headers: {
       'Content-Type': 'application/json',
     },
-    body: JSON.stringify({ magnetUri }),
+    body: JSON.stringify({ magnetUri, private: isPrivate }),
   });
 }
 
@@ -22,6 +22,7 @@ export interface FileInfo {
   torrentId: string;
   isVideo: boolean;
   isPlayable: boolean;
+  playableBytes: number; // 从文件开头起连续下载完成的字节数
 }
 
 // 电影详情类型
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+// maxHeldBytes bounds the data held after a corrupt or missing range until
+// that range arrives again
+const maxHeldBytes = 64 << 20
+
+var errTooMuchHeld = errors.New("too much data waiting for a range requested again")
+
+// assembler passes the data of a range to a sink in order. Data arriving
+// after a corrupt or missing part is held until that part was received again.
+type assembler struct {
+	sink io.Writer
+	// next is the offset of the first byte not passed to sink
+	next      int64
+	held      map[int64][]byte
+	heldBytes int64
+}
+
+func newAssembler(offset int64, sink io.Writer) *assembler {
+	return &assembler{sink: sink, next: offset, held: make(map[int64][]byte)}
+}
+
+// add takes the data at offset in the file. Data passed to the sink already
+// is dropped.
+func (a *assembler) add(offset int64, data []byte) error {
+	if offset+int64(len(data)) <= a.next {
+		return nil
+	}
+	if offset > a.next {
+		if old, ok := a.held[offset]; ok {
+			if len(old) >= len(data) {
+				return nil
+			}
+			a.heldBytes -= int64(len(old))
+		}
+		if a.heldBytes+int64(len(data)) > maxHeldBytes {
+			return errTooMuchHeld
+		}
+		// data 可能引用数据通道的缓冲区，需要复制
+		a.held[offset] = append([]byte(nil), data...)
+		a.heldBytes += int64(len(data))
+		return nil
+	}
+
+	if err := a.write(offset, data); err != nil {
+		return err
+	}
+	// 接上已到达的后续数据
+	for progress := true; progress; {
+		progress = false
+		for off, held := range a.held {
+			if off > a.next {
+				continue
+			}
+			delete(a.held, off)
+			a.heldBytes -= int64(len(held))
+			if err := a.write(off, held); err != nil {
+				return err
+			}
+			progress = true
+		}
+	}
+	return nil
+}
+
+// write passes the part of data at offset after next to the sink
+func (a *assembler) write(offset int64, data []byte) error {
+	if offset+int64(len(data)) <= a.next {
+		return nil
+	}
+	data = data[a.next-offset:]
+	_, err := a.sink.Write(data)
+	a.next += int64(len(data))
+	return err
+}
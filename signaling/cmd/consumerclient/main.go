@@ -2,32 +2,48 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/pion/webrtc/v3"
+
+	"signaling/internal/keepalive"
+	"signaling/internal/logging"
+	"signaling/internal/protocol"
+	"signaling/internal/transfer"
 )
 
 var (
-	signalServer = flag.String("server", "43.156.74.32:8090", "Signaling server address")
+	signalServer = flag.String("server", "43.156.74.32:8090", "Signaling server host:port, dialed over ws://, or a ws:// or wss:// URL")
 	clientID     = flag.String("id", "consumer-"+fmt.Sprint(time.Now().Unix()), "Client ID")
+	producerID   = flag.String("producer", "", "ID of the producer to connect to (default choose from the server directory)")
+	listServers  = flag.Bool("list", false, "Print the server directory and exit")
+	token        = flag.String("token", os.Getenv("SIGNALING_TOKEN"), "Access token for the signaling server (default $SIGNALING_TOKEN)")
+	outDir       = flag.String("out", "downloads", "Directory received files are saved to, under their path on the producer")
+	resume       = flag.Bool("resume", true, "Request the rest of partially received files in -out when the data channel opens")
+	accessToken  = flag.String("access-token", os.Getenv("PRODUCER_ACCESS_TOKEN"), "Token for the files of a producer that requires one (default $PRODUCER_ACCESS_TOKEN)")
 )
 
-// Message represents the structure of messages exchanged with the signaling server
-type Message struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
-}
+// stdin is shared by choosing a producer and sending messages on the data channel
+var stdin = bufio.NewScanner(os.Stdin)
 
 func main() {
+	setupLogging := logging.Flags()
 	flag.Parse()
+	setupLogging()
 
 	// Create a new WebRTC API with default codecs
 	api := webrtc.NewAPI()
@@ -49,144 +65,287 @@ func main() {
 
 	// Handle data channel from producer
 	peerConnection.OnDataChannel(func(d *webrtc.DataChannel) {
-		log.Printf("New data channel: %s, %d", d.Label(), d.ID())
+		slog.Info("new data channel", "label", d.Label())
 
+		// Control messages arrive as JSON text, file data as binary frames
+		r := newReceiver(d)
 		d.OnOpen(func() {
-			log.Println("Data channel opened")
+			slog.Info("data channel opened")
+
+			// 令牌要在文件请求之前发送
+			if *accessToken != "" {
+				data, err := json.Marshal(transfer.Request{Type: transfer.RequestAuth, Token: *accessToken})
+				if err == nil {
+					err = d.SendText(string(data))
+				}
+				if err != nil {
+					slog.Warn("sending access token failed", "error", err)
+				}
+			}
+
+			// 继续接收上次中断的文件
+			if *resume {
+				for _, req := range resumeRequests() {
+					data, err := json.Marshal(req)
+					if err == nil {
+						err = d.SendText(string(data))
+					}
+					if err != nil {
+						slog.Warn("resuming file failed", "path", req.Path, "error", err)
+					} else {
+						slog.Info("resuming file", "path", req.Path, "offset", req.Offset)
+					}
+				}
+			}
 			
 			// Start a goroutine to read from stdin and send messages
 			go func() {
-				scanner := bufio.NewScanner(os.Stdin)
-				fmt.Println("Data channel connected. Enter messages to send to producer:")
-				for scanner.Scan() {
-					msg := scanner.Text()
+				fmt.Println("Data channel connected. Enter 'list [path]', 'get <path> [offset] [length]', 'cancel <transfer>', 'auth <token>' or messages to send to producer:")
+				for stdin.Scan() {
+					msg, err := commandMessage(stdin.Text())
+					if err != nil {
+						slog.Warn("invalid command", "error", err)
+						continue
+					}
 					if err := d.SendText(msg); err != nil {
-						log.Printf("Failed to send message: %v", err)
+						slog.Warn("sending message failed", "error", err)
 					} else {
-						log.Printf("Sent message: %s", msg)
+						slog.Info("sent message", "message", msg)
 					}
 				}
 			}()
 		})
 
-		d.OnMessage(func(msg webrtc.DataChannelMessage) {
-			log.Printf("Received message from producer: %s", string(msg.Data))
-		})
+		d.OnMessage(r.handleMessage)
 
 		d.OnClose(func() {
-			log.Println("Data channel closed")
+			slog.Info("data channel closed")
+			r.close()
 		})
 	})
 
 	// Connect to the signaling server
 	u := url.URL{
-		Scheme:   "ws",
-		Host:     *signalServer,
-		Path:     "/ws",
-		RawQuery: fmt.Sprintf("id=%s&type=consumer", *clientID),
+		Scheme: "ws",
+		Host:   *signalServer,
+		Path:   "/ws",
+	}
+	if strings.Contains(*signalServer, "://") {
+		parsed, err := url.Parse(*signalServer)
+		if err != nil {
+			log.Fatalf("Invalid signaling server URL: %v", err)
+		}
+		u = *parsed
 	}
-	log.Printf("Connecting to signaling server: %s", u.String())
+	slog.Info("connecting to signaling server", "url", u.String())
 
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	header := http.Header{}
+	if *token != "" {
+		header.Set("Authorization", "Bearer "+*token)
+	}
+	conn, err := dialSignaling(u.String(), header)
 	if err != nil {
 		log.Fatalf("Failed to connect to signaling server: %v", err)
 	}
-	defer conn.Close()
-	log.Println("Connected to signaling server")
+	slog.Info("connected to signaling server")
+	keepalive.Client(conn)
 
-	// Global websocket connection for signaling
+	// Current websocket connection for signaling, nil while reconnecting.
+	// writes come from WebRTC callbacks too, and websocket allows one writer at a time
 	var wsConn = conn
+	var writeMu sync.Mutex
+	setConn := func(c *websocket.Conn) {
+		writeMu.Lock()
+		wsConn = c
+		writeMu.Unlock()
+	}
+	defer func() {
+		writeMu.Lock()
+		if wsConn != nil {
+			wsConn.Close()
+		}
+		writeMu.Unlock()
+	}()
 
 	// Helper function to send messages to the signaling server
-	sendSignalingMessage := func(msgType string, data interface{}) {
-		msg := Message{
-			Type: msgType,
-			Data: data,
+	sendSignalingMessage := func(msgType protocol.MessageType, to string, payload interface{}) {
+		msg, err := protocol.NewMessage(msgType, *clientID, to, payload)
+		if err != nil {
+			slog.Error("encoding message failed", "type", msgType, "error", err)
+			return
 		}
-
 		msgBytes, err := json.Marshal(msg)
 		if err != nil {
-			log.Printf("Error encoding message: %v", err)
+			slog.Error("encoding message failed", "type", msgType, "error", err)
 			return
 		}
 
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if wsConn == nil {
+			slog.Warn("not connected to signaling server, dropping message", "dir", logging.Out, "type", msgType, "client", to)
+			return
+		}
 		if err := wsConn.WriteMessage(websocket.TextMessage, msgBytes); err != nil {
-			log.Printf("Error sending message to signaling server: %v", err)
+			slog.Warn("sending signaling message failed", "dir", logging.Out, "type", msgType, "client", to, "error", err)
+			return
 		}
+		slog.Log(context.Background(), logging.MessageLevel(msgType), "signaling message sent", "dir", logging.Out, "type", msgType, "client", to)
 	}
 
+	// The producer that sent the offer, which ICE candidates are sent to
+	var producerMu sync.Mutex
+	var producer string
+
 	// ICE candidate handler
 	peerConnection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
 		if candidate == nil {
 			return
 		}
 
+		candidateJSON, err := json.Marshal(candidate.ToJSON())
+		if err != nil {
+			slog.Error("encoding ICE candidate failed", "error", err)
+			return
+		}
+		producerMu.Lock()
+		target := producer
+		producerMu.Unlock()
+
 		// Send ICE candidate to signaling server
-		sendSignalingMessage("ice-candidate", candidate.ToJSON())
+		sendSignalingMessage(protocol.ICECandidate, target, protocol.ICECandidateMessage{Candidate: candidateJSON})
 	})
 
-	// Handle incoming signaling messages
-	go func() {
-		for {
-			_, msgBytes, err := wsConn.ReadMessage()
+	// Register as a consumer and ask a producer to connect
+	sendSignalingMessage(protocol.Register, "", protocol.RegisterMessage{ID: *clientID, Role: protocol.RoleClient})
+
+	target := *producerID
+	if target == "" || *listServers {
+		sendSignalingMessage(protocol.ListServers, "", nil)
+		servers, err := readServerList(conn)
+		if err != nil {
+			log.Fatalf("Failed to get the server directory: %v", err)
+		}
+		if *listServers {
+			printServers(servers)
+			return
+		}
+		if target, err = chooseServer(servers); err != nil {
+			log.Fatalf("Failed to choose a producer: %v", err)
+		}
+	}
+	sendSignalingMessage(protocol.ConnectRequest, target, protocol.ConnectRequestMessage{ServerID: target, ClientID: *clientID})
+
+	// handleMessage handles a message from the signaling server
+	handleMessage := func(msg *protocol.Message) {
+		slog.Log(context.Background(), logging.MessageLevel(msg.Type), "signaling message received", "dir", logging.In, "type", msg.Type, "client", msg.From)
+		switch msg.Type {
+		case protocol.ConnectResponse:
+			var resp protocol.ConnectResponseMessage
+			if err := msg.DecodePayload(&resp); err != nil {
+				slog.Warn("invalid connect response", "error", err)
+				return
+			}
+			if !resp.Success {
+				slog.Warn("connect request failed", "client", target, "error", resp.Error)
+			} else {
+				slog.Info("connect request sent to producer", "client", resp.ServerID)
+			}
+
+		case protocol.SDPOffer:
+			// Handle offer from producer
+			var offer protocol.SDPMessage
+			if err := msg.DecodePayload(&offer); err != nil {
+				slog.Warn("invalid SDP offer", "client", msg.From, "error", err)
+				return
+			}
+			producerMu.Lock()
+			producer = msg.From
+			producerMu.Unlock()
+
+			// Set remote description
+			sdp := webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer.SDP}
+			if err := peerConnection.SetRemoteDescription(sdp); err != nil {
+				slog.Warn("setting remote description failed", "client", msg.From, "error", err)
+				return
+			}
+
+			// Create answer
+			answer, err := peerConnection.CreateAnswer(nil)
 			if err != nil {
-				log.Printf("Error reading from signaling server: %v", err)
+				slog.Error("creating answer failed", "client", msg.From, "error", err)
 				return
 			}
 
-			var msg Message
-			if err := json.Unmarshal(msgBytes, &msg); err != nil {
-				log.Printf("Error parsing message: %v", err)
-				continue
+			// Set local description
+			if err := peerConnection.SetLocalDescription(answer); err != nil {
+				slog.Error("setting local description failed", "client", msg.From, "error", err)
+				return
 			}
 
-			switch msg.Type {
-			case "offer":
-				// Handle offer from producer
-				var sdp webrtc.SessionDescription
-				data, _ := json.Marshal(msg.Data)
-				if err := json.Unmarshal(data, &sdp); err != nil {
-					log.Printf("Error parsing SDP offer: %v", err)
-					continue
-				}
+			// Send answer to signaling server
+			sendSignalingMessage(protocol.SDPAnswer, msg.From, protocol.SDPMessage{SDP: answer.SDP})
 
-				// Set remote description
-				if err := peerConnection.SetRemoteDescription(sdp); err != nil {
-					log.Printf("Error setting remote description: %v", err)
-					continue
-				}
+		case protocol.ICECandidate:
+			// Handle ICE candidate from producer
+			var candidateMsg protocol.ICECandidateMessage
+			if err := msg.DecodePayload(&candidateMsg); err != nil {
+				slog.Warn("invalid ICE candidate", "client", msg.From, "error", err)
+				return
+			}
+			var candidate webrtc.ICECandidateInit
+			if err := json.Unmarshal(candidateMsg.Candidate, &candidate); err != nil {
+				slog.Warn("invalid ICE candidate", "client", msg.From, "error", err)
+				return
+			}
 
-				// Create answer
-				answer, err := peerConnection.CreateAnswer(nil)
-				if err != nil {
-					log.Printf("Error creating answer: %v", err)
-					continue
-				}
+			if err := peerConnection.AddICECandidate(candidate); err != nil {
+				slog.Warn("adding ICE candidate failed", "client", msg.From, "error", err)
+			}
 
-				// Set local description
-				if err := peerConnection.SetLocalDescription(answer); err != nil {
-					log.Printf("Error setting local description: %v", err)
-					continue
-				}
+		case protocol.Error:
+			var errMsg protocol.ErrorMessage
+			if err := msg.DecodePayload(&errMsg); err == nil {
+				slog.Warn("signaling server error", "code", errMsg.Code, "error", errMsg.Message, "type", errMsg.Type, "to", errMsg.To)
+			}
 
-				// Send answer to signaling server
-				sendSignalingMessage("answer", answer)
+		case protocol.ServerShutdown:
+			// The server closes the connection next, we reconnect with backoff
+			slog.Info("signaling server is shutting down, will reconnect")
 
-			case "ice-candidate":
-				// Handle ICE candidate from producer
-				var candidate webrtc.ICECandidateInit
-				data, _ := json.Marshal(msg.Data)
-				if err := json.Unmarshal(data, &candidate); err != nil {
-					log.Printf("Error parsing ICE candidate: %v", err)
-					continue
-				}
+		case protocol.SDPAnswer:
+			slog.Warn("unexpected SDP answer", "client", msg.From)
+		}
+	}
+
+	// Handle incoming signaling messages, reconnecting when the connection drops
+	go func() {
+		var backoff keepalive.Backoff
+		for {
+			connected := time.Now()
+			err := readSignaling(conn, handleMessage)
+			setConn(nil)
+			conn.Close()
+			if time.Since(connected) > keepalive.Timeout {
+				backoff.Reset()
+			}
 
-				if err := peerConnection.AddICECandidate(candidate); err != nil {
-					log.Printf("Error adding ICE candidate: %v", err)
+			for {
+				delay := backoff.Next()
+				slog.Warn("lost connection to signaling server", "error", err, "retry_in", delay)
+				time.Sleep(delay)
+				if conn, err = dialSignaling(u.String(), header); err == nil {
+					break
 				}
+			}
+			slog.Info("reconnected to signaling server")
+			keepalive.Client(conn)
+			setConn(conn)
 
-			case "answer":
-				log.Println("Received answer (unexpected for consumer)")
+			// 重新注册；还没收到 offer 时重新请求连接，已建立的 WebRTC 连接不需要信令
+			sendSignalingMessage(protocol.Register, "", protocol.RegisterMessage{ID: *clientID, Role: protocol.RoleClient})
+			if peerConnection.RemoteDescription() == nil {
+				sendSignalingMessage(protocol.ConnectRequest, target, protocol.ConnectRequestMessage{ServerID: target, ClientID: *clientID})
 			}
 		}
 	}()
@@ -195,5 +354,166 @@ func main() {
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 	<-interrupt
-	log.Println("Shutting down...")
+	slog.Info("shutting down")
+}
+
+// dialSignaling connects to the signaling server. A rejected token is fatal,
+// retrying cannot fix it.
+func dialSignaling(rawURL string, header http.Header) (*websocket.Conn, error) {
+	conn, resp, err := websocket.DefaultDialer.Dial(rawURL, header)
+	if err != nil && resp != nil && resp.StatusCode == http.StatusUnauthorized {
+		log.Fatalf("Failed to connect to signaling server: token rejected, set -token or $SIGNALING_TOKEN")
+	}
+	return conn, err
+}
+
+// readSignaling passes the messages read from conn to handle until reading fails
+func readSignaling(conn *websocket.Conn, handle func(*protocol.Message)) error {
+	for {
+		_, msgBytes, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		keepalive.Extend(conn)
+
+		msg, err := protocol.Decode(msgBytes)
+		if err != nil {
+			slog.Warn("invalid signaling message", "dir", logging.In, "error", err)
+			continue
+		}
+		handle(msg)
+	}
+}
+
+// readServerList waits for the answer to a list-servers request
+func readServerList(conn *websocket.Conn) ([]protocol.ServerInfo, error) {
+	for {
+		_, msgBytes, err := conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		msg, err := protocol.Decode(msgBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		switch msg.Type {
+		case protocol.ServerList:
+			var list protocol.ServerListMessage
+			if err := msg.DecodePayload(&list); err != nil {
+				return nil, err
+			}
+			return list.Servers, nil
+		case protocol.Error:
+			var errMsg protocol.ErrorMessage
+			if err := msg.DecodePayload(&errMsg); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%s: %s", errMsg.Code, errMsg.Message)
+		}
+	}
+}
+
+// printServers prints the server directory as a numbered list
+func printServers(servers []protocol.ServerInfo) {
+	if len(servers) == 0 {
+		fmt.Println("No producers online")
+		return
+	}
+	for i, server := range servers {
+		fmt.Printf("%d. %s (%s)", i+1, server.Name, server.ID)
+		if server.Description != "" {
+			fmt.Printf(" - %s", server.Description)
+		}
+		fmt.Println()
+	}
+}
+
+// chooseServer returns the ID of the only producer online, or asks the user
+// to pick one when there are several
+func chooseServer(servers []protocol.ServerInfo) (string, error) {
+	switch len(servers) {
+	case 0:
+		return "", fmt.Errorf("no producers online")
+	case 1:
+		slog.Info("connecting to the only producer online", "name", servers[0].Name, "client", servers[0].ID)
+		return servers[0].ID, nil
+	}
+
+	printServers(servers)
+	for {
+		fmt.Printf("Choose a producer [1-%d]: ", len(servers))
+		if !stdin.Scan() {
+			return "", fmt.Errorf("no producer chosen")
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(stdin.Text()))
+		if err == nil && n >= 1 && n <= len(servers) {
+			return servers[n-1].ID, nil
+		}
+	}
+}
+
+// commandMessage turns a line typed by the user into a data channel message:
+// "list [path]", "get <path> [offset] [length]", "cancel <transfer>" and
+// "auth <token>" become requests, other lines are sent as they are
+func commandMessage(line string) (string, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return line, nil
+	}
+
+	var req transfer.Request
+	switch fields[0] {
+	case transfer.RequestList:
+		if len(fields) > 2 {
+			return "", fmt.Errorf("usage: list [path]")
+		}
+		req = transfer.Request{Type: transfer.RequestList}
+		if len(fields) == 2 {
+			req.Path = fields[1]
+		}
+	case transfer.RequestGet:
+		if len(fields) < 2 || len(fields) > 4 {
+			return "", fmt.Errorf("usage: get <path> [offset] [length]")
+		}
+		req = transfer.Request{Type: transfer.RequestGet, Path: fields[1]}
+		var err error
+		// 没有指定偏移时从已接收的部分之后继续
+		if size, ok := partSize(req.Path); ok && len(fields) == 2 {
+			slog.Info("resuming file", "path", req.Path, "offset", size)
+			req.Offset = size
+		}
+		if len(fields) > 2 {
+			if req.Offset, err = strconv.ParseInt(fields[2], 10, 64); err != nil || req.Offset < 0 {
+				return "", fmt.Errorf("invalid offset %q", fields[2])
+			}
+		}
+		if len(fields) > 3 {
+			if req.Length, err = strconv.ParseInt(fields[3], 10, 64); err != nil || req.Length < 0 {
+				return "", fmt.Errorf("invalid length %q", fields[3])
+			}
+		}
+	case transfer.RequestCancel:
+		if len(fields) != 2 {
+			return "", fmt.Errorf("usage: cancel <transfer>")
+		}
+		id, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil || id == 0 {
+			return "", fmt.Errorf("invalid transfer %q", fields[1])
+		}
+		req = transfer.Request{Type: transfer.RequestCancel, Transfer: uint32(id)}
+	case transfer.RequestAuth:
+		if len(fields) != 2 {
+			return "", fmt.Errorf("usage: auth <token>")
+		}
+		req = transfer.Request{Type: transfer.RequestAuth, Token: fields[1]}
+	default:
+		return line, nil
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
 }
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+
+	"signaling/internal/transfer"
+)
+
+const (
+	// progressInterval limits how often the progress of a transfer is logged
+	progressInterval = time.Second
+	// maxRepairs bounds how often ranges of a file are requested again
+	maxRepairs = 10
+)
+
+// incomingFile is a range of a file being received from the producer
+type incomingFile struct {
+	name     string
+	path     string
+	size     int64
+	transfer uint32
+	// offset and length are the range being sent, received counts from offset
+	offset   int64
+	length   int64
+	received int64
+	nextSeq  uint32
+	started  time.Time
+	lastLog  time.Time
+
+	// parent is the file a repair transfer resends a range of; data of a
+	// repair goes to its parent's assembler
+	parent *incomingFile
+	// asm passes the data in order to digest
+	asm    *assembler
+	digest hash.Hash
+	// repairs counts the repair transfers still expected, retries all of them
+	repairs int
+	retries int
+	// eof is set once the producer sent the whole range
+	eof      *transfer.Control
+	err      error
+	verified bool
+
+	// out is the part the file is saved to, nil when it is not saved
+	out   *os.File
+	local string
+}
+
+// target returns the file that the data of f belongs to
+func (f *incomingFile) target() *incomingFile {
+	if f.parent != nil {
+		return f.parent
+	}
+	return f
+}
+
+// receiver follows the transfers on a data channel. Its methods are called
+// from the channel's OnMessage callback, one message at a time.
+type receiver struct {
+	dataChannel *webrtc.DataChannel
+	files       map[uint32]*incomingFile
+	// wanted maps ranges requested again to their files until the producer
+	// queues them, repairing maps their transfers until they start
+	wanted    map[string]*incomingFile
+	repairing map[uint32]*incomingFile
+	// saving holds the local paths being written, so two transfers of the
+	// same file cannot write the same part
+	saving map[string]bool
+	// listing collects a listing split into several messages
+	listing []transfer.Entry
+}
+
+func newReceiver(dataChannel *webrtc.DataChannel) *receiver {
+	return &receiver{
+		dataChannel: dataChannel,
+		files:       make(map[uint32]*incomingFile),
+		wanted:      make(map[string]*incomingFile),
+		repairing:   make(map[uint32]*incomingFile),
+		saving:      make(map[string]bool),
+	}
+}
+
+// handleMessage handles a JSON control message or a binary data frame
+func (r *receiver) handleMessage(msg webrtc.DataChannelMessage) {
+	if msg.IsString {
+		r.handleControl(msg.Data)
+		return
+	}
+
+	chunk, err := transfer.DecodeFrame(msg.Data)
+	if err != nil {
+		slog.Warn("invalid frame from producer", "error", err)
+		return
+	}
+	file, ok := r.files[chunk.Transfer]
+	if !ok {
+		slog.Warn("chunk for unknown transfer", "transfer", chunk.Transfer)
+		return
+	}
+	target := file.target()
+	if target.err != nil {
+		return
+	}
+
+	// 缺失的分块在之后重新请求
+	if expected := file.offset + file.received; chunk.Offset > expected {
+		slog.Warn("chunks missing, requesting them again", "transfer", file.transfer, "file", file.name, "first", file.nextSeq, "last", chunk.Seq-1)
+		r.repair(target, expected, chunk.Offset-expected)
+	}
+	file.nextSeq = chunk.Seq + 1
+	file.received = max(file.received, chunk.Offset+int64(len(chunk.Data))-file.offset)
+
+	if !chunk.Valid() {
+		slog.Warn("chunk corrupt, requesting it again", "transfer", file.transfer, "file", file.name, "seq", chunk.Seq)
+		r.repair(target, chunk.Offset, int64(len(chunk.Data)))
+	} else if err := target.asm.add(chunk.Offset, chunk.Data); err != nil {
+		r.fail(target, err)
+		return
+	}
+
+	if file.parent == nil && time.Since(file.lastLog) >= progressInterval {
+		file.lastLog = time.Now()
+		slog.Info("receiving file", "transfer", file.transfer, "file", file.name, "received", file.received, "length", file.length,
+			"percent", fmt.Sprintf("%.2f", percent(file.received, file.length)),
+			"mb_per_sec", fmt.Sprintf("%.2f", float64(file.received)/max(time.Since(file.started).Seconds(), 0.001)/1024/1024))
+	}
+}
+
+// repair requests length bytes at offset of file again
+func (r *receiver) repair(file *incomingFile, offset, length int64) {
+	if file.retries >= maxRepairs {
+		r.fail(file, fmt.Errorf("gave up after requesting %d ranges again", maxRepairs))
+		return
+	}
+	file.retries++
+
+	data, err := json.Marshal(transfer.Request{Type: transfer.RequestGet, Path: file.path, Offset: offset, Length: length})
+	if err == nil {
+		err = r.dataChannel.SendText(string(data))
+	}
+	if err != nil {
+		r.fail(file, fmt.Errorf("requesting %d bytes at offset %d again: %v", length, offset, err))
+		return
+	}
+	r.wanted[repairKey(file.path, offset, length)] = file
+	file.repairs++
+}
+
+// fail stops verifying file; the failure is reported once the transfer ends
+func (r *receiver) fail(file *incomingFile, err error) {
+	if file.err == nil {
+		file.err = err
+		file.asm = nil
+	}
+}
+
+// finish reports a file once the producer sent it and all ranges requested
+// again arrived
+func (r *receiver) finish(file *incomingFile) {
+	if file.eof == nil || file.repairs > 0 {
+		return
+	}
+
+	elapsed := time.Since(file.started).Seconds()
+	log := slog.With("transfer", file.transfer, "file", file.name)
+	discard := false
+	switch {
+	case file.err != nil:
+		log.Warn("file transfer failed", "error", file.err)
+	case file.asm.next != file.offset+file.length:
+		log.Warn("received file incomplete", "received", file.asm.next-file.offset, "length", file.length)
+	case file.eof.SHA256 != "" && hex.EncodeToString(file.digest.Sum(nil)) != file.eof.SHA256:
+		log.Warn("received file corrupt", "sha256", hex.EncodeToString(file.digest.Sum(nil)), "expected", file.eof.SHA256)
+		discard = true
+	case file.eof.SHA256 == "":
+		log.Info("received file, not verified", "length", file.length)
+	default:
+		log.Info("received file, SHA-256 verified", "length", file.length, "mb_per_sec", fmt.Sprintf("%.2f", float64(file.length)/max(elapsed, 0.001)/1024/1024))
+		file.verified = true
+	}
+	r.closePart(file, discard)
+}
+
+// handleControl handles a control message; messages other than those of
+// transfers, like the torrent list, are printed as they are
+func (r *receiver) handleControl(data []byte) {
+	var control transfer.Control
+	if err := json.Unmarshal(data, &control); err != nil {
+		slog.Warn("invalid message from producer", "error", err)
+		return
+	}
+
+	switch control.Type {
+	case transfer.ControlQueued:
+		key := repairKey(control.Path, control.Offset, control.Length)
+		if parent, ok := r.wanted[key]; ok {
+			delete(r.wanted, key)
+			r.repairing[control.Transfer] = parent
+			return
+		}
+		slog.Info("request queued", "transfer", control.Transfer, "path", control.Path)
+
+	case transfer.ControlMetadata:
+		file := &incomingFile{
+			name:     control.FileName,
+			path:     control.Path,
+			size:     control.FileSize,
+			transfer: control.Transfer,
+			offset:   control.Offset,
+			length:   control.Length,
+			started:  time.Now(),
+		}
+		r.files[control.Transfer] = file
+
+		if parent, ok := r.repairing[control.Transfer]; ok {
+			delete(r.repairing, control.Transfer)
+			file.parent = parent
+			slog.Info("receiving range again", "transfer", control.Transfer, "file", control.FileName, "offset", control.Offset, "length", control.Length)
+			return
+		}
+
+		file.digest = sha256.New()
+		file.asm = newAssembler(control.Offset, r.openPart(file))
+		if control.Offset == 0 && control.Length == control.FileSize {
+			slog.Info("receiving file", "transfer", control.Transfer, "file", control.FileName, "size", control.FileSize)
+		} else {
+			slog.Info("receiving file range", "transfer", control.Transfer, "file", control.FileName,
+				"size", control.FileSize, "offset", control.Offset, "length", control.Length)
+		}
+
+	case transfer.ControlEOF:
+		file, ok := r.files[control.Transfer]
+		if !ok {
+			slog.Warn("end of unknown transfer", "transfer", control.Transfer)
+			return
+		}
+		delete(r.files, control.Transfer)
+
+		target := file.target()
+		if end, received := file.offset+file.length, file.offset+file.received; received < end && target.err == nil {
+			slog.Warn("end of file missing, requesting it again", "transfer", file.transfer, "file", file.name, "missing", end-received)
+			r.repair(target, received, end-received)
+		}
+		if file.parent != nil {
+			file.parent.repairs--
+			r.finish(file.parent)
+			return
+		}
+		file.eof = &control
+		r.finish(file)
+
+	case transfer.ControlList:
+		var listing transfer.Listing
+		if err := json.Unmarshal(data, &listing); err != nil {
+			slog.Warn("invalid listing from producer", "error", err)
+			return
+		}
+		r.listing = append(r.listing, listing.Entries...)
+		if !listing.More {
+			printListing(listing.Path, r.listing, listing.Truncated)
+			r.listing = nil
+		}
+
+	case transfer.ControlCanceled, transfer.ControlError:
+		// 传输可能在开始前就被取消或失败
+		parent, repairing := r.repairing[control.Transfer]
+		delete(r.repairing, control.Transfer)
+		file, ok := r.files[control.Transfer]
+		delete(r.files, control.Transfer)
+		if ok {
+			parent, repairing = file.parent, file.parent != nil
+		}
+
+		switch {
+		case repairing:
+			// 重传失败时整个文件无法校验
+			r.fail(parent, fmt.Errorf("range requested again: %s %s", control.Type, control.Error))
+			parent.repairs--
+			r.finish(parent)
+		case !ok && control.Type == transfer.ControlCanceled:
+			slog.Info("transfer canceled before it started", "transfer", control.Transfer)
+		case !ok:
+			slog.Warn("producer error", "transfer", control.Transfer, "error", control.Error)
+		case control.Type == transfer.ControlCanceled:
+			slog.Info("file transfer canceled", "transfer", file.transfer, "file", file.name, "received", file.received, "length", file.length)
+			r.closePart(file, false)
+		default:
+			slog.Warn("file transfer failed", "transfer", file.transfer, "file", file.name, "error", control.Error)
+			r.closePart(file, false)
+		}
+
+	default:
+		slog.Info("message from producer", "message", string(data))
+	}
+}
+
+// printListing prints the entries of a listing as an indented tree
+func printListing(dir string, entries []transfer.Entry, truncated bool) {
+	if dir == "" {
+		dir = "."
+	}
+	fmt.Printf("Files in %s:\n", dir)
+	if len(entries) == 0 {
+		fmt.Println("  (empty)")
+	}
+
+	// 条目路径相对于生产者的根目录，缩进从最浅的一层开始
+	top := -1
+	for _, entry := range entries {
+		if depth := strings.Count(entry.Path, "/"); top < 0 || depth < top {
+			top = depth
+		}
+	}
+	for _, entry := range entries {
+		indent := strings.Repeat("  ", strings.Count(entry.Path, "/")-top+1)
+		name := path.Base(entry.Path)
+		switch {
+		case entry.Dir:
+			fmt.Printf("%s%s/\n", indent, name)
+		case entry.Video:
+			fmt.Printf("%s%s (%d bytes, video)\n", indent, name, entry.Size)
+		default:
+			fmt.Printf("%s%s (%d bytes)\n", indent, name, entry.Size)
+		}
+	}
+	if truncated {
+		fmt.Println("  ... (listing truncated)")
+	}
+}
+
+// repairKey identifies a range requested again, to match it to the metadata
+// of its transfer
+func repairKey(path string, offset, length int64) string {
+	return fmt.Sprintf("%d+%d:%s", offset, length, path)
+}
+
+// percent returns n as a percentage of total
+func percent(n, total int64) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(n) * 100 / float64(total)
+}
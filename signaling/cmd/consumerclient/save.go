@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"signaling/internal/transfer"
+)
+
+// partSuffix marks files still being received. A part holds the verified
+// start of the file, so a later request can resume where it ends.
+const partSuffix = ".part"
+
+// localPath returns where the file at the producer's path remote is saved.
+// Rooting remote before cleaning it keeps it inside the output directory.
+func localPath(remote string) (string, error) {
+	clean := path.Clean("/" + filepath.ToSlash(remote))
+	if clean == "/" {
+		return "", errors.New("empty path")
+	}
+	return filepath.Join(*outDir, filepath.FromSlash(clean)), nil
+}
+
+// partSize returns the size of the part of remote received so far
+func partSize(remote string) (int64, bool) {
+	local, err := localPath(remote)
+	if err != nil {
+		return 0, false
+	}
+	info, err := os.Stat(local + partSuffix)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+// openPart opens the part of file for writing when the transfer continues
+// it, and returns where the file's data goes. Ranges that do not start where
+// the part ends, like those requested for seeking, are verified but not saved.
+func (r *receiver) openPart(file *incomingFile) io.Writer {
+	local, err := localPath(file.path)
+	if err != nil {
+		slog.Warn("not saving file", "transfer", file.transfer, "file", file.name, "error", err)
+		return file.digest
+	}
+	if r.saving[local] {
+		slog.Info("not saving file, another transfer is saving it", "transfer", file.transfer, "file", file.name)
+		return file.digest
+	}
+	size, _ := partSize(file.path)
+	if file.offset != size {
+		slog.Info("not saving file, range does not continue the part", "transfer", file.transfer, "file", file.name, "offset", file.offset, "part", local+partSuffix, "part_size", size)
+		return file.digest
+	}
+
+	if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+		slog.Warn("not saving file", "transfer", file.transfer, "file", file.name, "error", err)
+		return file.digest
+	}
+	out, err := os.OpenFile(local+partSuffix, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		slog.Warn("not saving file", "transfer", file.transfer, "file", file.name, "error", err)
+		return file.digest
+	}
+	file.out = out
+	file.local = local
+	r.saving[local] = true
+	return io.MultiWriter(out, file.digest)
+}
+
+// closePart closes the part of file. A file received whole and verified
+// loses its part suffix. discard drops the data of this transfer, when it
+// failed verification; otherwise the part keeps the data received in order.
+func (r *receiver) closePart(file *incomingFile, discard bool) {
+	if file.out == nil {
+		return
+	}
+	out := file.out
+	file.out = nil
+	delete(r.saving, file.local)
+
+	if discard {
+		// 校验失败的数据不能用于续传，只保留此前的部分
+		if err := out.Truncate(file.offset); err != nil {
+			slog.Warn("truncating part failed", "part", file.local+partSuffix, "error", err)
+		}
+	}
+	info, err := out.Stat()
+	if err == nil {
+		err = out.Close()
+	} else {
+		out.Close()
+	}
+	if err != nil {
+		slog.Warn("saving file failed", "path", file.local, "error", err)
+		return
+	}
+
+	if !file.verified || info.Size() != file.size {
+		slog.Info("saved part of file", "file", file.name, "part", file.local+partSuffix, "saved", info.Size(), "size", file.size)
+		return
+	}
+	if err := os.Rename(file.local+partSuffix, file.local); err != nil {
+		slog.Warn("saving file failed", "path", file.local, "error", err)
+		return
+	}
+	slog.Info("saved file", "path", file.local)
+}
+
+// close keeps the parts of the files being received when the data channel
+// closes, so they can be resumed. pion calls it from the goroutine that
+// delivers the channel's messages.
+func (r *receiver) close() {
+	files := make(map[*incomingFile]bool)
+	for _, file := range r.files {
+		files[file.target()] = true
+	}
+	for _, file := range r.repairing {
+		files[file] = true
+	}
+	for _, file := range r.wanted {
+		files[file] = true
+	}
+	clear(r.files)
+	clear(r.repairing)
+	clear(r.wanted)
+
+	for file := range files {
+		if file.out != nil {
+			slog.Info("file transfer interrupted", "transfer", file.transfer, "file", file.name)
+			r.closePart(file, false)
+		}
+	}
+}
+
+// resumeRequests returns requests for the rest of the parts in the output
+// directory
+func resumeRequests() []transfer.Request {
+	var requests []transfer.Request
+	filepath.WalkDir(*outDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || !strings.HasSuffix(p, partSuffix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(*outDir, strings.TrimSuffix(p, partSuffix))
+		if err != nil {
+			return nil
+		}
+		requests = append(requests, transfer.Request{Type: transfer.RequestGet, Path: filepath.ToSlash(rel), Offset: info.Size()})
+		return nil
+	})
+	return requests
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultExtensions are the files served unless -extensions says otherwise:
+// videos and their subtitles
+const defaultExtensions = ".mp4,.mkv,.avi,.mov,.wmv,.flv,.webm,.m4v,.mpg,.mpeg,.3gp,.rmvb,.ts,.m2ts,.srt,.vtt,.ass,.ssa,.sub"
+
+var errAccessDenied = errors.New("Access denied")
+
+// allowedExts is parsed from -extensions in main; nil allows any file
+var allowedExts map[string]bool
+
+// parseExtensions parses a comma-separated list of extensions; "*" allows any
+func parseExtensions(list string) map[string]bool {
+	if strings.TrimSpace(list) == "*" {
+		return nil
+	}
+	exts := make(map[string]bool)
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts[ext] = true
+	}
+	return exts
+}
+
+// extensionAllowed reports whether files named name may be served
+func extensionAllowed(name string) bool {
+	return allowedExts == nil || allowedExts[strings.ToLower(path.Ext(filepath.ToSlash(name)))]
+}
+
+// resolvePath returns the requested path cleaned and relative to basedir,
+// and its real path with symbolic links resolved. Links may point anywhere
+// inside basedir, but not out of it.
+func resolvePath(requestedPath string) (cleanPath, realPath string, err error) {
+	if cleanPath, err = cleanRequestPath(requestedPath); err != nil {
+		return "", "", err
+	}
+	base, err := filepath.EvalSymlinks(*baseDir)
+	if err != nil {
+		return "", "", fmt.Errorf("Base directory unavailable: %v", err)
+	}
+	realPath, err = filepath.EvalSymlinks(filepath.Join(base, cleanPath))
+	if os.IsNotExist(err) {
+		return "", "", fmt.Errorf("File not found: %s", cleanPath)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("Error resolving %s: %v", cleanPath, err)
+	}
+	if !withinDir(base, realPath) {
+		return "", "", errors.New("Invalid path: outside of the base directory")
+	}
+	return cleanPath, realPath, nil
+}
+
+// withinDir reports whether p is dir or inside it; both must be clean
+func withinDir(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && !filepath.IsAbs(rel) && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// accessGrant is what an access token allows: the files under Paths,
+// relative to basedir with slashes, all files when Paths is empty, until
+// Expires (Unix seconds)
+type accessGrant struct {
+	Paths   []string `json:"paths,omitempty"`
+	Expires int64    `json:"exp"`
+}
+
+// allows reports whether the grant covers the file or directory at p
+func (g *accessGrant) allows(p string) bool {
+	if time.Now().Unix() >= g.Expires {
+		return false
+	}
+	if len(g.Paths) == 0 {
+		return true
+	}
+	p = grantPath(p)
+	for _, prefix := range g.Paths {
+		if prefix == "" || p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// leadsTo reports whether the directory at p contains a path the grant
+// covers, so a listing of its parent may show it
+func (g *accessGrant) leadsTo(p string) bool {
+	p = grantPath(p)
+	for _, prefix := range g.Paths {
+		if p == "" || strings.HasPrefix(prefix, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// grantPath normalizes a path for matching against a grant
+func grantPath(p string) string {
+	return strings.Trim(path.Clean("/"+filepath.ToSlash(p)), "/")
+}
+
+// mintAccessToken creates a token granting paths for ttl, signed with secret.
+// The token is the base64 JSON grant and its base64 HMAC-SHA256, joined by a dot.
+func mintAccessToken(secret string, paths []string, ttl time.Duration) (string, error) {
+	grant := accessGrant{Expires: time.Now().Add(ttl).Unix()}
+	for _, p := range paths {
+		if p = strings.TrimSpace(p); p != "" {
+			grant.Paths = append(grant.Paths, grantPath(p))
+		}
+	}
+	payload, err := json.Marshal(grant)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signGrant(secret, encoded)), nil
+}
+
+// parseAccessToken checks the signature and expiry of a token
+func parseAccessToken(secret, token string) (*accessGrant, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errors.New("malformed token")
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, signGrant(secret, encoded)) {
+		return nil, errors.New("bad signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("malformed token")
+	}
+	var grant accessGrant
+	if err := json.Unmarshal(payload, &grant); err != nil {
+		return nil, errors.New("malformed token")
+	}
+	if time.Now().Unix() >= grant.Expires {
+		return nil, errors.New("token expired")
+	}
+	return &grant, nil
+}
+
+func signGrant(secret, encoded string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// authorize checks a token sent on the channel and grants its files to the
+// session
+func (c *flowChannel) authorize(token string) error {
+	if *accessSecret == "" {
+		return nil
+	}
+	grant, err := parseAccessToken(*accessSecret, token)
+	if err != nil {
+		return fmt.Errorf("Invalid access token: %v", err)
+	}
+	c.mu.Lock()
+	c.grant = grant
+	c.mu.Unlock()
+	return nil
+}
+
+// allowed reports whether the session may request the file or directory at
+// p. Without -access-secret every file may be requested.
+func (c *flowChannel) allowed(p string) bool {
+	if *accessSecret == "" {
+		return true
+	}
+	c.mu.Lock()
+	grant := c.grant
+	c.mu.Unlock()
+	return grant != nil && grant.allows(p)
+}
+
+// listable reports whether a listing may show the directory at p
+func (c *flowChannel) listable(p string) bool {
+	if c.allowed(p) {
+		return true
+	}
+	c.mu.Lock()
+	grant := c.grant
+	c.mu.Unlock()
+	return grant != nil && time.Now().Unix() < grant.Expires && grant.leadsTo(p)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolvePath(t *testing.T) {
+	root := t.TempDir()
+	base := filepath.Join(root, "base")
+	outside := filepath.Join(root, "outside")
+	for _, dir := range []string{filepath.Join(base, "show"), outside} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(base, "movie.mp4"), filepath.Join(base, "show", "e01.mkv"), filepath.Join(outside, "secret.mp4")} {
+		if err := os.WriteFile(file, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(base, "inside.mp4"):      filepath.Join(base, "show", "e01.mkv"),
+		filepath.Join(base, "relative.mp4"):    "movie.mp4",
+		filepath.Join(base, "escape.mp4"):      filepath.Join(outside, "secret.mp4"),
+		filepath.Join(base, "escape-relative"): "../outside",
+		filepath.Join(base, "show", "escape"):  outside,
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := *baseDir
+	*baseDir = base
+	defer func() { *baseDir = old }()
+
+	// the base directory may itself be reached through a link
+	realBase, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		path            string
+		clean, real     string
+		wantErrContains string
+	}{
+		"file":                     {path: "movie.mp4", clean: "movie.mp4", real: "movie.mp4"},
+		"unclean":                  {path: "show/../show/./e01.mkv", clean: "show/e01.mkv", real: "show/e01.mkv"},
+		"base directory":           {path: ".", clean: ".", real: "."},
+		"link inside":              {path: "inside.mp4", clean: "inside.mp4", real: "show/e01.mkv"},
+		"relative link inside":     {path: "relative.mp4", clean: "relative.mp4", real: "movie.mp4"},
+		"link to file outside":     {path: "escape.mp4", wantErrContains: "outside of the base directory"},
+		"relative link outside":    {path: "escape-relative/secret.mp4", wantErrContains: "outside of the base directory"},
+		"directory link outside":   {path: "show/escape/secret.mp4", wantErrContains: "outside of the base directory"},
+		"parent":                   {path: "../outside/secret.mp4", wantErrContains: "directory traversal"},
+		"parent after clean":       {path: "show/../../outside/secret.mp4", wantErrContains: "directory traversal"},
+		"absolute":                 {path: filepath.Join(outside, "secret.mp4"), wantErrContains: "directory traversal"},
+		"missing":                  {path: "show/e02.mkv", wantErrContains: "File not found"},
+		"missing through bad link": {path: "escape-relative/missing.mp4", wantErrContains: "File not found"},
+	}
+
+	for name, tc := range cases {
+		clean, real, err := resolvePath(tc.path)
+		if tc.wantErrContains != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+				t.Errorf("%s: err = %v, want it to contain %q", name, err, tc.wantErrContains)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if want := filepath.Join(realBase, tc.real); clean != tc.clean || real != want {
+			t.Errorf("%s: got %s, %s, want %s, %s", name, clean, real, tc.clean, want)
+		}
+	}
+}
+
+func TestWithinDir(t *testing.T) {
+	cases := map[string]struct {
+		dir, p string
+		want   bool
+	}{
+		"same":            {"/data", "/data", true},
+		"child":           {"/data", "/data/movie.mp4", true},
+		"nested":          {"/data", "/data/show/e01.mkv", true},
+		"dotted name":     {"/data", "/data/..movie.mp4", true},
+		"parent":          {"/data", "/", false},
+		"sibling":         {"/data", "/other/movie.mp4", false},
+		"sibling prefix":  {"/data", "/data2/movie.mp4", false},
+		"relative inside": {"data", "data/movie.mp4", true},
+		"mixed":           {"/data", "data/movie.mp4", false},
+	}
+
+	for name, tc := range cases {
+		if got := withinDir(tc.dir, tc.p); got != tc.want {
+			t.Errorf("%s: withinDir(%q, %q) = %v, want %v", name, tc.dir, tc.p, got, tc.want)
+		}
+	}
+}
+
+func TestAccessGrant(t *testing.T) {
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Hour).Unix()
+
+	cases := map[string]struct {
+		grant   accessGrant
+		p       string
+		allows  bool
+		leadsTo bool
+	}{
+		"all files":                 {accessGrant{Expires: future}, "a/movie.mp4", true, false},
+		"all files expired":         {accessGrant{Expires: past}, "a/movie.mp4", false, false},
+		"exact file":                {accessGrant{Paths: []string{"a/movie.mp4"}, Expires: future}, "a/movie.mp4", true, false},
+		"file in directory":         {accessGrant{Paths: []string{"a"}, Expires: future}, "a/movie.mp4", true, false},
+		"directory itself":          {accessGrant{Paths: []string{"a"}, Expires: future}, "a", true, false},
+		"sibling with prefix":       {accessGrant{Paths: []string{"a"}, Expires: future}, "ab/movie.mp4", false, false},
+		"sibling directory":         {accessGrant{Paths: []string{"a"}, Expires: future}, "ab", false, false},
+		"parent of granted":         {accessGrant{Paths: []string{"a/b"}, Expires: future}, "a", false, true},
+		"parent of granted sibling": {accessGrant{Paths: []string{"ab/c"}, Expires: future}, "a", false, false},
+		"base directory":            {accessGrant{Paths: []string{"a"}, Expires: future}, ".", false, true},
+		"root granted":              {accessGrant{Paths: []string{""}, Expires: future}, "b/movie.mp4", true, false},
+		"unclean request":           {accessGrant{Paths: []string{"a"}, Expires: future}, "./a/../a/movie.mp4", true, false},
+		"escaping request":          {accessGrant{Paths: []string{"a"}, Expires: future}, "a/../b/movie.mp4", false, false},
+		"expired path":              {accessGrant{Paths: []string{"a"}, Expires: past}, "a/movie.mp4", false, false},
+		"second path":               {accessGrant{Paths: []string{"a", "b"}, Expires: future}, "b/movie.mp4", true, false},
+	}
+
+	for name, tc := range cases {
+		if got := tc.grant.allows(tc.p); got != tc.allows {
+			t.Errorf("%s: allows(%q) = %v, want %v", name, tc.p, got, tc.allows)
+		}
+		if got := tc.grant.leadsTo(tc.p); got != tc.leadsTo {
+			t.Errorf("%s: leadsTo(%q) = %v, want %v", name, tc.p, got, tc.leadsTo)
+		}
+	}
+}
+
+func TestParseAccessToken(t *testing.T) {
+	valid, err := mintAccessToken("secret", []string{"/a/", " b ", ""}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := mintAccessToken("secret", nil, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := func(payload string) string {
+		encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+		return encoded + "." + base64.RawURLEncoding.EncodeToString(signGrant("secret", encoded))
+	}
+	encoded, sig, _ := strings.Cut(valid, ".")
+
+	cases := map[string]struct {
+		secret, token string
+		paths         []string
+		wantErr       string
+	}{
+		"valid":              {secret: "secret", token: valid, paths: []string{"a", "b"}},
+		"wrong secret":       {secret: "other", token: valid, wantErr: "bad signature"},
+		"tampered payload":   {secret: "secret", token: "x" + valid, wantErr: "bad signature"},
+		"truncated sig":      {secret: "secret", token: encoded + "." + sig[:len(sig)-2], wantErr: "bad signature"},
+		"sig not base64":     {secret: "secret", token: encoded + ".!!", wantErr: "bad signature"},
+		"expired":            {secret: "secret", token: expired, wantErr: "token expired"},
+		"no dot":             {secret: "secret", token: encoded, wantErr: "malformed token"},
+		"empty":              {secret: "secret", token: "", wantErr: "malformed token"},
+		"payload not base64": {secret: "secret", token: "!!." + base64.RawURLEncoding.EncodeToString(signGrant("secret", "!!")), wantErr: "malformed token"},
+		"payload not json":   {secret: "secret", token: signed("paths"), wantErr: "malformed token"},
+		"no expiry":          {secret: "secret", token: signed(`{"paths":["a"]}`), wantErr: "token expired"},
+	}
+
+	for name, tc := range cases {
+		grant, err := parseAccessToken(tc.secret, tc.token)
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("%s: err = %v, want %s", name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(grant.Paths, tc.paths) {
+			t.Errorf("%s: paths = %q, want %q", name, grant.Paths, tc.paths)
+		}
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	cases := map[string]struct {
+		list string
+		want map[string]bool
+	}{
+		"any":            {"*", nil},
+		"any with space": {" * ", nil},
+		"dotted":         {".mp4,.mkv", map[string]bool{".mp4": true, ".mkv": true}},
+		"without dots":   {"mp4, MKV", map[string]bool{".mp4": true, ".mkv": true}},
+		"empty entries":  {",.mp4,, ,", map[string]bool{".mp4": true}},
+		"none":           {"", map[string]bool{}},
+	}
+
+	for name, tc := range cases {
+		if got := parseExtensions(tc.list); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"signaling/internal/transfer"
+)
+
+// torrentsPrefix marks requests served from the backend's torrents instead of basedir:
+// "torrents" lists them, "torrents/<infoHash>/<file path>" streams a file
+const torrentsPrefix = "torrents"
+
+// BackendClient reads torrents from the magnet-player backend API, so the producer
+// can serve files that are still downloading
+type BackendClient struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// BackendTorrent is a torrent as listed by the backend
+type BackendTorrent struct {
+	InfoHash string        `json:"infoHash"`
+	Name     string        `json:"name"`
+	Length   int64         `json:"length"`
+	Progress float32       `json:"progress"`
+	State    string        `json:"state"`
+	Files    []BackendFile `json:"files"`
+}
+
+// BackendFile is a file of a torrent as listed by the backend
+type BackendFile struct {
+	Path      string  `json:"path"`
+	Length    int64   `json:"length"`
+	Progress  float32 `json:"progress"`
+	FileIndex int     `json:"fileIndex"`
+	IsVideo   bool    `json:"isVideo"`
+}
+
+// NewBackendClient creates a client for the API at baseURL, e.g.
+// http://localhost:8080/magnet/api/v1. apiKey may be empty when the backend
+// does not require authentication.
+func NewBackendClient(baseURL, apiKey string) *BackendClient {
+	// 流式响应可能持续很久，只限制等待响应头的时间
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 30 * time.Second
+	return &BackendClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{Transport: transport},
+	}
+}
+
+// ListTorrents returns the backend's torrents with their files
+func (b *BackendClient) ListTorrents() ([]BackendTorrent, error) {
+	resp, err := b.get(b.baseURL + "/torrents")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var torrents []BackendTorrent
+	if err := json.NewDecoder(resp.Body).Decode(&torrents); err != nil {
+		return nil, fmt.Errorf("解析种子列表失败: %v", err)
+	}
+	return torrents, nil
+}
+
+// OpenFile streams length bytes from offset of a file of a torrent through
+// the backend's torrent reader, up to the end of the file when length is 0,
+// and returns the size of the whole file. Pieces not downloaded yet are
+// fetched first, so reads wait instead of failing. Canceling ctx aborts the
+// request and reads from the body.
+func (b *BackendClient) OpenFile(ctx context.Context, infoHash, filePath string, offset, length int64) (io.ReadCloser, int64, error) {
+	segments := strings.Split(filePath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	req, err := b.newRequest(ctx, b.baseURL+"/stream/"+url.PathEscape(infoHash)+"/"+strings.Join(segments, "/"))
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset > 0 || length > 0 {
+		if length > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+		} else {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+	}
+
+	resp, err := b.do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.ContentLength < 0 {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("后端未返回文件大小")
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		// 请求了范围但后端返回整个文件
+		if offset > 0 {
+			resp.Body.Close()
+			return nil, 0, fmt.Errorf("后端不支持范围请求")
+		}
+		return resp.Body, resp.ContentLength, nil
+	}
+
+	// Content-Range: bytes <first>-<last>/<size>
+	_, size, ok := strings.Cut(resp.Header.Get("Content-Range"), "/")
+	fileSize, err := strconv.ParseInt(size, 10, 64)
+	if !ok || err != nil {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("后端返回无效的 Content-Range: %q", resp.Header.Get("Content-Range"))
+	}
+	return resp.Body, fileSize, nil
+}
+
+// get sends an authenticated GET request and turns error responses into errors
+func (b *BackendClient) get(rawURL string) (*http.Response, error) {
+	req, err := b.newRequest(context.Background(), rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return b.do(req)
+}
+
+// newRequest creates an authenticated GET request
+func (b *BackendClient) newRequest(ctx context.Context, rawURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if b.apiKey != "" {
+		req.Header.Set("X-Api-Key", b.apiKey)
+	}
+	return req, nil
+}
+
+// do sends req and turns error responses into errors
+func (b *BackendClient) do(req *http.Request) (*http.Response, error) {
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求后端失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			return nil, fmt.Errorf("请求的范围超出文件末尾")
+		}
+		// 后端的错误响应带有 message 字段
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr) == nil && apiErr.Message != "" {
+			return nil, fmt.Errorf("后端返回 %d: %s", resp.StatusCode, apiErr.Message)
+		}
+		return nil, fmt.Errorf("后端返回 %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// processTorrentRequest serves a request under torrentsPrefix from the backend
+func processTorrentRequest(dataChannel *flowChannel, t *fileTransfer) {
+	req := t.req
+	if backend == nil {
+		sendTransferError(dataChannel, t.id, "Torrents are not available: no backend configured")
+		return
+	}
+
+	rest := strings.TrimPrefix(strings.TrimPrefix(req.Path, torrentsPrefix), "/")
+	if rest == "" {
+		torrents, err := backend.ListTorrents()
+		if err != nil {
+			sendTransferError(dataChannel, t.id, fmt.Sprintf("Error listing torrents: %v", err))
+			return
+		}
+		sendJSON(dataChannel, struct {
+			Type     string           `json:"type"`
+			Torrents []BackendTorrent `json:"torrents"`
+		}{Type: "torrents", Torrents: torrents})
+		return
+	}
+
+	infoHash, filePath, ok := strings.Cut(rest, "/")
+	if !ok || filePath == "" {
+		sendTransferError(dataChannel, t.id, "Invalid path: expected torrents/<infoHash>/<file path>")
+		return
+	}
+	if !extensionAllowed(filePath) {
+		sendTransferError(dataChannel, t.id, fmt.Sprintf("File type not allowed: %s", req.Path))
+		return
+	}
+
+	// 取消传输时同时中止对后端的请求
+	reader, size, err := backend.OpenFile(t.ctx, infoHash, filePath, req.Offset, req.Length)
+	if err != nil {
+		sendTransferError(dataChannel, t.id, fmt.Sprintf("Error opening %s: %v", req.Path, err))
+		return
+	}
+	defer reader.Close()
+
+	offset, length, err := req.Range(size)
+	if err != nil {
+		sendTransferError(dataChannel, t.id, fmt.Sprintf("Invalid range for %s: %v", req.Path, err))
+		return
+	}
+
+	dataChannel.log.Info("sending torrent file", "transfer", t.id, "info_hash", infoHash, "file", filePath)
+	meta := transfer.Control{
+		FileName: path.Base(filePath),
+		FileSize: size,
+		Path:     req.Path,
+		Offset:   offset,
+		Length:   length,
+	}
+	if err := sendFile(dataChannel, t, meta, reader); err != nil {
+		dataChannel.log.Warn("sending torrent file failed", "transfer", t.id, "error", err)
+	}
+}
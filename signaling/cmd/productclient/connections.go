@@ -0,0 +1,90 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// removeConnection closes a connection and forgets it, unless the consumer
+// connected again in the meantime. Its queued and running transfers stop.
+func (cm *ConnectionManager) removeConnection(conn *Connection) {
+	cm.mutex.Lock()
+	current := cm.connections[conn.ConsumerID] == conn
+	if current {
+		delete(cm.connections, conn.ConsumerID)
+	}
+	cm.mutex.Unlock()
+	if current {
+		slog.Info("移除连接", "client", conn.ConsumerID)
+	}
+
+	conn.channel.cancelAll()
+	// 重复关闭是安全的，状态回调和数据通道关闭都会调用这里
+	if err := conn.PeerConnection.Close(); err != nil {
+		slog.Warn("关闭连接失败", "client", conn.ConsumerID, "error", err)
+	}
+}
+
+// snapshot returns the connections ordered by consumer ID
+func (cm *ConnectionManager) snapshot() []*Connection {
+	cm.mutex.Lock()
+	conns := make([]*Connection, 0, len(cm.connections))
+	for _, conn := range cm.connections {
+		conns = append(conns, conn)
+	}
+	cm.mutex.Unlock()
+	slices.SortFunc(conns, func(a, b *Connection) int { return cmp.Compare(a.ConsumerID, b.ConsumerID) })
+	return conns
+}
+
+// usable reports whether a connection in state is being set up or
+// connected, so a repeated connect request does not replace it
+func usable(state webrtc.PeerConnectionState) bool {
+	switch state {
+	case webrtc.PeerConnectionStateNew, webrtc.PeerConnectionStateConnecting, webrtc.PeerConnectionStateConnected:
+		return true
+	}
+	return false
+}
+
+// expireIdle periodically closes idle connections, see closeIdle
+func (cm *ConnectionManager) expireIdle(timeout time.Duration) {
+	ticker := time.NewTicker(min(timeout/4, time.Minute))
+	defer ticker.Stop()
+	for now := range ticker.C {
+		cm.closeIdle(timeout, now)
+	}
+}
+
+// closeIdle closes the connections of consumers that sent no request for
+// timeout and have no queued or running transfers
+func (cm *ConnectionManager) closeIdle(timeout time.Duration, now time.Time) {
+	for _, conn := range cm.snapshot() {
+		idle := now.Sub(time.Unix(0, conn.lastRequest.Load()))
+		if idle < timeout || len(conn.channel.snapshot()) > 0 {
+			continue
+		}
+		slog.Info("连接空闲，关闭连接", "client", conn.ConsumerID, "idle", idle.Round(time.Second))
+		cm.removeConnection(conn)
+	}
+}
+
+// printStats prints the data sent to each consumer and the average rate
+// since its connection was set up
+func (cm *ConnectionManager) printStats() {
+	conns := cm.snapshot()
+	fmt.Printf("Connections: %d\n", len(conns))
+	for _, conn := range conns {
+		sent := conn.channel.sent.Load()
+		uptime := time.Since(conn.created)
+		idle := time.Since(time.Unix(0, conn.lastRequest.Load()))
+		fmt.Printf("- Consumer %s: %s for %v, %d transfers, %d bytes sent at %.2f MB/s, idle %v\n",
+			conn.ConsumerID, conn.PeerConnection.ConnectionState(), uptime.Round(time.Second), len(conn.channel.snapshot()),
+			sent, float64(sent)/max(uptime.Seconds(), 0.001)/1024/1024, idle.Round(time.Second))
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func newTestConnection(t *testing.T, cm *ConnectionManager, consumerID string) *Connection {
+	t.Helper()
+	conn, err := cm.CreateConnection(consumerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.PeerConnection.Close() })
+	return conn
+}
+
+func TestReplaceConnection(t *testing.T) {
+	cm := NewConnectionManager(webrtc.NewAPI())
+	old := newTestConnection(t, cm, "c1")
+	conn := newTestConnection(t, cm, "c1")
+
+	if got, ok := cm.connection("c1"); !ok || got != conn {
+		t.Fatalf("connection of c1 is not the new one")
+	}
+	if state := old.PeerConnection.ConnectionState(); state != webrtc.PeerConnectionStateClosed {
+		t.Errorf("replaced connection is %s, want closed", state)
+	}
+
+	// a late callback of the replaced connection keeps the new one
+	cm.removeConnection(old)
+	if got, ok := cm.connection("c1"); !ok || got != conn {
+		t.Errorf("removing the replaced connection removed the new one")
+	}
+}
+
+func TestCloseIdle(t *testing.T) {
+	cm := NewConnectionManager(webrtc.NewAPI())
+	idle := newTestConnection(t, cm, "idle")
+	active := newTestConnection(t, cm, "active")
+	busy := newTestConnection(t, cm, "busy")
+
+	now := time.Now()
+	idle.lastRequest.Store(now.Add(-time.Hour).UnixNano())
+	active.lastRequest.Store(now.Add(-time.Minute).UnixNano())
+	busy.lastRequest.Store(now.Add(-time.Hour).UnixNano())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	busy.channel.transfers[1] = &fileTransfer{id: 1, ctx: ctx, cancel: cancel}
+
+	cm.closeIdle(10*time.Minute, now)
+
+	cases := map[string]struct {
+		conn *Connection
+		kept bool
+	}{
+		"idle":   {idle, false},
+		"active": {active, true},
+		"busy":   {busy, true},
+	}
+	for name, tc := range cases {
+		_, kept := cm.connection(name)
+		closed := tc.conn.PeerConnection.ConnectionState() == webrtc.PeerConnectionStateClosed
+		if kept != tc.kept || closed == tc.kept {
+			t.Errorf("%s: kept %v, closed %v, want kept %v", name, kept, closed, tc.kept)
+		}
+	}
+}
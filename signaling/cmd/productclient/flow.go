@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+
+	"signaling/internal/transfer"
+)
+
+const (
+	// maxBufferedAmount is how much data may wait in the data channel's send
+	// buffer before sending file data pauses
+	maxBufferedAmount = 1 << 20
+	// lowBufferedAmount is where sending resumes
+	lowBufferedAmount = 512 << 10
+
+	// maxMessageSize is the largest data channel message pion and browsers
+	// accept unless the peer announces a larger max-message-size
+	maxMessageSize = 65535
+
+	// Chunks are sized to about chunkDuration of data at the measured rate,
+	// between minChunkSize and maxChunkSize
+	minChunkSize  = 4 << 10
+	maxChunkSize  = maxMessageSize - transfer.ChunkHeaderSize
+	chunkDuration = 20 * time.Millisecond
+)
+
+var errChannelClosed = errors.New("data channel closed")
+
+// flowChannel is a data channel whose file data is paced by its buffered
+// amount, so sends run at link speed without overrunning the SCTP buffers
+type flowChannel struct {
+	*webrtc.DataChannel
+	// low is signalled when the buffered amount drops below lowBufferedAmount
+	low chan struct{}
+
+	// mu guards the transfers of the channel
+	mu sync.Mutex
+	// queue holds the transfers waiting to start, in order
+	queue []*fileTransfer
+	// transfers holds the queued and running transfers by ID
+	transfers map[uint32]*fileTransfer
+	running   int
+	// grant is what the session's access token allows, see -access-secret
+	grant *accessGrant
+
+	// sent counts the file data sent on the channel, for the stats command
+	sent atomic.Int64
+	// log carries the ID of the consumer on the other end
+	log *slog.Logger
+}
+
+func newFlowChannel(dataChannel *webrtc.DataChannel, consumerID string) *flowChannel {
+	c := &flowChannel{
+		DataChannel: dataChannel,
+		low:         make(chan struct{}, 1),
+		transfers:   make(map[uint32]*fileTransfer),
+		log:         slog.With("client", consumerID),
+	}
+	dataChannel.SetBufferedAmountLowThreshold(lowBufferedAmount)
+	dataChannel.OnBufferedAmountLow(func() {
+		select {
+		case c.low <- struct{}{}:
+		default:
+		}
+	})
+	return c
+}
+
+// waitForBuffer blocks while more than maxBufferedAmount is waiting to be
+// sent, or until ctx is canceled
+func (c *flowChannel) waitForBuffer(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for c.BufferedAmount() > maxBufferedAmount {
+		select {
+		case <-c.low:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			// 通道关闭后不会再触发 OnBufferedAmountLow
+			if c.ReadyState() != webrtc.DataChannelStateOpen {
+				return errChannelClosed
+			}
+		}
+	}
+	return nil
+}
+
+// adaptChunkSize returns the chunk size for sending at rate bytes per second
+func adaptChunkSize(rate float64) int {
+	size := int(rate * chunkDuration.Seconds())
+	if size < minChunkSize {
+		return minChunkSize
+	}
+	if size > maxChunkSize {
+		return maxChunkSize
+	}
+	return size
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"signaling/internal/transfer"
+)
+
+const (
+	// maxListEntries bounds a listing, so a huge base directory cannot keep
+	// the producer busy
+	maxListEntries = 10000
+	// maxListMessage leaves room for the rest of a listing message
+	maxListMessage = maxMessageSize - 1024
+)
+
+// videoExts are the extensions listed as videos, as in the backend
+var videoExts = map[string]bool{
+	".mp4":  true,
+	".mkv":  true,
+	".avi":  true,
+	".mov":  true,
+	".wmv":  true,
+	".flv":  true,
+	".webm": true,
+	".m4v":  true,
+	".mpg":  true,
+	".mpeg": true,
+	".3gp":  true,
+	".rmvb": true,
+	".ts":   true,
+	".m2ts": true,
+}
+
+// processListRequest sends the files under the requested directory of
+// basedir that the session may request
+func processListRequest(dataChannel *flowChannel, req transfer.Request) {
+	if !dataChannel.listable(req.Path) {
+		sendErrorMessage(dataChannel, errAccessDenied.Error())
+		return
+	}
+	_, dir, err := resolvePath(req.Path)
+	if err != nil {
+		sendErrorMessage(dataChannel, err.Error())
+		return
+	}
+	root, err := filepath.EvalSymlinks(*baseDir)
+	if err != nil {
+		sendErrorMessage(dataChannel, fmt.Sprintf("Base directory unavailable: %v", err))
+		return
+	}
+
+	entries, truncated, err := listFiles(root, dir)
+	if err != nil {
+		sendErrorMessage(dataChannel, fmt.Sprintf("Error listing %s: %v", req.Path, err))
+		return
+	}
+	// 只列出允许请求的文件
+	allowed := entries[:0]
+	for _, entry := range entries {
+		if entry.Dir && dataChannel.listable(entry.Path) || !entry.Dir && extensionAllowed(entry.Path) && dataChannel.allowed(entry.Path) {
+			allowed = append(allowed, entry)
+		}
+	}
+	dataChannel.log.Info("sending listing", "dir", dir, "entries", len(allowed), "truncated", truncated)
+	sendListing(dataChannel, req.Path, allowed, truncated)
+}
+
+// listFiles walks the directory start inside root and returns its files and
+// subdirectories, without start itself, with paths relative to root. Hidden
+// files are skipped. Symbolic links to allowed files inside root are listed
+// with the size of their target.
+func listFiles(root, start string) (entries []transfer.Entry, truncated bool, err error) {
+	info, err := os.Stat(start)
+	if err != nil {
+		return nil, false, err
+	}
+	if !info.IsDir() {
+		return nil, false, fmt.Errorf("not a directory")
+	}
+
+	err = filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if p == start {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if err != nil {
+			// 无法读取的子目录跳过，不影响其余条目
+			slog.Warn("listing failed", "path", p, "error", err)
+			return nil
+		}
+		if len(entries) >= maxListEntries {
+			truncated = true
+			return filepath.SkipAll
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		entry := transfer.Entry{Path: filepath.ToSlash(rel)}
+		switch {
+		case d.IsDir():
+			entry.Dir = true
+		case d.Type().IsRegular() || d.Type()&fs.ModeSymlink != 0:
+			if d.Type()&fs.ModeSymlink != 0 {
+				if real, err := filepath.EvalSymlinks(p); err != nil || !withinDir(root, real) || !extensionAllowed(real) {
+					return nil
+				}
+			}
+			info, err := os.Stat(p)
+			if err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+			entry.Size = info.Size()
+			entry.Video = videoExts[strings.ToLower(path.Ext(entry.Path))]
+		default:
+			return nil
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, truncated, err
+}
+
+// sendListing sends entries in as many list messages as needed to keep each
+// under the data channel's message size limit
+func sendListing(dataChannel *flowChannel, dir string, entries []transfer.Entry, truncated bool) {
+	listing := transfer.Listing{Type: transfer.ControlList, Path: dir, Entries: []transfer.Entry{}}
+	size := len(dir)
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			continue
+		}
+		if size+len(data) > maxListMessage && len(listing.Entries) > 0 {
+			listing.More = true
+			sendJSON(dataChannel, listing)
+			listing.Entries = []transfer.Entry{}
+			size = len(dir)
+		}
+		listing.Entries = append(listing.Entries, entry)
+		size += len(data) + 1
+	}
+	listing.More = false
+	listing.Truncated = truncated
+	sendJSON(dataChannel, listing)
+}
@@ -2,41 +2,73 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/pion/webrtc/v3"
+
+	"signaling/internal/keepalive"
+	"signaling/internal/logging"
+	"signaling/internal/protocol"
+	"signaling/internal/transfer"
 )
 
 var (
-	signalServer = flag.String("server", "shiying.sh.cn:8090", "Signaling server address")
-	clientID     = flag.String("id", "producer-"+fmt.Sprint(time.Now().Unix()), "Client ID")
-	baseDir      = flag.String("basedir", "/root/magnet-player/backend/data", "Base directory for video files")
-	chunkSize    = flag.Int("chunk", 2<<10, "Size of video chunks to send in bytes")
+	signalServer      = flag.String("server", "shiying.sh.cn:8090", "Signaling server host:port, dialed over wss://, or a ws:// or wss:// URL")
+	clientID          = flag.String("id", "producer-"+fmt.Sprint(time.Now().Unix()), "Client ID")
+	serverName        = flag.String("name", "", "Name shown to consumers in the server directory (default the client ID)")
+	description       = flag.String("description", "", "Description shown to consumers in the server directory")
+	token             = flag.String("token", os.Getenv("SIGNALING_TOKEN"), "Access token for the signaling server (default $SIGNALING_TOKEN)")
+	baseDir           = flag.String("basedir", "/root/magnet-player/backend/data", "Base directory for video files")
+	chunkSize         = flag.Int("chunk", 16<<10, "Initial size of the data in each chunk frame in bytes, adapted to the link speed")
+	maxTransfers      = flag.Int("max-transfers", 4, "Files sent at the same time to all consumers; more requests wait in per-consumer queues")
+	consumerTransfers = flag.Int("consumer-transfers", 2, "Files sent at the same time to one consumer")
+	backendURL        = flag.String("backend", "", "magnet-player API to serve torrents from, e.g. http://localhost:8080/magnet/api/v1")
+	backendKey        = flag.String("backend-key", os.Getenv("BACKEND_API_KEY"), "API key for the backend (default $BACKEND_API_KEY)")
+	extensions        = flag.String("extensions", defaultExtensions, "Comma-separated extensions of the files served, or * for any file")
+	accessSecret      = flag.String("access-secret", os.Getenv("PRODUCER_ACCESS_SECRET"), "Require consumers to present an access token signed with this secret (default $PRODUCER_ACCESS_SECRET)")
+	mintToken         = flag.String("mint-token", "", "Print an access token for these comma-separated paths under basedir, / for all files, and exit")
+	tokenTTL          = flag.Duration("token-ttl", 24*time.Hour, "How long tokens printed by -mint-token are valid")
+	idleTimeout       = flag.Duration("idle-timeout", 10*time.Minute, "Close connections to consumers that requested nothing for this long and have no transfers, 0 to keep them")
+
+	// backend is set when -backend is given
+	backend *BackendClient
+
+	// lastTransferID numbers the files sent, so chunks can be matched to them
+	lastTransferID uint32
 )
 
-// Message represents the structure of messages exchanged with the signaling server
-type Message struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
-}
-
 // Connection represents a WebRTC connection to a consumer
 type Connection struct {
 	PeerConnection *webrtc.PeerConnection
 	DataChannel    *webrtc.DataChannel
 	ConsumerID     string
-	Active         bool
+	// channel paces and queues the transfers on DataChannel
+	channel *flowChannel
+
+	// created is when the connection was set up, lastRequest the Unix
+	// nanoseconds of the consumer's last request, for -idle-timeout
+	created     time.Time
+	lastRequest atomic.Int64
 }
 
 // ConnectionManager manages multiple WebRTC connections
@@ -44,18 +76,27 @@ type ConnectionManager struct {
 	connections map[string]*Connection
 	mutex       sync.Mutex
 	api         *webrtc.API
-	wsConn      *websocket.Conn
+	// wsConn is the current signaling connection, replaced on reconnect
+	wsConn *websocket.Conn
+	// writeMu guards wsConn and serializes writes to it, which come from WebRTC callbacks too
+	writeMu sync.Mutex
 }
 
 // NewConnectionManager creates a new connection manager
-func NewConnectionManager(api *webrtc.API, wsConn *websocket.Conn) *ConnectionManager {
+func NewConnectionManager(api *webrtc.API) *ConnectionManager {
 	return &ConnectionManager{
 		connections: make(map[string]*Connection),
 		api:         api,
-		wsConn:      wsConn,
 	}
 }
 
+// setSignalingConn switches to a new signaling connection, nil while reconnecting
+func (cm *ConnectionManager) setSignalingConn(conn *websocket.Conn) {
+	cm.writeMu.Lock()
+	cm.wsConn = conn
+	cm.writeMu.Unlock()
+}
+
 // CreateConnection creates a new WebRTC connection for a consumer
 func (cm *ConnectionManager) CreateConnection(consumerID string) (*Connection, error) {
 	// 基本ICE配置
@@ -81,34 +122,65 @@ func (cm *ConnectionManager) CreateConnection(consumerID string) (*Connection, e
 	}
 
 	// 创建连接对象
+	channel := newFlowChannel(dataChannel, consumerID)
 	conn := &Connection{
 		PeerConnection: peerConnection,
 		DataChannel:    dataChannel,
 		ConsumerID:     consumerID,
-		Active:         true,
+		channel:        channel,
+		created:        time.Now(),
 	}
+	conn.lastRequest.Store(conn.created.UnixNano())
 
 	// 数据通道事件处理
 	dataChannel.OnOpen(func() {
-		log.Printf("数据通道已打开，客户端ID: %s", consumerID)
+		channel.log.Info("数据通道已打开")
 	})
 
 	dataChannel.OnMessage(func(msg webrtc.DataChannelMessage) {
-		// 收到文件路径请求
-		filePath := string(msg.Data)
-		log.Printf("收到文件请求，客户端ID: %s，文件: %s", consumerID, filePath)
+		conn.lastRequest.Store(time.Now().UnixNano())
+		// 收到文件请求：JSON 请求，或旧版客户端发送的文件路径
+		req, err := transfer.ParseRequest(msg.Data)
+		if err != nil {
+			channel.log.Warn("无效的请求", "error", err)
+			sendErrorMessage(channel, err.Error())
+			return
+		}
+
+		switch req.Type {
+		case transfer.RequestCancel:
+			channel.log.Info("收到取消请求", "transfer", req.Transfer)
+			if !channel.cancelTransfer(req.Transfer) {
+				sendErrorMessage(channel, fmt.Sprintf("Unknown transfer %d", req.Transfer))
+			}
+			return
+		case transfer.RequestList:
+			channel.log.Info("收到目录请求", "path", req.Path)
+			go processListRequest(channel, req)
+			return
+		case transfer.RequestAuth:
+			// 令牌决定本次会话可以请求的文件
+			if err := channel.authorize(req.Token); err != nil {
+				channel.log.Warn("访问令牌无效", "error", err)
+				sendErrorMessage(channel, err.Error())
+			} else {
+				channel.log.Info("访问令牌有效")
+			}
+			return
+		}
+
+		channel.log.Info("收到文件请求", "path", req.Path, "offset", req.Offset, "length", req.Length)
 
-		// 处理视频请求
-		go processVideoRequest(dataChannel, filePath)
+		// 请求进入该连接的队列，按并发限制依次发送
+		if err := channel.enqueue(req); err != nil {
+			channel.log.Warn("拒绝文件请求", "path", req.Path, "error", err)
+			sendErrorMessage(channel, err.Error())
+		}
 	})
 
 	dataChannel.OnClose(func() {
-		log.Printf("数据通道已关闭，客户端ID: %s", consumerID)
-		cm.mutex.Lock()
-		if conn, exists := cm.connections[consumerID]; exists {
-			conn.Active = false
-		}
-		cm.mutex.Unlock()
+		channel.log.Info("数据通道已关闭")
+		cm.removeConnection(conn)
 	})
 
 	// ICE候选事件处理
@@ -118,318 +190,344 @@ func (cm *ConnectionManager) CreateConnection(consumerID string) (*Connection, e
 		}
 
 		// 发送ICE候选到消费者
-		candidateJSON := candidate.ToJSON()
-		log.Printf("发送ICE候选到客户端: %s", consumerID)
-		cm.sendSignalingMessage("ice-candidate", candidateJSON, consumerID)
+		candidateJSON, err := json.Marshal(candidate.ToJSON())
+		if err != nil {
+			channel.log.Error("编码ICE候选失败", "error", err)
+			return
+		}
+		cm.sendSignalingMessage(protocol.ICECandidate, consumerID, protocol.ICECandidateMessage{Candidate: candidateJSON})
 	})
 
-	// 连接状态监控
+	// 连接状态监控：失败或关闭的连接立即移除；断开的连接可能恢复，
+	// 未恢复时 ICE 会在超时后进入 failed
 	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
-		log.Printf("连接状态变更为 %s，客户端ID: %s", state.String(), consumerID)
+		channel.log.Info("连接状态变更", "state", state.String())
+		switch state {
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			cm.removeConnection(conn)
+		}
 	})
 
+	cm.mutex.Lock()
+	old := cm.connections[consumerID]
 	cm.connections[consumerID] = conn
+	cm.mutex.Unlock()
+	if old != nil {
+		// 同一消费者的旧连接已不可用，由新连接替换
+		cm.removeConnection(old)
+	}
 	return conn, nil
 }
 
-// ProcessSignalingMessage 处理信令消息
-func (cm *ConnectionManager) ProcessSignalingMessage(msg Message, senderID string) {
-	switch msg.Type {
-	case "connect":
-		log.Printf("收到连接请求，客户端ID: %s", senderID)
+// ProcessSignalingMessage 处理信令消息，msg.From 是信令服务器填写的发送者ID
+func (cm *ConnectionManager) ProcessSignalingMessage(msg *protocol.Message) {
+	senderID := msg.From
+	slog.Log(context.Background(), logging.MessageLevel(msg.Type), "收到信令消息", "dir", logging.In, "type", msg.Type, "client", senderID)
 
-		// 检查是否已存在此消费者的连接，避免重复处理
-		cm.mutex.Lock()
-		conn, exists := cm.connections[senderID]
-		activeExists := exists && conn.Active
-		cm.mutex.Unlock()
+	switch msg.Type {
+	case protocol.ConnectRequest:
+		var req protocol.ConnectRequestMessage
+		if err := msg.DecodePayload(&req); err != nil {
+			slog.Warn("解析连接请求失败", "client", senderID, "error", err)
+			return
+		}
 
-		if activeExists {
-			log.Printf("已存在与客户端 %s 的活跃连接，忽略重复的连接请求", senderID)
+		// 检查是否已存在此消费者的连接，避免重复处理；断开的连接由新连接替换
+		conn, exists := cm.connection(senderID)
+		if exists && usable(conn.PeerConnection.ConnectionState()) {
+			slog.Info("已存在活跃连接，忽略重复的连接请求", "client", senderID)
 			return
 		}
 
 		// 创建新连接
 		conn, err := cm.CreateConnection(senderID)
 		if err != nil {
-			log.Printf("创建连接失败: %v", err)
+			slog.Error("创建连接失败", "client", senderID, "error", err)
 			return
 		}
 
 		// 创建SDP offer
 		offer, err := conn.PeerConnection.CreateOffer(nil)
 		if err != nil {
-			log.Printf("创建offer失败: %v", err)
+			slog.Error("创建offer失败", "client", senderID, "error", err)
 			return
 		}
 
 		// 设置本地描述
 		err = conn.PeerConnection.SetLocalDescription(offer)
 		if err != nil {
-			log.Printf("设置本地描述失败: %v", err)
+			slog.Error("设置本地描述失败", "client", senderID, "error", err)
 			return
 		}
 
 		// 发送offer给消费者
-		offerData := map[string]interface{}{
-			"sdp":      offer.SDP,
-			"type":     offer.Type.String(),
-			"clientId": senderID, // 使用clientId，确保与前端代码一致
-		}
-
-		log.Printf("发送offer给客户端: %s", senderID)
-		cm.sendSignalingMessage("offer", offerData, senderID)
-
-	case "answer":
-		log.Printf("收到answer，客户端ID: %s", senderID)
-
-		// 解析SDP answer
-		var sdpObj map[string]interface{}
-		var sdp string
-
-		// 处理不同格式的answer数据
-		if dataStr, ok := msg.Data.(string); ok {
-			if err := json.Unmarshal([]byte(dataStr), &sdpObj); err != nil {
-				log.Printf("解析SDP answer字符串失败: %v", err)
-				return
-			}
-			if sdpValue, ok := sdpObj["sdp"].(string); ok {
-				sdp = sdpValue
-			}
-		} else if dataMap, ok := msg.Data.(map[string]interface{}); ok {
-			if sdpValue, ok := dataMap["sdp"].(string); ok {
-				sdp = sdpValue
-			}
-			sdpObj = dataMap
-		}
+		cm.sendSignalingMessage(protocol.SDPOffer, senderID, protocol.SDPMessage{SDP: offer.SDP})
 
-		if sdp == "" {
-			log.Printf("无法从answer中获取SDP")
+	case protocol.SDPAnswer:
+		var answer protocol.SDPMessage
+		if err := msg.DecodePayload(&answer); err != nil {
+			slog.Warn("解析SDP answer失败", "client", senderID, "error", err)
 			return
 		}
 
 		// 查找对应的连接
-		cm.mutex.Lock()
-		conn, exists := cm.connections[senderID]
-		cm.mutex.Unlock()
-
-		if !exists || !conn.Active {
-			log.Printf("找不到活跃的连接: %s", senderID)
+		conn, ok := cm.connection(senderID)
+		if !ok {
+			slog.Warn("找不到对应的连接", "client", senderID)
 			return
 		}
 
 		// 设置远程描述
 		err := conn.PeerConnection.SetRemoteDescription(webrtc.SessionDescription{
 			Type: webrtc.SDPTypeAnswer,
-			SDP:  sdp,
+			SDP:  answer.SDP,
 		})
 
 		if err != nil {
-			log.Printf("设置远程描述失败: %v", err)
+			slog.Warn("设置远程描述失败", "client", senderID, "error", err)
 			return
 		}
 
-		log.Printf("设置远程描述成功，客户端ID: %s", senderID)
-
-	case "ice-candidate":
-		log.Printf("收到ICE候选，客户端ID: %s", senderID)
+		slog.Info("设置远程描述成功", "client", senderID)
 
-		// 查找对应的连接
-		cm.mutex.Lock()
-		conn, exists := cm.connections[senderID]
-		cm.mutex.Unlock()
-
-		if !exists || !conn.Active {
-			log.Printf("找不到活跃的连接: %s", senderID)
+	case protocol.ICECandidate:
+		var candidateMsg protocol.ICECandidateMessage
+		if err := msg.DecodePayload(&candidateMsg); err != nil {
+			slog.Warn("解析ICE候选失败", "client", senderID, "error", err)
 			return
 		}
 
-		// 解析ICE候选
-		var candidate map[string]interface{}
-
-		if dataStr, ok := msg.Data.(string); ok {
-			if err := json.Unmarshal([]byte(dataStr), &candidate); err != nil {
-				log.Printf("解析ICE候选字符串失败: %v", err)
-				return
-			}
-		} else if dataMap, ok := msg.Data.(map[string]interface{}); ok {
-			candidate = dataMap
-		} else {
-			log.Printf("未知的ICE候选数据格式")
+		// 查找对应的连接
+		conn, ok := cm.connection(senderID)
+		if !ok {
+			slog.Warn("找不到对应的连接", "client", senderID)
 			return
 		}
 
-		candidateStr, ok := candidate["candidate"].(string)
-		if !ok {
-			log.Printf("ICE候选数据格式错误")
+		var candidate webrtc.ICECandidateInit
+		if err := json.Unmarshal(candidateMsg.Candidate, &candidate); err != nil {
+			slog.Warn("ICE候选数据格式错误", "client", senderID, "error", err)
 			return
 		}
 
 		// 添加ICE候选
-		err := conn.PeerConnection.AddICECandidate(webrtc.ICECandidateInit{
-			Candidate: candidateStr,
-		})
-
-		if err != nil {
-			log.Printf("添加ICE候选失败: %v", err)
+		if err := conn.PeerConnection.AddICECandidate(candidate); err != nil {
+			slog.Warn("添加ICE候选失败", "client", senderID, "error", err)
 			return
 		}
 
+	case protocol.Error:
+		var errMsg protocol.ErrorMessage
+		if err := msg.DecodePayload(&errMsg); err == nil {
+			slog.Warn("信令服务器返回错误", "code", errMsg.Code, "error", errMsg.Message, "type", errMsg.Type, "to", errMsg.To)
+		}
+		// 消费者已离开，不再等待它的answer
+		if errMsg.Code == protocol.ErrCodePeerOffline && errMsg.To != "" {
+			cm.closeConnection(errMsg.To)
+		}
+
+	case protocol.ServerShutdown:
+		// 服务器随后关闭连接，按退避重连；已建立的连接不受影响
+		slog.Info("信令服务器正在关闭，稍后重连")
+
 	default:
-		log.Printf("收到未知类型的消息: %s", msg.Type)
+		slog.Warn("收到未知类型的消息", "client", senderID, "type", msg.Type)
 	}
 }
 
-// Send a message to the signaling server
-func (cm *ConnectionManager) sendSignalingMessage(msgType string, data interface{}, targetID string) {
-	msg := Message{
-		Type: msgType,
-		Data: data,
-	}
+// connection returns the connection to a consumer
+func (cm *ConnectionManager) connection(consumerID string) (*Connection, bool) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	conn, exists := cm.connections[consumerID]
+	return conn, exists
+}
 
-	// 不做额外的ID处理，避免重复
-	// 数据中应该已经包含targetId
+// closeConnection closes the connection to a consumer
+func (cm *ConnectionManager) closeConnection(consumerID string) {
+	if conn, exists := cm.connection(consumerID); exists {
+		cm.removeConnection(conn)
+	}
+}
 
+// sendSignalingMessage sends a message from this producer to the peer with ID to,
+// or to the signaling server itself when to is empty
+func (cm *ConnectionManager) sendSignalingMessage(msgType protocol.MessageType, to string, payload interface{}) {
+	msg, err := protocol.NewMessage(msgType, *clientID, to, payload)
+	if err != nil {
+		slog.Error("encoding message failed", "type", msgType, "error", err)
+		return
+	}
 	msgBytes, err := json.Marshal(msg)
 	if err != nil {
-		log.Printf("Error encoding message: %v", err)
+		slog.Error("encoding message failed", "type", msgType, "error", err)
 		return
 	}
 
 	// 发送到信令服务器
+	cm.writeMu.Lock()
+	defer cm.writeMu.Unlock()
+	if cm.wsConn == nil {
+		slog.Warn("未连接信令服务器，丢弃消息", "dir", logging.Out, "type", msgType, "client", to)
+		return
+	}
 	if err := cm.wsConn.WriteMessage(websocket.TextMessage, msgBytes); err != nil {
-		log.Printf("Error sending message to signaling server: %v", err)
+		slog.Warn("发送信令消息失败", "dir", logging.Out, "type", msgType, "client", to, "error", err)
+		return
 	}
+	slog.Log(context.Background(), logging.MessageLevel(msgType), "发送信令消息", "dir", logging.Out, "type", msgType, "client", to)
 }
 
-// CloseAllConnections closes all WebRTC connections
-func (cm *ConnectionManager) CloseAllConnections() {
+// printTransfers prints the queued and running transfers of all consumers
+func (cm *ConnectionManager) printTransfers() {
+	conns := cm.snapshot()
+	count := 0
+	for _, conn := range conns {
+		for _, t := range conn.channel.snapshot() {
+			count++
+			started := t.started.Load()
+			if started == 0 {
+				fmt.Printf("- Transfer %d to %s: %s, queued\n", t.id, conn.ConsumerID, t.req.Path)
+				continue
+			}
+			sent, length := t.sent.Load(), t.length.Load()
+			elapsed := time.Since(time.Unix(0, started)).Seconds()
+			fmt.Printf("- Transfer %d to %s: %s, %d/%d bytes (%.2f%%) at %.2f MB/s\n",
+				t.id, conn.ConsumerID, t.req.Path, sent, length, float64(sent)*100/float64(max(length, 1)), float64(sent)/max(elapsed, 0.001)/1024/1024)
+		}
+	}
+	fmt.Printf("Transfers: %d\n", count)
+}
+
+// cancelTransfer stops a transfer to any consumer, reporting whether there was one
+func (cm *ConnectionManager) cancelTransfer(transferID uint32) bool {
 	cm.mutex.Lock()
 	defer cm.mutex.Unlock()
-
 	for _, conn := range cm.connections {
-		if conn.Active {
-			conn.PeerConnection.Close()
-			conn.Active = false
+		if conn.channel.cancelTransfer(transferID) {
+			slog.Info("已取消传输", "client", conn.ConsumerID, "transfer", transferID)
+			return true
 		}
 	}
+	return false
+}
+
+// CloseAllConnections closes all WebRTC connections
+func (cm *ConnectionManager) CloseAllConnections() {
+	for _, conn := range cm.snapshot() {
+		cm.removeConnection(conn)
+	}
 }
 
 func main() {
+	setupLogging := logging.Flags()
 	flag.Parse()
+	setupLogging()
+	if *backendURL != "" {
+		backend = NewBackendClient(*backendURL, *backendKey)
+		slog.Info("serving torrents from backend", "url", *backendURL)
+	}
+	transferSlots = make(chan struct{}, max(*maxTransfers, 1))
+	allowedExts = parseExtensions(*extensions)
+	if *mintToken != "" {
+		if *accessSecret == "" {
+			log.Fatal("-mint-token requires -access-secret")
+		}
+		accessToken, err := mintAccessToken(*accessSecret, strings.Split(*mintToken, ","), *tokenTTL)
+		if err != nil {
+			log.Fatalf("Error creating access token: %v", err)
+		}
+		fmt.Println(accessToken)
+		return
+	}
 
 	// Create a new WebRTC API with default codecs
 	api := webrtc.NewAPI()
 
 	// Connect to the signaling server
 	u := url.URL{
-		Scheme:   "wss",
-		Host:     *signalServer,
-		Path:     "/ws",
-		RawQuery: fmt.Sprintf("id=%s&type=producer", *clientID),
+		Scheme: "wss",
+		Host:   *signalServer,
+		Path:   "/ws",
 	}
-	log.Printf("Connecting to signaling server: %s", u.String())
-
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
-	if err != nil {
-		log.Fatalf("Failed to connect to signaling server: %v", err)
+	if strings.Contains(*signalServer, "://") {
+		parsed, err := url.Parse(*signalServer)
+		if err != nil {
+			log.Fatalf("Invalid signaling server URL: %v", err)
+		}
+		u = *parsed
+	}
+	header := http.Header{}
+	if *token != "" {
+		header.Set("Authorization", "Bearer "+*token)
 	}
-	defer conn.Close()
-	log.Println("Connected to signaling server")
 
 	// Create connection manager
-	connectionManager := NewConnectionManager(api, conn)
+	connectionManager := NewConnectionManager(api)
 	defer connectionManager.CloseAllConnections()
+	if *idleTimeout > 0 {
+		go connectionManager.expireIdle(*idleTimeout)
+	}
 
-	// Handle incoming signaling messages
+	// Stay connected to the signaling server. Established WebRTC connections
+	// do not need it, so they keep running while we reconnect.
+	registration := protocol.RegisterMessage{ID: *clientID, Role: protocol.RoleServer, Name: *serverName, Description: *description}
 	go func() {
+		var backoff keepalive.Backoff
 		for {
-			_, msgBytes, err := conn.ReadMessage()
+			slog.Info("connecting to signaling server", "url", u.String())
+			conn, err := dialSignaling(u.String(), header)
 			if err != nil {
-				log.Printf("Error reading from signaling server: %v", err)
-				return
-			}
-
-			// 由于信令服务器发送的是原始消息，不是封装结构
-			var msg Message
-			if err := json.Unmarshal(msgBytes, &msg); err != nil {
-				log.Printf("Error parsing message: %v", err)
+				delay := backoff.Next()
+				slog.Warn("connecting to signaling server failed", "error", err, "retry_in", delay)
+				time.Sleep(delay)
 				continue
 			}
+			slog.Info("connected to signaling server")
 
-			// 从消息中提取发送者ID
-			var senderID string
-
-			// 尝试从消息数据中提取clientId
-			var data map[string]interface{}
-			if dataStr, ok := msg.Data.(string); ok {
-				// 如果Data是字符串，尝试解析成map
-				if err := json.Unmarshal([]byte(dataStr), &data); err == nil {
-					if clientID, ok := data["clientId"].(string); ok && clientID != "" {
-						senderID = clientID
-						log.Printf("Extracted client ID from message: %s", senderID)
-					}
-				}
-			} else if dataMap, ok := msg.Data.(map[string]interface{}); ok {
-				// 如果Data已经是map，直接尝试获取clientId
-				if clientID, ok := dataMap["clientId"].(string); ok && clientID != "" {
-					senderID = clientID
-					log.Printf("Extracted client ID from message data map: %s", senderID)
-				}
-			}
+			connected := time.Now()
+			err = serveSignaling(connectionManager, conn, registration)
+			connectionManager.setSignalingConn(nil)
+			conn.Close()
 
-			// 如果无法从消息中提取ID，则使用之前的逻辑
-			if senderID == "" {
-				if msg.Type == "offer" {
-					// 为新的offer生成一个临时ID
-					senderID = fmt.Sprintf("consumer-%d", time.Now().Unix())
-					log.Printf("No ID in message, assigning temporary ID: %s", senderID)
-				} else {
-					// 对于其他消息类型，尝试根据活跃连接匹配
-					connectionManager.mutex.Lock()
-					for id, conn := range connectionManager.connections {
-						if conn.Active {
-							senderID = id
-							break
-						}
-					}
-					connectionManager.mutex.Unlock()
-
-					if senderID == "" {
-						// 如果找不到活跃连接，使用一个默认值
-						senderID = "unknown-consumer"
-						log.Printf("Could not determine sender ID, using default: %s", senderID)
-					}
-				}
+			// 连接维持了一段时间才重置退避，避免服务器立即断开时频繁重连
+			if time.Since(connected) > keepalive.Timeout {
+				backoff.Reset()
 			}
-
-			// 处理消息
-			connectionManager.ProcessSignalingMessage(msg, senderID)
+			delay := backoff.Next()
+			slog.Warn("lost connection to signaling server", "error", err, "retry_in", delay)
+			time.Sleep(delay)
 		}
 	}()
 
 	// Start a goroutine to read from stdin for commands
 	go func() {
 		scanner := bufio.NewScanner(os.Stdin)
-		fmt.Println("Producer client started. Enter 'list' to see active connections or 'exit' to quit:")
+		fmt.Println("Producer client started. Enter 'list' to see active connections, 'stats' to see their throughput, 'transfers' to see queued and running transfers, 'cancel <transfer>' to stop one or 'exit' to quit:")
 		for scanner.Scan() {
-			cmd := scanner.Text()
+			cmd, arg, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
 			switch cmd {
 			case "list":
-				connectionManager.mutex.Lock()
-				fmt.Printf("Active connections: %d\n", len(connectionManager.connections))
-				for id, conn := range connectionManager.connections {
-					if conn.Active {
-						fmt.Printf("- Consumer %s: active\n", id)
-					} else {
-						fmt.Printf("- Consumer %s: inactive\n", id)
-					}
+				conns := connectionManager.snapshot()
+				fmt.Printf("Active connections: %d\n", len(conns))
+				for _, conn := range conns {
+					fmt.Printf("- Consumer %s: %s\n", conn.ConsumerID, conn.PeerConnection.ConnectionState())
+				}
+			case "stats":
+				connectionManager.printStats()
+			case "transfers":
+				connectionManager.printTransfers()
+			case "cancel":
+				id, err := strconv.ParseUint(strings.TrimSpace(arg), 10, 32)
+				if err != nil {
+					fmt.Println("Usage: cancel <transfer>")
+				} else if !connectionManager.cancelTransfer(uint32(id)) {
+					fmt.Printf("Unknown transfer %d\n", id)
 				}
-				connectionManager.mutex.Unlock()
 			case "exit":
 				os.Exit(0)
 			default:
-				fmt.Println("Unknown command. Available commands: 'list', 'exit'")
+				fmt.Println("Unknown command. Available commands: 'list', 'stats', 'transfers', 'cancel <transfer>', 'exit'")
 			}
 		}
 	}()
@@ -440,148 +538,256 @@ func main() {
 	<-interrupt
 
 	// Close the peer connection
-	log.Println("Shutting down...")
+	slog.Info("shutting down")
 }
 
-func processVideoRequest(dataChannel *webrtc.DataChannel, requestedPath string) {
-	// Sanitize the requested path to prevent directory traversal
-	cleanPath := filepath.Clean(requestedPath)
+// dialSignaling connects to the signaling server. A rejected token is fatal,
+// retrying cannot fix it.
+func dialSignaling(rawURL string, header http.Header) (*websocket.Conn, error) {
+	conn, resp, err := websocket.DefaultDialer.Dial(rawURL, header)
+	if err != nil && resp != nil && resp.StatusCode == http.StatusUnauthorized {
+		log.Fatalf("Failed to connect to signaling server: token rejected, set -token or $SIGNALING_TOKEN")
+	}
+	return conn, err
+}
 
-	// Prevent directory traversal by ensuring the path doesn't contain ".."
-	if filepath.IsAbs(cleanPath) || cleanPath == ".." || filepath.HasPrefix(cleanPath, ".."+string(filepath.Separator)) {
-		sendErrorMessage(dataChannel, "Invalid path: directory traversal attempt detected")
-		return
+// serveSignaling registers on conn and handles its messages until it fails.
+// The registration is repeated every protocol.RefreshInterval so the
+// signaling server keeps this producer in its directory.
+func serveSignaling(cm *ConnectionManager, conn *websocket.Conn, registration protocol.RegisterMessage) error {
+	keepalive.Client(conn)
+	cm.setSignalingConn(conn)
+	// 注册为生产者，每次重连后都要重新注册
+	cm.sendSignalingMessage(protocol.Register, "", registration)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(protocol.RefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cm.sendSignalingMessage(protocol.Register, "", registration)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// Handle incoming signaling messages
+	for {
+		_, msgBytes, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		keepalive.Extend(conn)
+
+		msg, err := protocol.Decode(msgBytes)
+		if err != nil {
+			slog.Warn("invalid signaling message", "dir", logging.In, "error", err)
+			continue
+		}
+
+		// 处理消息
+		cm.ProcessSignalingMessage(msg)
 	}
+}
 
-	// Construct the absolute file path
-	filePath := filepath.Join(*baseDir, cleanPath)
+// processVideoRequest serves a get request, once the transfer left the queue
+func processVideoRequest(dataChannel *flowChannel, t *fileTransfer) {
+	// 种子文件由后端提供，可以在下载完成前播放
+	if !dataChannel.allowed(t.req.Path) {
+		sendTransferError(dataChannel, t.id, errAccessDenied.Error())
+		return
+	}
+	if t.req.Path == torrentsPrefix || strings.HasPrefix(t.req.Path, torrentsPrefix+"/") {
+		processTorrentRequest(dataChannel, t)
+		return
+	}
 
-	// Check if the file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		sendErrorMessage(dataChannel, fmt.Sprintf("File not found: %s", cleanPath))
+	// Resolve symbolic links, which must not lead out of basedir
+	cleanPath, filePath, err := resolvePath(t.req.Path)
+	if err != nil {
+		sendTransferError(dataChannel, t.id, err.Error())
+		return
+	}
+	if !extensionAllowed(cleanPath) || !extensionAllowed(filePath) {
+		sendTransferError(dataChannel, t.id, fmt.Sprintf("File type not allowed: %s", cleanPath))
 		return
 	}
 
 	// Send the video file
-	log.Printf("Sending video file: %s", filePath)
-	if err := sendVideoFile(dataChannel, filePath); err != nil {
-		log.Printf("Error sending video file: %v", err)
-		sendErrorMessage(dataChannel, fmt.Sprintf("Error sending video: %v", err))
+	dataChannel.log.Info("sending video file", "transfer", t.id, "file", filePath)
+	if err := sendVideoFile(dataChannel, t, filePath); err != nil {
+		dataChannel.log.Warn("sending video file failed", "transfer", t.id, "error", err)
 	}
 }
 
-func sendVideoFile(dataChannel *webrtc.DataChannel, filePath string) error {
+// cleanRequestPath turns a requested path into a path relative to basedir,
+// rejecting paths outside of it
+func cleanRequestPath(requestedPath string) (string, error) {
+	// Sanitize the requested path to prevent directory traversal
+	cleanPath := filepath.Clean(requestedPath)
+
+	// Prevent directory traversal by ensuring the path doesn't contain ".."
+	if filepath.IsAbs(cleanPath) || cleanPath == ".." || filepath.HasPrefix(cleanPath, ".."+string(filepath.Separator)) {
+		return "", errors.New("Invalid path: directory traversal attempt detected")
+	}
+	return cleanPath, nil
+}
+
+// sendVideoFile sends the range of the local file at filePath that t asks for
+func sendVideoFile(dataChannel *flowChannel, t *fileTransfer, filePath string) error {
 	// Open the video file
 	file, err := os.Open(filePath)
 	if err != nil {
+		sendTransferError(dataChannel, t.id, fmt.Sprintf("Error opening video: %v", err))
 		return err
 	}
 	defer file.Close()
 
 	// Get file info
 	fileInfo, err := file.Stat()
+	if err == nil && !fileInfo.Mode().IsRegular() {
+		err = fmt.Errorf("%s is not a file", t.req.Path)
+	}
 	if err != nil {
+		sendTransferError(dataChannel, t.id, fmt.Sprintf("Error opening video: %v", err))
 		return err
 	}
-	fileSize := fileInfo.Size()
-
-	// Send file metadata
-	metadata := struct {
-		Type     string `json:"type"`
-		FileName string `json:"fileName"`
-		FileSize int64  `json:"fileSize"`
-	}{
-		Type:     "metadata",
-		FileName: filepath.Base(filePath),
-		FileSize: fileSize,
-	}
 
-	metadataBytes, err := json.Marshal(metadata)
+	offset, length, err := t.req.Range(fileInfo.Size())
 	if err != nil {
+		sendTransferError(dataChannel, t.id, fmt.Sprintf("Invalid range for %s: %v", t.req.Path, err))
 		return err
 	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		sendTransferError(dataChannel, t.id, fmt.Sprintf("Error seeking video: %v", err))
+		return err
+	}
+
+	return sendFile(dataChannel, t, transfer.Control{
+		FileName: filepath.Base(filePath),
+		FileSize: fileInfo.Size(),
+		Path:     t.req.Path,
+		Offset:   offset,
+		Length:   length,
+	}, file)
+}
+
+// sendFile sends the metadata, the requested range of a file in binary chunk
+// frames, and the end-of-file message. meta describes the range; file is
+// positioned at meta.Offset. When sending fails after the metadata, the
+// consumer is told with an error for the transfer, or with canceled when the
+// transfer was canceled.
+func sendFile(dataChannel *flowChannel, t *fileTransfer, meta transfer.Control, file io.Reader) error {
+	ctx := t.ctx
+	t.length.Store(meta.Length)
 
-	if err := dataChannel.Send(metadataBytes); err != nil {
+	// Send file metadata
+	meta.Type = transfer.ControlMetadata
+	meta.Transfer = t.id
+	sendJSON(dataChannel, meta)
+	dataChannel.log.Info("sent file metadata", "transfer", meta.Transfer, "file", meta.FileName,
+		"size", meta.FileSize, "offset", meta.Offset, "length", meta.Length)
+
+	chunks, sum, err := sendChunks(dataChannel, t, meta.Offset, meta.Length, file)
+	if err != nil {
+		// 取消后的读取错误也归为取消
+		if ctx.Err() != nil {
+			sendJSON(dataChannel, transfer.Control{Type: transfer.ControlCanceled, Transfer: meta.Transfer})
+			dataChannel.log.Info("file transfer canceled", "transfer", meta.Transfer, "file", meta.FileName)
+			return nil
+		}
+		sendJSON(dataChannel, transfer.Control{Type: transfer.ControlError, Transfer: meta.Transfer, Error: err.Error()})
 		return err
 	}
-	log.Printf("Sent file metadata: %s, size: %d bytes", filepath.Base(filePath), fileSize)
 
-	// Read and send the file in chunks
-	buffer := make([]byte, *chunkSize)
-	totalSent := 0
+	// Send end-of-file message
+	sendJSON(dataChannel, transfer.Control{
+		Type:     transfer.ControlEOF,
+		Transfer: meta.Transfer,
+		Chunks:   chunks,
+		SHA256:   hex.EncodeToString(sum),
+	})
+	dataChannel.log.Info("file transfer complete", "transfer", meta.Transfer, "file", meta.FileName, "chunks", chunks)
+	return nil
+}
+
+// sendChunks reads length bytes of the file into chunk frames and sends them
+// as fast as the data channel drains, sizing chunks to the measured rate.
+// Chunk offsets count from the start of the file, which is at offset in file.
+// It returns the number of chunks and the SHA-256 of the data sent.
+func sendChunks(dataChannel *flowChannel, t *fileTransfer, offset, length int64, file io.Reader) (uint32, []byte, error) {
+	digest := sha256.New()
+	file = io.TeeReader(io.LimitReader(file, length), digest)
+	// Each chunk is read in place after the frame header
+	frame := make([]byte, transfer.ChunkHeaderSize+maxChunkSize)
+	size := min(max(*chunkSize, minChunkSize), maxChunkSize)
+	var totalSent int64
+	var seq uint32
 	startTime := time.Now()
+	lastLog := startTime
 
 	for {
-		n, err := file.Read(buffer)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
+		if err := dataChannel.waitForBuffer(t.ctx); err != nil {
+			return seq, nil, err
 		}
 
-		// Create chunk message
-		chunkMsg := struct {
-			Type      string `json:"type"`
-			ChunkData []byte `json:"chunkData"`
-		}{
-			Type:      "chunk",
-			ChunkData: buffer[:n],
+		// 每次读满一个分块；后端的响应可能在返回最后一段数据的同时返回 io.EOF
+		n, err := io.ReadFull(file, frame[transfer.ChunkHeaderSize:transfer.ChunkHeaderSize+size])
+		if err == io.EOF {
+			if totalSent < length {
+				return seq, nil, io.ErrUnexpectedEOF
+			}
+			return seq, digest.Sum(nil), nil
 		}
-
-		chunkBytes, err := json.Marshal(chunkMsg)
-		if err != nil {
-			return err
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return seq, nil, err
 		}
 
 		// Send the chunk
-		if err := dataChannel.Send(chunkBytes); err != nil {
-			return err
+		transfer.PutChunkHeader(frame[:transfer.ChunkHeaderSize+n], t.id, seq, offset+totalSent)
+		if err := dataChannel.Send(frame[:transfer.ChunkHeaderSize+n]); err != nil {
+			return seq, nil, err
 		}
+		totalSent += int64(n)
+		t.sent.Store(totalSent)
+		dataChannel.sent.Add(int64(n))
+		seq++
 
-		totalSent += n
 		elapsed := time.Since(startTime).Seconds()
 		if elapsed > 0 {
-			speed := float64(totalSent) / elapsed / 1024 / 1024
-			log.Printf("Sent %d/%d bytes (%.2f%%) at %.2f MB/s",
-				totalSent, fileSize, float64(totalSent)*100/float64(fileSize), speed)
+			rate := float64(totalSent) / elapsed
+			size = adaptChunkSize(rate)
+			if time.Since(lastLog) >= time.Second {
+				lastLog = time.Now()
+				dataChannel.log.Info("sending file", "transfer", t.id, "sent", totalSent, "length", length,
+					"percent", fmt.Sprintf("%.2f", float64(totalSent)*100/float64(length)), "mb_per_sec", fmt.Sprintf("%.2f", rate/1024/1024), "chunk_size", size)
+			}
 		}
-
-		// Add a small delay to prevent overwhelming the channel
-		time.Sleep(5 * time.Millisecond)
-	}
-
-	// Send end-of-file message
-	eofMsg := struct {
-		Type string `json:"type"`
-	}{
-		Type: "eof",
 	}
+}
 
-	eofBytes, err := json.Marshal(eofMsg)
+// sendJSON sends a control message encoded as JSON in a text message,
+// which tells it apart from binary data frames
+func sendJSON(dataChannel *flowChannel, msg interface{}) {
+	msgBytes, err := json.Marshal(msg)
 	if err != nil {
-		return err
+		dataChannel.log.Error("encoding control message failed", "error", err)
+		return
 	}
-
-	if err := dataChannel.Send(eofBytes); err != nil {
-		return err
+	if err := dataChannel.SendText(string(msgBytes)); err != nil {
+		dataChannel.log.Warn("sending control message failed", "error", err)
 	}
-	log.Printf("File transfer complete: %s", filepath.Base(filePath))
-
-	return nil
 }
 
-func sendErrorMessage(dataChannel *webrtc.DataChannel, errMsg string) {
-	errMsgStruct := struct {
-		Type  string `json:"type"`
-		Error string `json:"error"`
-	}{
-		Type:  "error",
-		Error: errMsg,
-	}
+func sendErrorMessage(dataChannel *flowChannel, errMsg string) {
+	sendJSON(dataChannel, transfer.Control{Type: transfer.ControlError, Error: errMsg})
+}
 
-	msgBytes, _ := json.Marshal(errMsgStruct)
-	if err := dataChannel.Send(msgBytes); err != nil {
-		log.Printf("Error sending error message: %v", err)
-	}
+// sendTransferError reports a request that failed after it was queued
+func sendTransferError(dataChannel *flowChannel, transferID uint32, errMsg string) {
+	sendJSON(dataChannel, transfer.Control{Type: transfer.ControlError, Transfer: transferID, Error: errMsg})
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"signaling/internal/transfer"
+)
+
+// maxQueuedTransfers bounds the requests waiting on one data channel
+const maxQueuedTransfers = 32
+
+// transferSlots limits the files sent at the same time to all consumers, see
+// -max-transfers
+var transferSlots chan struct{}
+
+// fileTransfer is a get request queued or being sent on a data channel
+type fileTransfer struct {
+	id     uint32
+	req    transfer.Request
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Progress for the transfers command: started is in Unix nanoseconds,
+	// 0 while the transfer is queued
+	started atomic.Int64
+	length  atomic.Int64
+	sent    atomic.Int64
+}
+
+// enqueue queues a get request and tells the consumer its transfer ID. A
+// request for a range of a file that is queued or being sent already is
+// rejected.
+func (c *flowChannel) enqueue(req transfer.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, t := range c.transfers {
+		if t.req == req {
+			return fmt.Errorf("%s is being sent already as transfer %d", req.Path, t.id)
+		}
+	}
+	if len(c.queue) >= maxQueuedTransfers {
+		return fmt.Errorf("too many queued requests, at most %d", maxQueuedTransfers)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &fileTransfer{id: atomic.AddUint32(&lastTransferID, 1), req: req, ctx: ctx, cancel: cancel}
+	c.transfers[t.id] = t
+	c.queue = append(c.queue, t)
+	// 先告知传输ID，之后的 metadata 才能对应到请求
+	sendJSON(c, transfer.Control{
+		Type:     transfer.ControlQueued,
+		Transfer: t.id,
+		Path:     req.Path,
+		Offset:   req.Offset,
+		Length:   req.Length,
+	})
+	c.dispatch()
+	return nil
+}
+
+// dispatch starts queued transfers while fewer than -consumer-transfers are
+// running on the channel. c.mu must be held.
+func (c *flowChannel) dispatch() {
+	for c.running < *consumerTransfers && len(c.queue) > 0 {
+		t := c.queue[0]
+		c.queue = c.queue[1:]
+		c.running++
+		go c.run(t)
+	}
+}
+
+// run sends a transfer once one of the global transferSlots is free
+func (c *flowChannel) run(t *fileTransfer) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.transfers, t.id)
+		c.running--
+		c.dispatch()
+		c.mu.Unlock()
+		t.cancel()
+	}()
+
+	select {
+	case transferSlots <- struct{}{}:
+		defer func() { <-transferSlots }()
+	case <-t.ctx.Done():
+		sendJSON(c, transfer.Control{Type: transfer.ControlCanceled, Transfer: t.id})
+		return
+	}
+	t.started.Store(time.Now().UnixNano())
+	processVideoRequest(c, t)
+}
+
+// cancelTransfer stops a queued or running transfer, reporting whether there
+// was one
+func (c *flowChannel) cancelTransfer(transferID uint32) bool {
+	c.mu.Lock()
+	t, ok := c.transfers[transferID]
+	queued := false
+	if ok {
+		if i := slices.Index(c.queue, t); i >= 0 {
+			c.queue = slices.Delete(c.queue, i, i+1)
+			delete(c.transfers, transferID)
+			queued = true
+		}
+	}
+	c.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	t.cancel()
+	// 排队中的传输没有协程，由这里回复
+	if queued {
+		sendJSON(c, transfer.Control{Type: transfer.ControlCanceled, Transfer: transferID})
+	}
+	return true
+}
+
+// cancelAll drops the queue and stops the running transfers, once the
+// channel is closed
+func (c *flowChannel) cancelAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range c.queue {
+		delete(c.transfers, t.id)
+		t.cancel()
+	}
+	c.queue = nil
+	for _, t := range c.transfers {
+		t.cancel()
+	}
+}
+
+// snapshot returns the queued and running transfers of the channel by ID
+func (c *flowChannel) snapshot() []*fileTransfer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	transfers := make([]*fileTransfer, 0, len(c.transfers))
+	for _, t := range c.transfers {
+		transfers = append(transfers, t)
+	}
+	slices.SortFunc(transfers, func(a, b *fileTransfer) int { return cmp.Compare(a.id, b.id) })
+	return transfers
+}
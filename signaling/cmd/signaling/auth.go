@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"signaling/internal/protocol"
+)
+
+// Environment variables configuring access to the signaling server. Each holds
+// a comma-separated list. Authentication is off when no token is configured.
+const (
+	// envProducerTokens lists the tokens that may register as a producer (role server)
+	envProducerTokens = "SIGNALING_PRODUCER_TOKENS"
+	// envConsumerTokens lists the tokens that may register as a consumer (role client)
+	envConsumerTokens = "SIGNALING_CONSUMER_TOKENS"
+	// envProducerIDs lists the IDs producers may register with, any ID when empty
+	envProducerIDs = "SIGNALING_PRODUCER_IDS"
+)
+
+var (
+	errRoleForbidden       = errors.New("the token does not allow this role")
+	errProducerIDForbidden = errors.New("this producer id is not allowed")
+)
+
+// rolePermissions lists the message types each role may send
+var rolePermissions = map[string]map[protocol.MessageType]bool{
+	protocol.RoleServer: {
+		protocol.Register:     true,
+		protocol.SDPOffer:     true,
+		protocol.ICECandidate: true,
+	},
+	protocol.RoleClient: {
+		protocol.Register:       true,
+		protocol.ListServers:    true,
+		protocol.ConnectRequest: true,
+		protocol.SDPAnswer:      true,
+		protocol.ICECandidate:   true,
+	},
+}
+
+// authConfig holds the access tokens of each role
+type authConfig struct {
+	// tokens maps a token to the roles it may register with
+	tokens map[string][]string
+	// producerIDs is nil when any producer ID is allowed
+	producerIDs map[string]bool
+}
+
+// auth is the access configuration of this server, loaded in main
+var auth = &authConfig{}
+
+// loadAuthConfig reads the access configuration from the environment
+func loadAuthConfig() *authConfig {
+	a := &authConfig{tokens: make(map[string][]string)}
+	for _, token := range splitList(os.Getenv(envProducerTokens)) {
+		a.tokens[token] = append(a.tokens[token], protocol.RoleServer)
+	}
+	for _, token := range splitList(os.Getenv(envConsumerTokens)) {
+		a.tokens[token] = append(a.tokens[token], protocol.RoleClient)
+	}
+	if ids := splitList(os.Getenv(envProducerIDs)); len(ids) > 0 {
+		a.producerIDs = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			a.producerIDs[id] = true
+		}
+	}
+	return a
+}
+
+// enabled reports whether connections need a token
+func (a *authConfig) enabled() bool {
+	return len(a.tokens) > 0
+}
+
+// authenticate returns the roles the request's token allows. The token is
+// taken from an "Authorization: Bearer" header or the token query parameter,
+// for browsers that cannot set headers on WebSocket requests.
+func (a *authConfig) authenticate(r *http.Request) ([]string, bool) {
+	if !a.enabled() {
+		return []string{protocol.RoleServer, protocol.RoleClient}, true
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		return nil, false
+	}
+	// 逐个比较所有令牌，耗时不泄露令牌内容
+	var roles []string
+	for candidate, candidateRoles := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			roles = candidateRoles
+		}
+	}
+	return roles, roles != nil
+}
+
+// authorize checks that a connection may register with reg
+func (a *authConfig) authorize(roles []string, reg protocol.RegisterMessage) error {
+	allowed := false
+	for _, role := range roles {
+		if role == reg.Role {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return errRoleForbidden
+	}
+	if reg.Role == protocol.RoleServer && a.producerIDs != nil && !a.producerIDs[reg.ID] {
+		return errProducerIDForbidden
+	}
+	return nil
+}
+
+// permitted reports whether a client of the role may send messages of the type.
+// Unknown types are left to the message handler to reject.
+func permitted(role string, msgType protocol.MessageType) bool {
+	for _, types := range rolePermissions {
+		if types[msgType] {
+			return rolePermissions[role][msgType]
+		}
+	}
+	return true
+}
+
+// bearerToken extracts the token of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
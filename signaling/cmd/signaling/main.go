@@ -1,27 +1,93 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sort"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/acme/autocert"
+
+	"signaling/internal/keepalive"
+	"signaling/internal/logging"
+	"signaling/internal/protocol"
+)
+
+// Server options, each flag defaults to an environment variable
+var (
+	listenAddr      = flag.String("addr", envOr("SIGNALING_ADDR", ":8090"), "Listen address ($SIGNALING_ADDR)")
+	certFile        = flag.String("tls-cert", os.Getenv("SIGNALING_TLS_CERT_FILE"), "TLS certificate file, serves wss:// with -tls-key ($SIGNALING_TLS_CERT_FILE)")
+	keyFile         = flag.String("tls-key", os.Getenv("SIGNALING_TLS_KEY_FILE"), "TLS key file ($SIGNALING_TLS_KEY_FILE)")
+	autocertHosts   = flag.String("autocert", os.Getenv("SIGNALING_AUTOCERT_DOMAINS"), "Comma-separated domains to get Let's Encrypt certificates for ($SIGNALING_AUTOCERT_DOMAINS)")
+	autocertDir     = flag.String("autocert-dir", envOr("SIGNALING_AUTOCERT_DIR", "./autocert"), "Directory to cache certificates in ($SIGNALING_AUTOCERT_DIR)")
+	autocertEmail   = flag.String("autocert-email", os.Getenv("SIGNALING_AUTOCERT_EMAIL"), "Contact email for Let's Encrypt ($SIGNALING_AUTOCERT_EMAIL)")
+	httpAddr        = flag.String("http-addr", os.Getenv("SIGNALING_HTTP_ADDR"), "Plain HTTP listen address answering ACME challenges and redirecting to HTTPS, e.g. :80 ($SIGNALING_HTTP_ADDR)")
+	readTimeout     = flag.Duration("read-timeout", envDuration("SIGNALING_READ_TIMEOUT", 10*time.Second), "Time to read the upgrade request and the register message ($SIGNALING_READ_TIMEOUT)")
+	writeTimeout    = flag.Duration("write-timeout", envDuration("SIGNALING_WRITE_TIMEOUT", 10*time.Second), "Time to write the upgrade response and each message ($SIGNALING_WRITE_TIMEOUT)")
+	metricsAddr     = flag.String("metrics-addr", os.Getenv("SIGNALING_METRICS_ADDR"), "Listen address for /metrics, e.g. 127.0.0.1:9090; served on -addr when empty ($SIGNALING_METRICS_ADDR)")
+	shutdownTimeout = flag.Duration("shutdown-timeout", envDuration("SIGNALING_SHUTDOWN_TIMEOUT", 10*time.Second), "Time to wait for peers to disconnect on SIGINT or SIGTERM ($SIGNALING_SHUTDOWN_TIMEOUT)")
 )
 
 // Client represents a connected client (producer or consumer)
 type Client struct {
 	ID   string
 	Conn *websocket.Conn
-	Type string // "producer" or "consumer"
+	Role string // protocol.RoleServer or protocol.RoleClient
+
+	// Name and Description of a producer, listed in the server directory
+	Name        string
+	Description string
+	// lastSeen is the time of the last message, guarded by clientsMux
+	lastSeen time.Time
+
+	// writeMu serializes writes, websocket connections allow one writer at a time
+	writeMu sync.Mutex
+	// log carries the client's ID and role, its remote address until it registered
+	log *slog.Logger
 }
 
-// Message represents the structure of messages exchanged with clients
-type Message struct {
-	Type string          `json:"type"`
-	Data json.RawMessage `json:"data"`
+// Send writes a message to the client
+func (c *Client) Send(msg *protocol.Message) error {
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	// 对端不读取时不会一直阻塞转发
+	if *writeTimeout > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(*writeTimeout))
+	}
+	if err := c.Conn.WriteMessage(websocket.TextMessage, msgBytes); err != nil {
+		return err
+	}
+	sentBytesTotal.add(uint64(len(msgBytes)))
+	c.log.Debug("message sent", "dir", logging.Out, "type", msg.Type, "from", msg.From, "bytes", len(msgBytes))
+	return nil
 }
 
+var (
+	errNotRegistered       = errors.New("the first message must be a register message")
+	errInvalidRegistration = errors.New("register needs an id and the role server or client")
+	errNoTarget            = errors.New("message has no recipient")
+	errPeerOffline         = errors.New("peer is not connected")
+	errSameRole            = errors.New("messages can only be sent between a server and a client")
+	errChangedRegistration = errors.New("a connection cannot change its id or role")
+	errIDTaken             = errors.New("the id is registered with another role")
+)
+
 var (
 	clients    = make(map[string]*Client)
 	clientsMux sync.Mutex
@@ -33,102 +99,524 @@ var (
 )
 
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// 升级前校验令牌，未授权的连接不占用 WebSocket
+	roles, ok := auth.authenticate(r)
+	if !ok {
+		rejectedTotal.add(1, "token")
+		slog.Warn("connection rejected: missing or invalid token", "remote_addr", r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="signaling"`)
+		http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+		return
+	}
+
 	// Upgrade HTTP connection to WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("Failed to upgrade connection: %v", err)
+		slog.Warn("websocket upgrade failed", "remote_addr", r.RemoteAddr, "error", err)
 		return
 	}
 	defer conn.Close()
+	// 关闭过程中升级的连接直接关闭，对端稍后重连
+	if !beginConn(conn) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(*writeTimeout))
+		return
+	}
+	defer endConn(conn)
 
-	// Register client with a unique ID
-	clientID := r.URL.Query().Get("id")
-	clientType := r.URL.Query().Get("type")
-
-	if clientID == "" || (clientType != "producer" && clientType != "consumer") {
-		log.Printf("Invalid client parameters")
+	// 第一条消息必须是注册消息
+	client, err := register(conn, roles)
+	if err != nil {
+		rejectedTotal.add(1, "registration")
+		connectionsTotal.add(1, "unregistered")
+		slog.Warn("registration failed", "remote_addr", r.RemoteAddr, "error", err)
 		return
 	}
 
-	// Register client
 	clientsMux.Lock()
-	client := &Client{
-		ID:   clientID,
-		Conn: conn,
-		Type: clientType,
+	// 同ID的新连接替换旧连接，但不能冒充另一种角色
+	existing := clients[client.ID]
+	if existing != nil && existing.Role != client.Role {
+		clientsMux.Unlock()
+		rejectedTotal.add(1, "registration")
+		connectionsTotal.add(1, "unregistered")
+		client.log.Warn("registration failed", "error", errIDTaken)
+		sendError(client, nil, protocol.ErrCodeForbidden, errIDTaken.Error())
+		return
 	}
-	clients[clientID] = client
+	client.lastSeen = time.Now()
+	clients[client.ID] = client
 	clientsMux.Unlock()
+	connectionsTotal.add(1, client.Role)
+	if existing != nil {
+		// 重连的客户端可能还留着半开的旧连接
+		client.log.Info("client reconnected, closing its previous connection")
+		existing.Conn.Close()
+	}
 
-	log.Printf("Client connected: %s (%s)", clientID, clientType)
+	// 定期 ping，对端在 keepalive.Timeout 内没有任何响应时读取失败
+	stop := make(chan struct{})
+	defer close(stop)
+	keepalive.Server(conn, stop)
+
+	if client.Role == protocol.RoleServer {
+		client.log.Info("client connected", "name", client.Name, "remote_addr", r.RemoteAddr)
+	} else {
+		client.log.Info("client connected", "remote_addr", r.RemoteAddr)
+	}
 
 	// Handle client messages
 	for {
 		// Read message from the client
 		_, msgBytes, err := conn.ReadMessage()
 		if err != nil {
-			log.Printf("Error reading message: %v", err)
+			client.log.Info("read failed", "error", err)
 			break
 		}
+		keepalive.Extend(conn)
+		receivedBytesTotal.add(uint64(len(msgBytes)))
+
+		msg, err := protocol.Decode(msgBytes)
+		if err != nil {
+			receivedTotal.add(1, "invalid")
+			client.log.Warn("invalid message", "dir", logging.In, "error", err)
+			rejectMessage(client, err)
+			continue
+		}
+		// 发送者以注册的ID为准，不能冒充其他客户端
+		msg.From = client.ID
+		touch(client)
+		receivedTotal.add(1, typeLabel(msg.Type))
+		client.log.Debug("message received", "dir", logging.In, "type", msg.Type, "to", msg.To, "bytes", len(msgBytes))
 
-		// Parse message
-		var msg Message
-		if err := json.Unmarshal(msgBytes, &msg); err != nil {
-			log.Printf("Error parsing message: %v", err)
+		if !permitted(client.Role, msg.Type) {
+			sendError(client, msg, protocol.ErrCodeForbidden, fmt.Sprintf("a %s may not send %s messages", client.Role, msg.Type))
 			continue
 		}
 
 		// Handle message based on type
 		switch msg.Type {
-		case "offer", "answer", "ice-candidate", "connect":
-			// Forward message to the other client
-			forwardMessage(clientID, msgBytes)
+		case protocol.Register:
+			// 生产者定期重新注册以保留在服务器目录中
+			if err := refreshRegistration(client, msg); err != nil {
+				sendError(client, msg, protocol.ErrCodeBadMessage, err.Error())
+			}
+		case protocol.ListServers:
+			sendServerList(client)
+		case protocol.ConnectRequest:
+			handleConnectRequest(client, msg)
+		case protocol.SDPOffer, protocol.SDPAnswer, protocol.ICECandidate:
+			// Forward message to the addressed peer
+			if err := forwardMessage(client, msg); err != nil {
+				client.log.Warn("forward failed", "dir", logging.In, "type", msg.Type, "to", msg.To, "error", err)
+				sendError(client, msg, errorCode(err), err.Error())
+			}
 		default:
-			log.Printf("Unknown message type: %s", msg.Type)
+			client.log.Warn("unknown message type", "dir", logging.In, "type", msg.Type)
+			sendError(client, msg, protocol.ErrCodeBadMessage, "unknown message type: "+string(msg.Type))
 		}
 	}
 
-	// Unregister client when disconnected
+	// Unregister client when disconnected, unless the ID was taken over by a new connection
 	clientsMux.Lock()
-	delete(clients, clientID)
+	if clients[client.ID] == client {
+		delete(clients, client.ID)
+	}
 	clientsMux.Unlock()
-	log.Printf("Client disconnected: %s (%s)", clientID, clientType)
+	client.log.Info("client disconnected")
 }
 
-func forwardMessage(senderID string, msg []byte) {
+// register reads the register message that starts every connection and
+// checks it against the roles the connection's token allows
+func register(conn *websocket.Conn, roles []string) (*Client, error) {
+	client := &Client{Conn: conn, log: slog.With("remote_addr", conn.RemoteAddr().String())}
+
+	if *readTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(*readTimeout))
+	}
+	_, msgBytes, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+	receivedBytesTotal.add(uint64(len(msgBytes)))
+	msg, err := protocol.Decode(msgBytes)
+	if err != nil {
+		receivedTotal.add(1, "invalid")
+		rejectMessage(client, err)
+		return nil, err
+	}
+	receivedTotal.add(1, typeLabel(msg.Type))
+	var reg protocol.RegisterMessage
+	if msg.Type != protocol.Register {
+		err = errNotRegistered
+	} else if err = msg.DecodePayload(&reg); err == nil && (reg.ID == "" || (reg.Role != protocol.RoleServer && reg.Role != protocol.RoleClient)) {
+		err = errInvalidRegistration
+	}
+	if err != nil {
+		sendError(client, msg, protocol.ErrCodeUnregistered, err.Error())
+		return nil, err
+	}
+	if err := auth.authorize(roles, reg); err != nil {
+		sendError(client, msg, protocol.ErrCodeForbidden, err.Error())
+		return nil, fmt.Errorf("%s as %s: %w", reg.ID, reg.Role, err)
+	}
+
+	client.ID = reg.ID
+	client.Role = reg.Role
+	client.log = slog.With("client", reg.ID, "role", reg.Role)
+	client.Name, client.Description = serverName(reg), reg.Description
+	return client, nil
+}
+
+// refreshRegistration updates the directory entry of a registered client
+// from a repeated register message
+func refreshRegistration(client *Client, msg *protocol.Message) error {
+	var reg protocol.RegisterMessage
+	if err := msg.DecodePayload(&reg); err != nil {
+		return err
+	}
+	if reg.ID != client.ID || reg.Role != client.Role {
+		return errChangedRegistration
+	}
 	clientsMux.Lock()
-	defer clientsMux.Unlock()
+	client.Name, client.Description = serverName(reg), reg.Description
+	clientsMux.Unlock()
+	return nil
+}
 
-	sender := clients[senderID]
-	if sender == nil {
-		return
+// serverName returns the name a client is listed with, its ID if it sent none
+func serverName(reg protocol.RegisterMessage) string {
+	if reg.Name == "" {
+		return reg.ID
 	}
+	return reg.Name
+}
 
-	// Determine target type (send producer messages to consumer and vice versa)
-	targetType := "consumer"
-	if sender.Type == "consumer" {
-		targetType = "producer"
+// touch records that a message was received from the client
+func touch(client *Client) {
+	clientsMux.Lock()
+	client.lastSeen = time.Now()
+	clientsMux.Unlock()
+}
+
+// sendServerList answers a list-servers request with the connected producers
+func sendServerList(client *Client) {
+	var list protocol.ServerListMessage
+	clientsMux.Lock()
+	for _, c := range clients {
+		if c.Role == protocol.RoleServer {
+			list.Servers = append(list.Servers, protocol.ServerInfo{ID: c.ID, Name: c.Name, Description: c.Description})
+		}
+	}
+	clientsMux.Unlock()
+	sort.Slice(list.Servers, func(i, j int) bool {
+		if list.Servers[i].Name != list.Servers[j].Name {
+			return list.Servers[i].Name < list.Servers[j].Name
+		}
+		return list.Servers[i].ID < list.Servers[j].ID
+	})
+	if list.Servers == nil {
+		list.Servers = []protocol.ServerInfo{}
 	}
 
-	// Forward message to all clients of the target type
-	for _, client := range clients {
-		if client.Type == targetType {
-			if err := client.Conn.WriteMessage(websocket.TextMessage, msg); err != nil {
-				log.Printf("Error forwarding message to %s: %v", client.ID, err)
+	msg, err := protocol.NewMessage(protocol.ServerList, "", client.ID, list)
+	if err != nil {
+		slog.Error("encoding message failed", "type", protocol.ServerList, "error", err)
+		return
+	}
+	if err := client.Send(msg); err != nil {
+		client.log.Warn("send failed", "dir", logging.Out, "type", msg.Type, "error", err)
+	}
+}
+
+// expireServers removes producers that sent nothing for protocol.ServerTTL
+// from the directory and closes their connections
+func expireServers() {
+	ticker := time.NewTicker(protocol.ServerTTL / 3)
+	defer ticker.Stop()
+	for range ticker.C {
+		var expired []*Client
+		clientsMux.Lock()
+		for id, client := range clients {
+			if client.Role == protocol.RoleServer && time.Since(client.lastSeen) > protocol.ServerTTL {
+				delete(clients, id)
+				expired = append(expired, client)
 			}
 		}
+		clientsMux.Unlock()
+
+		for _, client := range expired {
+			client.log.Info("server timed out, removing it from the directory", "last_seen", client.lastSeen)
+			// 关闭连接会结束该客户端的读取循环
+			client.Conn.Close()
+		}
+	}
+}
+
+// handleConnectRequest forwards a consumer's connect request to the producer it
+// names, or to any producer, and tells the consumer whether it was delivered
+func handleConnectRequest(client *Client, msg *protocol.Message) {
+	var req protocol.ConnectRequestMessage
+	if err := msg.DecodePayload(&req); err != nil {
+		sendError(client, msg, protocol.ErrCodeBadMessage, err.Error())
+		return
+	}
+	if msg.To == "" {
+		msg.To = req.ServerID
+	}
+	if msg.To == "" {
+		msg.To = anyServer()
+	}
+
+	resp := protocol.ConnectResponseMessage{ServerID: msg.To, ClientID: client.ID, Success: true}
+	if msg.To == "" {
+		resp.Success = false
+		resp.Error = "no server available"
+	} else if err := forwardMessage(client, msg); err != nil {
+		resp.Success = false
+		resp.Error = err.Error()
+	}
+	reply, err := protocol.NewMessage(protocol.ConnectResponse, "", client.ID, resp)
+	if err != nil {
+		slog.Error("encoding message failed", "type", protocol.ConnectResponse, "error", err)
+		return
+	}
+	if err := client.Send(reply); err != nil {
+		client.log.Warn("send failed", "dir", logging.Out, "type", reply.Type, "error", err)
+	}
+}
+
+// anyServer returns the ID of a connected producer, or "" if there is none
+func anyServer() string {
+	clientsMux.Lock()
+	defer clientsMux.Unlock()
+	for id, client := range clients {
+		if client.Role == protocol.RoleServer {
+			return id
+		}
+	}
+	return ""
+}
+
+// forwardMessage delivers a message to the peer in msg.To, which must have
+// the opposite role of the sender
+func forwardMessage(sender *Client, msg *protocol.Message) (err error) {
+	defer func() {
+		if err != nil {
+			forwardFailuresTotal.add(1, typeLabel(msg.Type), errorCode(err))
+		} else {
+			forwardedTotal.add(1, typeLabel(msg.Type))
+		}
+	}()
+	if msg.To == "" {
+		return errNoTarget
+	}
+	// 关闭时等待已开始的转发完成
+	if !beginForward() {
+		return errShuttingDown
+	}
+	defer drain.forwards.Done()
+	clientsMux.Lock()
+	target := clients[msg.To]
+	clientsMux.Unlock()
+
+	if target == nil {
+		return errPeerOffline
+	}
+	if target.Role == sender.Role {
+		return errSameRole
+	}
+	if err := target.Send(msg); err != nil {
+		return fmt.Errorf("%w: %v", errPeerOffline, err)
+	}
+	return nil
+}
+
+// errorCode returns the error code of a forwarding error
+func errorCode(err error) string {
+	if errors.Is(err, errPeerOffline) {
+		return protocol.ErrCodePeerOffline
+	}
+	if errors.Is(err, errShuttingDown) {
+		return protocol.ErrCodeShuttingDown
+	}
+	return protocol.ErrCodeBadMessage
+}
+
+// rejectMessage answers a message that could not be decoded
+func rejectMessage(client *Client, err error) {
+	code := protocol.ErrCodeBadMessage
+	if errors.Is(err, protocol.ErrUnsupportedVersion) {
+		code = protocol.ErrCodeVersion
+	}
+	sendError(client, nil, code, err.Error())
+}
+
+// sendError tells a client why its message was rejected; rejected is nil
+// when the message could not be decoded
+func sendError(client *Client, rejected *protocol.Message, code, message string) {
+	errMsg := protocol.ErrorMessage{Code: code, Message: message}
+	if rejected != nil {
+		errMsg.Type = rejected.Type
+		errMsg.To = rejected.To
+	}
+	msg, err := protocol.NewMessage(protocol.Error, "", client.ID, errMsg)
+	if err != nil {
+		slog.Error("encoding message failed", "type", protocol.Error, "error", err)
+		return
+	}
+	if err := client.Send(msg); err != nil {
+		client.log.Warn("send failed", "dir", logging.Out, "type", msg.Type, "code", code, "error", err)
 	}
 }
 
 func main() {
-	http.HandleFunc("/ws", handleWebSocket)
+	setupLogging := logging.Flags()
+	flag.Parse()
+	setupLogging()
+
+	auth = loadAuthConfig()
+	if auth.enabled() {
+		slog.Info("token authentication enabled", "tokens", len(auth.tokens))
+	} else {
+		slog.Info("token authentication disabled", "enable_with", envProducerTokens+" or "+envConsumerTokens)
+	}
+	if auth.producerIDs != nil {
+		slog.Info("producer IDs restricted", "ids", len(auth.producerIDs), "env", envProducerIDs)
+	}
+
+	upgrader.HandshakeTimeout = *writeTimeout
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", handleWebSocket)
+	go expireServers()
 
-	log.Printf("Starting signaling server on :8090 (HTTPS)")
+	// /metrics is served on -metrics-addr, or with the WebSocket endpoint
+	var servers []*http.Server
+	if *metricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.HandleFunc("/metrics", handleMetrics)
+		metricsServer := &http.Server{Addr: *metricsAddr, Handler: metricsMux, ReadTimeout: *readTimeout, WriteTimeout: *writeTimeout}
+		servers = append(servers, metricsServer)
+		slog.Info("metrics server starting", "addr", *metricsAddr)
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("metrics server failed", "error", err)
+			}
+		}()
+	} else {
+		mux.HandleFunc("/metrics", handleMetrics)
+	}
 
-	certFile := "/etc/letsencrypt/live/shiying.sh.cn/fullchain.pem"
-	keyFile := "/etc/letsencrypt/live/shiying.sh.cn/privkey.pem"
+	server := &http.Server{
+		Addr:         *listenAddr,
+		Handler:      mux,
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+		IdleTimeout:  120 * time.Second,
+	}
+
+	domains := splitList(*autocertHosts)
+	switch {
+	case len(domains) > 0 && (*certFile != "" || *keyFile != ""):
+		log.Fatalf("Use either -tls-cert/-tls-key or -autocert, not both")
+	case (*certFile == "") != (*keyFile == ""):
+		log.Fatalf("-tls-cert and -tls-key must be set together")
+	case len(domains) == 0 && *certFile == "" && *httpAddr != "":
+		log.Fatalf("-http-addr is only used with TLS")
+	}
 
-	if err := http.ListenAndServeTLS(":8090", certFile, keyFile, nil); err != nil {
-		log.Fatalf("Failed to start HTTPS server: %v", err)
+	servers = append(servers, server)
+	serveErr := make(chan error, 1)
+	if len(domains) == 0 && *certFile == "" {
+		slog.Info("signaling server starting", "addr", *listenAddr, "scheme", "ws", "protocol_version", protocol.Version)
+		go func() {
+			serveErr <- server.ListenAndServe()
+		}()
+	} else {
+		var fallback http.Handler = http.HandlerFunc(redirectToHTTPS)
+		if len(domains) > 0 {
+			manager := &autocert.Manager{
+				Prompt:     autocert.AcceptTOS,
+				HostPolicy: autocert.HostWhitelist(domains...),
+				Cache:      autocert.DirCache(*autocertDir),
+				Email:      *autocertEmail,
+			}
+			// TLSConfig also answers TLS-ALPN-01 challenges, which need the server on port 443
+			server.TLSConfig = manager.TLSConfig()
+			fallback = manager.HTTPHandler(fallback)
+		}
+		if *httpAddr != "" {
+			httpServer := &http.Server{
+				Addr:        *httpAddr,
+				Handler:     fallback,
+				ReadTimeout: *readTimeout,
+				IdleTimeout: 120 * time.Second,
+			}
+			servers = append(servers, httpServer)
+			slog.Info("HTTP server for redirects and certificate challenges starting", "addr", *httpAddr)
+			go func() {
+				if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					slog.Error("HTTP server failed", "addr", *httpAddr, "error", err)
+				}
+			}()
+		}
+
+		slog.Info("signaling server starting", "addr", *listenAddr, "scheme", "wss", "protocol_version", protocol.Version)
+		// With autocert the certificates come from TLSConfig.GetCertificate
+		go func() {
+			serveErr <- server.ListenAndServeTLS(*certFile, *keyFile)
+		}()
+	}
+
+	// Shut down gracefully on SIGINT or SIGTERM, like the backend
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
+		log.Fatalf("Failed to start server: %v", err)
+	case sig := <-quit:
+		slog.Info("shutting down", "signal", sig.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := shutdown(ctx, servers...); err != nil {
+		cancel()
+		log.Fatalf("Forced shutdown: %v", err)
+	}
+	slog.Info("server stopped")
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL on the TLS listener
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if _, port, err := net.SplitHostPort(*listenAddr); err == nil && port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+}
+
+// envOr returns the environment variable key, or def when it is not set
+func envOr(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// envDuration parses the environment variable key as a duration such as "30s",
+// returning def when it is not set
+func envDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
 	}
+	return d
 }
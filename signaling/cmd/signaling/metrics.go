@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"signaling/internal/protocol"
+)
+
+// counter is a monotonically increasing metric, by the values of its labels
+type counter struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+func newCounter(name, help string, labels ...string) *counter {
+	return &counter{name: name, help: help, labels: labels, values: make(map[string]uint64)}
+}
+
+// add adds n to the counter with the label values given in the order of its labels
+func (c *counter) add(n uint64, values ...string) {
+	key := strings.Join(values, "\x00")
+	c.mu.Lock()
+	c.values[key] += n
+	c.mu.Unlock()
+}
+
+func (c *counter) write(w io.Writer) {
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	samples := make([]string, len(keys))
+	for i, key := range keys {
+		samples[i] = fmt.Sprintf("%s%s %d\n", c.name, labelSet(c.labels, strings.Split(key, "\x00")), c.values[key])
+	}
+	c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	if len(c.labels) == 0 && len(samples) == 0 {
+		// 无标签的计数器从 0 开始
+		fmt.Fprintf(w, "%s 0\n", c.name)
+	}
+	for _, sample := range samples {
+		io.WriteString(w, sample)
+	}
+}
+
+// labelSet formats label names and values as {name="value",...}
+func labelSet(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, values[i])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Metrics of the signaling server
+var (
+	connectionsTotal = newCounter("signaling_connections_total",
+		"WebSocket connections accepted, by the role they registered with, or unregistered", "role")
+	rejectedTotal = newCounter("signaling_rejected_connections_total",
+		"Connections rejected before or at registration, by reason", "reason")
+	receivedTotal = newCounter("signaling_messages_received_total",
+		"Messages received from peers, by type", "type")
+	forwardedTotal = newCounter("signaling_messages_forwarded_total",
+		"Messages delivered from one peer to another, by type", "type")
+	forwardFailuresTotal = newCounter("signaling_forward_failures_total",
+		"Messages that could not be delivered to their recipient, by type and error code", "type", "code")
+	receivedBytesTotal = newCounter("signaling_received_bytes_total",
+		"Bytes of messages received from peers")
+	sentBytesTotal = newCounter("signaling_sent_bytes_total",
+		"Bytes of messages sent to peers, forwarded or from the server")
+
+	counters = []*counter{connectionsTotal, rejectedTotal, receivedTotal, forwardedTotal, forwardFailuresTotal, receivedBytesTotal, sentBytesTotal}
+)
+
+// typeLabel returns the label of a message type. Types peers may not send
+// are counted as "other", so unknown types cannot add series without bound.
+func typeLabel(t protocol.MessageType) string {
+	for _, types := range rolePermissions {
+		if types[t] {
+			return string(t)
+		}
+	}
+	return "other"
+}
+
+// handleMetrics serves the metrics in the Prometheus text format
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	producers, consumers := 0, 0
+	clientsMux.Lock()
+	for _, client := range clients {
+		if client.Role == protocol.RoleServer {
+			producers++
+		} else {
+			consumers++
+		}
+	}
+	clientsMux.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprintf(w, "# HELP signaling_connected_peers Registered peers, by role\n# TYPE signaling_connected_peers gauge\n")
+	fmt.Fprintf(w, "signaling_connected_peers{role=%q} %d\n", protocol.RoleServer, producers)
+	fmt.Fprintf(w, "signaling_connected_peers{role=%q} %d\n", protocol.RoleClient, consumers)
+	for _, c := range counters {
+		c.write(w)
+	}
+}
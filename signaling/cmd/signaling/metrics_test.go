@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCounterWrite(t *testing.T) {
+	cases := map[string]struct {
+		counter func() *counter
+		want    string
+	}{
+		"unlabeled without samples": {
+			func() *counter { return newCounter("bytes_total", "Bytes seen") },
+			"# HELP bytes_total Bytes seen\n# TYPE bytes_total counter\nbytes_total 0\n",
+		},
+		"unlabeled": {
+			func() *counter {
+				c := newCounter("bytes_total", "Bytes seen")
+				c.add(3)
+				c.add(4)
+				return c
+			},
+			"# HELP bytes_total Bytes seen\n# TYPE bytes_total counter\nbytes_total 7\n",
+		},
+		"labeled without samples": {
+			func() *counter { return newCounter("messages_total", "Messages", "type") },
+			"# HELP messages_total Messages\n# TYPE messages_total counter\n",
+		},
+		"labeled, sorted by label values": {
+			func() *counter {
+				c := newCounter("failures_total", "Failures", "type", "code")
+				c.add(1, "sdp-offer", "peer-offline")
+				c.add(2, "ice-candidate", "peer-offline")
+				c.add(1, "sdp-offer", "peer-offline")
+				return c
+			},
+			"# HELP failures_total Failures\n# TYPE failures_total counter\n" +
+				`failures_total{type="ice-candidate",code="peer-offline"} 2` + "\n" +
+				`failures_total{type="sdp-offer",code="peer-offline"} 2` + "\n",
+		},
+	}
+
+	for name, tc := range cases {
+		var b strings.Builder
+		tc.counter().write(&b)
+		if got := b.String(); got != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", name, got, tc.want)
+		}
+	}
+}
+
+func TestLabelSet(t *testing.T) {
+	cases := map[string]struct {
+		names, values []string
+		want          string
+	}{
+		"no labels":  {nil, nil, ""},
+		"one label":  {[]string{"role"}, []string{"server"}, `{role="server"}`},
+		"two labels": {[]string{"type", "code"}, []string{"register", "forbidden"}, `{type="register",code="forbidden"}`},
+		"escaped":    {[]string{"reason"}, []string{`say "hi"` + "\n\\"}, `{reason="say \"hi\"\n\\"}`},
+	}
+
+	for name, tc := range cases {
+		if got := labelSet(tc.names, tc.values); got != tc.want {
+			t.Errorf("%s: got %s, want %s", name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"signaling/internal/logging"
+	"signaling/internal/protocol"
+)
+
+var errShuttingDown = errors.New("the signaling server is shutting down")
+
+// drain tracks the WebSocket connections and the forwards in progress, so
+// shutdown can wait for them. Once closing is set neither starts anew.
+var drain struct {
+	mu       sync.Mutex
+	closing  bool
+	conns    map[*websocket.Conn]bool
+	connsWG  sync.WaitGroup
+	forwards sync.WaitGroup
+}
+
+// beginConn tracks a new connection; it returns false during shutdown.
+// Call endConn when the connection's handler returns.
+func beginConn(conn *websocket.Conn) bool {
+	drain.mu.Lock()
+	defer drain.mu.Unlock()
+	if drain.closing {
+		return false
+	}
+	if drain.conns == nil {
+		drain.conns = make(map[*websocket.Conn]bool)
+	}
+	drain.conns[conn] = true
+	drain.connsWG.Add(1)
+	return true
+}
+
+func endConn(conn *websocket.Conn) {
+	drain.mu.Lock()
+	delete(drain.conns, conn)
+	drain.mu.Unlock()
+	drain.connsWG.Done()
+}
+
+// beginForward tracks a message being forwarded; it returns false during
+// shutdown. Call drain.forwards.Done when the message was sent.
+func beginForward() bool {
+	drain.mu.Lock()
+	defer drain.mu.Unlock()
+	if drain.closing {
+		return false
+	}
+	drain.forwards.Add(1)
+	return true
+}
+
+// shutdown stops the servers from accepting connections, tells the connected
+// peers that the signaling server is going away, waits for the forwards in
+// progress and closes the WebSockets. It returns ctx's error when it had to
+// cut connections off.
+func shutdown(ctx context.Context, servers ...*http.Server) error {
+	// 停止监听；已升级的 WebSocket 连接不受 http.Server.Shutdown 管理
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Warn("HTTP server shutdown failed", "addr", server.Addr, "error", err)
+		}
+	}
+
+	drain.mu.Lock()
+	drain.closing = true
+	drain.mu.Unlock()
+
+	clientsMux.Lock()
+	peers := make([]*Client, 0, len(clients))
+	for _, client := range clients {
+		peers = append(peers, client)
+	}
+	clientsMux.Unlock()
+	slog.Info("notifying peers of the shutdown", "peers", len(peers))
+	for _, client := range peers {
+		msg, err := protocol.NewMessage(protocol.ServerShutdown, "", client.ID, nil)
+		if err != nil {
+			slog.Error("encoding message failed", "type", protocol.ServerShutdown, "error", err)
+			break
+		}
+		if err := client.Send(msg); err != nil {
+			client.log.Warn("send failed", "dir", logging.Out, "type", msg.Type, "error", err)
+		}
+	}
+
+	if !wait(ctx, &drain.forwards) {
+		slog.Warn("gave up waiting for messages being forwarded")
+	}
+
+	// 发送关闭帧，对端回复关闭帧后读取循环结束
+	drain.mu.Lock()
+	conns := make([]*websocket.Conn, 0, len(drain.conns))
+	for conn := range drain.conns {
+		conns = append(conns, conn)
+	}
+	drain.mu.Unlock()
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	deadline := time.Now().Add(*writeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	for _, conn := range conns {
+		conn.WriteControl(websocket.CloseMessage, closeMsg, deadline)
+	}
+	if wait(ctx, &drain.connsWG) {
+		return nil
+	}
+
+	drain.mu.Lock()
+	slog.Warn("closing connections that did not close in time", "connections", len(drain.conns))
+	for conn := range drain.conns {
+		conn.Close()
+	}
+	drain.mu.Unlock()
+	return ctx.Err()
+}
+
+// wait waits for wg until ctx is done, and reports whether wg finished
+func wait(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,100 @@
+// Package keepalive detects dead signaling connections with WebSocket
+// ping/pong and paces reconnection attempts.
+package keepalive
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// PingInterval is how often the signaling server pings its peers
+	PingInterval = 25 * time.Second
+	// Timeout is how long either side waits for a message, ping or pong
+	// before it considers the connection dead
+	Timeout = 60 * time.Second
+	// writeWait bounds writing a ping or pong
+	writeWait = 10 * time.Second
+)
+
+// Server pings conn every PingInterval until stop is closed. Reads on conn
+// fail once nothing, not even a pong, arrived for Timeout; call Extend after
+// each message read.
+func Server(conn *websocket.Conn, stop <-chan struct{}) {
+	Extend(conn)
+	conn.SetPongHandler(func(string) error {
+		Extend(conn)
+		return nil
+	})
+
+	go func() {
+		ticker := time.NewTicker(PingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// WriteControl may be called concurrently with other writes
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Client answers the server's pings on conn. Reads on conn fail once nothing,
+// not even a ping, arrived for Timeout; call Extend after each message read.
+func Client(conn *websocket.Conn) {
+	Extend(conn)
+	conn.SetPingHandler(func(data string) error {
+		Extend(conn)
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(writeWait))
+		// 连接已关闭时由读取循环报告错误
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+}
+
+// Extend pushes the read deadline of conn back to Timeout from now
+func Extend(conn *websocket.Conn) {
+	conn.SetReadDeadline(time.Now().Add(Timeout))
+}
+
+// Backoff computes exponentially growing, jittered delays between reconnection
+// attempts. The zero value starts at one second and caps at one minute.
+type Backoff struct {
+	Min, Max time.Duration
+	attempt  int
+}
+
+// Next returns the delay before the next attempt
+func (b *Backoff) Next() time.Duration {
+	min, max := b.Min, b.Max
+	if min <= 0 {
+		min = time.Second
+	}
+	if max <= 0 {
+		max = time.Minute
+	}
+
+	delay := max
+	if b.attempt < 30 {
+		if d := min << b.attempt; d > 0 && d < max {
+			delay = d
+		}
+	}
+	b.attempt++
+	// 随机抖动，避免服务器重启后所有客户端同时重连
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Reset starts over at the shortest delay, after a connection succeeded
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
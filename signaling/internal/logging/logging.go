@@ -0,0 +1,76 @@
+// Package logging sets up the structured logs of the signaling binaries.
+//
+// Logs about a peer carry its ID as "client", logs about a signaling message
+// its "type" and "dir" ("in" when received, "out" when sent), so the logs of
+// the server, producers and consumers can be matched up.
+package logging
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"strings"
+
+	"signaling/internal/protocol"
+)
+
+// Directions of a signaling message, the value of the "dir" attribute
+const (
+	In  = "in"
+	Out = "out"
+)
+
+// Flags registers the -log-format and -log-level flags, defaulting to
+// $SIGNALING_LOG_FORMAT and $SIGNALING_LOG_LEVEL, and returns a function that
+// calls Setup with their values once the flags are parsed
+func Flags() func() {
+	format := flag.String("log-format", envOr("SIGNALING_LOG_FORMAT", "text"), "Log format, text or json ($SIGNALING_LOG_FORMAT)")
+	level := flag.String("log-level", envOr("SIGNALING_LOG_LEVEL", "info"), "Log level, debug, info, warn or error ($SIGNALING_LOG_LEVEL)")
+	return func() {
+		Setup(*format, *level)
+	}
+}
+
+// Setup makes the default logger write format ("json" or "text") to stderr,
+// dropping records below level. Output of the log package goes through it too.
+func Setup(format, level string) {
+	opts := &slog.HandlerOptions{Level: parseLevel(level)}
+
+	var handler slog.Handler
+	if strings.EqualFold(format, "json") {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// MessageLevel is the level signaling messages of type t are logged at by
+// the clients: candidates and repeated registrations only at debug level
+func MessageLevel(t protocol.MessageType) slog.Level {
+	if t == protocol.ICECandidate || t == protocol.Register {
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
+// parseLevel parses a log level, info when it is not known
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func envOr(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
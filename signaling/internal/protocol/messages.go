@@ -1,5 +1,34 @@
 package protocol
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Version is the protocol version spoken by this build. Peers reject
+// messages of another version with an Error message.
+const Version = 3
+
+// Servers stay in the signaling server's directory for ServerTTL after their
+// last message. They send Register again every RefreshInterval to stay listed.
+const (
+	ServerTTL       = 90 * time.Second
+	RefreshInterval = 30 * time.Second
+)
+
+// ErrUnsupportedVersion is returned by Decode for messages of another version
+var ErrUnsupportedVersion = errors.New("unsupported protocol version")
+
+// Roles a peer registers with
+const (
+	// RoleServer is a producer that serves files
+	RoleServer = "server"
+	// RoleClient is a consumer that requests files
+	RoleClient = "client"
+)
+
 // MessageType defines the type of message being sent
 type MessageType string
 
@@ -24,18 +53,69 @@ const (
 	DataRequest MessageType = "data-request"
 	// DataResponse message is sent by servers with the requested data
 	DataResponse MessageType = "data-response"
+	// Error message is sent by the signaling server when it rejects a message
+	Error MessageType = "error"
+	// ServerShutdown message is sent by the signaling server before it closes
+	// the connection to stop. Peers reconnect to it or its replacement.
+	ServerShutdown MessageType = "server-shutdown"
 )
 
 // Message is the basic message structure for all communication
 type Message struct {
+	Version int         `json:"version"`
 	Type    MessageType `json:"type"`
-	Payload interface{} `json:"payload"`
+	// From is the ID of the sender. The signaling server sets it to the ID
+	// the sender registered with, so it cannot be forged.
+	From string `json:"from,omitempty"`
+	// To is the ID of the peer the message is for. The signaling server
+	// delivers it to that peer only, and answers with an Error message
+	// when the peer is not connected.
+	To      string          `json:"to,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
 }
 
-// RegisterMessage is sent when a client or server registers with the signaling server
+// NewMessage creates a message of the current version with the payload encoded as JSON.
+// to is empty for messages to the signaling server itself.
+func NewMessage(msgType MessageType, from, to string, payload interface{}) (*Message, error) {
+	msg := &Message{Version: Version, Type: msgType, From: from, To: to}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("encode %s payload: %w", msgType, err)
+		}
+		msg.Payload = data
+	}
+	return msg, nil
+}
+
+// Decode parses a message and checks its version
+func Decode(data []byte) (*Message, error) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("decode message: %w", err)
+	}
+	if msg.Version != Version {
+		return nil, fmt.Errorf("%w %d, expected %d", ErrUnsupportedVersion, msg.Version, Version)
+	}
+	return &msg, nil
+}
+
+// DecodePayload parses the payload of a message into v
+func (m *Message) DecodePayload(v interface{}) error {
+	if err := json.Unmarshal(m.Payload, v); err != nil {
+		return fmt.Errorf("decode %s payload: %w", m.Type, err)
+	}
+	return nil
+}
+
+// RegisterMessage is sent when a client or server registers with the signaling server.
+// Servers send it again with the same ID to refresh their directory entry.
 type RegisterMessage struct {
 	ID   string `json:"id"`
 	Role string `json:"role"` // "server" or "client"
+	// Name and Description are shown to clients in the server directory
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
 }
 
 // ServerInfo contains information about a registered server
@@ -66,14 +146,13 @@ type ConnectResponseMessage struct {
 
 // ICECandidateMessage contains WebRTC ICE candidates
 type ICECandidateMessage struct {
-	Target    string      `json:"target"` // ID of the target peer
-	Candidate interface{} `json:"candidate"`
+	// Candidate is a webrtc.ICECandidateInit encoded as JSON
+	Candidate json.RawMessage `json:"candidate"`
 }
 
 // SDPMessage contains WebRTC session description
 type SDPMessage struct {
-	Target string `json:"target"` // ID of the target peer
-	SDP    string `json:"sdp"`
+	SDP string `json:"sdp"`
 }
 
 // DataRequestMessage is sent by clients to request specific data
@@ -88,3 +167,23 @@ type DataResponseMessage struct {
 	Success bool   `json:"success"`
 	Error   string `json:"error,omitempty"`
 }
+
+// Error codes of ErrorMessage
+const (
+	ErrCodeBadMessage   = "bad-message"
+	ErrCodeVersion      = "unsupported-version"
+	ErrCodeUnregistered = "not-registered"
+	ErrCodeNoServer     = "no-server"
+	ErrCodePeerOffline  = "peer-offline"
+	ErrCodeForbidden    = "forbidden"
+	ErrCodeShuttingDown = "shutting-down"
+)
+
+// ErrorMessage is sent by the signaling server when it rejects a message
+type ErrorMessage struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Type and To are those of the rejected message, when it was decoded
+	Type MessageType `json:"type,omitempty"`
+	To   string      `json:"to,omitempty"`
+}
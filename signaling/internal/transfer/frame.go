@@ -0,0 +1,219 @@
+// Package transfer defines how files are listed, requested and sent over a
+// WebRTC data channel.
+//
+// The consumer sends requests as JSON text messages. The producer answers
+// with control messages (metadata, end of file, errors) as JSON text
+// messages. File data is sent as binary frames: a 1-byte frame type, a header
+// depending on the type and the raw payload. Both share one data channel, so
+// they arrive in the order they were sent.
+//
+// Chunks carry a sequence number and a checksum, and the end-of-file message
+// the SHA-256 of all data sent, so the consumer can detect corrupt or missing
+// ranges and request them again.
+package transfer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// FrameChunk is a piece of a file: type, transfer ID (uint32), sequence
+// number of the chunk in the transfer (uint32), offset of the data in the file
+// (uint64), CRC-32C of the data (uint32), all big-endian, then the data
+const FrameChunk byte = 1
+
+// ChunkHeaderSize is the size of a chunk frame without its data
+const ChunkHeaderSize = 1 + 4 + 4 + 8 + 4
+
+// crcTable is the Castagnoli polynomial, computed in hardware on most CPUs
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrShortFrame is returned for frames shorter than their header
+	ErrShortFrame = errors.New("frame too short")
+	// ErrUnknownFrame is returned for frames of an unknown type
+	ErrUnknownFrame = errors.New("unknown frame type")
+)
+
+// Chunk is the content of a chunk frame
+type Chunk struct {
+	Transfer uint32
+	Seq      uint32
+	Offset   int64
+	Checksum uint32
+	Data     []byte
+}
+
+// Valid reports whether the data matches its checksum
+func (c Chunk) Valid() bool {
+	return crc32.Checksum(c.Data, crcTable) == c.Checksum
+}
+
+// PutChunkHeader writes the header of a chunk frame into the first
+// ChunkHeaderSize bytes of frame, including the checksum of the data after
+// it. The data is in frame already, so it can be read into place without
+// copying.
+func PutChunkHeader(frame []byte, transfer, seq uint32, offset int64) {
+	frame[0] = FrameChunk
+	binary.BigEndian.PutUint32(frame[1:5], transfer)
+	binary.BigEndian.PutUint32(frame[5:9], seq)
+	binary.BigEndian.PutUint64(frame[9:17], uint64(offset))
+	binary.BigEndian.PutUint32(frame[17:21], crc32.Checksum(frame[ChunkHeaderSize:], crcTable))
+}
+
+// DecodeFrame parses a binary frame. The returned Data aliases frame.
+func DecodeFrame(frame []byte) (Chunk, error) {
+	if len(frame) == 0 {
+		return Chunk{}, ErrShortFrame
+	}
+	switch frame[0] {
+	case FrameChunk:
+		if len(frame) < ChunkHeaderSize {
+			return Chunk{}, ErrShortFrame
+		}
+		return Chunk{
+			Transfer: binary.BigEndian.Uint32(frame[1:5]),
+			Seq:      binary.BigEndian.Uint32(frame[5:9]),
+			Offset:   int64(binary.BigEndian.Uint64(frame[9:17])),
+			Checksum: binary.BigEndian.Uint32(frame[17:21]),
+			Data:     frame[ChunkHeaderSize:],
+		}, nil
+	default:
+		return Chunk{}, fmt.Errorf("%w %d", ErrUnknownFrame, frame[0])
+	}
+}
+
+// Types of control messages
+const (
+	// ControlQueued answers a get request with the ID of its transfer, which
+	// may wait for others to finish before it starts
+	ControlQueued = "queued"
+	// ControlMetadata starts a transfer with the file's name and size
+	ControlMetadata = "metadata"
+	// ControlEOF ends a transfer after its last chunk, with the number of
+	// chunks and the SHA-256 of the range sent
+	ControlEOF = "eof"
+	// ControlError reports a failed request, or a failed transfer when Transfer is set
+	ControlError = "error"
+	// ControlCanceled confirms that a transfer was stopped by a cancel request
+	ControlCanceled = "canceled"
+	// ControlList answers a list request with a Listing
+	ControlList = "list"
+)
+
+// Control is a control message sent as JSON text
+type Control struct {
+	Type     string `json:"type"`
+	Transfer uint32 `json:"transfer,omitempty"`
+	FileName string `json:"fileName,omitempty"`
+	FileSize int64  `json:"fileSize,omitempty"`
+	// Path, Offset and Length of queued repeat the request, so the consumer
+	// can match the transfer to it; those of metadata give the range
+	// actually sent
+	Path   string `json:"path,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+	Length int64  `json:"length,omitempty"`
+	// Chunks and SHA256 of eof let the consumer check that it got all data
+	Chunks uint32 `json:"chunks,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Types of requests
+const (
+	// RequestGet asks for Length bytes of the file at Path from Offset
+	RequestGet = "get"
+	// RequestCancel stops the transfer with ID Transfer
+	RequestCancel = "cancel"
+	// RequestList asks for the files under the directory Path, the base
+	// directory when Path is empty
+	RequestList = "list"
+	// RequestAuth presents Token, which decides the files the session may
+	// request when the producer requires one
+	RequestAuth = "auth"
+)
+
+// Request is sent by the consumer as JSON text
+type Request struct {
+	Type   string `json:"type"`
+	Path   string `json:"path,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+	// Length is 0 to read up to the end of the file
+	Length   int64  `json:"length,omitempty"`
+	Transfer uint32 `json:"transfer,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+// ParseRequest parses a request. A message that is not a JSON object is a
+// path, asking for the whole file as in earlier versions.
+func ParseRequest(data []byte) (Request, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return Request{Type: RequestGet, Path: string(data)}, nil
+	}
+	var req Request
+	if err := json.Unmarshal(trimmed, &req); err != nil {
+		return Request{}, fmt.Errorf("invalid request: %w", err)
+	}
+	switch req.Type {
+	case RequestGet:
+		if req.Path == "" {
+			return Request{}, errors.New("invalid request: missing path")
+		}
+		if req.Offset < 0 || req.Length < 0 {
+			return Request{}, errors.New("invalid request: negative offset or length")
+		}
+	case RequestCancel:
+		if req.Transfer == 0 {
+			return Request{}, errors.New("invalid request: missing transfer")
+		}
+	case RequestList:
+	case RequestAuth:
+		if req.Token == "" {
+			return Request{}, errors.New("invalid request: missing token")
+		}
+	default:
+		return Request{}, fmt.Errorf("invalid request: unknown type %q", req.Type)
+	}
+	return req, nil
+}
+
+// Range returns the offset and length of the part of a file of size fileSize
+// that req asks for
+func (req Request) Range(fileSize int64) (offset, length int64, err error) {
+	if req.Offset > fileSize {
+		return 0, 0, fmt.Errorf("offset %d is beyond the end of the file (%d bytes)", req.Offset, fileSize)
+	}
+	length = fileSize - req.Offset
+	if req.Length > 0 && req.Length < length {
+		length = req.Length
+	}
+	return req.Offset, length, nil
+}
+
+// Listing is one message of the answer to a list request. Large listings are
+// split into several messages, all but the last with More set, so each fits in
+// a data channel message.
+type Listing struct {
+	Type    string  `json:"type"`
+	Path    string  `json:"path"`
+	Entries []Entry `json:"entries"`
+	More    bool    `json:"more,omitempty"`
+	// Truncated is set on the last message when entries were left out
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Entry is a file or directory in a Listing. Entries are in depth-first,
+// lexical order, so each directory comes before its contents.
+type Entry struct {
+	// Path is relative to the base directory with forward slashes, as used
+	// in get requests
+	Path  string `json:"path"`
+	Size  int64  `json:"size,omitempty"`
+	Dir   bool   `json:"dir,omitempty"`
+	Video bool   `json:"video,omitempty"`
+}
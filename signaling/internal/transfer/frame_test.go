@@ -0,0 +1,137 @@
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestChunkRoundTrip(t *testing.T) {
+	cases := map[string]struct {
+		transfer, seq uint32
+		offset        int64
+		data          []byte
+	}{
+		"empty data":  {1, 0, 0, nil},
+		"data":        {7, 3, 48 << 10, []byte("some file data")},
+		"large ids":   {1<<32 - 1, 1<<32 - 1, 1<<40 + 5, []byte{0, 1, 2}},
+		"large chunk": {2, 9, 16 << 10, bytes.Repeat([]byte{0xab}, 64<<10)},
+	}
+
+	for name, tc := range cases {
+		frame := make([]byte, ChunkHeaderSize+len(tc.data))
+		copy(frame[ChunkHeaderSize:], tc.data)
+		PutChunkHeader(frame, tc.transfer, tc.seq, tc.offset)
+
+		chunk, err := DecodeFrame(frame)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if chunk.Transfer != tc.transfer || chunk.Seq != tc.seq || chunk.Offset != tc.offset || !bytes.Equal(chunk.Data, tc.data) {
+			t.Errorf("%s: got transfer %d, seq %d, offset %d, %d bytes", name, chunk.Transfer, chunk.Seq, chunk.Offset, len(chunk.Data))
+		}
+		if !chunk.Valid() {
+			t.Errorf("%s: checksum does not match", name)
+		}
+
+		if len(tc.data) > 0 {
+			frame[len(frame)-1] ^= 1
+			if chunk, _ := DecodeFrame(frame); chunk.Valid() {
+				t.Errorf("%s: corrupt data passes the checksum", name)
+			}
+		}
+	}
+}
+
+func TestDecodeFrameErrors(t *testing.T) {
+	cases := map[string]struct {
+		frame []byte
+		want  error
+	}{
+		"nil":           {nil, ErrShortFrame},
+		"empty":         {[]byte{}, ErrShortFrame},
+		"type only":     {[]byte{FrameChunk}, ErrShortFrame},
+		"short header":  {append([]byte{FrameChunk}, make([]byte, ChunkHeaderSize-2)...), ErrShortFrame},
+		"unknown type":  {append([]byte{2}, make([]byte, ChunkHeaderSize)...), ErrUnknownFrame},
+		"text as frame": {[]byte(`{"type":"get"}`), ErrUnknownFrame},
+	}
+
+	for name, tc := range cases {
+		if _, err := DecodeFrame(tc.frame); !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", name, err, tc.want)
+		}
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	cases := map[string]struct {
+		message string
+		want    Request
+		wantErr string
+	}{
+		"legacy path":        {message: "movies/a.mp4", want: Request{Type: RequestGet, Path: "movies/a.mp4"}},
+		"legacy path spaces": {message: " my movie.mkv ", want: Request{Type: RequestGet, Path: " my movie.mkv "}},
+		"get":                {message: `{"type":"get","path":"a.mp4","offset":10,"length":20}`, want: Request{Type: RequestGet, Path: "a.mp4", Offset: 10, Length: 20}},
+		"get after space":    {message: ` {"type":"get","path":"a.mp4"}`, want: Request{Type: RequestGet, Path: "a.mp4"}},
+		"cancel":             {message: `{"type":"cancel","transfer":3}`, want: Request{Type: RequestCancel, Transfer: 3}},
+		"list":               {message: `{"type":"list"}`, want: Request{Type: RequestList}},
+		"auth":               {message: `{"type":"auth","token":"abc"}`, want: Request{Type: RequestAuth, Token: "abc"}},
+		"get without path":   {message: `{"type":"get"}`, wantErr: "missing path"},
+		"negative offset":    {message: `{"type":"get","path":"a.mp4","offset":-1}`, wantErr: "negative offset"},
+		"negative length":    {message: `{"type":"get","path":"a.mp4","length":-1}`, wantErr: "negative offset or length"},
+		"cancel without id":  {message: `{"type":"cancel"}`, wantErr: "missing transfer"},
+		"auth without token": {message: `{"type":"auth"}`, wantErr: "missing token"},
+		"unknown type":       {message: `{"type":"put","path":"a.mp4"}`, wantErr: `unknown type "put"`},
+		"missing type":       {message: `{"path":"a.mp4"}`, wantErr: `unknown type ""`},
+		"invalid json":       {message: `{"type":`, wantErr: "invalid request"},
+	}
+
+	for name, tc := range cases {
+		req, err := ParseRequest([]byte(tc.message))
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: err = %v, want it to contain %q", name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if req != tc.want {
+			t.Errorf("%s: got %+v, want %+v", name, req, tc.want)
+		}
+	}
+}
+
+func TestRequestRange(t *testing.T) {
+	cases := map[string]struct {
+		req            Request
+		size           int64
+		offset, length int64
+		wantErr        bool
+	}{
+		"whole file":           {Request{}, 100, 0, 100, false},
+		"from offset":          {Request{Offset: 40}, 100, 40, 60, false},
+		"length":               {Request{Offset: 40, Length: 10}, 100, 40, 10, false},
+		"length past the end":  {Request{Offset: 90, Length: 50}, 100, 90, 10, false},
+		"offset at the end":    {Request{Offset: 100}, 100, 100, 0, false},
+		"length at the end":    {Request{Offset: 100, Length: 10}, 100, 100, 0, false},
+		"empty file":           {Request{}, 0, 0, 0, false},
+		"offset past the end":  {Request{Offset: 101}, 100, 0, 0, true},
+		"offset in empty file": {Request{Offset: 1}, 0, 0, 0, true},
+	}
+
+	for name, tc := range cases {
+		offset, length, err := tc.req.Range(tc.size)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: err = %v, want error %v", name, err, tc.wantErr)
+			continue
+		}
+		if !tc.wantErr && (offset != tc.offset || length != tc.length) {
+			t.Errorf("%s: got %d+%d, want %d+%d", name, offset, length, tc.offset, tc.length)
+		}
+	}
+}
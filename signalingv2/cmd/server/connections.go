@@ -0,0 +1,161 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// 清理长时间无法使用的消费者连接：超过 connectTimeout 仍未建立、
+// 断开超过 disconnectTimeout 仍未恢复的连接会被关闭
+const (
+	connectTimeout    = 30 * time.Second
+	disconnectTimeout = 15 * time.Second
+	sweepInterval     = 5 * time.Second
+)
+
+// consumer 是一个消费者的 PeerConnection 和它的状态
+type consumer struct {
+	pc *webrtc.PeerConnection
+	// state 是最近一次的连接状态，since 是进入该状态的时间，lastActive 是最近一次收到请求的时间
+	state      webrtc.PeerConnectionState
+	since      time.Time
+	lastActive time.Time
+}
+
+// connectionManager 按消费者ID管理连接，信令消息和 WebRTC 回调在不同的 goroutine 中访问它
+type connectionManager struct {
+	mu        sync.Mutex
+	consumers map[string]*consumer
+	// max 是同时保留的消费者数，超出时关闭最久未活动的连接
+	max int
+}
+
+func newConnectionManager(max int) *connectionManager {
+	return &connectionManager{consumers: make(map[string]*consumer), max: max}
+}
+
+// add 记录消费者的新连接；同一消费者重新发送 offer 时关闭它的旧连接
+func (m *connectionManager) add(id string, pc *webrtc.PeerConnection) {
+	now := time.Now()
+	m.mu.Lock()
+	old := m.consumers[id]
+	m.consumers[id] = &consumer{pc: pc, state: webrtc.PeerConnectionStateNew, since: now, lastActive: now}
+	var evicted []*webrtc.PeerConnection
+	for m.max > 0 && len(m.consumers) > m.max {
+		victim := m.leastActive(id)
+		slog.Info("消费者过多，关闭最久未活动的连接", "client", victim)
+		evicted = append(evicted, m.consumers[victim].pc)
+		delete(m.consumers, victim)
+	}
+	m.mu.Unlock()
+
+	if old != nil {
+		slog.Info("消费者重新连接，关闭旧连接", "client", id)
+		evicted = append(evicted, old.pc)
+	}
+	for _, pc := range evicted {
+		closePeerConnection(pc)
+	}
+}
+
+// leastActive 返回除 except 外最久未活动的消费者ID，调用时需持有 m.mu
+func (m *connectionManager) leastActive(except string) string {
+	var victim string
+	var oldest time.Time
+	for id, c := range m.consumers {
+		if id != except && (victim == "" || c.lastActive.Before(oldest)) {
+			victim, oldest = id, c.lastActive
+		}
+	}
+	return victim
+}
+
+// peerConnection 返回消费者当前的 PeerConnection
+func (m *connectionManager) peerConnection(id string) (*webrtc.PeerConnection, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.consumers[id]
+	if !ok {
+		return nil, false
+	}
+	return c.pc, true
+}
+
+// current 报告 pc 是否仍是消费者当前的连接，已被替换或移除时返回 false
+func (m *connectionManager) current(id string, pc *webrtc.PeerConnection) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.consumers[id]
+	return ok && c.pc == pc
+}
+
+// touch 记录消费者的一次请求，活跃的消费者最后才会被淘汰
+func (m *connectionManager) touch(id string) {
+	m.mu.Lock()
+	if c, ok := m.consumers[id]; ok {
+		c.lastActive = time.Now()
+	}
+	m.mu.Unlock()
+}
+
+// stateChanged 记录 pc 的连接状态，失败或关闭的连接立即移除
+func (m *connectionManager) stateChanged(id string, pc *webrtc.PeerConnection, state webrtc.PeerConnectionState) {
+	if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+		m.remove(id, pc)
+		return
+	}
+	m.mu.Lock()
+	if c, ok := m.consumers[id]; ok && c.pc == pc {
+		c.state, c.since = state, time.Now()
+	}
+	m.mu.Unlock()
+}
+
+// remove 移除并关闭 pc；消费者的连接已被新连接替换时只关闭 pc
+func (m *connectionManager) remove(id string, pc *webrtc.PeerConnection) {
+	m.mu.Lock()
+	if c, ok := m.consumers[id]; ok && c.pc == pc {
+		delete(m.consumers, id)
+		slog.Info("移除消费者连接", "client", id)
+	}
+	m.mu.Unlock()
+	closePeerConnection(pc)
+}
+
+// sweep 定期关闭长时间无法建立或断开后没有恢复的连接
+func (m *connectionManager) sweep() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		var dead []*webrtc.PeerConnection
+		m.mu.Lock()
+		for id, c := range m.consumers {
+			idle := time.Since(c.since)
+			switch {
+			case (c.state == webrtc.PeerConnectionStateNew || c.state == webrtc.PeerConnectionStateConnecting) && idle > connectTimeout:
+				slog.Info("连接建立超时，移除消费者", "client", id)
+			case c.state == webrtc.PeerConnectionStateDisconnected && idle > disconnectTimeout:
+				slog.Info("连接断开后未恢复，移除消费者", "client", id)
+			default:
+				continue
+			}
+			delete(m.consumers, id)
+			dead = append(dead, c.pc)
+		}
+		m.mu.Unlock()
+
+		for _, pc := range dead {
+			closePeerConnection(pc)
+		}
+	}
+}
+
+// closePeerConnection 关闭连接，数据通道随之关闭，正在发送的文件会停止
+func closePeerConnection(pc *webrtc.PeerConnection) {
+	if err := pc.Close(); err != nil {
+		slog.Warn("关闭 PeerConnection 失败", "error", err)
+	}
+}
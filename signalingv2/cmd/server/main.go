@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/pion/webrtc/v4"
+
+	"signalingv2/internal/logging"
 )
 
 // Message 定义消息结构，新增 Role 字段和 From 字段
@@ -24,16 +29,72 @@ type Message struct {
 	FilePath  string `json:"file_path,omitempty"`
 	Role      string `json:"role,omitempty"`
 	From      string `json:"from,omitempty"`
+	// ID、Name、Description 用于在信令服务器的服务器目录中注册本 B 端
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+var (
+	signalingURL = flag.String("signaling", "ws://43.156.74.32:8090/ws", "信令服务器地址，启用 TLS 时使用 wss://")
+	serverID     = flag.String("id", "B", "在服务器目录中注册的ID，多个 B 端需各不相同")
+	serverName   = flag.String("name", "", "服务器目录中显示的名称（默认为ID）")
+	description  = flag.String("description", "", "服务器目录中显示的描述")
+	maxConsumers = flag.Int("max-consumers", 32, "同时保留的消费者连接数，超出时关闭最久未活动的连接（0 表示不限制）")
+)
+
+// 信令服务器会移除 90 秒没有消息的 B 端，每 30 秒重新注册一次
+const refreshInterval = 30 * time.Second
+
+// 信令服务器每 25 秒 ping 一次，超过 pongTimeout 没有收到任何消息就认为连接已断开并重连
+const (
+	pongTimeout     = 60 * time.Second
+	maxReconnectGap = time.Minute
+)
+
+// wsConn 是当前的信令连接，重连期间为 nil
+// websocket 同一时间只允许一个写入者，ICE 回调、answer 和重新注册都会写入
+var (
+	wsConn    *websocket.Conn
+	wsWriteMu sync.Mutex
+)
+
+func setSignalingConn(conn *websocket.Conn) {
+	wsWriteMu.Lock()
+	wsConn = conn
+	wsWriteMu.Unlock()
+}
+
+func writeJSON(msg Message) error {
+	wsWriteMu.Lock()
+	defer wsWriteMu.Unlock()
+	if wsConn == nil {
+		return fmt.Errorf("未连接信令服务器")
+	}
+	if err := wsConn.WriteJSON(msg); err != nil {
+		return err
+	}
+	slog.Log(context.Background(), logging.MessageLevel(msg.Type), "发送信令消息", "dir", logging.Out, "type", msg.Type, "client", msg.From)
+	return nil
 }
 
-// 管理多个PeerConnection和DataChannel
-var peerConnections = make(map[string]*webrtc.PeerConnection)
-var dataChannels = make(map[string]*webrtc.DataChannel)
+// 发送缓冲区超过 maxBufferedAmount 时暂停发送，降到 lowBufferedAmount 以下时继续；
+// 分块大小在 minChunkSize 和 maxChunkSize 之间，对端未声明更大的 max-message-size 时
+// pion 和浏览器只接受 65535 字节以内的消息
+const (
+	maxBufferedAmount = 1 << 20
+	lowBufferedAmount = 512 << 10
+	minChunkSize      = 4 << 10
+	maxChunkSize      = 65535
+	chunkDuration     = 20 * time.Millisecond
+)
+
+// connections 管理每个消费者的 PeerConnection，在 main 中创建
+var connections *connectionManager
 
 // 连接到信令服务器
 func connectToSignalingServer() (*websocket.Conn, error) {
-	signalingServerURL := "ws://43.156.74.32:8090/ws"
-	conn, _, err := websocket.DefaultDialer.Dial(signalingServerURL, nil)
+	conn, _, err := websocket.DefaultDialer.Dial(*signalingURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("连接信令服务器失败: %v", err)
 	}
@@ -41,15 +102,15 @@ func connectToSignalingServer() (*websocket.Conn, error) {
 }
 
 // 创建 WebRTC PeerConnection
-func createPeerConnection(conn *websocket.Conn, from string) (*webrtc.PeerConnection, error) {
+func createPeerConnection(from string) (*webrtc.PeerConnection, error) {
 	config := webrtc.Configuration{
 		ICEServers: []webrtc.ICEServer{{URLs: []string{"stun:stun.l.google.com:19302"}}},
 	}
 	peerConnection, err := webrtc.NewPeerConnection(config)
 	if err != nil {
-		fmt.Println("新建p2p失败，因为", err)
 		return nil, err
 	}
+	log := slog.With("client", from)
 
 	// 配置 ICE 候选回调
 	peerConnection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
@@ -60,100 +121,161 @@ func createPeerConnection(conn *websocket.Conn, from string) (*webrtc.PeerConnec
 				Candidate: string(candidateJSON),
 				From:      from,
 			}
-			if err := conn.WriteJSON(msg); err != nil {
-				log.Println("发送 ICE Candidate 失败:", err)
-			} else {
-				log.Println("ICE Candidate 发送成功 for", from)
+			if err := writeJSON(msg); err != nil {
+				log.Warn("发送 ICE Candidate 失败", "error", err)
 			}
 		}
 	})
 
+	// 连接失败或关闭时移除，断开后未恢复的由 connections.sweep 清理
+	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Info("连接状态变更", "state", state.String())
+		connections.stateChanged(from, peerConnection, state)
+	})
+
 	// 监听 DataChannel，接收消费者发送的文件路径
 	peerConnection.OnDataChannel(func(dc *webrtc.DataChannel) {
-		dataChannels[from] = dc
+		// 消费者已用新的 offer 替换了这个连接
+		if !connections.current(from, peerConnection) {
+			dc.Close()
+			return
+		}
+		// 发送缓冲区降到阈值以下时通知 sendFileToPeer 继续发送
+		low := make(chan struct{}, 1)
+		dc.SetBufferedAmountLowThreshold(lowBufferedAmount)
+		dc.OnBufferedAmountLow(func() {
+			select {
+			case low <- struct{}{}:
+			default:
+			}
+		})
 		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
 			var filePath string
 			err := json.Unmarshal(msg.Data, &filePath)
 			if err != nil {
-				log.Println("反序列化文件路径失败:", err)
+				log.Warn("反序列化文件路径失败", "error", err)
 				return
 			}
-			log.Println("收到文件路径:", filePath, "from", from)
-			sendFileToPeer(dc, filePath)
+			log.Info("收到文件路径", "path", filePath)
+			connections.touch(from)
+			sendFileToPeer(dc, low, filePath, log)
 		})
 	})
-	peerConnections[from] = peerConnection
+	connections.add(from, peerConnection)
 	return peerConnection, nil
 }
 
-func sendFileToPeer(dc *webrtc.DataChannel, filePath string) {
+// sendFileToPeer 按数据通道的发送缓冲区控制速度：缓冲超过 maxBufferedAmount 时等待 low 通知，
+// 分块大小随测得的速率调整
+func sendFileToPeer(dc *webrtc.DataChannel, low <-chan struct{}, filePath string, log *slog.Logger) {
+	log = log.With("path", filePath)
 	file, err := os.Open(filePath)
 	if err != nil {
-		log.Println("Open file error:", err)
+		log.Warn("打开文件失败", "error", err)
 		return
 	}
 	defer file.Close()
 
-	buf := make([]byte, 32768) // 32KB
+	buf := make([]byte, maxChunkSize)
+	size := 16 << 10
+	var sent int64
+	start := time.Now()
 	for {
-		n, err := file.Read(buf)
+		for dc.BufferedAmount() > maxBufferedAmount {
+			select {
+			case <-low:
+			case <-time.After(time.Second):
+				// 通道关闭后不会再触发 OnBufferedAmountLow
+				if dc.ReadyState() != webrtc.DataChannelStateOpen {
+					log.Warn("传输过程中数据通道已关闭", "sent", sent)
+					return
+				}
+			}
+		}
+
+		n, err := file.Read(buf[:size])
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			log.Println("Read error:", err)
+			log.Warn("读取文件失败", "error", err)
 			return
 		}
 		sendErr := dc.Send(buf[:n])
 		if sendErr != nil {
-			log.Println("DataChannel send error:", sendErr)
+			log.Warn("数据通道发送失败", "sent", sent, "error", sendErr)
 			return
 		}
-		time.Sleep(33 * time.Millisecond)
+
+		// 每个分块约为 chunkDuration 的数据量
+		sent += int64(n)
+		if elapsed := time.Since(start).Seconds(); elapsed > 0 {
+			size = min(max(int(float64(sent)/elapsed*chunkDuration.Seconds()), minChunkSize), maxChunkSize)
+		}
 	}
-	fmt.Println("文件传输完成")
+	log.Info("文件传输完成", "sent", sent, "mb_per_sec", fmt.Sprintf("%.2f", float64(sent)/max(time.Since(start).Seconds(), 0.001)/1024/1024))
 }
 
-// 处理来自信令服务器的消息
+// 处理来自信令服务器的消息，连接断开或超时后返回
 func handleWebSocketMessages(conn *websocket.Conn) {
+	conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(pongTimeout))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(10*time.Second))
+	})
+
 	for {
 		var msg Message
 		if err := conn.ReadJSON(&msg); err != nil {
-			log.Println("读取 JSON 消息失败:", err)
+			slog.Warn("读取信令消息失败", "dir", logging.In, "error", err)
 			break
 		}
+		conn.SetReadDeadline(time.Now().Add(pongTimeout))
 
-		fmt.Println("收到信令服务器转发的消息:", msg)
+		// 服务器随后关闭连接，按退避重连；已建立的 WebRTC 连接不受影响
+		if msg.Type == "server-shutdown" {
+			slog.Info("信令服务器正在关闭，稍后重连")
+			continue
+		}
 
 		from := msg.From
+		slog.Log(context.Background(), logging.MessageLevel(msg.Type), "收到信令消息", "dir", logging.In, "type", msg.Type, "client", from)
 		if from == "" {
-			log.Println("收到消息缺少from字段，忽略")
+			slog.Warn("收到消息缺少from字段，忽略", "type", msg.Type)
 			continue
 		}
 
 		switch msg.Type {
 		case "offer":
 			// 新建 PeerConnection
-			peerConnection, err := createPeerConnection(conn, from)
+			peerConnection, err := createPeerConnection(from)
 			if err != nil {
-				log.Fatal("创建 PeerConnection 失败:", err)
+				slog.Error("创建 PeerConnection 失败", "client", from, "error", err)
+				continue
 			}
 
+			// 一个消费者的 offer 无效时只丢弃它的连接
 			offer := webrtc.SessionDescription{
 				Type: webrtc.SDPTypeOffer,
 				SDP:  msg.SDP,
 			}
 			if err := peerConnection.SetRemoteDescription(offer); err != nil {
-				log.Fatal("设置远端描述失败:", err)
+				slog.Warn("设置远端描述失败", "client", from, "error", err)
+				connections.remove(from, peerConnection)
+				continue
 			}
 
 			answer, err := peerConnection.CreateAnswer(nil)
 			if err != nil {
-				log.Fatal("创建 answer 失败:", err)
+				slog.Warn("创建 answer 失败", "client", from, "error", err)
+				connections.remove(from, peerConnection)
+				continue
 			}
 
 			if err := peerConnection.SetLocalDescription(answer); err != nil {
-				log.Fatal("设置本地描述失败:", err)
+				slog.Warn("设置本地描述失败", "client", from, "error", err)
+				connections.remove(from, peerConnection)
+				continue
 			}
 
 			answerMsg := Message{
@@ -161,13 +283,13 @@ func handleWebSocketMessages(conn *websocket.Conn) {
 				SDP:  answer.SDP,
 				From: from,
 			}
-			if err := conn.WriteJSON(answerMsg); err != nil {
-				log.Println("发送 answer 失败:", err)
+			if err := writeJSON(answerMsg); err != nil {
+				slog.Warn("发送 answer 失败", "client", from, "error", err)
 			}
 		case "candidate":
-			peerConnection, ok := peerConnections[from]
+			peerConnection, ok := connections.peerConnection(from)
 			if !ok {
-				log.Println("未找到对应的 PeerConnection for", from)
+				slog.Warn("未找到对应的 PeerConnection", "client", from)
 				continue
 			}
 			var iceCandidate webrtc.ICECandidateInit
@@ -179,25 +301,67 @@ func handleWebSocketMessages(conn *websocket.Conn) {
 }
 
 func main() {
-	// 连接到信令服务器
-	conn, err := connectToSignalingServer()
-	if err != nil {
-		log.Fatal(err)
-	}
-	fmt.Println("连接信令服务器成功")
+	setupLogging := logging.Flags()
+	flag.Parse()
+	setupLogging()
+	connections = newConnectionManager(*maxConsumers)
+	go connections.sweep()
 
 	// 发送注册消息，通知信令服务器本客户端为 B
 	regMsg := Message{
-		Type: "register",
-		Role: "B",
-	}
-	if err := conn.WriteJSON(regMsg); err != nil {
-		log.Fatal("注册失败:", err)
+		Type:        "register",
+		Role:        "B",
+		ID:          *serverID,
+		Name:        *serverName,
+		Description: *description,
 	}
 
-	// 后台处理信令消息
-	go handleWebSocketMessages(conn)
+	// 保持与信令服务器的连接，断开后按指数退避重连并重新注册
+	// 已建立的 WebRTC 连接不依赖信令，重连期间继续传输
+	delay := time.Second
+	for {
+		conn, err := connectToSignalingServer()
+		if err != nil {
+			slog.Warn("连接信令服务器失败", "error", err, "retry_in", delay)
+			time.Sleep(delay)
+			delay = min(delay*2, maxReconnectGap)
+			continue
+		}
+		slog.Info("连接信令服务器成功", "url", *signalingURL)
+		setSignalingConn(conn)
+		if err := writeJSON(regMsg); err != nil {
+			slog.Warn("注册失败", "error", err)
+		}
+
+		// 定期重新注册，保留在信令服务器的服务器目录中
+		done := make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(refreshInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := writeJSON(regMsg); err != nil {
+						slog.Warn("重新注册失败", "error", err)
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		connected := time.Now()
+		handleWebSocketMessages(conn)
+		close(done)
+		setSignalingConn(nil)
+		conn.Close()
 
-	// 防止程序退出
-	select {}
+		// 连接维持了一段时间才重置退避，避免服务器立即断开时频繁重连
+		if time.Since(connected) > pongTimeout {
+			delay = time.Second
+		}
+		slog.Warn("与信令服务器的连接已断开", "retry_in", delay)
+		time.Sleep(delay)
+		delay = min(delay*2, maxReconnectGap)
+	}
 }
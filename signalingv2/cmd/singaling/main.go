@@ -1,12 +1,43 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"encoding/json"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/websocket"
+
+	"signalingv2/internal/logging"
+)
+
+// 服务器选项，参数默认取环境变量
+var (
+	listenAddr      = flag.String("addr", envOr("SIGNALING_ADDR", ":8090"), "监听地址 ($SIGNALING_ADDR)")
+	certFile        = flag.String("tls-cert", os.Getenv("SIGNALING_TLS_CERT_FILE"), "TLS 证书文件，与 -tls-key 一起设置后提供 wss:// ($SIGNALING_TLS_CERT_FILE)")
+	keyFile         = flag.String("tls-key", os.Getenv("SIGNALING_TLS_KEY_FILE"), "TLS 私钥文件 ($SIGNALING_TLS_KEY_FILE)")
+	readTimeout     = flag.Duration("read-timeout", envDuration("SIGNALING_READ_TIMEOUT", 10*time.Second), "读取升级请求的超时时间 ($SIGNALING_READ_TIMEOUT)")
+	writeTimeout    = flag.Duration("write-timeout", envDuration("SIGNALING_WRITE_TIMEOUT", 10*time.Second), "写入升级响应和每条消息的超时时间 ($SIGNALING_WRITE_TIMEOUT)")
+	shutdownTimeout = flag.Duration("shutdown-timeout", envDuration("SIGNALING_SHUTDOWN_TIMEOUT", 10*time.Second), "收到 SIGINT 或 SIGTERM 后等待连接断开的时间 ($SIGNALING_SHUTDOWN_TIMEOUT)")
+	metricsAddr     = flag.String("metrics-addr", os.Getenv("SIGNALING_METRICS_ADDR"), "提供 /metrics 的监听地址，如 127.0.0.1:9090；为空时与 -addr 相同 ($SIGNALING_METRICS_ADDR)")
+)
+
+// 生产者（B）超过 serverTTL 没有发送任何消息就从目录中移除，B 端需要定期重新注册
+const serverTTL = 90 * time.Second
+
+// 每 pingInterval 向连接发送 ping，超过 pongTimeout 没有收到 pong 或消息就断开
+const (
+	pingInterval = 25 * time.Second
+	pongTimeout  = 60 * time.Second
 )
 
 // Message 定义消息结构，新增 Role 字段用于标识身份（B 或 C），以及注册消息
@@ -16,144 +47,394 @@ type Message struct {
 	Candidate string `json:"candidate,omitempty"`
 	Role      string `json:"role,omitempty"` // 用于注册时标识身份，如 "B"
 	From      string `json:"from,omitempty"` // 用于标识消息来源
+	// To 是消费者选择的生产者ID，为空时转发给任意一个生产者
+	To string `json:"to,omitempty"`
+	// ID、Name、Description 是生产者注册时提供的目录信息
+	ID          string       `json:"id,omitempty"`
+	Name        string       `json:"name,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Servers     []ServerInfo `json:"servers,omitempty"`
+}
+
+// ServerInfo 是服务器目录中的一个生产者
+type ServerInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// peer 是一个已连接的生产者或消费者
+type peer struct {
+	conn *websocket.Conn
+	role string
+	// id 对生产者是注册的ID，对消费者是它的 clientId
+	id          string
+	name        string
+	description string
+	lastSeen    time.Time
+	// log 带有连接的ID和角色，注册后替换；转发时其他连接的 goroutine 也会读取
+	log atomic.Pointer[slog.Logger]
+
+	// websocket 同一时间只允许一个写入者
+	writeMu sync.Mutex
+}
+
+func (p *peer) logger() *slog.Logger {
+	return p.log.Load()
 }
 
-// 全局连接存储及角色映射
-var clients = make(map[*websocket.Conn]bool)
-var roles = make(map[*websocket.Conn]string)
-var mu sync.Mutex
+// identify 在连接的ID或角色确定后更新它的 logger，调用时需持有 mu
+func (p *peer) identify() {
+	p.log.Store(slog.With("client", p.id, "role", roleLabel(p.role)))
+}
 
-// 专门存放注册为 B 的连接
-var bConn *websocket.Conn
+func (p *peer) send(msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	if *writeTimeout > 0 {
+		p.conn.SetWriteDeadline(time.Now().Add(*writeTimeout))
+	}
+	if err := p.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return err
+	}
+	sentBytesTotal.add(uint64(len(data)))
+	p.logger().Debug("发送消息", "dir", logging.Out, "type", msg.Type, "from", msg.From, "bytes", len(data))
+	return nil
+}
+
+// 全局连接存储，producers 和 consumers 按ID索引
+var (
+	producers = make(map[string]*peer)
+	consumers = make(map[string]*peer)
+	mu        sync.Mutex
+)
 
 // 处理每个 websocket 连接
 func handleWebSocket(conn *websocket.Conn) {
+	p := &peer{conn: conn, lastSeen: time.Now()}
+	p.log.Store(slog.With("remote_addr", conn.RemoteAddr().String()))
+	// 关闭过程中升级的连接直接关闭，对端稍后重连
+	if !beginPeer(p) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(*writeTimeout))
+		conn.Close()
+		return
+	}
+	defer endPeer(p)
+	stop := make(chan struct{})
 	defer func() {
+		close(stop)
 		mu.Lock()
-		delete(clients, conn)
-		delete(roles, conn)
-		// 如果断开的是 B 连接，清空 bConn
-		if bConn == conn {
-			bConn = nil
+		// 只移除仍指向本连接的条目，同ID的新连接可能已经替换了它
+		if producers[p.id] == p {
+			delete(producers, p.id)
+		}
+		if consumers[p.id] == p {
+			delete(consumers, p.id)
 		}
 		mu.Unlock()
 		conn.Close()
+		if p.role == "" {
+			connectionsTotal.add(1, "unregistered")
+		}
+		p.logger().Info("连接已断开")
 	}()
-
-	// 新连接加入
-	mu.Lock()
-	clients[conn] = true
-	mu.Unlock()
+	keepAlive(conn, stop)
 
 	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			p.logger().Info("读取消息失败", "error", err)
+			break
+		}
+		conn.SetReadDeadline(time.Now().Add(pongTimeout))
+		receivedBytesTotal.add(uint64(len(data)))
+
 		var msg Message
-		if err := conn.ReadJSON(&msg); err != nil {
-			log.Println("Error reading JSON:", err)
+		if err := json.Unmarshal(data, &msg); err != nil {
+			receivedTotal.add(1, "invalid")
+			p.logger().Warn("无效的消息", "dir", logging.In, "error", err)
 			break
 		}
+		receivedTotal.add(1, typeLabel(msg.Type))
+		p.logger().Debug("收到消息", "dir", logging.In, "type", msg.Type, "to", msg.To, "bytes", len(data))
 
-		// 处理注册消息，客户端在连接后应先发送注册消息
-		if msg.Type == "register" {
-			mu.Lock()
-			roles[conn] = msg.Role
-			if msg.Role == "B" {
-				bConn = conn
-				log.Println("注册了B客户端")
-			} else {
-				log.Println("注册了消费者客户端")
+		mu.Lock()
+		p.lastSeen = time.Now()
+		mu.Unlock()
+
+		switch msg.Type {
+		case "register":
+			// 处理注册消息，客户端在连接后应先发送注册消息；生产者定期重复注册以保留在目录中
+			register(p, msg)
+		case "list-servers":
+			if err := p.send(Message{Type: "server-list", Servers: listServers()}); err != nil {
+				p.logger().Warn("发送服务器目录失败", "error", err)
 			}
-			mu.Unlock()
-			continue
+		case "offer", "answer", "candidate":
+			forward(p, msg)
 		}
+	}
+}
 
-		// 根据消息类型做转发处理
-		switch msg.Type {
-		case "offer":
-			// 如果发起消息的连接非B，则转发到B
-			mu.Lock()
-			senderRole := roles[conn]
-			currentBConn := bConn
-			mu.Unlock()
-			if senderRole != "B" {
-				if currentBConn != nil {
-					if err := currentBConn.WriteJSON(msg); err != nil {
-						log.Println("向B转发offer时出错：", err)
-					} else {
-						log.Println("成功将offer转发给B")
-					}
-				} else {
-					log.Println("目前没有注册的B客户端，无法转发offer")
-				}
-			} else {
-				// 如果B发出offer，可根据需要转发给所有消费者（此处按业务需求处理）
-				mu.Lock()
-				for client, role := range roles {
-					if client != conn && role != "B" {
-						if err := client.WriteJSON(msg); err != nil {
-							log.Println("向消费者转发offer时出错：", err)
-						}
-					}
+// keepAlive 定期 ping 连接直到 stop 关闭，对端失联时读取会超时失败
+func keepAlive(conn *websocket.Conn, stop <-chan struct{}) {
+	conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// WriteControl 可以和其他写入并发调用
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+					return
 				}
-				mu.Unlock()
+			case <-stop:
+				return
 			}
-		case "answer":
-			// 如果B发出answer，则转发给所有消费者
-			mu.Lock()
-			for client, role := range roles {
-				if client != conn && role != "B" {
-					if err := client.WriteJSON(msg); err != nil {
-						log.Println("向消费者转发answer时出错：", err)
-					}
-				}
+		}
+	}()
+}
+
+// register 记录连接的身份，生产者按ID加入服务器目录
+func register(p *peer, msg Message) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	// 连接按第一次注册的角色计数
+	if p.role == "" {
+		connectionsTotal.add(1, roleLabel(msg.Role))
+	}
+	if msg.Role != "B" {
+		p.role = msg.Role
+		if msg.From != "" && p.id != msg.From {
+			if consumers[p.id] == p {
+				delete(consumers, p.id)
 			}
-			mu.Unlock()
-		case "candidate":
-			// ICE候选信息，根据发消息方决定转发对象：
-			mu.Lock()
-			senderRole := roles[conn]
-			currentBConn := bConn
-			mu.Unlock()
-			if senderRole != "B" {
-				// 消费者发送 ICE 信息，转发给 B
-				if currentBConn != nil {
-					if err := currentBConn.WriteJSON(msg); err != nil {
-						log.Println("向B转发candidate时出错：", err)
-					}
-				} else {
-					log.Println("目前没有注册的B客户端，无法转发candidate")
-				}
-			} else {
-				// 如果B发出 candidate，则转发给所有消费者
-				mu.Lock()
-				for client, role := range roles {
-					if client != conn && role != "B" {
-						if err := client.WriteJSON(msg); err != nil {
-							log.Println("向消费者转发candidate时出错：", err)
-						}
-					}
-				}
-				mu.Unlock()
+			p.id = msg.From
+			consumers[p.id] = p
+		}
+		p.identify()
+		p.logger().Info("注册了消费者")
+		return
+	}
+
+	// 旧版 B 端不带ID，使用 "B" 作为ID
+	id := msg.ID
+	if id == "" {
+		id = "B"
+	}
+	if p.role == "B" && p.id != id {
+		delete(producers, p.id)
+	}
+	name := msg.Name
+	if name == "" {
+		name = id
+	}
+	refreshed := p.role == "B" && p.id == id
+	p.role, p.id, p.name, p.description = "B", id, name, msg.Description
+	producers[id] = p
+	if !refreshed {
+		p.identify()
+		p.logger().Info("注册了B端", "name", name)
+	}
+}
+
+// listServers 返回按名称排序的生产者目录
+func listServers() []ServerInfo {
+	mu.Lock()
+	servers := make([]ServerInfo, 0, len(producers))
+	for _, p := range producers {
+		servers = append(servers, ServerInfo{ID: p.id, Name: p.name, Description: p.description})
+	}
+	mu.Unlock()
+	sort.Slice(servers, func(i, j int) bool {
+		if servers[i].Name != servers[j].Name {
+			return servers[i].Name < servers[j].Name
+		}
+		return servers[i].ID < servers[j].ID
+	})
+	return servers
+}
+
+// forward 转发 offer、answer 和 candidate：
+// 消费者的消息转发给 To 指定的生产者，生产者的消息转发给 From 指定的消费者
+func forward(sender *peer, msg Message) {
+	// 关闭时等待已开始的转发完成
+	if !beginForward() {
+		forwardFailuresTotal.add(1, typeLabel(msg.Type), codeShuttingDown)
+		sender.logger().Info("服务器正在关闭，丢弃消息", "type", msg.Type)
+		return
+	}
+	defer drain.forwards.Done()
+
+	mu.Lock()
+	var target *peer
+	if sender.role == "B" {
+		target = consumers[msg.From]
+	} else {
+		// 消费者在 offer 中带上 clientId，之后生产者的回复按它转发
+		if msg.From != "" && sender.id == "" {
+			sender.id = msg.From
+			consumers[msg.From] = sender
+			sender.identify()
+		}
+		msg.From = sender.id
+		if msg.To != "" {
+			target = producers[msg.To]
+		} else {
+			for _, p := range producers {
+				target = p
+				break
 			}
 		}
 	}
+	var targetID string
+	if target != nil {
+		targetID = target.id
+	}
+	mu.Unlock()
+
+	if target == nil {
+		forwardFailuresTotal.add(1, typeLabel(msg.Type), codePeerOffline)
+		if sender.role == "B" {
+			sender.logger().Warn("消费者不在线，无法转发", "type", msg.Type, "to", msg.From)
+		} else {
+			sender.logger().Warn("生产者不在线，无法转发", "type", msg.Type, "to", msg.To)
+		}
+		return
+	}
+	if err := target.send(msg); err != nil {
+		forwardFailuresTotal.add(1, typeLabel(msg.Type), codeSendFailed)
+		sender.logger().Warn("转发失败", "type", msg.Type, "to", targetID, "error", err)
+		return
+	}
+	forwardedTotal.add(1, typeLabel(msg.Type))
+	if msg.Type == "offer" {
+		sender.logger().Info("成功转发offer", "to", targetID)
+	}
+}
+
+// expireServers 把超过 serverTTL 没有消息的生产者移出目录并关闭其连接
+func expireServers() {
+	ticker := time.NewTicker(serverTTL / 3)
+	defer ticker.Stop()
+	for range ticker.C {
+		mu.Lock()
+		for id, p := range producers {
+			if time.Since(p.lastSeen) > serverTTL {
+				p.logger().Info("生产者超时，移出目录")
+				delete(producers, id)
+				p.conn.Close()
+			}
+		}
+		mu.Unlock()
+	}
 }
 
 func main() {
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+	setupLogging := logging.Flags()
+	flag.Parse()
+	setupLogging()
+	if (*certFile == "") != (*keyFile == "") {
+		log.Fatal("-tls-cert 和 -tls-key 必须同时设置")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		upgrader := websocket.Upgrader{
+			HandshakeTimeout: *writeTimeout,
 			// 允许跨域
 			CheckOrigin: func(r *http.Request) bool { return true },
 		}
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
-			log.Println("WebSocket升级失败：", err)
+			slog.Warn("WebSocket升级失败", "remote_addr", r.RemoteAddr, "error", err)
 			return
 		}
 		handleWebSocket(conn)
 	})
+	go expireServers()
+
+	// /metrics 在 -metrics-addr 上提供，未设置时与 WebSocket 使用同一地址
+	var servers []*http.Server
+	if *metricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.HandleFunc("/metrics", handleMetrics)
+		metricsServer := &http.Server{Addr: *metricsAddr, Handler: metricsMux, ReadTimeout: *readTimeout, WriteTimeout: *writeTimeout}
+		servers = append(servers, metricsServer)
+		slog.Info("指标服务器启动", "addr", *metricsAddr)
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("指标服务器出错", "error", err)
+			}
+		}()
+	} else {
+		mux.HandleFunc("/metrics", handleMetrics)
+	}
 
-	fmt.Println("信令服务器启动，监听 :8090")
-	if err := http.ListenAndServe(":8090", nil); err != nil {
+	server := &http.Server{
+		Addr:         *listenAddr,
+		Handler:      mux,
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+		IdleTimeout:  120 * time.Second,
+	}
+	servers = append(servers, server)
+	serveErr := make(chan error, 1)
+	go func() {
+		if *certFile != "" {
+			slog.Info("信令服务器启动", "addr", *listenAddr, "scheme", "wss")
+			serveErr <- server.ListenAndServeTLS(*certFile, *keyFile)
+		} else {
+			slog.Info("信令服务器启动", "addr", *listenAddr, "scheme", "ws")
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	// 收到 SIGINT 或 SIGTERM 时优雅关闭，与后端一致
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
 		log.Fatal("启动服务器时出错：", err)
+	case sig := <-quit:
+		slog.Info("正在关闭", "signal", sig.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := shutdown(ctx, servers...); err != nil {
+		cancel()
+		log.Fatal("强制关闭：", err)
+	}
+	slog.Info("信令服务器已停止")
+}
+
+// envOr 返回环境变量 key 的值，未设置时返回 def
+func envOr(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// envDuration 把环境变量 key 解析为时长（如 "30s"），未设置时返回 def
+func envDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s 无效: %v", key, err)
 	}
+	return d
 }
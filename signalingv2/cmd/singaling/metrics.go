@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// counter 是只增不减的指标，按标签的值分别计数
+type counter struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+func newCounter(name, help string, labels ...string) *counter {
+	return &counter{name: name, help: help, labels: labels, values: make(map[string]uint64)}
+}
+
+// add 给标签值为 values（按标签的顺序）的计数加 n
+func (c *counter) add(n uint64, values ...string) {
+	key := strings.Join(values, "\x00")
+	c.mu.Lock()
+	c.values[key] += n
+	c.mu.Unlock()
+}
+
+func (c *counter) write(w io.Writer) {
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	samples := make([]string, len(keys))
+	for i, key := range keys {
+		samples[i] = fmt.Sprintf("%s%s %d\n", c.name, labelSet(c.labels, strings.Split(key, "\x00")), c.values[key])
+	}
+	c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	if len(c.labels) == 0 && len(samples) == 0 {
+		// 无标签的计数器从 0 开始
+		fmt.Fprintf(w, "%s 0\n", c.name)
+	}
+	for _, sample := range samples {
+		io.WriteString(w, sample)
+	}
+}
+
+// labelSet 把标签名和值格式化为 {name="value",...}
+func labelSet(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, values[i])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// 信令服务器的指标，名称与 signaling 服务器相同；signalingv2 不校验令牌，没有拒绝连接的计数
+var (
+	connectionsTotal = newCounter("signaling_connections_total",
+		"WebSocket connections, by the role they first registered with, or unregistered when they close without registering", "role")
+	receivedTotal = newCounter("signaling_messages_received_total",
+		"Messages received from peers, by type", "type")
+	forwardedTotal = newCounter("signaling_messages_forwarded_total",
+		"Messages delivered from one peer to another, by type", "type")
+	forwardFailuresTotal = newCounter("signaling_forward_failures_total",
+		"Messages that could not be delivered to their recipient, by type and reason", "type", "code")
+	receivedBytesTotal = newCounter("signaling_received_bytes_total",
+		"Bytes of messages received from peers")
+	sentBytesTotal = newCounter("signaling_sent_bytes_total",
+		"Bytes of messages sent to peers, forwarded or from the server")
+
+	counters = []*counter{connectionsTotal, receivedTotal, forwardedTotal, forwardFailuresTotal, receivedBytesTotal, sentBytesTotal}
+)
+
+// 转发失败的原因，即 code 标签的值
+const (
+	codePeerOffline  = "peer-offline"
+	codeSendFailed   = "send-failed"
+	codeShuttingDown = "shutting-down"
+)
+
+// typeLabel 返回消息类型的标签；服务器不处理的类型记为 "other"，避免未知类型产生无限多的序列
+func typeLabel(t string) string {
+	switch t {
+	case "register", "list-servers", "offer", "answer", "candidate":
+		return t
+	}
+	return "other"
+}
+
+// roleLabel 返回角色的标签，B 端为 "B"，其余为消费者 "C"
+func roleLabel(role string) string {
+	if role == "B" {
+		return "B"
+	}
+	return "C"
+}
+
+// handleMetrics 以 Prometheus 文本格式提供指标
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	b, c := len(producers), len(consumers)
+	mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprintf(w, "# HELP signaling_connected_peers Registered peers, by role\n# TYPE signaling_connected_peers gauge\n")
+	fmt.Fprintf(w, "signaling_connected_peers{role=%q} %d\n", "B", b)
+	fmt.Fprintf(w, "signaling_connected_peers{role=%q} %d\n", "C", c)
+	for _, c := range counters {
+		c.write(w)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"signalingv2/internal/logging"
+)
+
+// drain 记录当前的连接和正在进行的转发，关闭时等待它们结束；closing 置位后不再接受新的连接和转发
+var drain struct {
+	mu       sync.Mutex
+	closing  bool
+	peers    map[*peer]bool
+	peersWG  sync.WaitGroup
+	forwards sync.WaitGroup
+}
+
+// beginPeer 登记新连接，关闭过程中返回 false；连接处理结束时调用 endPeer
+func beginPeer(p *peer) bool {
+	drain.mu.Lock()
+	defer drain.mu.Unlock()
+	if drain.closing {
+		return false
+	}
+	if drain.peers == nil {
+		drain.peers = make(map[*peer]bool)
+	}
+	drain.peers[p] = true
+	drain.peersWG.Add(1)
+	return true
+}
+
+func endPeer(p *peer) {
+	drain.mu.Lock()
+	delete(drain.peers, p)
+	drain.mu.Unlock()
+	drain.peersWG.Done()
+}
+
+// beginForward 登记一次转发，关闭过程中返回 false；发送完成后调用 drain.forwards.Done
+func beginForward() bool {
+	drain.mu.Lock()
+	defer drain.mu.Unlock()
+	if drain.closing {
+		return false
+	}
+	drain.forwards.Add(1)
+	return true
+}
+
+// shutdown 停止各个 server 接受新连接，通知所有对端服务器即将关闭，等待正在进行的转发后关闭 WebSocket。
+// 超过 ctx 的期限仍未断开的连接被强制关闭，此时返回 ctx 的错误
+func shutdown(ctx context.Context, servers ...*http.Server) error {
+	// 已升级的 WebSocket 连接不受 http.Server.Shutdown 管理
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Warn("关闭监听时出错", "addr", server.Addr, "error", err)
+		}
+	}
+
+	drain.mu.Lock()
+	drain.closing = true
+	peers := make([]*peer, 0, len(drain.peers))
+	for p := range drain.peers {
+		peers = append(peers, p)
+	}
+	drain.mu.Unlock()
+
+	slog.Info("通知各连接服务器即将关闭", "peers", len(peers))
+	for _, p := range peers {
+		if err := p.send(Message{Type: "server-shutdown"}); err != nil {
+			p.logger().Warn("通知服务器关闭失败", "dir", logging.Out, "type", "server-shutdown", "error", err)
+		}
+	}
+	if !wait(ctx, &drain.forwards) {
+		slog.Warn("等待转发超时")
+	}
+
+	// 对端回复关闭帧后读取循环结束
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	deadline := time.Now().Add(*writeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	for _, p := range peers {
+		p.conn.WriteControl(websocket.CloseMessage, closeMsg, deadline)
+	}
+	if wait(ctx, &drain.peersWG) {
+		return nil
+	}
+
+	drain.mu.Lock()
+	slog.Warn("强制关闭未及时断开的连接", "peers", len(drain.peers))
+	for p := range drain.peers {
+		p.conn.Close()
+	}
+	drain.mu.Unlock()
+	return ctx.Err()
+}
+
+// wait 等待 wg 直到 ctx 结束，返回 wg 是否已完成
+func wait(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,71 @@
+// Package logging 设置 signalingv2 各程序的结构化日志。
+//
+// 关于某个对端的日志用 "client" 记录它的ID，关于信令消息的日志记录 "type" 和
+// "dir"（收到为 "in"，发送为 "out"），便于对照信令服务器、B 端和消费者的日志。
+package logging
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// 信令消息的方向，即 "dir" 属性的值
+const (
+	In  = "in"
+	Out = "out"
+)
+
+// Flags 注册 -log-format 和 -log-level 参数，默认取 $SIGNALING_LOG_FORMAT 和
+// $SIGNALING_LOG_LEVEL；返回的函数在参数解析后调用 Setup
+func Flags() func() {
+	format := flag.String("log-format", envOr("SIGNALING_LOG_FORMAT", "text"), "日志格式，text 或 json ($SIGNALING_LOG_FORMAT)")
+	level := flag.String("log-level", envOr("SIGNALING_LOG_LEVEL", "info"), "日志级别，debug、info、warn 或 error ($SIGNALING_LOG_LEVEL)")
+	return func() {
+		Setup(*format, *level)
+	}
+}
+
+// Setup 让默认 logger 以 format（"json" 或 "text"）格式写入 stderr，丢弃低于 level 的记录；
+// log 包的输出也经过它
+func Setup(format, level string) {
+	opts := &slog.HandlerOptions{Level: parseLevel(level)}
+
+	var handler slog.Handler
+	if strings.EqualFold(format, "json") {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// MessageLevel 是 t 类型的信令消息的日志级别：ICE 候选和重复的注册只在 debug 级别记录
+func MessageLevel(t string) slog.Level {
+	if t == "candidate" || t == "register" {
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
+// parseLevel 解析日志级别，无法识别时为 info
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func envOr(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
@@ -4,11 +4,14 @@ import (
 	"flag"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"signalingv2/internal/logging"
 )
 
 var upgrader = websocket.Upgrader{
@@ -20,16 +23,17 @@ var upgrader = websocket.Upgrader{
 func wsHandler(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("Upgrade error:", err)
+		slog.Warn("upgrade failed", "remote_addr", r.RemoteAddr, "error", err)
 		return
 	}
 	defer conn.Close()
+	logger := slog.With("remote_addr", r.RemoteAddr)
 
 	// 打开本地 H264 文件，逐帧发送
 	filename := flag.Lookup("file").Value.String()
 	file, err := os.Open(filename)
 	if err != nil {
-		log.Println("Open file error:", err)
+		logger.Warn("opening file failed", "file", filename, "error", err)
 		return
 	}
 	defer file.Close()
@@ -41,12 +45,12 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 			if err == io.EOF {
 				break
 			}
-			log.Println("Read error:", err)
+			logger.Warn("reading file failed", "file", filename, "error", err)
 			return
 		}
 		err = conn.WriteMessage(websocket.BinaryMessage, buf[:n])
 		if err != nil {
-			log.Println("WebSocket write error:", err)
+			logger.Warn("WebSocket write failed", "error", err)
 			return
 		}
 		time.Sleep(33 * time.Millisecond) // 约30fps
@@ -55,9 +59,11 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 
 func main() {
 	flag.String("file", "test.h264", "H264 file to send")
+	setupLogging := logging.Flags()
 	flag.Parse()
+	setupLogging()
 
 	http.HandleFunc("/ws", wsHandler)
-	log.Println("WebSocket server started at :8080/ws")
+	slog.Info("WebSocket server started", "addr", ":8080", "path", "/ws")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }